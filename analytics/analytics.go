@@ -0,0 +1,340 @@
+// Package analytics aggregates the transactions of an account into money in
+// and money out by day, week or month with a breakdown by category, and
+// compares a period with the one right before it.
+package analytics
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+	"time"
+
+	"github.com/eclipseron/digital-wallet-app/models"
+	"github.com/eclipseron/digital-wallet-app/settlement"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+const (
+	IntervalDay   = "day"
+	IntervalWeek  = "week"
+	IntervalMonth = "month"
+)
+
+// MaxBuckets bounds the number of buckets of one report.
+const MaxBuckets = 366
+
+var (
+	ErrInterval = errors.New("interval must be day, week or month")
+	ErrRange    = fmt.Errorf("a report covers between 1 and %d buckets", MaxBuckets)
+)
+
+// Truncate returns the start of the bucket t falls in. Weeks start on
+// Monday, all in Asia/Jakarta.
+func Truncate(t time.Time, interval string) time.Time {
+	t = t.In(settlement.Location)
+	day := time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, settlement.Location)
+	switch interval {
+	case IntervalWeek:
+		return day.AddDate(0, 0, -(int(day.Weekday())+6)%7)
+	case IntervalMonth:
+		return day.AddDate(0, 0, 1-day.Day())
+	}
+	return day
+}
+
+// Next returns the start of the bucket after the one starting at start.
+func Next(start time.Time, interval string) time.Time {
+	switch interval {
+	case IntervalWeek:
+		return start.AddDate(0, 0, 7)
+	case IntervalMonth:
+		return start.AddDate(0, 1, 0)
+	}
+	return start.AddDate(0, 0, 1)
+}
+
+// Previous returns the start of the bucket before the one starting at start.
+func Previous(start time.Time, interval string) time.Time {
+	switch interval {
+	case IntervalWeek:
+		return start.AddDate(0, 0, -7)
+	case IntervalMonth:
+		return start.AddDate(0, -1, 0)
+	}
+	return start.AddDate(0, 0, -1)
+}
+
+// CategoryTotal adds up the transactions of one category.
+type CategoryTotal struct {
+	Category string `json:"category"`
+	MoneyIn  int64  `json:"moneyIn"`
+	MoneyOut int64  `json:"moneyOut"`
+	Count    int64  `json:"count"`
+}
+
+// Totals is money in and out of a bucket or a whole period. MoneyOut is
+// positive, Net is MoneyIn - MoneyOut.
+type Totals struct {
+	MoneyIn    int64           `json:"moneyIn"`
+	MoneyOut   int64           `json:"moneyOut"`
+	Net        int64           `json:"net"`
+	Count      int64           `json:"count"`
+	Categories []CategoryTotal `json:"categories"`
+}
+
+// Bucket is one day, week or month.
+type Bucket struct {
+	Start string `json:"start"`
+	Totals
+}
+
+// CategoryChange compares the spending of one category with the previous
+// period. Change is in percent, nil when nothing was spent before.
+type CategoryChange struct {
+	Category string   `json:"category"`
+	MoneyOut int64    `json:"moneyOut"`
+	Previous int64    `json:"previousMoneyOut"`
+	Change   *float64 `json:"change"`
+}
+
+// Comparison is a period against the period of the same number of buckets
+// right before it.
+type Comparison struct {
+	From           string           `json:"from"`
+	To             string           `json:"to"`
+	MoneyIn        int64            `json:"moneyIn"`
+	MoneyOut       int64            `json:"moneyOut"`
+	Net            int64            `json:"net"`
+	MoneyInChange  *float64         `json:"moneyInChange"`
+	MoneyOutChange *float64         `json:"moneyOutChange"`
+	Categories     []CategoryChange `json:"categories"`
+}
+
+// Report covers From to To, both included. Previous covers the same number
+// of buckets right before From.
+type Report struct {
+	AccountID uuid.UUID  `json:"accountId"`
+	Interval  string     `json:"interval"`
+	From      string     `json:"from"`
+	To        string     `json:"to"`
+	TimeZone  string     `json:"timeZone"`
+	Buckets   []Bucket   `json:"buckets"`
+	Total     Totals     `json:"total"`
+	Previous  Comparison `json:"previous"`
+}
+
+// Row is one category of one bucket as grouped by the database. Bucket is
+// the YYYY-MM-DD the bucket starts on.
+type Row struct {
+	Bucket   string
+	Category string
+	MoneyIn  int64
+	MoneyOut int64
+	Count    int64
+}
+
+// Build reports on accountID from the bucket from falls in to the bucket to
+// falls in, both included. Buckets without activity are included. The
+// previous period is read by the same grouped query.
+func Build(db *gorm.DB, accountID uuid.UUID, interval string, from, to time.Time) (*Report, error) {
+	if interval != IntervalDay && interval != IntervalWeek && interval != IntervalMonth {
+		return nil, ErrInterval
+	}
+	start, end := Truncate(from, interval), Next(Truncate(to, interval), interval)
+	var starts []time.Time
+	for b := start; b.Before(end); b = Next(b, interval) {
+		if len(starts) == MaxBuckets {
+			return nil, ErrRange
+		}
+		starts = append(starts, b)
+	}
+	if len(starts) == 0 {
+		return nil, ErrRange
+	}
+	prevStart := start
+	for range starts {
+		prevStart = Previous(prevStart, interval)
+	}
+
+	var rows []Row
+	err := db.Raw(`
+	SELECT to_char(date_trunc(?, created_at AT TIME ZONE ?), 'YYYY-MM-DD') AS bucket, category,
+		COALESCE(SUM(amount) FILTER (WHERE amount > 0), 0) AS money_in,
+		COALESCE(-SUM(amount) FILTER (WHERE amount < 0), 0) AS money_out,
+		COUNT(*) AS count
+	FROM transactions
+	WHERE account_id = ? AND deleted_at IS NULL AND created_at >= ? AND created_at < ?
+	GROUP BY 1, 2
+	`, interval, settlement.Location.String(), accountID.String(), prevStart, end).Scan(&rows).Error
+	if err != nil {
+		return nil, err
+	}
+
+	report := Assemble(rows, interval, prevStart, starts)
+	report.AccountID = accountID
+	return report, nil
+}
+
+// Assemble lays grouped rows out over the buckets starting at starts and
+// folds the rows before the first of them, from prevStart on, into the
+// comparison.
+func Assemble(rows []Row, interval string, prevStart time.Time, starts []time.Time) *Report {
+	first := starts[0].Format(time.DateOnly)
+	last := Previous(Next(starts[len(starts)-1], interval), IntervalDay)
+	report := &Report{
+		Interval: interval,
+		From:     first,
+		To:       last.Format(time.DateOnly),
+		TimeZone: settlement.Location.String(),
+		Buckets:  make([]Bucket, len(starts)),
+	}
+	index := map[string]int{}
+	for i, s := range starts {
+		key := s.Format(time.DateOnly)
+		index[key] = i
+		report.Buckets[i] = Bucket{Start: key, Totals: Totals{Categories: []CategoryTotal{}}}
+	}
+
+	var previous Totals
+	for _, r := range rows {
+		if r.Bucket < first {
+			previous.add(r)
+			continue
+		}
+		i, ok := index[r.Bucket]
+		if !ok {
+			continue
+		}
+		report.Buckets[i].add(r)
+		report.Total.add(r)
+	}
+	for i := range report.Buckets {
+		report.Buckets[i].sortCategories()
+	}
+	report.Total.sortCategories()
+	if report.Total.Categories == nil {
+		report.Total.Categories = []CategoryTotal{}
+	}
+
+	report.Previous = Comparison{
+		From:           prevStart.Format(time.DateOnly),
+		To:             Previous(starts[0], IntervalDay).Format(time.DateOnly),
+		MoneyIn:        previous.MoneyIn,
+		MoneyOut:       previous.MoneyOut,
+		Net:            previous.Net,
+		MoneyInChange:  Change(previous.MoneyIn, report.Total.MoneyIn),
+		MoneyOutChange: Change(previous.MoneyOut, report.Total.MoneyOut),
+		Categories:     []CategoryChange{},
+	}
+	before := map[string]int64{}
+	for _, c := range previous.Categories {
+		before[c.Category] = c.MoneyOut
+	}
+	for _, category := range models.Categories {
+		now, prev := int64(0), before[category]
+		for _, c := range report.Total.Categories {
+			if c.Category == category {
+				now = c.MoneyOut
+			}
+		}
+		if now == 0 && prev == 0 {
+			continue
+		}
+		report.Previous.Categories = append(report.Previous.Categories, CategoryChange{
+			Category: category,
+			MoneyOut: now,
+			Previous: prev,
+			Change:   Change(prev, now),
+		})
+	}
+	return report
+}
+
+func (t *Totals) add(r Row) {
+	t.MoneyIn += r.MoneyIn
+	t.MoneyOut += r.MoneyOut
+	t.Net = t.MoneyIn - t.MoneyOut
+	t.Count += r.Count
+	for i := range t.Categories {
+		if t.Categories[i].Category == r.Category {
+			t.Categories[i].MoneyIn += r.MoneyIn
+			t.Categories[i].MoneyOut += r.MoneyOut
+			t.Categories[i].Count += r.Count
+			return
+		}
+	}
+	t.Categories = append(t.Categories, CategoryTotal{
+		Category: r.Category,
+		MoneyIn:  r.MoneyIn,
+		MoneyOut: r.MoneyOut,
+		Count:    r.Count,
+	})
+}
+
+// sortCategories puts the biggest spending first.
+func (t *Totals) sortCategories() {
+	sort.SliceStable(t.Categories, func(i, j int) bool {
+		a, b := t.Categories[i], t.Categories[j]
+		if a.MoneyOut != b.MoneyOut {
+			return a.MoneyOut > b.MoneyOut
+		}
+		return a.Category < b.Category
+	})
+}
+
+// Change is the change from prev to now in percent with one decimal, nil
+// when prev is 0.
+func Change(prev, now int64) *float64 {
+	if prev == 0 {
+		return nil
+	}
+	change := math.Round(float64(now-prev)*1000/float64(prev)) / 10
+	return &change
+}
+
+// Recategorize runs the category rules again over every transaction the
+// account holder has not overridden, 500 at a time, and returns how many
+// changed. It backfills rows written before categories existed.
+func Recategorize(db *gorm.DB) (int64, error) {
+	type entry struct {
+		ID          uuid.UUID
+		Type        string
+		Amount      int64
+		BankName    *string
+		Description *string
+		Category    string
+	}
+
+	var changed int64
+	after := uuid.Nil
+	for {
+		var batch []entry
+		err := db.Raw(`
+		SELECT id, type, amount, bank_name, description, category FROM transactions
+		WHERE id > ? AND NOT category_overridden
+		ORDER BY id LIMIT 500
+		`, after.String()).Scan(&batch).Error
+		if err != nil {
+			return changed, err
+		}
+		if len(batch) == 0 {
+			return changed, nil
+		}
+		for _, e := range batch {
+			category := models.Categorize(e.Type, e.Amount, e.BankName, e.Description)
+			if category == e.Category {
+				continue
+			}
+			res := db.Exec(`
+			UPDATE transactions SET category = ? WHERE id = ? AND NOT category_overridden
+			`, category, e.ID.String())
+			if res.Error != nil {
+				return changed, res.Error
+			}
+			changed += res.RowsAffected
+		}
+		after = batch[len(batch)-1].ID
+	}
+}
@@ -0,0 +1,393 @@
+// Package atm issues cardless cash withdrawal codes and redeems them for the
+// ATM network. A code reserves its amount with a ledger hold: redeeming it
+// captures the hold as a WITHDRAW, cancelling, blocking or expiring it
+// releases the hold.
+package atm
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"math/big"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/eclipseron/digital-wallet-app/ledger"
+	"github.com/eclipseron/digital-wallet-app/models"
+	"github.com/eclipseron/digital-wallet-app/utils"
+	"github.com/eclipseron/digital-wallet-app/webhooks"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+const (
+	// MinAmount, MaxAmount and Denomination bound what one code can withdraw,
+	// ATMs only dispense whole notes.
+	MinAmount    = 50000
+	MaxAmount    = 5000000
+	Denomination = 50000
+	// MaxPinFailures wrong PINs block a code.
+	MaxPinFailures = 3
+	// SignatureTolerance is how far the timestamp of a signed callback may
+	// be from now.
+	SignatureTolerance = 5 * time.Minute
+
+	codeDigits = 12
+	pinDigits  = 6
+)
+
+var (
+	ErrAmount        = fmt.Errorf("amount must be a multiple of %d between %d and %d", Denomination, MinAmount, MaxAmount)
+	ErrCodeNotFound  = errors.New("withdrawal code not found")
+	ErrCodeNotActive = errors.New("withdrawal code is no longer active")
+	ErrCodeExpired   = errors.New("withdrawal code has expired")
+	ErrPinInvalid    = errors.New("invalid withdrawal pin")
+	ErrCodeBlocked   = errors.New("too many invalid pins, withdrawal code blocked")
+	ErrReferenceUsed = errors.New("network reference already used for another code")
+	ErrSignature     = errors.New("invalid or missing signature")
+	ErrNetworkSecret = errors.New("ATM_NETWORK_SECRET is not set")
+	ErrRedemption    = errors.New("a 12 digit code, a 6 digit pin, terminalId and reference are required")
+)
+
+// CodeTTL reads ATM_CODE_TTL, how long a code can be redeemed, 30 minutes by
+// default and at most a day.
+func CodeTTL() time.Duration {
+	ttl, err := time.ParseDuration(os.Getenv("ATM_CODE_TTL"))
+	if err != nil || ttl <= 0 || ttl > 24*time.Hour {
+		return 30 * time.Minute
+	}
+	return ttl
+}
+
+// HashCode is the lookup hash of a code.
+func HashCode(code string) string {
+	sum := sha256.Sum256([]byte(code))
+	return hex.EncodeToString(sum[:])
+}
+
+func digits(n int) (string, error) {
+	limit := new(big.Int).Exp(big.NewInt(10), big.NewInt(int64(n)), nil)
+	v, err := rand.Int(rand.Reader, limit)
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%0*d", n, v), nil
+}
+
+func isDigits(s string, n int) bool {
+	if len(s) != n {
+		return false
+	}
+	for _, r := range s {
+		if r < '0' || r > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+// Issue reserves amount on accountID and creates a code for it, returned
+// with the plain code and PIN. It must run inside a transaction.
+func Issue(tx *gorm.DB, accountID, userID uuid.UUID, amount int64) (*models.ATMCode, string, string, error) {
+	if amount < MinAmount || amount > MaxAmount || amount%Denomination != 0 {
+		return nil, "", "", ErrAmount
+	}
+	code, err := digits(codeDigits)
+	if err != nil {
+		return nil, "", "", err
+	}
+	pin, err := digits(pinDigits)
+	if err != nil {
+		return nil, "", "", err
+	}
+	pinHash, err := utils.CreateHash(pin)
+	if err != nil {
+		return nil, "", "", err
+	}
+
+	id := uuid.New()
+	reference := "atm:" + id.String()
+	desc := "Cardless ATM Withdrawal"
+	bank := "ATM"
+	owner := models.HoldOwnerATM
+	hold := models.Hold{
+		AccountID:   accountID,
+		Amount:      amount,
+		Reference:   &reference,
+		Description: &desc,
+		BankName:    &bank,
+		Owner:       &owner,
+		ExpiresAt:   time.Now().Add(CodeTTL()),
+	}
+	if err := ledger.PlaceHold(tx, &hold); err != nil {
+		return nil, "", "", err
+	}
+
+	atmCode := models.ATMCode{
+		ID:        id,
+		AccountID: accountID,
+		UserID:    userID,
+		HoldID:    hold.ID,
+		Amount:    amount,
+		CodeHash:  HashCode(code),
+		PinHash:   pinHash,
+		Status:    models.ATMCodeStatusActive,
+		ExpiresAt: hold.ExpiresAt,
+	}
+	if err := tx.Create(&atmCode).Error; err != nil {
+		return nil, "", "", err
+	}
+	return &atmCode, code, pin, nil
+}
+
+func lockCode(tx *gorm.DB, where string, args ...any) (*models.ATMCode, error) {
+	var code models.ATMCode
+	res := tx.Raw(`SELECT * FROM atm_codes WHERE `+where+` FOR UPDATE`, args...).Scan(&code)
+	if res.Error != nil {
+		return nil, res.Error
+	}
+	if res.RowsAffected == 0 {
+		return nil, ErrCodeNotFound
+	}
+	return &code, nil
+}
+
+// closeCode takes an active code out of use with status and releases its hold.
+// A hold that was already released, by the hold expiry or by hand, is fine.
+func closeCode(tx *gorm.DB, code *models.ATMCode, status string) error {
+	holdStatus := models.HoldStatusVoided
+	if status == models.ATMCodeStatusExpired {
+		holdStatus = models.HoldStatusExpired
+	}
+	if _, err := ledger.ReleaseHold(tx, code.HoldID, holdStatus); err != nil && !errors.Is(err, ledger.ErrHoldNotActive) {
+		return err
+	}
+	now := time.Now()
+	code.Status = status
+	code.ClosedAt = &now
+	return tx.Model(code).Select("status", "pin_failures", "closed_at", "updated_at").Updates(code).Error
+}
+
+// Cancel cancels an active code of accountID. It must run inside a
+// transaction.
+func Cancel(tx *gorm.DB, accountID, codeID uuid.UUID) (*models.ATMCode, error) {
+	code, err := lockCode(tx, "id = ? AND account_id = ?", codeID.String(), accountID.String())
+	if err != nil {
+		return nil, err
+	}
+	if code.Status != models.ATMCodeStatusActive {
+		return code, ErrCodeNotActive
+	}
+	return code, closeCode(tx, code, models.ATMCodeStatusCancelled)
+}
+
+// Redemption is the ATM network's request to pay out a code.
+type Redemption struct {
+	Code       string `json:"code"`
+	Pin        string `json:"pin"`
+	TerminalID string `json:"terminalId"`
+	Reference  string `json:"reference"`
+}
+
+// Redeem checks the code and PIN and captures the code's hold. It runs its
+// own transaction so a wrong PIN, a block or an expiry is committed even
+// though the redemption fails, audit is called in that transaction with the
+// code's status before and the outcome whenever the code was found. A retry
+// with the reference of a redeemed code returns that code again.
+func Redeem(ctx context.Context, db *gorm.DB, req Redemption,
+	audit func(tx *gorm.DB, code *models.ATMCode, before string, result error) error) (*models.ATMCode, error) {
+	if !isDigits(req.Code, codeDigits) || !isDigits(req.Pin, pinDigits) ||
+		req.TerminalID == "" || len(req.TerminalID) > 16 || req.Reference == "" || len(req.Reference) > 64 {
+		return nil, ErrRedemption
+	}
+
+	var result error
+	var code *models.ATMCode
+	err := db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		var err error
+		code, err = lockCode(tx, "code_hash = ?", HashCode(req.Code))
+		if errors.Is(err, ErrCodeNotFound) {
+			result = err
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		before := code.Status
+		if result, err = redeem(tx, code, req); err != nil {
+			return err
+		}
+		return audit(tx, code, before, result)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return code, result
+}
+
+// redeem moves a locked code on. The outcome for the ATM network is result,
+// err is reserved for failures that roll everything back.
+func redeem(tx *gorm.DB, code *models.ATMCode, req Redemption) (result error, err error) {
+	if code.Status == models.ATMCodeStatusRedeemed {
+		if code.NetworkReference != nil && *code.NetworkReference == req.Reference && utils.IsValid(code.PinHash, req.Pin) {
+			return nil, nil
+		}
+		return ErrCodeNotActive, nil
+	}
+	if code.Status != models.ATMCodeStatusActive {
+		return ErrCodeNotActive, nil
+	}
+	if !time.Now().Before(code.ExpiresAt) {
+		return ErrCodeExpired, closeCode(tx, code, models.ATMCodeStatusExpired)
+	}
+	if !utils.IsValid(code.PinHash, req.Pin) {
+		code.PinFailures++
+		if code.PinFailures >= MaxPinFailures {
+			return ErrCodeBlocked, closeCode(tx, code, models.ATMCodeStatusBlocked)
+		}
+		return ErrPinInvalid, tx.Model(code).Select("pin_failures", "updated_at").Updates(code).Error
+	}
+
+	var used int64
+	if err := tx.Model(&models.ATMCode{}).Where("network_reference = ?", req.Reference).Count(&used).Error; err != nil {
+		return nil, err
+	}
+	if used > 0 {
+		return ErrReferenceUsed, nil
+	}
+
+	desc := "Cardless ATM Withdrawal " + req.TerminalID
+	entry := models.Transactions{Type: "WITHDRAW", Description: &desc}
+	_, _, err = ledger.CaptureHold(tx, code.HoldID, 0, &entry)
+	if errors.Is(err, ledger.ErrHoldNotActive) || errors.Is(err, ledger.ErrHoldExpired) {
+		// the hold was released behind the code's back
+		return ErrCodeNotActive, closeCode(tx, code, models.ATMCodeStatusCancelled)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	code.Status = models.ATMCodeStatusRedeemed
+	code.TerminalID = &req.TerminalID
+	code.NetworkReference = &req.Reference
+	code.TransactionID = &entry.ID
+	code.ClosedAt = &now
+	return nil, tx.Model(code).
+		Select("status", "terminal_id", "network_reference", "transaction_id", "closed_at", "updated_at").
+		Updates(code).Error
+}
+
+// ExpireCodes expires every active code past its expiry, releasing its hold,
+// and records each expiry in the audit log. It returns how many expired.
+func ExpireCodes(db *gorm.DB) (int, error) {
+	var ids []uuid.UUID
+	err := db.Raw(`
+	SELECT id FROM atm_codes WHERE status = ? AND expires_at <= now() ORDER BY expires_at LIMIT 500
+	`, models.ATMCodeStatusActive).Scan(&ids).Error
+	if err != nil {
+		return 0, err
+	}
+
+	expired := 0
+	for _, id := range ids {
+		err := db.Transaction(func(tx *gorm.DB) error {
+			code, err := lockCode(tx, "id = ?", id.String())
+			if err != nil {
+				return err
+			}
+			// a redemption may have won the race
+			if code.Status != models.ATMCodeStatusActive {
+				return nil
+			}
+			if err := closeCode(tx, code, models.ATMCodeStatusExpired); err != nil {
+				return err
+			}
+			expired++
+
+			target := code.ID.String()
+			event := models.AuditEvent{
+				ActorID:    &code.UserID,
+				Action:     "atm.code.expire",
+				Outcome:    models.AuditOutcomeSuccess,
+				TargetType: "atm_code",
+				TargetID:   &target,
+			}
+			event.SetChanges(
+				map[string]any{"status": models.ATMCodeStatusActive},
+				map[string]any{"status": code.Status, "amount": code.Amount},
+			)
+			return tx.Create(&event).Error
+		})
+		if err != nil {
+			return expired, err
+		}
+	}
+	return expired, nil
+}
+
+// RunExpiry expires codes every interval until ctx is done.
+func RunExpiry(ctx context.Context, db *gorm.DB, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			n, err := ExpireCodes(db)
+			if err != nil {
+				log.Println("failed to expire atm codes:", err)
+				continue
+			}
+			if n > 0 {
+				log.Printf("expired %d atm codes", n)
+			}
+		}
+	}
+}
+
+// NetworkSecret reads ATM_NETWORK_SECRET, the key the ATM network signs its
+// callbacks with.
+func NetworkSecret() (string, error) {
+	secret := os.Getenv("ATM_NETWORK_SECRET")
+	if secret == "" {
+		return "", ErrNetworkSecret
+	}
+	return secret, nil
+}
+
+// Verify checks an X-ATM-Signature header against body. It is signed like
+// outgoing webhooks and its timestamp must be within SignatureTolerance of
+// now so old callbacks cannot be replayed.
+func Verify(secret, header string, body []byte, now time.Time) error {
+	var timestamp int64
+	var signature string
+	for _, part := range strings.Split(header, ",") {
+		key, value, _ := strings.Cut(strings.TrimSpace(part), "=")
+		switch key {
+		case "t":
+			timestamp, _ = strconv.ParseInt(value, 10, 64)
+		case "v1":
+			signature = value
+		}
+	}
+	if timestamp == 0 || signature == "" {
+		return ErrSignature
+	}
+	if d := now.Sub(time.Unix(timestamp, 0)); d > SignatureTolerance || d < -SignatureTolerance {
+		return ErrSignature
+	}
+	expected := webhooks.Sign(secret, timestamp, body)
+	if !hmac.Equal([]byte(expected), []byte(fmt.Sprintf("t=%d,v1=%s", timestamp, signature))) {
+		return ErrSignature
+	}
+	return nil
+}
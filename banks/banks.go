@@ -0,0 +1,87 @@
+// Package banks is the registry of banks wallet money can be sent to, with
+// the account number format and the transfer limits of each.
+package banks
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+const (
+	// MinAmount and MaxAmount bound one transfer to any bank, MaxAmount is
+	// the BI-FAST limit.
+	MinAmount = 50000
+	MaxAmount = 250000000
+)
+
+var (
+	ErrUnknownBank   = errors.New("unknown bank")
+	ErrAccountNumber = errors.New("invalid account number")
+	ErrAmount        = fmt.Errorf("amount must be between %d and %d", MinAmount, MaxAmount)
+)
+
+// Bank is a registered bank. Code is what transactions store as BankName,
+// Fee is charged on every transfer to it.
+type Bank struct {
+	Code      string `json:"code"`
+	Name      string `json:"name"`
+	MinDigits int    `json:"minDigits"`
+	MaxDigits int    `json:"maxDigits"`
+	Fee       int64  `json:"fee"`
+}
+
+// Registry lists every bank transfers can go to.
+var Registry = []Bank{
+	{Code: "BCA", Name: "Bank Central Asia", MinDigits: 10, MaxDigits: 10, Fee: 2500},
+	{Code: "BNI", Name: "Bank Negara Indonesia", MinDigits: 10, MaxDigits: 10, Fee: 2500},
+	{Code: "BRI", Name: "Bank Rakyat Indonesia", MinDigits: 15, MaxDigits: 15, Fee: 2500},
+	{Code: "MANDIRI", Name: "Bank Mandiri", MinDigits: 13, MaxDigits: 13, Fee: 2500},
+	{Code: "BSI", Name: "Bank Syariah Indonesia", MinDigits: 10, MaxDigits: 10, Fee: 2500},
+	{Code: "BTN", Name: "Bank Tabungan Negara", MinDigits: 16, MaxDigits: 16, Fee: 2500},
+	{Code: "CIMB", Name: "CIMB Niaga", MinDigits: 12, MaxDigits: 14, Fee: 2500},
+	{Code: "PERMATA", Name: "Bank Permata", MinDigits: 10, MaxDigits: 10, Fee: 2500},
+	{Code: "DANAMON", Name: "Bank Danamon", MinDigits: 10, MaxDigits: 13, Fee: 2500},
+}
+
+// Find returns the bank with code, case insensitive.
+func Find(code string) (*Bank, error) {
+	code = strings.ToUpper(strings.TrimSpace(code))
+	for i := range Registry {
+		if Registry[i].Code == code {
+			return &Registry[i], nil
+		}
+	}
+	return nil, ErrUnknownBank
+}
+
+// Check validates a transfer of amount to accountNumber at this bank.
+func (b *Bank) Check(accountNumber string, amount int64) error {
+	if err := b.CheckAccount(accountNumber); err != nil {
+		return err
+	}
+	if amount < MinAmount || amount > MaxAmount {
+		return ErrAmount
+	}
+	return nil
+}
+
+// CheckAccount validates accountNumber is an account number of this bank.
+func (b *Bank) CheckAccount(accountNumber string) error {
+	if len(accountNumber) < b.MinDigits || len(accountNumber) > b.MaxDigits {
+		return fmt.Errorf("%w: %s account numbers have %s digits", ErrAccountNumber, b.Code, b.digits())
+	}
+	for _, r := range accountNumber {
+		if r < '0' || r > '9' {
+			return fmt.Errorf("%w: only digits are allowed", ErrAccountNumber)
+		}
+	}
+	return nil
+}
+
+func (b *Bank) digits() string {
+	if b.MinDigits == b.MaxDigits {
+		return fmt.Sprint(b.MinDigits)
+	}
+	return fmt.Sprintf("%d to %d", b.MinDigits, b.MaxDigits)
+}
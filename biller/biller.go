@@ -0,0 +1,125 @@
+// Package biller sells prepaid products such as phone credit and electricity
+// tokens and pays postpaid bills through biller adapters. A purchase starts
+// with an inquiry that quotes the amount due, paying debits the wallet and a
+// background job then buys from the biller. A purchase the biller fails is
+// refunded to the wallet.
+package biller
+
+import (
+	"context"
+	"errors"
+	"sync"
+)
+
+const (
+	KindPrepaid  = "PREPAID"
+	KindPostpaid = "POSTPAID"
+
+	ResultSuccess = "SUCCESS"
+	ResultFailed  = "FAILED"
+	ResultPending = "PENDING"
+)
+
+var (
+	ErrUnknownProduct   = errors.New("unknown product")
+	ErrUnknownBiller    = errors.New("unknown biller")
+	ErrCustomerNotFound = errors.New("customer not found at the biller")
+	ErrCustomerID       = errors.New("customerId must be 6 to 20 digits")
+)
+
+// Product is an item of the catalogue. Price is what a prepaid product
+// costs, postpaid bills are priced by the inquiry.
+type Product struct {
+	Code     string `json:"code"`
+	Name     string `json:"name"`
+	Category string `json:"category"`
+	Kind     string `json:"kind"`
+	Price    int64  `json:"price,omitempty"`
+	AdminFee int64  `json:"adminFee"`
+	Biller   string `json:"biller"`
+}
+
+// Catalogue lists every product that can be bought.
+var Catalogue = []Product{
+	{Code: "PULSA10", Name: "Pulsa 10.000", Category: "PULSA", Kind: KindPrepaid, Price: 10000, AdminFee: 1500, Biller: "sim"},
+	{Code: "PULSA25", Name: "Pulsa 25.000", Category: "PULSA", Kind: KindPrepaid, Price: 25000, AdminFee: 1500, Biller: "sim"},
+	{Code: "PULSA50", Name: "Pulsa 50.000", Category: "PULSA", Kind: KindPrepaid, Price: 50000, AdminFee: 1500, Biller: "sim"},
+	{Code: "PULSA100", Name: "Pulsa 100.000", Category: "PULSA", Kind: KindPrepaid, Price: 100000, AdminFee: 1500, Biller: "sim"},
+	{Code: "PLN20", Name: "Token PLN 20.000", Category: "PLN_TOKEN", Kind: KindPrepaid, Price: 20000, AdminFee: 2500, Biller: "sim"},
+	{Code: "PLN50", Name: "Token PLN 50.000", Category: "PLN_TOKEN", Kind: KindPrepaid, Price: 50000, AdminFee: 2500, Biller: "sim"},
+	{Code: "PLN100", Name: "Token PLN 100.000", Category: "PLN_TOKEN", Kind: KindPrepaid, Price: 100000, AdminFee: 2500, Biller: "sim"},
+	{Code: "PLN200", Name: "Token PLN 200.000", Category: "PLN_TOKEN", Kind: KindPrepaid, Price: 200000, AdminFee: 2500, Biller: "sim"},
+	{Code: "PLNPOST", Name: "Tagihan PLN", Category: "PLN_BILL", Kind: KindPostpaid, AdminFee: 2500, Biller: "sim"},
+	{Code: "PDAM", Name: "Tagihan PDAM", Category: "WATER", Kind: KindPostpaid, AdminFee: 2500, Biller: "sim"},
+	{Code: "BPJS", Name: "BPJS Kesehatan", Category: "INSURANCE", Kind: KindPostpaid, AdminFee: 2500, Biller: "sim"},
+}
+
+// Find returns the catalogue product with code.
+func Find(code string) (*Product, error) {
+	for i := range Catalogue {
+		if Catalogue[i].Code == code {
+			return &Catalogue[i], nil
+		}
+	}
+	return nil, ErrUnknownProduct
+}
+
+// Inquiry is a biller's quote for a customer of a product.
+type Inquiry struct {
+	CustomerName string
+	Amount       int64
+	Reference    string
+}
+
+// Result is a biller's answer to a purchase. Token is set for products that
+// deliver one, such as electricity tokens.
+type Result struct {
+	Status    string
+	Reference string
+	Token     string
+	Message   string
+}
+
+// Biller is an adapter to one biller. Purchase is called again with the same
+// requestID until the result is no longer PENDING, the biller must treat a
+// repeated requestID as the same purchase.
+type Biller interface {
+	Inquire(ctx context.Context, product Product, customerID string) (*Inquiry, error)
+	Purchase(ctx context.Context, product Product, customerID string, amount int64, requestID string) (*Result, error)
+}
+
+var (
+	mu      sync.RWMutex
+	billers = map[string]Biller{"sim": NewSimulator()}
+)
+
+// RegisterBiller sets the adapter used for products of biller name.
+func RegisterBiller(name string, b Biller) {
+	mu.Lock()
+	defer mu.Unlock()
+	billers[name] = b
+}
+
+// Get returns the adapter of biller name.
+func Get(name string) (Biller, error) {
+	mu.RLock()
+	defer mu.RUnlock()
+	b, ok := billers[name]
+	if !ok {
+		return nil, ErrUnknownBiller
+	}
+	return b, nil
+}
+
+// ValidCustomerID checks a phone, meter or customer number.
+func ValidCustomerID(id string) bool {
+	if len(id) < 6 || len(id) > 20 {
+		return false
+	}
+	for _, r := range id {
+		if r < '0' || r > '9' {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,252 @@
+package biller
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/eclipseron/digital-wallet-app/jobs"
+	"github.com/eclipseron/digital-wallet-app/ledger"
+	"github.com/eclipseron/digital-wallet-app/models"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+const (
+	// InquiryTTL is how long a quote can be paid.
+	InquiryTTL = 15 * time.Minute
+	// JobPay buys a paid purchase from its biller.
+	JobPay = "biller.pay"
+)
+
+var (
+	ErrPaymentNotFound = errors.New("bill payment not found")
+	ErrNotPayable      = errors.New("bill payment was already paid")
+	ErrInquiryExpired  = errors.New("inquiry has expired, make a new one")
+	ErrStillPending    = errors.New("biller has not confirmed the purchase yet")
+)
+
+type payPayload struct {
+	PaymentID uuid.UUID `json:"paymentId"`
+}
+
+// Inquire asks the product's biller for a quote and records it as an INQUIRY
+// for accountID.
+func Inquire(ctx context.Context, db *gorm.DB, accountID, userID uuid.UUID, productCode, customerID string) (*models.BillPayment, error) {
+	product, err := Find(productCode)
+	if err != nil {
+		return nil, err
+	}
+	if !ValidCustomerID(customerID) {
+		return nil, ErrCustomerID
+	}
+	b, err := Get(product.Biller)
+	if err != nil {
+		return nil, err
+	}
+	inquiry, err := b.Inquire(ctx, *product, customerID)
+	if err != nil {
+		return nil, err
+	}
+
+	payment := models.BillPayment{
+		UserID:      userID,
+		AccountID:   accountID,
+		ProductCode: product.Code,
+		Biller:      product.Biller,
+		CustomerID:  customerID,
+		Amount:      inquiry.Amount,
+		AdminFee:    product.AdminFee,
+		Total:       inquiry.Amount + product.AdminFee,
+		Status:      models.BillPaymentStatusInquiry,
+		ExpiresAt:   time.Now().Add(InquiryTTL),
+	}
+	if inquiry.CustomerName != "" {
+		payment.CustomerName = &inquiry.CustomerName
+	}
+	if inquiry.Reference != "" {
+		payment.InquiryReference = &inquiry.Reference
+	}
+	return &payment, db.WithContext(ctx).Create(&payment).Error
+}
+
+func lockPayment(tx *gorm.DB, paymentID uuid.UUID) (*models.BillPayment, error) {
+	var payment models.BillPayment
+	res := tx.Raw(`SELECT * FROM bill_payments WHERE id = ? FOR UPDATE`, paymentID.String()).Scan(&payment)
+	if res.Error != nil {
+		return nil, res.Error
+	}
+	if res.RowsAffected == 0 {
+		return nil, ErrPaymentNotFound
+	}
+	return &payment, nil
+}
+
+// Pay debits the quoted total of an inquiry of accountID as a BILL_PAYMENT
+// and queues the purchase. It must run inside a transaction.
+func Pay(tx *gorm.DB, accountID, paymentID uuid.UUID) (*models.BillPayment, int64, error) {
+	payment, err := lockPayment(tx, paymentID)
+	if err != nil {
+		return nil, 0, err
+	}
+	if payment.AccountID != accountID {
+		return nil, 0, ErrPaymentNotFound
+	}
+	if payment.Status != models.BillPaymentStatusInquiry {
+		return payment, 0, ErrNotPayable
+	}
+	if !time.Now().Before(payment.ExpiresAt) {
+		return payment, 0, ErrInquiryExpired
+	}
+	product, err := Find(payment.ProductCode)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	desc := fmt.Sprintf("%s %s", product.Name, payment.CustomerID)
+	entry := models.Transactions{
+		AccountID:   accountID,
+		Type:        "BILL_PAYMENT",
+		Description: &desc,
+	}
+	balance, err := ledger.Debit(tx, &entry, payment.Total)
+	if err != nil {
+		return payment, 0, err
+	}
+
+	now := time.Now()
+	payment.Status = models.BillPaymentStatusPending
+	payment.TransactionID = &entry.ID
+	payment.PaidAt = &now
+	err = tx.Model(payment).Select("status", "transaction_id", "paid_at", "updated_at").Updates(payment).Error
+	if err != nil {
+		return nil, 0, err
+	}
+	_, err = jobs.Enqueue(tx, JobPay, payPayload{PaymentID: payment.ID}, jobs.EnqueueOptions{
+		UniqueKey: JobPay + ":" + payment.ID.String(),
+	})
+	if err != nil && !errors.Is(err, jobs.ErrDuplicateJob) {
+		return nil, 0, err
+	}
+	return payment, balance, nil
+}
+
+// Register adds the purchase job handler to the queue.
+func Register(q *jobs.Queue, db *gorm.DB) {
+	jobs.Handle(q, JobPay, func(ctx context.Context, p payPayload) error {
+		return Process(ctx, db, p.PaymentID)
+	})
+}
+
+// Process buys a PENDING purchase from its biller. The biller is called
+// outside of any transaction with the payment id as request id, so a retry
+// after a crash asks about the same purchase. A purchase still pending at the
+// biller returns ErrStillPending and the job retries it later.
+func Process(ctx context.Context, db *gorm.DB, paymentID uuid.UUID) error {
+	var payment models.BillPayment
+	if err := db.WithContext(ctx).First(&payment, "id = ?", paymentID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return jobs.Permanent(ErrPaymentNotFound)
+		}
+		return err
+	}
+	if payment.Status != models.BillPaymentStatusPending {
+		return nil
+	}
+	product, result, err := purchase(ctx, &payment)
+	if err != nil {
+		return err
+	}
+	if result.Status == ResultPending {
+		return ErrStillPending
+	}
+	return db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		return complete(tx, product, paymentID, result)
+	})
+}
+
+// purchase asks the payment's biller for the purchase, buying it unless the
+// biller already knows the request id.
+func purchase(ctx context.Context, payment *models.BillPayment) (*Product, *Result, error) {
+	product, err := Find(payment.ProductCode)
+	if err != nil {
+		return nil, nil, jobs.Permanent(err)
+	}
+	b, err := Get(payment.Biller)
+	if err != nil {
+		return nil, nil, jobs.Permanent(err)
+	}
+	result, err := b.Purchase(ctx, *product, payment.CustomerID, payment.Amount, payment.ID.String())
+	if err != nil {
+		return nil, nil, err
+	}
+	return product, result, nil
+}
+
+// complete books the biller's final answer on a locked payment. A payment
+// another worker already completed is left alone.
+func complete(tx *gorm.DB, product *Product, paymentID uuid.UUID, result *Result) error {
+	payment, err := lockPayment(tx, paymentID)
+	if err != nil {
+		return err
+	}
+	if payment.Status != models.BillPaymentStatusPending {
+		return nil
+	}
+	if result.Reference != "" {
+		payment.BillerReference = &result.Reference
+	}
+	now := time.Now()
+	payment.CompletedAt = &now
+
+	if result.Status == ResultSuccess {
+		payment.Status = models.BillPaymentStatusSuccess
+		if result.Token != "" {
+			payment.Token = &result.Token
+		}
+		err := tx.Model(&models.Transactions{}).Where("id = ?", payment.TransactionID).
+			Updates(map[string]any{"biller_reference": payment.BillerReference, "token": payment.Token}).Error
+		if err != nil {
+			return err
+		}
+		if err := savePayment(tx, payment); err != nil {
+			return err
+		}
+		body := fmt.Sprintf("%s for %s was successful.", product.Name, payment.CustomerID)
+		if payment.Token != nil {
+			body += " Token: " + *payment.Token
+		}
+		return models.Notify(tx, payment.UserID, models.NotificationBillPaid, "Payment successful", body,
+			map[string]any{"paymentId": payment.ID, "token": payment.Token, "billerReference": payment.BillerReference})
+	}
+
+	reason := result.Message
+	if reason == "" {
+		reason = "purchase failed at the biller"
+	}
+	desc := fmt.Sprintf("Refund %s %s", product.Name, payment.CustomerID)
+	entry := models.Transactions{
+		AccountID:   payment.AccountID,
+		Type:        "REFUND",
+		Description: &desc,
+	}
+	if _, err := ledger.Refund(tx, &entry, payment.Total); err != nil {
+		return err
+	}
+	payment.Status = models.BillPaymentStatusRefunded
+	payment.FailureReason = &reason
+	payment.RefundTransactionID = &entry.ID
+	if err := savePayment(tx, payment); err != nil {
+		return err
+	}
+	body := fmt.Sprintf("%s for %s failed, %d was refunded to your wallet.", product.Name, payment.CustomerID, payment.Total)
+	return models.Notify(tx, payment.UserID, models.NotificationBillRefunded, "Payment refunded", body,
+		map[string]any{"paymentId": payment.ID, "reason": reason})
+}
+
+func savePayment(tx *gorm.DB, payment *models.BillPayment) error {
+	return tx.Model(payment).Select(
+		"status", "biller_reference", "token", "failure_reason", "refund_transaction_id", "completed_at", "updated_at",
+	).Updates(payment).Error
+}
@@ -0,0 +1,90 @@
+package biller
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"github.com/eclipseron/digital-wallet-app/models"
+	"gorm.io/gorm"
+)
+
+const (
+	// StaleAfter is how long a purchase may stay PENDING without a queued
+	// job before Reconcile asks the biller about it.
+	StaleAfter = time.Hour
+	// MaxPending is how long a biller may keep a purchase pending, after
+	// that it is refunded.
+	MaxPending = 48 * time.Hour
+)
+
+// Reconcile finishes PENDING purchases whose job gave up, for example after
+// it was dead-lettered while the biller kept answering pending or was down.
+// Each purchase is asked about again and completed or refunded, one still
+// pending past MaxPending is refunded. It returns how many were finished.
+func Reconcile(ctx context.Context, db *gorm.DB) (int, error) {
+	var payments []models.BillPayment
+	err := db.WithContext(ctx).Raw(`
+	SELECT * FROM bill_payments bp
+	WHERE bp.status = ? AND bp.paid_at < ?
+	AND NOT EXISTS (
+		SELECT 1 FROM jobs j WHERE j.unique_key = ? || bp.id::text AND j.status IN (?, ?)
+	)
+	ORDER BY bp.paid_at LIMIT 100
+	`, models.BillPaymentStatusPending, time.Now().Add(-StaleAfter), JobPay+":",
+		models.JobStatusQueued, models.JobStatusRunning).Scan(&payments).Error
+	if err != nil {
+		return 0, err
+	}
+
+	finished := 0
+	for i := range payments {
+		ok, err := reconcile(ctx, db, &payments[i])
+		if err != nil {
+			// the biller may be down, the next run asks again
+			log.Printf("failed to reconcile bill payment %s: %v", payments[i].ID, err)
+			continue
+		}
+		if ok {
+			finished++
+		}
+	}
+	return finished, nil
+}
+
+func reconcile(ctx context.Context, db *gorm.DB, payment *models.BillPayment) (bool, error) {
+	product, result, err := purchase(ctx, payment)
+	if err != nil {
+		return false, err
+	}
+	if result.Status == ResultPending {
+		if payment.PaidAt != nil && time.Since(*payment.PaidAt) < MaxPending {
+			return false, nil
+		}
+		result = &Result{Status: ResultFailed, Reference: result.Reference, Message: "biller did not confirm the purchase"}
+	}
+	return true, db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		return complete(tx, product, payment.ID, result)
+	})
+}
+
+// Run reconciles stale purchases every interval until ctx is done.
+func Run(ctx context.Context, db *gorm.DB, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			n, err := Reconcile(ctx, db)
+			if err != nil {
+				log.Println("failed to reconcile bill payments:", err)
+				continue
+			}
+			if n > 0 {
+				log.Printf("reconciled %d bill payments", n)
+			}
+		}
+	}
+}
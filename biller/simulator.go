@@ -0,0 +1,76 @@
+package biller
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"math/big"
+	"sync"
+)
+
+// Simulator is a local biller for development and tests. Its behaviour
+// follows the last digit of the customer number:
+//
+//   - 0: the customer does not exist
+//   - 8: the first purchase attempt is still pending, the next one succeeds
+//   - 9: every purchase fails
+//
+// Postpaid bills get an amount derived from the customer number and
+// electricity tokens a token derived from the request id.
+type Simulator struct {
+	mu       sync.Mutex
+	attempts map[string]int
+}
+
+func NewSimulator() *Simulator {
+	return &Simulator{attempts: map[string]int{}}
+}
+
+func simReference(prefix, seed string) string {
+	sum := sha256.Sum256([]byte(prefix + seed))
+	return prefix + hex.EncodeToString(sum[:6])
+}
+
+func (s *Simulator) Inquire(ctx context.Context, product Product, customerID string) (*Inquiry, error) {
+	if customerID[len(customerID)-1] == '0' {
+		return nil, ErrCustomerNotFound
+	}
+	inquiry := &Inquiry{
+		CustomerName: "SIM CUSTOMER " + customerID[len(customerID)-4:],
+		Amount:       product.Price,
+		Reference:    simReference("INQ", product.Code+customerID),
+	}
+	if product.Kind == KindPostpaid {
+		sum := sha256.Sum256([]byte(product.Code + customerID))
+		// between 50.000 and 500.000 in steps of 100
+		inquiry.Amount = 50000 + new(big.Int).SetBytes(sum[:4]).Int64()%4501*100
+	}
+	return inquiry, nil
+}
+
+func (s *Simulator) Purchase(ctx context.Context, product Product, customerID string, amount int64, requestID string) (*Result, error) {
+	s.mu.Lock()
+	s.attempts[requestID]++
+	attempt := s.attempts[requestID]
+	s.mu.Unlock()
+
+	reference := simReference("SIM", requestID)
+	switch customerID[len(customerID)-1] {
+	case '9':
+		return &Result{Status: ResultFailed, Reference: reference, Message: "rejected by biller"}, nil
+	case '8':
+		if attempt == 1 {
+			return &Result{Status: ResultPending, Reference: reference}, nil
+		}
+	}
+
+	result := &Result{Status: ResultSuccess, Reference: reference}
+	if product.Category == "PLN_TOKEN" {
+		sum := sha256.Sum256([]byte(requestID))
+		n := new(big.Int).SetBytes(sum[:10]).String()
+		n = fmt.Sprintf("%020s", n[len(n)-min(len(n), 20):])
+		result.Token = fmt.Sprintf("%s-%s-%s-%s-%s", n[0:4], n[4:8], n[8:12], n[12:16], n[16:20])
+	}
+	return result, nil
+}
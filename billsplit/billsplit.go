@@ -0,0 +1,183 @@
+// Package billsplit divides a bill among its participants and reminds the
+// ones who have not paid their share yet.
+package billsplit
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/eclipseron/digital-wallet-app/models"
+	"gorm.io/gorm"
+)
+
+var (
+	ErrNoParticipants = errors.New("a bill needs at least one participant")
+	ErrAmountMismatch = errors.New("shares must add up to the total amount")
+	ErrPercentTotal   = errors.New("percentages must add up to 100")
+)
+
+// Equal splits total into n shares. The rupiah left over by the division go
+// to the first shares, one each.
+func Equal(total int64, n int) ([]int64, error) {
+	if n <= 0 {
+		return nil, ErrNoParticipants
+	}
+	shares := make([]int64, n)
+	base, rest := total/int64(n), total%int64(n)
+	for i := range shares {
+		shares[i] = base
+		if int64(i) < rest {
+			shares[i]++
+		}
+	}
+	return shares, nil
+}
+
+// Custom checks that amounts are positive and add up to total.
+func Custom(total int64, amounts []int64) ([]int64, error) {
+	if len(amounts) == 0 {
+		return nil, ErrNoParticipants
+	}
+	var sum int64
+	for _, a := range amounts {
+		if a <= 0 {
+			return nil, fmt.Errorf("%w: every share must be positive", ErrAmountMismatch)
+		}
+		sum += a
+	}
+	if sum != total {
+		return nil, ErrAmountMismatch
+	}
+	return amounts, nil
+}
+
+// ByPercent splits total by basis points, which must add up to 10000.
+// Shares are rounded down and the remainder goes to the largest fractions
+// first, so the shares always add up to total.
+func ByPercent(total int64, basisPoints []int64) ([]int64, error) {
+	if len(basisPoints) == 0 {
+		return nil, ErrNoParticipants
+	}
+	var sum int64
+	for _, bp := range basisPoints {
+		if bp <= 0 {
+			return nil, fmt.Errorf("%w: every percentage must be positive", ErrPercentTotal)
+		}
+		sum += bp
+	}
+	if sum != 10000 {
+		return nil, ErrPercentTotal
+	}
+
+	shares := make([]int64, len(basisPoints))
+	fractions := make([]int64, len(basisPoints))
+	var assigned int64
+	for i, bp := range basisPoints {
+		shares[i] = total * bp / 10000
+		fractions[i] = total * bp % 10000
+		assigned += shares[i]
+	}
+	for rest := total - assigned; rest > 0; rest-- {
+		largest := 0
+		for i := range fractions {
+			if fractions[i] > fractions[largest] {
+				largest = i
+			}
+		}
+		shares[largest]++
+		fractions[largest] = -1
+	}
+	return shares, nil
+}
+
+// MaxReminders reads SPLIT_BILL_MAX_REMINDERS, 3 by default.
+func MaxReminders() int {
+	if n, err := strconv.Atoi(os.Getenv("SPLIT_BILL_MAX_REMINDERS")); err == nil && n >= 0 {
+		return n
+	}
+	return 3
+}
+
+// RemindDue notifies every participant of an open bill whose reminder is due
+// and schedules the next one, up to MaxReminders per share. It returns how
+// many reminders were sent.
+func RemindDue(db *gorm.DB) (int, error) {
+	limit := MaxReminders()
+	sent := 0
+	err := db.Transaction(func(tx *gorm.DB) error {
+		var due []struct {
+			models.SplitBillShare
+			Title            string
+			OrganizerName    string
+			ReminderInterval int64
+			DueAt            *time.Time
+		}
+		err := tx.Raw(`
+		SELECT s.*, b.title, u.name AS organizer_name, b.reminder_interval, b.due_at
+		FROM split_bill_shares s
+		JOIN split_bills b ON b.id = s.split_bill_id
+		JOIN users u ON u.id = b.organizer_id
+		WHERE s.status = ? AND b.status = ? AND s.next_reminder_at <= now()
+		ORDER BY s.next_reminder_at LIMIT 500
+		FOR UPDATE OF s SKIP LOCKED
+		`, models.ShareUnpaid, models.SplitBillOpen).Scan(&due).Error
+		if err != nil {
+			return err
+		}
+
+		now := time.Now()
+		for _, s := range due {
+			body := fmt.Sprintf("%s is waiting for your share of Rp%d for %q.", s.OrganizerName, s.Amount, s.Title)
+			if s.DueAt != nil {
+				body += fmt.Sprintf(" It is due on %s.", s.DueAt.Format("2 Jan 2006"))
+			}
+			err := models.Notify(tx, s.UserID, models.NotificationSplitBillReminder, "Split bill reminder", body,
+				map[string]any{"splitBillId": s.SplitBillID, "shareId": s.ID, "amount": s.Amount})
+			if err != nil {
+				return err
+			}
+
+			var next *time.Time
+			if s.RemindersSent+1 < limit {
+				at := now.Add(time.Duration(s.ReminderInterval) * time.Second)
+				next = &at
+			}
+			err = tx.Exec(`
+			UPDATE split_bill_shares SET reminders_sent = reminders_sent + 1, next_reminder_at = ?, updated_at = now()
+			WHERE id = ?
+			`, next, s.ID).Error
+			if err != nil {
+				return err
+			}
+			sent++
+		}
+		return nil
+	})
+	return sent, err
+}
+
+// Run sends due reminders every interval until ctx is done.
+func Run(ctx context.Context, db *gorm.DB, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			n, err := RemindDue(db)
+			if err != nil {
+				log.Println("failed to send split bill reminders:", err)
+				continue
+			}
+			if n > 0 {
+				log.Printf("sent %d split bill reminders", n)
+			}
+		}
+	}
+}
@@ -0,0 +1,64 @@
+// Command atmsim plays the ATM network for local testing. It redeems a
+// cardless withdrawal code by sending the signed callback a terminal would
+// send, and prints the answer.
+//
+//	go run ./cmd/atmsim -code 123456789012 -pin 123456
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/eclipseron/digital-wallet-app/atm"
+	"github.com/eclipseron/digital-wallet-app/webhooks"
+	"github.com/google/uuid"
+	"github.com/joho/godotenv"
+)
+
+func main() {
+	url := flag.String("url", "http://localhost:8080/api/v1/atm/redeem", "redeem callback of the wallet")
+	code := flag.String("code", "", "12 digit withdrawal code")
+	pin := flag.String("pin", "", "6 digit withdrawal pin")
+	terminal := flag.String("terminal", "SIM00001", "terminal id")
+	reference := flag.String("reference", "", "network reference, a new one by default")
+	flag.Parse()
+
+	godotenv.Load()
+	secret, err := atm.NetworkSecret()
+	if err != nil {
+		log.Fatal(err)
+	}
+	if *reference == "" {
+		*reference = "SIM-" + uuid.NewString()
+	}
+
+	body, err := json.Marshal(atm.Redemption{
+		Code:       *code,
+		Pin:        *pin,
+		TerminalID: *terminal,
+		Reference:  *reference,
+	})
+	if err != nil {
+		log.Fatal(err)
+	}
+	req, err := http.NewRequest(http.MethodPost, *url, bytes.NewReader(body))
+	if err != nil {
+		log.Fatal(err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-ATM-Signature", webhooks.Sign(secret, time.Now().Unix(), body))
+
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		log.Fatal("failed to reach the wallet: ", err)
+	}
+	defer res.Body.Close()
+	answer, _ := io.ReadAll(res.Body)
+	fmt.Printf("reference %s: %s\n%s\n", *reference, res.Status, answer)
+}
@@ -0,0 +1,22 @@
+// Command categorize applies the category rules to every transaction whose
+// category was not set by the account holder. Run it after changing the
+// rules or to backfill rows written before categories existed.
+package main
+
+import (
+	"fmt"
+	"log"
+
+	"github.com/eclipseron/digital-wallet-app/analytics"
+	"github.com/eclipseron/digital-wallet-app/conf"
+)
+
+func main() {
+	db := conf.SetupDB()
+
+	n, err := analytics.Recategorize(db)
+	if err != nil {
+		log.Fatal("failed to categorize transactions: ", err)
+	}
+	fmt.Printf("recategorized %d transactions\n", n)
+}
@@ -0,0 +1,62 @@
+// Command verifychain checks the transaction hash chain of one account, or of
+// every account when -account is omitted, and exits non-zero on any issue.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"os"
+
+	"github.com/eclipseron/digital-wallet-app/conf"
+	"github.com/eclipseron/digital-wallet-app/ledger"
+	"github.com/google/uuid"
+)
+
+func main() {
+	account := flag.String("account", "", "account id to verify, all accounts when empty")
+	checkpoint := flag.Bool("checkpoint", false, "sign a checkpoint for every verified chain head")
+	flag.Parse()
+
+	db := conf.SetupDB()
+
+	var accounts []uuid.UUID
+	if *account != "" {
+		id, err := uuid.Parse(*account)
+		if err != nil {
+			log.Fatal("invalid account id: ", err)
+		}
+		accounts = append(accounts, id)
+	} else if err := db.Raw(`SELECT id FROM accounts ORDER BY created_at`).Scan(&accounts).Error; err != nil {
+		log.Fatal("failed to list accounts: ", err)
+	}
+
+	failed := 0
+	for _, id := range accounts {
+		report, err := ledger.VerifyChain(db, id)
+		if err != nil {
+			log.Fatalf("failed to verify %s: %v", id, err)
+		}
+		if report.Valid {
+			fmt.Printf("OK    %s entries=%d unchained=%d checkpoints=%d snapshots=%d\n",
+				id, report.Entries, report.Unchained, report.Checkpoints, report.Snapshots)
+			continue
+		}
+		failed++
+		fmt.Printf("FAIL  %s entries=%d\n", id, report.Entries)
+		for _, issue := range report.Issues {
+			fmt.Printf("      seq=%d %s\n", issue.Sequence, issue.Problem)
+		}
+	}
+
+	if *checkpoint && failed == 0 {
+		n, err := ledger.CreateCheckpoints(db)
+		if err != nil {
+			log.Fatal("failed to create checkpoints: ", err)
+		}
+		fmt.Printf("created %d checkpoints\n", n)
+	}
+	if failed > 0 {
+		os.Exit(1)
+	}
+}
@@ -2,12 +2,16 @@ package controller
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
 	"net/http"
 	"time"
 
+	"github.com/eclipseron/digital-wallet-app/banks"
 	"github.com/eclipseron/digital-wallet-app/dto"
+	"github.com/eclipseron/digital-wallet-app/ledger"
 	"github.com/eclipseron/digital-wallet-app/middleware"
+	"github.com/eclipseron/digital-wallet-app/models"
 	"github.com/google/uuid"
 )
 
@@ -30,17 +34,25 @@ func (c *Controller) GetAccountBalanceHandler(w http.ResponseWriter, r *http.Req
 	_uid, _ := r.Context().Value(middleware.USERID).(string)
 
 	type Account struct {
-		ID            uuid.UUID `json:"accountId"`
-		UserId        uuid.UUID `json:"userId"`
-		AccountNumber string    `json:"accountNumber"`
-		Balance       int64     `json:"balance"`
-		UpdatedAt     time.Time `json:"lastTransaction"`
+		ID            uuid.UUID             `json:"accountId"`
+		UserId        uuid.UUID             `json:"userId"`
+		AccountNumber string                `json:"accountNumber"`
+		Balance       int64                 `json:"balance"`
+		Ledger        int64                 `json:"ledgerBalance"`
+		Available     int64                 `json:"availableBalance"`
+		Main          int64                 `json:"mainBalance"`
+		Pocket        int64                 `json:"pocketBalance"`
+		Pockets       []PocketResponseModel `json:"pockets" gorm:"-"`
+		Status        string                `json:"status"`
+		UpdatedAt     time.Time             `json:"lastTransaction"`
 	}
 
 	var account Account
 
 	tx := c.DB.Raw(`
-	SELECT id, user_id, account_number, balance, updated_at
+	SELECT id, user_id, account_number, balance, balance AS ledger,
+	balance - held_balance - pocket_balance AS available, balance - pocket_balance AS main,
+	pocket_balance AS pocket, status, updated_at
 	FROM accounts WHERE id = ?
 	`, accountId.String()).Scan(&account)
 	if tx.RowsAffected == 0 {
@@ -64,7 +76,275 @@ func (c *Controller) GetAccountBalanceHandler(w http.ResponseWriter, r *http.Req
 		json.NewEncoder(w).Encode(&response)
 		return
 	}
+	if at := r.URL.Query().Get("at"); at != "" {
+		c.writeBalanceAt(w, r, &response, accountId, at)
+		return
+	}
+	var pockets []models.Pocket
+	if err := c.DB.Where("account_id = ?", accountId.String()).Order("created_at").Find(&pockets).Error; err != nil {
+		detail := err.Error()
+		w.WriteHeader(http.StatusInternalServerError)
+		response.Data = dto.ErrorModel{Message: "an error occured", Details: []*string{&detail}}
+		json.NewEncoder(w).Encode(&response)
+		return
+	}
+	account.Pockets = make([]PocketResponseModel, len(pockets))
+	for i := range pockets {
+		account.Pockets[i] = newPocketResponse(&pockets[i])
+	}
 	account.UpdatedAt = account.UpdatedAt.UTC()
 	response.Data = account
 	json.NewEncoder(w).Encode(&response)
 }
+
+type HistoricalBalanceResponseModel struct {
+	AccountId   uuid.UUID `json:"accountId"`
+	At          time.Time `json:"at"`
+	Balance     int64     `json:"balance"`
+	SnapshotDay *string   `json:"snapshotDay"`
+	Replayed    int64     `json:"replayedTransactions"`
+}
+
+// writeBalanceAt answers ?at=<RFC3339> with the ledger balance at that
+// instant, computed from the nearest daily snapshot.
+func (c *Controller) writeBalanceAt(w http.ResponseWriter, r *http.Request, response *dto.ResponseModel, accountId uuid.UUID, param string) {
+	at, err := time.Parse(time.RFC3339, param)
+	if err != nil {
+		detail := "at must be an RFC3339 timestamp"
+		w.WriteHeader(http.StatusBadRequest)
+		response.Data = dto.ErrorModel{Message: "invalid request", Details: []*string{&detail}}
+		json.NewEncoder(w).Encode(response)
+		return
+	}
+
+	balance, err := ledger.BalanceAt(r.Context(), c.DB, accountId, at)
+	if errors.Is(err, ledger.ErrFutureInstant) || errors.Is(err, ledger.ErrBeforeOpening) {
+		detail := err.Error()
+		w.WriteHeader(http.StatusBadRequest)
+		response.Data = dto.ErrorModel{Message: "invalid request", Details: []*string{&detail}}
+		json.NewEncoder(w).Encode(response)
+		return
+	}
+	if err != nil {
+		detail := err.Error()
+		w.WriteHeader(http.StatusInternalServerError)
+		response.Data = dto.ErrorModel{Message: "failed to compute balance", Details: []*string{&detail}}
+		json.NewEncoder(w).Encode(response)
+		return
+	}
+
+	data := HistoricalBalanceResponseModel{
+		AccountId: accountId,
+		At:        at.UTC(),
+		Balance:   balance.Balance,
+		Replayed:  balance.Replayed,
+	}
+	if balance.SnapshotDay != nil {
+		day := balance.SnapshotDay.Format(time.DateOnly)
+		data.SnapshotDay = &day
+	}
+	response.Data = data
+	json.NewEncoder(w).Encode(response)
+}
+
+func (c *Controller) CloseAccountHandler(w http.ResponseWriter, r *http.Request) {
+	var response dto.ResponseModel
+	response.ID = uuid.New()
+	response.Timestamp = time.Now().UTC()
+	w.Header().Add("Content-Type", "application/json")
+
+	param := r.PathValue("accountId")
+	accountId, err := uuid.Parse(param)
+	if err != nil {
+		detail := err.Error()
+		w.WriteHeader(http.StatusBadRequest)
+		response.Data = dto.ErrorModel{Message: "invalid id", Details: []*string{&detail}}
+		json.NewEncoder(w).Encode(&response)
+		return
+	}
+
+	_uid, _ := r.Context().Value(middleware.USERID).(string)
+
+	type RequestModel struct {
+		Reason      string `json:"reason"`
+		Destination string `json:"to"`
+		BankName    string `json:"bankName"`
+	}
+	var payload RequestModel
+	if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+		detail := err.Error()
+		w.WriteHeader(http.StatusBadRequest)
+		response.Data = dto.ErrorModel{Message: "invalid request body", Details: []*string{&detail}}
+		json.NewEncoder(w).Encode(&response)
+		return
+	}
+	if payload.Reason == "" {
+		payload.Reason = "closed by account holder"
+	}
+
+	type Account struct {
+		ID      uuid.UUID
+		UserId  uuid.UUID
+		Balance int64
+		Status  string
+	}
+
+	var account Account
+	tx := c.DB.Raw(`
+	SELECT id, user_id, balance, status
+	FROM accounts WHERE id = ?
+	`, accountId.String()).Scan(&account)
+	if tx.RowsAffected == 0 {
+		detail := fmt.Sprintf("account with id: %s not exist", accountId.String())
+		w.WriteHeader(http.StatusNotFound)
+		response.Data = dto.ErrorModel{Message: "account not found", Details: []*string{&detail}}
+		json.NewEncoder(w).Encode(&response)
+		return
+	}
+	if tx.Error != nil {
+		detail := tx.Error.Error()
+		w.WriteHeader(http.StatusInternalServerError)
+		response.Data = dto.ErrorModel{Message: "an error occured", Details: []*string{&detail}}
+		json.NewEncoder(w).Encode(&response)
+		return
+	}
+	if _uid != account.UserId.String() {
+		detail := "This account does not belong to the user"
+		w.WriteHeader(http.StatusForbidden)
+		response.Data = dto.ErrorModel{Message: "forbidden", Details: []*string{&detail}}
+		json.NewEncoder(w).Encode(&response)
+		return
+	}
+	// holders can only close an account they could also withdraw from,
+	// restricted accounts have to be closed by support
+	if err := models.CheckDebit(account.Status); err != nil {
+		detail := err.Error()
+		w.WriteHeader(http.StatusForbidden)
+		response.Data = dto.ErrorModel{Message: "account restricted", Details: []*string{&detail}}
+		json.NewEncoder(w).Encode(&response)
+		return
+	}
+
+	var sweep *models.BankDestination
+	if payload.Destination != "" && payload.BankName != "" {
+		bank, err := banks.Find(payload.BankName)
+		if err == nil {
+			err = bank.CheckAccount(payload.Destination)
+		}
+		if err != nil {
+			detail := err.Error()
+			w.WriteHeader(http.StatusBadRequest)
+			response.Data = dto.ErrorModel{Message: "invalid request body", Details: []*string{&detail}}
+			json.NewEncoder(w).Encode(&response)
+			return
+		}
+		sweep = &models.BankDestination{AccountNumber: payload.Destination, BankName: bank.Code}
+	}
+
+	actor := account.UserId
+	tx = c.DB.Begin()
+	swept, err := models.CloseAccount(tx, account.ID, payload.Reason, sweep, &actor)
+	if errors.Is(err, models.ErrPendingBills) {
+		tx.Rollback()
+		detail := "try again once your pending bill payments have completed"
+		w.WriteHeader(http.StatusConflict)
+		response.Data = dto.ErrorModel{Message: err.Error(), Details: []*string{&detail}}
+		json.NewEncoder(w).Encode(&response)
+		return
+	}
+	if errors.Is(err, models.ErrBalanceNotZero) || errors.Is(err, models.ErrActiveHolds) ||
+		errors.Is(err, models.ErrInvalidTransition) {
+		tx.Rollback()
+		detail := "withdraw the remaining balance or provide to and bankName to sweep it"
+		w.WriteHeader(http.StatusConflict)
+		response.Data = dto.ErrorModel{Message: err.Error(), Details: []*string{&detail}}
+		json.NewEncoder(w).Encode(&response)
+		return
+	}
+	if err != nil {
+		tx.Rollback()
+		detail := err.Error()
+		w.WriteHeader(http.StatusInternalServerError)
+		response.Data = dto.ErrorModel{Message: "failed to close account", Details: []*string{&detail}}
+		json.NewEncoder(w).Encode(&response)
+		return
+	}
+
+	event := newAuditEvent(r, response.ID, "account.close", "account", account.ID.String())
+	event.Reason = &payload.Reason
+	event.SetChanges(
+		map[string]any{"balance": account.Balance, "status": account.Status},
+		map[string]any{"balance": 0, "status": models.AccountStatusClosed},
+	)
+	if err := tx.Create(&event).Error; err != nil {
+		tx.Rollback()
+		detail := err.Error()
+		w.WriteHeader(http.StatusInternalServerError)
+		response.Data = dto.ErrorModel{Message: "failed to write audit entry", Details: []*string{&detail}}
+		json.NewEncoder(w).Encode(&response)
+		return
+	}
+
+	if err := tx.Commit().Error; err != nil {
+		detail := err.Error()
+		w.WriteHeader(http.StatusInternalServerError)
+		response.Data = dto.ErrorModel{Message: "database error", Details: []*string{&detail}}
+		json.NewEncoder(w).Encode(&response)
+		return
+	}
+
+	type CloseResponseModel struct {
+		AccountId   uuid.UUID `json:"accountId"`
+		Status      string    `json:"status"`
+		SweptAmount int64     `json:"sweptAmount"`
+		Destination *string   `json:"to"`
+		BankName    *string   `json:"bankName"`
+	}
+	data := CloseResponseModel{AccountId: account.ID, Status: models.AccountStatusClosed}
+	if swept != nil {
+		data.SweptAmount = -swept.Amount
+		data.Destination = swept.ExternalAccount
+		data.BankName = swept.BankName
+	}
+	response.Data = data
+	json.NewEncoder(w).Encode(&response)
+}
+
+// ownedAccount checks the account in the path belongs to the caller, it
+// writes the error response itself and returns false on failure.
+func (c *Controller) ownedAccount(w http.ResponseWriter, r *http.Request, response *dto.ResponseModel) (uuid.UUID, bool) {
+	accountId, err := uuid.Parse(r.PathValue("accountId"))
+	if err != nil {
+		detail := err.Error()
+		w.WriteHeader(http.StatusBadRequest)
+		response.Data = dto.ErrorModel{Message: "invalid id", Details: []*string{&detail}}
+		json.NewEncoder(w).Encode(response)
+		return accountId, false
+	}
+
+	_uid, _ := r.Context().Value(middleware.USERID).(string)
+	var owner uuid.UUID
+	tx := c.DB.Raw(`SELECT user_id FROM accounts WHERE id = ?`, accountId.String()).Scan(&owner)
+	if tx.RowsAffected == 0 {
+		detail := fmt.Sprintf("account with id: %s not exist", accountId.String())
+		w.WriteHeader(http.StatusNotFound)
+		response.Data = dto.ErrorModel{Message: "account not found", Details: []*string{&detail}}
+		json.NewEncoder(w).Encode(response)
+		return accountId, false
+	}
+	if tx.Error != nil {
+		detail := tx.Error.Error()
+		w.WriteHeader(http.StatusInternalServerError)
+		response.Data = dto.ErrorModel{Message: "an error occured", Details: []*string{&detail}}
+		json.NewEncoder(w).Encode(response)
+		return accountId, false
+	}
+	if _uid != owner.String() {
+		detail := "This account does not belong to the user"
+		w.WriteHeader(http.StatusForbidden)
+		response.Data = dto.ErrorModel{Message: "forbidden", Details: []*string{&detail}}
+		json.NewEncoder(w).Encode(response)
+		return accountId, false
+	}
+	return accountId, true
+}
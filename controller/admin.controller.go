@@ -0,0 +1,754 @@
+package controller
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/eclipseron/digital-wallet-app/dto"
+	"github.com/eclipseron/digital-wallet-app/ledger"
+	"github.com/eclipseron/digital-wallet-app/models"
+	"github.com/google/uuid"
+)
+
+// newAdminAudit builds the audit entry every admin handler has to write.
+func newAdminAudit(r *http.Request, requestID uuid.UUID, action, targetType, targetID, reason string) models.AuditEvent {
+	event := newAuditEvent(r, requestID, action, targetType, targetID)
+	event.Reason = &reason
+	return event
+}
+
+func parsePagination(r *http.Request) (limit, offset int) {
+	limit, offset = 20, 0
+	if v, err := strconv.Atoi(r.URL.Query().Get("limit")); err == nil && v > 0 && v <= 100 {
+		limit = v
+	}
+	if v, err := strconv.Atoi(r.URL.Query().Get("offset")); err == nil && v >= 0 {
+		offset = v
+	}
+	return limit, offset
+}
+
+func (c *Controller) AdminSearchUsersHandler(w http.ResponseWriter, r *http.Request) {
+	var response dto.ResponseModel
+	response.ID = uuid.New()
+	response.Timestamp = time.Now().UTC()
+	w.Header().Add("Content-Type", "application/json")
+
+	reason := strings.TrimSpace(r.URL.Query().Get("reason"))
+	if reason == "" {
+		detail := "reason query parameter is required"
+		w.WriteHeader(http.StatusBadRequest)
+		response.Data = dto.ErrorModel{Message: "invalid request", Details: []*string{&detail}}
+		json.NewEncoder(w).Encode(&response)
+		return
+	}
+	q := strings.TrimSpace(r.URL.Query().Get("q"))
+	limit, offset := parsePagination(r)
+
+	type User struct {
+		ID            uuid.UUID  `json:"userId"`
+		Name          string     `json:"name"`
+		Email         string     `json:"email"`
+		Role          string     `json:"role"`
+		AccountID     *uuid.UUID `json:"accountId"`
+		AccountNumber *string    `json:"accountNumber"`
+		CreatedAt     time.Time  `json:"createdAt"`
+	}
+
+	users := []User{}
+	pattern := "%" + q + "%"
+	tx := c.DB.Raw(`
+	SELECT u.id, u.name, u.email, u.role, a.id AS account_id, a.account_number, u.created_at
+	FROM users u
+	LEFT JOIN accounts a ON a.user_id = u.id AND a.deleted_at IS NULL
+	WHERE u.deleted_at IS NULL
+	AND (u.name ILIKE ? OR u.email ILIKE ? OR a.account_number = ? OR u.id::text = ?)
+	ORDER BY u.created_at DESC
+	LIMIT ? OFFSET ?
+	`, pattern, pattern, q, q, limit, offset).Scan(&users)
+	if tx.Error != nil {
+		detail := tx.Error.Error()
+		w.WriteHeader(http.StatusInternalServerError)
+		response.Data = dto.ErrorModel{Message: "an error occured", Details: []*string{&detail}}
+		json.NewEncoder(w).Encode(&response)
+		return
+	}
+
+	event := newAdminAudit(r, response.ID, "admin.user.search", "user", "", reason)
+	if err := c.DB.Create(&event).Error; err != nil {
+		detail := err.Error()
+		w.WriteHeader(http.StatusInternalServerError)
+		response.Data = dto.ErrorModel{Message: "failed to write audit entry", Details: []*string{&detail}}
+		json.NewEncoder(w).Encode(&response)
+		return
+	}
+
+	response.Data = users
+	json.NewEncoder(w).Encode(&response)
+}
+
+func (c *Controller) AdminGetAccountBalanceHandler(w http.ResponseWriter, r *http.Request) {
+	var response dto.ResponseModel
+	response.ID = uuid.New()
+	response.Timestamp = time.Now().UTC()
+	w.Header().Add("Content-Type", "application/json")
+
+	param := r.PathValue("accountId")
+	accountId, err := uuid.Parse(param)
+	if err != nil {
+		detail := err.Error()
+		w.WriteHeader(http.StatusBadRequest)
+		response.Data = dto.ErrorModel{Message: "invalid id", Details: []*string{&detail}}
+		json.NewEncoder(w).Encode(&response)
+		return
+	}
+	reason := strings.TrimSpace(r.URL.Query().Get("reason"))
+	if reason == "" {
+		detail := "reason query parameter is required"
+		w.WriteHeader(http.StatusBadRequest)
+		response.Data = dto.ErrorModel{Message: "invalid request", Details: []*string{&detail}}
+		json.NewEncoder(w).Encode(&response)
+		return
+	}
+
+	type Account struct {
+		ID            uuid.UUID `json:"accountId"`
+		UserId        uuid.UUID `json:"userId"`
+		AccountNumber string    `json:"accountNumber"`
+		Balance       int64     `json:"balance"`
+		Status        string    `json:"status"`
+		UpdatedAt     time.Time `json:"lastTransaction"`
+	}
+
+	var account Account
+	tx := c.DB.Raw(`
+	SELECT id, user_id, account_number, balance, status, updated_at
+	FROM accounts WHERE id = ?
+	`, accountId.String()).Scan(&account)
+	if tx.RowsAffected == 0 {
+		detail := fmt.Sprintf("account with id: %s not exist", accountId.String())
+		w.WriteHeader(http.StatusNotFound)
+		response.Data = dto.ErrorModel{Message: "account not found", Details: []*string{&detail}}
+		json.NewEncoder(w).Encode(&response)
+		return
+	}
+	if tx.Error != nil {
+		detail := tx.Error.Error()
+		w.WriteHeader(http.StatusInternalServerError)
+		response.Data = dto.ErrorModel{Message: "an error occured", Details: []*string{&detail}}
+		json.NewEncoder(w).Encode(&response)
+		return
+	}
+
+	event := newAdminAudit(r, response.ID, "admin.account.view", "account", accountId.String(), reason)
+	if err := c.DB.Create(&event).Error; err != nil {
+		detail := err.Error()
+		w.WriteHeader(http.StatusInternalServerError)
+		response.Data = dto.ErrorModel{Message: "failed to write audit entry", Details: []*string{&detail}}
+		json.NewEncoder(w).Encode(&response)
+		return
+	}
+
+	account.UpdatedAt = account.UpdatedAt.UTC()
+	response.Data = account
+	json.NewEncoder(w).Encode(&response)
+}
+
+func (c *Controller) AdminListTransactionsHandler(w http.ResponseWriter, r *http.Request) {
+	var response dto.ResponseModel
+	response.ID = uuid.New()
+	response.Timestamp = time.Now().UTC()
+	w.Header().Add("Content-Type", "application/json")
+
+	param := r.PathValue("accountId")
+	accountId, err := uuid.Parse(param)
+	if err != nil {
+		detail := err.Error()
+		w.WriteHeader(http.StatusBadRequest)
+		response.Data = dto.ErrorModel{Message: "invalid id", Details: []*string{&detail}}
+		json.NewEncoder(w).Encode(&response)
+		return
+	}
+	reason := strings.TrimSpace(r.URL.Query().Get("reason"))
+	if reason == "" {
+		detail := "reason query parameter is required"
+		w.WriteHeader(http.StatusBadRequest)
+		response.Data = dto.ErrorModel{Message: "invalid request", Details: []*string{&detail}}
+		json.NewEncoder(w).Encode(&response)
+		return
+	}
+	limit, offset := parsePagination(r)
+
+	type Transaction struct {
+		ID               uuid.UUID  `json:"transactionId"`
+		Amount           int64      `json:"amount"`
+		Type             string     `json:"type"`
+		Description      *string    `json:"description"`
+		RelatedAccountID *uuid.UUID `json:"relatedAccountId"`
+		ExternalAccount  *string    `json:"externalAccount"`
+		BankName         *string    `json:"bankName"`
+		Category         string     `json:"category"`
+		ReversalOf       *uuid.UUID `json:"reversalOf"`
+		ReversedAmount   int64      `json:"reversedAmount"`
+		ReversedAt       *time.Time `json:"reversedAt"`
+		CreatedAt        time.Time  `json:"at"`
+	}
+
+	transactions := []Transaction{}
+	tx := c.DB.Raw(`
+	SELECT id, amount, type, description, related_account_id, external_account, bank_name,
+	category, reversal_of, reversed_amount, reversed_at, created_at
+	FROM transactions WHERE account_id = ? AND deleted_at IS NULL
+	ORDER BY created_at DESC
+	LIMIT ? OFFSET ?
+	`, accountId.String(), limit, offset).Scan(&transactions)
+	if tx.Error != nil {
+		detail := tx.Error.Error()
+		w.WriteHeader(http.StatusInternalServerError)
+		response.Data = dto.ErrorModel{Message: "an error occured", Details: []*string{&detail}}
+		json.NewEncoder(w).Encode(&response)
+		return
+	}
+
+	event := newAdminAudit(r, response.ID, "admin.account.history", "account", accountId.String(), reason)
+	if err := c.DB.Create(&event).Error; err != nil {
+		detail := err.Error()
+		w.WriteHeader(http.StatusInternalServerError)
+		response.Data = dto.ErrorModel{Message: "failed to write audit entry", Details: []*string{&detail}}
+		json.NewEncoder(w).Encode(&response)
+		return
+	}
+
+	for i := range transactions {
+		transactions[i].CreatedAt = transactions[i].CreatedAt.UTC()
+	}
+	response.Data = transactions
+	json.NewEncoder(w).Encode(&response)
+}
+
+func (c *Controller) AdminFreezeAccountHandler(w http.ResponseWriter, r *http.Request) {
+	c.setAccountStatus(w, r, models.AccountStatusFrozen)
+}
+
+func (c *Controller) AdminUnfreezeAccountHandler(w http.ResponseWriter, r *http.Request) {
+	c.setAccountStatus(w, r, models.AccountStatusActive)
+}
+
+// AdminSetAccountStatusHandler takes the target status from the request body.
+// Closing an account goes through AdminCloseAccountHandler instead.
+func (c *Controller) AdminSetAccountStatusHandler(w http.ResponseWriter, r *http.Request) {
+	c.setAccountStatus(w, r, "")
+}
+
+func (c *Controller) setAccountStatus(w http.ResponseWriter, r *http.Request, status string) {
+	var response dto.ResponseModel
+	response.ID = uuid.New()
+	response.Timestamp = time.Now().UTC()
+	w.Header().Add("Content-Type", "application/json")
+
+	param := r.PathValue("accountId")
+	accountId, err := uuid.Parse(param)
+	if err != nil {
+		detail := err.Error()
+		w.WriteHeader(http.StatusBadRequest)
+		response.Data = dto.ErrorModel{Message: "invalid id", Details: []*string{&detail}}
+		json.NewEncoder(w).Encode(&response)
+		return
+	}
+
+	type RequestModel struct {
+		Status string `json:"status"`
+		Reason string `json:"reason"`
+	}
+	var payload RequestModel
+	if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+		detail := err.Error()
+		w.WriteHeader(http.StatusBadRequest)
+		response.Data = dto.ErrorModel{Message: "invalid request body", Details: []*string{&detail}}
+		json.NewEncoder(w).Encode(&response)
+		return
+	}
+	if status == "" {
+		status = payload.Status
+	}
+	if !models.IsValidAccountStatus(status) || status == models.AccountStatusClosed {
+		detail := "status must be one of ACTIVE, DEBIT_FROZEN, FROZEN, DORMANT"
+		w.WriteHeader(http.StatusBadRequest)
+		response.Data = dto.ErrorModel{Message: "invalid request body", Details: []*string{&detail}}
+		json.NewEncoder(w).Encode(&response)
+		return
+	}
+	if strings.TrimSpace(payload.Reason) == "" {
+		detail := "reason is required"
+		w.WriteHeader(http.StatusBadRequest)
+		response.Data = dto.ErrorModel{Message: "invalid request body", Details: []*string{&detail}}
+		json.NewEncoder(w).Encode(&response)
+		return
+	}
+
+	event := newAdminAudit(r, response.ID, "admin.account.status", "account", accountId.String(), payload.Reason)
+
+	tx := c.DB.Begin()
+	from, err := models.ChangeAccountStatus(tx, accountId, status, payload.Reason, event.ActorID)
+	if errors.Is(err, models.ErrAccountNotFound) {
+		tx.Rollback()
+		detail := fmt.Sprintf("account with id: %s not exist", accountId.String())
+		w.WriteHeader(http.StatusNotFound)
+		response.Data = dto.ErrorModel{Message: "account not found", Details: []*string{&detail}}
+		json.NewEncoder(w).Encode(&response)
+		return
+	}
+	if errors.Is(err, models.ErrInvalidTransition) {
+		tx.Rollback()
+		detail := fmt.Sprintf("cannot change status from %s to %s", from, status)
+		w.WriteHeader(http.StatusConflict)
+		response.Data = dto.ErrorModel{Message: err.Error(), Details: []*string{&detail}}
+		json.NewEncoder(w).Encode(&response)
+		return
+	}
+	if err != nil {
+		tx.Rollback()
+		detail := err.Error()
+		w.WriteHeader(http.StatusInternalServerError)
+		response.Data = dto.ErrorModel{Message: "failed to update account", Details: []*string{&detail}}
+		json.NewEncoder(w).Encode(&response)
+		return
+	}
+
+	event.SetChanges(map[string]string{"status": from}, map[string]string{"status": status})
+	if err := tx.Create(&event).Error; err != nil {
+		tx.Rollback()
+		detail := err.Error()
+		w.WriteHeader(http.StatusInternalServerError)
+		response.Data = dto.ErrorModel{Message: "failed to write audit entry", Details: []*string{&detail}}
+		json.NewEncoder(w).Encode(&response)
+		return
+	}
+
+	if err := tx.Commit().Error; err != nil {
+		detail := err.Error()
+		w.WriteHeader(http.StatusInternalServerError)
+		response.Data = dto.ErrorModel{Message: "database error", Details: []*string{&detail}}
+		json.NewEncoder(w).Encode(&response)
+		return
+	}
+
+	type StatusResponseModel struct {
+		AccountId      uuid.UUID `json:"accountId"`
+		PreviousStatus string    `json:"previousStatus"`
+		Status         string    `json:"status"`
+		Reason         string    `json:"reason"`
+		At             time.Time `json:"at"`
+	}
+	response.Data = StatusResponseModel{
+		AccountId:      accountId,
+		PreviousStatus: from,
+		Status:         status,
+		Reason:         payload.Reason,
+		At:             time.Now().UTC(),
+	}
+	json.NewEncoder(w).Encode(&response)
+}
+
+func (c *Controller) AdminCloseAccountHandler(w http.ResponseWriter, r *http.Request) {
+	var response dto.ResponseModel
+	response.ID = uuid.New()
+	response.Timestamp = time.Now().UTC()
+	w.Header().Add("Content-Type", "application/json")
+
+	param := r.PathValue("accountId")
+	accountId, err := uuid.Parse(param)
+	if err != nil {
+		detail := err.Error()
+		w.WriteHeader(http.StatusBadRequest)
+		response.Data = dto.ErrorModel{Message: "invalid id", Details: []*string{&detail}}
+		json.NewEncoder(w).Encode(&response)
+		return
+	}
+
+	type RequestModel struct {
+		Reason      string `json:"reason"`
+		Force       bool   `json:"force"`
+		Destination string `json:"to"`
+		BankName    string `json:"bankName"`
+	}
+	var payload RequestModel
+	if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+		detail := err.Error()
+		w.WriteHeader(http.StatusBadRequest)
+		response.Data = dto.ErrorModel{Message: "invalid request body", Details: []*string{&detail}}
+		json.NewEncoder(w).Encode(&response)
+		return
+	}
+	if strings.TrimSpace(payload.Reason) == "" {
+		detail := "reason is required"
+		w.WriteHeader(http.StatusBadRequest)
+		response.Data = dto.ErrorModel{Message: "invalid request body", Details: []*string{&detail}}
+		json.NewEncoder(w).Encode(&response)
+		return
+	}
+
+	// a forced close sweeps whatever is left to the designated bank account
+	var sweep *models.BankDestination
+	if payload.Force {
+		if payload.Destination == "" || payload.BankName == "" {
+			detail := "to and bankName is required for a forced sweep"
+			w.WriteHeader(http.StatusBadRequest)
+			response.Data = dto.ErrorModel{Message: "invalid request body", Details: []*string{&detail}}
+			json.NewEncoder(w).Encode(&response)
+			return
+		}
+		sweep = &models.BankDestination{AccountNumber: payload.Destination, BankName: payload.BankName}
+	}
+
+	event := newAdminAudit(r, response.ID, "admin.account.close", "account", accountId.String(), payload.Reason)
+
+	tx := c.DB.Begin()
+	swept, err := models.CloseAccount(tx, accountId, payload.Reason, sweep, event.ActorID)
+	if errors.Is(err, models.ErrAccountNotFound) {
+		tx.Rollback()
+		detail := fmt.Sprintf("account with id: %s not exist", accountId.String())
+		w.WriteHeader(http.StatusNotFound)
+		response.Data = dto.ErrorModel{Message: "account not found", Details: []*string{&detail}}
+		json.NewEncoder(w).Encode(&response)
+		return
+	}
+	if errors.Is(err, models.ErrBalanceNotZero) || errors.Is(err, models.ErrActiveHolds) ||
+		errors.Is(err, models.ErrPendingBills) || errors.Is(err, models.ErrInvalidTransition) {
+		tx.Rollback()
+		detail := err.Error()
+		w.WriteHeader(http.StatusConflict)
+		response.Data = dto.ErrorModel{Message: "cannot close account", Details: []*string{&detail}}
+		json.NewEncoder(w).Encode(&response)
+		return
+	}
+	if err != nil {
+		tx.Rollback()
+		detail := err.Error()
+		w.WriteHeader(http.StatusInternalServerError)
+		response.Data = dto.ErrorModel{Message: "failed to close account", Details: []*string{&detail}}
+		json.NewEncoder(w).Encode(&response)
+		return
+	}
+
+	var sweptAmount int64
+	if swept != nil {
+		sweptAmount = -swept.Amount
+	}
+	event.SetChanges(
+		map[string]any{"balance": sweptAmount},
+		map[string]any{"balance": 0, "status": models.AccountStatusClosed},
+	)
+	if err := tx.Create(&event).Error; err != nil {
+		tx.Rollback()
+		detail := err.Error()
+		w.WriteHeader(http.StatusInternalServerError)
+		response.Data = dto.ErrorModel{Message: "failed to write audit entry", Details: []*string{&detail}}
+		json.NewEncoder(w).Encode(&response)
+		return
+	}
+
+	if err := tx.Commit().Error; err != nil {
+		detail := err.Error()
+		w.WriteHeader(http.StatusInternalServerError)
+		response.Data = dto.ErrorModel{Message: "database error", Details: []*string{&detail}}
+		json.NewEncoder(w).Encode(&response)
+		return
+	}
+
+	type CloseResponseModel struct {
+		AccountId   uuid.UUID `json:"accountId"`
+		Status      string    `json:"status"`
+		SweptAmount int64     `json:"sweptAmount"`
+		Destination *string   `json:"to"`
+		BankName    *string   `json:"bankName"`
+	}
+	data := CloseResponseModel{AccountId: accountId, Status: models.AccountStatusClosed}
+	if swept != nil {
+		data.SweptAmount = -swept.Amount
+		data.Destination = swept.ExternalAccount
+		data.BankName = swept.BankName
+	}
+	response.Data = data
+	json.NewEncoder(w).Encode(&response)
+}
+func (c *Controller) AdminAdjustBalanceHandler(w http.ResponseWriter, r *http.Request) {
+	var response dto.ResponseModel
+	response.ID = uuid.New()
+	response.Timestamp = time.Now().UTC()
+	w.Header().Add("Content-Type", "application/json")
+
+	param := r.PathValue("accountId")
+	accountId, err := uuid.Parse(param)
+	if err != nil {
+		detail := err.Error()
+		w.WriteHeader(http.StatusBadRequest)
+		response.Data = dto.ErrorModel{Message: "invalid id", Details: []*string{&detail}}
+		json.NewEncoder(w).Encode(&response)
+		return
+	}
+
+	type RequestModel struct {
+		Amount int64  `json:"amount"`
+		Reason string `json:"reason"`
+	}
+	var payload RequestModel
+	if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+		detail := err.Error()
+		w.WriteHeader(http.StatusBadRequest)
+		response.Data = dto.ErrorModel{Message: "invalid request body", Details: []*string{&detail}}
+		json.NewEncoder(w).Encode(&response)
+		return
+	}
+	if payload.Amount == 0 || strings.TrimSpace(payload.Reason) == "" {
+		detail := "non-zero amount and reason is required"
+		w.WriteHeader(http.StatusBadRequest)
+		response.Data = dto.ErrorModel{Message: "invalid request body", Details: []*string{&detail}}
+		json.NewEncoder(w).Encode(&response)
+		return
+	}
+
+	type Account struct {
+		ID            uuid.UUID
+		AccountNumber string
+		Balance       int64
+		Status        string
+	}
+
+	var account Account
+	tx := c.DB.Begin()
+	res := tx.Raw(`
+	UPDATE accounts SET balance = balance + ?, updated_at = now()
+	WHERE id = ? AND deleted_at IS NULL
+	RETURNING id, account_number, balance, status
+	`, payload.Amount, accountId.String()).Scan(&account)
+	if res.Error != nil {
+		tx.Rollback()
+		detail := res.Error.Error()
+		w.WriteHeader(http.StatusInternalServerError)
+		response.Data = dto.ErrorModel{Message: "failed to update balance", Details: []*string{&detail}}
+		json.NewEncoder(w).Encode(&response)
+		return
+	}
+	if res.RowsAffected == 0 {
+		tx.Rollback()
+		detail := fmt.Sprintf("account with id: %s not exist", accountId.String())
+		w.WriteHeader(http.StatusNotFound)
+		response.Data = dto.ErrorModel{Message: "account not found", Details: []*string{&detail}}
+		json.NewEncoder(w).Encode(&response)
+		return
+	}
+	if account.Status == models.AccountStatusClosed {
+		tx.Rollback()
+		detail := models.ErrAccountClosed.Error()
+		w.WriteHeader(http.StatusForbidden)
+		response.Data = dto.ErrorModel{Message: "account restricted", Details: []*string{&detail}}
+		json.NewEncoder(w).Encode(&response)
+		return
+	}
+	if account.Balance < 0 {
+		tx.Rollback()
+		w.WriteHeader(http.StatusBadRequest)
+		response.Data = dto.ErrorModel{Message: "insufficient balance"}
+		json.NewEncoder(w).Encode(&response)
+		return
+	}
+
+	accTx := models.Transactions{
+		AccountID:   account.ID,
+		Amount:      payload.Amount,
+		Type:        "ADJUSTMENT",
+		Description: &payload.Reason,
+	}
+	if err := tx.Create(&accTx).Error; err != nil {
+		tx.Rollback()
+		detail := err.Error()
+		w.WriteHeader(http.StatusInternalServerError)
+		response.Data = dto.ErrorModel{Message: "failed to create transaction", Details: []*string{&detail}}
+		json.NewEncoder(w).Encode(&response)
+		return
+	}
+
+	event := newAdminAudit(r, response.ID, "admin.account.adjust", "account", accountId.String(), payload.Reason)
+	event.SetChanges(
+		map[string]int64{"balance": account.Balance - payload.Amount},
+		map[string]int64{"balance": account.Balance},
+	)
+	if err := tx.Create(&event).Error; err != nil {
+		tx.Rollback()
+		detail := err.Error()
+		w.WriteHeader(http.StatusInternalServerError)
+		response.Data = dto.ErrorModel{Message: "failed to write audit entry", Details: []*string{&detail}}
+		json.NewEncoder(w).Encode(&response)
+		return
+	}
+
+	if err := tx.Commit().Error; err != nil {
+		detail := err.Error()
+		w.WriteHeader(http.StatusInternalServerError)
+		response.Data = dto.ErrorModel{Message: "database error", Details: []*string{&detail}}
+		json.NewEncoder(w).Encode(&response)
+		return
+	}
+
+	type AdjustmentResponseModel struct {
+		AccountId     uuid.UUID `json:"accountId"`
+		AccountNumber string    `json:"accountNumber"`
+		TransactionId uuid.UUID `json:"transactionId"`
+		Amount        int64     `json:"amount"`
+		Type          string    `json:"type"`
+		FinalBalance  int64     `json:"finalBalance"`
+		Reason        string    `json:"reason"`
+		At            time.Time `json:"at"`
+	}
+	response.Data = AdjustmentResponseModel{
+		AccountId:     account.ID,
+		AccountNumber: account.AccountNumber,
+		TransactionId: accTx.ID,
+		Amount:        payload.Amount,
+		Type:          accTx.Type,
+		FinalBalance:  account.Balance,
+		Reason:        payload.Reason,
+		At:            accTx.CreatedAt.UTC(),
+	}
+	json.NewEncoder(w).Encode(&response)
+}
+
+func (c *Controller) AdminUpdateUserRoleHandler(w http.ResponseWriter, r *http.Request) {
+	var response dto.ResponseModel
+	response.ID = uuid.New()
+	response.Timestamp = time.Now().UTC()
+	w.Header().Add("Content-Type", "application/json")
+
+	param := r.PathValue("userId")
+	userId, err := uuid.Parse(param)
+	if err != nil {
+		detail := err.Error()
+		w.WriteHeader(http.StatusBadRequest)
+		response.Data = dto.ErrorModel{Message: "invalid id", Details: []*string{&detail}}
+		json.NewEncoder(w).Encode(&response)
+		return
+	}
+
+	type RequestModel struct {
+		Role   string `json:"role"`
+		Reason string `json:"reason"`
+	}
+	var payload RequestModel
+	if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+		detail := err.Error()
+		w.WriteHeader(http.StatusBadRequest)
+		response.Data = dto.ErrorModel{Message: "invalid request body", Details: []*string{&detail}}
+		json.NewEncoder(w).Encode(&response)
+		return
+	}
+	if !models.IsValidRole(payload.Role) || strings.TrimSpace(payload.Reason) == "" {
+		detail := "role must be one of customer, support, finance, admin and reason is required"
+		w.WriteHeader(http.StatusBadRequest)
+		response.Data = dto.ErrorModel{Message: "invalid request body", Details: []*string{&detail}}
+		json.NewEncoder(w).Encode(&response)
+		return
+	}
+
+	var previousRole string
+	tx := c.DB.Begin()
+	res := tx.Raw(`
+	UPDATE users u SET role = ?, updated_at = now()
+	FROM (SELECT id, role FROM users WHERE id = ? AND deleted_at IS NULL FOR UPDATE) old
+	WHERE u.id = old.id
+	RETURNING old.role
+	`, payload.Role, userId.String()).Scan(&previousRole)
+	if res.Error != nil {
+		tx.Rollback()
+		detail := res.Error.Error()
+		w.WriteHeader(http.StatusInternalServerError)
+		response.Data = dto.ErrorModel{Message: "failed to update user", Details: []*string{&detail}}
+		json.NewEncoder(w).Encode(&response)
+		return
+	}
+	if res.RowsAffected == 0 {
+		tx.Rollback()
+		detail := fmt.Sprintf("user with id: %s not exist", userId.String())
+		w.WriteHeader(http.StatusNotFound)
+		response.Data = dto.ErrorModel{Message: "user not found", Details: []*string{&detail}}
+		json.NewEncoder(w).Encode(&response)
+		return
+	}
+
+	event := newAdminAudit(r, response.ID, "admin.user.role", "user", userId.String(), payload.Reason)
+	event.SetChanges(map[string]string{"role": previousRole}, map[string]string{"role": payload.Role})
+	if err := tx.Create(&event).Error; err != nil {
+		tx.Rollback()
+		detail := err.Error()
+		w.WriteHeader(http.StatusInternalServerError)
+		response.Data = dto.ErrorModel{Message: "failed to write audit entry", Details: []*string{&detail}}
+		json.NewEncoder(w).Encode(&response)
+		return
+	}
+
+	if err := tx.Commit().Error; err != nil {
+		detail := err.Error()
+		w.WriteHeader(http.StatusInternalServerError)
+		response.Data = dto.ErrorModel{Message: "database error", Details: []*string{&detail}}
+		json.NewEncoder(w).Encode(&response)
+		return
+	}
+
+	type RoleResponseModel struct {
+		UserId uuid.UUID `json:"userId"`
+		Role   string    `json:"role"`
+	}
+	response.Data = RoleResponseModel{UserId: userId, Role: payload.Role}
+	json.NewEncoder(w).Encode(&response)
+}
+
+func (c *Controller) AdminVerifyChainHandler(w http.ResponseWriter, r *http.Request) {
+	var response dto.ResponseModel
+	response.ID = uuid.New()
+	response.Timestamp = time.Now().UTC()
+	w.Header().Add("Content-Type", "application/json")
+
+	param := r.PathValue("accountId")
+	accountId, err := uuid.Parse(param)
+	if err != nil {
+		detail := err.Error()
+		w.WriteHeader(http.StatusBadRequest)
+		response.Data = dto.ErrorModel{Message: "invalid id", Details: []*string{&detail}}
+		json.NewEncoder(w).Encode(&response)
+		return
+	}
+	reason := strings.TrimSpace(r.URL.Query().Get("reason"))
+	if reason == "" {
+		detail := "reason query parameter is required"
+		w.WriteHeader(http.StatusBadRequest)
+		response.Data = dto.ErrorModel{Message: "invalid request", Details: []*string{&detail}}
+		json.NewEncoder(w).Encode(&response)
+		return
+	}
+
+	report, err := ledger.VerifyChain(c.DB, accountId)
+	if err != nil {
+		detail := err.Error()
+		w.WriteHeader(http.StatusInternalServerError)
+		response.Data = dto.ErrorModel{Message: "failed to verify chain", Details: []*string{&detail}}
+		json.NewEncoder(w).Encode(&response)
+		return
+	}
+
+	event := newAdminAudit(r, response.ID, "admin.account.verify_chain", "account", accountId.String(), reason)
+	if err := c.DB.Create(&event).Error; err != nil {
+		detail := err.Error()
+		w.WriteHeader(http.StatusInternalServerError)
+		response.Data = dto.ErrorModel{Message: "failed to write audit entry", Details: []*string{&detail}}
+		json.NewEncoder(w).Encode(&response)
+		return
+	}
+
+	response.Data = report
+	json.NewEncoder(w).Encode(&response)
+}
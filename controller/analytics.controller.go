@@ -0,0 +1,180 @@
+package controller
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/eclipseron/digital-wallet-app/analytics"
+	"github.com/eclipseron/digital-wallet-app/dto"
+	"github.com/eclipseron/digital-wallet-app/middleware"
+	"github.com/eclipseron/digital-wallet-app/models"
+	"github.com/eclipseron/digital-wallet-app/settlement"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// AccountAnalyticsHandler answers ?interval=day|week|month&from=&to= (dates
+// as YYYY-MM-DD) with money in and out by bucket and category. It covers the
+// last 6 months by default.
+func (c *Controller) AccountAnalyticsHandler(w http.ResponseWriter, r *http.Request) {
+	var response dto.ResponseModel
+	response.ID = uuid.New()
+	response.Timestamp = time.Now().UTC()
+	w.Header().Add("Content-Type", "application/json")
+
+	accountId, ok := c.ownedAccount(w, r, &response)
+	if !ok {
+		return
+	}
+
+	query := r.URL.Query()
+	interval := strings.ToLower(query.Get("interval"))
+	if interval == "" {
+		interval = analytics.IntervalMonth
+	}
+	var err error
+	to := time.Now().In(settlement.Location)
+	if s := query.Get("to"); s != "" {
+		to, err = settlement.ParseDate(s)
+	}
+	from := to.AddDate(0, -5, 0)
+	if s := query.Get("from"); s != "" && err == nil {
+		from, err = settlement.ParseDate(s)
+	}
+	if err == nil && from.After(to) {
+		err = errors.New("from must not be after to")
+	}
+	if err != nil {
+		detail := err.Error()
+		w.WriteHeader(http.StatusBadRequest)
+		response.Data = dto.ErrorModel{Message: "invalid request", Details: []*string{&detail}}
+		json.NewEncoder(w).Encode(&response)
+		return
+	}
+
+	report, err := analytics.Build(c.DB, accountId, interval, from, to)
+	if errors.Is(err, analytics.ErrInterval) || errors.Is(err, analytics.ErrRange) {
+		detail := err.Error()
+		w.WriteHeader(http.StatusBadRequest)
+		response.Data = dto.ErrorModel{Message: "invalid request", Details: []*string{&detail}}
+		json.NewEncoder(w).Encode(&response)
+		return
+	}
+	if err != nil {
+		detail := err.Error()
+		w.WriteHeader(http.StatusInternalServerError)
+		response.Data = dto.ErrorModel{Message: "failed to build analytics", Details: []*string{&detail}}
+		json.NewEncoder(w).Encode(&response)
+		return
+	}
+
+	response.Data = report
+	json.NewEncoder(w).Encode(&response)
+}
+
+// SetTransactionCategoryHandler lets the account holder override the
+// category rules picked for a transaction.
+func (c *Controller) SetTransactionCategoryHandler(w http.ResponseWriter, r *http.Request) {
+	var response dto.ResponseModel
+	response.ID = uuid.New()
+	response.Timestamp = time.Now().UTC()
+	w.Header().Add("Content-Type", "application/json")
+
+	transactionId, err := uuid.Parse(r.PathValue("transactionId"))
+	if err != nil {
+		detail := err.Error()
+		w.WriteHeader(http.StatusBadRequest)
+		response.Data = dto.ErrorModel{Message: "invalid id", Details: []*string{&detail}}
+		json.NewEncoder(w).Encode(&response)
+		return
+	}
+
+	type Request struct {
+		Category string `json:"category"`
+	}
+	var payload Request
+	if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+		detail := err.Error()
+		w.WriteHeader(http.StatusBadRequest)
+		response.Data = dto.ErrorModel{Message: "invalid request", Details: []*string{&detail}}
+		json.NewEncoder(w).Encode(&response)
+		return
+	}
+	payload.Category = strings.ToUpper(strings.TrimSpace(payload.Category))
+	if !models.IsCategory(payload.Category) {
+		detail := fmt.Sprintf("category must be one of %s", strings.Join(models.Categories, ", "))
+		w.WriteHeader(http.StatusBadRequest)
+		response.Data = dto.ErrorModel{Message: "invalid request", Details: []*string{&detail}}
+		json.NewEncoder(w).Encode(&response)
+		return
+	}
+
+	_uid, _ := r.Context().Value(middleware.USERID).(string)
+	var before string
+	err = c.DB.Transaction(func(tx *gorm.DB) error {
+		var t struct {
+			Category string
+			UserID   uuid.UUID
+		}
+		res := tx.Raw(`
+		SELECT t.category, a.user_id FROM transactions t
+		JOIN accounts a ON a.id = t.account_id
+		WHERE t.id = ? AND t.deleted_at IS NULL
+		FOR UPDATE OF t
+		`, transactionId.String()).Scan(&t)
+		if res.Error != nil {
+			return res.Error
+		}
+		if res.RowsAffected == 0 {
+			return gorm.ErrRecordNotFound
+		}
+		if _uid != t.UserID.String() {
+			return errForbidden
+		}
+		before = t.Category
+
+		err := tx.Exec(`
+		UPDATE transactions SET category = ?, category_overridden = TRUE, updated_at = ? WHERE id = ?
+		`, payload.Category, time.Now(), transactionId.String()).Error
+		if err != nil {
+			return err
+		}
+
+		event := newAuditEvent(r, response.ID, "transaction.category", "transaction", transactionId.String())
+		event.SetChanges(map[string]any{"category": before}, map[string]any{"category": payload.Category})
+		return tx.Create(&event).Error
+	})
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		detail := fmt.Sprintf("transaction with id: %s not exist", transactionId.String())
+		w.WriteHeader(http.StatusNotFound)
+		response.Data = dto.ErrorModel{Message: "transaction not found", Details: []*string{&detail}}
+		json.NewEncoder(w).Encode(&response)
+		return
+	}
+	if errors.Is(err, errForbidden) {
+		detail := "This transaction does not belong to the user"
+		w.WriteHeader(http.StatusForbidden)
+		response.Data = dto.ErrorModel{Message: "forbidden", Details: []*string{&detail}}
+		json.NewEncoder(w).Encode(&response)
+		return
+	}
+	if err != nil {
+		detail := err.Error()
+		w.WriteHeader(http.StatusInternalServerError)
+		response.Data = dto.ErrorModel{Message: "failed to update category", Details: []*string{&detail}}
+		json.NewEncoder(w).Encode(&response)
+		return
+	}
+
+	type CategoryResponseModel struct {
+		TransactionId uuid.UUID `json:"transactionId"`
+		Category      string    `json:"category"`
+		Previous      string    `json:"previousCategory"`
+	}
+	response.Data = CategoryResponseModel{TransactionId: transactionId, Category: payload.Category, Previous: before}
+	json.NewEncoder(w).Encode(&response)
+}
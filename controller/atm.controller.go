@@ -0,0 +1,346 @@
+package controller
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/eclipseron/digital-wallet-app/atm"
+	"github.com/eclipseron/digital-wallet-app/dto"
+	"github.com/eclipseron/digital-wallet-app/ledger"
+	"github.com/eclipseron/digital-wallet-app/middleware"
+	"github.com/eclipseron/digital-wallet-app/models"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// maxATMCallbackBody bounds the body of an ATM network callback.
+const maxATMCallbackBody = 4 << 10
+
+type ATMCodeResponseModel struct {
+	CodeId        uuid.UUID  `json:"codeId"`
+	AccountId     uuid.UUID  `json:"accountId"`
+	Amount        int64      `json:"amount"`
+	Status        string     `json:"status"`
+	Code          *string    `json:"code,omitempty"`
+	Pin           *string    `json:"pin,omitempty"`
+	PinFailures   int        `json:"pinFailures"`
+	TerminalId    *string    `json:"terminalId"`
+	TransactionId *uuid.UUID `json:"transactionId"`
+	ExpiresAt     time.Time  `json:"expiresAt"`
+	ClosedAt      *time.Time `json:"closedAt"`
+	CreatedAt     time.Time  `json:"createdAt"`
+}
+
+func newATMCodeResponse(c *models.ATMCode) ATMCodeResponseModel {
+	res := ATMCodeResponseModel{
+		CodeId:        c.ID,
+		AccountId:     c.AccountID,
+		Amount:        c.Amount,
+		Status:        c.Status,
+		PinFailures:   c.PinFailures,
+		TerminalId:    c.TerminalID,
+		TransactionId: c.TransactionID,
+		ExpiresAt:     c.ExpiresAt.UTC(),
+		CreatedAt:     c.CreatedAt.UTC(),
+	}
+	if c.ClosedAt != nil {
+		at := c.ClosedAt.UTC()
+		res.ClosedAt = &at
+	}
+	return res
+}
+
+// CreateATMCodeHandler issues a cardless withdrawal code and PIN for an
+// amount, reserving it on the account. Both are only shown in this response.
+func (c *Controller) CreateATMCodeHandler(w http.ResponseWriter, r *http.Request) {
+	var response dto.ResponseModel
+	response.ID = uuid.New()
+	response.Timestamp = time.Now().UTC()
+	w.Header().Add("Content-Type", "application/json")
+
+	accountId, ok := c.ownedAccount(w, r, &response)
+	if !ok {
+		return
+	}
+
+	type RequestModel struct {
+		Amount int64  `json:"amount"`
+		Pin    string `json:"pin"`
+	}
+	var payload RequestModel
+	if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+		detail := err.Error()
+		w.WriteHeader(http.StatusBadRequest)
+		response.Data = dto.ErrorModel{Message: "invalid request body", Details: []*string{&detail}}
+		json.NewEncoder(w).Encode(&response)
+		return
+	}
+
+	_uid, _ := r.Context().Value(middleware.USERID).(string)
+	userId, _ := uuid.Parse(_uid)
+	if err := c.verifyPin(userId, payload.Pin); err != nil {
+		status := http.StatusForbidden
+		if !errors.Is(err, errPin) {
+			status = http.StatusInternalServerError
+		}
+		detail := err.Error()
+		w.WriteHeader(status)
+		response.Data = dto.ErrorModel{Message: "pin verification failed", Details: []*string{&detail}}
+		json.NewEncoder(w).Encode(&response)
+		return
+	}
+
+	var code *models.ATMCode
+	var plainCode, plainPin string
+	err := c.DB.Transaction(func(tx *gorm.DB) error {
+		var err error
+		code, plainCode, plainPin, err = atm.Issue(tx, accountId, userId, payload.Amount)
+		if err != nil {
+			return err
+		}
+		event := newAuditEvent(r, response.ID, "atm.code.issue", "atm_code", code.ID.String())
+		event.SetChanges(nil, map[string]any{
+			"amount": code.Amount, "status": code.Status, "holdId": code.HoldID, "expiresAt": code.ExpiresAt.UTC(),
+		})
+		return tx.Create(&event).Error
+	})
+	if errors.Is(err, atm.ErrAmount) {
+		detail := err.Error()
+		w.WriteHeader(http.StatusBadRequest)
+		response.Data = dto.ErrorModel{Message: "invalid request body", Details: []*string{&detail}}
+		json.NewEncoder(w).Encode(&response)
+		return
+	}
+	if errors.Is(err, ledger.ErrInsufficientBalance) {
+		c.transferFailed(accountId, "WITHDRAW", payload.Amount, err.Error(), nil, nil)
+		w.WriteHeader(http.StatusBadRequest)
+		response.Data = dto.ErrorModel{Message: "insufficient balance"}
+		json.NewEncoder(w).Encode(&response)
+		return
+	}
+	if models.IsRestricted(err) {
+		detail := err.Error()
+		c.transferFailed(accountId, "WITHDRAW", payload.Amount, detail, nil, nil)
+		w.WriteHeader(http.StatusForbidden)
+		response.Data = dto.ErrorModel{Message: "account restricted", Details: []*string{&detail}}
+		json.NewEncoder(w).Encode(&response)
+		return
+	}
+	if err != nil {
+		detail := err.Error()
+		w.WriteHeader(http.StatusInternalServerError)
+		response.Data = dto.ErrorModel{Message: "failed to issue withdrawal code", Details: []*string{&detail}}
+		json.NewEncoder(w).Encode(&response)
+		return
+	}
+
+	res := newATMCodeResponse(code)
+	res.Code = &plainCode
+	res.Pin = &plainPin
+	w.WriteHeader(http.StatusCreated)
+	response.Data = res
+	json.NewEncoder(w).Encode(&response)
+}
+
+// ListATMCodesHandler lists the withdrawal codes of an owned account, the
+// newest first, optionally of one ?status=.
+func (c *Controller) ListATMCodesHandler(w http.ResponseWriter, r *http.Request) {
+	var response dto.ResponseModel
+	response.ID = uuid.New()
+	response.Timestamp = time.Now().UTC()
+	w.Header().Add("Content-Type", "application/json")
+
+	accountId, ok := c.ownedAccount(w, r, &response)
+	if !ok {
+		return
+	}
+	limit, offset := parsePagination(r)
+
+	query := c.DB.Where("account_id = ?", accountId.String())
+	if status := strings.ToUpper(r.URL.Query().Get("status")); status != "" {
+		query = query.Where("status = ?", status)
+	}
+	var codes []models.ATMCode
+	if err := query.Order("created_at DESC").Limit(limit).Offset(offset).Find(&codes).Error; err != nil {
+		detail := err.Error()
+		w.WriteHeader(http.StatusInternalServerError)
+		response.Data = dto.ErrorModel{Message: "an error occured", Details: []*string{&detail}}
+		json.NewEncoder(w).Encode(&response)
+		return
+	}
+
+	data := make([]ATMCodeResponseModel, 0, len(codes))
+	for i := range codes {
+		data = append(data, newATMCodeResponse(&codes[i]))
+	}
+	response.Data = data
+	json.NewEncoder(w).Encode(&response)
+}
+
+// CancelATMCodeHandler cancels an active code and releases its hold.
+func (c *Controller) CancelATMCodeHandler(w http.ResponseWriter, r *http.Request) {
+	var response dto.ResponseModel
+	response.ID = uuid.New()
+	response.Timestamp = time.Now().UTC()
+	w.Header().Add("Content-Type", "application/json")
+
+	accountId, ok := c.ownedAccount(w, r, &response)
+	if !ok {
+		return
+	}
+	codeId, err := uuid.Parse(r.PathValue("codeId"))
+	if err != nil {
+		detail := err.Error()
+		w.WriteHeader(http.StatusBadRequest)
+		response.Data = dto.ErrorModel{Message: "invalid id", Details: []*string{&detail}}
+		json.NewEncoder(w).Encode(&response)
+		return
+	}
+
+	var code *models.ATMCode
+	err = c.DB.Transaction(func(tx *gorm.DB) error {
+		var err error
+		code, err = atm.Cancel(tx, accountId, codeId)
+		if err != nil {
+			return err
+		}
+		event := newAuditEvent(r, response.ID, "atm.code.cancel", "atm_code", code.ID.String())
+		event.SetChanges(
+			map[string]any{"status": models.ATMCodeStatusActive},
+			map[string]any{"status": code.Status},
+		)
+		return tx.Create(&event).Error
+	})
+	if errors.Is(err, atm.ErrCodeNotFound) {
+		detail := fmt.Sprintf("withdrawal code with id: %s not exist", codeId.String())
+		w.WriteHeader(http.StatusNotFound)
+		response.Data = dto.ErrorModel{Message: "withdrawal code not found", Details: []*string{&detail}}
+		json.NewEncoder(w).Encode(&response)
+		return
+	}
+	if errors.Is(err, atm.ErrCodeNotActive) {
+		detail := fmt.Sprintf("withdrawal code is %s", strings.ToLower(code.Status))
+		w.WriteHeader(http.StatusConflict)
+		response.Data = dto.ErrorModel{Message: "withdrawal code can not be cancelled", Details: []*string{&detail}}
+		json.NewEncoder(w).Encode(&response)
+		return
+	}
+	if err != nil {
+		detail := err.Error()
+		w.WriteHeader(http.StatusInternalServerError)
+		response.Data = dto.ErrorModel{Message: "failed to cancel withdrawal code", Details: []*string{&detail}}
+		json.NewEncoder(w).Encode(&response)
+		return
+	}
+
+	response.Data = newATMCodeResponse(code)
+	json.NewEncoder(w).Encode(&response)
+}
+
+// ATMRedeemHandler is called by the ATM network when a code and PIN are
+// entered at a terminal. The body must be signed with ATM_NETWORK_SECRET in
+// X-ATM-Signature. The ATM dispenses the amount of a successful answer.
+func (c *Controller) ATMRedeemHandler(w http.ResponseWriter, r *http.Request) {
+	var response dto.ResponseModel
+	response.ID = uuid.New()
+	response.Timestamp = time.Now().UTC()
+	w.Header().Add("Content-Type", "application/json")
+
+	secret, err := atm.NetworkSecret()
+	if err != nil {
+		detail := err.Error()
+		w.WriteHeader(http.StatusServiceUnavailable)
+		response.Data = dto.ErrorModel{Message: "atm network is not configured", Details: []*string{&detail}}
+		json.NewEncoder(w).Encode(&response)
+		return
+	}
+	body, err := io.ReadAll(io.LimitReader(r.Body, maxATMCallbackBody))
+	if err == nil {
+		err = atm.Verify(secret, r.Header.Get("X-ATM-Signature"), body, time.Now())
+	}
+	if err != nil {
+		detail := err.Error()
+		w.WriteHeader(http.StatusUnauthorized)
+		response.Data = dto.ErrorModel{Message: "unauthorized", Details: []*string{&detail}}
+		json.NewEncoder(w).Encode(&response)
+		return
+	}
+	var payload atm.Redemption
+	if err := json.Unmarshal(body, &payload); err != nil {
+		detail := err.Error()
+		w.WriteHeader(http.StatusBadRequest)
+		response.Data = dto.ErrorModel{Message: "invalid request body", Details: []*string{&detail}}
+		json.NewEncoder(w).Encode(&response)
+		return
+	}
+
+	audit := func(tx *gorm.DB, code *models.ATMCode, before string, result error) error {
+		event := newAuditEvent(r, response.ID, "atm.code.redeem", "atm_code", code.ID.String())
+		after := map[string]any{
+			"status": code.Status, "pinFailures": code.PinFailures,
+			"terminalId": payload.TerminalID, "reference": payload.Reference,
+		}
+		if result != nil {
+			event.Outcome = models.AuditOutcomeFailure
+			detail := result.Error()
+			event.Reason = &detail
+		} else {
+			after["transactionId"] = code.TransactionID
+		}
+		event.SetChanges(map[string]any{"status": before}, after)
+		return tx.Create(&event).Error
+	}
+	code, err := atm.Redeem(r.Context(), c.DB, payload, audit)
+
+	status, message := http.StatusOK, ""
+	switch {
+	case err == nil:
+	case errors.Is(err, atm.ErrRedemption):
+		status, message = http.StatusBadRequest, "invalid request body"
+	case errors.Is(err, atm.ErrCodeNotFound):
+		status, message = http.StatusNotFound, "withdrawal code not found"
+		event := newAuditEvent(r, response.ID, "atm.code.redeem", "atm_code", "")
+		event.Outcome = models.AuditOutcomeFailure
+		detail := err.Error()
+		event.Reason = &detail
+		c.recordAudit(event)
+	case errors.Is(err, atm.ErrPinInvalid), errors.Is(err, atm.ErrCodeBlocked):
+		status, message = http.StatusForbidden, "withdrawal refused"
+	case errors.Is(err, atm.ErrCodeExpired):
+		status, message = http.StatusGone, "withdrawal code expired"
+	case errors.Is(err, atm.ErrCodeNotActive), errors.Is(err, atm.ErrReferenceUsed):
+		status, message = http.StatusConflict, "withdrawal refused"
+	default:
+		status, message = http.StatusInternalServerError, "failed to redeem withdrawal code"
+	}
+	if err != nil {
+		detail := err.Error()
+		w.WriteHeader(status)
+		response.Data = dto.ErrorModel{Message: message, Details: []*string{&detail}}
+		json.NewEncoder(w).Encode(&response)
+		return
+	}
+
+	type RedeemResponseModel struct {
+		CodeId        uuid.UUID  `json:"codeId"`
+		Amount        int64      `json:"amount"`
+		TerminalId    *string    `json:"terminalId"`
+		Reference     *string    `json:"reference"`
+		TransactionId *uuid.UUID `json:"transactionId"`
+		RedeemedAt    *time.Time `json:"redeemedAt"`
+	}
+	response.Data = RedeemResponseModel{
+		CodeId:        code.ID,
+		Amount:        code.Amount,
+		TerminalId:    code.TerminalID,
+		Reference:     code.NetworkReference,
+		TransactionId: code.TransactionID,
+		RedeemedAt:    code.ClosedAt,
+	}
+	json.NewEncoder(w).Encode(&response)
+}
@@ -0,0 +1,161 @@
+package controller
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/eclipseron/digital-wallet-app/dto"
+	"github.com/eclipseron/digital-wallet-app/middleware"
+	"github.com/eclipseron/digital-wallet-app/models"
+	"github.com/eclipseron/digital-wallet-app/utils"
+	"github.com/google/uuid"
+)
+
+// newAuditEvent fills in the request metadata shared by every audit entry.
+// requestID must be the response.ID of the calling handler.
+func newAuditEvent(r *http.Request, requestID uuid.UUID, action, targetType, targetID string) models.AuditEvent {
+	ip := utils.ClientIP(r)
+	ua := r.UserAgent()
+	event := models.AuditEvent{
+		RequestID:  &requestID,
+		Action:     action,
+		Outcome:    models.AuditOutcomeSuccess,
+		TargetType: targetType,
+		UserAgent:  &ua,
+	}
+	if ip != "" {
+		event.IPAddress = &ip
+	}
+	_uid, _ := r.Context().Value(middleware.USERID).(string)
+	if actor, err := uuid.Parse(_uid); err == nil {
+		event.ActorID = &actor
+	}
+	if role, ok := r.Context().Value(middleware.ROLE).(string); ok {
+		event.ActorRole = &role
+	}
+	if targetID != "" {
+		event.TargetID = &targetID
+	}
+	return event
+}
+
+// recordAudit writes an event outside of any database transaction. It is used
+// for attempts that already failed, so a write error is only logged.
+func (c *Controller) recordAudit(event models.AuditEvent) {
+	if err := c.DB.Create(&event).Error; err != nil {
+		log.Println("failed to write audit entry:", err)
+	}
+}
+
+func (c *Controller) AdminListAuditEventsHandler(w http.ResponseWriter, r *http.Request) {
+	var response dto.ResponseModel
+	response.ID = uuid.New()
+	response.Timestamp = time.Now().UTC()
+	w.Header().Add("Content-Type", "application/json")
+
+	query := r.URL.Query()
+	reason := strings.TrimSpace(query.Get("reason"))
+	if reason == "" {
+		detail := "reason query parameter is required"
+		w.WriteHeader(http.StatusBadRequest)
+		response.Data = dto.ErrorModel{Message: "invalid request", Details: []*string{&detail}}
+		json.NewEncoder(w).Encode(&response)
+		return
+	}
+	limit, offset := parsePagination(r)
+
+	tx := c.DB.Model(&models.AuditEvent{})
+	for param, column := range map[string]string{
+		"actorId":    "actor_id",
+		"requestId":  "request_id",
+		"targetId":   "target_id",
+		"targetType": "target_type",
+		"outcome":    "outcome",
+	} {
+		if v := query.Get(param); v != "" {
+			tx = tx.Where(column+" = ?", v)
+		}
+	}
+	if v := query.Get("action"); v != "" {
+		// "admin." matches every admin action
+		tx = tx.Where("action LIKE ?", strings.ReplaceAll(v, "%", "")+"%")
+	}
+	for param, op := range map[string]string{"from": ">=", "to": "<"} {
+		v := query.Get(param)
+		if v == "" {
+			continue
+		}
+		at, err := time.Parse(time.RFC3339, v)
+		if err != nil {
+			detail := err.Error()
+			w.WriteHeader(http.StatusBadRequest)
+			response.Data = dto.ErrorModel{Message: "invalid " + param, Details: []*string{&detail}}
+			json.NewEncoder(w).Encode(&response)
+			return
+		}
+		tx = tx.Where("created_at "+op+" ?", at)
+	}
+
+	type AuditEvent struct {
+		ID         uuid.UUID        `json:"eventId"`
+		RequestID  *uuid.UUID       `json:"requestId"`
+		ActorID    *uuid.UUID       `json:"actorId"`
+		ActorRole  *string          `json:"actorRole"`
+		Action     string           `json:"action"`
+		Outcome    string           `json:"outcome"`
+		TargetType string           `json:"targetType"`
+		TargetID   *string          `json:"targetId"`
+		Reason     *string          `json:"reason"`
+		IPAddress  *string          `json:"ipAddress"`
+		UserAgent  *string          `json:"userAgent"`
+		Changes    *json.RawMessage `json:"changes"`
+		CreatedAt  time.Time        `json:"at"`
+	}
+
+	var rows []models.AuditEvent
+	if err := tx.Order("created_at DESC").Limit(limit).Offset(offset).Find(&rows).Error; err != nil {
+		detail := err.Error()
+		w.WriteHeader(http.StatusInternalServerError)
+		response.Data = dto.ErrorModel{Message: "an error occured", Details: []*string{&detail}}
+		json.NewEncoder(w).Encode(&response)
+		return
+	}
+
+	event := newAdminAudit(r, response.ID, "admin.audit.query", "audit_event", "", reason)
+	if err := c.DB.Create(&event).Error; err != nil {
+		detail := err.Error()
+		w.WriteHeader(http.StatusInternalServerError)
+		response.Data = dto.ErrorModel{Message: "failed to write audit entry", Details: []*string{&detail}}
+		json.NewEncoder(w).Encode(&response)
+		return
+	}
+
+	events := make([]AuditEvent, 0, len(rows))
+	for _, e := range rows {
+		var changes *json.RawMessage
+		if e.Changes != nil {
+			raw := json.RawMessage(*e.Changes)
+			changes = &raw
+		}
+		events = append(events, AuditEvent{
+			ID:         e.ID,
+			RequestID:  e.RequestID,
+			ActorID:    e.ActorID,
+			ActorRole:  e.ActorRole,
+			Action:     e.Action,
+			Outcome:    e.Outcome,
+			TargetType: e.TargetType,
+			TargetID:   e.TargetID,
+			Reason:     e.Reason,
+			IPAddress:  e.IPAddress,
+			UserAgent:  e.UserAgent,
+			Changes:    changes,
+			CreatedAt:  e.CreatedAt.UTC(),
+		})
+	}
+	response.Data = events
+	json.NewEncoder(w).Encode(&response)
+}
@@ -44,6 +44,12 @@ func (c *Controller) RegisterHandler(w http.ResponseWriter, r *http.Request) {
 	SELECT id FROM users WHERE email = ?
 	`, payload.Email).Scan(&_uid)
 	if tx.RowsAffected > 0 {
+		event := newAuditEvent(r, response.ID, "auth.register", "user", payload.Email)
+		event.Outcome = models.AuditOutcomeFailure
+		reason := "email already registered"
+		event.Reason = &reason
+		c.recordAudit(event)
+
 		w.WriteHeader(http.StatusConflict)
 		response.Data = dto.ErrorModel{Message: "email already registered"}
 		json.NewEncoder(w).Encode(&response)
@@ -69,6 +75,7 @@ func (c *Controller) RegisterHandler(w http.ResponseWriter, r *http.Request) {
 		Name:     payload.Name,
 		Email:    payload.Email,
 		Password: hash,
+		Role:     models.RoleCustomer,
 	}
 	if err := c.DB.Create(&user).Error; err != nil {
 		w.WriteHeader(http.StatusInternalServerError)
@@ -96,6 +103,10 @@ func (c *Controller) RegisterHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	event := newAuditEvent(r, response.ID, "auth.register", "user", user.ID.String())
+	event.ActorID = &user.ID
+	c.recordAudit(event)
+
 	response.Data = ResponseModel{
 		UserID:        user.ID,
 		AccountID:     account.ID,
@@ -133,9 +144,15 @@ func (c *Controller) LoginHandler(w http.ResponseWriter, r *http.Request) {
 
 	var user models.User
 	tx := c.DB.Raw(`
-	SELECT id, email, password FROM users WHERE email = ?
+	SELECT id, email, password, role FROM users WHERE email = ?
 	`, payload.Email).Scan(&user)
 	if tx.RowsAffected == 0 {
+		event := newAuditEvent(r, response.ID, "auth.login", "user", payload.Email)
+		event.Outcome = models.AuditOutcomeFailure
+		reason := "email not found"
+		event.Reason = &reason
+		c.recordAudit(event)
+
 		w.WriteHeader(http.StatusNotFound)
 		response.Data = dto.ErrorModel{Message: "email not found"}
 		json.NewEncoder(w).Encode(&response)
@@ -150,13 +167,19 @@ func (c *Controller) LoginHandler(w http.ResponseWriter, r *http.Request) {
 	}
 
 	if !utils.IsValid(user.Password, payload.Password) {
+		event := newAuditEvent(r, response.ID, "auth.login", "user", user.ID.String())
+		event.Outcome = models.AuditOutcomeFailure
+		reason := "invalid password"
+		event.Reason = &reason
+		c.recordAudit(event)
+
 		w.WriteHeader(http.StatusUnauthorized)
 		response.Data = dto.ErrorModel{Message: "invalid email or password"}
 		json.NewEncoder(w).Encode(&response)
 		return
 	}
 
-	token, err := utils.CreateJWT(user.ID)
+	token, err := utils.CreateJWT(user.ID, user.Role)
 	if err != nil {
 		detail := tx.Error.Error()
 		w.WriteHeader(http.StatusInternalServerError)
@@ -165,6 +188,11 @@ func (c *Controller) LoginHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	event := newAuditEvent(r, response.ID, "auth.login", "user", user.ID.String())
+	event.ActorID = &user.ID
+	event.ActorRole = &user.Role
+	c.recordAudit(event)
+
 	type LoginResponseModel struct {
 		UserID string `json:"user_id"`
 		Email  string `json:"email"`
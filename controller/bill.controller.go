@@ -0,0 +1,337 @@
+package controller
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/eclipseron/digital-wallet-app/biller"
+	"github.com/eclipseron/digital-wallet-app/dto"
+	"github.com/eclipseron/digital-wallet-app/ledger"
+	"github.com/eclipseron/digital-wallet-app/middleware"
+	"github.com/eclipseron/digital-wallet-app/models"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+type BillPaymentResponseModel struct {
+	PaymentId           uuid.UUID  `json:"paymentId"`
+	AccountId           uuid.UUID  `json:"accountId"`
+	ProductCode         string     `json:"productCode"`
+	CustomerId          string     `json:"customerId"`
+	CustomerName        *string    `json:"customerName"`
+	Amount              int64      `json:"amount"`
+	AdminFee            int64      `json:"adminFee"`
+	Total               int64      `json:"total"`
+	Status              string     `json:"status"`
+	BillerReference     *string    `json:"billerReference"`
+	Token               *string    `json:"token"`
+	FailureReason       *string    `json:"failureReason"`
+	TransactionId       *uuid.UUID `json:"transactionId"`
+	RefundTransactionId *uuid.UUID `json:"refundTransactionId"`
+	ExpiresAt           time.Time  `json:"expiresAt"`
+	PaidAt              *time.Time `json:"paidAt"`
+	CompletedAt         *time.Time `json:"completedAt"`
+	CreatedAt           time.Time  `json:"createdAt"`
+}
+
+func newBillPaymentResponse(p *models.BillPayment) BillPaymentResponseModel {
+	res := BillPaymentResponseModel{
+		PaymentId:           p.ID,
+		AccountId:           p.AccountID,
+		ProductCode:         p.ProductCode,
+		CustomerId:          p.CustomerID,
+		CustomerName:        p.CustomerName,
+		Amount:              p.Amount,
+		AdminFee:            p.AdminFee,
+		Total:               p.Total,
+		Status:              p.Status,
+		BillerReference:     p.BillerReference,
+		Token:               p.Token,
+		FailureReason:       p.FailureReason,
+		TransactionId:       p.TransactionID,
+		RefundTransactionId: p.RefundTransactionID,
+		ExpiresAt:           p.ExpiresAt.UTC(),
+		CreatedAt:           p.CreatedAt.UTC(),
+	}
+	if p.PaidAt != nil {
+		at := p.PaidAt.UTC()
+		res.PaidAt = &at
+	}
+	if p.CompletedAt != nil {
+		at := p.CompletedAt.UTC()
+		res.CompletedAt = &at
+	}
+	return res
+}
+
+// ListBillProductsHandler lists the product catalogue, optionally of one
+// ?category=.
+func (c *Controller) ListBillProductsHandler(w http.ResponseWriter, r *http.Request) {
+	var response dto.ResponseModel
+	response.ID = uuid.New()
+	response.Timestamp = time.Now().UTC()
+	w.Header().Add("Content-Type", "application/json")
+
+	category := strings.ToUpper(r.URL.Query().Get("category"))
+	data := make([]biller.Product, 0, len(biller.Catalogue))
+	for _, p := range biller.Catalogue {
+		if category == "" || p.Category == category {
+			data = append(data, p)
+		}
+	}
+	response.Data = data
+	json.NewEncoder(w).Encode(&response)
+}
+
+// BillInquiryHandler asks the biller for the amount due of a customer
+// number, or the price of a prepaid product. The quote can be paid until it
+// expires.
+func (c *Controller) BillInquiryHandler(w http.ResponseWriter, r *http.Request) {
+	var response dto.ResponseModel
+	response.ID = uuid.New()
+	response.Timestamp = time.Now().UTC()
+	w.Header().Add("Content-Type", "application/json")
+
+	accountId, ok := c.ownedAccount(w, r, &response)
+	if !ok {
+		return
+	}
+
+	type RequestModel struct {
+		ProductCode string `json:"productCode"`
+		CustomerId  string `json:"customerId"`
+	}
+	var payload RequestModel
+	if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+		detail := err.Error()
+		w.WriteHeader(http.StatusBadRequest)
+		response.Data = dto.ErrorModel{Message: "invalid request body", Details: []*string{&detail}}
+		json.NewEncoder(w).Encode(&response)
+		return
+	}
+
+	_uid, _ := r.Context().Value(middleware.USERID).(string)
+	userId, _ := uuid.Parse(_uid)
+	payment, err := biller.Inquire(r.Context(), c.DB, accountId, userId,
+		strings.ToUpper(payload.ProductCode), strings.TrimSpace(payload.CustomerId))
+	if errors.Is(err, biller.ErrUnknownProduct) || errors.Is(err, biller.ErrCustomerID) {
+		detail := err.Error()
+		w.WriteHeader(http.StatusBadRequest)
+		response.Data = dto.ErrorModel{Message: "invalid request body", Details: []*string{&detail}}
+		json.NewEncoder(w).Encode(&response)
+		return
+	}
+	if errors.Is(err, biller.ErrCustomerNotFound) {
+		detail := err.Error()
+		w.WriteHeader(http.StatusNotFound)
+		response.Data = dto.ErrorModel{Message: "customer not found", Details: []*string{&detail}}
+		json.NewEncoder(w).Encode(&response)
+		return
+	}
+	if err != nil {
+		detail := err.Error()
+		w.WriteHeader(http.StatusBadGateway)
+		response.Data = dto.ErrorModel{Message: "inquiry failed", Details: []*string{&detail}}
+		json.NewEncoder(w).Encode(&response)
+		return
+	}
+
+	w.WriteHeader(http.StatusCreated)
+	response.Data = newBillPaymentResponse(payment)
+	json.NewEncoder(w).Encode(&response)
+}
+
+// PayBillHandler pays an inquiry with the PIN. The total is debited at once
+// and the purchase completes in the background, the payment is SUCCESS or
+// REFUNDED once the biller answers.
+func (c *Controller) PayBillHandler(w http.ResponseWriter, r *http.Request) {
+	var response dto.ResponseModel
+	response.ID = uuid.New()
+	response.Timestamp = time.Now().UTC()
+	w.Header().Add("Content-Type", "application/json")
+
+	accountId, ok := c.ownedAccount(w, r, &response)
+	if !ok {
+		return
+	}
+	paymentId, err := uuid.Parse(r.PathValue("paymentId"))
+	if err != nil {
+		detail := err.Error()
+		w.WriteHeader(http.StatusBadRequest)
+		response.Data = dto.ErrorModel{Message: "invalid id", Details: []*string{&detail}}
+		json.NewEncoder(w).Encode(&response)
+		return
+	}
+
+	type RequestModel struct {
+		Pin string `json:"pin"`
+	}
+	var payload RequestModel
+	if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+		detail := err.Error()
+		w.WriteHeader(http.StatusBadRequest)
+		response.Data = dto.ErrorModel{Message: "invalid request body", Details: []*string{&detail}}
+		json.NewEncoder(w).Encode(&response)
+		return
+	}
+
+	_uid, _ := r.Context().Value(middleware.USERID).(string)
+	userId, _ := uuid.Parse(_uid)
+	if err := c.verifyPin(userId, payload.Pin); err != nil {
+		status := http.StatusForbidden
+		if !errors.Is(err, errPin) {
+			status = http.StatusInternalServerError
+		}
+		detail := err.Error()
+		w.WriteHeader(status)
+		response.Data = dto.ErrorModel{Message: "pin verification failed", Details: []*string{&detail}}
+		json.NewEncoder(w).Encode(&response)
+		return
+	}
+
+	var payment *models.BillPayment
+	err = c.DB.Transaction(func(tx *gorm.DB) error {
+		var err error
+		payment, _, err = biller.Pay(tx, accountId, paymentId)
+		if err != nil {
+			return err
+		}
+		event := newAuditEvent(r, response.ID, "bill.pay", "bill_payment", payment.ID.String())
+		event.SetChanges(
+			map[string]any{"status": models.BillPaymentStatusInquiry},
+			map[string]any{
+				"status": payment.Status, "productCode": payment.ProductCode, "customerId": payment.CustomerID,
+				"total": payment.Total, "transactionId": payment.TransactionID,
+			},
+		)
+		return tx.Create(&event).Error
+	})
+	if errors.Is(err, biller.ErrPaymentNotFound) {
+		detail := fmt.Sprintf("bill payment with id: %s not exist", paymentId.String())
+		w.WriteHeader(http.StatusNotFound)
+		response.Data = dto.ErrorModel{Message: "bill payment not found", Details: []*string{&detail}}
+		json.NewEncoder(w).Encode(&response)
+		return
+	}
+	if errors.Is(err, biller.ErrNotPayable) {
+		detail := fmt.Sprintf("bill payment is %s", strings.ToLower(payment.Status))
+		w.WriteHeader(http.StatusConflict)
+		response.Data = dto.ErrorModel{Message: "bill payment can not be paid", Details: []*string{&detail}}
+		json.NewEncoder(w).Encode(&response)
+		return
+	}
+	if errors.Is(err, biller.ErrInquiryExpired) {
+		detail := err.Error()
+		w.WriteHeader(http.StatusGone)
+		response.Data = dto.ErrorModel{Message: "bill payment can not be paid", Details: []*string{&detail}}
+		json.NewEncoder(w).Encode(&response)
+		return
+	}
+	if errors.Is(err, ledger.ErrInsufficientBalance) {
+		c.transferFailed(accountId, "BILL_PAYMENT", payment.Total, err.Error(), nil, nil)
+		w.WriteHeader(http.StatusBadRequest)
+		response.Data = dto.ErrorModel{Message: "insufficient balance"}
+		json.NewEncoder(w).Encode(&response)
+		return
+	}
+	if models.IsRestricted(err) {
+		detail := err.Error()
+		c.transferFailed(accountId, "BILL_PAYMENT", payment.Total, detail, nil, nil)
+		w.WriteHeader(http.StatusForbidden)
+		response.Data = dto.ErrorModel{Message: "account restricted", Details: []*string{&detail}}
+		json.NewEncoder(w).Encode(&response)
+		return
+	}
+	if err != nil {
+		detail := err.Error()
+		w.WriteHeader(http.StatusInternalServerError)
+		response.Data = dto.ErrorModel{Message: "failed to pay bill", Details: []*string{&detail}}
+		json.NewEncoder(w).Encode(&response)
+		return
+	}
+
+	w.WriteHeader(http.StatusAccepted)
+	response.Data = newBillPaymentResponse(payment)
+	json.NewEncoder(w).Encode(&response)
+}
+
+// ListBillPaymentsHandler lists the bill payments of an owned account, the
+// newest first, optionally of one ?status=.
+func (c *Controller) ListBillPaymentsHandler(w http.ResponseWriter, r *http.Request) {
+	var response dto.ResponseModel
+	response.ID = uuid.New()
+	response.Timestamp = time.Now().UTC()
+	w.Header().Add("Content-Type", "application/json")
+
+	accountId, ok := c.ownedAccount(w, r, &response)
+	if !ok {
+		return
+	}
+	limit, offset := parsePagination(r)
+
+	query := c.DB.Where("account_id = ?", accountId.String())
+	if status := strings.ToUpper(r.URL.Query().Get("status")); status != "" {
+		query = query.Where("status = ?", status)
+	}
+	var payments []models.BillPayment
+	if err := query.Order("created_at DESC").Limit(limit).Offset(offset).Find(&payments).Error; err != nil {
+		detail := err.Error()
+		w.WriteHeader(http.StatusInternalServerError)
+		response.Data = dto.ErrorModel{Message: "an error occured", Details: []*string{&detail}}
+		json.NewEncoder(w).Encode(&response)
+		return
+	}
+
+	data := make([]BillPaymentResponseModel, 0, len(payments))
+	for i := range payments {
+		data = append(data, newBillPaymentResponse(&payments[i]))
+	}
+	response.Data = data
+	json.NewEncoder(w).Encode(&response)
+}
+
+// GetBillPaymentHandler returns one bill payment, poll it for the outcome of
+// a paid purchase.
+func (c *Controller) GetBillPaymentHandler(w http.ResponseWriter, r *http.Request) {
+	var response dto.ResponseModel
+	response.ID = uuid.New()
+	response.Timestamp = time.Now().UTC()
+	w.Header().Add("Content-Type", "application/json")
+
+	accountId, ok := c.ownedAccount(w, r, &response)
+	if !ok {
+		return
+	}
+	paymentId, err := uuid.Parse(r.PathValue("paymentId"))
+	if err != nil {
+		detail := err.Error()
+		w.WriteHeader(http.StatusBadRequest)
+		response.Data = dto.ErrorModel{Message: "invalid id", Details: []*string{&detail}}
+		json.NewEncoder(w).Encode(&response)
+		return
+	}
+
+	var payment models.BillPayment
+	res := c.DB.Where("id = ? AND account_id = ?", paymentId.String(), accountId.String()).Limit(1).Find(&payment)
+	if res.Error != nil {
+		detail := res.Error.Error()
+		w.WriteHeader(http.StatusInternalServerError)
+		response.Data = dto.ErrorModel{Message: "an error occured", Details: []*string{&detail}}
+		json.NewEncoder(w).Encode(&response)
+		return
+	}
+	if res.RowsAffected == 0 {
+		detail := fmt.Sprintf("bill payment with id: %s not exist", paymentId.String())
+		w.WriteHeader(http.StatusNotFound)
+		response.Data = dto.ErrorModel{Message: "bill payment not found", Details: []*string{&detail}}
+		json.NewEncoder(w).Encode(&response)
+		return
+	}
+
+	response.Data = newBillPaymentResponse(&payment)
+	json.NewEncoder(w).Encode(&response)
+}
@@ -0,0 +1,384 @@
+package controller
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/eclipseron/digital-wallet-app/dto"
+	"github.com/eclipseron/digital-wallet-app/models"
+	"github.com/eclipseron/digital-wallet-app/statement"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+var errBudgetExists = errors.New("budget already exists")
+
+type BudgetResponseModel struct {
+	BudgetId   uuid.UUID `json:"budgetId"`
+	AccountId  uuid.UUID `json:"accountId"`
+	Category   *string   `json:"category"`
+	Amount     int64     `json:"amount"`
+	Thresholds []int     `json:"thresholds"`
+	Period     string    `json:"period"`
+	Spent      int64     `json:"spent"`
+	Remaining  int64     `json:"remaining"`
+	Percent    float64   `json:"percent"`
+	Exceeded   bool      `json:"exceeded"`
+	CreatedAt  time.Time `json:"createdAt"`
+}
+
+func newBudgetResponse(s *models.BudgetStatus) BudgetResponseModel {
+	res := BudgetResponseModel{
+		BudgetId:   s.ID,
+		AccountId:  s.AccountID,
+		Amount:     s.Amount,
+		Thresholds: s.ThresholdList(),
+		Period:     s.Period,
+		Spent:      s.Spent,
+		Remaining:  max(s.Amount-s.Spent, 0),
+		Percent:    math.Round(float64(s.Spent)*1000/float64(s.Amount)) / 10,
+		Exceeded:   s.Spent > s.Amount,
+		CreatedAt:  s.CreatedAt.UTC(),
+	}
+	if s.Category != "" {
+		category := s.Category
+		res.Category = &category
+	}
+	return res
+}
+
+// validThresholds checks alert thresholds are between 1% and 1000%, at most
+// five of them.
+func validThresholds(thresholds []int) error {
+	if len(thresholds) == 0 || len(thresholds) > 5 {
+		return errors.New("between 1 and 5 thresholds are required")
+	}
+	for _, t := range thresholds {
+		if t < 1 || t > 1000 {
+			return errors.New("thresholds are percentages between 1 and 1000")
+		}
+	}
+	return nil
+}
+
+// ListBudgetsHandler lists the budgets of an owned account with their
+// progress in ?month=YYYY-MM, the current month by default.
+func (c *Controller) ListBudgetsHandler(w http.ResponseWriter, r *http.Request) {
+	var response dto.ResponseModel
+	response.ID = uuid.New()
+	response.Timestamp = time.Now().UTC()
+	w.Header().Add("Content-Type", "application/json")
+
+	accountId, ok := c.ownedAccount(w, r, &response)
+	if !ok {
+		return
+	}
+	at := time.Now()
+	if month := r.URL.Query().Get("month"); month != "" {
+		start, _, err := statement.ParseMonth(month)
+		if err != nil {
+			detail := "month must be YYYY-MM"
+			w.WriteHeader(http.StatusBadRequest)
+			response.Data = dto.ErrorModel{Message: "invalid request", Details: []*string{&detail}}
+			json.NewEncoder(w).Encode(&response)
+			return
+		}
+		at = start
+	}
+
+	statuses, err := models.BudgetStatuses(c.DB, accountId, nil, at)
+	if err != nil {
+		detail := err.Error()
+		w.WriteHeader(http.StatusInternalServerError)
+		response.Data = dto.ErrorModel{Message: "an error occured", Details: []*string{&detail}}
+		json.NewEncoder(w).Encode(&response)
+		return
+	}
+	data := make([]BudgetResponseModel, len(statuses))
+	for i := range statuses {
+		data[i] = newBudgetResponse(&statuses[i])
+	}
+	response.Data = data
+	json.NewEncoder(w).Encode(&response)
+}
+
+// CreateBudgetHandler sets a monthly budget on one category of an owned
+// account, or on all of its spending when category is left out.
+func (c *Controller) CreateBudgetHandler(w http.ResponseWriter, r *http.Request) {
+	var response dto.ResponseModel
+	response.ID = uuid.New()
+	response.Timestamp = time.Now().UTC()
+	w.Header().Add("Content-Type", "application/json")
+
+	accountId, ok := c.ownedAccount(w, r, &response)
+	if !ok {
+		return
+	}
+
+	type Request struct {
+		Category   *string `json:"category"`
+		Amount     int64   `json:"amount"`
+		Thresholds []int   `json:"thresholds"`
+	}
+	var payload Request
+	if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+		detail := err.Error()
+		w.WriteHeader(http.StatusBadRequest)
+		response.Data = dto.ErrorModel{Message: "invalid request", Details: []*string{&detail}}
+		json.NewEncoder(w).Encode(&response)
+		return
+	}
+	category := ""
+	if payload.Category != nil {
+		category = strings.ToUpper(strings.TrimSpace(*payload.Category))
+	}
+	if payload.Thresholds == nil {
+		payload.Thresholds = models.DefaultBudgetThresholds
+	}
+	var err error
+	switch {
+	case payload.Amount <= 0:
+		err = errors.New("amount must be positive")
+	case category != "" && !models.IsCategory(category):
+		err = fmt.Errorf("category must be one of %s", strings.Join(models.Categories, ", "))
+	default:
+		err = validThresholds(payload.Thresholds)
+	}
+	if err != nil {
+		detail := err.Error()
+		w.WriteHeader(http.StatusBadRequest)
+		response.Data = dto.ErrorModel{Message: "invalid request", Details: []*string{&detail}}
+		json.NewEncoder(w).Encode(&response)
+		return
+	}
+
+	var owner uuid.UUID
+	c.DB.Raw(`SELECT user_id FROM accounts WHERE id = ?`, accountId.String()).Scan(&owner)
+	budget := models.Budget{
+		AccountID:  accountId,
+		UserID:     owner,
+		Category:   category,
+		Amount:     payload.Amount,
+		Thresholds: models.FormatThresholds(payload.Thresholds),
+	}
+	err = c.DB.Transaction(func(tx *gorm.DB) error {
+		res := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&budget)
+		if res.Error != nil {
+			return res.Error
+		}
+		if res.RowsAffected == 0 {
+			return errBudgetExists
+		}
+		event := newAuditEvent(r, response.ID, "budget.create", "budget", budget.ID.String())
+		event.SetChanges(nil, map[string]any{
+			"category": budget.Category, "amount": budget.Amount, "thresholds": budget.Thresholds,
+		})
+		return tx.Create(&event).Error
+	})
+	if errors.Is(err, errBudgetExists) {
+		detail := "the account already has a budget for this category, update it instead"
+		w.WriteHeader(http.StatusConflict)
+		response.Data = dto.ErrorModel{Message: "budget already exists", Details: []*string{&detail}}
+		json.NewEncoder(w).Encode(&response)
+		return
+	}
+	if err != nil {
+		detail := err.Error()
+		w.WriteHeader(http.StatusInternalServerError)
+		response.Data = dto.ErrorModel{Message: "failed to create budget", Details: []*string{&detail}}
+		json.NewEncoder(w).Encode(&response)
+		return
+	}
+
+	c.writeBudget(w, &response, accountId, budget.ID, http.StatusCreated)
+}
+
+// UpdateBudgetHandler changes the amount or the thresholds of a budget.
+func (c *Controller) UpdateBudgetHandler(w http.ResponseWriter, r *http.Request) {
+	var response dto.ResponseModel
+	response.ID = uuid.New()
+	response.Timestamp = time.Now().UTC()
+	w.Header().Add("Content-Type", "application/json")
+
+	accountId, ok := c.ownedAccount(w, r, &response)
+	if !ok {
+		return
+	}
+	budgetId, err := uuid.Parse(r.PathValue("budgetId"))
+	if err != nil {
+		detail := err.Error()
+		w.WriteHeader(http.StatusBadRequest)
+		response.Data = dto.ErrorModel{Message: "invalid id", Details: []*string{&detail}}
+		json.NewEncoder(w).Encode(&response)
+		return
+	}
+
+	type Request struct {
+		Amount     *int64 `json:"amount"`
+		Thresholds []int  `json:"thresholds"`
+	}
+	var payload Request
+	if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+		detail := err.Error()
+		w.WriteHeader(http.StatusBadRequest)
+		response.Data = dto.ErrorModel{Message: "invalid request", Details: []*string{&detail}}
+		json.NewEncoder(w).Encode(&response)
+		return
+	}
+	switch {
+	case payload.Amount == nil && payload.Thresholds == nil:
+		err = errors.New("amount or thresholds is required")
+	case payload.Amount != nil && *payload.Amount <= 0:
+		err = errors.New("amount must be positive")
+	case payload.Thresholds != nil:
+		err = validThresholds(payload.Thresholds)
+	}
+	if err != nil {
+		detail := err.Error()
+		w.WriteHeader(http.StatusBadRequest)
+		response.Data = dto.ErrorModel{Message: "invalid request", Details: []*string{&detail}}
+		json.NewEncoder(w).Encode(&response)
+		return
+	}
+
+	err = c.DB.Transaction(func(tx *gorm.DB) error {
+		var budget models.Budget
+		res := tx.Raw(`
+		SELECT * FROM budgets WHERE id = ? AND account_id = ? FOR UPDATE
+		`, budgetId.String(), accountId.String()).Scan(&budget)
+		if res.Error != nil {
+			return res.Error
+		}
+		if res.RowsAffected == 0 {
+			return gorm.ErrRecordNotFound
+		}
+		before := map[string]any{"amount": budget.Amount, "thresholds": budget.Thresholds}
+		if payload.Amount != nil {
+			budget.Amount = *payload.Amount
+		}
+		if payload.Thresholds != nil {
+			budget.Thresholds = models.FormatThresholds(payload.Thresholds)
+		}
+		if err := tx.Model(&budget).Select("amount", "thresholds", "updated_at").Updates(&budget).Error; err != nil {
+			return err
+		}
+		event := newAuditEvent(r, response.ID, "budget.update", "budget", budget.ID.String())
+		event.SetChanges(before, map[string]any{"amount": budget.Amount, "thresholds": budget.Thresholds})
+		return tx.Create(&event).Error
+	})
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		detail := fmt.Sprintf("budget with id: %s not exist", budgetId.String())
+		w.WriteHeader(http.StatusNotFound)
+		response.Data = dto.ErrorModel{Message: "budget not found", Details: []*string{&detail}}
+		json.NewEncoder(w).Encode(&response)
+		return
+	}
+	if err != nil {
+		detail := err.Error()
+		w.WriteHeader(http.StatusInternalServerError)
+		response.Data = dto.ErrorModel{Message: "failed to update budget", Details: []*string{&detail}}
+		json.NewEncoder(w).Encode(&response)
+		return
+	}
+
+	c.writeBudget(w, &response, accountId, budgetId, http.StatusOK)
+}
+
+// DeleteBudgetHandler removes a budget with its alert history.
+func (c *Controller) DeleteBudgetHandler(w http.ResponseWriter, r *http.Request) {
+	var response dto.ResponseModel
+	response.ID = uuid.New()
+	response.Timestamp = time.Now().UTC()
+	w.Header().Add("Content-Type", "application/json")
+
+	accountId, ok := c.ownedAccount(w, r, &response)
+	if !ok {
+		return
+	}
+	budgetId, err := uuid.Parse(r.PathValue("budgetId"))
+	if err != nil {
+		detail := err.Error()
+		w.WriteHeader(http.StatusBadRequest)
+		response.Data = dto.ErrorModel{Message: "invalid id", Details: []*string{&detail}}
+		json.NewEncoder(w).Encode(&response)
+		return
+	}
+
+	var budget models.Budget
+	err = c.DB.Transaction(func(tx *gorm.DB) error {
+		res := tx.Clauses(clause.Returning{}).
+			Where("id = ? AND account_id = ?", budgetId.String(), accountId.String()).
+			Delete(&budget)
+		if res.Error != nil {
+			return res.Error
+		}
+		if res.RowsAffected == 0 {
+			return gorm.ErrRecordNotFound
+		}
+		event := newAuditEvent(r, response.ID, "budget.delete", "budget", budgetId.String())
+		event.SetChanges(map[string]any{
+			"category": budget.Category, "amount": budget.Amount, "thresholds": budget.Thresholds,
+		}, nil)
+		return tx.Create(&event).Error
+	})
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		detail := fmt.Sprintf("budget with id: %s not exist", budgetId.String())
+		w.WriteHeader(http.StatusNotFound)
+		response.Data = dto.ErrorModel{Message: "budget not found", Details: []*string{&detail}}
+		json.NewEncoder(w).Encode(&response)
+		return
+	}
+	if err != nil {
+		detail := err.Error()
+		w.WriteHeader(http.StatusInternalServerError)
+		response.Data = dto.ErrorModel{Message: "failed to delete budget", Details: []*string{&detail}}
+		json.NewEncoder(w).Encode(&response)
+		return
+	}
+
+	type DeletedBudgetResponseModel struct {
+		BudgetId   uuid.UUID `json:"budgetId"`
+		AccountId  uuid.UUID `json:"accountId"`
+		Category   string    `json:"category"`
+		Amount     int64     `json:"amount"`
+		Thresholds []int     `json:"thresholds"`
+	}
+	response.Data = DeletedBudgetResponseModel{
+		BudgetId:   budget.ID,
+		AccountId:  budget.AccountID,
+		Category:   budget.Category,
+		Amount:     budget.Amount,
+		Thresholds: budget.ThresholdList(),
+	}
+	json.NewEncoder(w).Encode(&response)
+}
+
+// writeBudget answers with the current progress of one budget.
+func (c *Controller) writeBudget(w http.ResponseWriter, response *dto.ResponseModel, accountId, budgetId uuid.UUID, status int) {
+	statuses, err := models.BudgetStatuses(c.DB, accountId, nil, time.Now())
+	if err != nil {
+		detail := err.Error()
+		w.WriteHeader(http.StatusInternalServerError)
+		response.Data = dto.ErrorModel{Message: "an error occured", Details: []*string{&detail}}
+		json.NewEncoder(w).Encode(response)
+		return
+	}
+	for i := range statuses {
+		if statuses[i].ID == budgetId {
+			w.WriteHeader(status)
+			response.Data = newBudgetResponse(&statuses[i])
+			json.NewEncoder(w).Encode(response)
+			return
+		}
+	}
+	detail := fmt.Sprintf("budget with id: %s not exist", budgetId.String())
+	w.WriteHeader(http.StatusNotFound)
+	response.Data = dto.ErrorModel{Message: "budget not found", Details: []*string{&detail}}
+	json.NewEncoder(w).Encode(response)
+}
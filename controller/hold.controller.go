@@ -0,0 +1,461 @@
+package controller
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/eclipseron/digital-wallet-app/banks"
+	"github.com/eclipseron/digital-wallet-app/dto"
+	"github.com/eclipseron/digital-wallet-app/ledger"
+	"github.com/eclipseron/digital-wallet-app/middleware"
+	"github.com/eclipseron/digital-wallet-app/models"
+	"github.com/google/uuid"
+)
+
+const (
+	defaultHoldExpiry = 7 * 24 * time.Hour
+	maxHoldExpiry     = 30 * 24 * time.Hour
+)
+
+type HoldResponseModel struct {
+	HoldId         uuid.UUID  `json:"holdId"`
+	AccountId      uuid.UUID  `json:"accountId"`
+	Amount         int64      `json:"amount"`
+	CapturedAmount int64      `json:"capturedAmount"`
+	Status         string     `json:"status"`
+	Reference      *string    `json:"reference"`
+	Description    *string    `json:"description"`
+	Destination    *string    `json:"to"`
+	BankName       *string    `json:"bankName"`
+	TransactionId  *uuid.UUID `json:"transactionId"`
+	ExpiresAt      time.Time  `json:"expiresAt"`
+	ReleasedAt     *time.Time `json:"releasedAt"`
+	CreatedAt      time.Time  `json:"createdAt"`
+	FinalBalance   *int64     `json:"finalBalance,omitempty"`
+}
+
+func newHoldResponse(h *models.Hold) HoldResponseModel {
+	res := HoldResponseModel{
+		HoldId:         h.ID,
+		AccountId:      h.AccountID,
+		Amount:         h.Amount,
+		CapturedAmount: h.CapturedAmount,
+		Status:         h.Status,
+		Reference:      h.Reference,
+		Description:    h.Description,
+		Destination:    h.ExternalAccount,
+		BankName:       h.BankName,
+		TransactionId:  h.TransactionID,
+		ExpiresAt:      h.ExpiresAt.UTC(),
+		CreatedAt:      h.CreatedAt.UTC(),
+	}
+	if h.ReleasedAt != nil {
+		at := h.ReleasedAt.UTC()
+		res.ReleasedAt = &at
+	}
+	return res
+}
+
+// canManageAccount allows the account holder and finance staff.
+func canManageAccount(r *http.Request, owner uuid.UUID) bool {
+	_uid, _ := r.Context().Value(middleware.USERID).(string)
+	role, _ := r.Context().Value(middleware.ROLE).(string)
+	return _uid == owner.String() || role == models.RoleFinance || role == models.RoleAdmin
+}
+
+// canReleaseHold allows finance staff and the user who placed the hold, an
+// account holder can not release a hold staff placed on their account. A
+// hold for a bank transfer is only captured by staff, so the holder can not
+// send money out with it.
+func canReleaseHold(r *http.Request, placedBy *uuid.UUID, capture bool, external bool) bool {
+	_uid, _ := r.Context().Value(middleware.USERID).(string)
+	role, _ := r.Context().Value(middleware.ROLE).(string)
+	if role == models.RoleFinance || role == models.RoleAdmin {
+		return true
+	}
+	if capture && external {
+		return false
+	}
+	return placedBy != nil && _uid == placedBy.String()
+}
+
+func (c *Controller) PlaceHoldHandler(w http.ResponseWriter, r *http.Request) {
+	var response dto.ResponseModel
+	response.ID = uuid.New()
+	response.Timestamp = time.Now().UTC()
+	w.Header().Add("Content-Type", "application/json")
+
+	param := r.PathValue("accountId")
+	accountId, err := uuid.Parse(param)
+	if err != nil {
+		detail := err.Error()
+		w.WriteHeader(http.StatusBadRequest)
+		response.Data = dto.ErrorModel{Message: "invalid id", Details: []*string{&detail}}
+		json.NewEncoder(w).Encode(&response)
+		return
+	}
+
+	type RequestModel struct {
+		Amount      int64   `json:"amount"`
+		Reference   *string `json:"reference"`
+		Description *string `json:"description"`
+		Destination *string `json:"to"`
+		BankName    *string `json:"bankName"`
+		// ExpiresIn is in seconds, defaults to 7 days
+		ExpiresIn int64 `json:"expiresIn"`
+	}
+	var payload RequestModel
+	if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+		detail := err.Error()
+		w.WriteHeader(http.StatusBadRequest)
+		response.Data = dto.ErrorModel{Message: "invalid request body", Details: []*string{&detail}}
+		json.NewEncoder(w).Encode(&response)
+		return
+	}
+	if payload.Amount <= 0 {
+		detail := "hold amount must be positive"
+		w.WriteHeader(http.StatusBadRequest)
+		response.Data = dto.ErrorModel{Message: "invalid request body", Details: []*string{&detail}}
+		json.NewEncoder(w).Encode(&response)
+		return
+	}
+	if (payload.Destination == nil) != (payload.BankName == nil) {
+		detail := "to and bankName must be given together"
+		w.WriteHeader(http.StatusBadRequest)
+		response.Data = dto.ErrorModel{Message: "invalid request body", Details: []*string{&detail}}
+		json.NewEncoder(w).Encode(&response)
+		return
+	}
+	if payload.BankName != nil {
+		bank, err := banks.Find(*payload.BankName)
+		if err == nil {
+			err = bank.Check(*payload.Destination, payload.Amount)
+		}
+		if err != nil {
+			detail := err.Error()
+			w.WriteHeader(http.StatusBadRequest)
+			response.Data = dto.ErrorModel{Message: "invalid request body", Details: []*string{&detail}}
+			json.NewEncoder(w).Encode(&response)
+			return
+		}
+		payload.BankName = &bank.Code
+	}
+	expiry := defaultHoldExpiry
+	if payload.ExpiresIn > 0 {
+		expiry = time.Duration(payload.ExpiresIn) * time.Second
+	}
+	if expiry > maxHoldExpiry {
+		detail := "holds can not last longer than 30 days"
+		w.WriteHeader(http.StatusBadRequest)
+		response.Data = dto.ErrorModel{Message: "invalid request body", Details: []*string{&detail}}
+		json.NewEncoder(w).Encode(&response)
+		return
+	}
+
+	var owner uuid.UUID
+	tx := c.DB.Raw(`SELECT user_id FROM accounts WHERE id = ?`, accountId.String()).Scan(&owner)
+	if tx.RowsAffected == 0 {
+		detail := fmt.Sprintf("account with id: %s not exist", accountId.String())
+		w.WriteHeader(http.StatusNotFound)
+		response.Data = dto.ErrorModel{Message: "account not found", Details: []*string{&detail}}
+		json.NewEncoder(w).Encode(&response)
+		return
+	}
+	if tx.Error != nil {
+		detail := tx.Error.Error()
+		w.WriteHeader(http.StatusInternalServerError)
+		response.Data = dto.ErrorModel{Message: "an error occured", Details: []*string{&detail}}
+		json.NewEncoder(w).Encode(&response)
+		return
+	}
+	if !canManageAccount(r, owner) {
+		detail := "This account does not belong to the user"
+		w.WriteHeader(http.StatusForbidden)
+		response.Data = dto.ErrorModel{Message: "forbidden", Details: []*string{&detail}}
+		json.NewEncoder(w).Encode(&response)
+		return
+	}
+
+	_uid, _ := r.Context().Value(middleware.USERID).(string)
+	placedBy, _ := uuid.Parse(_uid)
+	hold := models.Hold{
+		AccountID:       accountId,
+		PlacedBy:        &placedBy,
+		Amount:          payload.Amount,
+		Reference:       payload.Reference,
+		Description:     payload.Description,
+		ExternalAccount: payload.Destination,
+		BankName:        payload.BankName,
+		ExpiresAt:       time.Now().Add(expiry),
+	}
+
+	tx = c.DB.Begin()
+	err = ledger.PlaceHold(tx, &hold)
+	if errors.Is(err, ledger.ErrInsufficientBalance) {
+		tx.Rollback()
+		w.WriteHeader(http.StatusBadRequest)
+		response.Data = dto.ErrorModel{Message: "insufficient balance"}
+		json.NewEncoder(w).Encode(&response)
+		return
+	}
+	if models.IsRestricted(err) {
+		tx.Rollback()
+		detail := err.Error()
+		w.WriteHeader(http.StatusForbidden)
+		response.Data = dto.ErrorModel{Message: "account restricted", Details: []*string{&detail}}
+		json.NewEncoder(w).Encode(&response)
+		return
+	}
+	if err != nil {
+		tx.Rollback()
+		detail := err.Error()
+		w.WriteHeader(http.StatusInternalServerError)
+		response.Data = dto.ErrorModel{Message: "failed to place hold", Details: []*string{&detail}}
+		json.NewEncoder(w).Encode(&response)
+		return
+	}
+
+	event := newAuditEvent(r, response.ID, "hold.place", "hold", hold.ID.String())
+	event.SetChanges(nil, map[string]any{"amount": hold.Amount, "status": hold.Status})
+	if err := tx.Create(&event).Error; err != nil {
+		tx.Rollback()
+		detail := err.Error()
+		w.WriteHeader(http.StatusInternalServerError)
+		response.Data = dto.ErrorModel{Message: "failed to write audit entry", Details: []*string{&detail}}
+		json.NewEncoder(w).Encode(&response)
+		return
+	}
+
+	if err := tx.Commit().Error; err != nil {
+		detail := err.Error()
+		w.WriteHeader(http.StatusInternalServerError)
+		response.Data = dto.ErrorModel{Message: "database error", Details: []*string{&detail}}
+		json.NewEncoder(w).Encode(&response)
+		return
+	}
+
+	response.Data = newHoldResponse(&hold)
+	json.NewEncoder(w).Encode(&response)
+}
+
+func (c *Controller) ListHoldsHandler(w http.ResponseWriter, r *http.Request) {
+	var response dto.ResponseModel
+	response.ID = uuid.New()
+	response.Timestamp = time.Now().UTC()
+	w.Header().Add("Content-Type", "application/json")
+
+	param := r.PathValue("accountId")
+	accountId, err := uuid.Parse(param)
+	if err != nil {
+		detail := err.Error()
+		w.WriteHeader(http.StatusBadRequest)
+		response.Data = dto.ErrorModel{Message: "invalid id", Details: []*string{&detail}}
+		json.NewEncoder(w).Encode(&response)
+		return
+	}
+
+	var owner uuid.UUID
+	tx := c.DB.Raw(`SELECT user_id FROM accounts WHERE id = ?`, accountId.String()).Scan(&owner)
+	if tx.RowsAffected == 0 {
+		detail := fmt.Sprintf("account with id: %s not exist", accountId.String())
+		w.WriteHeader(http.StatusNotFound)
+		response.Data = dto.ErrorModel{Message: "account not found", Details: []*string{&detail}}
+		json.NewEncoder(w).Encode(&response)
+		return
+	}
+	if tx.Error != nil {
+		detail := tx.Error.Error()
+		w.WriteHeader(http.StatusInternalServerError)
+		response.Data = dto.ErrorModel{Message: "an error occured", Details: []*string{&detail}}
+		json.NewEncoder(w).Encode(&response)
+		return
+	}
+	if !canManageAccount(r, owner) {
+		detail := "This account does not belong to the user"
+		w.WriteHeader(http.StatusForbidden)
+		response.Data = dto.ErrorModel{Message: "forbidden", Details: []*string{&detail}}
+		json.NewEncoder(w).Encode(&response)
+		return
+	}
+
+	limit, offset := parsePagination(r)
+	query := c.DB.Where("account_id = ?", accountId.String())
+	if status := r.URL.Query().Get("status"); status != "" {
+		query = query.Where("status = ?", status)
+	}
+
+	var holds []models.Hold
+	if err := query.Order("created_at DESC").Limit(limit).Offset(offset).Find(&holds).Error; err != nil {
+		detail := err.Error()
+		w.WriteHeader(http.StatusInternalServerError)
+		response.Data = dto.ErrorModel{Message: "an error occured", Details: []*string{&detail}}
+		json.NewEncoder(w).Encode(&response)
+		return
+	}
+
+	data := make([]HoldResponseModel, 0, len(holds))
+	for i := range holds {
+		data = append(data, newHoldResponse(&holds[i]))
+	}
+	response.Data = data
+	json.NewEncoder(w).Encode(&response)
+}
+
+func (c *Controller) CaptureHoldHandler(w http.ResponseWriter, r *http.Request) {
+	c.releaseHold(w, r, true)
+}
+
+func (c *Controller) VoidHoldHandler(w http.ResponseWriter, r *http.Request) {
+	c.releaseHold(w, r, false)
+}
+
+func (c *Controller) releaseHold(w http.ResponseWriter, r *http.Request, capture bool) {
+	var response dto.ResponseModel
+	response.ID = uuid.New()
+	response.Timestamp = time.Now().UTC()
+	w.Header().Add("Content-Type", "application/json")
+
+	param := r.PathValue("holdId")
+	holdId, err := uuid.Parse(param)
+	if err != nil {
+		detail := err.Error()
+		w.WriteHeader(http.StatusBadRequest)
+		response.Data = dto.ErrorModel{Message: "invalid id", Details: []*string{&detail}}
+		json.NewEncoder(w).Encode(&response)
+		return
+	}
+
+	type RequestModel struct {
+		// Amount is only used on capture, leaving it out captures the full hold
+		Amount int64 `json:"amount"`
+	}
+	var payload RequestModel
+	if r.ContentLength != 0 {
+		if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+			detail := err.Error()
+			w.WriteHeader(http.StatusBadRequest)
+			response.Data = dto.ErrorModel{Message: "invalid request body", Details: []*string{&detail}}
+			json.NewEncoder(w).Encode(&response)
+			return
+		}
+	}
+
+	var owner struct {
+		UserId          uuid.UUID
+		ExternalAccount *string
+		Owner           *string
+		PlacedBy        *uuid.UUID
+	}
+	tx := c.DB.Raw(`
+	SELECT a.user_id, h.external_account, h.owner, h.placed_by
+	FROM holds h JOIN accounts a ON a.id = h.account_id WHERE h.id = ?
+	`, holdId.String()).Scan(&owner)
+	if tx.RowsAffected == 0 {
+		detail := fmt.Sprintf("hold with id: %s not exist", holdId.String())
+		w.WriteHeader(http.StatusNotFound)
+		response.Data = dto.ErrorModel{Message: "hold not found", Details: []*string{&detail}}
+		json.NewEncoder(w).Encode(&response)
+		return
+	}
+	if tx.Error != nil {
+		detail := tx.Error.Error()
+		w.WriteHeader(http.StatusInternalServerError)
+		response.Data = dto.ErrorModel{Message: "an error occured", Details: []*string{&detail}}
+		json.NewEncoder(w).Encode(&response)
+		return
+	}
+	if !canManageAccount(r, owner.UserId) || !canReleaseHold(r, owner.PlacedBy, capture, owner.ExternalAccount != nil) {
+		detail := "This hold can not be released by the user"
+		w.WriteHeader(http.StatusForbidden)
+		response.Data = dto.ErrorModel{Message: "forbidden", Details: []*string{&detail}}
+		json.NewEncoder(w).Encode(&response)
+		return
+	}
+	// a hold placed by a subsystem is settled by that subsystem only
+	if owner.Owner != nil {
+		detail := fmt.Sprintf("hold is managed by %s", *owner.Owner)
+		w.WriteHeader(http.StatusConflict)
+		response.Data = dto.ErrorModel{Message: "hold can not be released here", Details: []*string{&detail}}
+		json.NewEncoder(w).Encode(&response)
+		return
+	}
+
+	var hold *models.Hold
+	var balance int64
+	action := "hold.void"
+	tx = c.DB.Begin()
+	if capture {
+		action = "hold.capture"
+		// holds placed for a bank transfer settle as one, others as a plain capture
+		entry := models.Transactions{Type: "CAPTURE"}
+		if owner.ExternalAccount != nil {
+			entry.Type = "TRANSFER_OUT"
+		}
+		hold, balance, err = ledger.CaptureHold(tx, holdId, payload.Amount, &entry)
+	} else {
+		hold, err = ledger.ReleaseHold(tx, holdId, models.HoldStatusVoided)
+	}
+	if errors.Is(err, ledger.ErrHoldNotActive) || errors.Is(err, ledger.ErrHoldExpired) {
+		tx.Rollback()
+		detail := fmt.Sprintf("hold status is %s", hold.Status)
+		w.WriteHeader(http.StatusConflict)
+		response.Data = dto.ErrorModel{Message: err.Error(), Details: []*string{&detail}}
+		json.NewEncoder(w).Encode(&response)
+		return
+	}
+	if models.IsRestricted(err) {
+		tx.Rollback()
+		detail := err.Error()
+		w.WriteHeader(http.StatusForbidden)
+		response.Data = dto.ErrorModel{Message: "account restricted", Details: []*string{&detail}}
+		json.NewEncoder(w).Encode(&response)
+		return
+	}
+	if errors.Is(err, ledger.ErrCaptureExceeded) || errors.Is(err, ledger.ErrHoldAmount) {
+		tx.Rollback()
+		w.WriteHeader(http.StatusBadRequest)
+		response.Data = dto.ErrorModel{Message: err.Error()}
+		json.NewEncoder(w).Encode(&response)
+		return
+	}
+	if err != nil {
+		tx.Rollback()
+		detail := err.Error()
+		w.WriteHeader(http.StatusInternalServerError)
+		response.Data = dto.ErrorModel{Message: "failed to release hold", Details: []*string{&detail}}
+		json.NewEncoder(w).Encode(&response)
+		return
+	}
+
+	event := newAuditEvent(r, response.ID, action, "hold", hold.ID.String())
+	event.SetChanges(
+		map[string]any{"status": models.HoldStatusActive},
+		map[string]any{"status": hold.Status, "capturedAmount": hold.CapturedAmount},
+	)
+	if err := tx.Create(&event).Error; err != nil {
+		tx.Rollback()
+		detail := err.Error()
+		w.WriteHeader(http.StatusInternalServerError)
+		response.Data = dto.ErrorModel{Message: "failed to write audit entry", Details: []*string{&detail}}
+		json.NewEncoder(w).Encode(&response)
+		return
+	}
+
+	if err := tx.Commit().Error; err != nil {
+		detail := err.Error()
+		w.WriteHeader(http.StatusInternalServerError)
+		response.Data = dto.ErrorModel{Message: "database error", Details: []*string{&detail}}
+		json.NewEncoder(w).Encode(&response)
+		return
+	}
+
+	data := newHoldResponse(hold)
+	if capture {
+		data.FinalBalance = &balance
+	}
+	response.Data = data
+	json.NewEncoder(w).Encode(&response)
+}
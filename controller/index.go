@@ -1,11 +1,16 @@
 package controller
 
-import "gorm.io/gorm"
+import (
+	"github.com/eclipseron/digital-wallet-app/stream"
+	"gorm.io/gorm"
+)
 
 type Controller struct {
 	DB *gorm.DB
+	// Events feeds the account event streams, they answer 503 while it is nil
+	Events *stream.Hub
 }
 
 func NewController(db *gorm.DB) *Controller {
-	return &Controller{db}
+	return &Controller{DB: db}
 }
@@ -0,0 +1,245 @@
+package controller
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/eclipseron/digital-wallet-app/dto"
+	"github.com/eclipseron/digital-wallet-app/interest"
+	"github.com/eclipseron/digital-wallet-app/middleware"
+	"github.com/eclipseron/digital-wallet-app/models"
+	"github.com/eclipseron/digital-wallet-app/settlement"
+	"github.com/eclipseron/digital-wallet-app/statement"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+type InterestScheduleResponseModel struct {
+	Scope         string          `json:"scope"`
+	EffectiveFrom string          `json:"effectiveFrom"`
+	Tiers         []interest.Tier `json:"tiers"`
+}
+
+type InterestReportResponseModel struct {
+	Period   string          `json:"period"`
+	TimeZone string          `json:"timeZone"`
+	Rows     []interest.Row  `json:"rows"`
+	Total    interest.Totals `json:"total"`
+}
+
+// AdminListInterestRatesHandler lists every interest schedule, the latest
+// first, optionally of one ?scope=.
+func (c *Controller) AdminListInterestRatesHandler(w http.ResponseWriter, r *http.Request) {
+	var response dto.ResponseModel
+	response.ID = uuid.New()
+	response.Timestamp = time.Now().UTC()
+	w.Header().Add("Content-Type", "application/json")
+
+	query := c.DB.Model(&models.InterestRate{})
+	if scope := strings.ToUpper(r.URL.Query().Get("scope")); scope != "" {
+		if !interest.IsScope(scope) {
+			detail := fmt.Sprintf("scope must be %s or %s", models.InterestScopeAccount, models.InterestScopePocket)
+			w.WriteHeader(http.StatusBadRequest)
+			response.Data = dto.ErrorModel{Message: "invalid request", Details: []*string{&detail}}
+			json.NewEncoder(w).Encode(&response)
+			return
+		}
+		query = query.Where("scope = ?", scope)
+	}
+	var rates []models.InterestRate
+	if err := query.Order("effective_from DESC, scope, min_balance").Find(&rates).Error; err != nil {
+		detail := err.Error()
+		w.WriteHeader(http.StatusInternalServerError)
+		response.Data = dto.ErrorModel{Message: "an error occured", Details: []*string{&detail}}
+		json.NewEncoder(w).Encode(&response)
+		return
+	}
+
+	schedules := []InterestScheduleResponseModel{}
+	for _, rate := range rates {
+		from := rate.EffectiveFrom.Format(time.DateOnly)
+		last := len(schedules) - 1
+		if last < 0 || schedules[last].Scope != rate.Scope || schedules[last].EffectiveFrom != from {
+			schedules = append(schedules, InterestScheduleResponseModel{Scope: rate.Scope, EffectiveFrom: from})
+			last++
+		}
+		schedules[last].Tiers = append(schedules[last].Tiers, interest.Tier{MinBalance: rate.MinBalance, RateBps: rate.RateBps})
+	}
+	response.Data = schedules
+	json.NewEncoder(w).Encode(&response)
+}
+
+// AdminSetInterestRatesHandler publishes the schedule of a scope from a
+// future day on, replacing one published for the same day. Days that may
+// have accrued already cannot be repriced.
+func (c *Controller) AdminSetInterestRatesHandler(w http.ResponseWriter, r *http.Request) {
+	var response dto.ResponseModel
+	response.ID = uuid.New()
+	response.Timestamp = time.Now().UTC()
+	w.Header().Add("Content-Type", "application/json")
+
+	type RequestModel struct {
+		Scope         string          `json:"scope"`
+		EffectiveFrom string          `json:"effectiveFrom"`
+		Tiers         []interest.Tier `json:"tiers"`
+		Reason        string          `json:"reason"`
+	}
+	var payload RequestModel
+	if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+		detail := err.Error()
+		w.WriteHeader(http.StatusBadRequest)
+		response.Data = dto.ErrorModel{Message: "invalid request body", Details: []*string{&detail}}
+		json.NewEncoder(w).Encode(&response)
+		return
+	}
+	payload.Scope = strings.ToUpper(payload.Scope)
+	from, err := settlement.ParseDate(payload.EffectiveFrom)
+	if err == nil && !from.After(settlement.Day(time.Now(), 0)) {
+		err = errors.New("effectiveFrom must be after today")
+	}
+	if err == nil && !interest.IsScope(payload.Scope) {
+		err = fmt.Errorf("scope must be %s or %s", models.InterestScopeAccount, models.InterestScopePocket)
+	}
+	if err == nil {
+		err = interest.Validate(payload.Tiers)
+	}
+	if err == nil && strings.TrimSpace(payload.Reason) == "" {
+		err = errors.New("reason is required")
+	}
+	if err != nil {
+		detail := err.Error()
+		w.WriteHeader(http.StatusBadRequest)
+		response.Data = dto.ErrorModel{Message: "invalid request body", Details: []*string{&detail}}
+		json.NewEncoder(w).Encode(&response)
+		return
+	}
+
+	var actor *uuid.UUID
+	_uid, _ := r.Context().Value(middleware.USERID).(string)
+	if id, err := uuid.Parse(_uid); err == nil {
+		actor = &id
+	}
+	effectiveFrom := payload.EffectiveFrom
+	err = c.DB.Transaction(func(tx *gorm.DB) error {
+		var before []interest.Tier
+		err := tx.Model(&models.InterestRate{}).
+			Where("scope = ? AND effective_from = ?", payload.Scope, effectiveFrom).
+			Order("min_balance").Find(&before).Error
+		if err != nil {
+			return err
+		}
+		err = tx.Where("scope = ? AND effective_from = ?", payload.Scope, effectiveFrom).
+			Delete(&models.InterestRate{}).Error
+		if err != nil {
+			return err
+		}
+		for _, t := range payload.Tiers {
+			err := tx.Exec(`
+			INSERT INTO interest_rates (scope, effective_from, min_balance, rate_bps, created_by, created_at)
+			VALUES (?, ?, ?, ?, ?, NOW())
+			`, payload.Scope, effectiveFrom, t.MinBalance, t.RateBps, actor).Error
+			if err != nil {
+				return err
+			}
+		}
+
+		event := newAdminAudit(r, response.ID, "admin.interest.rates", "interest_rate",
+			payload.Scope+"/"+effectiveFrom, payload.Reason)
+		event.SetChanges(before, payload.Tiers)
+		return tx.Create(&event).Error
+	})
+	if err != nil {
+		detail := err.Error()
+		w.WriteHeader(http.StatusInternalServerError)
+		response.Data = dto.ErrorModel{Message: "failed to save interest rates", Details: []*string{&detail}}
+		json.NewEncoder(w).Encode(&response)
+		return
+	}
+
+	w.WriteHeader(http.StatusCreated)
+	response.Data = InterestScheduleResponseModel{
+		Scope:         payload.Scope,
+		EffectiveFrom: effectiveFrom,
+		Tiers:         payload.Tiers,
+	}
+	json.NewEncoder(w).Encode(&response)
+}
+
+// AdminInterestReportHandler is the interest accrual report of ?month=
+// (YYYY-MM, the current month by default) for finance to reconcile, as JSON
+// or as a CSV download with ?format=csv.
+func (c *Controller) AdminInterestReportHandler(w http.ResponseWriter, r *http.Request) {
+	var response dto.ResponseModel
+	response.ID = uuid.New()
+	response.Timestamp = time.Now().UTC()
+	w.Header().Add("Content-Type", "application/json")
+
+	query := r.URL.Query()
+	reason := strings.TrimSpace(query.Get("reason"))
+	if reason == "" {
+		detail := "reason query parameter is required"
+		w.WriteHeader(http.StatusBadRequest)
+		response.Data = dto.ErrorModel{Message: "invalid request", Details: []*string{&detail}}
+		json.NewEncoder(w).Encode(&response)
+		return
+	}
+	period, start, _ := statement.Month(time.Now())
+	if s := query.Get("month"); s != "" {
+		var err error
+		if start, _, err = statement.ParseMonth(s); err != nil {
+			detail := "month must be YYYY-MM"
+			w.WriteHeader(http.StatusBadRequest)
+			response.Data = dto.ErrorModel{Message: "invalid request", Details: []*string{&detail}}
+			json.NewEncoder(w).Encode(&response)
+			return
+		}
+		period = start.Format("2006-01")
+	}
+	format := strings.ToLower(query.Get("format"))
+	if format != "" && format != "json" && format != "csv" {
+		detail := "format must be json or csv"
+		w.WriteHeader(http.StatusBadRequest)
+		response.Data = dto.ErrorModel{Message: "invalid request", Details: []*string{&detail}}
+		json.NewEncoder(w).Encode(&response)
+		return
+	}
+
+	rows, total, err := interest.Report(c.DB, start)
+	if err != nil {
+		detail := err.Error()
+		w.WriteHeader(http.StatusInternalServerError)
+		response.Data = dto.ErrorModel{Message: "failed to build interest report", Details: []*string{&detail}}
+		json.NewEncoder(w).Encode(&response)
+		return
+	}
+	event := newAdminAudit(r, response.ID, "admin.interest.report", "interest_report", period, reason)
+	if err := c.DB.Create(&event).Error; err != nil {
+		detail := err.Error()
+		w.WriteHeader(http.StatusInternalServerError)
+		response.Data = dto.ErrorModel{Message: "failed to write audit entry", Details: []*string{&detail}}
+		json.NewEncoder(w).Encode(&response)
+		return
+	}
+
+	if format == "csv" {
+		w.Header().Set("Content-Type", "text/csv")
+		w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", "interest_"+period+".csv"))
+		interest.WriteCSV(w, rows)
+		return
+	}
+
+	if rows == nil {
+		rows = []interest.Row{}
+	}
+	response.Data = InterestReportResponseModel{
+		Period:   period,
+		TimeZone: settlement.Location.String(),
+		Rows:     rows,
+		Total:    total,
+	}
+	json.NewEncoder(w).Encode(&response)
+}
@@ -0,0 +1,182 @@
+package controller
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/eclipseron/digital-wallet-app/dto"
+	"github.com/eclipseron/digital-wallet-app/jobs"
+	"github.com/eclipseron/digital-wallet-app/models"
+	"github.com/google/uuid"
+)
+
+type JobResponseModel struct {
+	JobId       uuid.UUID       `json:"jobId"`
+	Type        string          `json:"type"`
+	Payload     json.RawMessage `json:"payload"`
+	Status      string          `json:"status"`
+	UniqueKey   *string         `json:"uniqueKey"`
+	Attempts    int             `json:"attempts"`
+	MaxAttempts int             `json:"maxAttempts"`
+	RunAt       time.Time       `json:"runAt"`
+	LastError   *string         `json:"lastError"`
+	FinishedAt  *time.Time      `json:"finishedAt"`
+	CreatedAt   time.Time       `json:"createdAt"`
+}
+
+func newJobResponse(j *models.Job) JobResponseModel {
+	return JobResponseModel{
+		JobId:       j.ID,
+		Type:        j.Type,
+		Payload:     json.RawMessage(j.Payload),
+		Status:      j.Status,
+		UniqueKey:   j.UniqueKey,
+		Attempts:    j.Attempts,
+		MaxAttempts: j.MaxAttempts,
+		RunAt:       j.RunAt.UTC(),
+		LastError:   j.LastError,
+		FinishedAt:  j.FinishedAt,
+		CreatedAt:   j.CreatedAt.UTC(),
+	}
+}
+
+// AdminListJobsHandler lists dead jobs unless another status is asked for.
+func (c *Controller) AdminListJobsHandler(w http.ResponseWriter, r *http.Request) {
+	var response dto.ResponseModel
+	response.ID = uuid.New()
+	response.Timestamp = time.Now().UTC()
+	w.Header().Add("Content-Type", "application/json")
+
+	query := r.URL.Query()
+	reason := strings.TrimSpace(query.Get("reason"))
+	if reason == "" {
+		detail := "reason query parameter is required"
+		w.WriteHeader(http.StatusBadRequest)
+		response.Data = dto.ErrorModel{Message: "invalid request", Details: []*string{&detail}}
+		json.NewEncoder(w).Encode(&response)
+		return
+	}
+
+	status := models.JobStatusDead
+	if v := query.Get("status"); v != "" {
+		status = strings.ToUpper(v)
+	}
+	limit, offset := parsePagination(r)
+	db := c.DB.Where("status = ?", status)
+	if jobType := query.Get("type"); jobType != "" {
+		db = db.Where("type = ?", jobType)
+	}
+
+	var found []models.Job
+	if err := db.Order("updated_at DESC").Limit(limit).Offset(offset).Find(&found).Error; err != nil {
+		detail := err.Error()
+		w.WriteHeader(http.StatusInternalServerError)
+		response.Data = dto.ErrorModel{Message: "an error occured", Details: []*string{&detail}}
+		json.NewEncoder(w).Encode(&response)
+		return
+	}
+
+	event := newAdminAudit(r, response.ID, "admin.job.list", "job", "", reason)
+	if err := c.DB.Create(&event).Error; err != nil {
+		detail := err.Error()
+		w.WriteHeader(http.StatusInternalServerError)
+		response.Data = dto.ErrorModel{Message: "failed to write audit entry", Details: []*string{&detail}}
+		json.NewEncoder(w).Encode(&response)
+		return
+	}
+
+	data := make([]JobResponseModel, 0, len(found))
+	for i := range found {
+		data = append(data, newJobResponse(&found[i]))
+	}
+	response.Data = data
+	json.NewEncoder(w).Encode(&response)
+}
+
+func (c *Controller) AdminRetryJobHandler(w http.ResponseWriter, r *http.Request) {
+	var response dto.ResponseModel
+	response.ID = uuid.New()
+	response.Timestamp = time.Now().UTC()
+	w.Header().Add("Content-Type", "application/json")
+
+	param := r.PathValue("jobId")
+	jobId, err := uuid.Parse(param)
+	if err != nil {
+		detail := err.Error()
+		w.WriteHeader(http.StatusBadRequest)
+		response.Data = dto.ErrorModel{Message: "invalid id", Details: []*string{&detail}}
+		json.NewEncoder(w).Encode(&response)
+		return
+	}
+
+	type RequestModel struct {
+		Reason string `json:"reason"`
+	}
+	var payload RequestModel
+	if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+		detail := err.Error()
+		w.WriteHeader(http.StatusBadRequest)
+		response.Data = dto.ErrorModel{Message: "invalid request body", Details: []*string{&detail}}
+		json.NewEncoder(w).Encode(&response)
+		return
+	}
+	if strings.TrimSpace(payload.Reason) == "" {
+		detail := "reason is required"
+		w.WriteHeader(http.StatusBadRequest)
+		response.Data = dto.ErrorModel{Message: "invalid request body", Details: []*string{&detail}}
+		json.NewEncoder(w).Encode(&response)
+		return
+	}
+
+	tx := c.DB.Begin()
+	job, err := jobs.Retry(tx, jobId)
+	if errors.Is(err, jobs.ErrJobNotFound) {
+		tx.Rollback()
+		detail := fmt.Sprintf("job with id: %s not exist", jobId.String())
+		w.WriteHeader(http.StatusNotFound)
+		response.Data = dto.ErrorModel{Message: "job not found", Details: []*string{&detail}}
+		json.NewEncoder(w).Encode(&response)
+		return
+	}
+	if errors.Is(err, jobs.ErrJobNotDead) || errors.Is(err, jobs.ErrDuplicateJob) {
+		tx.Rollback()
+		w.WriteHeader(http.StatusConflict)
+		response.Data = dto.ErrorModel{Message: err.Error()}
+		json.NewEncoder(w).Encode(&response)
+		return
+	}
+	if err != nil {
+		tx.Rollback()
+		detail := err.Error()
+		w.WriteHeader(http.StatusInternalServerError)
+		response.Data = dto.ErrorModel{Message: "failed to retry job", Details: []*string{&detail}}
+		json.NewEncoder(w).Encode(&response)
+		return
+	}
+
+	event := newAdminAudit(r, response.ID, "admin.job.retry", "job", jobId.String(), payload.Reason)
+	event.SetChanges(map[string]any{"status": models.JobStatusDead}, map[string]any{"status": job.Status})
+	if err := tx.Create(&event).Error; err != nil {
+		tx.Rollback()
+		detail := err.Error()
+		w.WriteHeader(http.StatusInternalServerError)
+		response.Data = dto.ErrorModel{Message: "failed to write audit entry", Details: []*string{&detail}}
+		json.NewEncoder(w).Encode(&response)
+		return
+	}
+
+	if err := tx.Commit().Error; err != nil {
+		detail := err.Error()
+		w.WriteHeader(http.StatusInternalServerError)
+		response.Data = dto.ErrorModel{Message: "database error", Details: []*string{&detail}}
+		json.NewEncoder(w).Encode(&response)
+		return
+	}
+
+	response.Data = newJobResponse(job)
+	json.NewEncoder(w).Encode(&response)
+}
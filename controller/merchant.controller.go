@@ -0,0 +1,510 @@
+package controller
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/eclipseron/digital-wallet-app/dto"
+	"github.com/eclipseron/digital-wallet-app/middleware"
+	"github.com/eclipseron/digital-wallet-app/models"
+	"github.com/eclipseron/digital-wallet-app/webhooks"
+	"github.com/google/uuid"
+)
+
+type MerchantResponseModel struct {
+	MerchantId        uuid.UUID  `json:"merchantId"`
+	AccountId         uuid.UUID  `json:"accountId"`
+	Name              string     `json:"name"`
+	Status            string     `json:"status"`
+	WebhookEndpointId *uuid.UUID `json:"webhookEndpointId"`
+	// WebhookSecret is only returned when the merchant is created
+	WebhookSecret string    `json:"webhookSecret,omitempty"`
+	CreatedAt     time.Time `json:"createdAt"`
+}
+
+func newMerchantResponse(m *models.Merchant) MerchantResponseModel {
+	return MerchantResponseModel{
+		MerchantId:        m.ID,
+		AccountId:         m.AccountID,
+		Name:              m.Name,
+		Status:            m.Status,
+		WebhookEndpointId: m.WebhookEndpointID,
+		CreatedAt:         m.CreatedAt.UTC(),
+	}
+}
+
+type MerchantAPIKeyResponseModel struct {
+	KeyId      uuid.UUID  `json:"keyId"`
+	Prefix     string     `json:"prefix"`
+	Label      *string    `json:"label"`
+	LastUsedAt *time.Time `json:"lastUsedAt"`
+	RevokedAt  *time.Time `json:"revokedAt"`
+	// Key is only returned when it is created
+	Key       string    `json:"key,omitempty"`
+	CreatedAt time.Time `json:"createdAt"`
+}
+
+func newMerchantAPIKeyResponse(k *models.MerchantAPIKey) MerchantAPIKeyResponseModel {
+	return MerchantAPIKeyResponseModel{
+		KeyId:      k.ID,
+		Prefix:     k.Prefix,
+		Label:      k.Label,
+		LastUsedAt: k.LastUsedAt,
+		RevokedAt:  k.RevokedAt,
+		CreatedAt:  k.CreatedAt.UTC(),
+	}
+}
+
+// newMerchantKey returns a key of the form mk_<prefix>_<secret>, its prefix
+// and the SHA-256 of the whole key, which is all that gets stored.
+func newMerchantKey() (key, prefix, hash string, err error) {
+	b := make([]byte, 36)
+	if _, err = rand.Read(b); err != nil {
+		return "", "", "", err
+	}
+	prefix = hex.EncodeToString(b[:4])
+	key = "mk_" + prefix + "_" + hex.EncodeToString(b[4:])
+	return key, prefix, hashMerchantKey(key), nil
+}
+
+func hashMerchantKey(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:])
+}
+
+// RequireMerchantKey authenticates server-to-server calls with the
+// X-API-Key header and puts the merchant id in the context.
+func (c *Controller) RequireMerchantKey(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var response dto.ResponseModel
+		response.ID = uuid.New()
+		response.Timestamp = time.Now().UTC()
+		w.Header().Add("Content-Type", "application/json")
+
+		key := r.Header.Get("X-API-Key")
+		parts := strings.Split(key, "_")
+		if len(parts) != 3 || parts[0] != "mk" {
+			w.WriteHeader(http.StatusUnauthorized)
+			response.Data = dto.ErrorModel{Message: "missing or malformed api key"}
+			json.NewEncoder(w).Encode(&response)
+			return
+		}
+
+		var found struct {
+			ID         uuid.UUID
+			MerchantID uuid.UUID
+			KeyHash    string
+			Status     string
+		}
+		tx := c.DB.Raw(`
+		SELECT k.id, k.merchant_id, k.key_hash, m.status
+		FROM merchant_api_keys k JOIN merchants m ON m.id = k.merchant_id
+		WHERE k.prefix = ? AND k.revoked_at IS NULL
+		`, parts[1]).Scan(&found)
+		if tx.Error != nil {
+			detail := tx.Error.Error()
+			w.WriteHeader(http.StatusInternalServerError)
+			response.Data = dto.ErrorModel{Message: "an error occured", Details: []*string{&detail}}
+			json.NewEncoder(w).Encode(&response)
+			return
+		}
+		if tx.RowsAffected == 0 || subtle.ConstantTimeCompare([]byte(found.KeyHash), []byte(hashMerchantKey(key))) != 1 {
+			w.WriteHeader(http.StatusUnauthorized)
+			response.Data = dto.ErrorModel{Message: "invalid api key"}
+			json.NewEncoder(w).Encode(&response)
+			return
+		}
+		if found.Status != models.MerchantStatusActive {
+			detail := fmt.Sprintf("merchant is %s", strings.ToLower(found.Status))
+			w.WriteHeader(http.StatusForbidden)
+			response.Data = dto.ErrorModel{Message: "forbidden", Details: []*string{&detail}}
+			json.NewEncoder(w).Encode(&response)
+			return
+		}
+
+		c.DB.Exec(`UPDATE merchant_api_keys SET last_used_at = now() WHERE id = ?`, found.ID.String())
+
+		ctx := context.WithValue(r.Context(), middleware.MERCHANTID, found.MerchantID.String())
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+func (c *Controller) CreateMerchantHandler(w http.ResponseWriter, r *http.Request) {
+	var response dto.ResponseModel
+	response.ID = uuid.New()
+	response.Timestamp = time.Now().UTC()
+	w.Header().Add("Content-Type", "application/json")
+
+	_uid, _ := r.Context().Value(middleware.USERID).(string)
+	userId, err := uuid.Parse(_uid)
+	if err != nil {
+		detail := err.Error()
+		w.WriteHeader(http.StatusUnauthorized)
+		response.Data = dto.ErrorModel{Message: "invalid token payload", Details: []*string{&detail}}
+		json.NewEncoder(w).Encode(&response)
+		return
+	}
+
+	type RequestModel struct {
+		Name      string    `json:"name"`
+		AccountId uuid.UUID `json:"accountId"`
+		// WebhookURL receives payment.succeeded and payment.refunded for the
+		// settlement account
+		WebhookURL *string `json:"webhookUrl"`
+	}
+	var payload RequestModel
+	if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+		detail := err.Error()
+		w.WriteHeader(http.StatusBadRequest)
+		response.Data = dto.ErrorModel{Message: "invalid request body", Details: []*string{&detail}}
+		json.NewEncoder(w).Encode(&response)
+		return
+	}
+	payload.Name = strings.TrimSpace(payload.Name)
+	if payload.Name == "" || len(payload.Name) > 100 {
+		detail := "name is required and at most 100 characters"
+		w.WriteHeader(http.StatusBadRequest)
+		response.Data = dto.ErrorModel{Message: "invalid request body", Details: []*string{&detail}}
+		json.NewEncoder(w).Encode(&response)
+		return
+	}
+	var target *url.URL
+	if payload.WebhookURL != nil {
+		target, err = url.Parse(*payload.WebhookURL)
+		if err != nil || (target.Scheme != "https" && target.Scheme != "http") || target.Host == "" {
+			detail := "webhookUrl must be an absolute http or https URL"
+			w.WriteHeader(http.StatusBadRequest)
+			response.Data = dto.ErrorModel{Message: "invalid request body", Details: []*string{&detail}}
+			json.NewEncoder(w).Encode(&response)
+			return
+		}
+	}
+
+	var owner uuid.UUID
+	tx := c.DB.Raw(`SELECT user_id FROM accounts WHERE id = ? AND deleted_at IS NULL`, payload.AccountId.String()).Scan(&owner)
+	if tx.RowsAffected == 0 {
+		detail := fmt.Sprintf("account with id: %s not exist", payload.AccountId.String())
+		w.WriteHeader(http.StatusNotFound)
+		response.Data = dto.ErrorModel{Message: "account not found", Details: []*string{&detail}}
+		json.NewEncoder(w).Encode(&response)
+		return
+	}
+	if tx.Error != nil {
+		detail := tx.Error.Error()
+		w.WriteHeader(http.StatusInternalServerError)
+		response.Data = dto.ErrorModel{Message: "an error occured", Details: []*string{&detail}}
+		json.NewEncoder(w).Encode(&response)
+		return
+	}
+	if owner != userId {
+		detail := "This account does not belong to the user"
+		w.WriteHeader(http.StatusForbidden)
+		response.Data = dto.ErrorModel{Message: "forbidden", Details: []*string{&detail}}
+		json.NewEncoder(w).Encode(&response)
+		return
+	}
+
+	merchant := models.Merchant{
+		OwnerID:   userId,
+		AccountID: payload.AccountId,
+		Name:      payload.Name,
+		Status:    models.MerchantStatusActive,
+	}
+
+	tx = c.DB.Begin()
+	var exists bool
+	if err := tx.Raw(`SELECT EXISTS (SELECT 1 FROM merchants WHERE account_id = ?)`, payload.AccountId.String()).Scan(&exists).Error; err != nil {
+		tx.Rollback()
+		detail := err.Error()
+		w.WriteHeader(http.StatusInternalServerError)
+		response.Data = dto.ErrorModel{Message: "an error occured", Details: []*string{&detail}}
+		json.NewEncoder(w).Encode(&response)
+		return
+	}
+	if exists {
+		tx.Rollback()
+		detail := "this account already settles another merchant"
+		w.WriteHeader(http.StatusConflict)
+		response.Data = dto.ErrorModel{Message: "merchant already exists", Details: []*string{&detail}}
+		json.NewEncoder(w).Encode(&response)
+		return
+	}
+
+	var endpoint *models.WebhookEndpoint
+	if target != nil {
+		secret, err := webhooks.NewSecret()
+		if err != nil {
+			tx.Rollback()
+			detail := err.Error()
+			w.WriteHeader(http.StatusInternalServerError)
+			response.Data = dto.ErrorModel{Message: "failed to create secret", Details: []*string{&detail}}
+			json.NewEncoder(w).Encode(&response)
+			return
+		}
+		desc := fmt.Sprintf("merchant %s", merchant.Name)
+		endpoint = &models.WebhookEndpoint{
+			URL:         target.String(),
+			Secret:      secret,
+			EventTypes:  models.EventPaymentSucceeded + "," + models.EventPaymentRefunded,
+			AccountID:   &merchant.AccountID,
+			Description: &desc,
+			Active:      true,
+		}
+		if err := tx.Create(endpoint).Error; err != nil {
+			tx.Rollback()
+			detail := err.Error()
+			w.WriteHeader(http.StatusInternalServerError)
+			response.Data = dto.ErrorModel{Message: "failed to create webhook", Details: []*string{&detail}}
+			json.NewEncoder(w).Encode(&response)
+			return
+		}
+		merchant.WebhookEndpointID = &endpoint.ID
+	}
+
+	if err := tx.Create(&merchant).Error; err != nil {
+		tx.Rollback()
+		detail := err.Error()
+		w.WriteHeader(http.StatusInternalServerError)
+		response.Data = dto.ErrorModel{Message: "failed to create merchant", Details: []*string{&detail}}
+		json.NewEncoder(w).Encode(&response)
+		return
+	}
+
+	event := newAuditEvent(r, response.ID, "merchant.create", "merchant", merchant.ID.String())
+	event.SetChanges(nil, map[string]any{"name": merchant.Name, "accountId": merchant.AccountID})
+	if err := tx.Create(&event).Error; err != nil {
+		tx.Rollback()
+		detail := err.Error()
+		w.WriteHeader(http.StatusInternalServerError)
+		response.Data = dto.ErrorModel{Message: "failed to write audit entry", Details: []*string{&detail}}
+		json.NewEncoder(w).Encode(&response)
+		return
+	}
+
+	if err := tx.Commit().Error; err != nil {
+		detail := err.Error()
+		w.WriteHeader(http.StatusInternalServerError)
+		response.Data = dto.ErrorModel{Message: "database error", Details: []*string{&detail}}
+		json.NewEncoder(w).Encode(&response)
+		return
+	}
+
+	data := newMerchantResponse(&merchant)
+	if endpoint != nil {
+		data.WebhookSecret = endpoint.Secret
+	}
+	w.WriteHeader(http.StatusCreated)
+	response.Data = data
+	json.NewEncoder(w).Encode(&response)
+}
+
+func (c *Controller) ListMerchantsHandler(w http.ResponseWriter, r *http.Request) {
+	var response dto.ResponseModel
+	response.ID = uuid.New()
+	response.Timestamp = time.Now().UTC()
+	w.Header().Add("Content-Type", "application/json")
+
+	_uid, _ := r.Context().Value(middleware.USERID).(string)
+	var merchants []models.Merchant
+	if err := c.DB.Where("owner_id = ?", _uid).Order("created_at").Find(&merchants).Error; err != nil {
+		detail := err.Error()
+		w.WriteHeader(http.StatusInternalServerError)
+		response.Data = dto.ErrorModel{Message: "an error occured", Details: []*string{&detail}}
+		json.NewEncoder(w).Encode(&response)
+		return
+	}
+
+	data := make([]MerchantResponseModel, 0, len(merchants))
+	for i := range merchants {
+		data = append(data, newMerchantResponse(&merchants[i]))
+	}
+	response.Data = data
+	json.NewEncoder(w).Encode(&response)
+}
+
+// ownedMerchant loads the merchant in the path and checks the caller owns it,
+// it writes the error response itself and returns nil on failure.
+func (c *Controller) ownedMerchant(w http.ResponseWriter, r *http.Request, response *dto.ResponseModel) *models.Merchant {
+	merchantId, err := uuid.Parse(r.PathValue("merchantId"))
+	if err != nil {
+		detail := err.Error()
+		w.WriteHeader(http.StatusBadRequest)
+		response.Data = dto.ErrorModel{Message: "invalid id", Details: []*string{&detail}}
+		json.NewEncoder(w).Encode(response)
+		return nil
+	}
+
+	var merchant models.Merchant
+	tx := c.DB.Where("id = ?", merchantId.String()).Limit(1).Find(&merchant)
+	if tx.Error != nil {
+		detail := tx.Error.Error()
+		w.WriteHeader(http.StatusInternalServerError)
+		response.Data = dto.ErrorModel{Message: "an error occured", Details: []*string{&detail}}
+		json.NewEncoder(w).Encode(response)
+		return nil
+	}
+	if tx.RowsAffected == 0 {
+		detail := fmt.Sprintf("merchant with id: %s not exist", merchantId.String())
+		w.WriteHeader(http.StatusNotFound)
+		response.Data = dto.ErrorModel{Message: "merchant not found", Details: []*string{&detail}}
+		json.NewEncoder(w).Encode(response)
+		return nil
+	}
+	_uid, _ := r.Context().Value(middleware.USERID).(string)
+	if _uid != merchant.OwnerID.String() {
+		detail := "This merchant does not belong to the user"
+		w.WriteHeader(http.StatusForbidden)
+		response.Data = dto.ErrorModel{Message: "forbidden", Details: []*string{&detail}}
+		json.NewEncoder(w).Encode(response)
+		return nil
+	}
+	return &merchant
+}
+
+func (c *Controller) CreateMerchantAPIKeyHandler(w http.ResponseWriter, r *http.Request) {
+	var response dto.ResponseModel
+	response.ID = uuid.New()
+	response.Timestamp = time.Now().UTC()
+	w.Header().Add("Content-Type", "application/json")
+
+	merchant := c.ownedMerchant(w, r, &response)
+	if merchant == nil {
+		return
+	}
+
+	type RequestModel struct {
+		Label *string `json:"label"`
+	}
+	var payload RequestModel
+	if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+		detail := err.Error()
+		w.WriteHeader(http.StatusBadRequest)
+		response.Data = dto.ErrorModel{Message: "invalid request body", Details: []*string{&detail}}
+		json.NewEncoder(w).Encode(&response)
+		return
+	}
+
+	key, prefix, hash, err := newMerchantKey()
+	if err != nil {
+		detail := err.Error()
+		w.WriteHeader(http.StatusInternalServerError)
+		response.Data = dto.ErrorModel{Message: "failed to create api key", Details: []*string{&detail}}
+		json.NewEncoder(w).Encode(&response)
+		return
+	}
+	apiKey := models.MerchantAPIKey{
+		MerchantID: merchant.ID,
+		Prefix:     prefix,
+		KeyHash:    hash,
+		Label:      payload.Label,
+	}
+
+	tx := c.DB.Begin()
+	if err := tx.Create(&apiKey).Error; err != nil {
+		tx.Rollback()
+		detail := err.Error()
+		w.WriteHeader(http.StatusInternalServerError)
+		response.Data = dto.ErrorModel{Message: "failed to create api key", Details: []*string{&detail}}
+		json.NewEncoder(w).Encode(&response)
+		return
+	}
+
+	event := newAuditEvent(r, response.ID, "merchant.api_key.create", "merchant_api_key", apiKey.ID.String())
+	event.SetChanges(nil, map[string]any{"merchantId": merchant.ID, "prefix": prefix})
+	if err := tx.Create(&event).Error; err != nil {
+		tx.Rollback()
+		detail := err.Error()
+		w.WriteHeader(http.StatusInternalServerError)
+		response.Data = dto.ErrorModel{Message: "failed to write audit entry", Details: []*string{&detail}}
+		json.NewEncoder(w).Encode(&response)
+		return
+	}
+
+	if err := tx.Commit().Error; err != nil {
+		detail := err.Error()
+		w.WriteHeader(http.StatusInternalServerError)
+		response.Data = dto.ErrorModel{Message: "database error", Details: []*string{&detail}}
+		json.NewEncoder(w).Encode(&response)
+		return
+	}
+
+	data := newMerchantAPIKeyResponse(&apiKey)
+	data.Key = key
+	w.WriteHeader(http.StatusCreated)
+	response.Data = data
+	json.NewEncoder(w).Encode(&response)
+}
+
+func (c *Controller) RevokeMerchantAPIKeyHandler(w http.ResponseWriter, r *http.Request) {
+	var response dto.ResponseModel
+	response.ID = uuid.New()
+	response.Timestamp = time.Now().UTC()
+	w.Header().Add("Content-Type", "application/json")
+
+	merchant := c.ownedMerchant(w, r, &response)
+	if merchant == nil {
+		return
+	}
+	keyId, err := uuid.Parse(r.PathValue("keyId"))
+	if err != nil {
+		detail := err.Error()
+		w.WriteHeader(http.StatusBadRequest)
+		response.Data = dto.ErrorModel{Message: "invalid id", Details: []*string{&detail}}
+		json.NewEncoder(w).Encode(&response)
+		return
+	}
+
+	tx := c.DB.Begin()
+	var apiKey models.MerchantAPIKey
+	res := tx.Raw(`
+	UPDATE merchant_api_keys SET revoked_at = now()
+	WHERE id = ? AND merchant_id = ? AND revoked_at IS NULL
+	RETURNING *
+	`, keyId.String(), merchant.ID.String()).Scan(&apiKey)
+	if res.Error != nil {
+		tx.Rollback()
+		detail := res.Error.Error()
+		w.WriteHeader(http.StatusInternalServerError)
+		response.Data = dto.ErrorModel{Message: "failed to revoke api key", Details: []*string{&detail}}
+		json.NewEncoder(w).Encode(&response)
+		return
+	}
+	if res.RowsAffected == 0 {
+		tx.Rollback()
+		detail := fmt.Sprintf("active api key with id: %s not exist", keyId.String())
+		w.WriteHeader(http.StatusNotFound)
+		response.Data = dto.ErrorModel{Message: "api key not found", Details: []*string{&detail}}
+		json.NewEncoder(w).Encode(&response)
+		return
+	}
+
+	event := newAuditEvent(r, response.ID, "merchant.api_key.revoke", "merchant_api_key", apiKey.ID.String())
+	if err := tx.Create(&event).Error; err != nil {
+		tx.Rollback()
+		detail := err.Error()
+		w.WriteHeader(http.StatusInternalServerError)
+		response.Data = dto.ErrorModel{Message: "failed to write audit entry", Details: []*string{&detail}}
+		json.NewEncoder(w).Encode(&response)
+		return
+	}
+
+	if err := tx.Commit().Error; err != nil {
+		detail := err.Error()
+		w.WriteHeader(http.StatusInternalServerError)
+		response.Data = dto.ErrorModel{Message: "database error", Details: []*string{&detail}}
+		json.NewEncoder(w).Encode(&response)
+		return
+	}
+
+	response.Data = newMerchantAPIKeyResponse(&apiKey)
+	json.NewEncoder(w).Encode(&response)
+}
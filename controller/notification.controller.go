@@ -0,0 +1,111 @@
+package controller
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/eclipseron/digital-wallet-app/dto"
+	"github.com/eclipseron/digital-wallet-app/middleware"
+	"github.com/eclipseron/digital-wallet-app/models"
+	"github.com/google/uuid"
+)
+
+type NotificationResponseModel struct {
+	NotificationId uuid.UUID       `json:"notificationId"`
+	Type           string          `json:"type"`
+	Title          string          `json:"title"`
+	Body           string          `json:"body"`
+	Data           json.RawMessage `json:"data,omitempty"`
+	ReadAt         *time.Time      `json:"readAt"`
+	CreatedAt      time.Time       `json:"createdAt"`
+}
+
+func newNotificationResponse(n *models.Notification) NotificationResponseModel {
+	res := NotificationResponseModel{
+		NotificationId: n.ID,
+		Type:           n.Type,
+		Title:          n.Title,
+		Body:           n.Body,
+		ReadAt:         n.ReadAt,
+		CreatedAt:      n.CreatedAt.UTC(),
+	}
+	if n.Data != nil {
+		res.Data = json.RawMessage(*n.Data)
+	}
+	return res
+}
+
+// ListNotificationsHandler lists the caller's notifications, newest first.
+// ?unread=true leaves out the ones already read.
+func (c *Controller) ListNotificationsHandler(w http.ResponseWriter, r *http.Request) {
+	var response dto.ResponseModel
+	response.ID = uuid.New()
+	response.Timestamp = time.Now().UTC()
+	w.Header().Add("Content-Type", "application/json")
+
+	_uid, _ := r.Context().Value(middleware.USERID).(string)
+	limit, offset := parsePagination(r)
+
+	db := c.DB.Where("user_id = ?", _uid)
+	if r.URL.Query().Get("unread") == "true" {
+		db = db.Where("read_at IS NULL")
+	}
+	var notifications []models.Notification
+	if err := db.Order("created_at DESC").Limit(limit).Offset(offset).Find(&notifications).Error; err != nil {
+		detail := err.Error()
+		w.WriteHeader(http.StatusInternalServerError)
+		response.Data = dto.ErrorModel{Message: "an error occured", Details: []*string{&detail}}
+		json.NewEncoder(w).Encode(&response)
+		return
+	}
+
+	data := make([]NotificationResponseModel, 0, len(notifications))
+	for i := range notifications {
+		data = append(data, newNotificationResponse(&notifications[i]))
+	}
+	response.Data = data
+	json.NewEncoder(w).Encode(&response)
+}
+
+func (c *Controller) ReadNotificationHandler(w http.ResponseWriter, r *http.Request) {
+	var response dto.ResponseModel
+	response.ID = uuid.New()
+	response.Timestamp = time.Now().UTC()
+	w.Header().Add("Content-Type", "application/json")
+
+	_uid, _ := r.Context().Value(middleware.USERID).(string)
+	notificationId, err := uuid.Parse(r.PathValue("notificationId"))
+	if err != nil {
+		detail := err.Error()
+		w.WriteHeader(http.StatusBadRequest)
+		response.Data = dto.ErrorModel{Message: "invalid id", Details: []*string{&detail}}
+		json.NewEncoder(w).Encode(&response)
+		return
+	}
+
+	var n models.Notification
+	tx := c.DB.Raw(`
+	UPDATE notifications SET read_at = COALESCE(read_at, now())
+	WHERE id = ? AND user_id = ?
+	RETURNING *
+	`, notificationId.String(), _uid).Scan(&n)
+	if tx.Error != nil {
+		detail := tx.Error.Error()
+		w.WriteHeader(http.StatusInternalServerError)
+		response.Data = dto.ErrorModel{Message: "an error occured", Details: []*string{&detail}}
+		json.NewEncoder(w).Encode(&response)
+		return
+	}
+	if tx.RowsAffected == 0 {
+		detail := fmt.Sprintf("notification with id: %s not exist", notificationId.String())
+		w.WriteHeader(http.StatusNotFound)
+		response.Data = dto.ErrorModel{Message: "notification not found", Details: []*string{&detail}}
+		json.NewEncoder(w).Encode(&response)
+		return
+	}
+
+	response.Data = newNotificationResponse(&n)
+	json.NewEncoder(w).Encode(&response)
+}
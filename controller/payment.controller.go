@@ -0,0 +1,562 @@
+package controller
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/eclipseron/digital-wallet-app/dto"
+	"github.com/eclipseron/digital-wallet-app/ledger"
+	"github.com/eclipseron/digital-wallet-app/middleware"
+	"github.com/eclipseron/digital-wallet-app/models"
+	"github.com/eclipseron/digital-wallet-app/settlement"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+const (
+	defaultIntentExpiry = 15 * time.Minute
+	maxIntentExpiry     = 24 * time.Hour
+)
+
+type PaymentIntentResponseModel struct {
+	IntentId       uuid.UUID  `json:"intentId"`
+	MerchantId     uuid.UUID  `json:"merchantId"`
+	MerchantName   string     `json:"merchantName,omitempty"`
+	Reference      string     `json:"reference"`
+	Amount         int64      `json:"amount"`
+	Description    *string    `json:"description"`
+	Status         string     `json:"status"`
+	ExpiresAt      time.Time  `json:"expiresAt"`
+	PayerAccountId *uuid.UUID `json:"payerAccountId"`
+	TransactionId  *uuid.UUID `json:"transactionId"`
+	Fee            int64      `json:"fee"`
+	RefundedAmount int64      `json:"refundedAmount"`
+	PaidAt         *time.Time `json:"paidAt"`
+	CreatedAt      time.Time  `json:"createdAt"`
+	FinalBalance   *int64     `json:"finalBalance,omitempty"`
+}
+
+// newPaymentIntentResponse reports a pending intent past its expiry as
+// EXPIRED, the row itself is only updated when someone tries to pay it.
+func newPaymentIntentResponse(p *models.PaymentIntent) PaymentIntentResponseModel {
+	res := PaymentIntentResponseModel{
+		IntentId:       p.ID,
+		MerchantId:     p.MerchantID,
+		Reference:      p.Reference,
+		Amount:         p.Amount,
+		Description:    p.Description,
+		Status:         p.Status,
+		ExpiresAt:      p.ExpiresAt.UTC(),
+		PayerAccountId: p.PayerAccountID,
+		TransactionId:  p.TransactionID,
+		Fee:            p.Fee,
+		RefundedAmount: p.RefundedAmount,
+		PaidAt:         p.PaidAt,
+		CreatedAt:      p.CreatedAt.UTC(),
+	}
+	if p.Status == models.PaymentIntentPending && !p.ExpiresAt.After(time.Now()) {
+		res.Status = models.PaymentIntentExpired
+	}
+	if p.Merchant != nil {
+		res.MerchantName = p.Merchant.Name
+	}
+	return res
+}
+
+func (c *Controller) CreatePaymentIntentHandler(w http.ResponseWriter, r *http.Request) {
+	var response dto.ResponseModel
+	response.ID = uuid.New()
+	response.Timestamp = time.Now().UTC()
+	w.Header().Add("Content-Type", "application/json")
+
+	_mid, _ := r.Context().Value(middleware.MERCHANTID).(string)
+	merchantId, err := uuid.Parse(_mid)
+	if err != nil {
+		detail := err.Error()
+		w.WriteHeader(http.StatusUnauthorized)
+		response.Data = dto.ErrorModel{Message: "invalid api key", Details: []*string{&detail}}
+		json.NewEncoder(w).Encode(&response)
+		return
+	}
+
+	type RequestModel struct {
+		Amount      int64   `json:"amount"`
+		Reference   string  `json:"reference"`
+		Description *string `json:"description"`
+		// ExpiresIn is in seconds, defaults to 15 minutes
+		ExpiresIn int64 `json:"expiresIn"`
+	}
+	var payload RequestModel
+	if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+		detail := err.Error()
+		w.WriteHeader(http.StatusBadRequest)
+		response.Data = dto.ErrorModel{Message: "invalid request body", Details: []*string{&detail}}
+		json.NewEncoder(w).Encode(&response)
+		return
+	}
+	if payload.Amount <= 0 {
+		detail := "amount must be positive"
+		w.WriteHeader(http.StatusBadRequest)
+		response.Data = dto.ErrorModel{Message: "invalid request body", Details: []*string{&detail}}
+		json.NewEncoder(w).Encode(&response)
+		return
+	}
+	payload.Reference = strings.TrimSpace(payload.Reference)
+	if payload.Reference == "" || len(payload.Reference) > 64 {
+		detail := "reference is required and at most 64 characters"
+		w.WriteHeader(http.StatusBadRequest)
+		response.Data = dto.ErrorModel{Message: "invalid request body", Details: []*string{&detail}}
+		json.NewEncoder(w).Encode(&response)
+		return
+	}
+	expiry := defaultIntentExpiry
+	if payload.ExpiresIn > 0 {
+		expiry = time.Duration(payload.ExpiresIn) * time.Second
+	}
+	if expiry > maxIntentExpiry {
+		detail := "payment intents can not last longer than 24 hours"
+		w.WriteHeader(http.StatusBadRequest)
+		response.Data = dto.ErrorModel{Message: "invalid request body", Details: []*string{&detail}}
+		json.NewEncoder(w).Encode(&response)
+		return
+	}
+
+	// a retried create with the same reference gets the original intent back
+	var intent models.PaymentIntent
+	tx := c.DB.Raw(`
+	INSERT INTO payment_intents (merchant_id, reference, amount, description, status, expires_at, created_at, updated_at)
+	VALUES (?, ?, ?, ?, ?, ?, now(), now())
+	ON CONFLICT (merchant_id, reference) DO NOTHING
+	RETURNING *
+	`, merchantId.String(), payload.Reference, payload.Amount, payload.Description,
+		models.PaymentIntentPending, time.Now().Add(expiry)).Scan(&intent)
+	if tx.Error != nil {
+		detail := tx.Error.Error()
+		w.WriteHeader(http.StatusInternalServerError)
+		response.Data = dto.ErrorModel{Message: "failed to create payment intent", Details: []*string{&detail}}
+		json.NewEncoder(w).Encode(&response)
+		return
+	}
+	if tx.RowsAffected == 0 {
+		err := c.DB.Where("merchant_id = ? AND reference = ?", merchantId.String(), payload.Reference).
+			First(&intent).Error
+		if err != nil {
+			detail := err.Error()
+			w.WriteHeader(http.StatusInternalServerError)
+			response.Data = dto.ErrorModel{Message: "an error occured", Details: []*string{&detail}}
+			json.NewEncoder(w).Encode(&response)
+			return
+		}
+		if intent.Amount != payload.Amount {
+			detail := fmt.Sprintf("reference %s is already used for amount %d", intent.Reference, intent.Amount)
+			w.WriteHeader(http.StatusConflict)
+			response.Data = dto.ErrorModel{Message: "duplicate reference", Details: []*string{&detail}}
+			json.NewEncoder(w).Encode(&response)
+			return
+		}
+		response.Data = newPaymentIntentResponse(&intent)
+		json.NewEncoder(w).Encode(&response)
+		return
+	}
+
+	w.WriteHeader(http.StatusCreated)
+	response.Data = newPaymentIntentResponse(&intent)
+	json.NewEncoder(w).Encode(&response)
+}
+
+func (c *Controller) MerchantGetPaymentIntentHandler(w http.ResponseWriter, r *http.Request) {
+	var response dto.ResponseModel
+	response.ID = uuid.New()
+	response.Timestamp = time.Now().UTC()
+	w.Header().Add("Content-Type", "application/json")
+
+	_mid, _ := r.Context().Value(middleware.MERCHANTID).(string)
+	intentId, err := uuid.Parse(r.PathValue("intentId"))
+	if err != nil {
+		detail := err.Error()
+		w.WriteHeader(http.StatusBadRequest)
+		response.Data = dto.ErrorModel{Message: "invalid id", Details: []*string{&detail}}
+		json.NewEncoder(w).Encode(&response)
+		return
+	}
+
+	var intent models.PaymentIntent
+	tx := c.DB.Where("id = ? AND merchant_id = ?", intentId.String(), _mid).Limit(1).Find(&intent)
+	if tx.Error != nil {
+		detail := tx.Error.Error()
+		w.WriteHeader(http.StatusInternalServerError)
+		response.Data = dto.ErrorModel{Message: "an error occured", Details: []*string{&detail}}
+		json.NewEncoder(w).Encode(&response)
+		return
+	}
+	if tx.RowsAffected == 0 {
+		detail := fmt.Sprintf("payment intent with id: %s not exist", intentId.String())
+		w.WriteHeader(http.StatusNotFound)
+		response.Data = dto.ErrorModel{Message: "payment intent not found", Details: []*string{&detail}}
+		json.NewEncoder(w).Encode(&response)
+		return
+	}
+
+	response.Data = newPaymentIntentResponse(&intent)
+	json.NewEncoder(w).Encode(&response)
+}
+
+func (c *Controller) CancelPaymentIntentHandler(w http.ResponseWriter, r *http.Request) {
+	var response dto.ResponseModel
+	response.ID = uuid.New()
+	response.Timestamp = time.Now().UTC()
+	w.Header().Add("Content-Type", "application/json")
+
+	_mid, _ := r.Context().Value(middleware.MERCHANTID).(string)
+	intentId, err := uuid.Parse(r.PathValue("intentId"))
+	if err != nil {
+		detail := err.Error()
+		w.WriteHeader(http.StatusBadRequest)
+		response.Data = dto.ErrorModel{Message: "invalid id", Details: []*string{&detail}}
+		json.NewEncoder(w).Encode(&response)
+		return
+	}
+
+	var intent models.PaymentIntent
+	tx := c.DB.Raw(`
+	UPDATE payment_intents SET status = ?, updated_at = now()
+	WHERE id = ? AND merchant_id = ? AND status = ?
+	RETURNING *
+	`, models.PaymentIntentCancelled, intentId.String(), _mid, models.PaymentIntentPending).Scan(&intent)
+	if tx.Error != nil {
+		detail := tx.Error.Error()
+		w.WriteHeader(http.StatusInternalServerError)
+		response.Data = dto.ErrorModel{Message: "failed to cancel payment intent", Details: []*string{&detail}}
+		json.NewEncoder(w).Encode(&response)
+		return
+	}
+	if tx.RowsAffected == 0 {
+		detail := fmt.Sprintf("pending payment intent with id: %s not exist", intentId.String())
+		w.WriteHeader(http.StatusConflict)
+		response.Data = dto.ErrorModel{Message: "payment intent can not be cancelled", Details: []*string{&detail}}
+		json.NewEncoder(w).Encode(&response)
+		return
+	}
+
+	response.Data = newPaymentIntentResponse(&intent)
+	json.NewEncoder(w).Encode(&response)
+}
+
+func (c *Controller) GetPaymentIntentHandler(w http.ResponseWriter, r *http.Request) {
+	var response dto.ResponseModel
+	response.ID = uuid.New()
+	response.Timestamp = time.Now().UTC()
+	w.Header().Add("Content-Type", "application/json")
+
+	intentId, err := uuid.Parse(r.PathValue("intentId"))
+	if err != nil {
+		detail := err.Error()
+		w.WriteHeader(http.StatusBadRequest)
+		response.Data = dto.ErrorModel{Message: "invalid id", Details: []*string{&detail}}
+		json.NewEncoder(w).Encode(&response)
+		return
+	}
+
+	var intent models.PaymentIntent
+	tx := c.DB.Preload("Merchant").Where("id = ?", intentId.String()).Limit(1).Find(&intent)
+	if tx.Error != nil {
+		detail := tx.Error.Error()
+		w.WriteHeader(http.StatusInternalServerError)
+		response.Data = dto.ErrorModel{Message: "an error occured", Details: []*string{&detail}}
+		json.NewEncoder(w).Encode(&response)
+		return
+	}
+	if tx.RowsAffected == 0 {
+		detail := fmt.Sprintf("payment intent with id: %s not exist", intentId.String())
+		w.WriteHeader(http.StatusNotFound)
+		response.Data = dto.ErrorModel{Message: "payment intent not found", Details: []*string{&detail}}
+		json.NewEncoder(w).Encode(&response)
+		return
+	}
+
+	data := newPaymentIntentResponse(&intent)
+	// only the payer gets to see where the money came from
+	_uid, _ := r.Context().Value(middleware.USERID).(string)
+	if intent.PayerAccountID != nil {
+		var payer uuid.UUID
+		c.DB.Raw(`SELECT user_id FROM accounts WHERE id = ?`, intent.PayerAccountID.String()).Scan(&payer)
+		if payer.String() != _uid {
+			data.PayerAccountId = nil
+			data.TransactionId = nil
+		}
+	}
+	response.Data = data
+	json.NewEncoder(w).Encode(&response)
+}
+
+// payIntent moves the intent amount from accountID to the merchant, marks the
+// intent paid and writes payment.succeeded for the merchant's webhook. The
+// caller must hold the intent row lock and have checked it is payable.
+func payIntent(tx *gorm.DB, intent *models.PaymentIntent, merchant *models.Merchant, accountID uuid.UUID) (int64, error) {
+	payerDesc := fmt.Sprintf("Payment to %s (%s)", merchant.Name, intent.Reference)
+	merchantDesc := fmt.Sprintf("Payment %s", intent.Reference)
+	debit := models.Transactions{Type: "TRANSFER", Description: &payerDesc}
+	credit := models.Transactions{Type: "TRANSFER", Description: &merchantDesc}
+	balance, err := ledger.Transfer(tx, accountID, merchant.AccountID, intent.Amount, &debit, &credit)
+	if err != nil {
+		return 0, err
+	}
+	fee, err := chargeMerchantFee(tx, merchant, intent.Amount, intent.Reference)
+	if err != nil {
+		return 0, err
+	}
+
+	now := time.Now()
+	intent.Status = models.PaymentIntentSucceeded
+	intent.PayerAccountID = &accountID
+	intent.TransactionID = &debit.ID
+	intent.SettlementTransactionID = &credit.ID
+	intent.Fee = fee
+	intent.PaidAt = &now
+	err = tx.Model(intent).
+		Select("status", "payer_account_id", "transaction_id", "settlement_transaction_id", "fee", "paid_at", "updated_at").
+		Updates(intent).Error
+	if err != nil {
+		return 0, err
+	}
+	err = models.AppendOutbox(tx, &merchant.AccountID, models.EventPaymentSucceeded, map[string]any{
+		"intentId":      intent.ID,
+		"merchantId":    merchant.ID,
+		"reference":     intent.Reference,
+		"amount":        intent.Amount,
+		"fee":           fee,
+		"transactionId": credit.ID,
+		"paidAt":        now.UTC(),
+	})
+	return balance, err
+}
+
+// chargeMerchantFee books the MERCHANT_FEE_BPS fee of a payment as a FEE
+// transfer from the merchant to FEE_ACCOUNT_ID and returns it. Nothing is
+// charged while either is unset. Fees are kept when a payment is refunded.
+func chargeMerchantFee(tx *gorm.DB, merchant *models.Merchant, amount int64, reference string) (int64, error) {
+	feeAccount, ok := settlement.FeeAccount()
+	fee := settlement.Fee(amount, settlement.FeeBps())
+	if !ok || fee == 0 || feeAccount == merchant.AccountID {
+		return 0, nil
+	}
+	merchantDesc := strings.TrimSpace(fmt.Sprintf("Merchant fee %s", reference))
+	feeDesc := strings.TrimSpace(fmt.Sprintf("Merchant fee from %s %s", merchant.Name, reference))
+	debit := models.Transactions{Type: "FEE", Description: &merchantDesc}
+	credit := models.Transactions{Type: "FEE", Description: &feeDesc}
+	if _, err := ledger.Transfer(tx, merchant.AccountID, feeAccount, fee, &debit, &credit); err != nil {
+		return 0, err
+	}
+	return fee, nil
+}
+
+// ConfirmPaymentIntentHandler pays an intent from one of the caller's
+// accounts. The intent row is locked for the whole payment so it can only be
+// paid once, the merchant hears about it through payment.succeeded.
+func (c *Controller) ConfirmPaymentIntentHandler(w http.ResponseWriter, r *http.Request) {
+	var response dto.ResponseModel
+	response.ID = uuid.New()
+	response.Timestamp = time.Now().UTC()
+	w.Header().Add("Content-Type", "application/json")
+
+	_uid, _ := r.Context().Value(middleware.USERID).(string)
+	userId, err := uuid.Parse(_uid)
+	if err != nil {
+		detail := err.Error()
+		w.WriteHeader(http.StatusUnauthorized)
+		response.Data = dto.ErrorModel{Message: "invalid token payload", Details: []*string{&detail}}
+		json.NewEncoder(w).Encode(&response)
+		return
+	}
+	intentId, err := uuid.Parse(r.PathValue("intentId"))
+	if err != nil {
+		detail := err.Error()
+		w.WriteHeader(http.StatusBadRequest)
+		response.Data = dto.ErrorModel{Message: "invalid id", Details: []*string{&detail}}
+		json.NewEncoder(w).Encode(&response)
+		return
+	}
+
+	type RequestModel struct {
+		AccountId uuid.UUID `json:"accountId"`
+		Pin       string    `json:"pin"`
+	}
+	var payload RequestModel
+	if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+		detail := err.Error()
+		w.WriteHeader(http.StatusBadRequest)
+		response.Data = dto.ErrorModel{Message: "invalid request body", Details: []*string{&detail}}
+		json.NewEncoder(w).Encode(&response)
+		return
+	}
+
+	var owner uuid.UUID
+	tx := c.DB.Raw(`SELECT user_id FROM accounts WHERE id = ? AND deleted_at IS NULL`, payload.AccountId.String()).Scan(&owner)
+	if tx.RowsAffected == 0 {
+		detail := fmt.Sprintf("account with id: %s not exist", payload.AccountId.String())
+		w.WriteHeader(http.StatusNotFound)
+		response.Data = dto.ErrorModel{Message: "account not found", Details: []*string{&detail}}
+		json.NewEncoder(w).Encode(&response)
+		return
+	}
+	if tx.Error != nil {
+		detail := tx.Error.Error()
+		w.WriteHeader(http.StatusInternalServerError)
+		response.Data = dto.ErrorModel{Message: "an error occured", Details: []*string{&detail}}
+		json.NewEncoder(w).Encode(&response)
+		return
+	}
+	if owner != userId {
+		detail := "This account does not belong to the user"
+		w.WriteHeader(http.StatusForbidden)
+		response.Data = dto.ErrorModel{Message: "forbidden", Details: []*string{&detail}}
+		json.NewEncoder(w).Encode(&response)
+		return
+	}
+
+	if err := c.verifyPin(userId, payload.Pin); err != nil {
+		status := http.StatusForbidden
+		if !errors.Is(err, errPin) {
+			status = http.StatusInternalServerError
+		}
+		detail := err.Error()
+		w.WriteHeader(status)
+		response.Data = dto.ErrorModel{Message: "pin verification failed", Details: []*string{&detail}}
+		json.NewEncoder(w).Encode(&response)
+		return
+	}
+
+	tx = c.DB.Begin()
+	var intent models.PaymentIntent
+	res := tx.Raw(`SELECT * FROM payment_intents WHERE id = ? FOR UPDATE`, intentId.String()).Scan(&intent)
+	if res.Error != nil {
+		tx.Rollback()
+		detail := res.Error.Error()
+		w.WriteHeader(http.StatusInternalServerError)
+		response.Data = dto.ErrorModel{Message: "an error occured", Details: []*string{&detail}}
+		json.NewEncoder(w).Encode(&response)
+		return
+	}
+	if res.RowsAffected == 0 {
+		tx.Rollback()
+		detail := fmt.Sprintf("payment intent with id: %s not exist", intentId.String())
+		w.WriteHeader(http.StatusNotFound)
+		response.Data = dto.ErrorModel{Message: "payment intent not found", Details: []*string{&detail}}
+		json.NewEncoder(w).Encode(&response)
+		return
+	}
+	if intent.Status == models.PaymentIntentPending && !intent.ExpiresAt.After(time.Now()) {
+		intent.Status = models.PaymentIntentExpired
+		err := tx.Exec(`UPDATE payment_intents SET status = ?, updated_at = now() WHERE id = ?`,
+			intent.Status, intent.ID.String()).Error
+		if err == nil {
+			err = tx.Commit().Error
+		} else {
+			tx.Rollback()
+		}
+		if err != nil {
+			detail := err.Error()
+			w.WriteHeader(http.StatusInternalServerError)
+			response.Data = dto.ErrorModel{Message: "database error", Details: []*string{&detail}}
+			json.NewEncoder(w).Encode(&response)
+			return
+		}
+		w.WriteHeader(http.StatusGone)
+		response.Data = dto.ErrorModel{Message: "payment intent expired"}
+		json.NewEncoder(w).Encode(&response)
+		return
+	}
+	if intent.Status != models.PaymentIntentPending {
+		tx.Rollback()
+		detail := fmt.Sprintf("payment intent is %s", strings.ToLower(intent.Status))
+		w.WriteHeader(http.StatusConflict)
+		response.Data = dto.ErrorModel{Message: "payment intent can not be paid", Details: []*string{&detail}}
+		json.NewEncoder(w).Encode(&response)
+		return
+	}
+
+	var merchant models.Merchant
+	if err := tx.First(&merchant, "id = ?", intent.MerchantID).Error; err != nil {
+		tx.Rollback()
+		detail := err.Error()
+		w.WriteHeader(http.StatusInternalServerError)
+		response.Data = dto.ErrorModel{Message: "an error occured", Details: []*string{&detail}}
+		json.NewEncoder(w).Encode(&response)
+		return
+	}
+	if merchant.Status != models.MerchantStatusActive {
+		tx.Rollback()
+		detail := fmt.Sprintf("merchant is %s", strings.ToLower(merchant.Status))
+		w.WriteHeader(http.StatusConflict)
+		response.Data = dto.ErrorModel{Message: "payment intent can not be paid", Details: []*string{&detail}}
+		json.NewEncoder(w).Encode(&response)
+		return
+	}
+
+	balance, err := payIntent(tx, &intent, &merchant, payload.AccountId)
+	if errors.Is(err, ledger.ErrSameAccount) {
+		tx.Rollback()
+		detail := "a merchant can not pay itself"
+		w.WriteHeader(http.StatusBadRequest)
+		response.Data = dto.ErrorModel{Message: "invalid request body", Details: []*string{&detail}}
+		json.NewEncoder(w).Encode(&response)
+		return
+	}
+	if errors.Is(err, ledger.ErrInsufficientBalance) {
+		tx.Rollback()
+		c.transferFailed(payload.AccountId, "TRANSFER", intent.Amount, err.Error(), nil, nil)
+		w.WriteHeader(http.StatusBadRequest)
+		response.Data = dto.ErrorModel{Message: "insufficient balance"}
+		json.NewEncoder(w).Encode(&response)
+		return
+	}
+	if models.IsRestricted(err) {
+		tx.Rollback()
+		c.transferFailed(payload.AccountId, "TRANSFER", intent.Amount, err.Error(), nil, nil)
+		detail := err.Error()
+		w.WriteHeader(http.StatusForbidden)
+		response.Data = dto.ErrorModel{Message: "account restricted", Details: []*string{&detail}}
+		json.NewEncoder(w).Encode(&response)
+		return
+	}
+	if err != nil {
+		tx.Rollback()
+		detail := err.Error()
+		w.WriteHeader(http.StatusInternalServerError)
+		response.Data = dto.ErrorModel{Message: "payment failed", Details: []*string{&detail}}
+		json.NewEncoder(w).Encode(&response)
+		return
+	}
+
+	event := newAuditEvent(r, response.ID, "payment_intent.confirm", "payment_intent", intent.ID.String())
+	event.SetChanges(
+		map[string]any{"status": models.PaymentIntentPending},
+		map[string]any{"status": intent.Status, "accountId": payload.AccountId, "amount": intent.Amount},
+	)
+	if err := tx.Create(&event).Error; err != nil {
+		tx.Rollback()
+		detail := err.Error()
+		w.WriteHeader(http.StatusInternalServerError)
+		response.Data = dto.ErrorModel{Message: "failed to write audit entry", Details: []*string{&detail}}
+		json.NewEncoder(w).Encode(&response)
+		return
+	}
+
+	if err := tx.Commit().Error; err != nil {
+		detail := err.Error()
+		w.WriteHeader(http.StatusInternalServerError)
+		response.Data = dto.ErrorModel{Message: "database error", Details: []*string{&detail}}
+		json.NewEncoder(w).Encode(&response)
+		return
+	}
+
+	intent.Merchant = &merchant
+	data := newPaymentIntentResponse(&intent)
+	data.FinalBalance = &balance
+	response.Data = data
+	json.NewEncoder(w).Encode(&response)
+}
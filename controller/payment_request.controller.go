@@ -0,0 +1,578 @@
+package controller
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/eclipseron/digital-wallet-app/dto"
+	"github.com/eclipseron/digital-wallet-app/ledger"
+	"github.com/eclipseron/digital-wallet-app/middleware"
+	"github.com/eclipseron/digital-wallet-app/models"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+const (
+	defaultRequestExpiry = 7 * 24 * time.Hour
+	maxRequestExpiry     = 30 * 24 * time.Hour
+)
+
+var errPaymentRequestClosed = errors.New("payment request is no longer pending")
+
+type PaymentRequestResponseModel struct {
+	RequestId   uuid.UUID  `json:"requestId"`
+	AccountId   uuid.UUID  `json:"accountId"`
+	RequesterId uuid.UUID  `json:"requesterId"`
+	PayerId     *uuid.UUID `json:"payerId"`
+	Amount      int64      `json:"amount"`
+	Note        *string    `json:"note"`
+	Status      string     `json:"status"`
+	// PayLink is only shown to the requester
+	PayLink        string     `json:"payLink,omitempty"`
+	ExpiresAt      time.Time  `json:"expiresAt"`
+	PayerAccountId *uuid.UUID `json:"payerAccountId"`
+	TransactionId  *uuid.UUID `json:"transactionId"`
+	PaidAt         *time.Time `json:"paidAt"`
+	CreatedAt      time.Time  `json:"createdAt"`
+	FinalBalance   *int64     `json:"finalBalance,omitempty"`
+}
+
+// newPaymentRequestResponse reports a pending request past its expiry as
+// EXPIRED, like payment intents the row is left as it is.
+func newPaymentRequestResponse(p *models.PaymentRequest, userID string) PaymentRequestResponseModel {
+	res := PaymentRequestResponseModel{
+		RequestId:      p.ID,
+		AccountId:      p.AccountID,
+		RequesterId:    p.RequesterID,
+		PayerId:        p.PayerID,
+		Amount:         p.Amount,
+		Note:           p.Note,
+		Status:         p.Status,
+		ExpiresAt:      p.ExpiresAt.UTC(),
+		PayerAccountId: p.PayerAccountID,
+		TransactionId:  p.TransactionID,
+		PaidAt:         p.PaidAt,
+		CreatedAt:      p.CreatedAt.UTC(),
+	}
+	if p.Status == models.PaymentRequestPending && !p.ExpiresAt.After(time.Now()) {
+		res.Status = models.PaymentRequestExpired
+	}
+	if p.RequesterID.String() == userID {
+		res.PayLink = os.Getenv("PUBLIC_BASE_URL") + "/api/v1/pay-links/" + p.LinkToken
+	}
+	return res
+}
+
+func (c *Controller) CreatePaymentRequestHandler(w http.ResponseWriter, r *http.Request) {
+	var response dto.ResponseModel
+	response.ID = uuid.New()
+	response.Timestamp = time.Now().UTC()
+	w.Header().Add("Content-Type", "application/json")
+
+	_uid, _ := r.Context().Value(middleware.USERID).(string)
+	userId, err := uuid.Parse(_uid)
+	if err != nil {
+		detail := err.Error()
+		w.WriteHeader(http.StatusUnauthorized)
+		response.Data = dto.ErrorModel{Message: "invalid token payload", Details: []*string{&detail}}
+		json.NewEncoder(w).Encode(&response)
+		return
+	}
+
+	type RequestModel struct {
+		AccountId uuid.UUID `json:"accountId"`
+		Amount    int64     `json:"amount"`
+		Note      *string   `json:"note"`
+		// PayerEmail is optional, without it anyone with the link can pay
+		PayerEmail *string `json:"payerEmail"`
+		// ExpiresIn is in seconds, defaults to 7 days
+		ExpiresIn int64 `json:"expiresIn"`
+	}
+	var payload RequestModel
+	if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+		detail := err.Error()
+		w.WriteHeader(http.StatusBadRequest)
+		response.Data = dto.ErrorModel{Message: "invalid request body", Details: []*string{&detail}}
+		json.NewEncoder(w).Encode(&response)
+		return
+	}
+	if payload.Amount <= 0 {
+		detail := "amount must be positive"
+		w.WriteHeader(http.StatusBadRequest)
+		response.Data = dto.ErrorModel{Message: "invalid request body", Details: []*string{&detail}}
+		json.NewEncoder(w).Encode(&response)
+		return
+	}
+	if payload.Note != nil && len(*payload.Note) > 255 {
+		detail := "note is at most 255 characters"
+		w.WriteHeader(http.StatusBadRequest)
+		response.Data = dto.ErrorModel{Message: "invalid request body", Details: []*string{&detail}}
+		json.NewEncoder(w).Encode(&response)
+		return
+	}
+	expiry := defaultRequestExpiry
+	if payload.ExpiresIn > 0 {
+		expiry = time.Duration(payload.ExpiresIn) * time.Second
+	}
+	if expiry > maxRequestExpiry {
+		detail := "payment requests can not last longer than 30 days"
+		w.WriteHeader(http.StatusBadRequest)
+		response.Data = dto.ErrorModel{Message: "invalid request body", Details: []*string{&detail}}
+		json.NewEncoder(w).Encode(&response)
+		return
+	}
+
+	var owner uuid.UUID
+	tx := c.DB.Raw(`SELECT user_id FROM accounts WHERE id = ? AND deleted_at IS NULL`, payload.AccountId.String()).Scan(&owner)
+	if tx.RowsAffected == 0 {
+		detail := fmt.Sprintf("account with id: %s not exist", payload.AccountId.String())
+		w.WriteHeader(http.StatusNotFound)
+		response.Data = dto.ErrorModel{Message: "account not found", Details: []*string{&detail}}
+		json.NewEncoder(w).Encode(&response)
+		return
+	}
+	if tx.Error != nil {
+		detail := tx.Error.Error()
+		w.WriteHeader(http.StatusInternalServerError)
+		response.Data = dto.ErrorModel{Message: "an error occured", Details: []*string{&detail}}
+		json.NewEncoder(w).Encode(&response)
+		return
+	}
+	if owner != userId {
+		detail := "This account does not belong to the user"
+		w.WriteHeader(http.StatusForbidden)
+		response.Data = dto.ErrorModel{Message: "forbidden", Details: []*string{&detail}}
+		json.NewEncoder(w).Encode(&response)
+		return
+	}
+
+	var payerId *uuid.UUID
+	if payload.PayerEmail != nil {
+		var id uuid.UUID
+		tx := c.DB.Raw(`
+		SELECT id FROM users WHERE email = ? AND deleted_at IS NULL
+		`, strings.TrimSpace(*payload.PayerEmail)).Scan(&id)
+		if tx.Error != nil {
+			detail := tx.Error.Error()
+			w.WriteHeader(http.StatusInternalServerError)
+			response.Data = dto.ErrorModel{Message: "an error occured", Details: []*string{&detail}}
+			json.NewEncoder(w).Encode(&response)
+			return
+		}
+		if tx.RowsAffected == 0 {
+			detail := fmt.Sprintf("user with email: %s not exist", *payload.PayerEmail)
+			w.WriteHeader(http.StatusNotFound)
+			response.Data = dto.ErrorModel{Message: "payer not found", Details: []*string{&detail}}
+			json.NewEncoder(w).Encode(&response)
+			return
+		}
+		if id == userId {
+			detail := "you can not request money from yourself"
+			w.WriteHeader(http.StatusBadRequest)
+			response.Data = dto.ErrorModel{Message: "invalid request body", Details: []*string{&detail}}
+			json.NewEncoder(w).Encode(&response)
+			return
+		}
+		payerId = &id
+	}
+
+	b := make([]byte, 24)
+	if _, err := rand.Read(b); err != nil {
+		detail := err.Error()
+		w.WriteHeader(http.StatusInternalServerError)
+		response.Data = dto.ErrorModel{Message: "failed to create pay link", Details: []*string{&detail}}
+		json.NewEncoder(w).Encode(&response)
+		return
+	}
+	request := models.PaymentRequest{
+		RequesterID: userId,
+		AccountID:   payload.AccountId,
+		PayerID:     payerId,
+		Amount:      payload.Amount,
+		Note:        payload.Note,
+		LinkToken:   hex.EncodeToString(b),
+		Status:      models.PaymentRequestPending,
+		ExpiresAt:   time.Now().Add(expiry),
+	}
+
+	err = c.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&request).Error; err != nil {
+			return err
+		}
+		event := newAuditEvent(r, response.ID, "payment_request.create", "payment_request", request.ID.String())
+		event.SetChanges(nil, map[string]any{"amount": request.Amount, "payerId": request.PayerID})
+		return tx.Create(&event).Error
+	})
+	if err != nil {
+		detail := err.Error()
+		w.WriteHeader(http.StatusInternalServerError)
+		response.Data = dto.ErrorModel{Message: "failed to create payment request", Details: []*string{&detail}}
+		json.NewEncoder(w).Encode(&response)
+		return
+	}
+
+	w.WriteHeader(http.StatusCreated)
+	response.Data = newPaymentRequestResponse(&request, _uid)
+	json.NewEncoder(w).Encode(&response)
+}
+
+// ListPaymentRequestsHandler lists the requests the caller made, or with
+// ?direction=incoming the ones addressed to the caller.
+func (c *Controller) ListPaymentRequestsHandler(w http.ResponseWriter, r *http.Request) {
+	var response dto.ResponseModel
+	response.ID = uuid.New()
+	response.Timestamp = time.Now().UTC()
+	w.Header().Add("Content-Type", "application/json")
+
+	_uid, _ := r.Context().Value(middleware.USERID).(string)
+	query := r.URL.Query()
+	column := "requester_id"
+	switch query.Get("direction") {
+	case "", "outgoing":
+	case "incoming":
+		column = "payer_id"
+	default:
+		detail := "direction must be incoming or outgoing"
+		w.WriteHeader(http.StatusBadRequest)
+		response.Data = dto.ErrorModel{Message: "invalid request", Details: []*string{&detail}}
+		json.NewEncoder(w).Encode(&response)
+		return
+	}
+	limit, offset := parsePagination(r)
+
+	var requests []models.PaymentRequest
+	db := c.DB.Where(column+" = ?", _uid)
+	if status := query.Get("status"); status != "" {
+		db = db.Where("status = ?", strings.ToUpper(status))
+	}
+	if err := db.Order("created_at DESC").Limit(limit).Offset(offset).Find(&requests).Error; err != nil {
+		detail := err.Error()
+		w.WriteHeader(http.StatusInternalServerError)
+		response.Data = dto.ErrorModel{Message: "an error occured", Details: []*string{&detail}}
+		json.NewEncoder(w).Encode(&response)
+		return
+	}
+
+	data := make([]PaymentRequestResponseModel, 0, len(requests))
+	for i := range requests {
+		data = append(data, newPaymentRequestResponse(&requests[i], _uid))
+	}
+	response.Data = data
+	json.NewEncoder(w).Encode(&response)
+}
+
+func (c *Controller) GetPayLinkHandler(w http.ResponseWriter, r *http.Request) {
+	var response dto.ResponseModel
+	response.ID = uuid.New()
+	response.Timestamp = time.Now().UTC()
+	w.Header().Add("Content-Type", "application/json")
+
+	_uid, _ := r.Context().Value(middleware.USERID).(string)
+	var request models.PaymentRequest
+	tx := c.DB.Where("link_token = ?", r.PathValue("token")).Limit(1).Find(&request)
+	if tx.Error != nil {
+		detail := tx.Error.Error()
+		w.WriteHeader(http.StatusInternalServerError)
+		response.Data = dto.ErrorModel{Message: "an error occured", Details: []*string{&detail}}
+		json.NewEncoder(w).Encode(&response)
+		return
+	}
+	if tx.RowsAffected == 0 || (request.PayerID != nil && request.PayerID.String() != _uid && request.RequesterID.String() != _uid) {
+		w.WriteHeader(http.StatusNotFound)
+		response.Data = dto.ErrorModel{Message: "pay link not found"}
+		json.NewEncoder(w).Encode(&response)
+		return
+	}
+
+	response.Data = newPaymentRequestResponse(&request, _uid)
+	json.NewEncoder(w).Encode(&response)
+}
+
+func (c *Controller) PayPaymentRequestHandler(w http.ResponseWriter, r *http.Request) {
+	c.payPaymentRequest(w, r, "id")
+}
+
+func (c *Controller) PayLinkHandler(w http.ResponseWriter, r *http.Request) {
+	c.payPaymentRequest(w, r, "link_token")
+}
+
+// payPaymentRequest fulfils the request found by column, the request id or
+// the link token. A request without a named payer is only paid by whoever
+// holds its link, by id it needs the link token in the body too. The row is
+// locked and must still be pending, so a request is paid at most once however
+// often the link is used.
+func (c *Controller) payPaymentRequest(w http.ResponseWriter, r *http.Request, column string) {
+	var response dto.ResponseModel
+	response.ID = uuid.New()
+	response.Timestamp = time.Now().UTC()
+	w.Header().Add("Content-Type", "application/json")
+
+	_uid, _ := r.Context().Value(middleware.USERID).(string)
+	userId, err := uuid.Parse(_uid)
+	if err != nil {
+		detail := err.Error()
+		w.WriteHeader(http.StatusUnauthorized)
+		response.Data = dto.ErrorModel{Message: "invalid token payload", Details: []*string{&detail}}
+		json.NewEncoder(w).Encode(&response)
+		return
+	}
+	key := r.PathValue("token")
+	if column == "id" {
+		requestId, err := uuid.Parse(r.PathValue("requestId"))
+		if err != nil {
+			detail := err.Error()
+			w.WriteHeader(http.StatusBadRequest)
+			response.Data = dto.ErrorModel{Message: "invalid id", Details: []*string{&detail}}
+			json.NewEncoder(w).Encode(&response)
+			return
+		}
+		key = requestId.String()
+	}
+
+	type RequestModel struct {
+		AccountId uuid.UUID `json:"accountId"`
+		Pin       string    `json:"pin"`
+		// LinkToken is required to accept an open request by id
+		LinkToken string `json:"linkToken"`
+	}
+	var payload RequestModel
+	if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+		detail := err.Error()
+		w.WriteHeader(http.StatusBadRequest)
+		response.Data = dto.ErrorModel{Message: "invalid request body", Details: []*string{&detail}}
+		json.NewEncoder(w).Encode(&response)
+		return
+	}
+
+	var owner uuid.UUID
+	tx := c.DB.Raw(`SELECT user_id FROM accounts WHERE id = ? AND deleted_at IS NULL`, payload.AccountId.String()).Scan(&owner)
+	if tx.RowsAffected == 0 {
+		detail := fmt.Sprintf("account with id: %s not exist", payload.AccountId.String())
+		w.WriteHeader(http.StatusNotFound)
+		response.Data = dto.ErrorModel{Message: "account not found", Details: []*string{&detail}}
+		json.NewEncoder(w).Encode(&response)
+		return
+	}
+	if tx.Error != nil {
+		detail := tx.Error.Error()
+		w.WriteHeader(http.StatusInternalServerError)
+		response.Data = dto.ErrorModel{Message: "an error occured", Details: []*string{&detail}}
+		json.NewEncoder(w).Encode(&response)
+		return
+	}
+	if owner != userId {
+		detail := "This account does not belong to the user"
+		w.WriteHeader(http.StatusForbidden)
+		response.Data = dto.ErrorModel{Message: "forbidden", Details: []*string{&detail}}
+		json.NewEncoder(w).Encode(&response)
+		return
+	}
+
+	if err := c.verifyPin(userId, payload.Pin); err != nil {
+		status := http.StatusForbidden
+		if !errors.Is(err, errPin) {
+			status = http.StatusInternalServerError
+		}
+		detail := err.Error()
+		w.WriteHeader(status)
+		response.Data = dto.ErrorModel{Message: "pin verification failed", Details: []*string{&detail}}
+		json.NewEncoder(w).Encode(&response)
+		return
+	}
+
+	var request models.PaymentRequest
+	var balance int64
+	err = c.DB.Transaction(func(tx *gorm.DB) error {
+		res := tx.Raw(`SELECT * FROM payment_requests WHERE `+column+` = ? FOR UPDATE`, key).Scan(&request)
+		if res.Error != nil {
+			return res.Error
+		}
+		if res.RowsAffected == 0 {
+			return gorm.ErrRecordNotFound
+		}
+		if request.PayerID != nil && *request.PayerID != userId {
+			return errForbidden
+		}
+		if request.PayerID == nil && column == "id" &&
+			subtle.ConstantTimeCompare([]byte(payload.LinkToken), []byte(request.LinkToken)) != 1 {
+			return errForbidden
+		}
+		if request.Status != models.PaymentRequestPending || !request.ExpiresAt.After(time.Now()) {
+			return errPaymentRequestClosed
+		}
+
+		outDesc := "Payment request"
+		if request.Note != nil {
+			outDesc = fmt.Sprintf("Payment request: %s", *request.Note)
+		}
+		inDesc := outDesc
+		debit := models.Transactions{Type: "TRANSFER_OUT", Description: &outDesc}
+		credit := models.Transactions{Type: "TRANSFER_IN", Description: &inDesc}
+		var err error
+		balance, err = ledger.Transfer(tx, payload.AccountId, request.AccountID, request.Amount, &debit, &credit)
+		if err != nil {
+			return err
+		}
+
+		now := time.Now()
+		request.Status = models.PaymentRequestPaid
+		request.PayerAccountID = &payload.AccountId
+		request.TransactionID = &debit.ID
+		request.PaidAt = &now
+		err = tx.Model(&request).Select("status", "payer_account_id", "transaction_id", "paid_at", "updated_at").
+			Updates(&request).Error
+		if err != nil {
+			return err
+		}
+
+		event := newAuditEvent(r, response.ID, "payment_request.pay", "payment_request", request.ID.String())
+		event.SetChanges(
+			map[string]any{"status": models.PaymentRequestPending},
+			map[string]any{"status": request.Status, "accountId": payload.AccountId, "amount": request.Amount},
+		)
+		return tx.Create(&event).Error
+	})
+	if errors.Is(err, gorm.ErrRecordNotFound) || errors.Is(err, errForbidden) {
+		// a request addressed to someone else is not revealed
+		w.WriteHeader(http.StatusNotFound)
+		response.Data = dto.ErrorModel{Message: "payment request not found"}
+		json.NewEncoder(w).Encode(&response)
+		return
+	}
+	if errors.Is(err, errPaymentRequestClosed) {
+		detail := fmt.Sprintf("payment request is %s", strings.ToLower(newPaymentRequestResponse(&request, _uid).Status))
+		w.WriteHeader(http.StatusConflict)
+		response.Data = dto.ErrorModel{Message: err.Error(), Details: []*string{&detail}}
+		json.NewEncoder(w).Encode(&response)
+		return
+	}
+	if errors.Is(err, ledger.ErrSameAccount) {
+		detail := "the paying account is the one receiving the money"
+		w.WriteHeader(http.StatusBadRequest)
+		response.Data = dto.ErrorModel{Message: "invalid request body", Details: []*string{&detail}}
+		json.NewEncoder(w).Encode(&response)
+		return
+	}
+	if errors.Is(err, ledger.ErrInsufficientBalance) {
+		c.transferFailed(payload.AccountId, "TRANSFER_OUT", request.Amount, err.Error(), nil, nil)
+		w.WriteHeader(http.StatusBadRequest)
+		response.Data = dto.ErrorModel{Message: "insufficient balance"}
+		json.NewEncoder(w).Encode(&response)
+		return
+	}
+	if models.IsRestricted(err) {
+		c.transferFailed(payload.AccountId, "TRANSFER_OUT", request.Amount, err.Error(), nil, nil)
+		detail := err.Error()
+		w.WriteHeader(http.StatusForbidden)
+		response.Data = dto.ErrorModel{Message: "account restricted", Details: []*string{&detail}}
+		json.NewEncoder(w).Encode(&response)
+		return
+	}
+	if err != nil {
+		detail := err.Error()
+		w.WriteHeader(http.StatusInternalServerError)
+		response.Data = dto.ErrorModel{Message: "payment failed", Details: []*string{&detail}}
+		json.NewEncoder(w).Encode(&response)
+		return
+	}
+
+	data := newPaymentRequestResponse(&request, _uid)
+	data.FinalBalance = &balance
+	response.Data = data
+	json.NewEncoder(w).Encode(&response)
+}
+
+func (c *Controller) DeclinePaymentRequestHandler(w http.ResponseWriter, r *http.Request) {
+	c.closePaymentRequest(w, r, models.PaymentRequestDeclined)
+}
+
+func (c *Controller) CancelPaymentRequestHandler(w http.ResponseWriter, r *http.Request) {
+	c.closePaymentRequest(w, r, models.PaymentRequestCancelled)
+}
+
+// closePaymentRequest lets the named payer decline and the requester cancel
+// a pending request.
+func (c *Controller) closePaymentRequest(w http.ResponseWriter, r *http.Request, to string) {
+	var response dto.ResponseModel
+	response.ID = uuid.New()
+	response.Timestamp = time.Now().UTC()
+	w.Header().Add("Content-Type", "application/json")
+
+	_uid, _ := r.Context().Value(middleware.USERID).(string)
+	requestId, err := uuid.Parse(r.PathValue("requestId"))
+	if err != nil {
+		detail := err.Error()
+		w.WriteHeader(http.StatusBadRequest)
+		response.Data = dto.ErrorModel{Message: "invalid id", Details: []*string{&detail}}
+		json.NewEncoder(w).Encode(&response)
+		return
+	}
+
+	var request models.PaymentRequest
+	err = c.DB.Transaction(func(tx *gorm.DB) error {
+		res := tx.Raw(`SELECT * FROM payment_requests WHERE id = ? FOR UPDATE`, requestId.String()).Scan(&request)
+		if res.Error != nil {
+			return res.Error
+		}
+		if res.RowsAffected == 0 {
+			return gorm.ErrRecordNotFound
+		}
+		allowed := request.RequesterID.String() == _uid
+		if to == models.PaymentRequestDeclined {
+			allowed = request.PayerID != nil && request.PayerID.String() == _uid
+		}
+		if !allowed {
+			return errForbidden
+		}
+		if request.Status != models.PaymentRequestPending {
+			return errPaymentRequestClosed
+		}
+
+		request.Status = to
+		if err := tx.Model(&request).Select("status", "updated_at").Updates(&request).Error; err != nil {
+			return err
+		}
+		event := newAuditEvent(r, response.ID, "payment_request.status", "payment_request", request.ID.String())
+		event.SetChanges(map[string]any{"status": models.PaymentRequestPending}, map[string]any{"status": to})
+		return tx.Create(&event).Error
+	})
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		detail := fmt.Sprintf("payment request with id: %s not exist", requestId.String())
+		w.WriteHeader(http.StatusNotFound)
+		response.Data = dto.ErrorModel{Message: "payment request not found", Details: []*string{&detail}}
+		json.NewEncoder(w).Encode(&response)
+		return
+	}
+	if errors.Is(err, errForbidden) {
+		detail := "only the requester can cancel and only the named payer can decline"
+		w.WriteHeader(http.StatusForbidden)
+		response.Data = dto.ErrorModel{Message: "forbidden", Details: []*string{&detail}}
+		json.NewEncoder(w).Encode(&response)
+		return
+	}
+	if errors.Is(err, errPaymentRequestClosed) {
+		detail := fmt.Sprintf("payment request is %s", strings.ToLower(request.Status))
+		w.WriteHeader(http.StatusConflict)
+		response.Data = dto.ErrorModel{Message: err.Error(), Details: []*string{&detail}}
+		json.NewEncoder(w).Encode(&response)
+		return
+	}
+	if err != nil {
+		detail := err.Error()
+		w.WriteHeader(http.StatusInternalServerError)
+		response.Data = dto.ErrorModel{Message: "failed to update payment request", Details: []*string{&detail}}
+		json.NewEncoder(w).Encode(&response)
+		return
+	}
+
+	response.Data = newPaymentRequestResponse(&request, _uid)
+	json.NewEncoder(w).Encode(&response)
+}
@@ -0,0 +1,505 @@
+package controller
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/eclipseron/digital-wallet-app/dto"
+	"github.com/eclipseron/digital-wallet-app/ledger"
+	"github.com/eclipseron/digital-wallet-app/middleware"
+	"github.com/eclipseron/digital-wallet-app/models"
+	"github.com/eclipseron/digital-wallet-app/payout"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+type PayoutBatchResponseModel struct {
+	BatchId    uuid.UUID  `json:"batchId"`
+	AccountId  uuid.UUID  `json:"accountId"`
+	FileName   *string    `json:"fileName"`
+	Status     string     `json:"status"`
+	Items      int        `json:"items"`
+	Total      int64      `json:"total"`
+	Fees       int64      `json:"fees"`
+	GrandTotal int64      `json:"grandTotal"`
+	Succeeded  int        `json:"succeeded"`
+	Failed     int        `json:"failed"`
+	PaidAmount int64      `json:"paidAmount"`
+	HoldId     *uuid.UUID `json:"holdId"`
+	// Available and SufficientFunds are only set on a preview
+	Available       *int64     `json:"available,omitempty"`
+	SufficientFunds *bool      `json:"sufficientFunds,omitempty"`
+	ExpiresAt       time.Time  `json:"expiresAt"`
+	ExecutedAt      *time.Time `json:"executedAt"`
+	CompletedAt     *time.Time `json:"completedAt"`
+	CreatedAt       time.Time  `json:"createdAt"`
+}
+
+func newPayoutBatchResponse(b *models.PayoutBatch) PayoutBatchResponseModel {
+	res := PayoutBatchResponseModel{
+		BatchId:    b.ID,
+		AccountId:  b.AccountID,
+		FileName:   b.FileName,
+		Status:     b.Status,
+		Items:      b.Items,
+		Total:      b.Total,
+		Fees:       b.Fees,
+		GrandTotal: b.Total + b.Fees,
+		Succeeded:  b.Succeeded,
+		Failed:     b.Failed,
+		PaidAmount: b.PaidAmount,
+		HoldId:     b.HoldID,
+		ExpiresAt:  b.ExpiresAt.UTC(),
+		CreatedAt:  b.CreatedAt.UTC(),
+	}
+	if b.ExecutedAt != nil {
+		at := b.ExecutedAt.UTC()
+		res.ExecutedAt = &at
+	}
+	if b.CompletedAt != nil {
+		at := b.CompletedAt.UTC()
+		res.CompletedAt = &at
+	}
+	return res
+}
+
+type PayoutItemResponseModel struct {
+	ItemId        uuid.UUID  `json:"itemId"`
+	Line          int        `json:"line"`
+	Bank          string     `json:"bank"`
+	AccountNumber string     `json:"accountNumber"`
+	AccountName   string     `json:"accountName"`
+	Amount        int64      `json:"amount"`
+	Fee           int64      `json:"fee"`
+	Reference     *string    `json:"reference"`
+	Status        string     `json:"status"`
+	FailureReason *string    `json:"failureReason"`
+	TransactionId *uuid.UUID `json:"transactionId"`
+	ProcessedAt   *time.Time `json:"processedAt"`
+}
+
+func newPayoutItemResponse(i *models.PayoutItem) PayoutItemResponseModel {
+	res := PayoutItemResponseModel{
+		ItemId:        i.ID,
+		Line:          i.Line,
+		Bank:          i.BankCode,
+		AccountNumber: i.AccountNumber,
+		AccountName:   i.AccountName,
+		Amount:        i.Amount,
+		Fee:           i.Fee,
+		Reference:     i.Reference,
+		Status:        i.Status,
+		FailureReason: i.FailureReason,
+		TransactionId: i.TransactionID,
+	}
+	if i.ProcessedAt != nil {
+		at := i.ProcessedAt.UTC()
+		res.ProcessedAt = &at
+	}
+	return res
+}
+
+// withPreviewFunds adds the available balance of the source account to the
+// response of a preview, so the caller sees whether executing it can succeed.
+func (c *Controller) withPreviewFunds(res *PayoutBatchResponseModel) error {
+	if res.Status != models.PayoutBatchStatusPreview {
+		return nil
+	}
+	var available int64
+	err := c.DB.Raw(`
+	SELECT balance - held_balance - pocket_balance FROM accounts WHERE id = ?
+	`, res.AccountId.String()).Scan(&available).Error
+	if err != nil {
+		return err
+	}
+	sufficient := available >= res.GrandTotal
+	res.Available = &available
+	res.SufficientFunds = &sufficient
+	return nil
+}
+
+// payoutBatch writes the error response and returns false when the batch in
+// the path does not belong to accountId.
+func (c *Controller) payoutBatch(w http.ResponseWriter, r *http.Request, response *dto.ResponseModel, accountId uuid.UUID) (*models.PayoutBatch, bool) {
+	batchId, err := uuid.Parse(r.PathValue("batchId"))
+	if err != nil {
+		detail := err.Error()
+		w.WriteHeader(http.StatusBadRequest)
+		response.Data = dto.ErrorModel{Message: "invalid id", Details: []*string{&detail}}
+		json.NewEncoder(w).Encode(response)
+		return nil, false
+	}
+	var batch models.PayoutBatch
+	res := c.DB.Where("id = ? AND account_id = ?", batchId.String(), accountId.String()).Limit(1).Find(&batch)
+	if res.Error != nil {
+		detail := res.Error.Error()
+		w.WriteHeader(http.StatusInternalServerError)
+		response.Data = dto.ErrorModel{Message: "an error occured", Details: []*string{&detail}}
+		json.NewEncoder(w).Encode(response)
+		return nil, false
+	}
+	if res.RowsAffected == 0 {
+		detail := fmt.Sprintf("payout batch with id: %s not exist", batchId.String())
+		w.WriteHeader(http.StatusNotFound)
+		response.Data = dto.ErrorModel{Message: "payout batch not found", Details: []*string{&detail}}
+		json.NewEncoder(w).Encode(response)
+		return nil, false
+	}
+	return &batch, true
+}
+
+// CreatePayoutBatchHandler validates an uploaded payout file and stores it as
+// a preview with its total and fees. The file is a multipart "file" field or
+// the text/csv request body. Nothing is stored when any row is refused, every
+// refused row is listed instead.
+func (c *Controller) CreatePayoutBatchHandler(w http.ResponseWriter, r *http.Request) {
+	var response dto.ResponseModel
+	response.ID = uuid.New()
+	response.Timestamp = time.Now().UTC()
+	w.Header().Add("Content-Type", "application/json")
+
+	accountId, ok := c.ownedAccount(w, r, &response)
+	if !ok {
+		return
+	}
+
+	r.Body = http.MaxBytesReader(w, r.Body, payout.MaxFileSize+64<<10)
+	var file io.Reader = r.Body
+	var fileName string
+	mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if mediaType == "multipart/form-data" {
+		f, header, err := r.FormFile("file")
+		if err != nil {
+			detail := err.Error()
+			w.WriteHeader(http.StatusBadRequest)
+			response.Data = dto.ErrorModel{Message: "invalid request body", Details: []*string{&detail}}
+			json.NewEncoder(w).Encode(&response)
+			return
+		}
+		defer f.Close()
+		file, fileName = f, header.Filename
+		if len(fileName) > 255 {
+			fileName = fileName[:255]
+		}
+	}
+
+	data, err := io.ReadAll(io.LimitReader(file, payout.MaxFileSize+1))
+	if err == nil && len(data) > payout.MaxFileSize {
+		err = fmt.Errorf("%w: a file is at most %d bytes", payout.ErrFile, payout.MaxFileSize)
+	}
+	if err != nil {
+		detail := err.Error()
+		w.WriteHeader(http.StatusBadRequest)
+		response.Data = dto.ErrorModel{Message: "invalid payout file", Details: []*string{&detail}}
+		json.NewEncoder(w).Encode(&response)
+		return
+	}
+	rows, rowErrors, err := payout.Parse(bytes.NewReader(data), payout.ChargesFees())
+	if err != nil {
+		detail := err.Error()
+		w.WriteHeader(http.StatusBadRequest)
+		response.Data = dto.ErrorModel{Message: "invalid payout file", Details: []*string{&detail}}
+		json.NewEncoder(w).Encode(&response)
+		return
+	}
+	if len(rowErrors) > 0 {
+		details := make([]*string, 0, len(rowErrors))
+		for _, rowError := range rowErrors {
+			detail := rowError.Error()
+			details = append(details, &detail)
+		}
+		w.WriteHeader(http.StatusBadRequest)
+		response.Data = dto.ErrorModel{Message: "invalid payout file", Details: details}
+		json.NewEncoder(w).Encode(&response)
+		return
+	}
+
+	_uid, _ := r.Context().Value(middleware.USERID).(string)
+	userId, _ := uuid.Parse(_uid)
+	var batch *models.PayoutBatch
+	err = c.DB.Transaction(func(tx *gorm.DB) error {
+		var err error
+		batch, err = payout.Create(tx, accountId, userId, fileName, rows)
+		return err
+	})
+	if err != nil {
+		detail := err.Error()
+		w.WriteHeader(http.StatusInternalServerError)
+		response.Data = dto.ErrorModel{Message: "failed to create payout batch", Details: []*string{&detail}}
+		json.NewEncoder(w).Encode(&response)
+		return
+	}
+
+	res := newPayoutBatchResponse(batch)
+	if err := c.withPreviewFunds(&res); err != nil {
+		detail := err.Error()
+		w.WriteHeader(http.StatusInternalServerError)
+		response.Data = dto.ErrorModel{Message: "an error occured", Details: []*string{&detail}}
+		json.NewEncoder(w).Encode(&response)
+		return
+	}
+	w.WriteHeader(http.StatusCreated)
+	response.Data = res
+	json.NewEncoder(w).Encode(&response)
+}
+
+// ListPayoutBatchesHandler lists the payout batches of an owned account, the
+// newest first, optionally of one ?status=.
+func (c *Controller) ListPayoutBatchesHandler(w http.ResponseWriter, r *http.Request) {
+	var response dto.ResponseModel
+	response.ID = uuid.New()
+	response.Timestamp = time.Now().UTC()
+	w.Header().Add("Content-Type", "application/json")
+
+	accountId, ok := c.ownedAccount(w, r, &response)
+	if !ok {
+		return
+	}
+	limit, offset := parsePagination(r)
+
+	query := c.DB.Where("account_id = ?", accountId.String())
+	if status := strings.ToUpper(r.URL.Query().Get("status")); status != "" {
+		query = query.Where("status = ?", status)
+	}
+	var batches []models.PayoutBatch
+	if err := query.Order("created_at DESC").Limit(limit).Offset(offset).Find(&batches).Error; err != nil {
+		detail := err.Error()
+		w.WriteHeader(http.StatusInternalServerError)
+		response.Data = dto.ErrorModel{Message: "an error occured", Details: []*string{&detail}}
+		json.NewEncoder(w).Encode(&response)
+		return
+	}
+
+	data := make([]PayoutBatchResponseModel, 0, len(batches))
+	for i := range batches {
+		data = append(data, newPayoutBatchResponse(&batches[i]))
+	}
+	response.Data = data
+	json.NewEncoder(w).Encode(&response)
+}
+
+// GetPayoutBatchHandler returns a payout batch with its progress, a preview
+// also shows whether the account can cover it.
+func (c *Controller) GetPayoutBatchHandler(w http.ResponseWriter, r *http.Request) {
+	var response dto.ResponseModel
+	response.ID = uuid.New()
+	response.Timestamp = time.Now().UTC()
+	w.Header().Add("Content-Type", "application/json")
+
+	accountId, ok := c.ownedAccount(w, r, &response)
+	if !ok {
+		return
+	}
+	batch, ok := c.payoutBatch(w, r, &response, accountId)
+	if !ok {
+		return
+	}
+
+	res := newPayoutBatchResponse(batch)
+	if err := c.withPreviewFunds(&res); err != nil {
+		detail := err.Error()
+		w.WriteHeader(http.StatusInternalServerError)
+		response.Data = dto.ErrorModel{Message: "an error occured", Details: []*string{&detail}}
+		json.NewEncoder(w).Encode(&response)
+		return
+	}
+	response.Data = res
+	json.NewEncoder(w).Encode(&response)
+}
+
+// ListPayoutItemsHandler lists the rows of a payout batch in file order with
+// their status, optionally of one ?status=.
+func (c *Controller) ListPayoutItemsHandler(w http.ResponseWriter, r *http.Request) {
+	var response dto.ResponseModel
+	response.ID = uuid.New()
+	response.Timestamp = time.Now().UTC()
+	w.Header().Add("Content-Type", "application/json")
+
+	accountId, ok := c.ownedAccount(w, r, &response)
+	if !ok {
+		return
+	}
+	batch, ok := c.payoutBatch(w, r, &response, accountId)
+	if !ok {
+		return
+	}
+	limit, offset := parsePagination(r)
+
+	query := c.DB.Where("batch_id = ?", batch.ID.String())
+	if status := strings.ToUpper(r.URL.Query().Get("status")); status != "" {
+		query = query.Where("status = ?", status)
+	}
+	var items []models.PayoutItem
+	if err := query.Order("line").Limit(limit).Offset(offset).Find(&items).Error; err != nil {
+		detail := err.Error()
+		w.WriteHeader(http.StatusInternalServerError)
+		response.Data = dto.ErrorModel{Message: "an error occured", Details: []*string{&detail}}
+		json.NewEncoder(w).Encode(&response)
+		return
+	}
+
+	data := make([]PayoutItemResponseModel, 0, len(items))
+	for i := range items {
+		data = append(data, newPayoutItemResponse(&items[i]))
+	}
+	response.Data = data
+	json.NewEncoder(w).Encode(&response)
+}
+
+// ExecutePayoutBatchHandler executes a preview with the PIN. The grand total
+// is held on the account at once and the rows are paid in the background.
+func (c *Controller) ExecutePayoutBatchHandler(w http.ResponseWriter, r *http.Request) {
+	var response dto.ResponseModel
+	response.ID = uuid.New()
+	response.Timestamp = time.Now().UTC()
+	w.Header().Add("Content-Type", "application/json")
+
+	accountId, ok := c.ownedAccount(w, r, &response)
+	if !ok {
+		return
+	}
+	batchId, err := uuid.Parse(r.PathValue("batchId"))
+	if err != nil {
+		detail := err.Error()
+		w.WriteHeader(http.StatusBadRequest)
+		response.Data = dto.ErrorModel{Message: "invalid id", Details: []*string{&detail}}
+		json.NewEncoder(w).Encode(&response)
+		return
+	}
+
+	type RequestModel struct {
+		Pin string `json:"pin"`
+	}
+	var payload RequestModel
+	if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+		detail := err.Error()
+		w.WriteHeader(http.StatusBadRequest)
+		response.Data = dto.ErrorModel{Message: "invalid request body", Details: []*string{&detail}}
+		json.NewEncoder(w).Encode(&response)
+		return
+	}
+
+	_uid, _ := r.Context().Value(middleware.USERID).(string)
+	userId, _ := uuid.Parse(_uid)
+	if err := c.verifyPin(userId, payload.Pin); err != nil {
+		status := http.StatusForbidden
+		if !errors.Is(err, errPin) {
+			status = http.StatusInternalServerError
+		}
+		detail := err.Error()
+		w.WriteHeader(status)
+		response.Data = dto.ErrorModel{Message: "pin verification failed", Details: []*string{&detail}}
+		json.NewEncoder(w).Encode(&response)
+		return
+	}
+
+	var batch *models.PayoutBatch
+	err = c.DB.Transaction(func(tx *gorm.DB) error {
+		var err error
+		batch, err = payout.Execute(tx, accountId, batchId)
+		if err != nil {
+			return err
+		}
+		event := newAuditEvent(r, response.ID, "payout.execute", "payout_batch", batch.ID.String())
+		event.SetChanges(
+			map[string]any{"status": models.PayoutBatchStatusPreview},
+			map[string]any{
+				"status": batch.Status, "items": batch.Items, "total": batch.Total, "fees": batch.Fees,
+				"holdId": batch.HoldID,
+			},
+		)
+		return tx.Create(&event).Error
+	})
+	if errors.Is(err, payout.ErrBatchNotFound) {
+		detail := fmt.Sprintf("payout batch with id: %s not exist", batchId.String())
+		w.WriteHeader(http.StatusNotFound)
+		response.Data = dto.ErrorModel{Message: "payout batch not found", Details: []*string{&detail}}
+		json.NewEncoder(w).Encode(&response)
+		return
+	}
+	if errors.Is(err, payout.ErrNotPreview) {
+		detail := fmt.Sprintf("payout batch is %s", strings.ToLower(batch.Status))
+		w.WriteHeader(http.StatusConflict)
+		response.Data = dto.ErrorModel{Message: "payout batch can not be executed", Details: []*string{&detail}}
+		json.NewEncoder(w).Encode(&response)
+		return
+	}
+	if errors.Is(err, payout.ErrPreviewExpired) {
+		detail := err.Error()
+		w.WriteHeader(http.StatusGone)
+		response.Data = dto.ErrorModel{Message: "payout batch can not be executed", Details: []*string{&detail}}
+		json.NewEncoder(w).Encode(&response)
+		return
+	}
+	if errors.Is(err, ledger.ErrInsufficientBalance) {
+		c.transferFailed(accountId, "TRANSFER_OUT", batch.Total+batch.Fees, err.Error(), nil, nil)
+		w.WriteHeader(http.StatusBadRequest)
+		response.Data = dto.ErrorModel{Message: "insufficient balance"}
+		json.NewEncoder(w).Encode(&response)
+		return
+	}
+	if models.IsRestricted(err) {
+		detail := err.Error()
+		c.transferFailed(accountId, "TRANSFER_OUT", batch.Total+batch.Fees, detail, nil, nil)
+		w.WriteHeader(http.StatusForbidden)
+		response.Data = dto.ErrorModel{Message: "account restricted", Details: []*string{&detail}}
+		json.NewEncoder(w).Encode(&response)
+		return
+	}
+	if err != nil {
+		detail := err.Error()
+		w.WriteHeader(http.StatusInternalServerError)
+		response.Data = dto.ErrorModel{Message: "failed to execute payout batch", Details: []*string{&detail}}
+		json.NewEncoder(w).Encode(&response)
+		return
+	}
+
+	w.WriteHeader(http.StatusAccepted)
+	response.Data = newPayoutBatchResponse(batch)
+	json.NewEncoder(w).Encode(&response)
+}
+
+// GetPayoutResultHandler downloads the outcome of every row of a completed
+// batch as CSV.
+func (c *Controller) GetPayoutResultHandler(w http.ResponseWriter, r *http.Request) {
+	var response dto.ResponseModel
+	response.ID = uuid.New()
+	response.Timestamp = time.Now().UTC()
+	w.Header().Add("Content-Type", "application/json")
+
+	accountId, ok := c.ownedAccount(w, r, &response)
+	if !ok {
+		return
+	}
+	batch, ok := c.payoutBatch(w, r, &response, accountId)
+	if !ok {
+		return
+	}
+	if batch.Status != models.PayoutBatchStatusCompleted {
+		detail := payout.ErrNotCompleted.Error()
+		w.WriteHeader(http.StatusConflict)
+		response.Data = dto.ErrorModel{Message: "payout result not available", Details: []*string{&detail}}
+		json.NewEncoder(w).Encode(&response)
+		return
+	}
+
+	var items []models.PayoutItem
+	if err := c.DB.Where("batch_id = ?", batch.ID.String()).Order("line").Find(&items).Error; err != nil {
+		detail := err.Error()
+		w.WriteHeader(http.StatusInternalServerError)
+		response.Data = dto.ErrorModel{Message: "an error occured", Details: []*string{&detail}}
+		json.NewEncoder(w).Encode(&response)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/csv")
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", "payout_"+batch.ID.String()+"_result.csv"))
+	payout.WriteResult(w, items)
+}
@@ -0,0 +1,172 @@
+package controller
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"regexp"
+	"time"
+
+	"github.com/eclipseron/digital-wallet-app/dto"
+	"github.com/eclipseron/digital-wallet-app/middleware"
+	"github.com/eclipseron/digital-wallet-app/models"
+	"github.com/eclipseron/digital-wallet-app/utils"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+const (
+	maxPinFailures = 5
+	pinLockout     = 15 * time.Minute
+)
+
+var (
+	// errPin is wrapped by every PIN rejection so handlers can answer 403
+	errPin         = errors.New("pin rejected")
+	errPinRequired = fmt.Errorf("%w: pin is required", errPin)
+	errPinInvalid  = fmt.Errorf("%w: invalid pin", errPin)
+	errPinLocked   = fmt.Errorf("%w: too many invalid attempts, try again later", errPin)
+
+	pinPattern = regexp.MustCompile(`^[0-9]{6}$`)
+)
+
+// verifyPin checks the user's transaction PIN when one is set. Failures are
+// committed on their own so a rolled back payment still counts them, the
+// PIN locks for 15 minutes after 5 failures in a row.
+func (c *Controller) verifyPin(userID uuid.UUID, pin string) error {
+	var result error
+	err := c.DB.Transaction(func(tx *gorm.DB) error {
+		var user models.User
+		res := tx.Raw(`SELECT * FROM users WHERE id = ? FOR UPDATE`, userID.String()).Scan(&user)
+		if res.Error != nil {
+			return res.Error
+		}
+		if res.RowsAffected == 0 || user.PinHash == nil {
+			return nil
+		}
+
+		now := time.Now()
+		if user.PinLockedUntil != nil && user.PinLockedUntil.After(now) {
+			result = errPinLocked
+			return nil
+		}
+		if pin == "" {
+			result = errPinRequired
+			return nil
+		}
+		if utils.IsValid(*user.PinHash, pin) {
+			if user.PinFailures == 0 {
+				return nil
+			}
+			return tx.Exec(`UPDATE users SET pin_failures = 0 WHERE id = ?`, userID.String()).Error
+		}
+
+		result = errPinInvalid
+		failures := user.PinFailures + 1
+		var lockedUntil *time.Time
+		if failures >= maxPinFailures {
+			until := now.Add(pinLockout)
+			lockedUntil = &until
+			failures = 0
+			result = errPinLocked
+		}
+		return tx.Exec(`
+		UPDATE users SET pin_failures = ?, pin_locked_until = ? WHERE id = ?
+		`, failures, lockedUntil, userID.String()).Error
+	})
+	if err != nil {
+		return err
+	}
+	return result
+}
+
+func (c *Controller) SetPinHandler(w http.ResponseWriter, r *http.Request) {
+	var response dto.ResponseModel
+	response.ID = uuid.New()
+	response.Timestamp = time.Now().UTC()
+	w.Header().Add("Content-Type", "application/json")
+
+	_uid, _ := r.Context().Value(middleware.USERID).(string)
+	userId, err := uuid.Parse(_uid)
+	if err != nil {
+		detail := err.Error()
+		w.WriteHeader(http.StatusUnauthorized)
+		response.Data = dto.ErrorModel{Message: "invalid token payload", Details: []*string{&detail}}
+		json.NewEncoder(w).Encode(&response)
+		return
+	}
+
+	type RequestModel struct {
+		Password string `json:"password"`
+		Pin      string `json:"pin"`
+	}
+	var payload RequestModel
+	if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+		detail := err.Error()
+		w.WriteHeader(http.StatusBadRequest)
+		response.Data = dto.ErrorModel{Message: "invalid request body", Details: []*string{&detail}}
+		json.NewEncoder(w).Encode(&response)
+		return
+	}
+	if !pinPattern.MatchString(payload.Pin) {
+		detail := "pin must be 6 digits"
+		w.WriteHeader(http.StatusBadRequest)
+		response.Data = dto.ErrorModel{Message: "invalid request body", Details: []*string{&detail}}
+		json.NewEncoder(w).Encode(&response)
+		return
+	}
+
+	var password string
+	tx := c.DB.Raw(`SELECT password FROM users WHERE id = ? AND deleted_at IS NULL`, userId.String()).Scan(&password)
+	if tx.Error != nil {
+		detail := tx.Error.Error()
+		w.WriteHeader(http.StatusInternalServerError)
+		response.Data = dto.ErrorModel{Message: "an error occured", Details: []*string{&detail}}
+		json.NewEncoder(w).Encode(&response)
+		return
+	}
+	if tx.RowsAffected == 0 || !utils.IsValid(password, payload.Password) {
+		event := newAuditEvent(r, response.ID, "user.pin.set", "user", userId.String())
+		event.Outcome = models.AuditOutcomeFailure
+		c.recordAudit(event)
+
+		w.WriteHeader(http.StatusUnauthorized)
+		response.Data = dto.ErrorModel{Message: "invalid password"}
+		json.NewEncoder(w).Encode(&response)
+		return
+	}
+
+	hash, err := utils.CreateHash(payload.Pin)
+	if err != nil {
+		detail := err.Error()
+		w.WriteHeader(http.StatusInternalServerError)
+		response.Data = dto.ErrorModel{Message: "failed to hash pin", Details: []*string{&detail}}
+		json.NewEncoder(w).Encode(&response)
+		return
+	}
+
+	err = c.DB.Transaction(func(tx *gorm.DB) error {
+		err := tx.Exec(`
+		UPDATE users SET pin_hash = ?, pin_failures = 0, pin_locked_until = NULL, updated_at = now() WHERE id = ?
+		`, hash, userId.String()).Error
+		if err != nil {
+			return err
+		}
+		event := newAuditEvent(r, response.ID, "user.pin.set", "user", userId.String())
+		return tx.Create(&event).Error
+	})
+	if err != nil {
+		detail := err.Error()
+		w.WriteHeader(http.StatusInternalServerError)
+		response.Data = dto.ErrorModel{Message: "failed to set pin", Details: []*string{&detail}}
+		json.NewEncoder(w).Encode(&response)
+		return
+	}
+
+	type PinResponseModel struct {
+		PinEnabled bool `json:"pinEnabled"`
+	}
+	response.Data = PinResponseModel{PinEnabled: true}
+	json.NewEncoder(w).Encode(&response)
+}
@@ -0,0 +1,526 @@
+package controller
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/eclipseron/digital-wallet-app/dto"
+	"github.com/eclipseron/digital-wallet-app/ledger"
+	"github.com/eclipseron/digital-wallet-app/models"
+	"github.com/eclipseron/digital-wallet-app/settlement"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+var (
+	errTooManyPockets    = fmt.Errorf("an account can have at most %d pockets", models.MaxPockets)
+	errPocketLockedUntil = errors.New("pocket is locked until its target date")
+)
+
+type PocketResponseModel struct {
+	PocketId     uuid.UUID `json:"pocketId"`
+	AccountId    uuid.UUID `json:"accountId"`
+	Name         string    `json:"name"`
+	Balance      int64     `json:"balance"`
+	TargetAmount *int64    `json:"targetAmount"`
+	TargetDate   *string   `json:"targetDate"`
+	Progress     *float64  `json:"progress"`
+	Locked       bool      `json:"locked"`
+	CreatedAt    time.Time `json:"createdAt"`
+}
+
+func newPocketResponse(p *models.Pocket) PocketResponseModel {
+	res := PocketResponseModel{
+		PocketId:     p.ID,
+		AccountId:    p.AccountID,
+		Name:         p.Name,
+		Balance:      p.Balance,
+		TargetAmount: p.TargetAmount,
+		Locked:       p.Locked,
+		CreatedAt:    p.CreatedAt.UTC(),
+	}
+	if p.TargetDate != nil {
+		date := p.TargetDate.Format(time.DateOnly)
+		res.TargetDate = &date
+	}
+	if p.TargetAmount != nil && *p.TargetAmount > 0 {
+		progress := math.Round(float64(p.Balance)*1000/float64(*p.TargetAmount)) / 10
+		res.Progress = &progress
+	}
+	return res
+}
+
+type PocketMovementResponseModel struct {
+	MovementId uuid.UUID `json:"movementId"`
+	Amount     int64     `json:"amount"`
+	Balance    int64     `json:"balance"`
+	CreatedAt  time.Time `json:"at"`
+}
+
+// parseTarget reads an optional target amount and YYYY-MM-DD date. A zero
+// amount or an empty date clears them.
+func parseTarget(amount *int64, date *string) (*int64, *time.Time, error) {
+	var targetAmount *int64
+	var targetDate *time.Time
+	if amount != nil {
+		if *amount < 0 {
+			return nil, nil, errors.New("targetAmount must not be negative")
+		}
+		if *amount > 0 {
+			targetAmount = amount
+		}
+	}
+	if date != nil && *date != "" {
+		d, err := settlement.ParseDate(*date)
+		if err != nil {
+			return nil, nil, errors.New("targetDate must be YYYY-MM-DD")
+		}
+		targetDate = &d
+	}
+	return targetAmount, targetDate, nil
+}
+
+// ListPocketsHandler lists the pockets of an owned account.
+func (c *Controller) ListPocketsHandler(w http.ResponseWriter, r *http.Request) {
+	var response dto.ResponseModel
+	response.ID = uuid.New()
+	response.Timestamp = time.Now().UTC()
+	w.Header().Add("Content-Type", "application/json")
+
+	accountId, ok := c.ownedAccount(w, r, &response)
+	if !ok {
+		return
+	}
+
+	var pockets []models.Pocket
+	if err := c.DB.Where("account_id = ?", accountId.String()).Order("created_at").Find(&pockets).Error; err != nil {
+		detail := err.Error()
+		w.WriteHeader(http.StatusInternalServerError)
+		response.Data = dto.ErrorModel{Message: "an error occured", Details: []*string{&detail}}
+		json.NewEncoder(w).Encode(&response)
+		return
+	}
+	data := make([]PocketResponseModel, len(pockets))
+	for i := range pockets {
+		data[i] = newPocketResponse(&pockets[i])
+	}
+	response.Data = data
+	json.NewEncoder(w).Encode(&response)
+}
+
+// CreatePocketHandler opens an empty pocket on an owned account.
+func (c *Controller) CreatePocketHandler(w http.ResponseWriter, r *http.Request) {
+	var response dto.ResponseModel
+	response.ID = uuid.New()
+	response.Timestamp = time.Now().UTC()
+	w.Header().Add("Content-Type", "application/json")
+
+	accountId, ok := c.ownedAccount(w, r, &response)
+	if !ok {
+		return
+	}
+
+	type Request struct {
+		Name         string  `json:"name"`
+		TargetAmount *int64  `json:"targetAmount"`
+		TargetDate   *string `json:"targetDate"`
+		Locked       bool    `json:"locked"`
+	}
+	var payload Request
+	if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+		detail := err.Error()
+		w.WriteHeader(http.StatusBadRequest)
+		response.Data = dto.ErrorModel{Message: "invalid request", Details: []*string{&detail}}
+		json.NewEncoder(w).Encode(&response)
+		return
+	}
+	payload.Name = strings.TrimSpace(payload.Name)
+	targetAmount, targetDate, err := parseTarget(payload.TargetAmount, payload.TargetDate)
+	if err == nil && (payload.Name == "" || len(payload.Name) > 50) {
+		err = errors.New("name is required and at most 50 characters")
+	}
+	if err != nil {
+		detail := err.Error()
+		w.WriteHeader(http.StatusBadRequest)
+		response.Data = dto.ErrorModel{Message: "invalid request", Details: []*string{&detail}}
+		json.NewEncoder(w).Encode(&response)
+		return
+	}
+
+	pocket := models.Pocket{
+		AccountID:    accountId,
+		Name:         payload.Name,
+		TargetAmount: targetAmount,
+		TargetDate:   targetDate,
+		Locked:       payload.Locked,
+	}
+	err = c.DB.Transaction(func(tx *gorm.DB) error {
+		// serialises pocket creation per account so the limit holds
+		if err := tx.Exec(`SELECT 1 FROM accounts WHERE id = ? FOR UPDATE`, accountId.String()).Error; err != nil {
+			return err
+		}
+		var count int64
+		if err := tx.Model(&models.Pocket{}).Where("account_id = ?", accountId.String()).Count(&count).Error; err != nil {
+			return err
+		}
+		if count >= models.MaxPockets {
+			return errTooManyPockets
+		}
+		if err := tx.Create(&pocket).Error; err != nil {
+			return err
+		}
+		event := newAuditEvent(r, response.ID, "pocket.create", "pocket", pocket.ID.String())
+		event.SetChanges(nil, map[string]any{
+			"name": pocket.Name, "targetAmount": pocket.TargetAmount, "targetDate": payload.TargetDate,
+			"locked": pocket.Locked,
+		})
+		return tx.Create(&event).Error
+	})
+	if errors.Is(err, errTooManyPockets) {
+		detail := err.Error()
+		w.WriteHeader(http.StatusConflict)
+		response.Data = dto.ErrorModel{Message: "too many pockets", Details: []*string{&detail}}
+		json.NewEncoder(w).Encode(&response)
+		return
+	}
+	if err != nil {
+		detail := err.Error()
+		w.WriteHeader(http.StatusInternalServerError)
+		response.Data = dto.ErrorModel{Message: "failed to create pocket", Details: []*string{&detail}}
+		json.NewEncoder(w).Encode(&response)
+		return
+	}
+
+	w.WriteHeader(http.StatusCreated)
+	response.Data = newPocketResponse(&pocket)
+	json.NewEncoder(w).Encode(&response)
+}
+
+// GetPocketHandler returns a pocket with its movements, newest first.
+func (c *Controller) GetPocketHandler(w http.ResponseWriter, r *http.Request) {
+	var response dto.ResponseModel
+	response.ID = uuid.New()
+	response.Timestamp = time.Now().UTC()
+	w.Header().Add("Content-Type", "application/json")
+
+	pocket := c.ownedPocket(w, r, &response)
+	if pocket == nil {
+		return
+	}
+	limit, offset := parsePagination(r)
+
+	movements := []PocketMovementResponseModel{}
+	err := c.DB.Raw(`
+	SELECT id AS movement_id, amount, balance, created_at FROM pocket_movements
+	WHERE pocket_id = ? ORDER BY created_at DESC LIMIT ? OFFSET ?
+	`, pocket.ID.String(), limit, offset).Scan(&movements).Error
+	if err != nil {
+		detail := err.Error()
+		w.WriteHeader(http.StatusInternalServerError)
+		response.Data = dto.ErrorModel{Message: "an error occured", Details: []*string{&detail}}
+		json.NewEncoder(w).Encode(&response)
+		return
+	}
+	for i := range movements {
+		movements[i].CreatedAt = movements[i].CreatedAt.UTC()
+	}
+
+	type PocketDetailResponseModel struct {
+		PocketResponseModel
+		Movements []PocketMovementResponseModel `json:"movements"`
+	}
+	response.Data = PocketDetailResponseModel{PocketResponseModel: newPocketResponse(pocket), Movements: movements}
+	json.NewEncoder(w).Encode(&response)
+}
+
+// UpdatePocketHandler renames a pocket, changes its target or locks and
+// unlocks it. A pocket with a target date cannot be unlocked, nor its date
+// brought forward, before that date.
+func (c *Controller) UpdatePocketHandler(w http.ResponseWriter, r *http.Request) {
+	var response dto.ResponseModel
+	response.ID = uuid.New()
+	response.Timestamp = time.Now().UTC()
+	w.Header().Add("Content-Type", "application/json")
+
+	pocket := c.ownedPocket(w, r, &response)
+	if pocket == nil {
+		return
+	}
+
+	type Request struct {
+		Name         *string `json:"name"`
+		TargetAmount *int64  `json:"targetAmount"`
+		TargetDate   *string `json:"targetDate"`
+		Locked       *bool   `json:"locked"`
+	}
+	var payload Request
+	if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+		detail := err.Error()
+		w.WriteHeader(http.StatusBadRequest)
+		response.Data = dto.ErrorModel{Message: "invalid request", Details: []*string{&detail}}
+		json.NewEncoder(w).Encode(&response)
+		return
+	}
+	targetAmount, targetDate, err := parseTarget(payload.TargetAmount, payload.TargetDate)
+	if err == nil && payload.Name != nil {
+		*payload.Name = strings.TrimSpace(*payload.Name)
+		if *payload.Name == "" || len(*payload.Name) > 50 {
+			err = errors.New("name is required and at most 50 characters")
+		}
+	}
+	if err != nil {
+		detail := err.Error()
+		w.WriteHeader(http.StatusBadRequest)
+		response.Data = dto.ErrorModel{Message: "invalid request", Details: []*string{&detail}}
+		json.NewEncoder(w).Encode(&response)
+		return
+	}
+
+	err = c.DB.Transaction(func(tx *gorm.DB) error {
+		res := tx.Raw(`SELECT * FROM pockets WHERE id = ? AND deleted_at IS NULL FOR UPDATE`, pocket.ID.String()).Scan(pocket)
+		if res.Error != nil {
+			return res.Error
+		}
+		if res.RowsAffected == 0 {
+			return gorm.ErrRecordNotFound
+		}
+		before := newPocketResponse(pocket)
+
+		now := time.Now()
+		if pocket.Locked && pocket.LockedUntil(now) {
+			unlocking := payload.Locked != nil && !*payload.Locked
+			earlier := payload.TargetDate != nil && (targetDate == nil || targetDate.Before(*pocket.TargetDate))
+			if unlocking || earlier {
+				return errPocketLockedUntil
+			}
+		}
+		if payload.Name != nil {
+			pocket.Name = *payload.Name
+		}
+		if payload.TargetAmount != nil {
+			pocket.TargetAmount = targetAmount
+		}
+		if payload.TargetDate != nil {
+			pocket.TargetDate = targetDate
+		}
+		if payload.Locked != nil {
+			pocket.Locked = *payload.Locked
+		}
+		pocket.UpdatedAt = now
+		err := tx.Model(pocket).Select("name", "target_amount", "target_date", "locked", "updated_at").
+			Updates(pocket).Error
+		if err != nil {
+			return err
+		}
+
+		event := newAuditEvent(r, response.ID, "pocket.update", "pocket", pocket.ID.String())
+		event.SetChanges(before, newPocketResponse(pocket))
+		return tx.Create(&event).Error
+	})
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		detail := fmt.Sprintf("pocket with id: %s not exist", pocket.ID.String())
+		w.WriteHeader(http.StatusNotFound)
+		response.Data = dto.ErrorModel{Message: "pocket not found", Details: []*string{&detail}}
+		json.NewEncoder(w).Encode(&response)
+		return
+	}
+	if errors.Is(err, errPocketLockedUntil) {
+		detail := fmt.Sprintf("pocket is locked until %s", pocket.TargetDate.Format(time.DateOnly))
+		w.WriteHeader(http.StatusConflict)
+		response.Data = dto.ErrorModel{Message: "pocket is locked", Details: []*string{&detail}}
+		json.NewEncoder(w).Encode(&response)
+		return
+	}
+	if err != nil {
+		detail := err.Error()
+		w.WriteHeader(http.StatusInternalServerError)
+		response.Data = dto.ErrorModel{Message: "failed to update pocket", Details: []*string{&detail}}
+		json.NewEncoder(w).Encode(&response)
+		return
+	}
+
+	response.Data = newPocketResponse(pocket)
+	json.NewEncoder(w).Encode(&response)
+}
+
+// DeletePocketHandler moves what is left in an unlocked pocket back to the
+// main balance and removes the pocket. It answers with the pocket as it was
+// before the money was released.
+func (c *Controller) DeletePocketHandler(w http.ResponseWriter, r *http.Request) {
+	var response dto.ResponseModel
+	response.ID = uuid.New()
+	response.Timestamp = time.Now().UTC()
+	w.Header().Add("Content-Type", "application/json")
+
+	pocket := c.ownedPocket(w, r, &response)
+	if pocket == nil {
+		return
+	}
+
+	err := c.DB.Transaction(func(tx *gorm.DB) error {
+		// account first, as MovePocket does
+		if err := tx.Exec(`SELECT 1 FROM accounts WHERE id = ? FOR UPDATE`, pocket.AccountID.String()).Error; err != nil {
+			return err
+		}
+		res := tx.Raw(`SELECT * FROM pockets WHERE id = ? AND deleted_at IS NULL FOR UPDATE`, pocket.ID.String()).Scan(pocket)
+		if res.Error != nil {
+			return res.Error
+		}
+		if res.RowsAffected == 0 {
+			return ledger.ErrPocketNotFound
+		}
+		if pocket.Locked {
+			return ledger.ErrPocketLocked
+		}
+		released := pocket.Balance
+		if released > 0 {
+			if _, err := ledger.MovePocket(tx, pocket.AccountID, pocket.ID, -released); err != nil {
+				return err
+			}
+		}
+		if err := tx.Delete(&models.Pocket{}, "id = ?", pocket.ID.String()).Error; err != nil {
+			return err
+		}
+		event := newAuditEvent(r, response.ID, "pocket.delete", "pocket", pocket.ID.String())
+		event.SetChanges(map[string]any{"name": pocket.Name, "balance": released}, nil)
+		return tx.Create(&event).Error
+	})
+	if c.writePocketError(w, &response, pocket, err) {
+		return
+	}
+
+	response.Data = newPocketResponse(pocket)
+	json.NewEncoder(w).Encode(&response)
+}
+
+// DepositPocketHandler moves money from the main balance into a pocket.
+func (c *Controller) DepositPocketHandler(w http.ResponseWriter, r *http.Request) {
+	c.movePocket(w, r, 1)
+}
+
+// WithdrawPocketHandler moves money from an unlocked pocket back to the main
+// balance.
+func (c *Controller) WithdrawPocketHandler(w http.ResponseWriter, r *http.Request) {
+	c.movePocket(w, r, -1)
+}
+
+func (c *Controller) movePocket(w http.ResponseWriter, r *http.Request, sign int64) {
+	var response dto.ResponseModel
+	response.ID = uuid.New()
+	response.Timestamp = time.Now().UTC()
+	w.Header().Add("Content-Type", "application/json")
+
+	pocket := c.ownedPocket(w, r, &response)
+	if pocket == nil {
+		return
+	}
+
+	type Request struct {
+		Amount int64 `json:"amount"`
+	}
+	var payload Request
+	if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+		detail := err.Error()
+		w.WriteHeader(http.StatusBadRequest)
+		response.Data = dto.ErrorModel{Message: "invalid request", Details: []*string{&detail}}
+		json.NewEncoder(w).Encode(&response)
+		return
+	}
+	if payload.Amount <= 0 {
+		detail := "amount must be positive"
+		w.WriteHeader(http.StatusBadRequest)
+		response.Data = dto.ErrorModel{Message: "invalid request", Details: []*string{&detail}}
+		json.NewEncoder(w).Encode(&response)
+		return
+	}
+
+	action := "pocket.deposit"
+	if sign < 0 {
+		action = "pocket.withdraw"
+	}
+	var moved *models.Pocket
+	err := c.DB.Transaction(func(tx *gorm.DB) error {
+		var err error
+		moved, err = ledger.MovePocket(tx, pocket.AccountID, pocket.ID, sign*payload.Amount)
+		if err != nil {
+			return err
+		}
+		event := newAuditEvent(r, response.ID, action, "pocket", pocket.ID.String())
+		event.SetChanges(map[string]any{"balance": moved.Balance - sign*payload.Amount},
+			map[string]any{"balance": moved.Balance})
+		return tx.Create(&event).Error
+	})
+	if c.writePocketError(w, &response, pocket, err) {
+		return
+	}
+
+	response.Data = newPocketResponse(moved)
+	json.NewEncoder(w).Encode(&response)
+}
+
+// writePocketError answers a failed pocket move and reports whether there
+// was one.
+func (c *Controller) writePocketError(w http.ResponseWriter, response *dto.ResponseModel, pocket *models.Pocket, err error) bool {
+	if err == nil {
+		return false
+	}
+	switch {
+	case errors.Is(err, ledger.ErrPocketNotFound), errors.Is(err, models.ErrAccountNotFound):
+		detail := fmt.Sprintf("pocket with id: %s not exist", pocket.ID.String())
+		w.WriteHeader(http.StatusNotFound)
+		response.Data = dto.ErrorModel{Message: "pocket not found", Details: []*string{&detail}}
+	case errors.Is(err, ledger.ErrPocketLocked):
+		detail := "unlock the pocket before taking money out of it"
+		w.WriteHeader(http.StatusConflict)
+		response.Data = dto.ErrorModel{Message: "pocket is locked", Details: []*string{&detail}}
+	case errors.Is(err, ledger.ErrInsufficientBalance):
+		detail := err.Error()
+		w.WriteHeader(http.StatusBadRequest)
+		response.Data = dto.ErrorModel{Message: "insufficient balance", Details: []*string{&detail}}
+	default:
+		detail := err.Error()
+		w.WriteHeader(http.StatusInternalServerError)
+		response.Data = dto.ErrorModel{Message: "failed to move money", Details: []*string{&detail}}
+	}
+	json.NewEncoder(w).Encode(response)
+	return true
+}
+
+// ownedPocket loads the pocket in the path of an owned account, it writes
+// the error response itself and returns nil on failure.
+func (c *Controller) ownedPocket(w http.ResponseWriter, r *http.Request, response *dto.ResponseModel) *models.Pocket {
+	accountId, ok := c.ownedAccount(w, r, response)
+	if !ok {
+		return nil
+	}
+	pocketId, err := uuid.Parse(r.PathValue("pocketId"))
+	if err != nil {
+		detail := err.Error()
+		w.WriteHeader(http.StatusBadRequest)
+		response.Data = dto.ErrorModel{Message: "invalid id", Details: []*string{&detail}}
+		json.NewEncoder(w).Encode(response)
+		return nil
+	}
+	var pocket models.Pocket
+	err = c.DB.Where("id = ? AND account_id = ?", pocketId.String(), accountId.String()).First(&pocket).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		detail := fmt.Sprintf("pocket with id: %s not exist", pocketId.String())
+		w.WriteHeader(http.StatusNotFound)
+		response.Data = dto.ErrorModel{Message: "pocket not found", Details: []*string{&detail}}
+		json.NewEncoder(w).Encode(response)
+		return nil
+	}
+	if err != nil {
+		detail := err.Error()
+		w.WriteHeader(http.StatusInternalServerError)
+		response.Data = dto.ErrorModel{Message: "an error occured", Details: []*string{&detail}}
+		json.NewEncoder(w).Encode(response)
+		return nil
+	}
+	return &pocket
+}
@@ -0,0 +1,630 @@
+package controller
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/eclipseron/digital-wallet-app/dto"
+	"github.com/eclipseron/digital-wallet-app/ledger"
+	"github.com/eclipseron/digital-wallet-app/middleware"
+	"github.com/eclipseron/digital-wallet-app/models"
+	"github.com/eclipseron/digital-wallet-app/qrcode"
+	"github.com/eclipseron/digital-wallet-app/qris"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+const (
+	defaultQRScale = 8
+	maxQRScale     = 32
+	// dynamicQRExpiry is how long a dynamic account payload can be paid
+	dynamicQRExpiry = 24 * time.Hour
+)
+
+var (
+	errMerchantInactive = errors.New("merchant is not accepting payments")
+	errIntentNotPayable = errors.New("payment intent is not pending, expired or the amount differs")
+	errCodeNotPayable   = errors.New("qr code was already paid, expired or is not for this account")
+)
+
+type QRResponseModel struct {
+	Payload   string    `json:"payload"`
+	Dynamic   bool      `json:"dynamic"`
+	Amount    *int64    `json:"amount"`
+	AccountId uuid.UUID `json:"accountId"`
+	IntentId  *string   `json:"intentId,omitempty"`
+	CodeId    *string   `json:"codeId,omitempty"`
+}
+
+// qrPayload fills the account part of a payload. Merchant settlement accounts
+// show the merchant name and category, other accounts the holder's name.
+func (c *Controller) qrPayload(accountID uuid.UUID) (*qris.Payload, uuid.UUID, error) {
+	var account struct {
+		AccountNumber string
+		UserID        uuid.UUID
+		Name          string
+		MerchantName  *string
+	}
+	res := c.DB.Raw(`
+	SELECT a.account_number, a.user_id, u.name, m.name AS merchant_name
+	FROM accounts a
+	JOIN users u ON u.id = a.user_id
+	LEFT JOIN merchants m ON m.account_id = a.id
+	WHERE a.id = ? AND a.deleted_at IS NULL
+	`, accountID.String()).Scan(&account)
+	if res.Error != nil {
+		return nil, uuid.Nil, res.Error
+	}
+	if res.RowsAffected == 0 {
+		return nil, uuid.Nil, models.ErrAccountNotFound
+	}
+
+	p := &qris.Payload{
+		AccountNumber: account.AccountNumber,
+		Category:      qris.MCCTransfer,
+		MerchantName:  account.Name,
+	}
+	if account.MerchantName != nil {
+		p.Category = qris.MCCMerchant
+		p.MerchantName = *account.MerchantName
+	}
+	return p, account.UserID, nil
+}
+
+// AccountQRHandler returns the static payload of an account, or a dynamic one
+// when ?amount= is given. A dynamic payload is backed by a QRCode and can be
+// paid once. ?reference= is copied into the reference label.
+func (c *Controller) AccountQRHandler(w http.ResponseWriter, r *http.Request) {
+	var response dto.ResponseModel
+	response.ID = uuid.New()
+	response.Timestamp = time.Now().UTC()
+	w.Header().Add("Content-Type", "application/json")
+
+	accountId, err := uuid.Parse(r.PathValue("accountId"))
+	if err != nil {
+		detail := err.Error()
+		w.WriteHeader(http.StatusBadRequest)
+		response.Data = dto.ErrorModel{Message: "invalid id", Details: []*string{&detail}}
+		json.NewEncoder(w).Encode(&response)
+		return
+	}
+
+	query := r.URL.Query()
+	var amount int64
+	if v := query.Get("amount"); v != "" {
+		amount, err = strconv.ParseInt(v, 10, 64)
+		if err != nil || amount <= 0 {
+			detail := "amount must be a positive integer"
+			w.WriteHeader(http.StatusBadRequest)
+			response.Data = dto.ErrorModel{Message: "invalid request", Details: []*string{&detail}}
+			json.NewEncoder(w).Encode(&response)
+			return
+		}
+	}
+	reference := strings.TrimSpace(query.Get("reference"))
+	if len(reference) > 25 {
+		detail := "reference is at most 25 characters"
+		w.WriteHeader(http.StatusBadRequest)
+		response.Data = dto.ErrorModel{Message: "invalid request", Details: []*string{&detail}}
+		json.NewEncoder(w).Encode(&response)
+		return
+	}
+
+	payload, owner, err := c.qrPayload(accountId)
+	if errors.Is(err, models.ErrAccountNotFound) {
+		detail := fmt.Sprintf("account with id: %s not exist", accountId.String())
+		w.WriteHeader(http.StatusNotFound)
+		response.Data = dto.ErrorModel{Message: "account not found", Details: []*string{&detail}}
+		json.NewEncoder(w).Encode(&response)
+		return
+	}
+	if err != nil {
+		detail := err.Error()
+		w.WriteHeader(http.StatusInternalServerError)
+		response.Data = dto.ErrorModel{Message: "an error occured", Details: []*string{&detail}}
+		json.NewEncoder(w).Encode(&response)
+		return
+	}
+	_uid, _ := r.Context().Value(middleware.USERID).(string)
+	if _uid != owner.String() {
+		detail := "This account does not belong to the user"
+		w.WriteHeader(http.StatusForbidden)
+		response.Data = dto.ErrorModel{Message: "forbidden", Details: []*string{&detail}}
+		json.NewEncoder(w).Encode(&response)
+		return
+	}
+
+	payload.Reference = reference
+	if amount > 0 {
+		code := models.QRCode{
+			AccountID: accountId,
+			Amount:    amount,
+			Status:    models.QRCodeStatusActive,
+			ExpiresAt: time.Now().Add(dynamicQRExpiry),
+		}
+		if reference != "" {
+			code.Reference = &reference
+		}
+		if err := c.DB.Create(&code).Error; err != nil {
+			detail := err.Error()
+			w.WriteHeader(http.StatusInternalServerError)
+			response.Data = dto.ErrorModel{Message: "failed to create qr code", Details: []*string{&detail}}
+			json.NewEncoder(w).Encode(&response)
+			return
+		}
+		payload.Dynamic = true
+		payload.Amount = amount
+		payload.CodeID = code.ID.String()
+	}
+	encoded, err := payload.Encode()
+	if err != nil {
+		detail := err.Error()
+		w.WriteHeader(http.StatusInternalServerError)
+		response.Data = dto.ErrorModel{Message: "failed to encode qr payload", Details: []*string{&detail}}
+		json.NewEncoder(w).Encode(&response)
+		return
+	}
+
+	data := QRResponseModel{Payload: encoded, Dynamic: payload.Dynamic, AccountId: accountId}
+	if payload.Dynamic {
+		data.Amount = &payload.Amount
+		data.CodeId = &payload.CodeID
+	}
+	response.Data = data
+	json.NewEncoder(w).Encode(&response)
+}
+
+// PaymentIntentQRHandler returns the dynamic payload of a pending intent for
+// the merchant to show at checkout, scanning it pays the intent.
+func (c *Controller) PaymentIntentQRHandler(w http.ResponseWriter, r *http.Request) {
+	var response dto.ResponseModel
+	response.ID = uuid.New()
+	response.Timestamp = time.Now().UTC()
+	w.Header().Add("Content-Type", "application/json")
+
+	_mid, _ := r.Context().Value(middleware.MERCHANTID).(string)
+	intentId, err := uuid.Parse(r.PathValue("intentId"))
+	if err != nil {
+		detail := err.Error()
+		w.WriteHeader(http.StatusBadRequest)
+		response.Data = dto.ErrorModel{Message: "invalid id", Details: []*string{&detail}}
+		json.NewEncoder(w).Encode(&response)
+		return
+	}
+
+	var intent models.PaymentIntent
+	tx := c.DB.Preload("Merchant").Where("id = ? AND merchant_id = ?", intentId.String(), _mid).Limit(1).Find(&intent)
+	if tx.Error != nil {
+		detail := tx.Error.Error()
+		w.WriteHeader(http.StatusInternalServerError)
+		response.Data = dto.ErrorModel{Message: "an error occured", Details: []*string{&detail}}
+		json.NewEncoder(w).Encode(&response)
+		return
+	}
+	if tx.RowsAffected == 0 {
+		detail := fmt.Sprintf("payment intent with id: %s not exist", intentId.String())
+		w.WriteHeader(http.StatusNotFound)
+		response.Data = dto.ErrorModel{Message: "payment intent not found", Details: []*string{&detail}}
+		json.NewEncoder(w).Encode(&response)
+		return
+	}
+	if status := newPaymentIntentResponse(&intent).Status; status != models.PaymentIntentPending {
+		detail := fmt.Sprintf("payment intent is %s", strings.ToLower(status))
+		w.WriteHeader(http.StatusConflict)
+		response.Data = dto.ErrorModel{Message: "payment intent can not be paid", Details: []*string{&detail}}
+		json.NewEncoder(w).Encode(&response)
+		return
+	}
+
+	payload, _, err := c.qrPayload(intent.Merchant.AccountID)
+	if err != nil {
+		detail := err.Error()
+		w.WriteHeader(http.StatusInternalServerError)
+		response.Data = dto.ErrorModel{Message: "an error occured", Details: []*string{&detail}}
+		json.NewEncoder(w).Encode(&response)
+		return
+	}
+	payload.Dynamic = true
+	payload.Amount = intent.Amount
+	payload.IntentID = intent.ID.String()
+	if len(intent.Reference) <= 25 {
+		payload.BillNumber = intent.Reference
+	}
+	encoded, err := payload.Encode()
+	if err != nil {
+		detail := err.Error()
+		w.WriteHeader(http.StatusInternalServerError)
+		response.Data = dto.ErrorModel{Message: "failed to encode qr payload", Details: []*string{&detail}}
+		json.NewEncoder(w).Encode(&response)
+		return
+	}
+
+	response.Data = QRResponseModel{
+		Payload:   encoded,
+		Dynamic:   true,
+		Amount:    &intent.Amount,
+		AccountId: intent.Merchant.AccountID,
+		IntentId:  &payload.IntentID,
+	}
+	json.NewEncoder(w).Encode(&response)
+}
+
+// RenderQRHandler draws a payload as PNG. Only valid payloads of this wallet
+// are rendered, ?scale= is the pixel size of one module.
+func (c *Controller) RenderQRHandler(w http.ResponseWriter, r *http.Request) {
+	var response dto.ResponseModel
+	response.ID = uuid.New()
+	response.Timestamp = time.Now().UTC()
+	w.Header().Add("Content-Type", "application/json")
+
+	query := r.URL.Query()
+	payload := strings.TrimSpace(query.Get("payload"))
+	if _, err := qris.Parse(payload); err != nil {
+		detail := err.Error()
+		w.WriteHeader(http.StatusBadRequest)
+		response.Data = dto.ErrorModel{Message: "invalid qr payload", Details: []*string{&detail}}
+		json.NewEncoder(w).Encode(&response)
+		return
+	}
+	scale := defaultQRScale
+	if v := query.Get("scale"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 || n > maxQRScale {
+			detail := fmt.Sprintf("scale must be between 1 and %d", maxQRScale)
+			w.WriteHeader(http.StatusBadRequest)
+			response.Data = dto.ErrorModel{Message: "invalid request", Details: []*string{&detail}}
+			json.NewEncoder(w).Encode(&response)
+			return
+		}
+		scale = n
+	}
+
+	code, err := qrcode.Encode([]byte(payload))
+	var img bytes.Buffer
+	if err == nil {
+		err = code.PNG(&img, scale)
+	}
+	if err != nil {
+		detail := err.Error()
+		w.WriteHeader(http.StatusInternalServerError)
+		response.Data = dto.ErrorModel{Message: "failed to render qr code", Details: []*string{&detail}}
+		json.NewEncoder(w).Encode(&response)
+		return
+	}
+
+	w.Header().Set("Content-Type", "image/png")
+	w.Header().Set("Cache-Control", "private, max-age=300")
+	w.Write(img.Bytes())
+}
+
+// PayQRHandler pays a scanned payload. A payment intent payload pays the
+// intent, other merchant payloads book a TRANSFER and notify the merchant,
+// personal payloads book a TRANSFER_OUT and TRANSFER_IN pair. A dynamic
+// account payload also marks its QRCode paid so it can not be paid twice.
+func (c *Controller) PayQRHandler(w http.ResponseWriter, r *http.Request) {
+	var response dto.ResponseModel
+	response.ID = uuid.New()
+	response.Timestamp = time.Now().UTC()
+	w.Header().Add("Content-Type", "application/json")
+
+	_uid, _ := r.Context().Value(middleware.USERID).(string)
+	userId, err := uuid.Parse(_uid)
+	if err != nil {
+		detail := err.Error()
+		w.WriteHeader(http.StatusUnauthorized)
+		response.Data = dto.ErrorModel{Message: "invalid token payload", Details: []*string{&detail}}
+		json.NewEncoder(w).Encode(&response)
+		return
+	}
+
+	type RequestModel struct {
+		Payload   string    `json:"payload"`
+		AccountId uuid.UUID `json:"accountId"`
+		// Amount is entered by the payer for static payloads, a dynamic
+		// payload carries its own
+		Amount int64  `json:"amount"`
+		Pin    string `json:"pin"`
+	}
+	var payload RequestModel
+	if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+		detail := err.Error()
+		w.WriteHeader(http.StatusBadRequest)
+		response.Data = dto.ErrorModel{Message: "invalid request body", Details: []*string{&detail}}
+		json.NewEncoder(w).Encode(&response)
+		return
+	}
+
+	qr, err := qris.Parse(payload.Payload)
+	if err != nil {
+		detail := err.Error()
+		w.WriteHeader(http.StatusBadRequest)
+		response.Data = dto.ErrorModel{Message: "invalid qr payload", Details: []*string{&detail}}
+		json.NewEncoder(w).Encode(&response)
+		return
+	}
+	amount := payload.Amount
+	if qr.Dynamic {
+		if amount != 0 && amount != qr.Amount {
+			detail := fmt.Sprintf("this code is for exactly %d", qr.Amount)
+			w.WriteHeader(http.StatusBadRequest)
+			response.Data = dto.ErrorModel{Message: "invalid request body", Details: []*string{&detail}}
+			json.NewEncoder(w).Encode(&response)
+			return
+		}
+		amount = qr.Amount
+	}
+	if amount <= 0 {
+		detail := "amount must be positive"
+		w.WriteHeader(http.StatusBadRequest)
+		response.Data = dto.ErrorModel{Message: "invalid request body", Details: []*string{&detail}}
+		json.NewEncoder(w).Encode(&response)
+		return
+	}
+
+	var payer struct {
+		UserID        uuid.UUID
+		AccountNumber string
+	}
+	tx := c.DB.Raw(`
+	SELECT user_id, account_number FROM accounts WHERE id = ? AND deleted_at IS NULL
+	`, payload.AccountId.String()).Scan(&payer)
+	if tx.RowsAffected == 0 {
+		detail := fmt.Sprintf("account with id: %s not exist", payload.AccountId.String())
+		w.WriteHeader(http.StatusNotFound)
+		response.Data = dto.ErrorModel{Message: "account not found", Details: []*string{&detail}}
+		json.NewEncoder(w).Encode(&response)
+		return
+	}
+	if tx.Error != nil {
+		detail := tx.Error.Error()
+		w.WriteHeader(http.StatusInternalServerError)
+		response.Data = dto.ErrorModel{Message: "an error occured", Details: []*string{&detail}}
+		json.NewEncoder(w).Encode(&response)
+		return
+	}
+	if payer.UserID != userId {
+		detail := "This account does not belong to the user"
+		w.WriteHeader(http.StatusForbidden)
+		response.Data = dto.ErrorModel{Message: "forbidden", Details: []*string{&detail}}
+		json.NewEncoder(w).Encode(&response)
+		return
+	}
+
+	if err := c.verifyPin(userId, payload.Pin); err != nil {
+		status := http.StatusForbidden
+		if !errors.Is(err, errPin) {
+			status = http.StatusInternalServerError
+		}
+		detail := err.Error()
+		w.WriteHeader(status)
+		response.Data = dto.ErrorModel{Message: "pin verification failed", Details: []*string{&detail}}
+		json.NewEncoder(w).Encode(&response)
+		return
+	}
+
+	var target struct {
+		ID         uuid.UUID
+		MerchantID *uuid.UUID
+	}
+	tx = c.DB.Raw(`
+	SELECT a.id, m.id AS merchant_id
+	FROM accounts a LEFT JOIN merchants m ON m.account_id = a.id
+	WHERE a.account_number = ? AND a.deleted_at IS NULL
+	`, qr.AccountNumber).Scan(&target)
+	if tx.RowsAffected == 0 {
+		detail := fmt.Sprintf("account number %s not exist", qr.AccountNumber)
+		w.WriteHeader(http.StatusNotFound)
+		response.Data = dto.ErrorModel{Message: "account not found", Details: []*string{&detail}}
+		json.NewEncoder(w).Encode(&response)
+		return
+	}
+	if tx.Error != nil {
+		detail := tx.Error.Error()
+		w.WriteHeader(http.StatusInternalServerError)
+		response.Data = dto.ErrorModel{Message: "an error occured", Details: []*string{&detail}}
+		json.NewEncoder(w).Encode(&response)
+		return
+	}
+
+	type PaymentResponseModel struct {
+		TransactionId uuid.UUID `json:"transactionId"`
+		IntentId      *string   `json:"intentId,omitempty"`
+		Amount        int64     `json:"amount"`
+		To            string    `json:"to"`
+		MerchantName  string    `json:"merchantName"`
+		FinalBalance  int64     `json:"finalBalance"`
+	}
+	data := PaymentResponseModel{Amount: amount, To: qr.AccountNumber, MerchantName: qr.MerchantName}
+
+	tx = c.DB.Begin()
+	var code *models.QRCode
+	if qr.Dynamic && qr.IntentID == "" {
+		code, err = claimQRCode(tx, qr.CodeID, target.ID, amount)
+	}
+	var balance int64
+	var txType string
+	switch {
+	case err != nil:
+		// the code could not be claimed, nothing is booked
+	case target.MerchantID != nil:
+		txType = "TRANSFER"
+		var merchant models.Merchant
+		if err = tx.First(&merchant, "id = ?", *target.MerchantID).Error; err != nil {
+			break
+		}
+		if merchant.Status != models.MerchantStatusActive {
+			err = errMerchantInactive
+			break
+		}
+		if qr.IntentID == "" {
+			balance, data.TransactionId, err = payMerchant(tx, &merchant, payload.AccountId, amount, qr)
+			break
+		}
+
+		var intent models.PaymentIntent
+		res := tx.Raw(`
+		SELECT * FROM payment_intents WHERE id::text = ? AND merchant_id = ? FOR UPDATE
+		`, qr.IntentID, merchant.ID.String()).Scan(&intent)
+		err = res.Error
+		if err == nil && res.RowsAffected == 0 {
+			err = errIntentNotPayable
+		}
+		if err != nil {
+			break
+		}
+		if intent.Status != models.PaymentIntentPending || !intent.ExpiresAt.After(time.Now()) || intent.Amount != amount {
+			err = errIntentNotPayable
+			break
+		}
+		balance, err = payIntent(tx, &intent, &merchant, payload.AccountId)
+		if err == nil {
+			data.TransactionId = *intent.TransactionID
+			data.IntentId = &qr.IntentID
+		}
+	default:
+		txType = "TRANSFER_OUT"
+		outDesc := fmt.Sprintf("QR payment to %s", qr.AccountNumber)
+		inDesc := fmt.Sprintf("QR payment from %s", payer.AccountNumber)
+		debit := models.Transactions{Type: "TRANSFER_OUT", Description: &outDesc}
+		credit := models.Transactions{Type: "TRANSFER_IN", Description: &inDesc}
+		balance, err = ledger.Transfer(tx, payload.AccountId, target.ID, amount, &debit, &credit)
+		data.TransactionId = debit.ID
+	}
+	if err == nil && code != nil {
+		now := time.Now()
+		err = tx.Model(code).Updates(map[string]any{
+			"status":         models.QRCodeStatusPaid,
+			"transaction_id": data.TransactionId,
+			"paid_at":        now,
+		}).Error
+	}
+	if errors.Is(err, ledger.ErrSameAccount) {
+		tx.Rollback()
+		detail := "an account can not pay itself"
+		w.WriteHeader(http.StatusBadRequest)
+		response.Data = dto.ErrorModel{Message: "invalid request body", Details: []*string{&detail}}
+		json.NewEncoder(w).Encode(&response)
+		return
+	}
+	if errors.Is(err, errMerchantInactive) || errors.Is(err, errIntentNotPayable) || errors.Is(err, errCodeNotPayable) {
+		tx.Rollback()
+		detail := err.Error()
+		w.WriteHeader(http.StatusConflict)
+		response.Data = dto.ErrorModel{Message: "qr code can not be paid", Details: []*string{&detail}}
+		json.NewEncoder(w).Encode(&response)
+		return
+	}
+	if errors.Is(err, ledger.ErrInsufficientBalance) {
+		tx.Rollback()
+		c.transferFailed(payload.AccountId, txType, amount, err.Error(), nil, nil)
+		w.WriteHeader(http.StatusBadRequest)
+		response.Data = dto.ErrorModel{Message: "insufficient balance"}
+		json.NewEncoder(w).Encode(&response)
+		return
+	}
+	if models.IsRestricted(err) {
+		tx.Rollback()
+		c.transferFailed(payload.AccountId, txType, amount, err.Error(), nil, nil)
+		detail := err.Error()
+		w.WriteHeader(http.StatusForbidden)
+		response.Data = dto.ErrorModel{Message: "account restricted", Details: []*string{&detail}}
+		json.NewEncoder(w).Encode(&response)
+		return
+	}
+	if err != nil {
+		tx.Rollback()
+		detail := err.Error()
+		w.WriteHeader(http.StatusInternalServerError)
+		response.Data = dto.ErrorModel{Message: "payment failed", Details: []*string{&detail}}
+		json.NewEncoder(w).Encode(&response)
+		return
+	}
+
+	event := newAuditEvent(r, response.ID, "qr.pay", "transaction", data.TransactionId.String())
+	event.SetChanges(nil, map[string]any{
+		"accountId": payload.AccountId,
+		"to":        qr.AccountNumber,
+		"amount":    amount,
+		"dynamic":   qr.Dynamic,
+	})
+	if err := tx.Create(&event).Error; err != nil {
+		tx.Rollback()
+		detail := err.Error()
+		w.WriteHeader(http.StatusInternalServerError)
+		response.Data = dto.ErrorModel{Message: "failed to write audit entry", Details: []*string{&detail}}
+		json.NewEncoder(w).Encode(&response)
+		return
+	}
+
+	if err := tx.Commit().Error; err != nil {
+		detail := err.Error()
+		w.WriteHeader(http.StatusInternalServerError)
+		response.Data = dto.ErrorModel{Message: "database error", Details: []*string{&detail}}
+		json.NewEncoder(w).Encode(&response)
+		return
+	}
+
+	data.FinalBalance = balance
+	response.Data = data
+	json.NewEncoder(w).Encode(&response)
+}
+
+// claimQRCode locks the active QRCode behind a dynamic account payload. A
+// payload without a code, or whose code is paid, expired, for another account
+// or another amount, can not be paid.
+func claimQRCode(tx *gorm.DB, codeID string, accountID uuid.UUID, amount int64) (*models.QRCode, error) {
+	id, err := uuid.Parse(codeID)
+	if err != nil {
+		return nil, errCodeNotPayable
+	}
+	var code models.QRCode
+	res := tx.Raw(`SELECT * FROM qr_codes WHERE id = ? FOR UPDATE`, id.String()).Scan(&code)
+	if res.Error != nil {
+		return nil, res.Error
+	}
+	if res.RowsAffected == 0 || code.Status != models.QRCodeStatusActive || code.AccountID != accountID ||
+		code.Amount != amount || !code.ExpiresAt.After(time.Now()) {
+		return nil, errCodeNotPayable
+	}
+	return &code, nil
+}
+
+// payMerchant books a static or amount-only merchant payload as a TRANSFER
+// and tells the merchant with payment.succeeded, without an intent.
+func payMerchant(tx *gorm.DB, merchant *models.Merchant, accountID uuid.UUID, amount int64, qr *qris.Payload) (int64, uuid.UUID, error) {
+	reference := qr.Reference
+	if reference == "" {
+		reference = qr.BillNumber
+	}
+	payerDesc := fmt.Sprintf("QR payment to %s", merchant.Name)
+	merchantDesc := "QR payment"
+	if reference != "" {
+		merchantDesc = fmt.Sprintf("QR payment %s", reference)
+	}
+	debit := models.Transactions{Type: "TRANSFER", Description: &payerDesc}
+	credit := models.Transactions{Type: "TRANSFER", Description: &merchantDesc}
+	balance, err := ledger.Transfer(tx, accountID, merchant.AccountID, amount, &debit, &credit)
+	if err != nil {
+		return 0, uuid.Nil, err
+	}
+	fee, err := chargeMerchantFee(tx, merchant, amount, reference)
+	if err != nil {
+		return 0, uuid.Nil, err
+	}
+	err = models.AppendOutbox(tx, &merchant.AccountID, models.EventPaymentSucceeded, map[string]any{
+		"intentId":      nil,
+		"merchantId":    merchant.ID,
+		"reference":     reference,
+		"amount":        amount,
+		"fee":           fee,
+		"transactionId": credit.ID,
+		"paidAt":        time.Now().UTC(),
+	})
+	return balance, debit.ID, err
+}
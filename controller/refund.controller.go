@@ -0,0 +1,310 @@
+package controller
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/eclipseron/digital-wallet-app/dto"
+	"github.com/eclipseron/digital-wallet-app/ledger"
+	"github.com/eclipseron/digital-wallet-app/middleware"
+	"github.com/eclipseron/digital-wallet-app/models"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+var (
+	errRefundExceeds  = errors.New("refund exceeds the captured amount")
+	errRefundConflict = errors.New("reference is already used for another refund")
+)
+
+type RefundResponseModel struct {
+	RefundId             uuid.UUID  `json:"refundId"`
+	MerchantId           uuid.UUID  `json:"merchantId"`
+	Reference            *string    `json:"reference"`
+	PaymentTransactionId uuid.UUID  `json:"paymentTransactionId"`
+	PaymentIntentId      *uuid.UUID `json:"paymentIntentId"`
+	Amount               int64      `json:"amount"`
+	Reason               *string    `json:"reason"`
+	TransactionId        uuid.UUID  `json:"transactionId"`
+	// Refundable is what is left of the payment after this refund
+	Refundable int64     `json:"refundable"`
+	CreatedAt  time.Time `json:"createdAt"`
+}
+
+func newRefundResponse(rf *models.Refund, refundable int64) RefundResponseModel {
+	return RefundResponseModel{
+		RefundId:             rf.ID,
+		MerchantId:           rf.MerchantID,
+		Reference:            rf.Reference,
+		PaymentTransactionId: rf.PaymentTransactionID,
+		PaymentIntentId:      rf.PaymentIntentID,
+		Amount:               rf.Amount,
+		Reason:               rf.Reason,
+		TransactionId:        rf.TransactionID,
+		Refundable:           refundable,
+		CreatedAt:            rf.CreatedAt.UTC(),
+	}
+}
+
+// CreateRefundHandler sends money of a payment back to the payer, in full or
+// in part. The payment is either a paymentIntentId or the transactionId of
+// the merchant's side of a QR payment. The payment row stays locked while
+// the refund is booked, so concurrent refunds can not exceed its amount.
+func (c *Controller) CreateRefundHandler(w http.ResponseWriter, r *http.Request) {
+	var response dto.ResponseModel
+	response.ID = uuid.New()
+	response.Timestamp = time.Now().UTC()
+	w.Header().Add("Content-Type", "application/json")
+
+	_mid, _ := r.Context().Value(middleware.MERCHANTID).(string)
+
+	type RequestModel struct {
+		PaymentIntentId *uuid.UUID `json:"paymentIntentId"`
+		TransactionId   *uuid.UUID `json:"transactionId"`
+		// Amount defaults to everything not refunded yet
+		Amount    int64   `json:"amount"`
+		Reason    *string `json:"reason"`
+		Reference *string `json:"reference"`
+	}
+	var payload RequestModel
+	if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+		detail := err.Error()
+		w.WriteHeader(http.StatusBadRequest)
+		response.Data = dto.ErrorModel{Message: "invalid request body", Details: []*string{&detail}}
+		json.NewEncoder(w).Encode(&response)
+		return
+	}
+	if (payload.PaymentIntentId == nil) == (payload.TransactionId == nil) {
+		detail := "exactly one of paymentIntentId or transactionId is required"
+		w.WriteHeader(http.StatusBadRequest)
+		response.Data = dto.ErrorModel{Message: "invalid request body", Details: []*string{&detail}}
+		json.NewEncoder(w).Encode(&response)
+		return
+	}
+	if payload.Amount < 0 {
+		detail := "amount must be positive"
+		w.WriteHeader(http.StatusBadRequest)
+		response.Data = dto.ErrorModel{Message: "invalid request body", Details: []*string{&detail}}
+		json.NewEncoder(w).Encode(&response)
+		return
+	}
+	if payload.Reference != nil {
+		ref := strings.TrimSpace(*payload.Reference)
+		if ref == "" || len(ref) > 64 {
+			detail := "reference must be between 1 and 64 characters"
+			w.WriteHeader(http.StatusBadRequest)
+			response.Data = dto.ErrorModel{Message: "invalid request body", Details: []*string{&detail}}
+			json.NewEncoder(w).Encode(&response)
+			return
+		}
+		payload.Reference = &ref
+	}
+
+	var merchant models.Merchant
+	if err := c.DB.Where("id = ?", _mid).First(&merchant).Error; err != nil {
+		detail := err.Error()
+		w.WriteHeader(http.StatusInternalServerError)
+		response.Data = dto.ErrorModel{Message: "an error occured", Details: []*string{&detail}}
+		json.NewEncoder(w).Encode(&response)
+		return
+	}
+	// a suspended merchant may not move money out, refunds included
+	if merchant.Status != models.MerchantStatusActive {
+		detail := fmt.Sprintf("merchant is %s", strings.ToLower(merchant.Status))
+		w.WriteHeader(http.StatusConflict)
+		response.Data = dto.ErrorModel{Message: "refund can not be issued", Details: []*string{&detail}}
+		json.NewEncoder(w).Encode(&response)
+		return
+	}
+
+	paymentId := payload.TransactionId
+	if payload.PaymentIntentId != nil {
+		var intent models.PaymentIntent
+		tx := c.DB.Where("id = ? AND merchant_id = ?", payload.PaymentIntentId.String(), _mid).Limit(1).Find(&intent)
+		if tx.Error != nil {
+			detail := tx.Error.Error()
+			w.WriteHeader(http.StatusInternalServerError)
+			response.Data = dto.ErrorModel{Message: "an error occured", Details: []*string{&detail}}
+			json.NewEncoder(w).Encode(&response)
+			return
+		}
+		if tx.RowsAffected == 0 {
+			detail := fmt.Sprintf("payment intent with id: %s not exist", payload.PaymentIntentId.String())
+			w.WriteHeader(http.StatusNotFound)
+			response.Data = dto.ErrorModel{Message: "payment intent not found", Details: []*string{&detail}}
+			json.NewEncoder(w).Encode(&response)
+			return
+		}
+		if intent.Status != models.PaymentIntentSucceeded || intent.SettlementTransactionID == nil {
+			detail := fmt.Sprintf("payment intent is %s", strings.ToLower(intent.Status))
+			w.WriteHeader(http.StatusConflict)
+			response.Data = dto.ErrorModel{Message: "payment intent was not paid", Details: []*string{&detail}}
+			json.NewEncoder(w).Encode(&response)
+			return
+		}
+		paymentId = intent.SettlementTransactionID
+	}
+
+	var refund models.Refund
+	var refundable int64
+	replayed := false
+	err := c.DB.Transaction(func(tx *gorm.DB) error {
+		var payment struct {
+			Amount           int64
+			ReversedAmount   int64
+			RelatedAccountID *uuid.UUID
+		}
+		res := tx.Raw(`
+		SELECT amount, reversed_amount, related_account_id FROM transactions
+		WHERE id = ? AND account_id = ? AND type = 'TRANSFER' AND amount > 0 AND deleted_at IS NULL
+		FOR UPDATE
+		`, paymentId.String(), merchant.AccountID.String()).Scan(&payment)
+		if res.Error != nil {
+			return res.Error
+		}
+		if res.RowsAffected == 0 || payment.RelatedAccountID == nil {
+			return gorm.ErrRecordNotFound
+		}
+
+		var refunded int64
+		err := tx.Raw(`
+		SELECT COALESCE(SUM(amount), 0) FROM refunds WHERE payment_transaction_id = ?
+		`, paymentId.String()).Scan(&refunded).Error
+		if err != nil {
+			return err
+		}
+		refundable = payment.Amount - payment.ReversedAmount - refunded
+
+		// a retried refund with the same reference gets the original back
+		if payload.Reference != nil {
+			res := tx.Where("merchant_id = ? AND reference = ?", _mid, *payload.Reference).Limit(1).Find(&refund)
+			if res.Error != nil {
+				return res.Error
+			}
+			if res.RowsAffected > 0 {
+				if refund.PaymentTransactionID != *paymentId || (payload.Amount != 0 && payload.Amount != refund.Amount) {
+					return errRefundConflict
+				}
+				replayed = true
+				return nil
+			}
+		}
+
+		amount := payload.Amount
+		if amount == 0 {
+			amount = refundable
+		}
+		if amount <= 0 || amount > refundable {
+			return errRefundExceeds
+		}
+
+		debitDesc := fmt.Sprintf("Refund to customer (%s)", paymentId.String())
+		creditDesc := fmt.Sprintf("Refund from %s", merchant.Name)
+		debit := models.Transactions{Type: "REFUND", Description: &debitDesc}
+		credit := models.Transactions{Type: "REFUND", Description: &creditDesc}
+		if _, err := ledger.Transfer(tx, merchant.AccountID, *payment.RelatedAccountID, amount, &debit, &credit); err != nil {
+			return err
+		}
+		refundable -= amount
+
+		refund = models.Refund{
+			MerchantID:           merchant.ID,
+			Reference:            payload.Reference,
+			PaymentTransactionID: *paymentId,
+			Amount:               amount,
+			Reason:               payload.Reason,
+			TransactionID:        debit.ID,
+		}
+		var intentId uuid.UUID
+		res = tx.Raw(`
+		UPDATE payment_intents SET refunded_amount = refunded_amount + ?, updated_at = now()
+		WHERE settlement_transaction_id = ?
+		RETURNING id
+		`, amount, paymentId.String()).Scan(&intentId)
+		if res.Error != nil {
+			return res.Error
+		}
+		if res.RowsAffected > 0 {
+			refund.PaymentIntentID = &intentId
+		}
+		if err := tx.Create(&refund).Error; err != nil {
+			return err
+		}
+
+		err = models.AppendOutbox(tx, &merchant.AccountID, models.EventPaymentRefunded, map[string]any{
+			"refundId":             refund.ID,
+			"merchantId":           merchant.ID,
+			"intentId":             refund.PaymentIntentID,
+			"paymentTransactionId": refund.PaymentTransactionID,
+			"reference":            refund.Reference,
+			"amount":               amount,
+			"refundable":           refundable,
+			"transactionId":        debit.ID,
+		})
+		if err != nil {
+			return err
+		}
+
+		event := newAuditEvent(r, response.ID, "merchant.refund", "refund", refund.ID.String())
+		event.SetChanges(
+			map[string]any{"refundable": refundable + amount},
+			map[string]any{"refundable": refundable, "amount": amount, "merchantId": merchant.ID},
+		)
+		return tx.Create(&event).Error
+	})
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		detail := fmt.Sprintf("payment with transaction id: %s not exist", paymentId.String())
+		w.WriteHeader(http.StatusNotFound)
+		response.Data = dto.ErrorModel{Message: "payment not found", Details: []*string{&detail}}
+		json.NewEncoder(w).Encode(&response)
+		return
+	}
+	if errors.Is(err, errRefundExceeds) {
+		detail := fmt.Sprintf("%d left to refund on this payment", refundable)
+		w.WriteHeader(http.StatusConflict)
+		response.Data = dto.ErrorModel{Message: err.Error(), Details: []*string{&detail}}
+		json.NewEncoder(w).Encode(&response)
+		return
+	}
+	if errors.Is(err, errRefundConflict) {
+		w.WriteHeader(http.StatusConflict)
+		response.Data = dto.ErrorModel{Message: err.Error()}
+		json.NewEncoder(w).Encode(&response)
+		return
+	}
+	if errors.Is(err, ledger.ErrInsufficientBalance) {
+		attempted := payload.Amount
+		if attempted == 0 {
+			attempted = refundable
+		}
+		c.transferFailed(merchant.AccountID, "REFUND", attempted, err.Error(), nil, nil)
+		w.WriteHeader(http.StatusBadRequest)
+		response.Data = dto.ErrorModel{Message: "insufficient balance"}
+		json.NewEncoder(w).Encode(&response)
+		return
+	}
+	if models.IsRestricted(err) {
+		detail := err.Error()
+		w.WriteHeader(http.StatusForbidden)
+		response.Data = dto.ErrorModel{Message: "account restricted", Details: []*string{&detail}}
+		json.NewEncoder(w).Encode(&response)
+		return
+	}
+	if err != nil {
+		detail := err.Error()
+		w.WriteHeader(http.StatusInternalServerError)
+		response.Data = dto.ErrorModel{Message: "refund failed", Details: []*string{&detail}}
+		json.NewEncoder(w).Encode(&response)
+		return
+	}
+
+	if !replayed {
+		w.WriteHeader(http.StatusCreated)
+	}
+	response.Data = newRefundResponse(&refund, refundable)
+	json.NewEncoder(w).Encode(&response)
+}
@@ -0,0 +1,131 @@
+package controller
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/eclipseron/digital-wallet-app/dto"
+	"github.com/eclipseron/digital-wallet-app/ledger"
+	"github.com/eclipseron/digital-wallet-app/models"
+	"github.com/google/uuid"
+)
+
+func (c *Controller) AdminReverseTransactionHandler(w http.ResponseWriter, r *http.Request) {
+	var response dto.ResponseModel
+	response.ID = uuid.New()
+	response.Timestamp = time.Now().UTC()
+	w.Header().Add("Content-Type", "application/json")
+
+	param := r.PathValue("transactionId")
+	transactionId, err := uuid.Parse(param)
+	if err != nil {
+		detail := err.Error()
+		w.WriteHeader(http.StatusBadRequest)
+		response.Data = dto.ErrorModel{Message: "invalid id", Details: []*string{&detail}}
+		json.NewEncoder(w).Encode(&response)
+		return
+	}
+
+	type RequestModel struct {
+		// Amount is optional, leaving it out reverses the full transaction
+		Amount        int64  `json:"amount"`
+		Reason        string `json:"reason"`
+		AllowNegative bool   `json:"allowNegative"`
+	}
+	var payload RequestModel
+	if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+		detail := err.Error()
+		w.WriteHeader(http.StatusBadRequest)
+		response.Data = dto.ErrorModel{Message: "invalid request body", Details: []*string{&detail}}
+		json.NewEncoder(w).Encode(&response)
+		return
+	}
+	if strings.TrimSpace(payload.Reason) == "" {
+		detail := "reason is required"
+		w.WriteHeader(http.StatusBadRequest)
+		response.Data = dto.ErrorModel{Message: "invalid request body", Details: []*string{&detail}}
+		json.NewEncoder(w).Encode(&response)
+		return
+	}
+
+	tx := c.DB.Begin()
+	reversal, finalBalance, err := ledger.Reverse(tx, transactionId, payload.Amount, payload.Reason, payload.AllowNegative)
+	if errors.Is(err, ledger.ErrTransactionNotFound) {
+		tx.Rollback()
+		detail := fmt.Sprintf("transaction with id: %s not exist", transactionId.String())
+		w.WriteHeader(http.StatusNotFound)
+		response.Data = dto.ErrorModel{Message: "transaction not found", Details: []*string{&detail}}
+		json.NewEncoder(w).Encode(&response)
+		return
+	}
+	if errors.Is(err, ledger.ErrAlreadyReversed) || errors.Is(err, ledger.ErrNotReversible) ||
+		errors.Is(err, ledger.ErrInternalTransfer) {
+		tx.Rollback()
+		w.WriteHeader(http.StatusConflict)
+		response.Data = dto.ErrorModel{Message: err.Error()}
+		json.NewEncoder(w).Encode(&response)
+		return
+	}
+	if errors.Is(err, ledger.ErrReversalAmount) || errors.Is(err, ledger.ErrInsufficientBalance) ||
+		errors.Is(err, models.ErrAccountClosed) {
+		tx.Rollback()
+		w.WriteHeader(http.StatusBadRequest)
+		response.Data = dto.ErrorModel{Message: err.Error()}
+		json.NewEncoder(w).Encode(&response)
+		return
+	}
+	if err != nil {
+		tx.Rollback()
+		detail := err.Error()
+		w.WriteHeader(http.StatusInternalServerError)
+		response.Data = dto.ErrorModel{Message: "failed to reverse transaction", Details: []*string{&detail}}
+		json.NewEncoder(w).Encode(&response)
+		return
+	}
+
+	event := newAdminAudit(r, response.ID, "admin.transaction.reverse", "transaction", transactionId.String(), payload.Reason)
+	event.SetChanges(
+		map[string]any{"balance": finalBalance - reversal.Amount, "reversed": false},
+		map[string]any{"balance": finalBalance, "reversed": true, "reversalId": reversal.ID},
+	)
+	if err := tx.Create(&event).Error; err != nil {
+		tx.Rollback()
+		detail := err.Error()
+		w.WriteHeader(http.StatusInternalServerError)
+		response.Data = dto.ErrorModel{Message: "failed to write audit entry", Details: []*string{&detail}}
+		json.NewEncoder(w).Encode(&response)
+		return
+	}
+
+	if err := tx.Commit().Error; err != nil {
+		detail := err.Error()
+		w.WriteHeader(http.StatusInternalServerError)
+		response.Data = dto.ErrorModel{Message: "database error", Details: []*string{&detail}}
+		json.NewEncoder(w).Encode(&response)
+		return
+	}
+
+	type ReversalResponseModel struct {
+		TransactionId uuid.UUID `json:"transactionId"`
+		ReversalOf    uuid.UUID `json:"reversalOf"`
+		AccountId     uuid.UUID `json:"accountId"`
+		Amount        int64     `json:"amount"`
+		Type          string    `json:"type"`
+		FinalBalance  int64     `json:"finalBalance"`
+		At            time.Time `json:"at"`
+	}
+	response.Data = ReversalResponseModel{
+		TransactionId: reversal.ID,
+		ReversalOf:    transactionId,
+		AccountId:     reversal.AccountID,
+		Amount:        reversal.Amount,
+		Type:          reversal.Type,
+		FinalBalance:  finalBalance,
+		At:            reversal.CreatedAt.UTC(),
+	}
+	json.NewEncoder(w).Encode(&response)
+}
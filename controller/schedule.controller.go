@@ -0,0 +1,455 @@
+package controller
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/eclipseron/digital-wallet-app/dto"
+	"github.com/eclipseron/digital-wallet-app/middleware"
+	"github.com/eclipseron/digital-wallet-app/models"
+	"github.com/eclipseron/digital-wallet-app/scheduler"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+type ScheduleResponseModel struct {
+	ScheduleId       uuid.UUID  `json:"scheduleId"`
+	AccountId        uuid.UUID  `json:"accountId"`
+	Amount           int64      `json:"amount"`
+	Destination      string     `json:"to"`
+	BankName         string     `json:"bankName"`
+	Description      *string    `json:"description"`
+	Recurrence       *string    `json:"recurrence"`
+	StartAt          time.Time  `json:"startAt"`
+	EndAt            *time.Time `json:"endAt"`
+	MaxOccurrences   *int       `json:"maxOccurrences"`
+	Occurrences      int        `json:"occurrences"`
+	NextOccurrenceAt *time.Time `json:"nextOccurrenceAt"`
+	NextRunAt        *time.Time `json:"nextRunAt"`
+	Status           string     `json:"status"`
+	MaxRetries       int        `json:"maxRetries"`
+	RetryInterval    int64      `json:"retryInterval"`
+	LastRunAt        *time.Time `json:"lastRunAt"`
+	CreatedAt        time.Time  `json:"createdAt"`
+}
+
+func newScheduleResponse(s *models.ScheduledTransfer) ScheduleResponseModel {
+	return ScheduleResponseModel{
+		ScheduleId:       s.ID,
+		AccountId:        s.AccountID,
+		Amount:           s.Amount,
+		Destination:      s.Destination,
+		BankName:         s.BankName,
+		Description:      s.Description,
+		Recurrence:       s.Recurrence,
+		StartAt:          s.StartAt.UTC(),
+		EndAt:            s.EndAt,
+		MaxOccurrences:   s.MaxOccurrences,
+		Occurrences:      s.Occurrences,
+		NextOccurrenceAt: s.NextOccurrenceAt,
+		NextRunAt:        s.NextRunAt,
+		Status:           s.Status,
+		MaxRetries:       s.MaxRetries,
+		RetryInterval:    s.RetryInterval,
+		LastRunAt:        s.LastRunAt,
+		CreatedAt:        s.CreatedAt.UTC(),
+	}
+}
+
+func (c *Controller) CreateScheduleHandler(w http.ResponseWriter, r *http.Request) {
+	var response dto.ResponseModel
+	response.ID = uuid.New()
+	response.Timestamp = time.Now().UTC()
+	w.Header().Add("Content-Type", "application/json")
+
+	type RequestModel struct {
+		AccountID   string  `json:"accountId"`
+		Amount      int64   `json:"amount"`
+		Destination string  `json:"to"`
+		BankName    string  `json:"bankName"`
+		Description *string `json:"description"`
+		StartAt     string  `json:"startAt"`
+		// Recurrence is an RRULE, leaving it out schedules a one-off transfer
+		Recurrence     *string `json:"recurrence"`
+		EndAt          *string `json:"endAt"`
+		MaxOccurrences *int    `json:"maxOccurrences"`
+		// MaxRetries and RetryInterval (seconds) default to the server policy
+		MaxRetries    *int   `json:"maxRetries"`
+		RetryInterval *int64 `json:"retryInterval"`
+	}
+	var payload RequestModel
+	if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+		detail := err.Error()
+		w.WriteHeader(http.StatusBadRequest)
+		response.Data = dto.ErrorModel{Message: "invalid request body", Details: []*string{&detail}}
+		json.NewEncoder(w).Encode(&response)
+		return
+	}
+	if payload.Amount < 50000 {
+		detail := "minimum withdraw amount is Rp50.000"
+		w.WriteHeader(http.StatusBadRequest)
+		response.Data = dto.ErrorModel{Message: "invalid request body", Details: []*string{&detail}}
+		json.NewEncoder(w).Encode(&response)
+		return
+	}
+	if payload.AccountID == "" || payload.Destination == "" || payload.BankName == "" || payload.StartAt == "" {
+		detail := "accountId, to, bankName, and startAt is required"
+		w.WriteHeader(http.StatusBadRequest)
+		response.Data = dto.ErrorModel{Message: "invalid request body", Details: []*string{&detail}}
+		json.NewEncoder(w).Encode(&response)
+		return
+	}
+	accountId, err := uuid.Parse(payload.AccountID)
+	if err != nil {
+		detail := err.Error()
+		w.WriteHeader(http.StatusBadRequest)
+		response.Data = dto.ErrorModel{Message: "invalid id", Details: []*string{&detail}}
+		json.NewEncoder(w).Encode(&response)
+		return
+	}
+	startAt, err := time.Parse(time.RFC3339, payload.StartAt)
+	if err != nil {
+		detail := "startAt must be RFC3339"
+		w.WriteHeader(http.StatusBadRequest)
+		response.Data = dto.ErrorModel{Message: "invalid request body", Details: []*string{&detail}}
+		json.NewEncoder(w).Encode(&response)
+		return
+	}
+	if startAt.Before(time.Now().Add(-time.Minute)) {
+		detail := "startAt can not be in the past"
+		w.WriteHeader(http.StatusBadRequest)
+		response.Data = dto.ErrorModel{Message: "invalid request body", Details: []*string{&detail}}
+		json.NewEncoder(w).Encode(&response)
+		return
+	}
+	var endAt *time.Time
+	if payload.EndAt != nil {
+		t, err := time.Parse(time.RFC3339, *payload.EndAt)
+		if err != nil {
+			detail := "endAt must be RFC3339"
+			w.WriteHeader(http.StatusBadRequest)
+			response.Data = dto.ErrorModel{Message: "invalid request body", Details: []*string{&detail}}
+			json.NewEncoder(w).Encode(&response)
+			return
+		}
+		endAt = &t
+	}
+	if payload.MaxOccurrences != nil && *payload.MaxOccurrences < 1 {
+		detail := "maxOccurrences must be positive"
+		w.WriteHeader(http.StatusBadRequest)
+		response.Data = dto.ErrorModel{Message: "invalid request body", Details: []*string{&detail}}
+		json.NewEncoder(w).Encode(&response)
+		return
+	}
+
+	_uid, _ := r.Context().Value(middleware.USERID).(string)
+	var owner uuid.UUID
+	tx := c.DB.Raw(`SELECT user_id FROM accounts WHERE id = ?`, accountId.String()).Scan(&owner)
+	if tx.RowsAffected == 0 {
+		detail := fmt.Sprintf("account with id: %s not exist", accountId.String())
+		w.WriteHeader(http.StatusNotFound)
+		response.Data = dto.ErrorModel{Message: "account not found", Details: []*string{&detail}}
+		json.NewEncoder(w).Encode(&response)
+		return
+	}
+	if tx.Error != nil {
+		detail := tx.Error.Error()
+		w.WriteHeader(http.StatusInternalServerError)
+		response.Data = dto.ErrorModel{Message: "an error occured", Details: []*string{&detail}}
+		json.NewEncoder(w).Encode(&response)
+		return
+	}
+	if owner.String() != _uid {
+		detail := "This account does not belong to the user"
+		w.WriteHeader(http.StatusForbidden)
+		response.Data = dto.ErrorModel{Message: "forbidden", Details: []*string{&detail}}
+		json.NewEncoder(w).Encode(&response)
+		return
+	}
+
+	policy := scheduler.DefaultRetryPolicy()
+	schedule := models.ScheduledTransfer{
+		AccountID:      accountId,
+		UserID:         owner,
+		Amount:         payload.Amount,
+		Destination:    payload.Destination,
+		BankName:       payload.BankName,
+		Description:    payload.Description,
+		Recurrence:     payload.Recurrence,
+		StartAt:        startAt.UTC(),
+		EndAt:          endAt,
+		MaxOccurrences: payload.MaxOccurrences,
+		MaxRetries:     policy.MaxRetries,
+		RetryInterval:  int64(policy.Interval / time.Second),
+	}
+	if payload.MaxRetries != nil && *payload.MaxRetries >= 0 {
+		schedule.MaxRetries = *payload.MaxRetries
+	}
+	if payload.RetryInterval != nil && *payload.RetryInterval > 0 {
+		schedule.RetryInterval = *payload.RetryInterval
+	}
+	if err := scheduler.Init(&schedule); err != nil {
+		detail := err.Error()
+		w.WriteHeader(http.StatusBadRequest)
+		response.Data = dto.ErrorModel{Message: "invalid recurrence", Details: []*string{&detail}}
+		json.NewEncoder(w).Encode(&response)
+		return
+	}
+
+	tx = c.DB.Begin()
+	if err := tx.Create(&schedule).Error; err != nil {
+		tx.Rollback()
+		detail := err.Error()
+		w.WriteHeader(http.StatusInternalServerError)
+		response.Data = dto.ErrorModel{Message: "failed to create schedule", Details: []*string{&detail}}
+		json.NewEncoder(w).Encode(&response)
+		return
+	}
+
+	event := newAuditEvent(r, response.ID, "schedule.create", "scheduled_transfer", schedule.ID.String())
+	event.SetChanges(nil, map[string]any{
+		"amount": schedule.Amount, "to": schedule.Destination, "recurrence": schedule.Recurrence,
+		"status": schedule.Status,
+	})
+	if err := tx.Create(&event).Error; err != nil {
+		tx.Rollback()
+		detail := err.Error()
+		w.WriteHeader(http.StatusInternalServerError)
+		response.Data = dto.ErrorModel{Message: "failed to write audit entry", Details: []*string{&detail}}
+		json.NewEncoder(w).Encode(&response)
+		return
+	}
+
+	if err := tx.Commit().Error; err != nil {
+		detail := err.Error()
+		w.WriteHeader(http.StatusInternalServerError)
+		response.Data = dto.ErrorModel{Message: "database error", Details: []*string{&detail}}
+		json.NewEncoder(w).Encode(&response)
+		return
+	}
+
+	w.WriteHeader(http.StatusCreated)
+	response.Data = newScheduleResponse(&schedule)
+	json.NewEncoder(w).Encode(&response)
+}
+
+func (c *Controller) ListSchedulesHandler(w http.ResponseWriter, r *http.Request) {
+	var response dto.ResponseModel
+	response.ID = uuid.New()
+	response.Timestamp = time.Now().UTC()
+	w.Header().Add("Content-Type", "application/json")
+
+	_uid, _ := r.Context().Value(middleware.USERID).(string)
+	limit, offset := parsePagination(r)
+	query := c.DB.Where("user_id = ?", _uid)
+	if status := r.URL.Query().Get("status"); status != "" {
+		query = query.Where("status = ?", status)
+	}
+	if accountId := r.URL.Query().Get("accountId"); accountId != "" {
+		query = query.Where("account_id = ?", accountId)
+	}
+
+	var schedules []models.ScheduledTransfer
+	if err := query.Order("created_at DESC").Limit(limit).Offset(offset).Find(&schedules).Error; err != nil {
+		detail := err.Error()
+		w.WriteHeader(http.StatusInternalServerError)
+		response.Data = dto.ErrorModel{Message: "an error occured", Details: []*string{&detail}}
+		json.NewEncoder(w).Encode(&response)
+		return
+	}
+
+	data := make([]ScheduleResponseModel, 0, len(schedules))
+	for i := range schedules {
+		data = append(data, newScheduleResponse(&schedules[i]))
+	}
+	response.Data = data
+	json.NewEncoder(w).Encode(&response)
+}
+
+func (c *Controller) ListScheduleRunsHandler(w http.ResponseWriter, r *http.Request) {
+	var response dto.ResponseModel
+	response.ID = uuid.New()
+	response.Timestamp = time.Now().UTC()
+	w.Header().Add("Content-Type", "application/json")
+
+	param := r.PathValue("scheduleId")
+	scheduleId, err := uuid.Parse(param)
+	if err != nil {
+		detail := err.Error()
+		w.WriteHeader(http.StatusBadRequest)
+		response.Data = dto.ErrorModel{Message: "invalid id", Details: []*string{&detail}}
+		json.NewEncoder(w).Encode(&response)
+		return
+	}
+
+	var owner uuid.UUID
+	tx := c.DB.Raw(`SELECT user_id FROM scheduled_transfers WHERE id = ?`, scheduleId.String()).Scan(&owner)
+	if tx.RowsAffected == 0 {
+		detail := fmt.Sprintf("schedule with id: %s not exist", scheduleId.String())
+		w.WriteHeader(http.StatusNotFound)
+		response.Data = dto.ErrorModel{Message: "schedule not found", Details: []*string{&detail}}
+		json.NewEncoder(w).Encode(&response)
+		return
+	}
+	if tx.Error != nil {
+		detail := tx.Error.Error()
+		w.WriteHeader(http.StatusInternalServerError)
+		response.Data = dto.ErrorModel{Message: "an error occured", Details: []*string{&detail}}
+		json.NewEncoder(w).Encode(&response)
+		return
+	}
+	if !canManageAccount(r, owner) {
+		detail := "This schedule does not belong to the user"
+		w.WriteHeader(http.StatusForbidden)
+		response.Data = dto.ErrorModel{Message: "forbidden", Details: []*string{&detail}}
+		json.NewEncoder(w).Encode(&response)
+		return
+	}
+
+	limit, offset := parsePagination(r)
+	var runs []models.ScheduledTransferRun
+	err = c.DB.Where("scheduled_transfer_id = ?", scheduleId.String()).
+		Order("created_at DESC").Limit(limit).Offset(offset).Find(&runs).Error
+	if err != nil {
+		detail := err.Error()
+		w.WriteHeader(http.StatusInternalServerError)
+		response.Data = dto.ErrorModel{Message: "an error occured", Details: []*string{&detail}}
+		json.NewEncoder(w).Encode(&response)
+		return
+	}
+
+	type RunResponseModel struct {
+		RunId         uuid.UUID  `json:"runId"`
+		ScheduledFor  time.Time  `json:"scheduledFor"`
+		Attempt       int        `json:"attempt"`
+		Status        string     `json:"status"`
+		Error         *string    `json:"error"`
+		TransactionId *uuid.UUID `json:"transactionId"`
+		At            time.Time  `json:"at"`
+	}
+	data := make([]RunResponseModel, 0, len(runs))
+	for _, run := range runs {
+		data = append(data, RunResponseModel{
+			RunId:         run.ID,
+			ScheduledFor:  run.ScheduledFor.UTC(),
+			Attempt:       run.Attempt,
+			Status:        run.Status,
+			Error:         run.Error,
+			TransactionId: run.TransactionID,
+			At:            run.CreatedAt.UTC(),
+		})
+	}
+	response.Data = data
+	json.NewEncoder(w).Encode(&response)
+}
+
+func (c *Controller) PauseScheduleHandler(w http.ResponseWriter, r *http.Request) {
+	c.changeSchedule(w, r, models.ScheduleStatusPaused)
+}
+
+func (c *Controller) ResumeScheduleHandler(w http.ResponseWriter, r *http.Request) {
+	c.changeSchedule(w, r, models.ScheduleStatusActive)
+}
+
+func (c *Controller) CancelScheduleHandler(w http.ResponseWriter, r *http.Request) {
+	c.changeSchedule(w, r, models.ScheduleStatusCancelled)
+}
+
+var (
+	errForbidden          = errors.New("forbidden")
+	errScheduleTransition = errors.New("schedule can not move to this status")
+)
+
+func (c *Controller) changeSchedule(w http.ResponseWriter, r *http.Request, to string) {
+	var response dto.ResponseModel
+	response.ID = uuid.New()
+	response.Timestamp = time.Now().UTC()
+	w.Header().Add("Content-Type", "application/json")
+
+	param := r.PathValue("scheduleId")
+	scheduleId, err := uuid.Parse(param)
+	if err != nil {
+		detail := err.Error()
+		w.WriteHeader(http.StatusBadRequest)
+		response.Data = dto.ErrorModel{Message: "invalid id", Details: []*string{&detail}}
+		json.NewEncoder(w).Encode(&response)
+		return
+	}
+
+	var schedule models.ScheduledTransfer
+	var from string
+	err = c.DB.Transaction(func(tx *gorm.DB) error {
+		res := tx.Raw(`SELECT * FROM scheduled_transfers WHERE id = ? FOR UPDATE`, scheduleId.String()).Scan(&schedule)
+		if res.Error != nil {
+			return res.Error
+		}
+		if res.RowsAffected == 0 {
+			return gorm.ErrRecordNotFound
+		}
+		if !canManageAccount(r, schedule.UserID) {
+			return errForbidden
+		}
+
+		from = schedule.Status
+		switch {
+		case to == models.ScheduleStatusPaused && from == models.ScheduleStatusActive:
+			schedule.Status = models.ScheduleStatusPaused
+			schedule.NextRunAt = nil
+		case to == models.ScheduleStatusActive && from == models.ScheduleStatusPaused:
+			if err := scheduler.Resume(&schedule, time.Now().UTC()); err != nil {
+				return err
+			}
+		case to == models.ScheduleStatusCancelled &&
+			(from == models.ScheduleStatusActive || from == models.ScheduleStatusPaused):
+			schedule.Status = models.ScheduleStatusCancelled
+			schedule.NextRunAt = nil
+		default:
+			return errScheduleTransition
+		}
+
+		err := tx.Model(&schedule).Select(
+			"status", "next_occurrence_at", "next_run_at", "retry_attempt", "updated_at",
+		).Updates(&schedule).Error
+		if err != nil {
+			return err
+		}
+
+		event := newAuditEvent(r, response.ID, "schedule.status", "scheduled_transfer", schedule.ID.String())
+		event.SetChanges(map[string]any{"status": from}, map[string]any{"status": schedule.Status})
+		return tx.Create(&event).Error
+	})
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		detail := fmt.Sprintf("schedule with id: %s not exist", scheduleId.String())
+		w.WriteHeader(http.StatusNotFound)
+		response.Data = dto.ErrorModel{Message: "schedule not found", Details: []*string{&detail}}
+		json.NewEncoder(w).Encode(&response)
+		return
+	}
+	if errors.Is(err, errForbidden) {
+		detail := "This schedule does not belong to the user"
+		w.WriteHeader(http.StatusForbidden)
+		response.Data = dto.ErrorModel{Message: "forbidden", Details: []*string{&detail}}
+		json.NewEncoder(w).Encode(&response)
+		return
+	}
+	if errors.Is(err, errScheduleTransition) {
+		detail := fmt.Sprintf("schedule is %s", from)
+		w.WriteHeader(http.StatusConflict)
+		response.Data = dto.ErrorModel{Message: err.Error(), Details: []*string{&detail}}
+		json.NewEncoder(w).Encode(&response)
+		return
+	}
+	if err != nil {
+		detail := err.Error()
+		w.WriteHeader(http.StatusInternalServerError)
+		response.Data = dto.ErrorModel{Message: "failed to update schedule", Details: []*string{&detail}}
+		json.NewEncoder(w).Encode(&response)
+		return
+	}
+
+	response.Data = newScheduleResponse(&schedule)
+	json.NewEncoder(w).Encode(&response)
+}
@@ -0,0 +1,129 @@
+package controller
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/eclipseron/digital-wallet-app/dto"
+	"github.com/eclipseron/digital-wallet-app/middleware"
+	"github.com/eclipseron/digital-wallet-app/models"
+	"github.com/eclipseron/digital-wallet-app/settlement"
+	"github.com/google/uuid"
+)
+
+type SettlementReportResponseModel struct {
+	MerchantId uuid.UUID        `json:"merchantId"`
+	AccountId  uuid.UUID        `json:"accountId"`
+	From       string           `json:"from"`
+	To         string           `json:"to"`
+	TimeZone   string           `json:"timeZone"`
+	Cutoff     string           `json:"cutoff"`
+	Days       []settlement.Row `json:"days"`
+	Total      settlement.Row   `json:"total"`
+}
+
+// MerchantSettlementHandler is the settlement report of an owned merchant.
+func (c *Controller) MerchantSettlementHandler(w http.ResponseWriter, r *http.Request) {
+	var response dto.ResponseModel
+	response.ID = uuid.New()
+	response.Timestamp = time.Now().UTC()
+	w.Header().Add("Content-Type", "application/json")
+
+	merchant := c.ownedMerchant(w, r, &response)
+	if merchant == nil {
+		return
+	}
+	c.writeSettlementReport(w, r, &response, merchant)
+}
+
+// SettlementReportHandler is the settlement report of the merchant behind
+// the API key.
+func (c *Controller) SettlementReportHandler(w http.ResponseWriter, r *http.Request) {
+	var response dto.ResponseModel
+	response.ID = uuid.New()
+	response.Timestamp = time.Now().UTC()
+	w.Header().Add("Content-Type", "application/json")
+
+	_mid, _ := r.Context().Value(middleware.MERCHANTID).(string)
+	var merchant models.Merchant
+	if err := c.DB.Where("id = ?", _mid).First(&merchant).Error; err != nil {
+		detail := err.Error()
+		w.WriteHeader(http.StatusInternalServerError)
+		response.Data = dto.ErrorModel{Message: "an error occured", Details: []*string{&detail}}
+		json.NewEncoder(w).Encode(&response)
+		return
+	}
+	c.writeSettlementReport(w, r, &response, &merchant)
+}
+
+// writeSettlementReport answers ?from=&to= (YYYY-MM-DD business days, the
+// last 7 by default) as JSON, or as a CSV download with ?format=csv.
+func (c *Controller) writeSettlementReport(w http.ResponseWriter, r *http.Request, response *dto.ResponseModel, merchant *models.Merchant) {
+	cutoff := settlement.Cutoff()
+	query := r.URL.Query()
+	var err error
+	to := settlement.Day(time.Now(), cutoff)
+	if s := query.Get("to"); s != "" {
+		to, err = settlement.ParseDate(s)
+	}
+	from := to.AddDate(0, 0, -6)
+	if s := query.Get("from"); s != "" && err == nil {
+		from, err = settlement.ParseDate(s)
+	}
+	if err != nil {
+		detail := err.Error()
+		w.WriteHeader(http.StatusBadRequest)
+		response.Data = dto.ErrorModel{Message: "invalid request", Details: []*string{&detail}}
+		json.NewEncoder(w).Encode(response)
+		return
+	}
+	format := strings.ToLower(query.Get("format"))
+	if format != "" && format != "json" && format != "csv" {
+		detail := "format must be json or csv"
+		w.WriteHeader(http.StatusBadRequest)
+		response.Data = dto.ErrorModel{Message: "invalid request", Details: []*string{&detail}}
+		json.NewEncoder(w).Encode(response)
+		return
+	}
+
+	rows, err := settlement.Report(c.DB, merchant.AccountID, from, to)
+	if errors.Is(err, settlement.ErrRange) {
+		detail := err.Error()
+		w.WriteHeader(http.StatusBadRequest)
+		response.Data = dto.ErrorModel{Message: "invalid request", Details: []*string{&detail}}
+		json.NewEncoder(w).Encode(response)
+		return
+	}
+	if err != nil {
+		detail := err.Error()
+		w.WriteHeader(http.StatusInternalServerError)
+		response.Data = dto.ErrorModel{Message: "failed to build settlement report", Details: []*string{&detail}}
+		json.NewEncoder(w).Encode(response)
+		return
+	}
+
+	if format == "csv" {
+		filename := fmt.Sprintf("settlement_%s_%s_%s.csv",
+			merchant.ID.String(), from.Format(time.DateOnly), to.Format(time.DateOnly))
+		w.Header().Set("Content-Type", "text/csv")
+		w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", filename))
+		settlement.WriteCSV(w, rows)
+		return
+	}
+
+	response.Data = SettlementReportResponseModel{
+		MerchantId: merchant.ID,
+		AccountId:  merchant.AccountID,
+		From:       from.Format(time.DateOnly),
+		To:         to.Format(time.DateOnly),
+		TimeZone:   settlement.Location.String(),
+		Cutoff:     time.Time{}.Add(cutoff).Format("15:04"),
+		Days:       rows,
+		Total:      settlement.Sum(rows),
+	}
+	json.NewEncoder(w).Encode(response)
+}
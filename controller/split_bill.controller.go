@@ -0,0 +1,700 @@
+package controller
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/eclipseron/digital-wallet-app/billsplit"
+	"github.com/eclipseron/digital-wallet-app/dto"
+	"github.com/eclipseron/digital-wallet-app/ledger"
+	"github.com/eclipseron/digital-wallet-app/middleware"
+	"github.com/eclipseron/digital-wallet-app/models"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+const (
+	defaultReminderInterval = 24 * time.Hour
+	maxSplitParticipants    = 50
+)
+
+var (
+	errSplitBillClosed = errors.New("split bill is no longer open")
+	errShareNotOwed    = errors.New("you have no unpaid share in this bill")
+)
+
+type SplitBillShareResponseModel struct {
+	ShareId       uuid.UUID  `json:"shareId"`
+	UserId        uuid.UUID  `json:"userId"`
+	Amount        int64      `json:"amount"`
+	Percent       *float64   `json:"percent"`
+	Status        string     `json:"status"`
+	TransactionId *uuid.UUID `json:"transactionId"`
+	PaidAt        *time.Time `json:"paidAt"`
+	RemindersSent int        `json:"remindersSent"`
+}
+
+type SplitBillResponseModel struct {
+	BillId      uuid.UUID                     `json:"billId"`
+	OrganizerId uuid.UUID                     `json:"organizerId"`
+	AccountId   uuid.UUID                     `json:"accountId"`
+	Title       string                        `json:"title"`
+	TotalAmount int64                         `json:"totalAmount"`
+	PaidAmount  int64                         `json:"paidAmount"`
+	Method      string                        `json:"method"`
+	Status      string                        `json:"status"`
+	DueAt       *time.Time                    `json:"dueAt"`
+	Shares      []SplitBillShareResponseModel `json:"shares"`
+	CreatedAt   time.Time                     `json:"createdAt"`
+}
+
+func newSplitBillResponse(b *models.SplitBill) SplitBillResponseModel {
+	res := SplitBillResponseModel{
+		BillId:      b.ID,
+		OrganizerId: b.OrganizerID,
+		AccountId:   b.AccountID,
+		Title:       b.Title,
+		TotalAmount: b.TotalAmount,
+		Method:      b.Method,
+		Status:      b.Status,
+		DueAt:       b.DueAt,
+		Shares:      make([]SplitBillShareResponseModel, 0, len(b.Shares)),
+		CreatedAt:   b.CreatedAt.UTC(),
+	}
+	for _, s := range b.Shares {
+		share := SplitBillShareResponseModel{
+			ShareId:       s.ID,
+			UserId:        s.UserID,
+			Amount:        s.Amount,
+			Status:        s.Status,
+			TransactionId: s.TransactionID,
+			PaidAt:        s.PaidAt,
+			RemindersSent: s.RemindersSent,
+		}
+		if s.Percent != nil {
+			p := float64(*s.Percent) / 100
+			share.Percent = &p
+		}
+		if s.Status == models.SharePaid {
+			res.PaidAmount += s.Amount
+		}
+		res.Shares = append(res.Shares, share)
+	}
+	return res
+}
+
+func (c *Controller) CreateSplitBillHandler(w http.ResponseWriter, r *http.Request) {
+	var response dto.ResponseModel
+	response.ID = uuid.New()
+	response.Timestamp = time.Now().UTC()
+	w.Header().Add("Content-Type", "application/json")
+
+	_uid, _ := r.Context().Value(middleware.USERID).(string)
+	userId, err := uuid.Parse(_uid)
+	if err != nil {
+		detail := err.Error()
+		w.WriteHeader(http.StatusUnauthorized)
+		response.Data = dto.ErrorModel{Message: "invalid token payload", Details: []*string{&detail}}
+		json.NewEncoder(w).Encode(&response)
+		return
+	}
+
+	type ParticipantModel struct {
+		Email string `json:"email"`
+		// Amount is used by CUSTOM bills, Percent by PERCENT bills
+		Amount  int64   `json:"amount"`
+		Percent float64 `json:"percent"`
+	}
+	type RequestModel struct {
+		AccountId    uuid.UUID          `json:"accountId"`
+		Title        string             `json:"title"`
+		TotalAmount  int64              `json:"totalAmount"`
+		Method       string             `json:"method"`
+		Participants []ParticipantModel `json:"participants"`
+		DueAt        *string            `json:"dueAt"`
+		// ReminderIntervalHours defaults to 24
+		ReminderIntervalHours int64 `json:"reminderIntervalHours"`
+	}
+	var payload RequestModel
+	if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+		detail := err.Error()
+		w.WriteHeader(http.StatusBadRequest)
+		response.Data = dto.ErrorModel{Message: "invalid request body", Details: []*string{&detail}}
+		json.NewEncoder(w).Encode(&response)
+		return
+	}
+	payload.Title = strings.TrimSpace(payload.Title)
+	if payload.Title == "" || len(payload.Title) > 100 {
+		detail := "title is required and at most 100 characters"
+		w.WriteHeader(http.StatusBadRequest)
+		response.Data = dto.ErrorModel{Message: "invalid request body", Details: []*string{&detail}}
+		json.NewEncoder(w).Encode(&response)
+		return
+	}
+	if payload.TotalAmount <= 0 {
+		detail := "totalAmount must be positive"
+		w.WriteHeader(http.StatusBadRequest)
+		response.Data = dto.ErrorModel{Message: "invalid request body", Details: []*string{&detail}}
+		json.NewEncoder(w).Encode(&response)
+		return
+	}
+	if len(payload.Participants) == 0 || len(payload.Participants) > maxSplitParticipants {
+		detail := fmt.Sprintf("a bill needs between 1 and %d participants", maxSplitParticipants)
+		w.WriteHeader(http.StatusBadRequest)
+		response.Data = dto.ErrorModel{Message: "invalid request body", Details: []*string{&detail}}
+		json.NewEncoder(w).Encode(&response)
+		return
+	}
+	var dueAt *time.Time
+	if payload.DueAt != nil {
+		at, err := time.Parse(time.RFC3339, *payload.DueAt)
+		if err != nil || !at.After(time.Now()) {
+			detail := "dueAt must be a future RFC3339 time"
+			w.WriteHeader(http.StatusBadRequest)
+			response.Data = dto.ErrorModel{Message: "invalid request body", Details: []*string{&detail}}
+			json.NewEncoder(w).Encode(&response)
+			return
+		}
+		dueAt = &at
+	}
+	interval := defaultReminderInterval
+	if payload.ReminderIntervalHours > 0 {
+		interval = time.Duration(payload.ReminderIntervalHours) * time.Hour
+	}
+
+	method := strings.ToUpper(payload.Method)
+	var amounts []int64
+	var basisPoints []int64
+	switch method {
+	case models.SplitMethodEqual:
+		amounts, err = billsplit.Equal(payload.TotalAmount, len(payload.Participants))
+	case models.SplitMethodCustom:
+		for _, p := range payload.Participants {
+			amounts = append(amounts, p.Amount)
+		}
+		amounts, err = billsplit.Custom(payload.TotalAmount, amounts)
+	case models.SplitMethodPercent:
+		for _, p := range payload.Participants {
+			bp := math.Round(p.Percent * 100)
+			if math.Abs(bp-p.Percent*100) > 1e-6 {
+				err = errors.New("percentages have at most two decimals")
+				break
+			}
+			basisPoints = append(basisPoints, int64(bp))
+		}
+		if err == nil {
+			amounts, err = billsplit.ByPercent(payload.TotalAmount, basisPoints)
+		}
+	default:
+		err = fmt.Errorf("method must be one of %s, %s or %s",
+			models.SplitMethodEqual, models.SplitMethodCustom, models.SplitMethodPercent)
+	}
+	if err != nil {
+		detail := err.Error()
+		w.WriteHeader(http.StatusBadRequest)
+		response.Data = dto.ErrorModel{Message: "invalid request body", Details: []*string{&detail}}
+		json.NewEncoder(w).Encode(&response)
+		return
+	}
+
+	var owner uuid.UUID
+	tx := c.DB.Raw(`SELECT user_id FROM accounts WHERE id = ? AND deleted_at IS NULL`, payload.AccountId.String()).Scan(&owner)
+	if tx.RowsAffected == 0 {
+		detail := fmt.Sprintf("account with id: %s not exist", payload.AccountId.String())
+		w.WriteHeader(http.StatusNotFound)
+		response.Data = dto.ErrorModel{Message: "account not found", Details: []*string{&detail}}
+		json.NewEncoder(w).Encode(&response)
+		return
+	}
+	if tx.Error != nil {
+		detail := tx.Error.Error()
+		w.WriteHeader(http.StatusInternalServerError)
+		response.Data = dto.ErrorModel{Message: "an error occured", Details: []*string{&detail}}
+		json.NewEncoder(w).Encode(&response)
+		return
+	}
+	if owner != userId {
+		detail := "This account does not belong to the user"
+		w.WriteHeader(http.StatusForbidden)
+		response.Data = dto.ErrorModel{Message: "forbidden", Details: []*string{&detail}}
+		json.NewEncoder(w).Encode(&response)
+		return
+	}
+
+	emails := make([]string, 0, len(payload.Participants))
+	for _, p := range payload.Participants {
+		emails = append(emails, strings.TrimSpace(p.Email))
+	}
+	var users []struct {
+		ID    uuid.UUID
+		Email string
+	}
+	if err := c.DB.Raw(`SELECT id, email FROM users WHERE email IN ? AND deleted_at IS NULL`, emails).Scan(&users).Error; err != nil {
+		detail := err.Error()
+		w.WriteHeader(http.StatusInternalServerError)
+		response.Data = dto.ErrorModel{Message: "an error occured", Details: []*string{&detail}}
+		json.NewEncoder(w).Encode(&response)
+		return
+	}
+	ids := make(map[string]uuid.UUID, len(users))
+	for _, u := range users {
+		ids[u.Email] = u.ID
+	}
+
+	bill := models.SplitBill{
+		OrganizerID:      userId,
+		AccountID:        payload.AccountId,
+		Title:            payload.Title,
+		TotalAmount:      payload.TotalAmount,
+		Method:           method,
+		Status:           models.SplitBillOpen,
+		DueAt:            dueAt,
+		ReminderInterval: int64(interval / time.Second),
+	}
+	seen := map[uuid.UUID]bool{}
+	now := time.Now()
+	// with reminders turned off no share is ever scheduled for one
+	var firstReminder *time.Time
+	if billsplit.MaxReminders() > 0 {
+		at := now.Add(interval)
+		firstReminder = &at
+	}
+	for i, email := range emails {
+		id, ok := ids[email]
+		if !ok {
+			detail := fmt.Sprintf("user with email: %s not exist", email)
+			w.WriteHeader(http.StatusNotFound)
+			response.Data = dto.ErrorModel{Message: "participant not found", Details: []*string{&detail}}
+			json.NewEncoder(w).Encode(&response)
+			return
+		}
+		if seen[id] {
+			detail := fmt.Sprintf("%s is listed twice", email)
+			w.WriteHeader(http.StatusBadRequest)
+			response.Data = dto.ErrorModel{Message: "invalid request body", Details: []*string{&detail}}
+			json.NewEncoder(w).Encode(&response)
+			return
+		}
+		seen[id] = true
+
+		share := models.SplitBillShare{UserID: id, Amount: amounts[i], Status: models.ShareUnpaid, NextReminderAt: firstReminder}
+		if basisPoints != nil {
+			share.Percent = &basisPoints[i]
+		}
+		// the organizer's own share never moves money
+		if id == userId {
+			share.Status = models.SharePaid
+			share.PaidAt = &now
+			share.NextReminderAt = nil
+		}
+		bill.Shares = append(bill.Shares, share)
+	}
+	if len(bill.Shares) == 1 && bill.Shares[0].UserID == userId {
+		detail := "a bill needs at least one participant other than the organizer"
+		w.WriteHeader(http.StatusBadRequest)
+		response.Data = dto.ErrorModel{Message: "invalid request body", Details: []*string{&detail}}
+		json.NewEncoder(w).Encode(&response)
+		return
+	}
+
+	err = c.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&bill).Error; err != nil {
+			return err
+		}
+		event := newAuditEvent(r, response.ID, "split_bill.create", "split_bill", bill.ID.String())
+		event.SetChanges(nil, map[string]any{
+			"totalAmount":  bill.TotalAmount,
+			"method":       bill.Method,
+			"participants": len(bill.Shares),
+		})
+		return tx.Create(&event).Error
+	})
+	if err != nil {
+		detail := err.Error()
+		w.WriteHeader(http.StatusInternalServerError)
+		response.Data = dto.ErrorModel{Message: "failed to create split bill", Details: []*string{&detail}}
+		json.NewEncoder(w).Encode(&response)
+		return
+	}
+
+	w.WriteHeader(http.StatusCreated)
+	response.Data = newSplitBillResponse(&bill)
+	json.NewEncoder(w).Encode(&response)
+}
+
+// ListSplitBillsHandler lists the bills the caller organizes, or with
+// ?role=participant the bills the caller has a share in.
+func (c *Controller) ListSplitBillsHandler(w http.ResponseWriter, r *http.Request) {
+	var response dto.ResponseModel
+	response.ID = uuid.New()
+	response.Timestamp = time.Now().UTC()
+	w.Header().Add("Content-Type", "application/json")
+
+	_uid, _ := r.Context().Value(middleware.USERID).(string)
+	limit, offset := parsePagination(r)
+
+	db := c.DB.Preload("Shares")
+	switch r.URL.Query().Get("role") {
+	case "", "organizer":
+		db = db.Where("organizer_id = ?", _uid)
+	case "participant":
+		db = db.Where("id IN (SELECT split_bill_id FROM split_bill_shares WHERE user_id = ?)", _uid)
+	default:
+		detail := "role must be organizer or participant"
+		w.WriteHeader(http.StatusBadRequest)
+		response.Data = dto.ErrorModel{Message: "invalid request", Details: []*string{&detail}}
+		json.NewEncoder(w).Encode(&response)
+		return
+	}
+
+	var bills []models.SplitBill
+	if err := db.Order("created_at DESC").Limit(limit).Offset(offset).Find(&bills).Error; err != nil {
+		detail := err.Error()
+		w.WriteHeader(http.StatusInternalServerError)
+		response.Data = dto.ErrorModel{Message: "an error occured", Details: []*string{&detail}}
+		json.NewEncoder(w).Encode(&response)
+		return
+	}
+
+	data := make([]SplitBillResponseModel, 0, len(bills))
+	for i := range bills {
+		data = append(data, newSplitBillResponse(&bills[i]))
+	}
+	response.Data = data
+	json.NewEncoder(w).Encode(&response)
+}
+
+func (c *Controller) GetSplitBillHandler(w http.ResponseWriter, r *http.Request) {
+	var response dto.ResponseModel
+	response.ID = uuid.New()
+	response.Timestamp = time.Now().UTC()
+	w.Header().Add("Content-Type", "application/json")
+
+	_uid, _ := r.Context().Value(middleware.USERID).(string)
+	billId, err := uuid.Parse(r.PathValue("billId"))
+	if err != nil {
+		detail := err.Error()
+		w.WriteHeader(http.StatusBadRequest)
+		response.Data = dto.ErrorModel{Message: "invalid id", Details: []*string{&detail}}
+		json.NewEncoder(w).Encode(&response)
+		return
+	}
+
+	var bill models.SplitBill
+	tx := c.DB.Preload("Shares").Where("id = ?", billId.String()).Limit(1).Find(&bill)
+	if tx.Error != nil {
+		detail := tx.Error.Error()
+		w.WriteHeader(http.StatusInternalServerError)
+		response.Data = dto.ErrorModel{Message: "an error occured", Details: []*string{&detail}}
+		json.NewEncoder(w).Encode(&response)
+		return
+	}
+	member := tx.RowsAffected > 0 && bill.OrganizerID.String() == _uid
+	for _, s := range bill.Shares {
+		member = member || s.UserID.String() == _uid
+	}
+	if !member {
+		detail := fmt.Sprintf("split bill with id: %s not exist", billId.String())
+		w.WriteHeader(http.StatusNotFound)
+		response.Data = dto.ErrorModel{Message: "split bill not found", Details: []*string{&detail}}
+		json.NewEncoder(w).Encode(&response)
+		return
+	}
+
+	response.Data = newSplitBillResponse(&bill)
+	json.NewEncoder(w).Encode(&response)
+}
+
+// PaySplitBillShareHandler pays the caller's share into the organizer's
+// account. The bill is locked so the last payment settles it exactly once.
+func (c *Controller) PaySplitBillShareHandler(w http.ResponseWriter, r *http.Request) {
+	var response dto.ResponseModel
+	response.ID = uuid.New()
+	response.Timestamp = time.Now().UTC()
+	w.Header().Add("Content-Type", "application/json")
+
+	_uid, _ := r.Context().Value(middleware.USERID).(string)
+	userId, err := uuid.Parse(_uid)
+	if err != nil {
+		detail := err.Error()
+		w.WriteHeader(http.StatusUnauthorized)
+		response.Data = dto.ErrorModel{Message: "invalid token payload", Details: []*string{&detail}}
+		json.NewEncoder(w).Encode(&response)
+		return
+	}
+	billId, err := uuid.Parse(r.PathValue("billId"))
+	if err != nil {
+		detail := err.Error()
+		w.WriteHeader(http.StatusBadRequest)
+		response.Data = dto.ErrorModel{Message: "invalid id", Details: []*string{&detail}}
+		json.NewEncoder(w).Encode(&response)
+		return
+	}
+
+	type RequestModel struct {
+		AccountId uuid.UUID `json:"accountId"`
+		Pin       string    `json:"pin"`
+	}
+	var payload RequestModel
+	if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+		detail := err.Error()
+		w.WriteHeader(http.StatusBadRequest)
+		response.Data = dto.ErrorModel{Message: "invalid request body", Details: []*string{&detail}}
+		json.NewEncoder(w).Encode(&response)
+		return
+	}
+
+	var owner uuid.UUID
+	tx := c.DB.Raw(`SELECT user_id FROM accounts WHERE id = ? AND deleted_at IS NULL`, payload.AccountId.String()).Scan(&owner)
+	if tx.RowsAffected == 0 {
+		detail := fmt.Sprintf("account with id: %s not exist", payload.AccountId.String())
+		w.WriteHeader(http.StatusNotFound)
+		response.Data = dto.ErrorModel{Message: "account not found", Details: []*string{&detail}}
+		json.NewEncoder(w).Encode(&response)
+		return
+	}
+	if tx.Error != nil {
+		detail := tx.Error.Error()
+		w.WriteHeader(http.StatusInternalServerError)
+		response.Data = dto.ErrorModel{Message: "an error occured", Details: []*string{&detail}}
+		json.NewEncoder(w).Encode(&response)
+		return
+	}
+	if owner != userId {
+		detail := "This account does not belong to the user"
+		w.WriteHeader(http.StatusForbidden)
+		response.Data = dto.ErrorModel{Message: "forbidden", Details: []*string{&detail}}
+		json.NewEncoder(w).Encode(&response)
+		return
+	}
+
+	if err := c.verifyPin(userId, payload.Pin); err != nil {
+		status := http.StatusForbidden
+		if !errors.Is(err, errPin) {
+			status = http.StatusInternalServerError
+		}
+		detail := err.Error()
+		w.WriteHeader(status)
+		response.Data = dto.ErrorModel{Message: "pin verification failed", Details: []*string{&detail}}
+		json.NewEncoder(w).Encode(&response)
+		return
+	}
+
+	var bill models.SplitBill
+	var share models.SplitBillShare
+	var balance int64
+	err = c.DB.Transaction(func(tx *gorm.DB) error {
+		res := tx.Raw(`SELECT * FROM split_bills WHERE id = ? FOR UPDATE`, billId.String()).Scan(&bill)
+		if res.Error != nil {
+			return res.Error
+		}
+		if res.RowsAffected == 0 {
+			return gorm.ErrRecordNotFound
+		}
+		res = tx.Raw(`
+		SELECT * FROM split_bill_shares WHERE split_bill_id = ? AND user_id = ? FOR UPDATE
+		`, bill.ID.String(), userId.String()).Scan(&share)
+		if res.Error != nil {
+			return res.Error
+		}
+		if res.RowsAffected == 0 {
+			return gorm.ErrRecordNotFound
+		}
+		if bill.Status != models.SplitBillOpen {
+			return errSplitBillClosed
+		}
+		if share.Status != models.ShareUnpaid {
+			return errShareNotOwed
+		}
+
+		outDesc := fmt.Sprintf("Split bill: %s", bill.Title)
+		inDesc := outDesc
+		debit := models.Transactions{Type: "TRANSFER_OUT", Description: &outDesc}
+		credit := models.Transactions{Type: "TRANSFER_IN", Description: &inDesc}
+		var err error
+		balance, err = ledger.Transfer(tx, payload.AccountId, bill.AccountID, share.Amount, &debit, &credit)
+		if err != nil {
+			return err
+		}
+
+		now := time.Now()
+		share.Status = models.SharePaid
+		share.PayerAccountID = &payload.AccountId
+		share.TransactionID = &debit.ID
+		share.PaidAt = &now
+		share.NextReminderAt = nil
+		err = tx.Model(&share).Select("status", "payer_account_id", "transaction_id", "paid_at", "next_reminder_at", "updated_at").
+			Updates(&share).Error
+		if err != nil {
+			return err
+		}
+
+		var unpaid int64
+		err = tx.Model(&models.SplitBillShare{}).
+			Where("split_bill_id = ? AND status = ?", bill.ID, models.ShareUnpaid).Count(&unpaid).Error
+		if err != nil {
+			return err
+		}
+		if unpaid == 0 {
+			bill.Status = models.SplitBillSettled
+			if err := tx.Model(&bill).Select("status", "updated_at").Updates(&bill).Error; err != nil {
+				return err
+			}
+		}
+
+		err = models.Notify(tx, bill.OrganizerID, models.NotificationSplitBillPaid, "Split bill share paid",
+			fmt.Sprintf("A participant paid Rp%d for %q, %d shares left.", share.Amount, bill.Title, unpaid),
+			map[string]any{"splitBillId": bill.ID, "shareId": share.ID, "userId": userId})
+		if err != nil {
+			return err
+		}
+
+		event := newAuditEvent(r, response.ID, "split_bill.pay", "split_bill_share", share.ID.String())
+		event.SetChanges(
+			map[string]any{"status": models.ShareUnpaid},
+			map[string]any{"status": share.Status, "accountId": payload.AccountId, "amount": share.Amount},
+		)
+		return tx.Create(&event).Error
+	})
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		detail := fmt.Sprintf("split bill with id: %s not exist", billId.String())
+		w.WriteHeader(http.StatusNotFound)
+		response.Data = dto.ErrorModel{Message: "split bill not found", Details: []*string{&detail}}
+		json.NewEncoder(w).Encode(&response)
+		return
+	}
+	if errors.Is(err, errSplitBillClosed) || errors.Is(err, errShareNotOwed) {
+		w.WriteHeader(http.StatusConflict)
+		response.Data = dto.ErrorModel{Message: err.Error()}
+		json.NewEncoder(w).Encode(&response)
+		return
+	}
+	if errors.Is(err, ledger.ErrSameAccount) {
+		detail := "the paying account is the one collecting the bill"
+		w.WriteHeader(http.StatusBadRequest)
+		response.Data = dto.ErrorModel{Message: "invalid request body", Details: []*string{&detail}}
+		json.NewEncoder(w).Encode(&response)
+		return
+	}
+	if errors.Is(err, ledger.ErrInsufficientBalance) {
+		c.transferFailed(payload.AccountId, "TRANSFER_OUT", share.Amount, err.Error(), nil, nil)
+		w.WriteHeader(http.StatusBadRequest)
+		response.Data = dto.ErrorModel{Message: "insufficient balance"}
+		json.NewEncoder(w).Encode(&response)
+		return
+	}
+	if models.IsRestricted(err) {
+		c.transferFailed(payload.AccountId, "TRANSFER_OUT", share.Amount, err.Error(), nil, nil)
+		detail := err.Error()
+		w.WriteHeader(http.StatusForbidden)
+		response.Data = dto.ErrorModel{Message: "account restricted", Details: []*string{&detail}}
+		json.NewEncoder(w).Encode(&response)
+		return
+	}
+	if err != nil {
+		detail := err.Error()
+		w.WriteHeader(http.StatusInternalServerError)
+		response.Data = dto.ErrorModel{Message: "payment failed", Details: []*string{&detail}}
+		json.NewEncoder(w).Encode(&response)
+		return
+	}
+
+	if err := c.DB.Where("split_bill_id = ?", bill.ID).Order("created_at").Find(&bill.Shares).Error; err != nil {
+		bill.Shares = []models.SplitBillShare{share}
+	}
+	type PayResponseModel struct {
+		SplitBillResponseModel
+		FinalBalance int64 `json:"finalBalance"`
+	}
+	response.Data = PayResponseModel{SplitBillResponseModel: newSplitBillResponse(&bill), FinalBalance: balance}
+	json.NewEncoder(w).Encode(&response)
+}
+
+// CancelSplitBillHandler closes an open bill. Paid shares stay with the
+// organizer, unpaid ones are cancelled and no longer reminded.
+func (c *Controller) CancelSplitBillHandler(w http.ResponseWriter, r *http.Request) {
+	var response dto.ResponseModel
+	response.ID = uuid.New()
+	response.Timestamp = time.Now().UTC()
+	w.Header().Add("Content-Type", "application/json")
+
+	_uid, _ := r.Context().Value(middleware.USERID).(string)
+	billId, err := uuid.Parse(r.PathValue("billId"))
+	if err != nil {
+		detail := err.Error()
+		w.WriteHeader(http.StatusBadRequest)
+		response.Data = dto.ErrorModel{Message: "invalid id", Details: []*string{&detail}}
+		json.NewEncoder(w).Encode(&response)
+		return
+	}
+
+	var bill models.SplitBill
+	err = c.DB.Transaction(func(tx *gorm.DB) error {
+		res := tx.Raw(`SELECT * FROM split_bills WHERE id = ? FOR UPDATE`, billId.String()).Scan(&bill)
+		if res.Error != nil {
+			return res.Error
+		}
+		if res.RowsAffected == 0 {
+			return gorm.ErrRecordNotFound
+		}
+		if bill.OrganizerID.String() != _uid {
+			return errForbidden
+		}
+		if bill.Status != models.SplitBillOpen {
+			return errSplitBillClosed
+		}
+
+		bill.Status = models.SplitBillCancelled
+		if err := tx.Model(&bill).Select("status", "updated_at").Updates(&bill).Error; err != nil {
+			return err
+		}
+		err := tx.Exec(`
+		UPDATE split_bill_shares SET status = ?, next_reminder_at = NULL, updated_at = now()
+		WHERE split_bill_id = ? AND status = ?
+		`, models.ShareCancelled, bill.ID.String(), models.ShareUnpaid).Error
+		if err != nil {
+			return err
+		}
+
+		event := newAuditEvent(r, response.ID, "split_bill.cancel", "split_bill", bill.ID.String())
+		event.SetChanges(map[string]any{"status": models.SplitBillOpen}, map[string]any{"status": bill.Status})
+		return tx.Create(&event).Error
+	})
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		detail := fmt.Sprintf("split bill with id: %s not exist", billId.String())
+		w.WriteHeader(http.StatusNotFound)
+		response.Data = dto.ErrorModel{Message: "split bill not found", Details: []*string{&detail}}
+		json.NewEncoder(w).Encode(&response)
+		return
+	}
+	if errors.Is(err, errForbidden) {
+		detail := "only the organizer can cancel a split bill"
+		w.WriteHeader(http.StatusForbidden)
+		response.Data = dto.ErrorModel{Message: "forbidden", Details: []*string{&detail}}
+		json.NewEncoder(w).Encode(&response)
+		return
+	}
+	if errors.Is(err, errSplitBillClosed) {
+		detail := fmt.Sprintf("split bill is %s", strings.ToLower(bill.Status))
+		w.WriteHeader(http.StatusConflict)
+		response.Data = dto.ErrorModel{Message: err.Error(), Details: []*string{&detail}}
+		json.NewEncoder(w).Encode(&response)
+		return
+	}
+	if err != nil {
+		detail := err.Error()
+		w.WriteHeader(http.StatusInternalServerError)
+		response.Data = dto.ErrorModel{Message: "failed to cancel split bill", Details: []*string{&detail}}
+		json.NewEncoder(w).Encode(&response)
+		return
+	}
+
+	c.DB.Where("split_bill_id = ?", bill.ID).Order("created_at").Find(&bill.Shares)
+	response.Data = newSplitBillResponse(&bill)
+	json.NewEncoder(w).Encode(&response)
+}
@@ -0,0 +1,329 @@
+package controller
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/eclipseron/digital-wallet-app/dto"
+	"github.com/eclipseron/digital-wallet-app/models"
+	"github.com/eclipseron/digital-wallet-app/settlement"
+	"github.com/eclipseron/digital-wallet-app/statement"
+	"github.com/google/uuid"
+)
+
+// statementWriteTimeout replaces the server's write timeout while a statement
+// streams, long ranges take a while to render.
+const statementWriteTimeout = 10 * time.Minute
+
+// GetStatementHandler exports the statement of one of the caller's accounts.
+func (c *Controller) GetStatementHandler(w http.ResponseWriter, r *http.Request) {
+	var response dto.ResponseModel
+	response.ID = uuid.New()
+	response.Timestamp = time.Now().UTC()
+	w.Header().Add("Content-Type", "application/json")
+
+	accountId, ok := c.ownedAccount(w, r, &response)
+	if !ok {
+		return
+	}
+	c.writeStatement(w, r, &response, accountId, nil)
+}
+
+// AdminGetStatementHandler exports the statement of any account for the
+// accounting team. Like every admin read it needs a reason.
+func (c *Controller) AdminGetStatementHandler(w http.ResponseWriter, r *http.Request) {
+	var response dto.ResponseModel
+	response.ID = uuid.New()
+	response.Timestamp = time.Now().UTC()
+	w.Header().Add("Content-Type", "application/json")
+
+	accountId, err := uuid.Parse(r.PathValue("accountId"))
+	if err != nil {
+		detail := err.Error()
+		w.WriteHeader(http.StatusBadRequest)
+		response.Data = dto.ErrorModel{Message: "invalid id", Details: []*string{&detail}}
+		json.NewEncoder(w).Encode(&response)
+		return
+	}
+	reason := strings.TrimSpace(r.URL.Query().Get("reason"))
+	if reason == "" {
+		detail := "reason query parameter is required"
+		w.WriteHeader(http.StatusBadRequest)
+		response.Data = dto.ErrorModel{Message: "invalid request", Details: []*string{&detail}}
+		json.NewEncoder(w).Encode(&response)
+		return
+	}
+
+	// the audit entry is written once the account is known to exist
+	audit := func() error {
+		event := newAdminAudit(r, response.ID, "admin.account.statement", "account", accountId.String(), reason)
+		return c.DB.Create(&event).Error
+	}
+	c.writeStatement(w, r, &response, accountId, audit)
+}
+
+// writeStatement streams the statement for ?from=&to= (YYYY-MM-DD days in
+// Asia/Jakarta, both included, the current month by default) in ?format=
+// csv, pdf, ofx or json. Errors are answered as JSON until the first byte of
+// the statement is written, after that the response can only be cut short.
+func (c *Controller) writeStatement(w http.ResponseWriter, r *http.Request, response *dto.ResponseModel,
+	accountId uuid.UUID, before func() error) {
+	query := r.URL.Query()
+	loc := settlement.Location
+	var err error
+	to := settlement.Day(time.Now(), 0)
+	if s := query.Get("to"); s != "" {
+		to, err = settlement.ParseDate(s)
+	}
+	from := time.Date(to.Year(), to.Month(), 1, 0, 0, 0, 0, loc)
+	if s := query.Get("from"); s != "" && err == nil {
+		from, err = settlement.ParseDate(s)
+	}
+	if err == nil && to.Before(from) {
+		err = errors.New("from must not be after to")
+	}
+	format := strings.ToLower(query.Get("format"))
+	if format == "" {
+		format = statement.FormatCSV
+	}
+	var out statement.Writer
+	if err == nil {
+		out, err = statement.NewWriter(format, w)
+	}
+	if err != nil {
+		detail := err.Error()
+		w.WriteHeader(http.StatusBadRequest)
+		response.Data = dto.ErrorModel{Message: "invalid request", Details: []*string{&detail}}
+		json.NewEncoder(w).Encode(response)
+		return
+	}
+	end := to.AddDate(0, 0, 1)
+
+	started := false
+	begin := func(s *statement.Summary) error {
+		if before != nil {
+			if err := before(); err != nil {
+				return err
+			}
+		}
+		filename := fmt.Sprintf("statement_%s_%s_%s.%s",
+			s.AccountNumber, from.Format(time.DateOnly), to.Format(time.DateOnly), format)
+		http.NewResponseController(w).SetWriteDeadline(time.Now().Add(statementWriteTimeout))
+		w.Header().Set("Content-Type", statement.ContentType(format))
+		w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", filename))
+		w.WriteHeader(http.StatusOK)
+		started = true
+		return nil
+	}
+
+	err = statement.Generate(r.Context(), c.DB, accountId, from, end, loc, begin, out)
+	if err != nil && started {
+		log.Printf("statement of account %s was cut short: %v", accountId.String(), err)
+		return
+	}
+	if errors.Is(err, statement.ErrAccountNotFound) {
+		detail := fmt.Sprintf("account with id: %s not exist", accountId.String())
+		w.WriteHeader(http.StatusNotFound)
+		response.Data = dto.ErrorModel{Message: "account not found", Details: []*string{&detail}}
+		json.NewEncoder(w).Encode(response)
+		return
+	}
+	if err != nil {
+		detail := err.Error()
+		w.WriteHeader(http.StatusInternalServerError)
+		response.Data = dto.ErrorModel{Message: "failed to export statement", Details: []*string{&detail}}
+		json.NewEncoder(w).Encode(response)
+		return
+	}
+}
+
+type MonthlyStatementResponseModel struct {
+	StatementId uuid.UUID       `json:"statementId"`
+	AccountId   uuid.UUID       `json:"accountId"`
+	Period      string          `json:"period"`
+	PeriodStart time.Time       `json:"periodStart"`
+	PeriodEnd   time.Time       `json:"periodEnd"`
+	Opening     int64           `json:"openingBalance"`
+	Closing     int64           `json:"closingBalance"`
+	Credits     int64           `json:"totalCredits"`
+	Debits      int64           `json:"totalDebits"`
+	Count       int64           `json:"transactionCount"`
+	Totals      json.RawMessage `json:"totalsByType"`
+	Hash        string          `json:"hash"`
+	CreatedAt   time.Time       `json:"createdAt"`
+}
+
+func newMonthlyStatementResponse(s *models.MonthlyStatement) MonthlyStatementResponseModel {
+	return MonthlyStatementResponseModel{
+		StatementId: s.ID,
+		AccountId:   s.AccountID,
+		Period:      s.Period,
+		PeriodStart: s.PeriodStart.UTC(),
+		PeriodEnd:   s.PeriodEnd.UTC(),
+		Opening:     s.Opening,
+		Closing:     s.Closing,
+		Credits:     s.Credits,
+		Debits:      s.Debits,
+		Count:       s.Count,
+		Totals:      json.RawMessage(s.Totals),
+		Hash:        s.Hash,
+		CreatedAt:   s.CreatedAt.UTC(),
+	}
+}
+
+// ListMonthlyStatementsHandler lists the archived statements of an account,
+// newest month first. The documents themselves are downloaded one by one.
+func (c *Controller) ListMonthlyStatementsHandler(w http.ResponseWriter, r *http.Request) {
+	var response dto.ResponseModel
+	response.ID = uuid.New()
+	response.Timestamp = time.Now().UTC()
+	w.Header().Add("Content-Type", "application/json")
+
+	accountId, ok := c.ownedAccount(w, r, &response)
+	if !ok {
+		return
+	}
+	limit, offset := parsePagination(r)
+
+	var statements []models.MonthlyStatement
+	err := c.DB.Omit("document").Where("account_id = ?", accountId.String()).
+		Order("period DESC").Limit(limit).Offset(offset).Find(&statements).Error
+	if err != nil {
+		detail := err.Error()
+		w.WriteHeader(http.StatusInternalServerError)
+		response.Data = dto.ErrorModel{Message: "an error occured", Details: []*string{&detail}}
+		json.NewEncoder(w).Encode(&response)
+		return
+	}
+
+	data := make([]MonthlyStatementResponseModel, 0, len(statements))
+	for i := range statements {
+		data = append(data, newMonthlyStatementResponse(&statements[i]))
+	}
+	response.Data = data
+	json.NewEncoder(w).Encode(&response)
+}
+
+// GetMonthlyStatementHandler downloads an archived statement exactly as it
+// was stored, X-Content-SHA256 carries its hash.
+func (c *Controller) GetMonthlyStatementHandler(w http.ResponseWriter, r *http.Request) {
+	var response dto.ResponseModel
+	response.ID = uuid.New()
+	response.Timestamp = time.Now().UTC()
+	w.Header().Add("Content-Type", "application/json")
+
+	accountId, ok := c.ownedAccount(w, r, &response)
+	if !ok {
+		return
+	}
+	stmt := c.monthlyStatement(w, r, &response, accountId)
+	if stmt == nil {
+		return
+	}
+
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=\"statement_%s.json\"", stmt.Period))
+	w.Header().Set("X-Content-SHA256", stmt.Hash)
+	w.Write(stmt.Document)
+}
+
+// AdminVerifyMonthlyStatementHandler renders an archived month again and
+// compares it byte for byte with the stored document.
+func (c *Controller) AdminVerifyMonthlyStatementHandler(w http.ResponseWriter, r *http.Request) {
+	var response dto.ResponseModel
+	response.ID = uuid.New()
+	response.Timestamp = time.Now().UTC()
+	w.Header().Add("Content-Type", "application/json")
+
+	accountId, err := uuid.Parse(r.PathValue("accountId"))
+	if err != nil {
+		detail := err.Error()
+		w.WriteHeader(http.StatusBadRequest)
+		response.Data = dto.ErrorModel{Message: "invalid id", Details: []*string{&detail}}
+		json.NewEncoder(w).Encode(&response)
+		return
+	}
+	reason := strings.TrimSpace(r.URL.Query().Get("reason"))
+	if reason == "" {
+		detail := "reason query parameter is required"
+		w.WriteHeader(http.StatusBadRequest)
+		response.Data = dto.ErrorModel{Message: "invalid request", Details: []*string{&detail}}
+		json.NewEncoder(w).Encode(&response)
+		return
+	}
+	stmt := c.monthlyStatement(w, r, &response, accountId)
+	if stmt == nil {
+		return
+	}
+
+	document, _, err := statement.Render(r.Context(), c.DB, accountId, stmt.PeriodStart)
+	if err != nil {
+		detail := err.Error()
+		w.WriteHeader(http.StatusInternalServerError)
+		response.Data = dto.ErrorModel{Message: "failed to render statement", Details: []*string{&detail}}
+		json.NewEncoder(w).Encode(&response)
+		return
+	}
+
+	type VerifyResponseModel struct {
+		Period          string `json:"period"`
+		Hash            string `json:"hash"`
+		RegeneratedHash string `json:"regeneratedHash"`
+		Identical       bool   `json:"identical"`
+	}
+	result := VerifyResponseModel{
+		Period:          stmt.Period,
+		Hash:            stmt.Hash,
+		RegeneratedHash: statement.Hash(document),
+		Identical:       bytes.Equal(document, stmt.Document),
+	}
+
+	event := newAdminAudit(r, response.ID, "admin.account.statement.verify", "account", accountId.String(), reason)
+	event.SetChanges(nil, result)
+	if err := c.DB.Create(&event).Error; err != nil {
+		detail := err.Error()
+		w.WriteHeader(http.StatusInternalServerError)
+		response.Data = dto.ErrorModel{Message: "failed to write audit entry", Details: []*string{&detail}}
+		json.NewEncoder(w).Encode(&response)
+		return
+	}
+
+	response.Data = result
+	json.NewEncoder(w).Encode(&response)
+}
+
+// monthlyStatement loads the statement of the period in the path, it writes
+// the error response itself and returns nil on failure.
+func (c *Controller) monthlyStatement(w http.ResponseWriter, r *http.Request, response *dto.ResponseModel, accountId uuid.UUID) *models.MonthlyStatement {
+	period := r.PathValue("period")
+	if _, _, err := statement.ParseMonth(period); err != nil {
+		detail := "period must be YYYY-MM"
+		w.WriteHeader(http.StatusBadRequest)
+		response.Data = dto.ErrorModel{Message: "invalid request", Details: []*string{&detail}}
+		json.NewEncoder(w).Encode(response)
+		return nil
+	}
+
+	var stmt models.MonthlyStatement
+	tx := c.DB.Where("account_id = ? AND period = ?", accountId.String(), period).Limit(1).Find(&stmt)
+	if tx.Error != nil {
+		detail := tx.Error.Error()
+		w.WriteHeader(http.StatusInternalServerError)
+		response.Data = dto.ErrorModel{Message: "an error occured", Details: []*string{&detail}}
+		json.NewEncoder(w).Encode(response)
+		return nil
+	}
+	if tx.RowsAffected == 0 {
+		detail := fmt.Sprintf("no statement for %s", period)
+		w.WriteHeader(http.StatusNotFound)
+		response.Data = dto.ErrorModel{Message: "statement not found", Details: []*string{&detail}}
+		json.NewEncoder(w).Encode(response)
+		return nil
+	}
+	return &stmt
+}
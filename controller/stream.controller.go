@@ -0,0 +1,160 @@
+package controller
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/eclipseron/digital-wallet-app/dto"
+	"github.com/eclipseron/digital-wallet-app/middleware"
+	"github.com/eclipseron/digital-wallet-app/models"
+	"github.com/google/uuid"
+)
+
+const streamHeartbeat = 15 * time.Second
+
+// AccountEventsHandler streams the account's outbox events as Server-Sent
+// Events. The event id is the outbox position, a client that reconnects with
+// Last-Event-ID (or ?lastEventId= for a first connect) gets every event after
+// it before the live ones.
+func (c *Controller) AccountEventsHandler(w http.ResponseWriter, r *http.Request) {
+	var response dto.ResponseModel
+	response.ID = uuid.New()
+	response.Timestamp = time.Now().UTC()
+	w.Header().Add("Content-Type", "application/json")
+
+	param := r.PathValue("accountId")
+	accountId, err := uuid.Parse(param)
+	if err != nil {
+		detail := err.Error()
+		w.WriteHeader(http.StatusBadRequest)
+		response.Data = dto.ErrorModel{Message: "invalid id", Details: []*string{&detail}}
+		json.NewEncoder(w).Encode(&response)
+		return
+	}
+
+	lastEventId := r.Header.Get("Last-Event-ID")
+	if lastEventId == "" {
+		lastEventId = r.URL.Query().Get("lastEventId")
+	}
+	var lastSent int64 = -1
+	if lastEventId != "" {
+		lastSent, err = strconv.ParseInt(lastEventId, 10, 64)
+		if err != nil || lastSent < 0 {
+			detail := "Last-Event-ID must be a non-negative integer"
+			w.WriteHeader(http.StatusBadRequest)
+			response.Data = dto.ErrorModel{Message: "invalid request", Details: []*string{&detail}}
+			json.NewEncoder(w).Encode(&response)
+			return
+		}
+	}
+
+	_uid, _ := r.Context().Value(middleware.USERID).(string)
+	var owner uuid.UUID
+	tx := c.DB.Raw(`SELECT user_id FROM accounts WHERE id = ?`, accountId.String()).Scan(&owner)
+	if tx.RowsAffected == 0 {
+		detail := fmt.Sprintf("account with id: %s not exist", accountId.String())
+		w.WriteHeader(http.StatusNotFound)
+		response.Data = dto.ErrorModel{Message: "account not found", Details: []*string{&detail}}
+		json.NewEncoder(w).Encode(&response)
+		return
+	}
+	if tx.Error != nil {
+		detail := tx.Error.Error()
+		w.WriteHeader(http.StatusInternalServerError)
+		response.Data = dto.ErrorModel{Message: "an error occured", Details: []*string{&detail}}
+		json.NewEncoder(w).Encode(&response)
+		return
+	}
+	if _uid != owner.String() {
+		detail := "This account does not belong to the user"
+		w.WriteHeader(http.StatusForbidden)
+		response.Data = dto.ErrorModel{Message: "forbidden", Details: []*string{&detail}}
+		json.NewEncoder(w).Encode(&response)
+		return
+	}
+	if c.Events == nil {
+		w.WriteHeader(http.StatusServiceUnavailable)
+		response.Data = dto.ErrorModel{Message: "event stream is not available"}
+		json.NewEncoder(w).Encode(&response)
+		return
+	}
+
+	// subscribe before the replay so nothing committed in between is lost,
+	// duplicates are skipped by position
+	sub := c.Events.Subscribe(accountId)
+	defer sub.Close()
+
+	// streams outlive the server's write timeout
+	rc := http.NewResponseController(w)
+	if err := rc.SetWriteDeadline(time.Time{}); err != nil {
+		detail := err.Error()
+		w.WriteHeader(http.StatusInternalServerError)
+		response.Data = dto.ErrorModel{Message: "streaming is not supported", Details: []*string{&detail}}
+		json.NewEncoder(w).Encode(&response)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+	fmt.Fprint(w, "retry: 3000\n\n")
+
+	write := func(event models.OutboxEvent) error {
+		_, err := fmt.Fprintf(w, "id: %d\nevent: %s\ndata: %s\n\n", event.Position, event.Type, event.Payload)
+		lastSent = event.Position
+		return err
+	}
+
+	if lastSent >= 0 {
+		for {
+			var missed []models.OutboxEvent
+			err := c.DB.Where("account_id = ? AND position > ?", accountId.String(), lastSent).
+				Order("position").Limit(500).Find(&missed).Error
+			if err != nil {
+				fmt.Fprintf(w, "event: error\ndata: %q\n\n", "failed to load missed events")
+				return
+			}
+			for _, event := range missed {
+				if err := write(event); err != nil {
+					return
+				}
+			}
+			if len(missed) < 500 {
+				break
+			}
+		}
+	}
+	if err := rc.Flush(); err != nil {
+		return
+	}
+
+	heartbeat := time.NewTicker(streamHeartbeat)
+	defer heartbeat.Stop()
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case <-heartbeat.C:
+			fmt.Fprint(w, ": ping\n\n")
+		case event, ok := <-sub.C:
+			if !ok {
+				// dropped by the hub, the client resumes from lastSent
+				return
+			}
+			if event.Position <= lastSent {
+				continue
+			}
+			if err := write(event); err != nil {
+				return
+			}
+		}
+		if err := rc.Flush(); err != nil {
+			return
+		}
+	}
+}
@@ -2,16 +2,30 @@ package controller
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
+	"log"
 	"net/http"
 	"time"
 
 	"github.com/eclipseron/digital-wallet-app/dto"
+	"github.com/eclipseron/digital-wallet-app/ledger"
 	"github.com/eclipseron/digital-wallet-app/middleware"
 	"github.com/eclipseron/digital-wallet-app/models"
 	"github.com/google/uuid"
 )
 
+// transferFailed writes transfer.failed once the handler's own transaction
+// is rolled back, so like recordAudit a write error is only logged.
+func (c *Controller) transferFailed(accountID uuid.UUID, txType string, amount int64, reason string, destination, bankName *string) {
+	err := models.PublishTransferFailed(c.DB, accountID, txType, amount, reason, destination, bankName)
+	if err != nil {
+		log.Println("failed to write outbox event:", err)
+	}
+}
+
+// WithdrawHandler debits cash taken out without a terminal involved. Cash
+// taken from an ATM goes through a withdrawal code, see CreateATMCodeHandler.
 func (c *Controller) WithdrawHandler(w http.ResponseWriter, r *http.Request) {
 	var response dto.ResponseModel
 	response.ID = uuid.New()
@@ -62,12 +76,14 @@ func (c *Controller) WithdrawHandler(w http.ResponseWriter, r *http.Request) {
 		UserId        uuid.UUID
 		AccountNumber string
 		Balance       int64
+		Available     int64
+		Status        string
 	}
 
 	var account Account
 
 	tx := c.DB.Raw(`
-	SELECT id, user_id, account_number, balance
+	SELECT id, user_id, account_number, balance, balance - held_balance - pocket_balance AS available, status
 	FROM accounts WHERE id = ?
 	`, accountId.String()).Scan(&account)
 	if tx.RowsAffected == 0 {
@@ -91,36 +107,68 @@ func (c *Controller) WithdrawHandler(w http.ResponseWriter, r *http.Request) {
 		json.NewEncoder(w).Encode(&response)
 		return
 	}
-	if account.Balance < payload.Amount {
+	if err := models.CheckDebit(account.Status); err != nil {
+		detail := err.Error()
+		c.transferFailed(account.ID, "WITHDRAW", payload.Amount, detail, nil, nil)
+		w.WriteHeader(http.StatusForbidden)
+		response.Data = dto.ErrorModel{Message: "account restricted", Details: []*string{&detail}}
+		json.NewEncoder(w).Encode(&response)
+		return
+	}
+	if account.Available < payload.Amount {
+		c.transferFailed(account.ID, "WITHDRAW", payload.Amount, ledger.ErrInsufficientBalance.Error(), nil, nil)
 		w.WriteHeader(http.StatusBadRequest)
 		response.Data = dto.ErrorModel{Message: "insufficient balance"}
 		json.NewEncoder(w).Encode(&response)
 		return
 	}
 
-	account.Balance -= payload.Amount
+	// the ledger checks status and available balance again under the row lock
+	desc := "Cash Withdrawal"
+	accTx := models.Transactions{
+		AccountID:   account.ID,
+		Type:        "WITHDRAW",
+		Description: &desc,
+	}
 	tx = c.DB.Begin()
-	if err := tx.Save(&account).Error; err != nil {
+	account.Balance, err = ledger.Debit(tx, &accTx, payload.Amount)
+	if errors.Is(err, ledger.ErrInsufficientBalance) {
+		tx.Rollback()
+		c.transferFailed(account.ID, "WITHDRAW", payload.Amount, err.Error(), nil, nil)
+		w.WriteHeader(http.StatusBadRequest)
+		response.Data = dto.ErrorModel{Message: "insufficient balance"}
+		json.NewEncoder(w).Encode(&response)
+		return
+	}
+	if models.IsRestricted(err) {
 		tx.Rollback()
 		detail := err.Error()
+		c.transferFailed(account.ID, "WITHDRAW", payload.Amount, detail, nil, nil)
+		w.WriteHeader(http.StatusForbidden)
+		response.Data = dto.ErrorModel{Message: "account restricted", Details: []*string{&detail}}
+		json.NewEncoder(w).Encode(&response)
+		return
+	}
+	if err != nil {
+		tx.Rollback()
+		detail := err.Error()
+		c.transferFailed(account.ID, "WITHDRAW", payload.Amount, detail, nil, nil)
 		w.WriteHeader(http.StatusInternalServerError)
-		response.Data = dto.ErrorModel{Message: "failed to update balance", Details: []*string{&detail}}
+		response.Data = dto.ErrorModel{Message: "failed to create transaction", Details: []*string{&detail}}
 		json.NewEncoder(w).Encode(&response)
 		return
 	}
 
-	desc := "ATM Cash Withdrawal"
-	accTx := models.Transactions{
-		AccountID:   account.ID,
-		Amount:      -payload.Amount,
-		Type:        "WITHDRAW",
-		Description: &desc,
-	}
-	if err := tx.Create(&accTx).Error; err != nil {
+	event := newAuditEvent(r, response.ID, "transaction.withdraw", "transaction", accTx.ID.String())
+	event.SetChanges(
+		map[string]int64{"balance": account.Balance + payload.Amount},
+		map[string]int64{"balance": account.Balance},
+	)
+	if err := tx.Create(&event).Error; err != nil {
 		tx.Rollback()
 		detail := err.Error()
 		w.WriteHeader(http.StatusInternalServerError)
-		response.Data = dto.ErrorModel{Message: "failed to create transaction", Details: []*string{&detail}}
+		response.Data = dto.ErrorModel{Message: "failed to write audit entry", Details: []*string{&detail}}
 		json.NewEncoder(w).Encode(&response)
 		return
 	}
@@ -205,12 +253,14 @@ func (c *Controller) BankWithdrawHandler(w http.ResponseWriter, r *http.Request)
 		UserId        uuid.UUID
 		AccountNumber string
 		Balance       int64
+		Available     int64
+		Status        string
 	}
 
 	var account Account
 
 	tx := c.DB.Raw(`
-	SELECT id, user_id, account_number, balance
+	SELECT id, user_id, account_number, balance, balance - held_balance - pocket_balance AS available, status
 	FROM accounts WHERE id = ?
 	`, accountId.String()).Scan(&account)
 	if tx.RowsAffected == 0 {
@@ -234,38 +284,63 @@ func (c *Controller) BankWithdrawHandler(w http.ResponseWriter, r *http.Request)
 		json.NewEncoder(w).Encode(&response)
 		return
 	}
-	if account.Balance < payload.Amount {
+	if err := models.CheckDebit(account.Status); err != nil {
+		detail := err.Error()
+		c.transferFailed(account.ID, "TRANSFER_OUT", payload.Amount, detail, &payload.Destination, &payload.BankName)
+		w.WriteHeader(http.StatusForbidden)
+		response.Data = dto.ErrorModel{Message: "account restricted", Details: []*string{&detail}}
+		json.NewEncoder(w).Encode(&response)
+		return
+	}
+	if account.Available < payload.Amount {
+		c.transferFailed(account.ID, "TRANSFER_OUT", payload.Amount, ledger.ErrInsufficientBalance.Error(), &payload.Destination, &payload.BankName)
 		w.WriteHeader(http.StatusBadRequest)
 		response.Data = dto.ErrorModel{Message: "insufficient balance"}
 		json.NewEncoder(w).Encode(&response)
 		return
 	}
 
-	account.Balance -= payload.Amount
+	// the ledger checks status and available balance again under the row lock
 	tx = c.DB.Begin()
-	if err := tx.Save(&account).Error; err != nil {
+	accTx, finalBalance, err := ledger.BankTransfer(tx, account.ID, payload.Amount, payload.Destination, payload.BankName)
+	if errors.Is(err, ledger.ErrInsufficientBalance) {
+		tx.Rollback()
+		c.transferFailed(account.ID, "TRANSFER_OUT", payload.Amount, err.Error(), &payload.Destination, &payload.BankName)
+		w.WriteHeader(http.StatusBadRequest)
+		response.Data = dto.ErrorModel{Message: "insufficient balance"}
+		json.NewEncoder(w).Encode(&response)
+		return
+	}
+	if models.IsRestricted(err) {
+		tx.Rollback()
+		detail := err.Error()
+		c.transferFailed(account.ID, "TRANSFER_OUT", payload.Amount, detail, &payload.Destination, &payload.BankName)
+		w.WriteHeader(http.StatusForbidden)
+		response.Data = dto.ErrorModel{Message: "account restricted", Details: []*string{&detail}}
+		json.NewEncoder(w).Encode(&response)
+		return
+	}
+	if err != nil {
 		tx.Rollback()
 		detail := err.Error()
+		c.transferFailed(account.ID, "TRANSFER_OUT", payload.Amount, detail, &payload.Destination, &payload.BankName)
 		w.WriteHeader(http.StatusInternalServerError)
-		response.Data = dto.ErrorModel{Message: "failed to update balance", Details: []*string{&detail}}
+		response.Data = dto.ErrorModel{Message: "failed to create transaction", Details: []*string{&detail}}
 		json.NewEncoder(w).Encode(&response)
 		return
 	}
+	account.Balance = finalBalance
 
-	desc := "Bank Withdrawal"
-	accTx := models.Transactions{
-		AccountID:       account.ID,
-		Amount:          -payload.Amount,
-		Type:            "TRANSFER_OUT",
-		Description:     &desc,
-		ExternalAccount: &payload.Destination,
-		BankName:        &payload.BankName,
-	}
-	if err := tx.Create(&accTx).Error; err != nil {
+	event := newAuditEvent(r, response.ID, "transaction.bank_transfer", "transaction", accTx.ID.String())
+	event.SetChanges(
+		map[string]int64{"balance": account.Balance + payload.Amount},
+		map[string]int64{"balance": account.Balance},
+	)
+	if err := tx.Create(&event).Error; err != nil {
 		tx.Rollback()
 		detail := err.Error()
 		w.WriteHeader(http.StatusInternalServerError)
-		response.Data = dto.ErrorModel{Message: "failed to create transaction", Details: []*string{&detail}}
+		response.Data = dto.ErrorModel{Message: "failed to write audit entry", Details: []*string{&detail}}
 		json.NewEncoder(w).Encode(&response)
 		return
 	}
@@ -352,12 +427,14 @@ func (c *Controller) TopUpHandler(w http.ResponseWriter, r *http.Request) {
 		UserId        uuid.UUID
 		AccountNumber string
 		Balance       int64
+		Available     int64
+		Status        string
 	}
 
 	var account Account
 
 	tx := c.DB.Raw(`
-	SELECT id, user_id, account_number, balance
+	SELECT id, user_id, account_number, balance, balance - held_balance - pocket_balance AS available, status
 	FROM accounts WHERE id = ?
 	`, accountId.String()).Scan(&account)
 	if tx.RowsAffected == 0 {
@@ -381,6 +458,13 @@ func (c *Controller) TopUpHandler(w http.ResponseWriter, r *http.Request) {
 		json.NewEncoder(w).Encode(&response)
 		return
 	}
+	if err := models.CheckCredit(account.Status); err != nil {
+		detail := err.Error()
+		w.WriteHeader(http.StatusForbidden)
+		response.Data = dto.ErrorModel{Message: "account restricted", Details: []*string{&detail}}
+		json.NewEncoder(w).Encode(&response)
+		return
+	}
 	if payload.Amount < 10000 {
 		detail := "minimum top up is Rp10.000"
 		w.WriteHeader(http.StatusBadRequest)
@@ -389,29 +473,41 @@ func (c *Controller) TopUpHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	account.Balance += payload.Amount
+	desc := "Top Up"
+	accTx := models.Transactions{
+		AccountID:   account.ID,
+		Type:        "TRANSFER_IN",
+		Description: &desc,
+	}
 	tx = c.DB.Begin()
-	if err := tx.Save(&account).Error; err != nil {
+	account.Balance, err = ledger.Credit(tx, &accTx, payload.Amount)
+	if models.IsRestricted(err) {
+		tx.Rollback()
+		detail := err.Error()
+		w.WriteHeader(http.StatusForbidden)
+		response.Data = dto.ErrorModel{Message: "account restricted", Details: []*string{&detail}}
+		json.NewEncoder(w).Encode(&response)
+		return
+	}
+	if err != nil {
 		tx.Rollback()
 		detail := err.Error()
 		w.WriteHeader(http.StatusInternalServerError)
-		response.Data = dto.ErrorModel{Message: "failed to update balance", Details: []*string{&detail}}
+		response.Data = dto.ErrorModel{Message: "failed to create transaction", Details: []*string{&detail}}
 		json.NewEncoder(w).Encode(&response)
 		return
 	}
 
-	desc := "Top Up"
-	accTx := models.Transactions{
-		AccountID:   account.ID,
-		Amount:      payload.Amount,
-		Type:        "TRANSFER_IN",
-		Description: &desc,
-	}
-	if err := tx.Create(&accTx).Error; err != nil {
+	event := newAuditEvent(r, response.ID, "transaction.topup", "transaction", accTx.ID.String())
+	event.SetChanges(
+		map[string]int64{"balance": account.Balance - payload.Amount},
+		map[string]int64{"balance": account.Balance},
+	)
+	if err := tx.Create(&event).Error; err != nil {
 		tx.Rollback()
 		detail := err.Error()
 		w.WriteHeader(http.StatusInternalServerError)
-		response.Data = dto.ErrorModel{Message: "failed to create transaction", Details: []*string{&detail}}
+		response.Data = dto.ErrorModel{Message: "failed to write audit entry", Details: []*string{&detail}}
 		json.NewEncoder(w).Encode(&response)
 		return
 	}
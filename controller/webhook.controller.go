@@ -0,0 +1,462 @@
+package controller
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/eclipseron/digital-wallet-app/dto"
+	"github.com/eclipseron/digital-wallet-app/models"
+	"github.com/eclipseron/digital-wallet-app/webhooks"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+type WebhookEndpointResponseModel struct {
+	EndpointId  uuid.UUID  `json:"endpointId"`
+	URL         string     `json:"url"`
+	EventTypes  []string   `json:"eventTypes"`
+	AccountId   *uuid.UUID `json:"accountId"`
+	Description *string    `json:"description"`
+	Active      bool       `json:"active"`
+	// Secret is only returned when the endpoint is created
+	Secret    string    `json:"secret,omitempty"`
+	CreatedAt time.Time `json:"createdAt"`
+}
+
+func newWebhookEndpointResponse(e *models.WebhookEndpoint) WebhookEndpointResponseModel {
+	types := []string{}
+	if e.EventTypes != "" {
+		types = strings.Split(e.EventTypes, ",")
+	}
+	return WebhookEndpointResponseModel{
+		EndpointId:  e.ID,
+		URL:         e.URL,
+		EventTypes:  types,
+		AccountId:   e.AccountID,
+		Description: e.Description,
+		Active:      e.Active,
+		CreatedAt:   e.CreatedAt.UTC(),
+	}
+}
+
+type WebhookDeliveryResponseModel struct {
+	DeliveryId     uuid.UUID  `json:"deliveryId"`
+	EventId        uuid.UUID  `json:"eventId"`
+	EndpointId     uuid.UUID  `json:"endpointId"`
+	AccountId      *uuid.UUID `json:"accountId"`
+	Position       int64      `json:"position"`
+	Status         string     `json:"status"`
+	Attempts       int        `json:"attempts"`
+	NextAttemptAt  time.Time  `json:"nextAttemptAt"`
+	LastStatusCode *int       `json:"lastStatusCode"`
+	LastError      *string    `json:"lastError"`
+	DeliveredAt    *time.Time `json:"deliveredAt"`
+	CreatedAt      time.Time  `json:"createdAt"`
+}
+
+func newWebhookDeliveryResponse(d *models.WebhookDelivery) WebhookDeliveryResponseModel {
+	return WebhookDeliveryResponseModel{
+		DeliveryId:     d.ID,
+		EventId:        d.EventID,
+		EndpointId:     d.EndpointID,
+		AccountId:      d.AccountID,
+		Position:       d.Position,
+		Status:         d.Status,
+		Attempts:       d.Attempts,
+		NextAttemptAt:  d.NextAttemptAt.UTC(),
+		LastStatusCode: d.LastStatusCode,
+		LastError:      d.LastError,
+		DeliveredAt:    d.DeliveredAt,
+		CreatedAt:      d.CreatedAt.UTC(),
+	}
+}
+
+func (c *Controller) AdminCreateWebhookHandler(w http.ResponseWriter, r *http.Request) {
+	var response dto.ResponseModel
+	response.ID = uuid.New()
+	response.Timestamp = time.Now().UTC()
+	w.Header().Add("Content-Type", "application/json")
+
+	type RequestModel struct {
+		URL string `json:"url"`
+		// EventTypes is optional, leaving it out subscribes to every event
+		EventTypes  []string `json:"eventTypes"`
+		Description *string  `json:"description"`
+		Reason      string   `json:"reason"`
+	}
+	var payload RequestModel
+	if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+		detail := err.Error()
+		w.WriteHeader(http.StatusBadRequest)
+		response.Data = dto.ErrorModel{Message: "invalid request body", Details: []*string{&detail}}
+		json.NewEncoder(w).Encode(&response)
+		return
+	}
+	if strings.TrimSpace(payload.Reason) == "" {
+		detail := "reason is required"
+		w.WriteHeader(http.StatusBadRequest)
+		response.Data = dto.ErrorModel{Message: "invalid request body", Details: []*string{&detail}}
+		json.NewEncoder(w).Encode(&response)
+		return
+	}
+	target, err := url.Parse(payload.URL)
+	if err != nil || (target.Scheme != "https" && target.Scheme != "http") || target.Host == "" {
+		detail := "url must be an absolute http or https URL"
+		w.WriteHeader(http.StatusBadRequest)
+		response.Data = dto.ErrorModel{Message: "invalid request body", Details: []*string{&detail}}
+		json.NewEncoder(w).Encode(&response)
+		return
+	}
+	for _, t := range payload.EventTypes {
+		if !models.IsValidEventType(t) {
+			detail := fmt.Sprintf("unknown event type: %s", t)
+			w.WriteHeader(http.StatusBadRequest)
+			response.Data = dto.ErrorModel{Message: "invalid request body", Details: []*string{&detail}}
+			json.NewEncoder(w).Encode(&response)
+			return
+		}
+	}
+
+	secret, err := webhooks.NewSecret()
+	if err != nil {
+		detail := err.Error()
+		w.WriteHeader(http.StatusInternalServerError)
+		response.Data = dto.ErrorModel{Message: "failed to create secret", Details: []*string{&detail}}
+		json.NewEncoder(w).Encode(&response)
+		return
+	}
+	endpoint := models.WebhookEndpoint{
+		URL:         target.String(),
+		Secret:      secret,
+		EventTypes:  strings.Join(payload.EventTypes, ","),
+		Description: payload.Description,
+		Active:      true,
+	}
+
+	tx := c.DB.Begin()
+	if err := tx.Create(&endpoint).Error; err != nil {
+		tx.Rollback()
+		detail := err.Error()
+		w.WriteHeader(http.StatusInternalServerError)
+		response.Data = dto.ErrorModel{Message: "failed to create webhook", Details: []*string{&detail}}
+		json.NewEncoder(w).Encode(&response)
+		return
+	}
+
+	event := newAdminAudit(r, response.ID, "admin.webhook.create", "webhook_endpoint", endpoint.ID.String(), payload.Reason)
+	event.SetChanges(nil, map[string]any{"url": endpoint.URL, "eventTypes": payload.EventTypes})
+	if err := tx.Create(&event).Error; err != nil {
+		tx.Rollback()
+		detail := err.Error()
+		w.WriteHeader(http.StatusInternalServerError)
+		response.Data = dto.ErrorModel{Message: "failed to write audit entry", Details: []*string{&detail}}
+		json.NewEncoder(w).Encode(&response)
+		return
+	}
+
+	if err := tx.Commit().Error; err != nil {
+		detail := err.Error()
+		w.WriteHeader(http.StatusInternalServerError)
+		response.Data = dto.ErrorModel{Message: "database error", Details: []*string{&detail}}
+		json.NewEncoder(w).Encode(&response)
+		return
+	}
+
+	data := newWebhookEndpointResponse(&endpoint)
+	data.Secret = endpoint.Secret
+	w.WriteHeader(http.StatusCreated)
+	response.Data = data
+	json.NewEncoder(w).Encode(&response)
+}
+
+func (c *Controller) AdminListWebhooksHandler(w http.ResponseWriter, r *http.Request) {
+	var response dto.ResponseModel
+	response.ID = uuid.New()
+	response.Timestamp = time.Now().UTC()
+	w.Header().Add("Content-Type", "application/json")
+
+	reason := strings.TrimSpace(r.URL.Query().Get("reason"))
+	if reason == "" {
+		detail := "reason query parameter is required"
+		w.WriteHeader(http.StatusBadRequest)
+		response.Data = dto.ErrorModel{Message: "invalid request", Details: []*string{&detail}}
+		json.NewEncoder(w).Encode(&response)
+		return
+	}
+
+	var endpoints []models.WebhookEndpoint
+	if err := c.DB.Order("created_at DESC").Find(&endpoints).Error; err != nil {
+		detail := err.Error()
+		w.WriteHeader(http.StatusInternalServerError)
+		response.Data = dto.ErrorModel{Message: "an error occured", Details: []*string{&detail}}
+		json.NewEncoder(w).Encode(&response)
+		return
+	}
+
+	event := newAdminAudit(r, response.ID, "admin.webhook.list", "webhook_endpoint", "", reason)
+	if err := c.DB.Create(&event).Error; err != nil {
+		detail := err.Error()
+		w.WriteHeader(http.StatusInternalServerError)
+		response.Data = dto.ErrorModel{Message: "failed to write audit entry", Details: []*string{&detail}}
+		json.NewEncoder(w).Encode(&response)
+		return
+	}
+
+	data := make([]WebhookEndpointResponseModel, 0, len(endpoints))
+	for i := range endpoints {
+		data = append(data, newWebhookEndpointResponse(&endpoints[i]))
+	}
+	response.Data = data
+	json.NewEncoder(w).Encode(&response)
+}
+
+// AdminDisableWebhookHandler stops deliveries to an endpoint. Its pending
+// deliveries stay in the log and can be replayed.
+func (c *Controller) AdminDisableWebhookHandler(w http.ResponseWriter, r *http.Request) {
+	var response dto.ResponseModel
+	response.ID = uuid.New()
+	response.Timestamp = time.Now().UTC()
+	w.Header().Add("Content-Type", "application/json")
+
+	param := r.PathValue("endpointId")
+	endpointId, err := uuid.Parse(param)
+	if err != nil {
+		detail := err.Error()
+		w.WriteHeader(http.StatusBadRequest)
+		response.Data = dto.ErrorModel{Message: "invalid id", Details: []*string{&detail}}
+		json.NewEncoder(w).Encode(&response)
+		return
+	}
+	reason := strings.TrimSpace(r.URL.Query().Get("reason"))
+	if reason == "" {
+		detail := "reason query parameter is required"
+		w.WriteHeader(http.StatusBadRequest)
+		response.Data = dto.ErrorModel{Message: "invalid request", Details: []*string{&detail}}
+		json.NewEncoder(w).Encode(&response)
+		return
+	}
+
+	var endpoint models.WebhookEndpoint
+	err = c.DB.Transaction(func(tx *gorm.DB) error {
+		res := tx.Raw(`
+		UPDATE webhook_endpoints SET active = false, updated_at = now() WHERE id = ? RETURNING *
+		`, endpointId.String()).Scan(&endpoint)
+		if res.Error != nil {
+			return res.Error
+		}
+		if res.RowsAffected == 0 {
+			return gorm.ErrRecordNotFound
+		}
+		event := newAdminAudit(r, response.ID, "admin.webhook.disable", "webhook_endpoint", endpointId.String(), reason)
+		event.SetChanges(map[string]bool{"active": true}, map[string]bool{"active": false})
+		return tx.Create(&event).Error
+	})
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		detail := fmt.Sprintf("webhook with id: %s not exist", endpointId.String())
+		w.WriteHeader(http.StatusNotFound)
+		response.Data = dto.ErrorModel{Message: "webhook not found", Details: []*string{&detail}}
+		json.NewEncoder(w).Encode(&response)
+		return
+	}
+	if err != nil {
+		detail := err.Error()
+		w.WriteHeader(http.StatusInternalServerError)
+		response.Data = dto.ErrorModel{Message: "failed to disable webhook", Details: []*string{&detail}}
+		json.NewEncoder(w).Encode(&response)
+		return
+	}
+
+	response.Data = newWebhookEndpointResponse(&endpoint)
+	json.NewEncoder(w).Encode(&response)
+}
+
+func (c *Controller) AdminListWebhookDeliveriesHandler(w http.ResponseWriter, r *http.Request) {
+	var response dto.ResponseModel
+	response.ID = uuid.New()
+	response.Timestamp = time.Now().UTC()
+	w.Header().Add("Content-Type", "application/json")
+
+	param := r.PathValue("endpointId")
+	endpointId, err := uuid.Parse(param)
+	if err != nil {
+		detail := err.Error()
+		w.WriteHeader(http.StatusBadRequest)
+		response.Data = dto.ErrorModel{Message: "invalid id", Details: []*string{&detail}}
+		json.NewEncoder(w).Encode(&response)
+		return
+	}
+	query := r.URL.Query()
+	reason := strings.TrimSpace(query.Get("reason"))
+	if reason == "" {
+		detail := "reason query parameter is required"
+		w.WriteHeader(http.StatusBadRequest)
+		response.Data = dto.ErrorModel{Message: "invalid request", Details: []*string{&detail}}
+		json.NewEncoder(w).Encode(&response)
+		return
+	}
+
+	limit, offset := parsePagination(r)
+	db := c.DB.Where("endpoint_id = ?", endpointId.String())
+	if status := query.Get("status"); status != "" {
+		db = db.Where("status = ?", strings.ToUpper(status))
+	}
+	if accountId := query.Get("accountId"); accountId != "" {
+		db = db.Where("account_id = ?", accountId)
+	}
+
+	var deliveries []models.WebhookDelivery
+	if err := db.Order("position DESC").Limit(limit).Offset(offset).Find(&deliveries).Error; err != nil {
+		detail := err.Error()
+		w.WriteHeader(http.StatusInternalServerError)
+		response.Data = dto.ErrorModel{Message: "an error occured", Details: []*string{&detail}}
+		json.NewEncoder(w).Encode(&response)
+		return
+	}
+
+	event := newAdminAudit(r, response.ID, "admin.webhook.deliveries", "webhook_endpoint", endpointId.String(), reason)
+	if err := c.DB.Create(&event).Error; err != nil {
+		detail := err.Error()
+		w.WriteHeader(http.StatusInternalServerError)
+		response.Data = dto.ErrorModel{Message: "failed to write audit entry", Details: []*string{&detail}}
+		json.NewEncoder(w).Encode(&response)
+		return
+	}
+
+	data := make([]WebhookDeliveryResponseModel, 0, len(deliveries))
+	for i := range deliveries {
+		data = append(data, newWebhookDeliveryResponse(&deliveries[i]))
+	}
+	response.Data = data
+	json.NewEncoder(w).Encode(&response)
+}
+
+func (c *Controller) AdminReplayWebhookDeliveryHandler(w http.ResponseWriter, r *http.Request) {
+	var response dto.ResponseModel
+	response.ID = uuid.New()
+	response.Timestamp = time.Now().UTC()
+	w.Header().Add("Content-Type", "application/json")
+
+	param := r.PathValue("deliveryId")
+	deliveryId, err := uuid.Parse(param)
+	if err != nil {
+		detail := err.Error()
+		w.WriteHeader(http.StatusBadRequest)
+		response.Data = dto.ErrorModel{Message: "invalid id", Details: []*string{&detail}}
+		json.NewEncoder(w).Encode(&response)
+		return
+	}
+
+	type RequestModel struct {
+		Reason string `json:"reason"`
+	}
+	var payload RequestModel
+	if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+		detail := err.Error()
+		w.WriteHeader(http.StatusBadRequest)
+		response.Data = dto.ErrorModel{Message: "invalid request body", Details: []*string{&detail}}
+		json.NewEncoder(w).Encode(&response)
+		return
+	}
+	if strings.TrimSpace(payload.Reason) == "" {
+		detail := "reason is required"
+		w.WriteHeader(http.StatusBadRequest)
+		response.Data = dto.ErrorModel{Message: "invalid request body", Details: []*string{&detail}}
+		json.NewEncoder(w).Encode(&response)
+		return
+	}
+
+	var delivery *models.WebhookDelivery
+	err = c.DB.Transaction(func(tx *gorm.DB) error {
+		delivery, err = webhooks.Replay(tx, deliveryId)
+		if err != nil {
+			return err
+		}
+		event := newAdminAudit(r, response.ID, "admin.webhook.replay", "webhook_delivery", deliveryId.String(), payload.Reason)
+		return tx.Create(&event).Error
+	})
+	if errors.Is(err, webhooks.ErrDeliveryNotFound) {
+		detail := fmt.Sprintf("delivery with id: %s not exist", deliveryId.String())
+		w.WriteHeader(http.StatusNotFound)
+		response.Data = dto.ErrorModel{Message: "delivery not found", Details: []*string{&detail}}
+		json.NewEncoder(w).Encode(&response)
+		return
+	}
+	if err != nil {
+		detail := err.Error()
+		w.WriteHeader(http.StatusInternalServerError)
+		response.Data = dto.ErrorModel{Message: "failed to replay delivery", Details: []*string{&detail}}
+		json.NewEncoder(w).Encode(&response)
+		return
+	}
+
+	response.Data = newWebhookDeliveryResponse(delivery)
+	json.NewEncoder(w).Encode(&response)
+}
+
+func (c *Controller) AdminReplayWebhookHandler(w http.ResponseWriter, r *http.Request) {
+	var response dto.ResponseModel
+	response.ID = uuid.New()
+	response.Timestamp = time.Now().UTC()
+	w.Header().Add("Content-Type", "application/json")
+
+	param := r.PathValue("endpointId")
+	endpointId, err := uuid.Parse(param)
+	if err != nil {
+		detail := err.Error()
+		w.WriteHeader(http.StatusBadRequest)
+		response.Data = dto.ErrorModel{Message: "invalid id", Details: []*string{&detail}}
+		json.NewEncoder(w).Encode(&response)
+		return
+	}
+
+	type RequestModel struct {
+		From   time.Time `json:"from"`
+		To     time.Time `json:"to"`
+		Reason string    `json:"reason"`
+	}
+	var payload RequestModel
+	if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+		detail := err.Error()
+		w.WriteHeader(http.StatusBadRequest)
+		response.Data = dto.ErrorModel{Message: "invalid request body", Details: []*string{&detail}}
+		json.NewEncoder(w).Encode(&response)
+		return
+	}
+	if strings.TrimSpace(payload.Reason) == "" || payload.From.IsZero() || !payload.To.After(payload.From) {
+		detail := "reason, from and to are required and to must be after from"
+		w.WriteHeader(http.StatusBadRequest)
+		response.Data = dto.ErrorModel{Message: "invalid request body", Details: []*string{&detail}}
+		json.NewEncoder(w).Encode(&response)
+		return
+	}
+
+	var replayed int64
+	err = c.DB.Transaction(func(tx *gorm.DB) error {
+		replayed, err = webhooks.ReplayRange(tx, endpointId, payload.From, payload.To)
+		if err != nil {
+			return err
+		}
+		event := newAdminAudit(r, response.ID, "admin.webhook.replay_range", "webhook_endpoint", endpointId.String(), payload.Reason)
+		event.SetChanges(nil, map[string]any{"from": payload.From, "to": payload.To, "replayed": replayed})
+		return tx.Create(&event).Error
+	})
+	if err != nil {
+		detail := err.Error()
+		w.WriteHeader(http.StatusInternalServerError)
+		response.Data = dto.ErrorModel{Message: "failed to replay deliveries", Details: []*string{&detail}}
+		json.NewEncoder(w).Encode(&response)
+		return
+	}
+
+	type ReplayResponseModel struct {
+		EndpointId uuid.UUID `json:"endpointId"`
+		Replayed   int64     `json:"replayed"`
+	}
+	response.Data = ReplayResponseModel{EndpointId: endpointId, Replayed: replayed}
+	json.NewEncoder(w).Encode(&response)
+}
@@ -0,0 +1,134 @@
+package interest
+
+import (
+	"context"
+	"time"
+
+	"github.com/eclipseron/digital-wallet-app/ledger"
+	"github.com/eclipseron/digital-wallet-app/models"
+	"github.com/eclipseron/digital-wallet-app/settlement"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// eligible holds for accounts that earn interest: active ones that neither
+// belong to a merchant nor are a system account. Its only argument is the
+// list of system accounts.
+const eligible = `a.status = 'ACTIVE' AND a.deleted_at IS NULL AND a.id NOT IN ?
+	AND NOT EXISTS (SELECT 1 FROM merchants mc WHERE mc.account_id = a.id)`
+
+// mainBalances reads the end of day main balances: the snapshot balance less
+// what sat in the account's pockets when the day ended.
+const mainBalances = `
+	SELECT s.account_id AS target, s.account_id, NULL::uuid AS pocket_id,
+		s.balance - COALESCE((
+			SELECT SUM(p.balance - COALESCE((
+				SELECT SUM(m.amount) FROM pocket_movements m WHERE m.pocket_id = p.id AND m.created_at >= ?
+			), 0))
+			FROM pockets p WHERE p.account_id = s.account_id
+		), 0) AS balance
+	FROM balance_snapshots s JOIN accounts a ON a.id = s.account_id
+	WHERE s.day = ? AND s.account_id > ? AND ` + eligible + `
+	AND NOT EXISTS (SELECT 1 FROM interest_accruals i WHERE i.account_id = a.id AND i.pocket_id IS NULL AND i.day = ?)
+	AND NOT EXISTS (SELECT 1 FROM interest_payouts o WHERE o.account_id = a.id AND o.pocket_id IS NULL AND o.period = ?)
+	ORDER BY s.account_id LIMIT 500`
+
+// pocketBalances reads the end of day balances of the pockets open then.
+const pocketBalances = `
+	SELECT p.id AS target, p.account_id, p.id AS pocket_id,
+		p.balance - COALESCE((
+			SELECT SUM(m.amount) FROM pocket_movements m WHERE m.pocket_id = p.id AND m.created_at >= ?
+		), 0) AS balance
+	FROM pockets p JOIN accounts a ON a.id = p.account_id
+	WHERE p.created_at < ? AND (p.deleted_at IS NULL OR p.deleted_at >= ?) AND p.id > ? AND ` + eligible + `
+	AND NOT EXISTS (SELECT 1 FROM interest_accruals i WHERE i.pocket_id = p.id AND i.day = ?)
+	AND NOT EXISTS (SELECT 1 FROM interest_payouts o WHERE o.pocket_id = p.id AND o.period = ?)
+	ORDER BY p.id LIMIT 500`
+
+type balance struct {
+	Target    uuid.UUID
+	AccountID uuid.UUID
+	PocketID  *uuid.UUID
+	Balance   int64
+}
+
+// AccrueDay writes the accruals of day for every eligible main balance and
+// pocket that has none yet, under the schedules in effect that day. Main
+// balances come from the day's balance snapshots, which are written first
+// when missing. Days of a month that was already paid are left alone. It
+// returns how many accruals were written.
+func AccrueDay(ctx context.Context, db *gorm.DB, day time.Time) (int64, error) {
+	day, end := ledger.EndOfDay(day)
+	if _, err := ledger.Snapshot(ctx, db, day); err != nil {
+		return 0, err
+	}
+	date, period := day.Format(time.DateOnly), day.Format("2006-01")
+	fee, _ := settlement.FeeAccount()
+	expense, _ := ExpenseAccount()
+	tax, _ := TaxAccount()
+	system := []string{fee.String(), expense.String(), tax.String()}
+
+	var written int64
+	for _, scope := range []string{models.InterestScopeAccount, models.InterestScopePocket} {
+		tiers, err := Schedule(db.WithContext(ctx), scope, day)
+		if err != nil {
+			return written, err
+		}
+		if len(tiers) == 0 {
+			continue
+		}
+
+		after := uuid.Nil
+		for {
+			var balances []balance
+			var err error
+			if scope == models.InterestScopeAccount {
+				err = db.WithContext(ctx).Raw(mainBalances,
+					end, date, after.String(), system, date, period).Scan(&balances).Error
+			} else {
+				err = db.WithContext(ctx).Raw(pocketBalances,
+					end, end, end, after.String(), system, date, period).Scan(&balances).Error
+			}
+			if err != nil {
+				return written, err
+			}
+			if len(balances) == 0 {
+				break
+			}
+
+			accruals := make([]models.InterestAccrual, 0, len(balances))
+			for _, b := range balances {
+				accruals = append(accruals, models.InterestAccrual{
+					AccountID: b.AccountID,
+					PocketID:  b.PocketID,
+					Day:       time.Date(day.Year(), day.Month(), day.Day(), 0, 0, 0, 0, time.UTC),
+					Balance:   b.Balance,
+					Amount:    Daily(b.Balance, tiers),
+				})
+			}
+			res := db.WithContext(ctx).Clauses(clause.OnConflict{DoNothing: true}).Create(&accruals)
+			if res.Error != nil {
+				return written, res.Error
+			}
+			written += res.RowsAffected
+			after = balances[len(balances)-1].Target
+		}
+	}
+	return written, nil
+}
+
+// AccrueDue accrues the last ledger.SnapshotDays days that ended at least
+// ledger.SnapshotGrace before now, oldest first.
+func AccrueDue(ctx context.Context, db *gorm.DB, now time.Time) (int64, error) {
+	today, _ := ledger.EndOfDay(now.Add(-ledger.SnapshotGrace))
+	var written int64
+	for i := ledger.SnapshotDays; i >= 1; i-- {
+		n, err := AccrueDay(ctx, db, today.AddDate(0, 0, -i))
+		if err != nil {
+			return written, err
+		}
+		written += n
+	}
+	return written, nil
+}
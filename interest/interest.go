@@ -0,0 +1,157 @@
+// Package interest accrues daily interest on the main balance of accounts
+// and on savings pockets and pays it out once a month.
+//
+// Interest accrues on the end of day balance (Asia/Jakarta days) under the
+// schedule of tiers in effect that day, at RateBps a year over 365 days. All
+// amounts are integers and rounded as follows:
+//
+//   - each tier band accrues in micro rupiah (1/1,000,000), rounded half up
+//   - a payout is the whole rupiah of the month's accruals plus the carry
+//     from the month before, the fraction is carried to the next month
+//   - the tax withheld is INTEREST_TAX_BPS of the payout, rounded half up
+//
+// Interest is paid out of INTEREST_ACCOUNT_ID and the tax withheld is owed
+// on TAX_ACCOUNT_ID until it is remitted.
+package interest
+
+import (
+	"cmp"
+	"errors"
+	"fmt"
+	"math/big"
+	"os"
+	"slices"
+	"strconv"
+	"time"
+
+	"github.com/eclipseron/digital-wallet-app/models"
+	"github.com/eclipseron/digital-wallet-app/settlement"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+const (
+	// MicrosPerRupiah is the unit accruals are kept in.
+	MicrosPerRupiah = 1_000_000
+	// DaysPerYear is the day count annual rates are divided by.
+	DaysPerYear = 365
+	// MaxTiers bounds the tiers of one schedule.
+	MaxTiers = 10
+	// MaxRateBps is the highest annual rate a tier may pay, 100%.
+	MaxRateBps = 10000
+)
+
+var (
+	ErrExpenseAccount = errors.New("INTEREST_ACCOUNT_ID is not set")
+	ErrTaxAccount     = errors.New("TAX_ACCOUNT_ID is not set")
+)
+
+// Tier is one band of a schedule.
+type Tier struct {
+	MinBalance int64 `json:"minBalance"`
+	RateBps    int64 `json:"rateBps"`
+}
+
+// IsScope reports whether scope is a scope interest can be paid on.
+func IsScope(scope string) bool {
+	return scope == models.InterestScopeAccount || scope == models.InterestScopePocket
+}
+
+// TaxBps reads INTEREST_TAX_BPS, the tax withheld from every payout in basis
+// points. It is 0 by default.
+func TaxBps() int64 {
+	bps, err := strconv.ParseInt(os.Getenv("INTEREST_TAX_BPS"), 10, 64)
+	if err != nil || bps < 0 || bps > 10000 {
+		return 0
+	}
+	return bps
+}
+
+// ExpenseAccount reads INTEREST_ACCOUNT_ID, the funded account interest is
+// paid from.
+func ExpenseAccount() (uuid.UUID, bool) {
+	id, err := uuid.Parse(os.Getenv("INTEREST_ACCOUNT_ID"))
+	return id, err == nil
+}
+
+// TaxAccount reads TAX_ACCOUNT_ID, the account withheld tax is credited to.
+func TaxAccount() (uuid.UUID, bool) {
+	id, err := uuid.Parse(os.Getenv("TAX_ACCOUNT_ID"))
+	return id, err == nil
+}
+
+// Validate checks a schedule has between 1 and MaxTiers tiers with distinct,
+// non-negative minimum balances and rates up to MaxRateBps, and sorts it by
+// MinBalance.
+func Validate(tiers []Tier) error {
+	if len(tiers) == 0 || len(tiers) > MaxTiers {
+		return fmt.Errorf("between 1 and %d tiers are required", MaxTiers)
+	}
+	slices.SortFunc(tiers, func(a, b Tier) int {
+		return cmp.Compare(a.MinBalance, b.MinBalance)
+	})
+	for i, t := range tiers {
+		if t.MinBalance < 0 {
+			return errors.New("minBalance cannot be negative")
+		}
+		if t.RateBps < 0 || t.RateBps > MaxRateBps {
+			return fmt.Errorf("rateBps must be between 0 and %d", MaxRateBps)
+		}
+		if i > 0 && tiers[i-1].MinBalance == t.MinBalance {
+			return errors.New("minBalance must be unique")
+		}
+	}
+	return nil
+}
+
+// Schedule returns the tiers of scope in effect on day sorted by MinBalance,
+// none when the scope pays no interest yet.
+func Schedule(db *gorm.DB, scope string, day time.Time) ([]Tier, error) {
+	var tiers []Tier
+	err := db.Raw(`
+	SELECT min_balance, rate_bps FROM interest_rates
+	WHERE scope = ? AND effective_from = (
+		SELECT MAX(effective_from) FROM interest_rates WHERE scope = ? AND effective_from <= ?
+	)
+	ORDER BY min_balance
+	`, scope, scope, day.Format(time.DateOnly)).Scan(&tiers).Error
+	return tiers, err
+}
+
+// Daily is the interest in micro rupiah earned in one day by an end of day
+// balance under tiers, which must be sorted by MinBalance. Nothing accrues
+// below the first tier.
+func Daily(balance int64, tiers []Tier) int64 {
+	var total int64
+	for i, t := range tiers {
+		if balance <= t.MinBalance {
+			break
+		}
+		upper := balance
+		if i+1 < len(tiers) {
+			upper = min(upper, tiers[i+1].MinBalance)
+		}
+		total += band(upper-t.MinBalance, t.RateBps)
+	}
+	return total
+}
+
+// band is amount × bps / 10000 / DaysPerYear in micro rupiah, rounded half
+// up. It is computed on big integers so large balances cannot overflow.
+func band(amount, bps int64) int64 {
+	n := new(big.Int).Mul(big.NewInt(amount), big.NewInt(bps*MicrosPerRupiah/10000))
+	n.Mul(n, big.NewInt(2))
+	n.Add(n, big.NewInt(DaysPerYear))
+	n.Quo(n, big.NewInt(2*DaysPerYear))
+	return n.Int64()
+}
+
+// Split turns the micro rupiah accrued in a month plus the carry from the
+// month before into the whole rupiah paid and the fraction carried to the
+// next month, then withholds taxBps of the payment.
+func Split(accrued, carryIn, taxBps int64) (gross, tax, net, carryOut int64) {
+	total := accrued + carryIn
+	gross, carryOut = total/MicrosPerRupiah, total%MicrosPerRupiah
+	tax = settlement.Fee(gross, taxBps)
+	return gross, tax, gross - tax, carryOut
+}
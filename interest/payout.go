@@ -0,0 +1,183 @@
+package interest
+
+import (
+	"context"
+	"errors"
+	"log"
+	"time"
+
+	"github.com/eclipseron/digital-wallet-app/ledger"
+	"github.com/eclipseron/digital-wallet-app/models"
+	"github.com/eclipseron/digital-wallet-app/statement"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// Pay pays what the main balance of accountID, or its pocket when pocketID is
+// set, accrued in the month starting at start. The gross interest moves in
+// from the interest account and the tax out to the tax account in one
+// transaction, the net interest of a pocket then moves into it unless the
+// pocket was deleted. An account that can not take the bookings, a frozen
+// one or a dormant one when tax is due, gets a Deferred payout that carries
+// everything to the next month. A payout is written even when nothing is paid
+// so the carry moves on to the next month.
+func Pay(ctx context.Context, db *gorm.DB, accountID uuid.UUID, pocketID *uuid.UUID, start time.Time, taxBps int64) (*models.InterestPayout, error) {
+	period, start, end := statement.Month(start)
+	payout := models.InterestPayout{
+		AccountID: accountID,
+		PocketID:  pocketID,
+		Period:    period,
+		TaxBps:    taxBps,
+	}
+
+	err := db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		err := tx.Raw(`
+		SELECT COUNT(*), COALESCE(SUM(amount), 0) FROM interest_accruals
+		WHERE account_id = ? AND pocket_id IS NOT DISTINCT FROM ? AND day >= ? AND day < ?
+		`, accountID.String(), pocketID, start.Format(time.DateOnly), end.Format(time.DateOnly)).
+			Row().Scan(&payout.Days, &payout.Accrued)
+		if err != nil {
+			return err
+		}
+		err = tx.Raw(`
+		SELECT carry_out FROM interest_payouts
+		WHERE account_id = ? AND pocket_id IS NOT DISTINCT FROM ? AND period < ?
+		ORDER BY period DESC LIMIT 1
+		`, accountID.String(), pocketID, period).Scan(&payout.CarryIn).Error
+		if err != nil {
+			return err
+		}
+		payout.Gross, payout.Tax, payout.Net, payout.CarryOut = Split(payout.Accrued, payout.CarryIn, taxBps)
+
+		var status string
+		if err := tx.Raw(`SELECT status FROM accounts WHERE id = ?`, accountID.String()).Scan(&status).Error; err != nil {
+			return err
+		}
+		if payout.Gross > 0 && (models.CheckCredit(status) != nil || (payout.Tax > 0 && models.CheckDebit(status) != nil)) {
+			reason := "account is " + status
+			payout.Deferred = &reason
+			payout.CarryOut = payout.Accrued + payout.CarryIn
+			payout.Gross, payout.Tax, payout.Net = 0, 0, 0
+			return tx.Create(&payout).Error
+		}
+
+		desc := "Interest " + period
+		if pocketID != nil {
+			desc = "Pocket interest " + period
+		}
+		if payout.Gross > 0 {
+			expense, ok := ExpenseAccount()
+			if !ok {
+				return ErrExpenseAccount
+			}
+			debit := models.Transactions{Type: "INTEREST", Description: &desc}
+			credit := models.Transactions{Type: "INTEREST", Description: &desc}
+			if _, err := ledger.Transfer(tx, expense, accountID, payout.Gross, &debit, &credit); err != nil {
+				return err
+			}
+			payout.TransactionID = &credit.ID
+		}
+		if payout.Tax > 0 {
+			taxAccount, ok := TaxAccount()
+			if !ok {
+				return ErrTaxAccount
+			}
+			taxDesc := "Tax on " + desc
+			debit := models.Transactions{Type: "TAX", Description: &taxDesc}
+			credit := models.Transactions{Type: "TAX", Description: &taxDesc}
+			if _, err := ledger.Transfer(tx, accountID, taxAccount, payout.Tax, &debit, &credit); err != nil {
+				return err
+			}
+			payout.TaxTransactionID = &debit.ID
+		}
+		if pocketID != nil && payout.Net > 0 {
+			_, err := ledger.MovePocket(tx, accountID, *pocketID, payout.Net)
+			if err != nil && !errors.Is(err, ledger.ErrPocketNotFound) {
+				return err
+			}
+		}
+		return tx.Create(&payout).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &payout, nil
+}
+
+// PayDue pays last month's interest of every main balance and pocket that
+// accrued any and was not paid yet. Nothing is paid until the interest
+// account, and the tax account when tax is withheld, are configured. Failures
+// are logged and retried on the next run. It returns how many payouts were
+// written.
+func PayDue(ctx context.Context, db *gorm.DB, now time.Time) (int, error) {
+	_, current, _ := statement.Month(now)
+	period, start, end := statement.Month(current.AddDate(0, -1, 0))
+	taxBps := TaxBps()
+	if _, ok := ExpenseAccount(); !ok {
+		return 0, ErrExpenseAccount
+	}
+	if _, ok := TaxAccount(); !ok && taxBps > 0 {
+		return 0, ErrTaxAccount
+	}
+
+	paid := 0
+	after := uuid.Nil
+	for {
+		var targets []balance
+		err := db.WithContext(ctx).Raw(`
+		SELECT COALESCE(i.pocket_id, i.account_id) AS target, i.account_id, i.pocket_id
+		FROM interest_accruals i
+		WHERE i.day >= ? AND i.day < ? AND COALESCE(i.pocket_id, i.account_id) > ?
+		AND NOT EXISTS (
+			SELECT 1 FROM interest_payouts o
+			WHERE o.account_id = i.account_id AND o.pocket_id IS NOT DISTINCT FROM i.pocket_id AND o.period = ?
+		)
+		GROUP BY i.account_id, i.pocket_id
+		ORDER BY target LIMIT 100
+		`, start.Format(time.DateOnly), end.Format(time.DateOnly), after.String(), period).Scan(&targets).Error
+		if err != nil {
+			return paid, err
+		}
+		if len(targets) == 0 {
+			return paid, nil
+		}
+		for _, t := range targets {
+			if _, err := Pay(ctx, db, t.AccountID, t.PocketID, start, taxBps); err != nil {
+				log.Printf("failed to pay %s interest of %s: %v", period, t.Target, err)
+				continue
+			}
+			paid++
+		}
+		after = targets[len(targets)-1].Target
+	}
+}
+
+// Run accrues the days that ended and pays last month's interest every
+// interval until ctx is done. Payouts wait until every accrual succeeded.
+func Run(ctx context.Context, db *gorm.DB, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			n, err := AccrueDue(ctx, db, time.Now())
+			if err != nil {
+				log.Println("failed to accrue interest:", err)
+				continue
+			}
+			if n > 0 {
+				log.Printf("wrote %d interest accruals", n)
+			}
+			paid, err := PayDue(ctx, db, time.Now())
+			if err != nil {
+				log.Println("failed to pay interest:", err)
+				continue
+			}
+			if paid > 0 {
+				log.Printf("wrote %d interest payouts", paid)
+			}
+		}
+	}
+}
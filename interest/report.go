@@ -0,0 +1,178 @@
+package interest
+
+import (
+	"encoding/csv"
+	"io"
+	"strconv"
+	"time"
+
+	"github.com/eclipseron/digital-wallet-app/statement"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// Row is what a main balance (no PocketID) or a pocket accrued in a month
+// and, once Paid, the payout of it. Accrued, CarryIn and CarryOut are in
+// micro rupiah. BookedInterest and BookedTax are the amounts of the payout's
+// INTEREST and TAX transactions as found in the ledger. Deferred is set when
+// the payout booked nothing and carried the month over. Reconciled is only
+// meaningful for paid rows.
+type Row struct {
+	AccountID        uuid.UUID  `json:"accountId"`
+	PocketID         *uuid.UUID `json:"pocketId"`
+	Days             int64      `json:"days"`
+	AverageBalance   int64      `json:"averageBalance"`
+	Accrued          int64      `json:"accrued"`
+	Paid             bool       `json:"paid"`
+	PaidDays         int64      `json:"paidDays"`
+	PaidAccrued      int64      `json:"paidAccrued"`
+	CarryIn          int64      `json:"carryIn"`
+	Gross            int64      `json:"gross"`
+	TaxBps           int64      `json:"taxBps"`
+	Tax              int64      `json:"tax"`
+	Net              int64      `json:"net"`
+	CarryOut         int64      `json:"carryOut"`
+	TransactionID    *uuid.UUID `json:"transactionId"`
+	TaxTransactionID *uuid.UUID `json:"taxTransactionId"`
+	BookedInterest   int64      `json:"bookedInterest"`
+	BookedTax        int64      `json:"bookedTax"`
+	Deferred         *string    `json:"deferred"`
+	Reconciled       bool       `json:"reconciled" gorm:"-"`
+}
+
+// Check sets Reconciled: the payout covers exactly the accruals there are,
+// its amounts follow the rounding rules and the ledger booked the same.
+func (r *Row) Check() {
+	gross, tax, net, carryOut := Split(r.Accrued, r.CarryIn, r.TaxBps)
+	if r.Deferred != nil {
+		gross, tax, net, carryOut = 0, 0, 0, r.Accrued+r.CarryIn
+	}
+	r.Reconciled = r.Paid && r.PaidDays == r.Days && r.PaidAccrued == r.Accrued &&
+		r.Gross == gross && r.Tax == tax && r.Net == net && r.CarryOut == carryOut &&
+		r.BookedInterest == r.Gross && r.BookedTax == r.Tax
+}
+
+// Totals adds up the rows of a report. Deferred counts the payouts carried
+// over and Mismatches the paid rows that did not reconcile.
+type Totals struct {
+	Rows           int64 `json:"rows"`
+	Paid           int64 `json:"paid"`
+	Accrued        int64 `json:"accrued"`
+	CarryIn        int64 `json:"carryIn"`
+	Gross          int64 `json:"gross"`
+	Tax            int64 `json:"tax"`
+	Net            int64 `json:"net"`
+	CarryOut       int64 `json:"carryOut"`
+	BookedInterest int64 `json:"bookedInterest"`
+	BookedTax      int64 `json:"bookedTax"`
+	Deferred       int64 `json:"deferred"`
+	Mismatches     int64 `json:"mismatches"`
+}
+
+// Sum checks every row and adds them up.
+func Sum(rows []Row) Totals {
+	var total Totals
+	for i := range rows {
+		r := &rows[i]
+		r.Check()
+		total.Rows++
+		total.Accrued += r.Accrued
+		if !r.Paid {
+			continue
+		}
+		total.Paid++
+		total.CarryIn += r.CarryIn
+		total.Gross += r.Gross
+		total.Tax += r.Tax
+		total.Net += r.Net
+		total.CarryOut += r.CarryOut
+		total.BookedInterest += r.BookedInterest
+		total.BookedTax += r.BookedTax
+		if r.Deferred != nil {
+			total.Deferred++
+		}
+		if !r.Reconciled {
+			total.Mismatches++
+		}
+	}
+	return total
+}
+
+// Report is the accrual report of the month starting at start, one row per
+// main balance and pocket that accrued interest in it.
+func Report(db *gorm.DB, start time.Time) ([]Row, Totals, error) {
+	period, start, end := statement.Month(start)
+	var rows []Row
+	err := db.Raw(`
+	SELECT i.account_id, i.pocket_id, COUNT(*) AS days,
+		(SUM(i.balance) / COUNT(*))::bigint AS average_balance, SUM(i.amount)::bigint AS accrued,
+		o.id IS NOT NULL AS paid, COALESCE(o.days, 0) AS paid_days, COALESCE(o.accrued, 0) AS paid_accrued,
+		COALESCE(o.carry_in, 0) AS carry_in, COALESCE(o.gross, 0) AS gross, COALESCE(o.tax_bps, 0) AS tax_bps,
+		COALESCE(o.tax, 0) AS tax, COALESCE(o.net, 0) AS net, COALESCE(o.carry_out, 0) AS carry_out,
+		o.transaction_id, o.tax_transaction_id, o.deferred,
+		COALESCE((
+			SELECT t.amount FROM transactions t
+			WHERE t.id = o.transaction_id AND t.account_id = o.account_id AND t.type = 'INTEREST'
+		), 0) AS booked_interest,
+		COALESCE((
+			SELECT -t.amount FROM transactions t
+			WHERE t.id = o.tax_transaction_id AND t.account_id = o.account_id AND t.type = 'TAX'
+		), 0) AS booked_tax
+	FROM interest_accruals i
+	LEFT JOIN interest_payouts o ON o.account_id = i.account_id
+		AND o.pocket_id IS NOT DISTINCT FROM i.pocket_id AND o.period = ?
+	WHERE i.day >= ? AND i.day < ?
+	GROUP BY i.account_id, i.pocket_id, o.id
+	ORDER BY i.account_id, i.pocket_id NULLS FIRST
+	`, period, start.Format(time.DateOnly), end.Format(time.DateOnly)).Scan(&rows).Error
+	if err != nil {
+		return nil, Totals{}, err
+	}
+	return rows, Sum(rows), nil
+}
+
+// WriteCSV writes rows with a header line.
+func WriteCSV(w io.Writer, rows []Row) error {
+	out := csv.NewWriter(w)
+	out.Write([]string{
+		"account_id", "pocket_id", "days", "average_balance", "accrued_micros", "paid", "carry_in_micros",
+		"gross", "tax_bps", "tax", "net", "carry_out_micros", "transaction_id", "tax_transaction_id",
+		"booked_interest", "booked_tax", "deferred", "reconciled",
+	})
+	deferred := func(reason *string) string {
+		if reason == nil {
+			return ""
+		}
+		return *reason
+	}
+	id := func(id *uuid.UUID) string {
+		if id == nil {
+			return ""
+		}
+		return id.String()
+	}
+	for _, r := range rows {
+		out.Write([]string{
+			r.AccountID.String(),
+			id(r.PocketID),
+			strconv.FormatInt(r.Days, 10),
+			strconv.FormatInt(r.AverageBalance, 10),
+			strconv.FormatInt(r.Accrued, 10),
+			strconv.FormatBool(r.Paid),
+			strconv.FormatInt(r.CarryIn, 10),
+			strconv.FormatInt(r.Gross, 10),
+			strconv.FormatInt(r.TaxBps, 10),
+			strconv.FormatInt(r.Tax, 10),
+			strconv.FormatInt(r.Net, 10),
+			strconv.FormatInt(r.CarryOut, 10),
+			id(r.TransactionID),
+			id(r.TaxTransactionID),
+			strconv.FormatInt(r.BookedInterest, 10),
+			strconv.FormatInt(r.BookedTax, 10),
+			deferred(r.Deferred),
+			strconv.FormatBool(r.Reconciled),
+		})
+	}
+	out.Flush()
+	return out.Error()
+}
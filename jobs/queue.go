@@ -0,0 +1,308 @@
+package jobs
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"math/rand"
+	"sync"
+	"time"
+
+	"github.com/eclipseron/digital-wallet-app/models"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5/pgconn"
+	"gorm.io/gorm"
+)
+
+var (
+	ErrDuplicateJob = errors.New("a job with this unique key is already pending")
+	ErrJobNotFound  = errors.New("job not found")
+	ErrJobNotDead   = errors.New("only dead jobs can be retried")
+)
+
+const defaultMaxAttempts = 10
+
+// Handler runs one job. Jobs are delivered at least once, a handler may see
+// the same job again after a crash and must be idempotent.
+type Handler func(ctx context.Context, job *models.Job) error
+
+type permanentError struct{ err error }
+
+func (e permanentError) Error() string { return e.err.Error() }
+func (e permanentError) Unwrap() error { return e.err }
+
+// Permanent marks err as not worth retrying, the job is dead-lettered at once.
+func Permanent(err error) error {
+	return permanentError{err}
+}
+
+type Queue struct {
+	db       *gorm.DB
+	mu       sync.RWMutex
+	handlers map[string]Handler
+
+	// PollInterval is how long an idle worker waits before looking again
+	PollInterval time.Duration
+	// Lease bounds how long a job may run. RUNNING jobs older than this are
+	// assumed to belong to a crashed worker and are queued again.
+	Lease time.Duration
+}
+
+func NewQueue(db *gorm.DB) *Queue {
+	return &Queue{
+		db:           db,
+		handlers:     map[string]Handler{},
+		PollInterval: time.Second,
+		Lease:        10 * time.Minute,
+	}
+}
+
+// Register sets the handler for jobType. Workers only claim job types that
+// have a handler.
+func (q *Queue) Register(jobType string, handler Handler) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.handlers[jobType] = handler
+}
+
+// Handle registers a handler that receives the job payload decoded as T. A
+// payload that does not decode dead-letters the job.
+func Handle[T any](q *Queue, jobType string, fn func(ctx context.Context, payload T) error) {
+	q.Register(jobType, func(ctx context.Context, job *models.Job) error {
+		var payload T
+		if err := json.Unmarshal([]byte(job.Payload), &payload); err != nil {
+			return Permanent(fmt.Errorf("invalid payload: %w", err))
+		}
+		return fn(ctx, payload)
+	})
+}
+
+type EnqueueOptions struct {
+	// UniqueKey drops the job when another one with the same key is still
+	// QUEUED or RUNNING, Enqueue then returns ErrDuplicateJob
+	UniqueKey   string
+	RunAt       time.Time
+	MaxAttempts int
+}
+
+// Enqueue inserts a job. Pass the caller's transaction so the job is only
+// visible once the work that produced it commits.
+func Enqueue(tx *gorm.DB, jobType string, payload any, opts EnqueueOptions) (*models.Job, error) {
+	b, err := json.Marshal(payload)
+	if err != nil {
+		return nil, err
+	}
+	runAt := opts.RunAt
+	if runAt.IsZero() {
+		runAt = time.Now()
+	}
+	maxAttempts := opts.MaxAttempts
+	if maxAttempts <= 0 {
+		maxAttempts = defaultMaxAttempts
+	}
+	var uniqueKey *string
+	if opts.UniqueKey != "" {
+		uniqueKey = &opts.UniqueKey
+	}
+
+	var job models.Job
+	res := tx.Raw(`
+	INSERT INTO jobs (type, payload, status, unique_key, max_attempts, run_at, created_at, updated_at)
+	VALUES (?, ?, ?, ?, ?, ?, now(), now())
+	ON CONFLICT (unique_key) WHERE unique_key IS NOT NULL AND status IN ('QUEUED', 'RUNNING')
+	DO NOTHING
+	RETURNING *
+	`, jobType, string(b), models.JobStatusQueued, uniqueKey, maxAttempts, runAt).Scan(&job)
+	if res.Error != nil {
+		return nil, res.Error
+	}
+	if res.RowsAffected == 0 {
+		return nil, ErrDuplicateJob
+	}
+	return &job, nil
+}
+
+// Backoff is the delay before the given attempt is retried: 5s doubling per
+// attempt up to one hour, with up to 10% jitter so failed jobs spread out.
+func Backoff(attempt int) time.Duration {
+	delay := time.Hour
+	if attempt < 12 {
+		delay = min(5*time.Second<<max(attempt-1, 0), time.Hour)
+	}
+	return delay + time.Duration(rand.Int63n(int64(delay/10)+1))
+}
+
+// Retry queues a dead job again with a fresh set of attempts. It returns
+// ErrDuplicateJob while another job with its unique key is pending.
+func Retry(tx *gorm.DB, jobID uuid.UUID) (*models.Job, error) {
+	var job models.Job
+	res := tx.Raw(`SELECT * FROM jobs WHERE id = ? FOR UPDATE`, jobID.String()).Scan(&job)
+	if res.Error != nil {
+		return nil, res.Error
+	}
+	if res.RowsAffected == 0 {
+		return nil, ErrJobNotFound
+	}
+	if job.Status != models.JobStatusDead {
+		return nil, ErrJobNotDead
+	}
+
+	res = tx.Raw(`
+	UPDATE jobs SET status = ?, attempts = 0, run_at = now(), finished_at = NULL, updated_at = now()
+	WHERE id = ?
+	RETURNING *
+	`, models.JobStatusQueued, jobID.String()).Scan(&job)
+	// another job with the same unique key is already pending
+	var pgErr *pgconn.PgError
+	if errors.As(res.Error, &pgErr) && pgErr.Code == "23505" {
+		return nil, ErrDuplicateJob
+	}
+	return &job, res.Error
+}
+
+// Run starts workers and blocks until ctx is done and every job that was
+// already claimed has finished, so in-flight work drains on shutdown.
+func (q *Queue) Run(ctx context.Context, workers int) {
+	var wg sync.WaitGroup
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			q.work(ctx)
+		}()
+	}
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		q.reap(ctx)
+	}()
+	wg.Wait()
+}
+
+func (q *Queue) work(ctx context.Context) {
+	for ctx.Err() == nil {
+		job, err := q.claim()
+		if err != nil {
+			log.Println("failed to claim job:", err)
+		}
+		if job == nil {
+			select {
+			case <-ctx.Done():
+			case <-time.After(q.PollInterval):
+			}
+			continue
+		}
+		q.execute(ctx, job)
+	}
+}
+
+func (q *Queue) claim() (*models.Job, error) {
+	q.mu.RLock()
+	types := make([]string, 0, len(q.handlers))
+	for t := range q.handlers {
+		types = append(types, t)
+	}
+	q.mu.RUnlock()
+	if len(types) == 0 {
+		return nil, nil
+	}
+
+	var job models.Job
+	res := q.db.Raw(`
+	UPDATE jobs SET status = ?, attempts = attempts + 1, locked_at = now(), updated_at = now()
+	WHERE id = (
+		SELECT id FROM jobs
+		WHERE status = ? AND run_at <= now() AND type IN ?
+		ORDER BY run_at LIMIT 1
+		FOR UPDATE SKIP LOCKED
+	)
+	RETURNING *
+	`, models.JobStatusRunning, models.JobStatusQueued, types).Scan(&job)
+	if res.Error != nil || res.RowsAffected == 0 {
+		return nil, res.Error
+	}
+	return &job, nil
+}
+
+func (q *Queue) execute(ctx context.Context, job *models.Job) {
+	q.mu.RLock()
+	handler := q.handlers[job.Type]
+	q.mu.RUnlock()
+
+	// a claimed job runs to completion even when shutdown starts
+	runCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), q.Lease)
+	defer cancel()
+
+	err := func() (err error) {
+		defer func() {
+			if p := recover(); p != nil {
+				err = fmt.Errorf("job panicked: %v", p)
+			}
+		}()
+		return handler(runCtx, job)
+	}()
+
+	// the outcome is only recorded while this claim still holds the job: the
+	// reaper may have queued it again after the lease ran out and another
+	// worker claimed it, which bumped attempts
+	var res *gorm.DB
+	if err == nil {
+		res = q.db.Exec(`
+		UPDATE jobs SET status = ?, locked_at = NULL, last_error = NULL, finished_at = now(), updated_at = now()
+		WHERE id = ? AND status = ? AND attempts = ?
+		`, models.JobStatusSucceeded, job.ID.String(), models.JobStatusRunning, job.Attempts)
+		if res.Error != nil {
+			log.Printf("failed to complete job %s: %v", job.ID, res.Error)
+		} else if res.RowsAffected == 0 {
+			log.Printf("job %s (%s) finished after its lease expired", job.ID, job.Type)
+		}
+		return
+	}
+
+	detail := err.Error()
+	var permanent permanentError
+	if errors.As(err, &permanent) || job.Attempts >= job.MaxAttempts {
+		log.Printf("job %s (%s) is dead after %d attempts: %s", job.ID, job.Type, job.Attempts, detail)
+		res = q.db.Exec(`
+		UPDATE jobs SET status = ?, locked_at = NULL, last_error = ?, finished_at = now(), updated_at = now()
+		WHERE id = ? AND status = ? AND attempts = ?
+		`, models.JobStatusDead, detail, job.ID.String(), models.JobStatusRunning, job.Attempts)
+	} else {
+		res = q.db.Exec(`
+		UPDATE jobs SET status = ?, locked_at = NULL, last_error = ?, run_at = ?, updated_at = now()
+		WHERE id = ? AND status = ? AND attempts = ?
+		`, models.JobStatusQueued, detail, time.Now().Add(Backoff(job.Attempts)), job.ID.String(),
+			models.JobStatusRunning, job.Attempts)
+	}
+	if res.Error != nil {
+		log.Printf("failed to record failure of job %s: %v", job.ID, res.Error)
+	} else if res.RowsAffected == 0 {
+		log.Printf("job %s (%s) failed after its lease expired: %s", job.ID, job.Type, detail)
+	}
+}
+
+// reap queues jobs again whose worker died while running them.
+func (q *Queue) reap(ctx context.Context) {
+	ticker := time.NewTicker(q.Lease / 2)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			err := q.db.Exec(`
+			UPDATE jobs SET
+				status = CASE WHEN attempts >= max_attempts THEN ? ELSE ? END,
+				finished_at = CASE WHEN attempts >= max_attempts THEN now() END,
+				last_error = 'lease expired', locked_at = NULL, run_at = now(), updated_at = now()
+			WHERE status = ? AND locked_at < ?
+			`, models.JobStatusDead, models.JobStatusQueued, models.JobStatusRunning,
+				time.Now().Add(-q.Lease)).Error
+			if err != nil {
+				log.Println("failed to reap jobs:", err)
+			}
+		}
+	}
+}
@@ -0,0 +1,250 @@
+package ledger
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/eclipseron/digital-wallet-app/models"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// ErrCheckpointSecret is returned when CHECKPOINT_SECRET is not set, a
+// checkpoint signed with an empty key proves nothing.
+var ErrCheckpointSecret = errors.New("CHECKPOINT_SECRET is not set")
+
+type ChainIssue struct {
+	Sequence      int64      `json:"sequence"`
+	TransactionID *uuid.UUID `json:"transactionId"`
+	Problem       string     `json:"problem"`
+}
+
+type ChainReport struct {
+	AccountID    uuid.UUID    `json:"accountId"`
+	Valid        bool         `json:"valid"`
+	Entries      int64        `json:"entries"`
+	Unchained    int64        `json:"unchained"`
+	LastSequence int64        `json:"lastSequence"`
+	LastHash     *string      `json:"lastHash"`
+	Checkpoints  int64        `json:"checkpoints"`
+	Snapshots    int64        `json:"snapshots"`
+	Issues       []ChainIssue `json:"issues"`
+}
+
+// VerifyChain walks an account's chain in sequence order and reports every
+// sequence gap, broken link, content mismatch and checkpoint that no longer
+// matches the stored row. Rows are streamed so long histories are fine.
+// Balance snapshots are checked against the transactions between them.
+// Checkpoints can not be checked without CHECKPOINT_SECRET.
+func VerifyChain(db *gorm.DB, accountID uuid.UUID) (*ChainReport, error) {
+	report := &ChainReport{AccountID: accountID, Issues: []ChainIssue{}}
+
+	err := db.Raw(`
+	SELECT COUNT(*) FROM transactions WHERE account_id = ? AND hash IS NULL
+	`, accountID.String()).Scan(&report.Unchained).Error
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := db.Model(&models.Transactions{}).Unscoped().
+		Where("account_id = ? AND hash IS NOT NULL", accountID.String()).
+		Order("sequence ASC").Rows()
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	hashes := map[int64]string{}
+	var prevHash *string
+	for rows.Next() {
+		var t models.Transactions
+		if err := db.ScanRows(rows, &t); err != nil {
+			return nil, err
+		}
+		id := t.ID
+		report.Entries++
+
+		if expected := report.LastSequence + 1; t.Sequence != expected {
+			report.Issues = append(report.Issues, ChainIssue{
+				Sequence:      t.Sequence,
+				TransactionID: &id,
+				Problem:       fmt.Sprintf("sequence gap, expected %d", expected),
+			})
+		}
+		if !sameHash(t.PrevHash, prevHash) {
+			report.Issues = append(report.Issues, ChainIssue{
+				Sequence:      t.Sequence,
+				TransactionID: &id,
+				Problem:       "previous hash does not link to the prior entry",
+			})
+		}
+		if t.DeletedAt.Valid {
+			report.Issues = append(report.Issues, ChainIssue{
+				Sequence:      t.Sequence,
+				TransactionID: &id,
+				Problem:       "entry has been deleted",
+			})
+		}
+		if computed := t.ComputeHash(); computed != *t.Hash {
+			report.Issues = append(report.Issues, ChainIssue{
+				Sequence:      t.Sequence,
+				TransactionID: &id,
+				Problem:       "content does not match stored hash",
+			})
+		}
+
+		report.LastSequence = t.Sequence
+		prevHash = t.Hash
+		hashes[t.Sequence] = *t.Hash
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	report.LastHash = prevHash
+
+	var checkpoints []models.ChainCheckpoint
+	err = db.Where("account_id = ?", accountID.String()).Order("sequence ASC").Find(&checkpoints).Error
+	if err != nil {
+		return nil, err
+	}
+	for _, cp := range checkpoints {
+		report.Checkpoints++
+		seq := cp.Sequence
+		signature, err := signCheckpoint(cp)
+		if err != nil {
+			return nil, err
+		}
+		if !hmac.Equal([]byte(cp.Signature), []byte(signature)) {
+			report.Issues = append(report.Issues, ChainIssue{
+				Sequence: seq,
+				Problem:  "checkpoint signature is invalid",
+			})
+			continue
+		}
+		hash, ok := hashes[seq]
+		if !ok {
+			report.Issues = append(report.Issues, ChainIssue{
+				Sequence: seq,
+				Problem:  "checkpointed entry is missing",
+			})
+			continue
+		}
+		if hash != cp.Hash {
+			report.Issues = append(report.Issues, ChainIssue{
+				Sequence: seq,
+				Problem:  "entry hash differs from signed checkpoint",
+			})
+		}
+	}
+
+	report.Snapshots, err = verifySnapshots(db, accountID, report)
+	if err != nil {
+		return nil, err
+	}
+
+	report.Valid = len(report.Issues) == 0
+	return report, nil
+}
+
+func sameHash(a, b *string) bool {
+	if a == nil || b == nil {
+		return a == nil && b == nil
+	}
+	return *a == *b
+}
+
+func signCheckpoint(cp models.ChainCheckpoint) (string, error) {
+	secret := os.Getenv("CHECKPOINT_SECRET")
+	if secret == "" {
+		return "", ErrCheckpointSecret
+	}
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(cp.AccountID.String()))
+	mac.Write([]byte{0x1f})
+	mac.Write([]byte(strconv.FormatInt(cp.Sequence, 10)))
+	mac.Write([]byte{0x1f})
+	mac.Write([]byte(cp.Hash))
+	mac.Write([]byte{0x1f})
+	mac.Write([]byte(cp.CreatedAt.UTC().Format(time.RFC3339Nano)))
+	return hex.EncodeToString(mac.Sum(nil)), nil
+}
+
+// CreateCheckpoints signs the current chain head of every account that has
+// new entries since its last checkpoint and returns how many were written.
+// Nothing is written without CHECKPOINT_SECRET.
+func CreateCheckpoints(db *gorm.DB) (int, error) {
+	if os.Getenv("CHECKPOINT_SECRET") == "" {
+		return 0, ErrCheckpointSecret
+	}
+
+	type Head struct {
+		AccountID uuid.UUID
+		Sequence  int64
+		Hash      string
+	}
+
+	var heads []Head
+	err := db.Raw(`
+	SELECT t.account_id, t.sequence, t.hash
+	FROM transactions t
+	JOIN (
+		SELECT account_id, MAX(sequence) AS sequence
+		FROM transactions WHERE hash IS NOT NULL
+		GROUP BY account_id
+	) head ON head.account_id = t.account_id AND head.sequence = t.sequence
+	LEFT JOIN (
+		SELECT account_id, MAX(sequence) AS sequence
+		FROM chain_checkpoints
+		GROUP BY account_id
+	) cp ON cp.account_id = t.account_id
+	WHERE t.hash IS NOT NULL AND (cp.sequence IS NULL OR cp.sequence < head.sequence)
+	`).Scan(&heads).Error
+	if err != nil {
+		return 0, err
+	}
+
+	for _, head := range heads {
+		cp := models.ChainCheckpoint{
+			AccountID: head.AccountID,
+			Sequence:  head.Sequence,
+			Hash:      head.Hash,
+			CreatedAt: time.Now().UTC().Truncate(time.Microsecond),
+		}
+		if cp.Signature, err = signCheckpoint(cp); err != nil {
+			return 0, err
+		}
+		if err := db.Create(&cp).Error; err != nil {
+			return 0, err
+		}
+	}
+	return len(heads), nil
+}
+
+// RunCheckpoints creates checkpoints every interval until ctx is done.
+func RunCheckpoints(ctx context.Context, db *gorm.DB, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			n, err := CreateCheckpoints(db)
+			if err != nil {
+				log.Println("failed to create chain checkpoints:", err)
+				continue
+			}
+			if n > 0 {
+				log.Printf("created %d chain checkpoints", n)
+			}
+		}
+	}
+}
@@ -0,0 +1,293 @@
+package ledger
+
+import (
+	"context"
+	"errors"
+	"log"
+	"time"
+
+	"github.com/eclipseron/digital-wallet-app/models"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+var (
+	ErrHoldNotFound    = errors.New("hold not found")
+	ErrHoldAmount      = errors.New("hold amount must be positive")
+	ErrHoldNotActive   = errors.New("hold is no longer active")
+	ErrHoldExpired     = errors.New("hold has expired")
+	ErrCaptureExceeded = errors.New("capture amount exceeds the held amount")
+)
+
+// PlaceHold reserves amount on the account. The hold counts against the
+// available balance until it is captured, voided or expires. It must run
+// inside a transaction.
+func PlaceHold(tx *gorm.DB, hold *models.Hold) error {
+	if hold.Amount <= 0 {
+		return ErrHoldAmount
+	}
+
+	var account struct {
+		Balance       int64
+		HeldBalance   int64
+		PocketBalance int64
+		Status        string
+	}
+	res := tx.Raw(`
+	SELECT balance, held_balance, pocket_balance, status FROM accounts
+	WHERE id = ? AND deleted_at IS NULL FOR UPDATE
+	`, hold.AccountID.String()).Scan(&account)
+	if res.Error != nil {
+		return res.Error
+	}
+	if res.RowsAffected == 0 {
+		return models.ErrAccountNotFound
+	}
+	if err := models.CheckDebit(account.Status); err != nil {
+		return err
+	}
+	if account.Balance-account.HeldBalance-account.PocketBalance < hold.Amount {
+		return ErrInsufficientBalance
+	}
+
+	err := tx.Exec(`
+	UPDATE accounts SET held_balance = held_balance + ?, updated_at = now() WHERE id = ?
+	`, hold.Amount, hold.AccountID.String()).Error
+	if err != nil {
+		return err
+	}
+	hold.Status = models.HoldStatusActive
+	if err := tx.Create(hold).Error; err != nil {
+		return err
+	}
+	return models.PublishBalance(tx, hold.AccountID, nil)
+}
+
+func lockHold(tx *gorm.DB, holdID uuid.UUID) (*models.Hold, error) {
+	var hold models.Hold
+	res := tx.Raw(`SELECT * FROM holds WHERE id = ? FOR UPDATE`, holdID.String()).Scan(&hold)
+	if res.Error != nil {
+		return nil, res.Error
+	}
+	if res.RowsAffected == 0 {
+		return nil, ErrHoldNotFound
+	}
+	if hold.Status != models.HoldStatusActive {
+		return &hold, ErrHoldNotActive
+	}
+	return &hold, nil
+}
+
+// checkHoldAccount locks the account of hold and checks money may still
+// leave it.
+func checkHoldAccount(tx *gorm.DB, hold *models.Hold) error {
+	var status string
+	res := tx.Raw(`
+	SELECT status FROM accounts WHERE id = ? FOR UPDATE
+	`, hold.AccountID.String()).Scan(&status)
+	if res.Error != nil {
+		return res.Error
+	}
+	if res.RowsAffected == 0 {
+		return models.ErrAccountNotFound
+	}
+	return models.CheckDebit(status)
+}
+
+// CaptureHold turns an active hold into a ledger debit. amount 0 captures the
+// full hold, a smaller amount captures part of it and releases the rest. A
+// hold without an Owner is only captured while the account may be debited.
+// entry carries the type and description of the debit, its AccountID and
+// Amount are filled in here. It must run inside a transaction.
+func CaptureHold(tx *gorm.DB, holdID uuid.UUID, amount int64, entry *models.Transactions) (*models.Hold, int64, error) {
+	hold, err := lockHold(tx, holdID)
+	if err != nil {
+		return hold, 0, err
+	}
+	if time.Now().After(hold.ExpiresAt) {
+		return hold, 0, ErrHoldExpired
+	}
+	if amount == 0 {
+		amount = hold.Amount
+	}
+	if amount < 0 {
+		return hold, 0, ErrHoldAmount
+	}
+	if amount > hold.Amount {
+		return hold, 0, ErrCaptureExceeded
+	}
+	// a hold placed before a freeze must not move money out after it, only
+	// subsystem holds settle what they already promised
+	if hold.Owner == nil {
+		if err := checkHoldAccount(tx, hold); err != nil {
+			return hold, 0, err
+		}
+	}
+
+	var balance int64
+	res := tx.Raw(`
+	UPDATE accounts SET balance = balance - ?, held_balance = held_balance - ?, updated_at = now()
+	WHERE id = ?
+	RETURNING balance
+	`, amount, hold.Amount, hold.AccountID.String()).Scan(&balance)
+	if res.Error != nil {
+		return hold, 0, res.Error
+	}
+
+	entry.AccountID = hold.AccountID
+	entry.Amount = -amount
+	if entry.ExternalAccount == nil {
+		entry.ExternalAccount = hold.ExternalAccount
+	}
+	if entry.BankName == nil {
+		entry.BankName = hold.BankName
+	}
+	if entry.Description == nil {
+		entry.Description = hold.Description
+	}
+	if err := tx.Create(entry).Error; err != nil {
+		return hold, 0, err
+	}
+
+	now := time.Now()
+	hold.Status = models.HoldStatusCaptured
+	hold.CapturedAmount = amount
+	hold.TransactionID = &entry.ID
+	hold.ReleasedAt = &now
+	err = tx.Exec(`
+	UPDATE holds SET status = ?, captured_amount = ?, transaction_id = ?, released_at = ?, updated_at = ?
+	WHERE id = ?
+	`, hold.Status, amount, entry.ID.String(), now, now, hold.ID.String()).Error
+	return hold, balance, err
+}
+
+// DebitHold books amount out of an active hold as entry and keeps the rest
+// held, so one hold can pay several debits. The hold's Amount is what is still
+// held and CapturedAmount what was taken so far, it is CAPTURED once nothing
+// is left. Every debit is a new payment, so each one is only booked while the
+// account may be debited. It must run inside a transaction.
+func DebitHold(tx *gorm.DB, holdID uuid.UUID, amount int64, entry *models.Transactions) (*models.Hold, int64, error) {
+	hold, err := lockHold(tx, holdID)
+	if err != nil {
+		return hold, 0, err
+	}
+	if time.Now().After(hold.ExpiresAt) {
+		return hold, 0, ErrHoldExpired
+	}
+	if amount <= 0 {
+		return hold, 0, ErrHoldAmount
+	}
+	if amount > hold.Amount {
+		return hold, 0, ErrCaptureExceeded
+	}
+	if err := checkHoldAccount(tx, hold); err != nil {
+		return hold, 0, err
+	}
+
+	var balance int64
+	res := tx.Raw(`
+	UPDATE accounts SET balance = balance - ?, held_balance = held_balance - ?, updated_at = now()
+	WHERE id = ?
+	RETURNING balance
+	`, amount, amount, hold.AccountID.String()).Scan(&balance)
+	if res.Error != nil {
+		return hold, 0, res.Error
+	}
+
+	entry.AccountID = hold.AccountID
+	entry.Amount = -amount
+	if err := tx.Create(entry).Error; err != nil {
+		return hold, 0, err
+	}
+
+	now := time.Now()
+	hold.Amount -= amount
+	hold.CapturedAmount += amount
+	hold.TransactionID = &entry.ID
+	if hold.Amount == 0 {
+		hold.Status = models.HoldStatusCaptured
+		hold.ReleasedAt = &now
+	}
+	err = tx.Exec(`
+	UPDATE holds SET amount = ?, captured_amount = ?, status = ?, transaction_id = ?, released_at = ?, updated_at = ?
+	WHERE id = ?
+	`, hold.Amount, hold.CapturedAmount, hold.Status, entry.ID.String(), hold.ReleasedAt, now, hold.ID.String()).Error
+	return hold, balance, err
+}
+
+// ReleaseHold voids an active hold, status is either VOIDED or EXPIRED. It
+// must run inside a transaction.
+func ReleaseHold(tx *gorm.DB, holdID uuid.UUID, status string) (*models.Hold, error) {
+	hold, err := lockHold(tx, holdID)
+	if err != nil {
+		return hold, err
+	}
+
+	err = tx.Exec(`
+	UPDATE accounts SET held_balance = held_balance - ?, updated_at = now() WHERE id = ?
+	`, hold.Amount, hold.AccountID.String()).Error
+	if err != nil {
+		return hold, err
+	}
+
+	now := time.Now()
+	hold.Status = status
+	hold.ReleasedAt = &now
+	err = tx.Exec(`
+	UPDATE holds SET status = ?, released_at = ?, updated_at = ? WHERE id = ?
+	`, status, now, now, hold.ID.String()).Error
+	if err != nil {
+		return hold, err
+	}
+	return hold, models.PublishBalance(tx, hold.AccountID, nil)
+}
+
+// ExpireHolds releases every active hold past its expiry and returns how
+// many were released. Each hold is released in its own transaction.
+func ExpireHolds(db *gorm.DB) (int, error) {
+	var ids []uuid.UUID
+	err := db.Raw(`
+	SELECT id FROM holds WHERE status = ? AND expires_at < now() ORDER BY expires_at LIMIT 500
+	`, models.HoldStatusActive).Scan(&ids).Error
+	if err != nil {
+		return 0, err
+	}
+
+	released := 0
+	for _, id := range ids {
+		err := db.Transaction(func(tx *gorm.DB) error {
+			_, err := ReleaseHold(tx, id, models.HoldStatusExpired)
+			return err
+		})
+		// a capture or void may have won the race, that is fine
+		if errors.Is(err, ErrHoldNotActive) {
+			continue
+		}
+		if err != nil {
+			return released, err
+		}
+		released++
+	}
+	return released, nil
+}
+
+// RunHoldExpiry expires holds every interval until ctx is done.
+func RunHoldExpiry(ctx context.Context, db *gorm.DB, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			n, err := ExpireHolds(db)
+			if err != nil {
+				log.Println("failed to expire holds:", err)
+				continue
+			}
+			if n > 0 {
+				log.Printf("expired %d holds", n)
+			}
+		}
+	}
+}
@@ -0,0 +1,87 @@
+package ledger
+
+import (
+	"errors"
+	"time"
+
+	"github.com/eclipseron/digital-wallet-app/models"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+var (
+	ErrPocketNotFound = errors.New("pocket not found")
+	ErrPocketLocked   = errors.New("pocket is locked")
+)
+
+// MovePocket moves amount from the main balance of accountID into pocketID,
+// or back out of it when amount is negative. No transaction is booked, the
+// ledger balance stays the same and only the available balance changes.
+// The account is locked before the pocket. It must run inside a transaction
+// and returns the pocket as it is after the move.
+func MovePocket(tx *gorm.DB, accountID, pocketID uuid.UUID, amount int64) (*models.Pocket, error) {
+	if amount == 0 {
+		return nil, ErrInvalidAmount
+	}
+
+	var account struct {
+		Balance       int64
+		HeldBalance   int64
+		PocketBalance int64
+	}
+	res := tx.Raw(`
+	SELECT balance, held_balance, pocket_balance FROM accounts
+	WHERE id = ? AND deleted_at IS NULL FOR UPDATE
+	`, accountID.String()).Scan(&account)
+	if res.Error != nil {
+		return nil, res.Error
+	}
+	if res.RowsAffected == 0 {
+		return nil, models.ErrAccountNotFound
+	}
+
+	var pocket models.Pocket
+	res = tx.Raw(`
+	SELECT * FROM pockets WHERE id = ? AND account_id = ? AND deleted_at IS NULL FOR UPDATE
+	`, pocketID.String(), accountID.String()).Scan(&pocket)
+	if res.Error != nil {
+		return nil, res.Error
+	}
+	if res.RowsAffected == 0 {
+		return nil, ErrPocketNotFound
+	}
+
+	if amount > 0 && account.Balance-account.HeldBalance-account.PocketBalance < amount {
+		return nil, ErrInsufficientBalance
+	}
+	if amount < 0 {
+		if pocket.Locked {
+			return nil, ErrPocketLocked
+		}
+		if pocket.Balance < -amount {
+			return nil, ErrInsufficientBalance
+		}
+	}
+
+	err := tx.Exec(`
+	UPDATE accounts SET pocket_balance = pocket_balance + ?, updated_at = now() WHERE id = ?
+	`, amount, accountID.String()).Error
+	if err != nil {
+		return nil, err
+	}
+	pocket.Balance += amount
+	pocket.UpdatedAt = time.Now()
+	if err := tx.Model(&pocket).Select("balance", "updated_at").Updates(&pocket).Error; err != nil {
+		return nil, err
+	}
+	movement := models.PocketMovement{
+		PocketID:  pocket.ID,
+		AccountID: accountID,
+		Amount:    amount,
+		Balance:   pocket.Balance,
+	}
+	if err := tx.Create(&movement).Error; err != nil {
+		return nil, err
+	}
+	return &pocket, models.PublishBalance(tx, accountID, nil)
+}
@@ -0,0 +1,140 @@
+package ledger
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/eclipseron/digital-wallet-app/models"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+var (
+	ErrTransactionNotFound = errors.New("transaction not found")
+	ErrAlreadyReversed     = errors.New("transaction has already been reversed")
+	ErrNotReversible       = errors.New("reversal transactions cannot be reversed")
+	ErrReversalAmount      = errors.New("reversal amount must be positive and at most the original amount")
+	ErrInternalTransfer    = errors.New("transfers between wallets cannot be reversed, refund or send them back instead")
+)
+
+// reversibleTypes are the single leg bookings whose other side is outside
+// the wallet. A booking between two wallets has a second leg on the other
+// account that Reverse would leave untouched.
+var reversibleTypes = map[string]bool{
+	"WITHDRAW":     true,
+	"TRANSFER_OUT": true,
+	"TRANSFER_IN":  true,
+	"ADJUSTMENT":   true,
+	"CAPTURE":      true,
+}
+
+// Reverse books a compensating REVERSAL row for the original transaction and
+// adds it to the original's reversed amount. amount 0 reverses what is left,
+// anything smaller is a partial reversal and the rest can be reversed later.
+// The original counts as reversed once all of it is. Only bookings against the
+// outside world are reversible, see reversibleTypes. A reversal that would
+// take more than the available balance fails unless allowNegative is set. It
+// must run inside a transaction.
+func Reverse(tx *gorm.DB, originalID uuid.UUID, amount int64, reason string, allowNegative bool) (*models.Transactions, int64, error) {
+	var original models.Transactions
+	res := tx.Raw(`
+	SELECT * FROM transactions WHERE id = ? AND deleted_at IS NULL FOR UPDATE
+	`, originalID.String()).Scan(&original)
+	if res.Error != nil {
+		return nil, 0, res.Error
+	}
+	if res.RowsAffected == 0 {
+		return nil, 0, ErrTransactionNotFound
+	}
+	if original.Type == "REVERSAL" {
+		return nil, 0, ErrNotReversible
+	}
+	if original.ReversedAt != nil {
+		return nil, 0, ErrAlreadyReversed
+	}
+	if !reversibleTypes[original.Type] || original.RelatedAccountID != nil {
+		return nil, 0, ErrInternalTransfer
+	}
+
+	full := original.Amount
+	if full < 0 {
+		full = -full
+	}
+	left := full - original.ReversedAmount
+	if left <= 0 {
+		return nil, 0, ErrAlreadyReversed
+	}
+	if amount == 0 {
+		amount = left
+	}
+	if amount < 0 || amount > left {
+		return nil, 0, ErrReversalAmount
+	}
+
+	// the compensating entry always moves money the opposite way
+	delta := -amount
+	if original.Amount < 0 {
+		delta = amount
+	}
+
+	var account struct {
+		Balance       int64
+		HeldBalance   int64
+		PocketBalance int64
+		Status        string
+	}
+	res = tx.Raw(`
+	SELECT balance, held_balance, pocket_balance, status FROM accounts
+	WHERE id = ? AND deleted_at IS NULL FOR UPDATE
+	`, original.AccountID.String()).Scan(&account)
+	if res.Error != nil {
+		return nil, 0, res.Error
+	}
+	if res.RowsAffected == 0 {
+		return nil, 0, models.ErrAccountNotFound
+	}
+	if account.Status == models.AccountStatusClosed {
+		return nil, 0, models.ErrAccountClosed
+	}
+	// held and pocket money is spoken for, a reversal may not take it back
+	available := account.Balance - account.HeldBalance - account.PocketBalance
+	if delta < 0 && available+delta < 0 && !allowNegative {
+		return nil, 0, ErrInsufficientBalance
+	}
+	err := tx.Raw(`
+	UPDATE accounts SET balance = balance + ?, updated_at = now() WHERE id = ? RETURNING balance
+	`, delta, original.AccountID.String()).Scan(&account.Balance).Error
+	if err != nil {
+		return nil, 0, err
+	}
+
+	desc := fmt.Sprintf("Reversal of %s: %s", original.ID, reason)
+	reversal := models.Transactions{
+		AccountID:        original.AccountID,
+		Amount:           delta,
+		Type:             "REVERSAL",
+		Description:      &desc,
+		RelatedAccountID: original.RelatedAccountID,
+		ExternalAccount:  original.ExternalAccount,
+		BankName:         original.BankName,
+		ReversalOf:       &original.ID,
+	}
+	if err := tx.Create(&reversal).Error; err != nil {
+		return nil, 0, err
+	}
+
+	var reversedAt *time.Time
+	if original.ReversedAmount+amount == full {
+		now := time.Now()
+		reversedAt = &now
+	}
+	err = tx.Exec(`
+	UPDATE transactions SET reversed_at = ?, reversed_amount = reversed_amount + ?, reversed_by_id = ?, updated_at = now()
+	WHERE id = ?
+	`, reversedAt, amount, reversal.ID.String(), original.ID.String()).Error
+	if err != nil {
+		return nil, 0, err
+	}
+	return &reversal, account.Balance, nil
+}
@@ -0,0 +1,260 @@
+package ledger
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/eclipseron/digital-wallet-app/settlement"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// SnapshotDays is how many past days each run fills in, so a job that was
+// down for a while catches up on its own.
+const SnapshotDays = 7
+
+// SnapshotGrace is how long after a day ends it is snapshotted, so bookings
+// still committing around midnight are in the snapshot.
+const SnapshotGrace = 15 * time.Minute
+
+var (
+	ErrDayNotSettled   = errors.New("day has not been over long enough to snapshot")
+	ErrFutureInstant   = errors.New("instant is in the future")
+	ErrBeforeOpening   = errors.New("account did not exist at that instant")
+	ErrAccountNotFound = errors.New("account not found")
+)
+
+// EndOfDay returns the calendar day of t in Asia/Jakarta and the instant it
+// ends at.
+func EndOfDay(t time.Time) (day, end time.Time) {
+	t = t.In(settlement.Location)
+	day = time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, settlement.Location)
+	return day, day.AddDate(0, 0, 1)
+}
+
+// Snapshot writes the end of day balance of every account that existed on
+// day and has no snapshot of it yet. The balance is the current balance less
+// everything booked since the day ended, read in a single statement so it
+// cannot race with new transfers. A day is only snapshotted SnapshotGrace
+// after it ended. It returns how many snapshots were written.
+func Snapshot(ctx context.Context, db *gorm.DB, day time.Time) (int64, error) {
+	day, end := EndOfDay(day)
+	if time.Now().Before(end.Add(SnapshotGrace)) {
+		return 0, ErrDayNotSettled
+	}
+	res := db.WithContext(ctx).Exec(`
+	INSERT INTO balance_snapshots (account_id, day, as_of, balance, sequence, created_at)
+	SELECT a.id, ?, ?,
+		a.balance - COALESCE(SUM(t.amount) FILTER (WHERE t.created_at >= ?), 0),
+		COALESCE(MAX(t.sequence) FILTER (WHERE t.created_at < ? AND t.hash IS NOT NULL), 0),
+		NOW()
+	FROM accounts a
+	LEFT JOIN transactions t ON t.account_id = a.id AND t.deleted_at IS NULL
+	WHERE a.created_at < ? AND (a.deleted_at IS NULL OR a.deleted_at >= ?)
+	AND NOT EXISTS (SELECT 1 FROM balance_snapshots s WHERE s.account_id = a.id AND s.day = ?)
+	GROUP BY a.id
+	ON CONFLICT (account_id, day) DO NOTHING
+	`, day.Format(time.DateOnly), end, end, end, end, day, day.Format(time.DateOnly))
+	return res.RowsAffected, res.Error
+}
+
+// SnapshotDue snapshots the last SnapshotDays days that ended at least
+// SnapshotGrace before now.
+func SnapshotDue(ctx context.Context, db *gorm.DB, now time.Time) (int64, error) {
+	today, _ := EndOfDay(now.Add(-SnapshotGrace))
+	var written int64
+	for i := SnapshotDays; i >= 1; i-- {
+		n, err := Snapshot(ctx, db, today.AddDate(0, 0, -i))
+		if err != nil {
+			return written, err
+		}
+		written += n
+	}
+	return written, nil
+}
+
+// RunSnapshots writes end of day balance snapshots every interval until ctx
+// is done.
+func RunSnapshots(ctx context.Context, db *gorm.DB, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			n, err := SnapshotDue(ctx, db, time.Now())
+			if err != nil {
+				log.Println("failed to write balance snapshots:", err)
+				continue
+			}
+			if n > 0 {
+				log.Printf("wrote %d balance snapshots", n)
+			}
+		}
+	}
+}
+
+// HistoricalBalance is the ledger balance of an account right after at.
+// SnapshotDay is the snapshot it was computed from, nil when there was none
+// and the transactions were replayed back from the current balance.
+type HistoricalBalance struct {
+	AccountID   uuid.UUID
+	At          time.Time
+	Balance     int64
+	SnapshotDay *time.Time
+	Replayed    int64
+}
+
+// BalanceAt computes the balance of accountID at at, everything booked at or
+// before it included. It starts from the snapshot closest to at and replays
+// the transactions between the two, forward or backward.
+func BalanceAt(ctx context.Context, db *gorm.DB, accountID uuid.UUID, at time.Time) (*HistoricalBalance, error) {
+	if at.After(time.Now()) {
+		return nil, ErrFutureInstant
+	}
+	result := &HistoricalBalance{AccountID: accountID, At: at}
+	err := db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		var head struct {
+			CreatedAt time.Time
+			Balance   int64
+			Day       *time.Time
+			AsOf      *time.Time
+			Snapshot  *int64
+		}
+		res := tx.Raw(`
+		SELECT a.created_at, a.balance, s.day, s.as_of, s.balance AS snapshot
+		FROM accounts a
+		LEFT JOIN LATERAL (
+			SELECT day, as_of, balance FROM balance_snapshots
+			WHERE account_id = a.id
+			ORDER BY ABS(EXTRACT(EPOCH FROM as_of - ?)) LIMIT 1
+		) s ON TRUE
+		WHERE a.id = ?
+		`, at, accountID.String()).Scan(&head)
+		if res.Error != nil {
+			return res.Error
+		}
+		if res.RowsAffected == 0 {
+			return ErrAccountNotFound
+		}
+		if at.Before(head.CreatedAt) {
+			return ErrBeforeOpening
+		}
+
+		var replay struct {
+			Amount int64
+			Count  int64
+		}
+		var err error
+		switch {
+		case head.AsOf == nil:
+			// no snapshot yet, walk back from the current balance
+			result.Balance = head.Balance
+			err = tx.Raw(`
+			SELECT -COALESCE(SUM(amount), 0) AS amount, COUNT(*) AS count FROM transactions
+			WHERE account_id = ? AND deleted_at IS NULL AND created_at > ?
+			`, accountID.String(), at).Scan(&replay).Error
+		case !head.AsOf.After(at):
+			result.Balance = *head.Snapshot
+			err = tx.Raw(`
+			SELECT COALESCE(SUM(amount), 0) AS amount, COUNT(*) AS count FROM transactions
+			WHERE account_id = ? AND deleted_at IS NULL AND created_at >= ? AND created_at <= ?
+			`, accountID.String(), *head.AsOf, at).Scan(&replay).Error
+		default:
+			result.Balance = *head.Snapshot
+			err = tx.Raw(`
+			SELECT -COALESCE(SUM(amount), 0) AS amount, COUNT(*) AS count FROM transactions
+			WHERE account_id = ? AND deleted_at IS NULL AND created_at > ? AND created_at < ?
+			`, accountID.String(), at, *head.AsOf).Scan(&replay).Error
+		}
+		if err != nil {
+			return err
+		}
+		result.Balance += replay.Amount
+		result.Replayed = replay.Count
+		result.SnapshotDay = head.Day
+		return nil
+	}, &sql.TxOptions{Isolation: sql.LevelRepeatableRead, ReadOnly: true})
+	if err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// verifySnapshots checks every snapshot of accountID against the previous
+// one and the transactions booked between them, and the latest snapshot
+// against the current balance. It returns the number of snapshots checked.
+func verifySnapshots(db *gorm.DB, accountID uuid.UUID, report *ChainReport) (int64, error) {
+	type check struct {
+		Day      time.Time
+		Sequence int64
+		Balance  int64
+		Expected *int64
+	}
+
+	var checks []check
+	err := db.Raw(`
+	WITH s AS (
+		SELECT day, as_of, sequence, balance,
+			LAG(balance) OVER (ORDER BY as_of) AS prev_balance,
+			LAG(as_of) OVER (ORDER BY as_of) AS prev_as_of
+		FROM balance_snapshots WHERE account_id = ?
+	)
+	SELECT s.day, s.sequence, s.balance,
+		s.prev_balance + (
+			SELECT COALESCE(SUM(t.amount), 0) FROM transactions t
+			WHERE t.account_id = ? AND t.deleted_at IS NULL
+			AND t.created_at >= s.prev_as_of AND t.created_at < s.as_of
+		) AS expected
+	FROM s ORDER BY s.as_of
+	`, accountID.String(), accountID.String()).Scan(&checks).Error
+	if err != nil {
+		return 0, err
+	}
+	for _, c := range checks {
+		if c.Expected != nil && *c.Expected != c.Balance {
+			report.Issues = append(report.Issues, ChainIssue{
+				Sequence: c.Sequence,
+				Problem: fmt.Sprintf("balance snapshot of %s does not match the previous snapshot and the transactions since",
+					c.Day.Format(time.DateOnly)),
+			})
+		}
+	}
+	if len(checks) == 0 {
+		return 0, nil
+	}
+
+	// one statement, so the balance and the sum are read at the same time
+	var drift struct {
+		Day   time.Time
+		Drift int64
+	}
+	err = db.Raw(`
+	SELECT s.day, a.balance - s.balance - COALESCE((
+		SELECT SUM(t.amount) FROM transactions t
+		WHERE t.account_id = a.id AND t.deleted_at IS NULL AND t.created_at >= s.as_of
+	), 0) AS drift
+	FROM accounts a
+	JOIN LATERAL (
+		SELECT day, as_of, balance FROM balance_snapshots
+		WHERE account_id = a.id ORDER BY as_of DESC LIMIT 1
+	) s ON TRUE
+	WHERE a.id = ?
+	`, accountID.String()).Scan(&drift).Error
+	if err != nil {
+		return 0, err
+	}
+	if drift.Drift != 0 {
+		report.Issues = append(report.Issues, ChainIssue{
+			Sequence: report.LastSequence,
+			Problem: fmt.Sprintf("current balance is off by %d from the snapshot of %s and the transactions since",
+				drift.Drift, drift.Day.Format(time.DateOnly)),
+		})
+	}
+	return int64(len(checks)), nil
+}
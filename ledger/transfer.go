@@ -0,0 +1,156 @@
+package ledger
+
+import (
+	"errors"
+
+	"github.com/eclipseron/digital-wallet-app/models"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+var (
+	ErrInvalidAmount       = errors.New("amount must be positive")
+	ErrInsufficientBalance = errors.New("insufficient balance")
+	ErrSameAccount         = errors.New("source and destination account are the same")
+)
+
+// Debit takes amount out of entry.AccountID and books entry with the negated
+// amount. The account is locked and its status and available balance are
+// checked under the lock. It must run inside a transaction and returns the
+// final ledger balance.
+func Debit(tx *gorm.DB, entry *models.Transactions, amount int64) (int64, error) {
+	if amount <= 0 {
+		return 0, ErrInvalidAmount
+	}
+
+	var account struct {
+		Balance       int64
+		HeldBalance   int64
+		PocketBalance int64
+		Status        string
+	}
+	res := tx.Raw(`
+	SELECT balance, held_balance, pocket_balance, status FROM accounts
+	WHERE id = ? AND deleted_at IS NULL FOR UPDATE
+	`, entry.AccountID.String()).Scan(&account)
+	if res.Error != nil {
+		return 0, res.Error
+	}
+	if res.RowsAffected == 0 {
+		return 0, models.ErrAccountNotFound
+	}
+	if err := models.CheckDebit(account.Status); err != nil {
+		return 0, err
+	}
+	if account.Balance-account.HeldBalance-account.PocketBalance < amount {
+		return 0, ErrInsufficientBalance
+	}
+
+	var balance int64
+	err := tx.Raw(`
+	UPDATE accounts SET balance = balance - ?, updated_at = now() WHERE id = ? RETURNING balance
+	`, amount, entry.AccountID.String()).Scan(&balance).Error
+	if err != nil {
+		return 0, err
+	}
+
+	entry.Amount = -amount
+	return balance, tx.Create(entry).Error
+}
+
+// Credit adds amount to entry.AccountID and books entry. It must run inside a
+// transaction and returns the final ledger balance.
+func Credit(tx *gorm.DB, entry *models.Transactions, amount int64) (int64, error) {
+	return credit(tx, entry, amount, true)
+}
+
+// Refund credits money back to the account it was taken from for a payment
+// that did not go through. Unlike Credit it books on a restricted account,
+// the money was the owner's before the restriction.
+func Refund(tx *gorm.DB, entry *models.Transactions, amount int64) (int64, error) {
+	return credit(tx, entry, amount, false)
+}
+
+func credit(tx *gorm.DB, entry *models.Transactions, amount int64, checkStatus bool) (int64, error) {
+	if amount <= 0 {
+		return 0, ErrInvalidAmount
+	}
+
+	var status string
+	res := tx.Raw(`
+	SELECT status FROM accounts WHERE id = ? AND deleted_at IS NULL FOR UPDATE
+	`, entry.AccountID.String()).Scan(&status)
+	if res.Error != nil {
+		return 0, res.Error
+	}
+	if res.RowsAffected == 0 {
+		return 0, models.ErrAccountNotFound
+	}
+	if checkStatus {
+		if err := models.CheckCredit(status); err != nil {
+			return 0, err
+		}
+	}
+
+	var balance int64
+	err := tx.Raw(`
+	UPDATE accounts SET balance = balance + ?, updated_at = now() WHERE id = ? RETURNING balance
+	`, amount, entry.AccountID.String()).Scan(&balance).Error
+	if err != nil {
+		return 0, err
+	}
+
+	entry.Amount = amount
+	return balance, tx.Create(entry).Error
+}
+
+// BankTransfer is the bank withdrawal used by BankWithdrawHandler and by
+// scheduled transfers. It must run inside a transaction.
+func BankTransfer(tx *gorm.DB, accountID uuid.UUID, amount int64, destination, bankName string) (*models.Transactions, int64, error) {
+	desc := "Bank Withdrawal"
+	entry := models.Transactions{
+		AccountID:       accountID,
+		Type:            "TRANSFER_OUT",
+		Description:     &desc,
+		ExternalAccount: &destination,
+		BankName:        &bankName,
+	}
+	balance, err := Debit(tx, &entry, amount)
+	if err != nil {
+		return nil, 0, err
+	}
+	return &entry, balance, nil
+}
+
+// Transfer moves amount from one wallet to another, booking debit on from and
+// credit on to with RelatedAccountID pointing at the other side. Both rows
+// are locked in id order first so opposite transfers cannot deadlock. It must
+// run inside a transaction and returns the final balance of from.
+func Transfer(tx *gorm.DB, from, to uuid.UUID, amount int64, debit, credit *models.Transactions) (int64, error) {
+	if from == to {
+		return 0, ErrSameAccount
+	}
+	var locked []uuid.UUID
+	err := tx.Raw(`
+	SELECT id FROM accounts WHERE id IN (?, ?) AND deleted_at IS NULL ORDER BY id FOR UPDATE
+	`, from.String(), to.String()).Scan(&locked).Error
+	if err != nil {
+		return 0, err
+	}
+	if len(locked) != 2 {
+		return 0, models.ErrAccountNotFound
+	}
+
+	debit.AccountID = from
+	debit.RelatedAccountID = &to
+	balance, err := Debit(tx, debit, amount)
+	if err != nil {
+		return 0, err
+	}
+	credit.AccountID = to
+	credit.RelatedAccountID = &from
+	if _, err := Credit(tx, credit, amount); err != nil {
+		return 0, err
+	}
+	return balance, nil
+}
@@ -1,13 +1,31 @@
 package main
 
 import (
+	"context"
+	"errors"
 	"log"
 	"net/http"
+	"os"
+	"os/signal"
+	"strconv"
+	"syscall"
 	"time"
 
+	"github.com/eclipseron/digital-wallet-app/atm"
+	"github.com/eclipseron/digital-wallet-app/biller"
+	"github.com/eclipseron/digital-wallet-app/billsplit"
 	"github.com/eclipseron/digital-wallet-app/conf"
 	"github.com/eclipseron/digital-wallet-app/controller"
+	"github.com/eclipseron/digital-wallet-app/interest"
+	"github.com/eclipseron/digital-wallet-app/jobs"
+	"github.com/eclipseron/digital-wallet-app/ledger"
 	"github.com/eclipseron/digital-wallet-app/middleware"
+	"github.com/eclipseron/digital-wallet-app/models"
+	"github.com/eclipseron/digital-wallet-app/payout"
+	"github.com/eclipseron/digital-wallet-app/scheduler"
+	"github.com/eclipseron/digital-wallet-app/statement"
+	"github.com/eclipseron/digital-wallet-app/stream"
+	"github.com/eclipseron/digital-wallet-app/webhooks"
 )
 
 func main() {
@@ -16,6 +34,43 @@ func main() {
 
 	c := controller.NewController(db)
 
+	// SIGINT or SIGTERM stops the background loops and starts the shutdown
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	checkpointInterval, err := time.ParseDuration(os.Getenv("CHECKPOINT_INTERVAL"))
+	if err != nil {
+		checkpointInterval = time.Hour
+	}
+	go ledger.RunCheckpoints(ctx, db, checkpointInterval)
+	go ledger.RunHoldExpiry(ctx, db, time.Minute)
+	go atm.RunExpiry(ctx, db, time.Minute)
+	go ledger.RunSnapshots(ctx, db, time.Hour)
+	go scheduler.Run(ctx, db, time.Minute)
+	go billsplit.Run(ctx, db, time.Minute)
+	go statement.Run(ctx, db, time.Hour)
+	go interest.Run(ctx, db, time.Hour)
+	go biller.Run(ctx, db, 10*time.Minute)
+
+	// event streams end when ctx is done so they don't hold up the shutdown
+	c.Events = stream.NewHub(db)
+	go c.Events.Run(ctx)
+
+	workers, err := strconv.Atoi(os.Getenv("JOB_WORKERS"))
+	if err != nil || workers <= 0 {
+		workers = 4
+	}
+	queue := jobs.NewQueue(db)
+	webhooks.Register(queue, db)
+	biller.Register(queue, db)
+	payout.Register(queue, db)
+	go webhooks.Run(ctx, db, 2*time.Second)
+	drained := make(chan struct{})
+	go func() {
+		queue.Run(ctx, workers)
+		close(drained)
+	}()
+
 	s := &http.Server{
 		Addr:         ":8080",
 		ReadTimeout:  20 * time.Second,
@@ -25,10 +80,161 @@ func main() {
 
 	http.Handle("GET /api/v1/accounts/{accountId}/balance",
 		middleware.RequireAuth(http.HandlerFunc(c.GetAccountBalanceHandler)))
+	http.Handle("GET /api/v1/accounts/{accountId}/statement",
+		middleware.RequireAuth(http.HandlerFunc(c.GetStatementHandler)))
+	http.Handle("GET /api/v1/accounts/{accountId}/statements",
+		middleware.RequireAuth(http.HandlerFunc(c.ListMonthlyStatementsHandler)))
+	http.Handle("GET /api/v1/accounts/{accountId}/statements/{period}",
+		middleware.RequireAuth(http.HandlerFunc(c.GetMonthlyStatementHandler)))
+	http.Handle("GET /api/v1/accounts/{accountId}/analytics",
+		middleware.RequireAuth(http.HandlerFunc(c.AccountAnalyticsHandler)))
+	http.Handle("GET /api/v1/accounts/{accountId}/budgets",
+		middleware.RequireAuth(http.HandlerFunc(c.ListBudgetsHandler)))
+	http.Handle("POST /api/v1/accounts/{accountId}/budgets",
+		middleware.RequireAuth(http.HandlerFunc(c.CreateBudgetHandler)))
+	http.Handle("PUT /api/v1/accounts/{accountId}/budgets/{budgetId}",
+		middleware.RequireAuth(http.HandlerFunc(c.UpdateBudgetHandler)))
+	http.Handle("DELETE /api/v1/accounts/{accountId}/budgets/{budgetId}",
+		middleware.RequireAuth(http.HandlerFunc(c.DeleteBudgetHandler)))
+	http.Handle("GET /api/v1/accounts/{accountId}/pockets",
+		middleware.RequireAuth(http.HandlerFunc(c.ListPocketsHandler)))
+	http.Handle("POST /api/v1/accounts/{accountId}/pockets",
+		middleware.RequireAuth(http.HandlerFunc(c.CreatePocketHandler)))
+	http.Handle("GET /api/v1/accounts/{accountId}/pockets/{pocketId}",
+		middleware.RequireAuth(http.HandlerFunc(c.GetPocketHandler)))
+	http.Handle("PUT /api/v1/accounts/{accountId}/pockets/{pocketId}",
+		middleware.RequireAuth(http.HandlerFunc(c.UpdatePocketHandler)))
+	http.Handle("DELETE /api/v1/accounts/{accountId}/pockets/{pocketId}",
+		middleware.RequireAuth(http.HandlerFunc(c.DeletePocketHandler)))
+	http.Handle("POST /api/v1/accounts/{accountId}/pockets/{pocketId}/deposit",
+		middleware.RequireAuth(http.HandlerFunc(c.DepositPocketHandler)))
+	http.Handle("POST /api/v1/accounts/{accountId}/pockets/{pocketId}/withdraw",
+		middleware.RequireAuth(http.HandlerFunc(c.WithdrawPocketHandler)))
+	http.Handle("GET /api/v1/accounts/{accountId}/events",
+		middleware.RequireAuth(http.HandlerFunc(c.AccountEventsHandler)))
+	http.Handle("GET /api/v1/accounts/{accountId}/holds",
+		middleware.RequireAuth(http.HandlerFunc(c.ListHoldsHandler)))
+	http.Handle("POST /api/v1/accounts/{accountId}/holds",
+		middleware.RequireAuth(http.HandlerFunc(c.PlaceHoldHandler)))
+	http.Handle("POST /api/v1/holds/{holdId}/capture",
+		middleware.RequireAuth(http.HandlerFunc(c.CaptureHoldHandler)))
+	http.Handle("POST /api/v1/holds/{holdId}/void",
+		middleware.RequireAuth(http.HandlerFunc(c.VoidHoldHandler)))
+	http.Handle("GET /api/v1/accounts/{accountId}/atm-codes",
+		middleware.RequireAuth(http.HandlerFunc(c.ListATMCodesHandler)))
+	http.Handle("POST /api/v1/accounts/{accountId}/atm-codes",
+		middleware.RequireAuth(http.HandlerFunc(c.CreateATMCodeHandler)))
+	http.Handle("DELETE /api/v1/accounts/{accountId}/atm-codes/{codeId}",
+		middleware.RequireAuth(http.HandlerFunc(c.CancelATMCodeHandler)))
+	// called by the ATM network, authenticated by the body signature
+	http.HandleFunc("POST /api/v1/atm/redeem", c.ATMRedeemHandler)
+	http.Handle("GET /api/v1/bills/products",
+		middleware.RequireAuth(http.HandlerFunc(c.ListBillProductsHandler)))
+	http.Handle("GET /api/v1/accounts/{accountId}/bills",
+		middleware.RequireAuth(http.HandlerFunc(c.ListBillPaymentsHandler)))
+	http.Handle("POST /api/v1/accounts/{accountId}/bills/inquiry",
+		middleware.RequireAuth(http.HandlerFunc(c.BillInquiryHandler)))
+	http.Handle("GET /api/v1/accounts/{accountId}/bills/{paymentId}",
+		middleware.RequireAuth(http.HandlerFunc(c.GetBillPaymentHandler)))
+	http.Handle("POST /api/v1/accounts/{accountId}/bills/{paymentId}/pay",
+		middleware.RequireAuth(http.HandlerFunc(c.PayBillHandler)))
+	http.Handle("GET /api/v1/accounts/{accountId}/payouts",
+		middleware.RequireAuth(http.HandlerFunc(c.ListPayoutBatchesHandler)))
+	http.Handle("POST /api/v1/accounts/{accountId}/payouts",
+		middleware.RequireAuth(http.HandlerFunc(c.CreatePayoutBatchHandler)))
+	http.Handle("GET /api/v1/accounts/{accountId}/payouts/{batchId}",
+		middleware.RequireAuth(http.HandlerFunc(c.GetPayoutBatchHandler)))
+	http.Handle("GET /api/v1/accounts/{accountId}/payouts/{batchId}/items",
+		middleware.RequireAuth(http.HandlerFunc(c.ListPayoutItemsHandler)))
+	http.Handle("POST /api/v1/accounts/{accountId}/payouts/{batchId}/execute",
+		middleware.RequireAuth(http.HandlerFunc(c.ExecutePayoutBatchHandler)))
+	http.Handle("GET /api/v1/accounts/{accountId}/payouts/{batchId}/result",
+		middleware.RequireAuth(http.HandlerFunc(c.GetPayoutResultHandler)))
+	http.Handle("POST /api/v1/accounts/{accountId}/close",
+		middleware.RequireAuth(http.HandlerFunc(c.CloseAccountHandler)))
 	http.Handle("POST /api/v1/transaction/withdraw",
 		middleware.RequireAuth(http.HandlerFunc(c.WithdrawHandler)))
 	http.Handle("POST /api/v1/transaction/transfer/bank",
 		middleware.RequireAuth(http.HandlerFunc(c.BankWithdrawHandler)))
+	http.Handle("PUT /api/v1/transactions/{transactionId}/category",
+		middleware.RequireAuth(http.HandlerFunc(c.SetTransactionCategoryHandler)))
+	http.Handle("GET /api/v1/schedules",
+		middleware.RequireAuth(http.HandlerFunc(c.ListSchedulesHandler)))
+	http.Handle("POST /api/v1/schedules",
+		middleware.RequireAuth(http.HandlerFunc(c.CreateScheduleHandler)))
+	http.Handle("GET /api/v1/schedules/{scheduleId}/runs",
+		middleware.RequireAuth(http.HandlerFunc(c.ListScheduleRunsHandler)))
+	http.Handle("POST /api/v1/schedules/{scheduleId}/pause",
+		middleware.RequireAuth(http.HandlerFunc(c.PauseScheduleHandler)))
+	http.Handle("POST /api/v1/schedules/{scheduleId}/resume",
+		middleware.RequireAuth(http.HandlerFunc(c.ResumeScheduleHandler)))
+	http.Handle("POST /api/v1/schedules/{scheduleId}/cancel",
+		middleware.RequireAuth(http.HandlerFunc(c.CancelScheduleHandler)))
+
+	http.Handle("PUT /api/v1/users/me/pin",
+		middleware.RequireAuth(http.HandlerFunc(c.SetPinHandler)))
+	http.Handle("GET /api/v1/merchants",
+		middleware.RequireAuth(http.HandlerFunc(c.ListMerchantsHandler)))
+	http.Handle("POST /api/v1/merchants",
+		middleware.RequireAuth(http.HandlerFunc(c.CreateMerchantHandler)))
+	http.Handle("POST /api/v1/merchants/{merchantId}/api-keys",
+		middleware.RequireAuth(http.HandlerFunc(c.CreateMerchantAPIKeyHandler)))
+	http.Handle("DELETE /api/v1/merchants/{merchantId}/api-keys/{keyId}",
+		middleware.RequireAuth(http.HandlerFunc(c.RevokeMerchantAPIKeyHandler)))
+	http.Handle("GET /api/v1/merchants/{merchantId}/settlements",
+		middleware.RequireAuth(http.HandlerFunc(c.MerchantSettlementHandler)))
+	http.Handle("GET /api/v1/accounts/{accountId}/qr",
+		middleware.RequireAuth(http.HandlerFunc(c.AccountQRHandler)))
+	http.Handle("GET /api/v1/qr/image",
+		middleware.RequireAuth(http.HandlerFunc(c.RenderQRHandler)))
+	http.Handle("POST /api/v1/qr/pay",
+		middleware.RequireAuth(http.HandlerFunc(c.PayQRHandler)))
+	http.Handle("GET /api/v1/payment-requests",
+		middleware.RequireAuth(http.HandlerFunc(c.ListPaymentRequestsHandler)))
+	http.Handle("POST /api/v1/payment-requests",
+		middleware.RequireAuth(http.HandlerFunc(c.CreatePaymentRequestHandler)))
+	http.Handle("POST /api/v1/payment-requests/{requestId}/accept",
+		middleware.RequireAuth(http.HandlerFunc(c.PayPaymentRequestHandler)))
+	http.Handle("POST /api/v1/payment-requests/{requestId}/decline",
+		middleware.RequireAuth(http.HandlerFunc(c.DeclinePaymentRequestHandler)))
+	http.Handle("POST /api/v1/payment-requests/{requestId}/cancel",
+		middleware.RequireAuth(http.HandlerFunc(c.CancelPaymentRequestHandler)))
+	http.Handle("GET /api/v1/pay-links/{token}",
+		middleware.RequireAuth(http.HandlerFunc(c.GetPayLinkHandler)))
+	http.Handle("POST /api/v1/pay-links/{token}/pay",
+		middleware.RequireAuth(http.HandlerFunc(c.PayLinkHandler)))
+	http.Handle("GET /api/v1/split-bills",
+		middleware.RequireAuth(http.HandlerFunc(c.ListSplitBillsHandler)))
+	http.Handle("POST /api/v1/split-bills",
+		middleware.RequireAuth(http.HandlerFunc(c.CreateSplitBillHandler)))
+	http.Handle("GET /api/v1/split-bills/{billId}",
+		middleware.RequireAuth(http.HandlerFunc(c.GetSplitBillHandler)))
+	http.Handle("POST /api/v1/split-bills/{billId}/pay",
+		middleware.RequireAuth(http.HandlerFunc(c.PaySplitBillShareHandler)))
+	http.Handle("POST /api/v1/split-bills/{billId}/cancel",
+		middleware.RequireAuth(http.HandlerFunc(c.CancelSplitBillHandler)))
+	http.Handle("GET /api/v1/notifications",
+		middleware.RequireAuth(http.HandlerFunc(c.ListNotificationsHandler)))
+	http.Handle("POST /api/v1/notifications/{notificationId}/read",
+		middleware.RequireAuth(http.HandlerFunc(c.ReadNotificationHandler)))
+	http.Handle("GET /api/v1/payment-intents/{intentId}",
+		middleware.RequireAuth(http.HandlerFunc(c.GetPaymentIntentHandler)))
+	http.Handle("POST /api/v1/payment-intents/{intentId}/confirm",
+		middleware.RequireAuth(http.HandlerFunc(c.ConfirmPaymentIntentHandler)))
+
+	// these APIs are called by merchant servers with an X-API-Key
+	http.Handle("POST /api/v1/merchant/payment-intents",
+		c.RequireMerchantKey(http.HandlerFunc(c.CreatePaymentIntentHandler)))
+	http.Handle("GET /api/v1/merchant/payment-intents/{intentId}",
+		c.RequireMerchantKey(http.HandlerFunc(c.MerchantGetPaymentIntentHandler)))
+	http.Handle("GET /api/v1/merchant/payment-intents/{intentId}/qr",
+		c.RequireMerchantKey(http.HandlerFunc(c.PaymentIntentQRHandler)))
+	http.Handle("POST /api/v1/merchant/payment-intents/{intentId}/cancel",
+		c.RequireMerchantKey(http.HandlerFunc(c.CancelPaymentIntentHandler)))
+	http.Handle("POST /api/v1/merchant/refunds",
+		c.RequireMerchantKey(http.HandlerFunc(c.CreateRefundHandler)))
+	http.Handle("GET /api/v1/merchant/settlements",
+		c.RequireMerchantKey(http.HandlerFunc(c.SettlementReportHandler)))
 
 	// these APIs are used for security purpose
 	http.HandleFunc("POST /api/v1/register", c.RegisterHandler)
@@ -38,7 +244,73 @@ func main() {
 	http.Handle("POST /api/v1/transaction/transfer/topup",
 		middleware.RequireAuth(http.HandlerFunc(c.TopUpHandler)))
 
-	if err := s.ListenAndServe(); err != nil {
-		log.Fatal("Failed to start server: ", err)
+	// every admin route needs a staff role, individual routes narrow it further
+	admin := http.NewServeMux()
+	staff := []string{models.RoleSupport, models.RoleFinance, models.RoleAdmin}
+	admin.HandleFunc("GET /api/v1/admin/users", c.AdminSearchUsersHandler)
+	admin.Handle("PUT /api/v1/admin/users/{userId}/role",
+		middleware.RequireRole(models.RoleAdmin)(http.HandlerFunc(c.AdminUpdateUserRoleHandler)))
+	admin.HandleFunc("GET /api/v1/admin/accounts/{accountId}/balance", c.AdminGetAccountBalanceHandler)
+	admin.HandleFunc("GET /api/v1/admin/accounts/{accountId}/transactions", c.AdminListTransactionsHandler)
+	admin.Handle("POST /api/v1/admin/accounts/{accountId}/freeze",
+		middleware.RequireRole(models.RoleSupport, models.RoleAdmin)(http.HandlerFunc(c.AdminFreezeAccountHandler)))
+	admin.Handle("POST /api/v1/admin/accounts/{accountId}/unfreeze",
+		middleware.RequireRole(models.RoleSupport, models.RoleAdmin)(http.HandlerFunc(c.AdminUnfreezeAccountHandler)))
+	admin.Handle("PUT /api/v1/admin/accounts/{accountId}/status",
+		middleware.RequireRole(models.RoleSupport, models.RoleAdmin)(http.HandlerFunc(c.AdminSetAccountStatusHandler)))
+	admin.Handle("POST /api/v1/admin/accounts/{accountId}/close",
+		middleware.RequireRole(models.RoleAdmin)(http.HandlerFunc(c.AdminCloseAccountHandler)))
+	admin.Handle("POST /api/v1/admin/accounts/{accountId}/adjustments",
+		middleware.RequireRole(models.RoleFinance, models.RoleAdmin)(http.HandlerFunc(c.AdminAdjustBalanceHandler)))
+	admin.Handle("GET /api/v1/admin/accounts/{accountId}/statement",
+		middleware.RequireRole(models.RoleFinance, models.RoleAdmin)(http.HandlerFunc(c.AdminGetStatementHandler)))
+	admin.Handle("GET /api/v1/admin/accounts/{accountId}/statements/{period}/verify",
+		middleware.RequireRole(models.RoleFinance, models.RoleAdmin)(http.HandlerFunc(c.AdminVerifyMonthlyStatementHandler)))
+	admin.HandleFunc("GET /api/v1/admin/accounts/{accountId}/chain", c.AdminVerifyChainHandler)
+	admin.HandleFunc("GET /api/v1/admin/interest/rates", c.AdminListInterestRatesHandler)
+	admin.Handle("POST /api/v1/admin/interest/rates",
+		middleware.RequireRole(models.RoleFinance, models.RoleAdmin)(http.HandlerFunc(c.AdminSetInterestRatesHandler)))
+	admin.Handle("GET /api/v1/admin/interest/report",
+		middleware.RequireRole(models.RoleFinance, models.RoleAdmin)(http.HandlerFunc(c.AdminInterestReportHandler)))
+	admin.Handle("POST /api/v1/admin/transactions/{transactionId}/reverse",
+		middleware.RequireRole(models.RoleFinance, models.RoleAdmin)(http.HandlerFunc(c.AdminReverseTransactionHandler)))
+	admin.Handle("GET /api/v1/admin/jobs",
+		middleware.RequireRole(models.RoleAdmin)(http.HandlerFunc(c.AdminListJobsHandler)))
+	admin.Handle("POST /api/v1/admin/jobs/{jobId}/retry",
+		middleware.RequireRole(models.RoleAdmin)(http.HandlerFunc(c.AdminRetryJobHandler)))
+	admin.Handle("GET /api/v1/admin/webhooks",
+		middleware.RequireRole(models.RoleAdmin)(http.HandlerFunc(c.AdminListWebhooksHandler)))
+	admin.Handle("POST /api/v1/admin/webhooks",
+		middleware.RequireRole(models.RoleAdmin)(http.HandlerFunc(c.AdminCreateWebhookHandler)))
+	admin.Handle("DELETE /api/v1/admin/webhooks/{endpointId}",
+		middleware.RequireRole(models.RoleAdmin)(http.HandlerFunc(c.AdminDisableWebhookHandler)))
+	admin.Handle("GET /api/v1/admin/webhooks/{endpointId}/deliveries",
+		middleware.RequireRole(models.RoleAdmin)(http.HandlerFunc(c.AdminListWebhookDeliveriesHandler)))
+	admin.Handle("POST /api/v1/admin/webhooks/{endpointId}/replay",
+		middleware.RequireRole(models.RoleAdmin)(http.HandlerFunc(c.AdminReplayWebhookHandler)))
+	admin.Handle("POST /api/v1/admin/webhook-deliveries/{deliveryId}/replay",
+		middleware.RequireRole(models.RoleAdmin)(http.HandlerFunc(c.AdminReplayWebhookDeliveryHandler)))
+	admin.Handle("GET /api/v1/admin/audit-events",
+		middleware.RequireRole(models.RoleAdmin)(http.HandlerFunc(c.AdminListAuditEventsHandler)))
+	http.Handle("/api/v1/admin/",
+		middleware.RequireAuth(middleware.RequireRole(staff...)(admin)))
+
+	go func() {
+		if err := s.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			log.Fatal("Failed to start server: ", err)
+		}
+	}()
+
+	<-ctx.Done()
+	log.Println("shutting down")
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	if err := s.Shutdown(shutdownCtx); err != nil {
+		log.Println("failed to shut down server:", err)
+	}
+	select {
+	case <-drained:
+	case <-shutdownCtx.Done():
+		log.Println("job workers did not drain in time")
 	}
 }
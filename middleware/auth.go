@@ -3,12 +3,15 @@ package middleware
 import (
 	"context"
 	"encoding/json"
+	"fmt"
 	"net/http"
 	"os"
+	"slices"
 	"strings"
 	"time"
 
 	"github.com/eclipseron/digital-wallet-app/dto"
+	"github.com/eclipseron/digital-wallet-app/models"
 	"github.com/golang-jwt/jwt/v5"
 	"github.com/google/uuid"
 )
@@ -16,6 +19,10 @@ import (
 type ContextString string
 
 var USERID ContextString = "USERID"
+var ROLE ContextString = "ROLE"
+
+// MERCHANTID is set by the merchant API key check instead of USERID.
+var MERCHANTID ContextString = "MERCHANTID"
 
 func RequireAuth(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
@@ -60,7 +67,37 @@ func RequireAuth(next http.Handler) http.Handler {
 			return
 		}
 
+		// tokens issued before roles were introduced carry no role claim
+		role, ok := claims["role"].(string)
+		if !ok || role == "" {
+			role = models.RoleCustomer
+		}
+
 		ctx := context.WithValue(r.Context(), USERID, sub)
+		ctx = context.WithValue(ctx, ROLE, role)
 		next.ServeHTTP(w, r.WithContext(ctx))
 	})
 }
+
+// RequireRole must be wrapped by RequireAuth so the role is already in the context.
+func RequireRole(roles ...string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			role, _ := r.Context().Value(ROLE).(string)
+			if slices.Contains(roles, role) {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			var response dto.ResponseModel
+			response.ID = uuid.New()
+			response.Timestamp = time.Now().UTC()
+			w.Header().Add("Content-Type", "application/json")
+
+			detail := fmt.Sprintf("this action requires one of roles: %s", strings.Join(roles, ", "))
+			w.WriteHeader(http.StatusForbidden)
+			response.Data = dto.ErrorModel{Message: "forbidden", Details: []*string{&detail}}
+			json.NewEncoder(w).Encode(&response)
+		})
+	}
+}
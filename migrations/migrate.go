@@ -16,9 +16,138 @@ func Run(db *gorm.DB) {
 		&models.User{},
 		&models.Account{},
 		&models.Transactions{},
+		&models.AccountStatusChange{},
+		&models.AuditEvent{},
+		&models.ChainCheckpoint{},
+		&models.Hold{},
+		&models.ScheduledTransfer{},
+		&models.ScheduledTransferRun{},
+		&models.Job{},
+		&models.OutboxEvent{},
+		&models.WebhookEndpoint{},
+		&models.WebhookDelivery{},
+		&models.Merchant{},
+		&models.MerchantAPIKey{},
+		&models.PaymentIntent{},
+		&models.Refund{},
+		&models.PaymentRequest{},
+		&models.Notification{},
+		&models.SplitBill{},
+		&models.SplitBillShare{},
+		&models.MonthlyStatement{},
+		&models.BalanceSnapshot{},
+		&models.Budget{},
+		&models.BudgetAlert{},
+		&models.Pocket{},
+		&models.PocketMovement{},
+		&models.InterestRate{},
+		&models.InterestAccrual{},
+		&models.InterestPayout{},
+		&models.ATMCode{},
+		&models.BillPayment{},
+		&models.PayoutBatch{},
+		&models.PayoutItem{},
+		&models.QRCode{},
 	)
 	if err != nil {
 		log.Fatal("migration failed:", err)
 	}
+
+	// audit_events is append-only, any UPDATE, DELETE or TRUNCATE is rejected
+	err = db.Exec(`
+	CREATE OR REPLACE FUNCTION reject_audit_event_change() RETURNS trigger AS $$
+	BEGIN
+		RAISE EXCEPTION 'audit_events is append-only';
+	END;
+	$$ LANGUAGE plpgsql;
+
+	DROP TRIGGER IF EXISTS audit_events_append_only ON audit_events;
+	CREATE TRIGGER audit_events_append_only
+	BEFORE UPDATE OR DELETE OR TRUNCATE ON audit_events
+	FOR EACH STATEMENT EXECUTE FUNCTION reject_audit_event_change();
+	`).Error
+	if err != nil {
+		log.Fatal("failed to protect audit_events: ", err)
+	}
+
+	// archived statements are kept exactly as they were written
+	err = db.Exec(`
+	CREATE OR REPLACE FUNCTION reject_monthly_statement_change() RETURNS trigger AS $$
+	BEGIN
+		RAISE EXCEPTION 'monthly_statements is append-only';
+	END;
+	$$ LANGUAGE plpgsql;
+
+	DROP TRIGGER IF EXISTS monthly_statements_append_only ON monthly_statements;
+	CREATE TRIGGER monthly_statements_append_only
+	BEFORE UPDATE OR DELETE OR TRUNCATE ON monthly_statements
+	FOR EACH STATEMENT EXECUTE FUNCTION reject_monthly_statement_change();
+	`).Error
+	if err != nil {
+		log.Fatal("failed to protect monthly_statements: ", err)
+	}
+
+	// chained transactions cannot be deleted and only the columns outside of
+	// the hash (updated_at and later bookkeeping flags) may change
+	err = db.Exec(`
+	CREATE UNIQUE INDEX IF NOT EXISTS idx_transactions_chain
+	ON transactions (account_id, sequence) WHERE hash IS NOT NULL;
+
+	CREATE OR REPLACE FUNCTION protect_chained_transaction() RETURNS trigger AS $$
+	BEGIN
+		IF TG_OP = 'DELETE' THEN
+			IF OLD.hash IS NOT NULL THEN
+				RAISE EXCEPTION 'chained transaction % cannot be deleted', OLD.id;
+			END IF;
+			RETURN OLD;
+		END IF;
+		IF OLD.hash IS NOT NULL AND (
+			NEW.id, NEW.account_id, NEW.amount, NEW.type, NEW.description,
+			NEW.related_account_id, NEW.external_account, NEW.bank_name,
+			NEW.created_at, NEW.deleted_at, NEW.sequence, NEW.prev_hash, NEW.hash,
+			NEW.reversal_of
+		) IS DISTINCT FROM (
+			OLD.id, OLD.account_id, OLD.amount, OLD.type, OLD.description,
+			OLD.related_account_id, OLD.external_account, OLD.bank_name,
+			OLD.created_at, OLD.deleted_at, OLD.sequence, OLD.prev_hash, OLD.hash,
+			OLD.reversal_of
+		) THEN
+			RAISE EXCEPTION 'chained transaction % is immutable', OLD.id;
+		END IF;
+		RETURN NEW;
+	END;
+	$$ LANGUAGE plpgsql;
+
+	DROP TRIGGER IF EXISTS transactions_immutable ON transactions;
+	CREATE TRIGGER transactions_immutable
+	BEFORE UPDATE OR DELETE ON transactions
+	FOR EACH ROW EXECUTE FUNCTION protect_chained_transaction();
+	`).Error
+	if err != nil {
+		log.Fatal("failed to protect transactions: ", err)
+	}
+	// unique keys only dedupe jobs that are still pending, workers claim due
+	// jobs in run_at order
+	err = db.Exec(`
+	CREATE UNIQUE INDEX IF NOT EXISTS idx_jobs_unique_key
+	ON jobs (unique_key) WHERE unique_key IS NOT NULL AND status IN ('QUEUED', 'RUNNING');
+
+	CREATE INDEX IF NOT EXISTS idx_jobs_due ON jobs (run_at) WHERE status = 'QUEUED';
+	`).Error
+	if err != nil {
+		log.Fatal("failed to index jobs: ", err)
+	}
+
+	// a main balance (no pocket) accrues once a day and is paid once a month
+	err = db.Exec(`
+	CREATE UNIQUE INDEX IF NOT EXISTS idx_interest_accrual_day
+	ON interest_accruals (account_id, COALESCE(pocket_id, '00000000-0000-0000-0000-000000000000'), day);
+
+	CREATE UNIQUE INDEX IF NOT EXISTS idx_interest_payout_period
+	ON interest_payouts (account_id, COALESCE(pocket_id, '00000000-0000-0000-0000-000000000000'), period);
+	`).Error
+	if err != nil {
+		log.Fatal("failed to index interest: ", err)
+	}
 	log.Println("migration success")
 }
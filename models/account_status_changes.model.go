@@ -0,0 +1,19 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+type AccountStatusChange struct {
+	ID         uuid.UUID  `gorm:"type:uuid;default:uuid_generate_v4();primaryKey"`
+	AccountID  uuid.UUID  `gorm:"type:uuid;not null;index"`
+	FromStatus string     `gorm:"type:varchar(16);not null"`
+	ToStatus   string     `gorm:"type:varchar(16);not null"`
+	Reason     string     `gorm:"type:text;not null"`
+	ChangedBy  *uuid.UUID `gorm:"type:uuid"`
+	CreatedAt  time.Time
+
+	Account *Account `gorm:"constraint:OnUpdate:CASCADE,OnDelete:CASCADE"`
+}
@@ -1,20 +1,214 @@
 package models
 
 import (
+	"errors"
 	"time"
 
 	"github.com/google/uuid"
 	"gorm.io/gorm"
 )
 
+const (
+	AccountStatusActive      = "ACTIVE"
+	AccountStatusDebitFrozen = "DEBIT_FROZEN"
+	AccountStatusFrozen      = "FROZEN"
+	AccountStatusDormant     = "DORMANT"
+	AccountStatusClosed      = "CLOSED"
+)
+
+var (
+	ErrAccountDebitFrozen = errors.New("account is debit frozen, outgoing transactions are blocked")
+	ErrAccountFrozen      = errors.New("account is frozen, all transactions are blocked")
+	ErrAccountDormant     = errors.New("account is dormant, contact support to reactivate it")
+	ErrAccountClosed      = errors.New("account is closed")
+	ErrAccountNotFound    = errors.New("account not found")
+	ErrInvalidTransition  = errors.New("invalid account status transition")
+	ErrBalanceNotZero     = errors.New("account balance must be zero before closing")
+	ErrActiveHolds        = errors.New("account has active holds, capture or void them first")
+	ErrPendingBills       = errors.New("account has bill payments waiting for the biller")
+)
+
+// Account.Balance is the ledger balance. HeldBalance is the sum of active
+// holds and PocketBalance the sum of its pockets, so the available balance
+// is Balance - HeldBalance - PocketBalance.
 type Account struct {
-	ID            uuid.UUID `gorm:"type:uuid;default:uuid_generate_v4();primaryKey"`
-	UserID        uuid.UUID `gorm:"type:uuid;not null"`
-	AccountNumber string    `gorm:"not null;unique"`
-	Balance       int64     `gorm:"not null"`
-	CreatedAt     time.Time
-	UpdatedAt     time.Time
-	DeletedAt     gorm.DeletedAt `gorm:"index"`
+	ID              uuid.UUID `gorm:"type:uuid;default:uuid_generate_v4();primaryKey"`
+	UserID          uuid.UUID `gorm:"type:uuid;not null"`
+	AccountNumber   string    `gorm:"not null;unique"`
+	Balance         int64     `gorm:"not null"`
+	HeldBalance     int64     `gorm:"not null;default:0"`
+	PocketBalance   int64     `gorm:"not null;default:0"`
+	Status          string    `gorm:"type:varchar(16);not null;default:ACTIVE"`
+	StatusReason    *string   `gorm:"type:text"`
+	StatusChangedAt *time.Time
+	CreatedAt       time.Time
+	UpdatedAt       time.Time
+	DeletedAt       gorm.DeletedAt `gorm:"index"`
 
 	User *User `gorm:"constraint:OnUpdate:CASCADE,OnDelete:SET NULL"`
 }
+
+func IsValidAccountStatus(status string) bool {
+	switch status {
+	case AccountStatusActive, AccountStatusDebitFrozen, AccountStatusFrozen,
+		AccountStatusDormant, AccountStatusClosed:
+		return true
+	}
+	return false
+}
+
+// CheckDebit reports whether money may leave an account in the given status.
+func CheckDebit(status string) error {
+	switch status {
+	case AccountStatusDebitFrozen:
+		return ErrAccountDebitFrozen
+	case AccountStatusFrozen:
+		return ErrAccountFrozen
+	case AccountStatusDormant:
+		return ErrAccountDormant
+	case AccountStatusClosed:
+		return ErrAccountClosed
+	}
+	return nil
+}
+
+// CheckCredit reports whether money may enter an account in the given status.
+// Debit frozen and dormant accounts still accept incoming funds.
+func CheckCredit(status string) error {
+	switch status {
+	case AccountStatusFrozen:
+		return ErrAccountFrozen
+	case AccountStatusClosed:
+		return ErrAccountClosed
+	}
+	return nil
+}
+
+// IsRestricted reports whether err was returned by CheckDebit or CheckCredit.
+func IsRestricted(err error) bool {
+	return errors.Is(err, ErrAccountDebitFrozen) || errors.Is(err, ErrAccountFrozen) ||
+		errors.Is(err, ErrAccountDormant) || errors.Is(err, ErrAccountClosed)
+}
+
+// ChangeAccountStatus moves an account to a new status and records the change
+// in account_status_changes. It must run inside a transaction. Closed is
+// terminal, so a closed account cannot be moved anywhere else.
+func ChangeAccountStatus(tx *gorm.DB, accountID uuid.UUID, to, reason string, actor *uuid.UUID) (string, error) {
+	if !IsValidAccountStatus(to) {
+		return "", ErrInvalidTransition
+	}
+
+	var from string
+	res := tx.Raw(`
+	SELECT status FROM accounts WHERE id = ? AND deleted_at IS NULL FOR UPDATE
+	`, accountID.String()).Scan(&from)
+	if res.Error != nil {
+		return "", res.Error
+	}
+	if res.RowsAffected == 0 {
+		return "", ErrAccountNotFound
+	}
+	if from == AccountStatusClosed || from == to {
+		return from, ErrInvalidTransition
+	}
+
+	now := time.Now()
+	err := tx.Exec(`
+	UPDATE accounts SET status = ?, status_reason = ?, status_changed_at = ?, updated_at = ?
+	WHERE id = ?
+	`, to, reason, now, now, accountID.String()).Error
+	if err != nil {
+		return from, err
+	}
+
+	change := AccountStatusChange{
+		AccountID:  accountID,
+		FromStatus: from,
+		ToStatus:   to,
+		Reason:     reason,
+		ChangedBy:  actor,
+		CreatedAt:  now,
+	}
+	return from, tx.Create(&change).Error
+}
+
+// BankDestination is the designated bank account a closing balance is swept to.
+type BankDestination struct {
+	AccountNumber string
+	BankName      string
+}
+
+// CloseAccount closes an account inside the given transaction. A remaining
+// balance is only allowed when sweep is set, in which case it is moved out as
+// a TRANSFER_OUT to the designated bank account before the status changes.
+// Pockets are emptied into the sweep and removed.
+func CloseAccount(tx *gorm.DB, accountID uuid.UUID, reason string, sweep *BankDestination, actor *uuid.UUID) (*Transactions, error) {
+	var account struct {
+		Balance       int64
+		HeldBalance   int64
+		PocketBalance int64
+	}
+	res := tx.Raw(`
+	SELECT balance, held_balance, pocket_balance FROM accounts WHERE id = ? AND deleted_at IS NULL FOR UPDATE
+	`, accountID.String()).Scan(&account)
+	if res.Error != nil {
+		return nil, res.Error
+	}
+	if res.RowsAffected == 0 {
+		return nil, ErrAccountNotFound
+	}
+	if account.HeldBalance > 0 {
+		return nil, ErrActiveHolds
+	}
+	// a pending payment may still be refunded to the account
+	var pending int64
+	err := tx.Model(&BillPayment{}).
+		Where("account_id = ? AND status = ?", accountID, BillPaymentStatusPending).
+		Count(&pending).Error
+	if err != nil {
+		return nil, err
+	}
+	if pending > 0 {
+		return nil, ErrPendingBills
+	}
+	balance := account.Balance
+
+	var swept *Transactions
+	if balance == 0 && account.PocketBalance != 0 {
+		return nil, ErrBalanceNotZero
+	}
+	if balance != 0 {
+		if sweep == nil || balance < 0 {
+			return nil, ErrBalanceNotZero
+		}
+		desc := "Closing Balance Sweep"
+		swept = &Transactions{
+			AccountID:       accountID,
+			Amount:          -balance,
+			Type:            "TRANSFER_OUT",
+			Description:     &desc,
+			ExternalAccount: &sweep.AccountNumber,
+			BankName:        &sweep.BankName,
+		}
+		if err := tx.Exec(`
+		UPDATE accounts SET balance = 0, pocket_balance = 0, updated_at = now() WHERE id = ?
+		`, accountID.String()).Error; err != nil {
+			return nil, err
+		}
+		if err := tx.Create(swept).Error; err != nil {
+			return nil, err
+		}
+	}
+
+	if err := tx.Exec(`
+	UPDATE pockets SET balance = 0, updated_at = now(), deleted_at = now()
+	WHERE account_id = ? AND deleted_at IS NULL
+	`, accountID.String()).Error; err != nil {
+		return nil, err
+	}
+
+	if _, err := ChangeAccountStatus(tx, accountID, AccountStatusClosed, reason, actor); err != nil {
+		return nil, err
+	}
+	return swept, nil
+}
@@ -0,0 +1,42 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const (
+	ATMCodeStatusActive    = "ACTIVE"
+	ATMCodeStatusRedeemed  = "REDEEMED"
+	ATMCodeStatusCancelled = "CANCELLED"
+	ATMCodeStatusExpired   = "EXPIRED"
+	ATMCodeStatusBlocked   = "BLOCKED"
+)
+
+// ATMCode is a one-time cardless cash withdrawal. The code and PIN are shown
+// to the user once, only their hashes are kept. While ACTIVE the amount is
+// reserved by HoldID, redeeming at an ATM captures the hold and every other
+// way out of ACTIVE releases it.
+type ATMCode struct {
+	ID          uuid.UUID `gorm:"type:uuid;default:uuid_generate_v4();primaryKey"`
+	AccountID   uuid.UUID `gorm:"type:uuid;not null;index"`
+	UserID      uuid.UUID `gorm:"type:uuid;not null"`
+	HoldID      uuid.UUID `gorm:"type:uuid;not null"`
+	Amount      int64     `gorm:"not null"`
+	CodeHash    string    `gorm:"type:varchar(64);not null;uniqueIndex"`
+	PinHash     string    `gorm:"type:text;not null"`
+	Status      string    `gorm:"type:varchar(10);not null;default:ACTIVE;index"`
+	PinFailures int       `gorm:"not null;default:0"`
+	ExpiresAt   time.Time `gorm:"not null;index"`
+	// TerminalID and NetworkReference identify the redemption on the ATM
+	// network, the reference makes a retried callback idempotent
+	TerminalID       *string    `gorm:"type:varchar(16)"`
+	NetworkReference *string    `gorm:"type:varchar(64);uniqueIndex"`
+	TransactionID    *uuid.UUID `gorm:"type:uuid"`
+	ClosedAt         *time.Time
+	CreatedAt        time.Time
+	UpdatedAt        time.Time
+
+	Account *Account `gorm:"constraint:OnUpdate:CASCADE,OnDelete:CASCADE"`
+}
@@ -0,0 +1,42 @@
+package models
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const (
+	AuditOutcomeSuccess = "SUCCESS"
+	AuditOutcomeFailure = "FAILURE"
+)
+
+// AuditEvent rows are append-only, migrations install a trigger that rejects
+// any UPDATE or DELETE on audit_events. RequestID carries the _id of the API
+// response that produced the event so both can be correlated.
+type AuditEvent struct {
+	ID         uuid.UUID  `gorm:"type:uuid;default:uuid_generate_v4();primaryKey"`
+	RequestID  *uuid.UUID `gorm:"type:uuid;index"`
+	ActorID    *uuid.UUID `gorm:"type:uuid;index"`
+	ActorRole  *string    `gorm:"type:varchar(10)"`
+	Action     string     `gorm:"type:varchar(64);not null;index"`
+	Outcome    string     `gorm:"type:varchar(8);not null;default:SUCCESS"`
+	TargetType string     `gorm:"type:varchar(32)"`
+	TargetID   *string    `gorm:"type:varchar(100);index"`
+	Reason     *string    `gorm:"type:text"`
+	IPAddress  *string    `gorm:"type:varchar(45)"`
+	UserAgent  *string    `gorm:"type:text"`
+	Changes    *string    `gorm:"type:jsonb"`
+	CreatedAt  time.Time  `gorm:"index"`
+}
+
+// SetChanges stores a before/after diff of the target as JSON.
+func (e *AuditEvent) SetChanges(before, after any) {
+	b, err := json.Marshal(map[string]any{"before": before, "after": after})
+	if err != nil {
+		return
+	}
+	changes := string(b)
+	e.Changes = &changes
+}
@@ -0,0 +1,22 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// BalanceSnapshot is the ledger balance of an account at the end of one
+// calendar day in Asia/Jakarta, that is everything booked before AsOf.
+// Sequence is the last chained entry included.
+type BalanceSnapshot struct {
+	ID        uuid.UUID `gorm:"type:uuid;default:uuid_generate_v4();primaryKey"`
+	AccountID uuid.UUID `gorm:"type:uuid;not null;uniqueIndex:idx_balance_snapshot_day"`
+	Day       time.Time `gorm:"type:date;not null;uniqueIndex:idx_balance_snapshot_day"`
+	AsOf      time.Time `gorm:"not null"`
+	Balance   int64     `gorm:"not null"`
+	Sequence  int64     `gorm:"not null;default:0"`
+	CreatedAt time.Time
+
+	Account *Account `gorm:"constraint:OnUpdate:CASCADE,OnDelete:CASCADE"`
+}
@@ -0,0 +1,48 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const (
+	BillPaymentStatusInquiry  = "INQUIRY"
+	BillPaymentStatusPending  = "PENDING"
+	BillPaymentStatusSuccess  = "SUCCESS"
+	BillPaymentStatusRefunded = "REFUNDED"
+
+	NotificationBillPaid     = "bill.paid"
+	NotificationBillRefunded = "bill.refunded"
+)
+
+// BillPayment is a bill or prepaid purchase. An inquiry quotes Amount (the
+// price or the amount due) plus AdminFee until ExpiresAt. Paying debits
+// Total as a BILL_PAYMENT and leaves it PENDING until the biller answers,
+// a purchase the biller fails is refunded.
+type BillPayment struct {
+	ID                  uuid.UUID  `gorm:"type:uuid;default:uuid_generate_v4();primaryKey"`
+	UserID              uuid.UUID  `gorm:"type:uuid;not null;index"`
+	AccountID           uuid.UUID  `gorm:"type:uuid;not null;index"`
+	ProductCode         string     `gorm:"type:varchar(32);not null"`
+	Biller              string     `gorm:"type:varchar(16);not null"`
+	CustomerID          string     `gorm:"type:varchar(32);not null"`
+	CustomerName        *string    `gorm:"type:varchar(100)"`
+	Amount              int64      `gorm:"not null"`
+	AdminFee            int64      `gorm:"not null;default:0"`
+	Total               int64      `gorm:"not null"`
+	Status              string     `gorm:"type:varchar(10);not null;default:INQUIRY;index"`
+	InquiryReference    *string    `gorm:"type:varchar(64)"`
+	BillerReference     *string    `gorm:"type:varchar(64)"`
+	Token               *string    `gorm:"type:varchar(64)"`
+	FailureReason       *string    `gorm:"type:text"`
+	TransactionID       *uuid.UUID `gorm:"type:uuid"`
+	RefundTransactionID *uuid.UUID `gorm:"type:uuid"`
+	ExpiresAt           time.Time  `gorm:"not null"`
+	PaidAt              *time.Time
+	CompletedAt         *time.Time
+	CreatedAt           time.Time
+	UpdatedAt           time.Time
+
+	Account *Account `gorm:"constraint:OnUpdate:CASCADE,OnDelete:CASCADE"`
+}
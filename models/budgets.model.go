@@ -0,0 +1,193 @@
+package models
+
+import (
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+const NotificationBudgetThreshold = "budget.threshold"
+
+// DefaultBudgetThresholds are the percentages alerted on when a budget does
+// not set its own.
+var DefaultBudgetThresholds = []int{80, 100}
+
+// Budget caps the monthly spending of an account, on one category or on
+// every debit when Category is empty. Months are calendar months in
+// Asia/Jakarta. Thresholds are percentages of Amount, comma separated.
+type Budget struct {
+	ID         uuid.UUID `gorm:"type:uuid;default:uuid_generate_v4();primaryKey"`
+	AccountID  uuid.UUID `gorm:"type:uuid;not null;uniqueIndex:idx_budget_category"`
+	UserID     uuid.UUID `gorm:"type:uuid;not null;index"`
+	Category   string    `gorm:"type:varchar(16);not null;default:'';uniqueIndex:idx_budget_category"`
+	Amount     int64     `gorm:"not null"`
+	Thresholds string    `gorm:"type:varchar(64);not null"`
+	CreatedAt  time.Time
+	UpdatedAt  time.Time
+
+	Account *Account `gorm:"constraint:OnUpdate:CASCADE,OnDelete:CASCADE"`
+}
+
+// BudgetAlert records a threshold a budget crossed in a month, so each one
+// is alerted once.
+type BudgetAlert struct {
+	ID            uuid.UUID `gorm:"type:uuid;default:uuid_generate_v4();primaryKey"`
+	BudgetID      uuid.UUID `gorm:"type:uuid;not null;uniqueIndex:idx_budget_alert_threshold"`
+	Period        string    `gorm:"type:varchar(7);not null;uniqueIndex:idx_budget_alert_threshold"`
+	Threshold     int       `gorm:"not null;uniqueIndex:idx_budget_alert_threshold"`
+	Spent         int64     `gorm:"not null"`
+	TransactionID uuid.UUID `gorm:"type:uuid;not null"`
+	CreatedAt     time.Time
+
+	Budget *Budget `gorm:"constraint:OnUpdate:CASCADE,OnDelete:CASCADE"`
+}
+
+// FormatThresholds stores thresholds sorted and without duplicates.
+func FormatThresholds(thresholds []int) string {
+	sorted := slices.Clone(thresholds)
+	slices.Sort(sorted)
+	sorted = slices.Compact(sorted)
+	parts := make([]string, len(sorted))
+	for i, t := range sorted {
+		parts[i] = strconv.Itoa(t)
+	}
+	return strings.Join(parts, ",")
+}
+
+// ThresholdList parses Thresholds.
+func (b *Budget) ThresholdList() []int {
+	var thresholds []int
+	for _, part := range strings.Split(b.Thresholds, ",") {
+		if t, err := strconv.Atoi(part); err == nil {
+			thresholds = append(thresholds, t)
+		}
+	}
+	return thresholds
+}
+
+// Crossed returns the thresholds spent has reached, lowest first.
+func (b *Budget) Crossed(spent int64) []int {
+	var crossed []int
+	for _, t := range b.ThresholdList() {
+		if spent*100 >= b.Amount*int64(t) {
+			crossed = append(crossed, t)
+		}
+	}
+	return crossed
+}
+
+// BudgetStatus is a budget with what was spent against it in Period.
+type BudgetStatus struct {
+	Budget
+	Period string
+	Spent  int64
+}
+
+// BudgetStatuses reads the budgets of accountID with their spending in the
+// month at falls in. Spending is the debits of the month less the refunds and
+// reversals that gave money back, a refund counts in the category of what it
+// refunds when that is known. Moves to the user's own accounts are not
+// spending and neither are fees and taxes for the overall budget. With a
+// category only the overall budget and the one of that category are read.
+func BudgetStatuses(db *gorm.DB, accountID uuid.UUID, category *string, at time.Time) ([]BudgetStatus, error) {
+	filter := ""
+	args := []any{at, accountID.String()}
+	if category != nil {
+		filter = "AND (b.category = '' OR b.category = ?)"
+		args = append(args, *category)
+	}
+
+	var statuses []BudgetStatus
+	err := db.Raw(`
+	WITH month AS (
+		SELECT date_trunc('month', ?::timestamptz AT TIME ZONE 'Asia/Jakarta') AS start
+	)
+	SELECT b.*, to_char(month.start, 'YYYY-MM') AS period, GREATEST(COALESCE((
+		SELECT -SUM(t.amount) FROM transactions t
+		WHERE t.account_id = b.account_id AND t.deleted_at IS NULL
+		AND t.created_at >= month.start AT TIME ZONE 'Asia/Jakarta'
+		AND t.created_at < (month.start + INTERVAL '1 month') AT TIME ZONE 'Asia/Jakarta'
+		AND ((
+			t.amount < 0 AND (b.category = '' OR t.category = b.category)
+			AND (b.category <> '' OR t.type NOT IN ('FEE', 'PAYOUT_FEE', 'TAX'))
+			AND NOT EXISTS (SELECT 1 FROM accounts o WHERE o.id = t.related_account_id AND o.user_id = b.user_id)
+		) OR (
+			t.amount > 0 AND t.type IN ('REFUND', 'REVERSAL') AND (b.category = '' OR COALESCE(
+				(SELECT o.category FROM transactions o WHERE o.id = t.reversal_of),
+				(SELECT o.category FROM bill_payments bp JOIN transactions o ON o.id = bp.transaction_id
+					WHERE bp.refund_transaction_id = t.id),
+				t.category
+			) = b.category)
+		))
+	), 0), 0) AS spent
+	FROM budgets b, month
+	WHERE b.account_id = ? `+filter+`
+	ORDER BY b.category
+	`, args...).Scan(&statuses).Error
+	return statuses, err
+}
+
+// EvaluateBudgets alerts the owner of every budget t pushed over one of its
+// thresholds. It runs in the transaction that writes t, so alerts commit
+// together with the debit. Every threshold crossed is recorded, only the
+// highest is notified.
+func EvaluateBudgets(tx *gorm.DB, t *Transactions) error {
+	if t.Amount >= 0 {
+		return nil
+	}
+	statuses, err := BudgetStatuses(tx, t.AccountID, &t.Category, t.CreatedAt)
+	if err != nil {
+		return err
+	}
+	for _, s := range statuses {
+		notify := 0
+		for _, threshold := range s.Crossed(s.Spent) {
+			res := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&BudgetAlert{
+				BudgetID:      s.ID,
+				Period:        s.Period,
+				Threshold:     threshold,
+				Spent:         s.Spent,
+				TransactionID: t.ID,
+			})
+			if res.Error != nil {
+				return res.Error
+			}
+			if res.RowsAffected > 0 {
+				notify = threshold
+			}
+		}
+		if notify == 0 {
+			continue
+		}
+
+		name := "overall"
+		if s.Category != "" {
+			name = s.Category
+		}
+		title := fmt.Sprintf("%d%% of your %s budget used", notify, name)
+		if notify >= 100 {
+			title = fmt.Sprintf("%s budget exceeded", name)
+		}
+		body := fmt.Sprintf("You have spent %d of your %d %s budget for %s.", s.Spent, s.Amount, name, s.Period)
+		err := Notify(tx, s.UserID, NotificationBudgetThreshold, title, body, map[string]any{
+			"budgetId":      s.ID,
+			"accountId":     s.AccountID,
+			"category":      s.Category,
+			"period":        s.Period,
+			"threshold":     notify,
+			"amount":        s.Amount,
+			"spent":         s.Spent,
+			"transactionId": t.ID,
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
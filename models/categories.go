@@ -0,0 +1,103 @@
+package models
+
+import (
+	"slices"
+	"strings"
+)
+
+const (
+	CategoryIncome        = "INCOME"
+	CategoryTransfer      = "TRANSFER"
+	CategoryCashOut       = "CASH_OUT"
+	CategoryFood          = "FOOD"
+	CategoryTransport     = "TRANSPORT"
+	CategoryShopping      = "SHOPPING"
+	CategoryBills         = "BILLS"
+	CategoryEntertainment = "ENTERTAINMENT"
+	CategoryHealth        = "HEALTH"
+	CategoryFees          = "FEES"
+	CategoryRefund        = "REFUND"
+	CategoryOther         = "OTHER"
+)
+
+// Categories lists every category a transaction can carry.
+var Categories = []string{
+	CategoryIncome, CategoryTransfer, CategoryCashOut, CategoryFood, CategoryTransport,
+	CategoryShopping, CategoryBills, CategoryEntertainment, CategoryHealth, CategoryFees,
+	CategoryRefund, CategoryOther,
+}
+
+// IsCategory reports whether category is one of Categories.
+func IsCategory(category string) bool {
+	return slices.Contains(Categories, category)
+}
+
+// CategoryRule assigns Category to transactions it matches. Empty fields
+// match anything. Direction is 1 for credits and -1 for debits, Banks and
+// Keywords are matched case-insensitively, keywords anywhere in the
+// description. NoBank matches only transactions without a bank.
+type CategoryRule struct {
+	Types     []string
+	Direction int
+	Banks     []string
+	NoBank    bool
+	Keywords  []string
+	Category  string
+}
+
+// CategoryRules are tried in order, the first match wins.
+var CategoryRules = []CategoryRule{
+	{Types: []string{"FEE", "PAYOUT_FEE", "TAX"}, Category: CategoryFees},
+	{Types: []string{"REFUND", "REVERSAL"}, Direction: 1, Category: CategoryRefund},
+	{Direction: 1, Category: CategoryIncome},
+	{Types: []string{"BILL_PAYMENT"}, Category: CategoryBills},
+	{Keywords: []string{"makan", "food", "resto", "cafe", "kopi", "coffee", "bakery", "warung"}, Category: CategoryFood},
+	{Keywords: []string{"gojek", "grab", "ojek", "taxi", "taksi", "bensin", "fuel", "parkir", "parking", "toll", "krl", "mrt", "kereta"}, Category: CategoryTransport},
+	{Keywords: []string{"pln", "listrik", "pdam", "internet", "wifi", "pulsa", "bpjs", "tagihan", "bill", "insurance", "asuransi"}, Category: CategoryBills},
+	{Keywords: []string{"netflix", "spotify", "youtube", "bioskop", "cinema", "steam", "game", "concert", "konser"}, Category: CategoryEntertainment},
+	{Keywords: []string{"apotek", "pharmacy", "klinik", "clinic", "hospital", "rumah sakit", "dokter", "doctor"}, Category: CategoryHealth},
+	{Keywords: []string{"tokopedia", "shopee", "lazada", "blibli", "indomaret", "alfamart", "market", "mall", "belanja", "shop"}, Category: CategoryShopping},
+	{Types: []string{"WITHDRAW"}, Banks: []string{"ATM"}, Category: CategoryCashOut},
+	{Types: []string{"WITHDRAW"}, NoBank: true, Category: CategoryCashOut},
+	{Types: []string{"WITHDRAW", "TRANSFER_OUT"}, Category: CategoryTransfer},
+	{Types: []string{"TRANSFER", "CAPTURE"}, Category: CategoryShopping},
+}
+
+// Match reports whether the rule applies to a transaction.
+func (r CategoryRule) Match(txType string, amount int64, bank, description *string) bool {
+	if len(r.Types) > 0 && !slices.Contains(r.Types, txType) {
+		return false
+	}
+	if r.Direction > 0 && amount <= 0 || r.Direction < 0 && amount >= 0 {
+		return false
+	}
+	if len(r.Banks) > 0 && (bank == nil || !slices.ContainsFunc(r.Banks, func(b string) bool {
+		return strings.EqualFold(b, *bank)
+	})) {
+		return false
+	}
+	if r.NoBank && bank != nil && *bank != "" {
+		return false
+	}
+	if len(r.Keywords) > 0 {
+		if description == nil {
+			return false
+		}
+		lower := strings.ToLower(*description)
+		if !slices.ContainsFunc(r.Keywords, func(k string) bool { return strings.Contains(lower, k) }) {
+			return false
+		}
+	}
+	return true
+}
+
+// Categorize returns the category of the first rule matching a transaction,
+// CategoryOther when none does.
+func Categorize(txType string, amount int64, bank, description *string) string {
+	for _, rule := range CategoryRules {
+		if rule.Match(txType, amount, bank, description) {
+			return rule.Category
+		}
+	}
+	return CategoryOther
+}
@@ -0,0 +1,18 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// ChainCheckpoint pins the head of an account's transaction hash chain at a
+// point in time. Signature is an HMAC over the other fields.
+type ChainCheckpoint struct {
+	ID        uuid.UUID `gorm:"type:uuid;default:uuid_generate_v4();primaryKey"`
+	AccountID uuid.UUID `gorm:"type:uuid;not null;index"`
+	Sequence  int64     `gorm:"not null"`
+	Hash      string    `gorm:"type:varchar(64);not null"`
+	Signature string    `gorm:"type:varchar(64);not null"`
+	CreatedAt time.Time
+}
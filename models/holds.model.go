@@ -0,0 +1,47 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const (
+	HoldStatusActive   = "ACTIVE"
+	HoldStatusCaptured = "CAPTURED"
+	HoldStatusVoided   = "VOIDED"
+	HoldStatusExpired  = "EXPIRED"
+)
+
+const (
+	HoldOwnerATM    = "atm"
+	HoldOwnerPayout = "payout"
+)
+
+// Hold reserves part of an account's balance. While ACTIVE its Amount is
+// counted in Account.HeldBalance, which lowers the available balance without
+// touching the ledger balance.
+type Hold struct {
+	ID              uuid.UUID `gorm:"type:uuid;default:uuid_generate_v4();primaryKey"`
+	AccountID       uuid.UUID `gorm:"type:uuid;not null;index"`
+	Amount          int64     `gorm:"not null"`
+	CapturedAmount  int64     `gorm:"not null;default:0"`
+	Status          string    `gorm:"type:varchar(10);not null;default:ACTIVE;index"`
+	Reference       *string   `gorm:"type:varchar(64)"`
+	Description     *string   `gorm:"type:text"`
+	ExternalAccount *string   `gorm:"type:varchar(30)"`
+	BankName        *string   `gorm:"type:varchar(8)"`
+	// PlacedBy is the user who placed the hold through the holds API
+	PlacedBy *uuid.UUID `gorm:"type:uuid"`
+	// Owner is the subsystem that placed the hold and alone settles it, it
+	// is nil for holds placed through the holds API
+	Owner *string `gorm:"type:varchar(16)"`
+	// TransactionID is the ledger entry written on capture
+	TransactionID *uuid.UUID `gorm:"type:uuid"`
+	ExpiresAt     time.Time  `gorm:"not null;index"`
+	ReleasedAt    *time.Time
+	CreatedAt     time.Time
+	UpdatedAt     time.Time
+
+	Account *Account `gorm:"constraint:OnUpdate:CASCADE,OnDelete:CASCADE"`
+}
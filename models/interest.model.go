@@ -0,0 +1,68 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const (
+	InterestScopeAccount = "ACCOUNT"
+	InterestScopePocket  = "POCKET"
+)
+
+// InterestRate is one tier of an interest schedule. A schedule is every tier
+// of a scope sharing EffectiveFrom and applies from that day until the next
+// schedule of the scope. A tier pays RateBps a year on the part of the end
+// of day balance between its MinBalance and the MinBalance of the next tier.
+type InterestRate struct {
+	ID            uuid.UUID  `gorm:"type:uuid;default:uuid_generate_v4();primaryKey"`
+	Scope         string     `gorm:"type:varchar(8);not null;uniqueIndex:idx_interest_rate_tier,priority:1"`
+	EffectiveFrom time.Time  `gorm:"type:date;not null;uniqueIndex:idx_interest_rate_tier,priority:2"`
+	MinBalance    int64      `gorm:"not null;uniqueIndex:idx_interest_rate_tier,priority:3"`
+	RateBps       int64      `gorm:"not null"`
+	CreatedBy     *uuid.UUID `gorm:"type:uuid"`
+	CreatedAt     time.Time
+}
+
+// InterestAccrual is the interest earned on one day by the main balance of
+// an account, or by one of its pockets when PocketID is set. Balance is the
+// end of day balance in rupiah and Amount the interest in micro rupiah.
+type InterestAccrual struct {
+	ID        uuid.UUID  `gorm:"type:uuid;default:uuid_generate_v4();primaryKey"`
+	AccountID uuid.UUID  `gorm:"type:uuid;not null;index"`
+	PocketID  *uuid.UUID `gorm:"type:uuid"`
+	Day       time.Time  `gorm:"type:date;not null;index"`
+	Balance   int64      `gorm:"not null"`
+	Amount    int64      `gorm:"not null"`
+	CreatedAt time.Time
+
+	Account *Account `gorm:"constraint:OnUpdate:CASCADE,OnDelete:CASCADE"`
+}
+
+// InterestPayout is the monthly payment of what a main balance or a pocket
+// accrued in Period (YYYY-MM). Accrued, CarryIn and CarryOut are in micro
+// rupiah, the rest in rupiah. Gross is booked as an INTEREST transfer from
+// the interest account and Tax, TaxBps of it withheld, as a TAX transfer to
+// the tax account. Deferred says why nothing was booked, the whole amount is
+// then carried to the next month.
+type InterestPayout struct {
+	ID               uuid.UUID  `gorm:"type:uuid;default:uuid_generate_v4();primaryKey"`
+	AccountID        uuid.UUID  `gorm:"type:uuid;not null;index"`
+	PocketID         *uuid.UUID `gorm:"type:uuid"`
+	Period           string     `gorm:"type:varchar(7);not null;index"`
+	Days             int64      `gorm:"not null"`
+	Accrued          int64      `gorm:"not null"`
+	CarryIn          int64      `gorm:"not null"`
+	Gross            int64      `gorm:"not null"`
+	TaxBps           int64      `gorm:"not null"`
+	Tax              int64      `gorm:"not null"`
+	Net              int64      `gorm:"not null"`
+	CarryOut         int64      `gorm:"not null"`
+	TransactionID    *uuid.UUID `gorm:"type:uuid"`
+	TaxTransactionID *uuid.UUID `gorm:"type:uuid"`
+	Deferred         *string    `gorm:"type:text"`
+	CreatedAt        time.Time
+
+	Account *Account `gorm:"constraint:OnUpdate:CASCADE,OnDelete:CASCADE"`
+}
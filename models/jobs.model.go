@@ -0,0 +1,34 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const (
+	JobStatusQueued    = "QUEUED"
+	JobStatusRunning   = "RUNNING"
+	JobStatusSucceeded = "SUCCEEDED"
+	JobStatusDead      = "DEAD"
+)
+
+// Job is a unit of background work. Workers claim QUEUED jobs whose RunAt
+// has passed with FOR UPDATE SKIP LOCKED. A failed job is queued again with
+// backoff until MaxAttempts is used up, then it is DEAD until an admin
+// retries it. UniqueKey, when set, is unique among QUEUED and RUNNING jobs.
+type Job struct {
+	ID          uuid.UUID `gorm:"type:uuid;default:uuid_generate_v4();primaryKey"`
+	Type        string    `gorm:"type:varchar(64);not null;index"`
+	Payload     string    `gorm:"type:jsonb;not null;default:'{}'"`
+	Status      string    `gorm:"type:varchar(10);not null;default:QUEUED"`
+	UniqueKey   *string   `gorm:"type:varchar(255)"`
+	Attempts    int       `gorm:"not null;default:0"`
+	MaxAttempts int       `gorm:"not null;default:10"`
+	RunAt       time.Time `gorm:"not null"`
+	LockedAt    *time.Time
+	LastError   *string `gorm:"type:text"`
+	FinishedAt  *time.Time
+	CreatedAt   time.Time
+	UpdatedAt   time.Time
+}
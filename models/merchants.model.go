@@ -0,0 +1,94 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const (
+	MerchantStatusActive    = "ACTIVE"
+	MerchantStatusSuspended = "SUSPENDED"
+)
+
+const (
+	PaymentIntentPending   = "PENDING"
+	PaymentIntentSucceeded = "SUCCEEDED"
+	PaymentIntentCancelled = "CANCELLED"
+	PaymentIntentExpired   = "EXPIRED"
+)
+
+// Merchant accepts wallet payments into its settlement account. Payment
+// notifications go to WebhookEndpointID, an endpoint scoped to that account.
+type Merchant struct {
+	ID                uuid.UUID  `gorm:"type:uuid;default:uuid_generate_v4();primaryKey"`
+	OwnerID           uuid.UUID  `gorm:"type:uuid;not null;index"`
+	AccountID         uuid.UUID  `gorm:"type:uuid;not null;uniqueIndex"`
+	Name              string     `gorm:"size:100;not null"`
+	Status            string     `gorm:"type:varchar(10);not null;default:ACTIVE"`
+	WebhookEndpointID *uuid.UUID `gorm:"type:uuid"`
+	CreatedAt         time.Time
+	UpdatedAt         time.Time
+
+	Owner   *User    `gorm:"constraint:OnUpdate:CASCADE,OnDelete:CASCADE"`
+	Account *Account `gorm:"constraint:OnUpdate:CASCADE,OnDelete:CASCADE"`
+}
+
+// MerchantAPIKey authenticates server-to-server calls. Only the SHA-256 of
+// the secret part is stored, Prefix finds the row.
+type MerchantAPIKey struct {
+	ID         uuid.UUID `gorm:"type:uuid;default:uuid_generate_v4();primaryKey"`
+	MerchantID uuid.UUID `gorm:"type:uuid;not null;index"`
+	Prefix     string    `gorm:"type:varchar(16);not null;uniqueIndex"`
+	KeyHash    string    `gorm:"type:varchar(64);not null"`
+	Label      *string   `gorm:"size:100"`
+	LastUsedAt *time.Time
+	RevokedAt  *time.Time
+	CreatedAt  time.Time
+
+	Merchant *Merchant `gorm:"constraint:OnUpdate:CASCADE,OnDelete:CASCADE"`
+}
+
+// PaymentIntent is a checkout a wallet user confirms. Reference is the
+// merchant's own order id and is unique per merchant, so retried creates
+// return the same intent.
+type PaymentIntent struct {
+	ID             uuid.UUID  `gorm:"type:uuid;default:uuid_generate_v4();primaryKey"`
+	MerchantID     uuid.UUID  `gorm:"type:uuid;not null;uniqueIndex:idx_payment_intent_reference"`
+	Reference      string     `gorm:"type:varchar(64);not null;uniqueIndex:idx_payment_intent_reference"`
+	Amount         int64      `gorm:"not null"`
+	Description    *string    `gorm:"type:text"`
+	Status         string     `gorm:"type:varchar(10);not null;default:PENDING;index"`
+	ExpiresAt      time.Time  `gorm:"not null"`
+	PayerAccountID *uuid.UUID `gorm:"type:uuid"`
+	// TransactionID is the payer's TRANSFER row, SettlementTransactionID the
+	// merchant's one that refunds are made against
+	TransactionID           *uuid.UUID `gorm:"type:uuid"`
+	SettlementTransactionID *uuid.UUID `gorm:"type:uuid;index"`
+	Fee                     int64      `gorm:"not null;default:0"`
+	RefundedAmount          int64      `gorm:"not null;default:0"`
+	PaidAt                  *time.Time
+	CreatedAt               time.Time
+	UpdatedAt               time.Time
+
+	Merchant *Merchant `gorm:"constraint:OnUpdate:CASCADE,OnDelete:CASCADE"`
+}
+
+// Refund gives back part or all of a payment. PaymentTransactionID is the
+// merchant's TRANSFER row of the payment, the refunds made against it never
+// add up to more than its amount. Reference is the merchant's own id for the
+// refund, retries with the same one return the same refund.
+type Refund struct {
+	ID                   uuid.UUID  `gorm:"type:uuid;default:uuid_generate_v4();primaryKey"`
+	MerchantID           uuid.UUID  `gorm:"type:uuid;not null;uniqueIndex:idx_refund_reference"`
+	Reference            *string    `gorm:"type:varchar(64);uniqueIndex:idx_refund_reference"`
+	PaymentTransactionID uuid.UUID  `gorm:"type:uuid;not null;index"`
+	PaymentIntentID      *uuid.UUID `gorm:"type:uuid;index"`
+	Amount               int64      `gorm:"not null"`
+	Reason               *string    `gorm:"type:text"`
+	// TransactionID is the merchant's REFUND row
+	TransactionID uuid.UUID `gorm:"type:uuid;not null"`
+	CreatedAt     time.Time
+
+	Merchant *Merchant `gorm:"constraint:OnUpdate:CASCADE,OnDelete:CASCADE"`
+}
@@ -0,0 +1,43 @@
+package models
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+const (
+	NotificationSplitBillReminder = "split_bill.reminder"
+	NotificationSplitBillPaid     = "split_bill.paid"
+)
+
+// Notification is a message for one user, shown in the app until read.
+type Notification struct {
+	ID        uuid.UUID `gorm:"type:uuid;default:uuid_generate_v4();primaryKey"`
+	UserID    uuid.UUID `gorm:"type:uuid;not null;index:idx_notifications_user,priority:1"`
+	Type      string    `gorm:"type:varchar(64);not null"`
+	Title     string    `gorm:"size:200;not null"`
+	Body      string    `gorm:"type:text;not null"`
+	Data      *string   `gorm:"type:jsonb"`
+	ReadAt    *time.Time
+	CreatedAt time.Time `gorm:"index:idx_notifications_user,priority:2,sort:desc"`
+
+	User *User `gorm:"constraint:OnUpdate:CASCADE,OnDelete:CASCADE"`
+}
+
+// Notify writes a notification for userID. data is stored as JSON and may be
+// nil. Run it in the transaction of the change it reports.
+func Notify(tx *gorm.DB, userID uuid.UUID, notificationType, title, body string, data any) error {
+	n := Notification{UserID: userID, Type: notificationType, Title: title, Body: body}
+	if data != nil {
+		b, err := json.Marshal(data)
+		if err != nil {
+			return err
+		}
+		s := string(b)
+		n.Data = &s
+	}
+	return tx.Create(&n).Error
+}
@@ -0,0 +1,97 @@
+package models
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+const (
+	EventTransactionCreated = "transaction.created"
+	EventBalanceChanged     = "balance.changed"
+	EventTransferFailed     = "transfer.failed"
+	EventPaymentSucceeded   = "payment.succeeded"
+	EventPaymentRefunded    = "payment.refunded"
+)
+
+// IsValidEventType reports whether a webhook endpoint can subscribe to eventType.
+func IsValidEventType(eventType string) bool {
+	switch eventType {
+	case EventTransactionCreated, EventBalanceChanged, EventTransferFailed, EventPaymentSucceeded, EventPaymentRefunded:
+		return true
+	}
+	return false
+}
+
+// OutboxEvent is a domain event written in the same database transaction as
+// the change it describes. Position is a global, gap-tolerant order used to
+// deliver events of one account in the order they committed.
+type OutboxEvent struct {
+	ID           uuid.UUID  `gorm:"type:uuid;default:uuid_generate_v4();primaryKey"`
+	Position     int64      `gorm:"type:bigserial;not null;uniqueIndex"`
+	AccountID    *uuid.UUID `gorm:"type:uuid;index"`
+	Type         string     `gorm:"type:varchar(64);not null;index"`
+	Payload      string     `gorm:"type:jsonb;not null"`
+	CreatedAt    time.Time
+	DispatchedAt *time.Time `gorm:"index"`
+}
+
+// OutboxChannel is the LISTEN/NOTIFY channel that announces new outbox rows.
+// Postgres only delivers the notification once the transaction commits.
+const OutboxChannel = "outbox_events"
+
+// AppendOutbox writes an event to the outbox and notifies OutboxChannel with
+// its account and position. tx must be the transaction of the change so the
+// event commits or rolls back with it.
+func AppendOutbox(tx *gorm.DB, accountID *uuid.UUID, eventType string, payload any) error {
+	b, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+	return tx.Exec(`
+	WITH e AS (
+		INSERT INTO outbox_events (account_id, type, payload, created_at) VALUES (?, ?, ?, now())
+		RETURNING account_id, position
+	)
+	SELECT pg_notify(?, json_build_object('accountId', account_id, 'position', position)::text) FROM e
+	`, accountID, eventType, string(b), OutboxChannel).Error
+}
+
+// PublishBalance writes balance.changed with the account's current balances.
+// transactionID is nil when only the held or pocket balance moved, as when a
+// hold is placed or money is put in a pocket.
+func PublishBalance(tx *gorm.DB, accountID uuid.UUID, transactionID *uuid.UUID) error {
+	var account struct {
+		Balance       int64
+		HeldBalance   int64
+		PocketBalance int64
+	}
+	err := tx.Raw(`
+	SELECT balance, held_balance, pocket_balance FROM accounts WHERE id = ?
+	`, accountID.String()).Scan(&account).Error
+	if err != nil {
+		return err
+	}
+	return AppendOutbox(tx, &accountID, EventBalanceChanged, map[string]any{
+		"accountId":        accountID,
+		"transactionId":    transactionID,
+		"ledgerBalance":    account.Balance,
+		"availableBalance": account.Balance - account.HeldBalance - account.PocketBalance,
+		"pocketBalance":    account.PocketBalance,
+	})
+}
+
+// PublishTransferFailed writes transfer.failed for a debit that was refused.
+// destination and bankName are nil for cash withdrawals.
+func PublishTransferFailed(tx *gorm.DB, accountID uuid.UUID, txType string, amount int64, reason string, destination, bankName *string) error {
+	return AppendOutbox(tx, &accountID, EventTransferFailed, map[string]any{
+		"accountId": accountID,
+		"type":      txType,
+		"amount":    amount,
+		"reason":    reason,
+		"to":        destination,
+		"bankName":  bankName,
+	})
+}
@@ -0,0 +1,40 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const (
+	PaymentRequestPending   = "PENDING"
+	PaymentRequestPaid      = "PAID"
+	PaymentRequestDeclined  = "DECLINED"
+	PaymentRequestCancelled = "CANCELLED"
+	PaymentRequestExpired   = "EXPIRED"
+)
+
+// PaymentRequest asks for money into AccountID. PayerID names the wallet user
+// who should pay, without it anyone holding the link token can pay.
+type PaymentRequest struct {
+	ID          uuid.UUID  `gorm:"type:uuid;default:uuid_generate_v4();primaryKey"`
+	RequesterID uuid.UUID  `gorm:"type:uuid;not null;index"`
+	AccountID   uuid.UUID  `gorm:"type:uuid;not null"`
+	PayerID     *uuid.UUID `gorm:"type:uuid;index"`
+	Amount      int64      `gorm:"not null"`
+	Note        *string    `gorm:"type:text"`
+	// LinkToken is the secret part of the shareable pay link
+	LinkToken string    `gorm:"type:varchar(64);not null;uniqueIndex"`
+	Status    string    `gorm:"type:varchar(10);not null;default:PENDING;index"`
+	ExpiresAt time.Time `gorm:"not null"`
+	// PayerAccountID and TransactionID are set once paid, TransactionID is
+	// the payer's TRANSFER_OUT row
+	PayerAccountID *uuid.UUID `gorm:"type:uuid"`
+	TransactionID  *uuid.UUID `gorm:"type:uuid"`
+	PaidAt         *time.Time
+	CreatedAt      time.Time
+	UpdatedAt      time.Time
+
+	Requester *User    `gorm:"constraint:OnUpdate:CASCADE,OnDelete:CASCADE"`
+	Account   *Account `gorm:"constraint:OnUpdate:CASCADE,OnDelete:CASCADE"`
+}
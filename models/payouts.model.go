@@ -0,0 +1,67 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const (
+	PayoutBatchStatusPreview    = "PREVIEW"
+	PayoutBatchStatusProcessing = "PROCESSING"
+	PayoutBatchStatusCompleted  = "COMPLETED"
+
+	PayoutItemStatusPending = "PENDING"
+	PayoutItemStatusSuccess = "SUCCESS"
+	PayoutItemStatusFailed  = "FAILED"
+
+	NotificationPayoutCompleted = "payout.completed"
+)
+
+// PayoutBatch is an uploaded file of bank payouts from AccountID. It is a
+// PREVIEW until executed before ExpiresAt, executing holds Total plus Fees
+// with HoldID and pays the items in the background. What failed items
+// reserved is released once the batch is COMPLETED.
+type PayoutBatch struct {
+	ID          uuid.UUID  `gorm:"type:uuid;default:uuid_generate_v4();primaryKey"`
+	AccountID   uuid.UUID  `gorm:"type:uuid;not null;index"`
+	UserID      uuid.UUID  `gorm:"type:uuid;not null"`
+	FileName    *string    `gorm:"type:varchar(255)"`
+	Status      string     `gorm:"type:varchar(10);not null;default:PREVIEW;index"`
+	Items       int        `gorm:"not null"`
+	Total       int64      `gorm:"not null"`
+	Fees        int64      `gorm:"not null;default:0"`
+	Succeeded   int        `gorm:"not null;default:0"`
+	Failed      int        `gorm:"not null;default:0"`
+	PaidAmount  int64      `gorm:"not null;default:0"`
+	HoldID      *uuid.UUID `gorm:"type:uuid"`
+	ExpiresAt   time.Time  `gorm:"not null"`
+	ExecutedAt  *time.Time
+	CompletedAt *time.Time
+	CreatedAt   time.Time
+	UpdatedAt   time.Time
+
+	Account *Account `gorm:"constraint:OnUpdate:CASCADE,OnDelete:CASCADE"`
+}
+
+// PayoutItem is one row of a payout file, Line is its line in the file.
+type PayoutItem struct {
+	ID               uuid.UUID  `gorm:"type:uuid;default:uuid_generate_v4();primaryKey"`
+	BatchID          uuid.UUID  `gorm:"type:uuid;not null;uniqueIndex:idx_payout_item_line"`
+	Line             int        `gorm:"not null;uniqueIndex:idx_payout_item_line"`
+	BankCode         string     `gorm:"type:varchar(8);not null"`
+	AccountNumber    string     `gorm:"type:varchar(30);not null"`
+	AccountName      string     `gorm:"type:varchar(100);not null"`
+	Amount           int64      `gorm:"not null"`
+	Fee              int64      `gorm:"not null;default:0"`
+	Reference        *string    `gorm:"type:varchar(64)"`
+	Status           string     `gorm:"type:varchar(8);not null;default:PENDING;index"`
+	FailureReason    *string    `gorm:"type:text"`
+	TransactionID    *uuid.UUID `gorm:"type:uuid"`
+	FeeTransactionID *uuid.UUID `gorm:"type:uuid"`
+	ProcessedAt      *time.Time
+	CreatedAt        time.Time
+	UpdatedAt        time.Time
+
+	Batch *PayoutBatch `gorm:"constraint:OnUpdate:CASCADE,OnDelete:CASCADE"`
+}
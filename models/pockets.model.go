@@ -0,0 +1,48 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// MaxPockets is how many open pockets an account may have.
+const MaxPockets = 20
+
+// Pocket is a named part of an account's balance set aside for saving. The
+// money stays in the account, Account.PocketBalance adds up its pockets and
+// is not available for spending. A locked pocket cannot be drawn from, and
+// not unlocked before its TargetDate.
+type Pocket struct {
+	ID           uuid.UUID `gorm:"type:uuid;default:uuid_generate_v4();primaryKey"`
+	AccountID    uuid.UUID `gorm:"type:uuid;not null;index"`
+	Name         string    `gorm:"size:50;not null"`
+	Balance      int64     `gorm:"not null;default:0"`
+	TargetAmount *int64
+	TargetDate   *time.Time `gorm:"type:date"`
+	Locked       bool       `gorm:"not null;default:false"`
+	CreatedAt    time.Time
+	UpdatedAt    time.Time
+	DeletedAt    gorm.DeletedAt `gorm:"index"`
+
+	Account *Account `gorm:"constraint:OnUpdate:CASCADE,OnDelete:CASCADE"`
+}
+
+// PocketMovement is money moved between the main balance and a pocket.
+// Amount is positive into the pocket and Balance the pocket balance after.
+type PocketMovement struct {
+	ID        uuid.UUID `gorm:"type:uuid;default:uuid_generate_v4();primaryKey"`
+	PocketID  uuid.UUID `gorm:"type:uuid;not null;index:idx_pocket_movements,priority:1"`
+	AccountID uuid.UUID `gorm:"type:uuid;not null"`
+	Amount    int64     `gorm:"not null"`
+	Balance   int64     `gorm:"not null"`
+	CreatedAt time.Time `gorm:"index:idx_pocket_movements,priority:2,sort:desc"`
+
+	Pocket *Pocket `gorm:"constraint:OnUpdate:CASCADE,OnDelete:CASCADE"`
+}
+
+// LockedUntil reports whether the pocket can still not be unlocked at now.
+func (p *Pocket) LockedUntil(now time.Time) bool {
+	return p.TargetDate != nil && now.Before(*p.TargetDate)
+}
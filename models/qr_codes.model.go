@@ -0,0 +1,29 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const (
+	QRCodeStatusActive = "ACTIVE"
+	QRCodeStatusPaid   = "PAID"
+)
+
+// QRCode backs a dynamic account payload, its id is carried in the payload
+// so the code pays Amount into AccountID once and is PAID after that.
+type QRCode struct {
+	ID            uuid.UUID  `gorm:"type:uuid;default:uuid_generate_v4();primaryKey"`
+	AccountID     uuid.UUID  `gorm:"type:uuid;not null;index"`
+	Amount        int64      `gorm:"not null"`
+	Reference     *string    `gorm:"type:varchar(25)"`
+	Status        string     `gorm:"type:varchar(10);not null;default:ACTIVE"`
+	ExpiresAt     time.Time  `gorm:"not null"`
+	TransactionID *uuid.UUID `gorm:"type:uuid"`
+	PaidAt        *time.Time
+	CreatedAt     time.Time
+	UpdatedAt     time.Time
+
+	Account *Account `gorm:"constraint:OnUpdate:CASCADE,OnDelete:CASCADE"`
+}
@@ -0,0 +1,66 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const (
+	ScheduleStatusActive    = "ACTIVE"
+	ScheduleStatusPaused    = "PAUSED"
+	ScheduleStatusCancelled = "CANCELLED"
+	ScheduleStatusCompleted = "COMPLETED"
+)
+
+const (
+	ScheduleRunSuccess  = "SUCCESS"
+	ScheduleRunRetrying = "RETRYING"
+	ScheduleRunFailed   = "FAILED"
+)
+
+// ScheduledTransfer is a bank transfer that runs once at StartAt, or
+// repeatedly when Recurrence holds an RRULE such as "FREQ=MONTHLY;BYMONTHDAY=1".
+// NextOccurrenceAt is the occurrence being worked on, NextRunAt is when the
+// scheduler picks it up again and moves forward on insufficient balance
+// retries.
+type ScheduledTransfer struct {
+	ID               uuid.UUID `gorm:"type:uuid;default:uuid_generate_v4();primaryKey"`
+	AccountID        uuid.UUID `gorm:"type:uuid;not null;index"`
+	UserID           uuid.UUID `gorm:"type:uuid;not null;index"`
+	Amount           int64     `gorm:"not null"`
+	Destination      string    `gorm:"type:varchar(30);not null"`
+	BankName         string    `gorm:"type:varchar(8);not null"`
+	Description      *string   `gorm:"type:text"`
+	Recurrence       *string   `gorm:"type:varchar(255)"`
+	StartAt          time.Time `gorm:"not null"`
+	EndAt            *time.Time
+	MaxOccurrences   *int
+	Occurrences      int `gorm:"not null;default:0"` // used up, paid or failed
+	NextOccurrenceAt *time.Time
+	NextRunAt        *time.Time `gorm:"index"`
+	Status           string     `gorm:"type:varchar(10);not null;default:ACTIVE;index"`
+	MaxRetries       int        `gorm:"not null;default:0"`
+	RetryInterval    int64      `gorm:"not null;default:0"` // seconds
+	RetryAttempt     int        `gorm:"not null;default:0"`
+	LastRunAt        *time.Time
+	CreatedAt        time.Time
+	UpdatedAt        time.Time
+
+	Account *Account `gorm:"constraint:OnUpdate:CASCADE,OnDelete:CASCADE"`
+	User    *User    `gorm:"constraint:OnUpdate:CASCADE,OnDelete:CASCADE"`
+}
+
+// ScheduledTransferRun records the outcome of every attempt at an occurrence.
+type ScheduledTransferRun struct {
+	ID                  uuid.UUID  `gorm:"type:uuid;default:uuid_generate_v4();primaryKey"`
+	ScheduledTransferID uuid.UUID  `gorm:"type:uuid;not null;index"`
+	ScheduledFor        time.Time  `gorm:"not null"`
+	Attempt             int        `gorm:"not null"`
+	Status              string     `gorm:"type:varchar(10);not null"`
+	Error               *string    `gorm:"type:text"`
+	TransactionID       *uuid.UUID `gorm:"type:uuid"`
+	CreatedAt           time.Time
+
+	ScheduledTransfer *ScheduledTransfer `gorm:"constraint:OnUpdate:CASCADE,OnDelete:CASCADE"`
+}
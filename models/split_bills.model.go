@@ -0,0 +1,67 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const (
+	SplitMethodEqual   = "EQUAL"
+	SplitMethodCustom  = "CUSTOM"
+	SplitMethodPercent = "PERCENT"
+)
+
+const (
+	SplitBillOpen      = "OPEN"
+	SplitBillSettled   = "SETTLED"
+	SplitBillCancelled = "CANCELLED"
+)
+
+const (
+	ShareUnpaid    = "UNPAID"
+	SharePaid      = "PAID"
+	ShareCancelled = "CANCELLED"
+)
+
+// SplitBill collects TotalAmount from its participants into the organizer's
+// AccountID. Unpaid shares are reminded every ReminderInterval seconds.
+type SplitBill struct {
+	ID               uuid.UUID `gorm:"type:uuid;default:uuid_generate_v4();primaryKey"`
+	OrganizerID      uuid.UUID `gorm:"type:uuid;not null;index"`
+	AccountID        uuid.UUID `gorm:"type:uuid;not null"`
+	Title            string    `gorm:"size:100;not null"`
+	TotalAmount      int64     `gorm:"not null"`
+	Method           string    `gorm:"type:varchar(8);not null"`
+	Status           string    `gorm:"type:varchar(10);not null;default:OPEN;index"`
+	DueAt            *time.Time
+	ReminderInterval int64 `gorm:"not null"`
+	CreatedAt        time.Time
+	UpdatedAt        time.Time
+
+	Shares    []SplitBillShare `gorm:"constraint:OnUpdate:CASCADE,OnDelete:CASCADE"`
+	Organizer *User            `gorm:"constraint:OnUpdate:CASCADE,OnDelete:CASCADE"`
+	Account   *Account         `gorm:"constraint:OnUpdate:CASCADE,OnDelete:CASCADE"`
+}
+
+// SplitBillShare is what one participant owes. Percent is in basis points
+// and only set for PERCENT bills. The organizer's own share is PAID from the
+// start and has no transaction.
+type SplitBillShare struct {
+	ID             uuid.UUID `gorm:"type:uuid;default:uuid_generate_v4();primaryKey"`
+	SplitBillID    uuid.UUID `gorm:"type:uuid;not null;uniqueIndex:idx_split_bill_share_user"`
+	UserID         uuid.UUID `gorm:"type:uuid;not null;uniqueIndex:idx_split_bill_share_user;index"`
+	Amount         int64     `gorm:"not null"`
+	Percent        *int64
+	Status         string     `gorm:"type:varchar(10);not null;default:UNPAID"`
+	PayerAccountID *uuid.UUID `gorm:"type:uuid"`
+	// TransactionID is the participant's TRANSFER_OUT row
+	TransactionID  *uuid.UUID `gorm:"type:uuid"`
+	PaidAt         *time.Time
+	RemindersSent  int        `gorm:"not null;default:0"`
+	NextReminderAt *time.Time `gorm:"index"`
+	CreatedAt      time.Time
+	UpdatedAt      time.Time
+
+	User *User `gorm:"constraint:OnUpdate:CASCADE,OnDelete:CASCADE"`
+}
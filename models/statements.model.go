@@ -0,0 +1,31 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// MonthlyStatement is the archived statement of one account for one
+// calendar month. Document is the canonical JSON rendering and Hash its
+// SHA-256, rows are never updated or deleted once written.
+type MonthlyStatement struct {
+	ID        uuid.UUID `gorm:"type:uuid;default:uuid_generate_v4();primaryKey"`
+	AccountID uuid.UUID `gorm:"type:uuid;not null;uniqueIndex:idx_monthly_statement_period"`
+	// Period is the month as YYYY-MM
+	Period      string    `gorm:"type:varchar(7);not null;uniqueIndex:idx_monthly_statement_period"`
+	PeriodStart time.Time `gorm:"not null"`
+	PeriodEnd   time.Time `gorm:"not null"`
+	Opening     int64     `gorm:"not null"`
+	Closing     int64     `gorm:"not null"`
+	Credits     int64     `gorm:"not null"`
+	Debits      int64     `gorm:"not null"`
+	Count       int64     `gorm:"not null"`
+	// Totals is the totals by type as a JSON array
+	Totals    string `gorm:"type:jsonb;not null"`
+	Document  []byte `gorm:"type:bytea;not null"`
+	Hash      string `gorm:"type:varchar(64);not null"`
+	CreatedAt time.Time
+
+	Account *Account `gorm:"constraint:OnUpdate:CASCADE,OnDelete:RESTRICT"`
+}
@@ -1,6 +1,10 @@
 package models
 
 import (
+	"crypto/sha256"
+	"encoding/hex"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/google/uuid"
@@ -11,15 +15,147 @@ type Transactions struct {
 	ID        uuid.UUID `gorm:"type:uuid;default:uuid_generate_v4();primaryKey"`
 	AccountID uuid.UUID `gorm:"type:uuid"`
 	Amount    int64     `gorm:"not null"`
-	// "WITHDRAW", "TRANSFER_IN", "TRANSFER_OUT"
+	// "WITHDRAW", "TRANSFER_IN", "TRANSFER_OUT", "ADJUSTMENT", "REVERSAL", "CAPTURE",
+	// "TRANSFER" (wallet to merchant, the sign tells the payer from the payee),
+	// "REFUND" (merchant or failed biller back to the payer), "FEE" (merchant to
+	// the fee account), "PAYOUT_FEE" (bulk payout transfer fee to the fee
+	// account), "INTEREST" (monthly interest payout), "TAX" (tax withheld from
+	// it) and "BILL_PAYMENT" (bill or prepaid purchase)
 	Type             string     `gorm:"type:varchar(12);not null"`
 	Description      *string    `gorm:"type:text"`
 	RelatedAccountID *uuid.UUID `gorm:"type:uuid"`
 	ExternalAccount  *string    `gorm:"type:varchar(30)"`
 	BankName         *string    `gorm:"type:varchar(8)"`
-	CreatedAt        time.Time
-	UpdatedAt        time.Time
-	DeletedAt        gorm.DeletedAt `gorm:"index"`
+	// ReversalOf links a REVERSAL row to the transaction it compensates
+	ReversalOf *uuid.UUID `gorm:"type:uuid;index"`
+	// ReversedAmount is the total reversed so far and ReversedByID the last
+	// reversal, ReversedAt is set once nothing is left to reverse. They stay
+	// outside of the hash.
+	ReversedAt     *time.Time
+	ReversedAmount int64      `gorm:"not null;default:0"`
+	ReversedByID   *uuid.UUID `gorm:"type:uuid"`
+	// Category is set by CategoryRules when the row is created, the account
+	// holder may override it. Both stay outside of the hash.
+	Category           string `gorm:"type:varchar(16);not null;default:OTHER;index"`
+	CategoryOverridden bool   `gorm:"not null;default:false"`
+	// BillerReference and Token are set on a BILL_PAYMENT once the biller
+	// confirms it. They stay outside of the hash.
+	BillerReference *string `gorm:"type:varchar(64)"`
+	Token           *string `gorm:"type:varchar(64)"`
+	// Sequence, PrevHash and Hash chain every row to the previous row of the
+	// same account. Rows written before the chain existed have no hash.
+	Sequence  int64   `gorm:"not null;default:0"`
+	PrevHash  *string `gorm:"type:varchar(64)"`
+	Hash      *string `gorm:"type:varchar(64)"`
+	CreatedAt time.Time
+	UpdatedAt time.Time
+	DeletedAt gorm.DeletedAt `gorm:"index"`
 
 	Account *Account `gorm:"constraint:OnUpdate:CASCADE,OnDelete:SET NULL"`
 }
+
+// BeforeCreate appends the row to its account's hash chain. The account row is
+// locked first so concurrent appends to the same chain are serialised.
+func (t *Transactions) BeforeCreate(tx *gorm.DB) error {
+	if t.ID == uuid.Nil {
+		t.ID = uuid.New()
+	}
+	if t.CreatedAt.IsZero() {
+		t.CreatedAt = time.Now()
+	}
+	if t.Category == "" {
+		t.Category = Categorize(t.Type, t.Amount, t.BankName, t.Description)
+	}
+	// postgres keeps microseconds, the hash has to match what is read back
+	t.CreatedAt = t.CreatedAt.UTC().Truncate(time.Microsecond)
+
+	db := tx.Session(&gorm.Session{NewDB: true})
+	if err := db.Exec(`SELECT 1 FROM accounts WHERE id = ? FOR UPDATE`, t.AccountID.String()).Error; err != nil {
+		return err
+	}
+
+	var prev struct {
+		Sequence int64
+		Hash     *string
+	}
+	err := db.Raw(`
+	SELECT sequence, hash FROM transactions
+	WHERE account_id = ? AND hash IS NOT NULL
+	ORDER BY sequence DESC LIMIT 1
+	`, t.AccountID.String()).Scan(&prev).Error
+	if err != nil {
+		return err
+	}
+
+	t.Sequence = prev.Sequence + 1
+	t.PrevHash = prev.Hash
+	hash := t.ComputeHash()
+	t.Hash = &hash
+	return nil
+}
+
+// AfterCreate writes transaction.created and balance.changed to the outbox in
+// the same database transaction as the row and checks debits against the
+// account's budgets. Every writer updates the account balance before it
+// creates the row, so the balance read here is final.
+func (t *Transactions) AfterCreate(tx *gorm.DB) error {
+	db := tx.Session(&gorm.Session{NewDB: true})
+	err := AppendOutbox(db, &t.AccountID, EventTransactionCreated, map[string]any{
+		"transactionId":    t.ID,
+		"accountId":        t.AccountID,
+		"amount":           t.Amount,
+		"type":             t.Type,
+		"description":      t.Description,
+		"relatedAccountId": t.RelatedAccountID,
+		"to":               t.ExternalAccount,
+		"bankName":         t.BankName,
+		"category":         t.Category,
+		"reversalOf":       t.ReversalOf,
+		"sequence":         t.Sequence,
+		"at":               t.CreatedAt.UTC(),
+	})
+	if err != nil {
+		return err
+	}
+	if err := EvaluateBudgets(db, t); err != nil {
+		return err
+	}
+	return PublishBalance(db, t.AccountID, &t.ID)
+}
+
+// ComputeHash returns the hex SHA-256 of the row content and the previous hash.
+// Fields that may legitimately change after insert are not part of it.
+func (t *Transactions) ComputeHash() string {
+	deref := func(s *string) string {
+		if s == nil {
+			return ""
+		}
+		return *s
+	}
+	related := ""
+	if t.RelatedAccountID != nil {
+		related = t.RelatedAccountID.String()
+	}
+
+	fields := []string{
+		t.ID.String(),
+		t.AccountID.String(),
+		strconv.FormatInt(t.Sequence, 10),
+		strconv.FormatInt(t.Amount, 10),
+		t.Type,
+		deref(t.Description),
+		related,
+		deref(t.ExternalAccount),
+		deref(t.BankName),
+		t.CreatedAt.UTC().Format(time.RFC3339Nano),
+		deref(t.PrevHash),
+	}
+	// appended only when set so rows chained before the column existed keep their hash
+	if t.ReversalOf != nil {
+		fields = append(fields, t.ReversalOf.String())
+	}
+	content := strings.Join(fields, "\x1f")
+
+	sum := sha256.Sum256([]byte(content))
+	return hex.EncodeToString(sum[:])
+}
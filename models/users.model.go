@@ -7,12 +7,32 @@ import (
 	"gorm.io/gorm"
 )
 
+const (
+	RoleCustomer = "customer"
+	RoleSupport  = "support"
+	RoleFinance  = "finance"
+	RoleAdmin    = "admin"
+)
+
 type User struct {
-	ID        uuid.UUID `gorm:"type:uuid;default:uuid_generate_v4();primaryKey"`
-	Name      string    `gorm:"size:100;not null"`
-	Email     string    `gorm:"size:100;not null"`
-	Password  string    `gorm:"not null"`
-	CreatedAt time.Time
-	UpdatedAt time.Time
-	DeletedAt gorm.DeletedAt `gorm:"index"`
+	ID       uuid.UUID `gorm:"type:uuid;default:uuid_generate_v4();primaryKey"`
+	Name     string    `gorm:"size:100;not null"`
+	Email    string    `gorm:"size:100;not null"`
+	Password string    `gorm:"not null"`
+	Role     string    `gorm:"type:varchar(10);not null;default:customer"`
+	// PinHash is the optional transaction PIN, payments ask for it once set
+	PinHash        *string
+	PinFailures    int `gorm:"not null;default:0"`
+	PinLockedUntil *time.Time
+	CreatedAt      time.Time
+	UpdatedAt      time.Time
+	DeletedAt      gorm.DeletedAt `gorm:"index"`
+}
+
+func IsValidRole(role string) bool {
+	switch role {
+	case RoleCustomer, RoleSupport, RoleFinance, RoleAdmin:
+		return true
+	}
+	return false
 }
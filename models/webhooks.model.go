@@ -0,0 +1,62 @@
+package models
+
+import (
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const (
+	DeliveryStatusPending   = "PENDING"
+	DeliveryStatusDelivered = "DELIVERED"
+	DeliveryStatusFailed    = "FAILED"
+)
+
+// WebhookEndpoint receives outbox events. EventTypes is a comma separated
+// list of event types, empty means every type. An endpoint with an AccountID
+// only receives that account's events, merchants get one of those.
+type WebhookEndpoint struct {
+	ID          uuid.UUID  `gorm:"type:uuid;default:uuid_generate_v4();primaryKey"`
+	URL         string     `gorm:"type:text;not null"`
+	Secret      string     `gorm:"type:varchar(100);not null"`
+	EventTypes  string     `gorm:"type:text;not null;default:''"`
+	AccountID   *uuid.UUID `gorm:"type:uuid;index"`
+	Description *string    `gorm:"type:text"`
+	Active      bool       `gorm:"not null;default:true"`
+	CreatedAt   time.Time
+	UpdatedAt   time.Time
+}
+
+func (e *WebhookEndpoint) Accepts(eventType string, accountID *uuid.UUID) bool {
+	if e.AccountID != nil && (accountID == nil || *accountID != *e.AccountID) {
+		return false
+	}
+	if e.EventTypes == "" {
+		return true
+	}
+	return slices.Contains(strings.Split(e.EventTypes, ","), eventType)
+}
+
+// WebhookDelivery is the delivery log, one row per event and endpoint. A
+// delivery of an account is only attempted once every earlier delivery of the
+// same account to the same endpoint is DELIVERED or FAILED.
+type WebhookDelivery struct {
+	ID             uuid.UUID  `gorm:"type:uuid;default:uuid_generate_v4();primaryKey"`
+	EventID        uuid.UUID  `gorm:"type:uuid;not null;uniqueIndex:idx_webhook_delivery_event"`
+	EndpointID     uuid.UUID  `gorm:"type:uuid;not null;uniqueIndex:idx_webhook_delivery_event;index:idx_webhook_delivery_queue"`
+	AccountID      *uuid.UUID `gorm:"type:uuid;index:idx_webhook_delivery_queue"`
+	Position       int64      `gorm:"not null;index:idx_webhook_delivery_queue"`
+	Status         string     `gorm:"type:varchar(10);not null;default:PENDING;index"`
+	Attempts       int        `gorm:"not null;default:0"`
+	NextAttemptAt  time.Time  `gorm:"not null"`
+	LastStatusCode *int
+	LastError      *string `gorm:"type:text"`
+	DeliveredAt    *time.Time
+	CreatedAt      time.Time
+	UpdatedAt      time.Time
+
+	Event    *OutboxEvent     `gorm:"constraint:OnUpdate:CASCADE,OnDelete:CASCADE"`
+	Endpoint *WebhookEndpoint `gorm:"constraint:OnUpdate:CASCADE,OnDelete:CASCADE"`
+}
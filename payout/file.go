@@ -0,0 +1,198 @@
+package payout
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/eclipseron/digital-wallet-app/banks"
+	"github.com/eclipseron/digital-wallet-app/models"
+)
+
+const (
+	// MaxFileSize and MaxRows bound one uploaded file.
+	MaxFileSize = 1 << 20
+	MaxRows     = 1000
+	// MaxBatchTotal bounds what one file can pay out, fees excluded.
+	MaxBatchTotal = 10000000000
+)
+
+var (
+	ErrFile    = errors.New("invalid payout file")
+	ErrColumns = errors.New("the header needs bank, account_number, account_name and amount, reference is optional")
+)
+
+// columns of a payout file, matched by header name in any order
+var columns = []string{"bank", "account_number", "account_name", "amount", "reference"}
+
+// Row is a validated row of a payout file.
+type Row struct {
+	Line          int
+	BankCode      string
+	AccountNumber string
+	AccountName   string
+	Amount        int64
+	Fee           int64
+	Reference     string
+}
+
+// RowError is why a row of a payout file was refused.
+type RowError struct {
+	Line    int    `json:"line"`
+	Message string `json:"message"`
+}
+
+func (e RowError) Error() string {
+	return fmt.Sprintf("line %d: %s", e.Line, e.Message)
+}
+
+// Parse reads and validates every row of a payout file against the bank
+// registry and limits. A file that can not be read at all returns an error,
+// otherwise every refused row is returned as a RowError and the batch is only
+// valid when there are none. Each row is charged its bank's fee when fees is
+// set.
+func Parse(r io.Reader, fees bool) ([]Row, []RowError, error) {
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = -1
+	reader.TrimLeadingSpace = true
+
+	header, err := reader.Read()
+	if err == io.EOF {
+		return nil, nil, fmt.Errorf("%w: the file is empty", ErrFile)
+	}
+	if err != nil {
+		return nil, nil, fmt.Errorf("%w: %v", ErrFile, err)
+	}
+	index := map[string]int{}
+	for i, name := range header {
+		index[strings.ToLower(strings.TrimSpace(strings.TrimPrefix(name, "\ufeff")))] = i
+	}
+	for _, name := range columns[:4] {
+		if _, ok := index[name]; !ok {
+			return nil, nil, fmt.Errorf("%w: %v", ErrFile, ErrColumns)
+		}
+	}
+
+	var rows []Row
+	var rowErrors []RowError
+	var total int64
+	references := map[string]int{}
+	for {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, nil, fmt.Errorf("%w: %v", ErrFile, err)
+		}
+		line, _ := reader.FieldPos(0)
+		if len(rows)+len(rowErrors) == MaxRows {
+			return nil, nil, fmt.Errorf("%w: a file has at most %d rows", ErrFile, MaxRows)
+		}
+		field := func(name string) string {
+			i, ok := index[name]
+			if !ok || i >= len(record) {
+				return ""
+			}
+			return strings.TrimSpace(record[i])
+		}
+
+		row, err := parseRow(line, field, fees)
+		if err == nil && row.Reference != "" {
+			if first, ok := references[row.Reference]; ok {
+				err = fmt.Errorf("reference %s is already used on line %d", row.Reference, first)
+			} else {
+				references[row.Reference] = line
+			}
+		}
+		if err != nil {
+			rowErrors = append(rowErrors, RowError{Line: line, Message: err.Error()})
+			continue
+		}
+		total += row.Amount
+		rows = append(rows, *row)
+	}
+
+	if len(rows)+len(rowErrors) == 0 {
+		return nil, nil, fmt.Errorf("%w: the file has no rows", ErrFile)
+	}
+	if total > MaxBatchTotal {
+		return nil, nil, fmt.Errorf("%w: a file pays out at most %d", ErrFile, int64(MaxBatchTotal))
+	}
+	return rows, rowErrors, nil
+}
+
+func parseRow(line int, field func(string) string, fees bool) (*Row, error) {
+	bank, err := banks.Find(field("bank"))
+	if err != nil {
+		return nil, fmt.Errorf("%w %q", err, field("bank"))
+	}
+	amount, err := strconv.ParseInt(field("amount"), 10, 64)
+	if err != nil {
+		return nil, fmt.Errorf("amount %q is not a whole number", field("amount"))
+	}
+	if err := bank.Check(field("account_number"), amount); err != nil {
+		return nil, err
+	}
+	name := field("account_name")
+	if name == "" || len(name) > 100 {
+		return nil, errors.New("account_name is required and at most 100 characters")
+	}
+	reference := field("reference")
+	if len(reference) > 64 {
+		return nil, errors.New("reference is at most 64 characters")
+	}
+
+	row := Row{
+		Line:          line,
+		BankCode:      bank.Code,
+		AccountNumber: field("account_number"),
+		AccountName:   name,
+		Amount:        amount,
+		Reference:     reference,
+	}
+	if fees {
+		row.Fee = bank.Fee
+	}
+	return &row, nil
+}
+
+// Totals sums the amounts and fees of rows.
+func Totals(rows []Row) (total, fees int64) {
+	for _, row := range rows {
+		total += row.Amount
+		fees += row.Fee
+	}
+	return total, fees
+}
+
+// WriteResult writes the outcome of every item of a batch as CSV.
+func WriteResult(w io.Writer, items []models.PayoutItem) error {
+	cw := csv.NewWriter(w)
+	cw.Write([]string{
+		"line", "bank", "account_number", "account_name", "amount", "fee", "reference",
+		"status", "transaction_id", "failure_reason",
+	})
+	for _, item := range items {
+		var reference, transaction, reason string
+		if item.Reference != nil {
+			reference = *item.Reference
+		}
+		if item.TransactionID != nil {
+			transaction = item.TransactionID.String()
+		}
+		if item.FailureReason != nil {
+			reason = *item.FailureReason
+		}
+		cw.Write([]string{
+			strconv.Itoa(item.Line), item.BankCode, item.AccountNumber, item.AccountName,
+			strconv.FormatInt(item.Amount, 10), strconv.FormatInt(item.Fee, 10), reference,
+			item.Status, transaction, reason,
+		})
+	}
+	cw.Flush()
+	return cw.Error()
+}
@@ -0,0 +1,318 @@
+// Package payout pays many bank destinations from one wallet out of an
+// uploaded CSV file. Every row is validated before the batch is stored as a
+// preview, executing it holds the total and fees on the source account at
+// once and a background job then pays the rows one by one out of that hold.
+// What failed rows reserved is released when the batch completes.
+package payout
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/eclipseron/digital-wallet-app/banks"
+	"github.com/eclipseron/digital-wallet-app/jobs"
+	"github.com/eclipseron/digital-wallet-app/ledger"
+	"github.com/eclipseron/digital-wallet-app/models"
+	"github.com/eclipseron/digital-wallet-app/settlement"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+const (
+	// PreviewTTL is how long a preview can be executed.
+	PreviewTTL = time.Hour
+	// HoldTTL is how long the hold of an executing batch lasts, far longer
+	// than paying a batch takes.
+	HoldTTL = 7 * 24 * time.Hour
+	// JobExecute pays the items of an executed batch.
+	JobExecute = "payout.execute"
+)
+
+var (
+	ErrBatchNotFound  = errors.New("payout batch not found")
+	ErrNotPreview     = errors.New("payout batch was already executed")
+	ErrPreviewExpired = errors.New("preview has expired, upload the file again")
+	ErrNotCompleted   = errors.New("payout batch has not completed yet")
+)
+
+type executePayload struct {
+	BatchID uuid.UUID `json:"batchId"`
+}
+
+// ChargesFees tells whether rows are charged their bank's fee, fees are only
+// charged while FEE_ACCOUNT_ID is set.
+func ChargesFees() bool {
+	_, ok := settlement.FeeAccount()
+	return ok
+}
+
+// Create stores validated rows as a PREVIEW batch of accountID. It must run
+// inside a transaction.
+func Create(tx *gorm.DB, accountID, userID uuid.UUID, fileName string, rows []Row) (*models.PayoutBatch, error) {
+	total, fees := Totals(rows)
+	batch := models.PayoutBatch{
+		AccountID: accountID,
+		UserID:    userID,
+		Status:    models.PayoutBatchStatusPreview,
+		Items:     len(rows),
+		Total:     total,
+		Fees:      fees,
+		ExpiresAt: time.Now().Add(PreviewTTL),
+	}
+	if fileName != "" {
+		batch.FileName = &fileName
+	}
+	if err := tx.Create(&batch).Error; err != nil {
+		return nil, err
+	}
+
+	items := make([]models.PayoutItem, 0, len(rows))
+	for _, row := range rows {
+		item := models.PayoutItem{
+			BatchID:       batch.ID,
+			Line:          row.Line,
+			BankCode:      row.BankCode,
+			AccountNumber: row.AccountNumber,
+			AccountName:   row.AccountName,
+			Amount:        row.Amount,
+			Fee:           row.Fee,
+			Status:        models.PayoutItemStatusPending,
+		}
+		if row.Reference != "" {
+			reference := row.Reference
+			item.Reference = &reference
+		}
+		items = append(items, item)
+	}
+	return &batch, tx.CreateInBatches(&items, 200).Error
+}
+
+func lockBatch(tx *gorm.DB, batchID uuid.UUID) (*models.PayoutBatch, error) {
+	var batch models.PayoutBatch
+	res := tx.Raw(`SELECT * FROM payout_batches WHERE id = ? FOR UPDATE`, batchID.String()).Scan(&batch)
+	if res.Error != nil {
+		return nil, res.Error
+	}
+	if res.RowsAffected == 0 {
+		return nil, ErrBatchNotFound
+	}
+	return &batch, nil
+}
+
+// Execute holds the total and fees of a preview of accountID and queues its
+// payment. It must run inside a transaction.
+func Execute(tx *gorm.DB, accountID, batchID uuid.UUID) (*models.PayoutBatch, error) {
+	batch, err := lockBatch(tx, batchID)
+	if err != nil {
+		return nil, err
+	}
+	if batch.AccountID != accountID {
+		return nil, ErrBatchNotFound
+	}
+	if batch.Status != models.PayoutBatchStatusPreview {
+		return batch, ErrNotPreview
+	}
+	if !time.Now().Before(batch.ExpiresAt) {
+		return batch, ErrPreviewExpired
+	}
+
+	reference := "payout:" + batch.ID.String()
+	desc := fmt.Sprintf("Bulk payout of %d transfers", batch.Items)
+	owner := models.HoldOwnerPayout
+	hold := models.Hold{
+		AccountID:   accountID,
+		Amount:      batch.Total + batch.Fees,
+		Reference:   &reference,
+		Description: &desc,
+		Owner:       &owner,
+		ExpiresAt:   time.Now().Add(HoldTTL),
+	}
+	if err := ledger.PlaceHold(tx, &hold); err != nil {
+		return batch, err
+	}
+
+	now := time.Now()
+	batch.Status = models.PayoutBatchStatusProcessing
+	batch.HoldID = &hold.ID
+	batch.ExecutedAt = &now
+	if err := tx.Model(batch).Select("status", "hold_id", "executed_at", "updated_at").Updates(batch).Error; err != nil {
+		return nil, err
+	}
+	_, err = jobs.Enqueue(tx, JobExecute, executePayload{BatchID: batch.ID}, jobs.EnqueueOptions{
+		UniqueKey: JobExecute + ":" + batch.ID.String(),
+	})
+	if err != nil && !errors.Is(err, jobs.ErrDuplicateJob) {
+		return nil, err
+	}
+	return batch, nil
+}
+
+// Register adds the execution job handler to the queue.
+func Register(q *jobs.Queue, db *gorm.DB) {
+	jobs.Handle(q, JobExecute, func(ctx context.Context, p executePayload) error {
+		return Process(ctx, db, p.BatchID)
+	})
+}
+
+// Process pays the pending items of a PROCESSING batch in file order, each
+// in its own transaction, then completes the batch. It stops when ctx is done
+// and picks up where it left off when run again.
+func Process(ctx context.Context, db *gorm.DB, batchID uuid.UUID) error {
+	var batch models.PayoutBatch
+	if err := db.WithContext(ctx).First(&batch, "id = ?", batchID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return jobs.Permanent(ErrBatchNotFound)
+		}
+		return err
+	}
+	if batch.Status != models.PayoutBatchStatusProcessing {
+		return nil
+	}
+	feeAccount, _ := settlement.FeeAccount()
+
+	for {
+		var ids []uuid.UUID
+		err := db.WithContext(ctx).Raw(`
+		SELECT id FROM payout_items WHERE batch_id = ? AND status = ? ORDER BY line LIMIT 100
+		`, batchID.String(), models.PayoutItemStatusPending).Scan(&ids).Error
+		if err != nil {
+			return err
+		}
+		if len(ids) == 0 {
+			break
+		}
+		for _, id := range ids {
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+			err := db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+				return payItem(tx, &batch, id, feeAccount)
+			})
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	return db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		return complete(tx, batchID)
+	})
+}
+
+// payItem pays one locked PENDING item out of the batch hold, with its fee
+// credited to feeAccount. An item whose bank left the registry or whose hold
+// is gone fails, everything else is an error and the item is tried again. A
+// restricted account pauses the batch until the job runs after it is lifted.
+func payItem(tx *gorm.DB, batch *models.PayoutBatch, itemID, feeAccount uuid.UUID) error {
+	var item models.PayoutItem
+	res := tx.Raw(`SELECT * FROM payout_items WHERE id = ? FOR UPDATE`, itemID.String()).Scan(&item)
+	if res.Error != nil {
+		return res.Error
+	}
+	if res.RowsAffected == 0 || item.Status != models.PayoutItemStatusPending {
+		return nil
+	}
+
+	if _, err := banks.Find(item.BankCode); err != nil {
+		return failItem(tx, &item, err)
+	}
+	desc := fmt.Sprintf("Bulk payout to %s", item.AccountName)
+	if item.Reference != nil {
+		desc = fmt.Sprintf("Bulk payout %s to %s", *item.Reference, item.AccountName)
+	}
+	entry := models.Transactions{
+		Type:            "TRANSFER_OUT",
+		Description:     &desc,
+		ExternalAccount: &item.AccountNumber,
+		BankName:        &item.BankCode,
+	}
+	_, _, err := ledger.DebitHold(tx, *batch.HoldID, item.Amount, &entry)
+	if errors.Is(err, ledger.ErrHoldNotActive) || errors.Is(err, ledger.ErrHoldExpired) {
+		return failItem(tx, &item, err)
+	}
+	if models.IsRestricted(err) {
+		return fmt.Errorf("payout batch %s paused: %w", batch.ID, err)
+	}
+	if err != nil {
+		return err
+	}
+	item.TransactionID = &entry.ID
+
+	// a fee left unpaid because FEE_ACCOUNT_ID changed since the preview is
+	// released with the rest of the hold
+	if item.Fee > 0 && feeAccount != uuid.Nil && feeAccount != batch.AccountID {
+		feeDesc := fmt.Sprintf("Bulk payout fee line %d", item.Line)
+		debit := models.Transactions{Type: "PAYOUT_FEE", Description: &feeDesc, RelatedAccountID: &feeAccount}
+		if _, _, err := ledger.DebitHold(tx, *batch.HoldID, item.Fee, &debit); err != nil {
+			return err
+		}
+		credit := models.Transactions{AccountID: feeAccount, Type: "PAYOUT_FEE", Description: &feeDesc, RelatedAccountID: &batch.AccountID}
+		if _, err := ledger.Credit(tx, &credit, item.Fee); err != nil {
+			return err
+		}
+		item.FeeTransactionID = &debit.ID
+	}
+
+	now := time.Now()
+	item.Status = models.PayoutItemStatusSuccess
+	item.ProcessedAt = &now
+	err = tx.Model(&item).Select("status", "transaction_id", "fee_transaction_id", "processed_at", "updated_at").Updates(&item).Error
+	if err != nil {
+		return err
+	}
+	return tx.Exec(`
+	UPDATE payout_batches SET succeeded = succeeded + 1, paid_amount = paid_amount + ?, updated_at = now() WHERE id = ?
+	`, item.Amount, batch.ID.String()).Error
+}
+
+func failItem(tx *gorm.DB, item *models.PayoutItem, cause error) error {
+	now := time.Now()
+	reason := cause.Error()
+	item.Status = models.PayoutItemStatusFailed
+	item.FailureReason = &reason
+	item.ProcessedAt = &now
+	if err := tx.Model(item).Select("status", "failure_reason", "processed_at", "updated_at").Updates(item).Error; err != nil {
+		return err
+	}
+	return tx.Exec(`
+	UPDATE payout_batches SET failed = failed + 1, updated_at = now() WHERE id = ?
+	`, item.BatchID.String()).Error
+}
+
+// complete releases what is left of the hold of a batch with no pending
+// items, marks it COMPLETED and notifies its owner.
+func complete(tx *gorm.DB, batchID uuid.UUID) error {
+	batch, err := lockBatch(tx, batchID)
+	if err != nil {
+		return err
+	}
+	if batch.Status != models.PayoutBatchStatusProcessing {
+		return nil
+	}
+	var pending int64
+	err = tx.Model(&models.PayoutItem{}).
+		Where("batch_id = ? AND status = ?", batchID.String(), models.PayoutItemStatusPending).
+		Count(&pending).Error
+	if err != nil || pending > 0 {
+		return err
+	}
+
+	if batch.HoldID != nil {
+		_, err := ledger.ReleaseHold(tx, *batch.HoldID, models.HoldStatusVoided)
+		if err != nil && !errors.Is(err, ledger.ErrHoldNotActive) {
+			return err
+		}
+	}
+	now := time.Now()
+	batch.Status = models.PayoutBatchStatusCompleted
+	batch.CompletedAt = &now
+	if err := tx.Model(batch).Select("status", "completed_at", "updated_at").Updates(batch).Error; err != nil {
+		return err
+	}
+
+	body := fmt.Sprintf("%d of %d transfers were paid, %d failed.", batch.Succeeded, batch.Items, batch.Failed)
+	return models.Notify(tx, batch.UserID, models.NotificationPayoutCompleted, "Bulk payout completed", body,
+		map[string]any{"batchId": batch.ID, "succeeded": batch.Succeeded, "failed": batch.Failed, "paidAmount": batch.PaidAmount})
+}
@@ -0,0 +1,303 @@
+// Package qris encodes and parses merchant-presented QR payloads in the
+// EMVCo TLV format used by QRIS. Every data object is a two digit id, a two
+// digit length and the value, and the payload ends with a CRC16 over
+// everything before the checksum value.
+package qris
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// GUI identifies this wallet inside the merchant account template (id 26),
+// payloads without it belong to another issuer.
+const GUI = "COM.ECLIPSERON.WALLET"
+
+const (
+	CurrencyIDR = "360"
+	CountryID   = "ID"
+	DefaultCity = "JAKARTA"
+
+	// MCCTransfer is used for personal accounts, MCCMerchant for merchants
+	// that did not pick a category
+	MCCTransfer = "4829"
+	MCCMerchant = "5999"
+
+	pointStatic  = "11"
+	pointDynamic = "12"
+)
+
+var (
+	ErrMalformed   = errors.New("malformed qr payload")
+	ErrChecksum    = errors.New("qr payload checksum does not match")
+	ErrUnsupported = errors.New("qr payload is not issued by this wallet")
+)
+
+// Payload is the part of a QR payload this wallet reads and writes. A static
+// payload has no amount and the payer enters it, a dynamic one is for a
+// single payment of Amount and names the intent or code that records it.
+type Payload struct {
+	Dynamic       bool
+	AccountNumber string
+	// IntentID is set on the dynamic payload of a merchant payment intent,
+	// CodeID on the dynamic payload of an account
+	IntentID     string
+	CodeID       string
+	Category     string
+	Currency     string
+	Amount       int64
+	CountryCode  string
+	MerchantName string
+	MerchantCity string
+	BillNumber   string
+	// Reference is the reference label, for example a payment intent id
+	Reference string
+	Purpose   string
+}
+
+// CRC16 is CRC-16/CCITT-FALSE, the checksum EMVCo payloads use.
+func CRC16(data []byte) uint16 {
+	crc := uint16(0xFFFF)
+	for _, b := range data {
+		crc ^= uint16(b) << 8
+		for i := 0; i < 8; i++ {
+			if crc&0x8000 != 0 {
+				crc = crc<<1 ^ 0x1021
+			} else {
+				crc <<= 1
+			}
+		}
+	}
+	return crc
+}
+
+// Encode returns the payload string including its checksum.
+func (p *Payload) Encode() (string, error) {
+	if p.AccountNumber == "" {
+		return "", fmt.Errorf("%w: account number is required", ErrMalformed)
+	}
+	if p.Dynamic && p.Amount <= 0 {
+		return "", fmt.Errorf("%w: a dynamic payload needs a positive amount", ErrMalformed)
+	}
+
+	var b strings.Builder
+	write := func(id, value string) error {
+		if len(value) > 99 {
+			return fmt.Errorf("%w: field %s is longer than 99 characters", ErrMalformed, id)
+		}
+		fmt.Fprintf(&b, "%s%02d%s", id, len(value), value)
+		return nil
+	}
+	template := func(fields [][2]string) (string, error) {
+		var t strings.Builder
+		for _, f := range fields {
+			if f[1] == "" {
+				continue
+			}
+			if len(f[1]) > 99 {
+				return "", fmt.Errorf("%w: field %s is longer than 99 characters", ErrMalformed, f[0])
+			}
+			fmt.Fprintf(&t, "%s%02d%s", f[0], len(f[1]), f[1])
+		}
+		return t.String(), nil
+	}
+
+	point := pointStatic
+	if p.Dynamic {
+		point = pointDynamic
+	}
+	account, err := template([][2]string{{"00", GUI}, {"01", p.AccountNumber}, {"02", p.IntentID}, {"03", p.CodeID}})
+	if err != nil {
+		return "", err
+	}
+	additional, err := template([][2]string{{"01", p.BillNumber}, {"05", p.Reference}, {"08", p.Purpose}})
+	if err != nil {
+		return "", err
+	}
+
+	fields := [][2]string{
+		{"00", "01"},
+		{"01", point},
+		{"26", account},
+		{"52", or(p.Category, MCCTransfer)},
+		{"53", or(p.Currency, CurrencyIDR)},
+		{"54", ""},
+		{"58", or(p.CountryCode, CountryID)},
+		{"59", or(clean(p.MerchantName, 25), "WALLET USER")},
+		{"60", or(clean(p.MerchantCity, 15), DefaultCity)},
+		{"62", additional},
+	}
+	if p.Dynamic {
+		fields[5][1] = strconv.FormatInt(p.Amount, 10)
+	}
+	for _, f := range fields {
+		if f[1] == "" {
+			continue
+		}
+		if err := write(f[0], f[1]); err != nil {
+			return "", err
+		}
+	}
+
+	b.WriteString("6304")
+	return fmt.Sprintf("%s%04X", b.String(), CRC16([]byte(b.String()))), nil
+}
+
+// Parse checks the checksum and the mandatory fields of s and returns what
+// it says. Payloads of other issuers fail with ErrUnsupported.
+func Parse(s string) (*Payload, error) {
+	s = strings.TrimSpace(s)
+	if len(s) < 8 || len(s) > 512 {
+		return nil, fmt.Errorf("%w: unexpected length", ErrMalformed)
+	}
+	body, checksum := s[:len(s)-4], s[len(s)-4:]
+	if !strings.HasSuffix(body, "6304") {
+		return nil, fmt.Errorf("%w: the checksum must be the last field", ErrMalformed)
+	}
+	want, err := strconv.ParseUint(checksum, 16, 16)
+	if err != nil {
+		return nil, fmt.Errorf("%w: checksum is not hexadecimal", ErrMalformed)
+	}
+	if uint16(want) != CRC16([]byte(body)) {
+		return nil, ErrChecksum
+	}
+
+	fields, err := parseTLV(s[:len(s)-8])
+	if err != nil {
+		return nil, err
+	}
+	if fields["00"] != "01" {
+		return nil, fmt.Errorf("%w: unsupported payload format indicator", ErrMalformed)
+	}
+	for _, id := range []string{"52", "53", "58", "59", "60"} {
+		if fields[id] == "" {
+			return nil, fmt.Errorf("%w: field %s is required", ErrMalformed, id)
+		}
+	}
+
+	p := &Payload{
+		Category:     fields["52"],
+		Currency:     fields["53"],
+		CountryCode:  fields["58"],
+		MerchantName: fields["59"],
+		MerchantCity: fields["60"],
+	}
+	switch fields["01"] {
+	case "", pointStatic:
+	case pointDynamic:
+		p.Dynamic = true
+	default:
+		return nil, fmt.Errorf("%w: unknown point of initiation method", ErrMalformed)
+	}
+	if p.Currency != CurrencyIDR {
+		return nil, fmt.Errorf("%w: only IDR (360) is supported", ErrUnsupported)
+	}
+
+	if amount, ok := fields["54"]; ok {
+		// rupiah has no minor unit in the ledger, only .0 or .00 is accepted
+		whole, fraction, _ := strings.Cut(amount, ".")
+		if strings.Trim(fraction, "0") != "" {
+			return nil, fmt.Errorf("%w: amount must be whole rupiah", ErrMalformed)
+		}
+		p.Amount, err = strconv.ParseInt(whole, 10, 64)
+		if err != nil || p.Amount <= 0 {
+			return nil, fmt.Errorf("%w: invalid amount", ErrMalformed)
+		}
+	}
+	if p.Dynamic && p.Amount == 0 {
+		return nil, fmt.Errorf("%w: a dynamic payload needs an amount", ErrMalformed)
+	}
+
+	// merchant account information may sit in any of the templates 26 to 51,
+	// only ours is read
+	found := false
+	for id := 26; id <= 51 && !found; id++ {
+		value, ok := fields[strconv.Itoa(id)]
+		if !ok {
+			continue
+		}
+		sub, err := parseTLV(value)
+		if err != nil {
+			return nil, err
+		}
+		if sub["00"] != GUI {
+			continue
+		}
+		found = true
+		p.AccountNumber = sub["01"]
+		p.IntentID = sub["02"]
+		p.CodeID = sub["03"]
+	}
+	if !found {
+		return nil, ErrUnsupported
+	}
+	if p.AccountNumber == "" {
+		return nil, fmt.Errorf("%w: account number is missing", ErrMalformed)
+	}
+
+	if value, ok := fields["62"]; ok {
+		sub, err := parseTLV(value)
+		if err != nil {
+			return nil, err
+		}
+		p.BillNumber = sub["01"]
+		p.Reference = sub["05"]
+		p.Purpose = sub["08"]
+	}
+	return p, nil
+}
+
+// parseTLV splits s into its data objects. Ids must be unique.
+func parseTLV(s string) (map[string]string, error) {
+	fields := map[string]string{}
+	for i := 0; i < len(s); {
+		if i+4 > len(s) {
+			return nil, fmt.Errorf("%w: truncated field at %d", ErrMalformed, i)
+		}
+		id := s[i : i+2]
+		n, err := strconv.Atoi(s[i+2 : i+4])
+		if err != nil || !isDigits(s[i:i+4]) || i+4+n > len(s) {
+			return nil, fmt.Errorf("%w: invalid field at %d", ErrMalformed, i)
+		}
+		if _, ok := fields[id]; ok {
+			return nil, fmt.Errorf("%w: field %s appears twice", ErrMalformed, id)
+		}
+		fields[id] = s[i+4 : i+4+n]
+		i += 4 + n
+	}
+	return fields, nil
+}
+
+func isDigits(s string) bool {
+	for _, r := range s {
+		if r < '0' || r > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+func or(s, fallback string) string {
+	if s == "" {
+		return fallback
+	}
+	return s
+}
+
+// clean keeps printable ASCII and cuts s to max characters, names are
+// shown by any scanner app.
+func clean(s string, max int) string {
+	var b strings.Builder
+	for _, r := range s {
+		if r >= 0x20 && r < 0x7F {
+			b.WriteRune(r)
+		}
+	}
+	out := strings.TrimSpace(b.String())
+	if len(out) > max {
+		out = strings.TrimSpace(out[:max])
+	}
+	return out
+}
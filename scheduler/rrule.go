@@ -0,0 +1,170 @@
+package scheduler
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Rule is the subset of RFC 5545 RRULE used for recurring transfers:
+// FREQ, INTERVAL, COUNT, UNTIL, BYMONTHDAY and BYDAY (weekly only).
+type Rule struct {
+	Freq       string
+	Interval   int
+	Count      int
+	Until      *time.Time
+	ByMonthDay int
+	ByDay      []time.Weekday
+}
+
+var weekdays = map[string]time.Weekday{
+	"SU": time.Sunday, "MO": time.Monday, "TU": time.Tuesday, "WE": time.Wednesday,
+	"TH": time.Thursday, "FR": time.Friday, "SA": time.Saturday,
+}
+
+// ParseRule parses rules like "FREQ=MONTHLY;BYMONTHDAY=1;COUNT=12". A leading
+// "RRULE:" is accepted.
+func ParseRule(s string) (*Rule, error) {
+	s = strings.TrimPrefix(strings.TrimSpace(s), "RRULE:")
+	if s == "" {
+		return nil, errors.New("empty rule")
+	}
+
+	rule := &Rule{Interval: 1}
+	for _, part := range strings.Split(s, ";") {
+		key, value, ok := strings.Cut(part, "=")
+		if !ok {
+			return nil, fmt.Errorf("invalid rule part %q", part)
+		}
+		switch strings.ToUpper(key) {
+		case "FREQ":
+			rule.Freq = strings.ToUpper(value)
+			if !slices.Contains([]string{"DAILY", "WEEKLY", "MONTHLY", "YEARLY"}, rule.Freq) {
+				return nil, fmt.Errorf("unsupported FREQ %q", value)
+			}
+		case "INTERVAL":
+			n, err := strconv.Atoi(value)
+			if err != nil || n < 1 {
+				return nil, fmt.Errorf("invalid INTERVAL %q", value)
+			}
+			rule.Interval = n
+		case "COUNT":
+			n, err := strconv.Atoi(value)
+			if err != nil || n < 1 {
+				return nil, fmt.Errorf("invalid COUNT %q", value)
+			}
+			rule.Count = n
+		case "UNTIL":
+			until, err := parseUntil(value)
+			if err != nil {
+				return nil, fmt.Errorf("invalid UNTIL %q", value)
+			}
+			rule.Until = &until
+		case "BYMONTHDAY":
+			n, err := strconv.Atoi(value)
+			if err != nil || n == 0 || n < -1 || n > 31 {
+				return nil, fmt.Errorf("invalid BYMONTHDAY %q, use 1 to 31 or -1", value)
+			}
+			rule.ByMonthDay = n
+		case "BYDAY":
+			for _, day := range strings.Split(value, ",") {
+				wd, ok := weekdays[strings.ToUpper(day)]
+				if !ok {
+					return nil, fmt.Errorf("invalid BYDAY %q", day)
+				}
+				rule.ByDay = append(rule.ByDay, wd)
+			}
+			slices.Sort(rule.ByDay)
+		default:
+			return nil, fmt.Errorf("unsupported rule part %q", key)
+		}
+	}
+
+	if rule.Freq == "" {
+		return nil, errors.New("FREQ is required")
+	}
+	if len(rule.ByDay) > 0 && rule.Freq != "WEEKLY" {
+		return nil, errors.New("BYDAY is only supported with FREQ=WEEKLY")
+	}
+	if rule.ByMonthDay != 0 && rule.Freq != "MONTHLY" {
+		return nil, errors.New("BYMONTHDAY is only supported with FREQ=MONTHLY")
+	}
+	return rule, nil
+}
+
+func parseUntil(value string) (time.Time, error) {
+	for _, layout := range []string{"20060102T150405Z", "20060102", time.RFC3339} {
+		if t, err := time.Parse(layout, value); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, errors.New("unknown UNTIL format")
+}
+
+// Next returns the first occurrence of the series starting at dtstart that is
+// strictly after the given time. ok is false once the series is past UNTIL.
+// COUNT is not applied here, callers track how many occurrences ran.
+func (r *Rule) Next(dtstart, after time.Time) (next time.Time, ok bool) {
+	// enough periods to cover decades of daily transfers
+	for k := 0; k < 50000; k++ {
+		for _, candidate := range r.period(dtstart, k*r.Interval) {
+			if candidate.Before(dtstart) || !candidate.After(after) {
+				continue
+			}
+			if r.Until != nil && candidate.After(*r.Until) {
+				return time.Time{}, false
+			}
+			return candidate, true
+		}
+	}
+	return time.Time{}, false
+}
+
+// period returns the sorted occurrences in the n-th period after dtstart.
+func (r *Rule) period(dtstart time.Time, n int) []time.Time {
+	y, m, d := dtstart.Date()
+	hh, mm, ss := dtstart.Clock()
+	loc := dtstart.Location()
+
+	switch r.Freq {
+	case "DAILY":
+		return []time.Time{dtstart.AddDate(0, 0, n)}
+	case "WEEKLY":
+		if len(r.ByDay) == 0 {
+			return []time.Time{dtstart.AddDate(0, 0, 7*n)}
+		}
+		// weeks start on Monday
+		offset := (int(dtstart.Weekday()) + 6) % 7
+		monday := time.Date(y, m, d-offset+7*n, hh, mm, ss, 0, loc)
+		days := make([]time.Time, 0, len(r.ByDay))
+		for _, wd := range r.ByDay {
+			days = append(days, monday.AddDate(0, 0, (int(wd)+6)%7))
+		}
+		slices.SortFunc(days, func(a, b time.Time) int { return a.Compare(b) })
+		return days
+	case "MONTHLY":
+		first := time.Date(y, m+time.Month(n), 1, hh, mm, ss, 0, loc)
+		day := d
+		if r.ByMonthDay != 0 {
+			day = r.ByMonthDay
+		}
+		return []time.Time{clampDay(first, day)}
+	case "YEARLY":
+		first := time.Date(y+n, m, 1, hh, mm, ss, 0, loc)
+		return []time.Time{clampDay(first, d)}
+	}
+	return nil
+}
+
+// clampDay moves first (the 1st of a month) to day, where -1 or a day past
+// the end of the month means the last day of that month.
+func clampDay(first time.Time, day int) time.Time {
+	last := first.AddDate(0, 1, -1).Day()
+	if day == -1 || day > last {
+		day = last
+	}
+	return first.AddDate(0, 0, day-1)
+}
@@ -0,0 +1,279 @@
+package scheduler
+
+import (
+	"context"
+	"errors"
+	"log"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/eclipseron/digital-wallet-app/ledger"
+	"github.com/eclipseron/digital-wallet-app/models"
+	"gorm.io/gorm"
+)
+
+var ErrNoOccurrence = errors.New("schedule has no occurrence in its date range")
+
+// RetryPolicy controls how often a run that failed on insufficient balance is
+// retried before the occurrence is given up.
+type RetryPolicy struct {
+	MaxRetries int
+	Interval   time.Duration
+}
+
+// DefaultRetryPolicy reads SCHEDULE_RETRY_MAX and SCHEDULE_RETRY_INTERVAL,
+// falling back to 3 retries one hour apart.
+func DefaultRetryPolicy() RetryPolicy {
+	policy := RetryPolicy{MaxRetries: 3, Interval: time.Hour}
+	if n, err := strconv.Atoi(os.Getenv("SCHEDULE_RETRY_MAX")); err == nil && n >= 0 {
+		policy.MaxRetries = n
+	}
+	if d, err := time.ParseDuration(os.Getenv("SCHEDULE_RETRY_INTERVAL")); err == nil && d > 0 {
+		policy.Interval = d
+	}
+	return policy
+}
+
+// Init validates the recurrence of a new schedule and sets its first
+// occurrence.
+func Init(s *models.ScheduledTransfer) error {
+	first, ok, err := nextOccurrence(s, s.StartAt.Add(-time.Nanosecond))
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return ErrNoOccurrence
+	}
+	s.Status = models.ScheduleStatusActive
+	s.NextOccurrenceAt = &first
+	s.NextRunAt = &first
+	return nil
+}
+
+// nextOccurrence returns the first occurrence of s strictly after the given
+// time, honouring EndAt, MaxOccurrences and the rule's own COUNT and UNTIL.
+func nextOccurrence(s *models.ScheduledTransfer, after time.Time) (time.Time, bool, error) {
+	limit := 0
+	if s.MaxOccurrences != nil {
+		limit = *s.MaxOccurrences
+	}
+
+	var next time.Time
+	if s.Recurrence == nil {
+		// a one-off transfer runs once at StartAt
+		if s.Occurrences > 0 || !s.StartAt.After(after) {
+			return time.Time{}, false, nil
+		}
+		next = s.StartAt
+	} else {
+		rule, err := ParseRule(*s.Recurrence)
+		if err != nil {
+			return time.Time{}, false, err
+		}
+		if rule.Count > 0 && (limit == 0 || rule.Count < limit) {
+			limit = rule.Count
+		}
+		var ok bool
+		next, ok = rule.Next(s.StartAt, after)
+		if !ok {
+			return time.Time{}, false, nil
+		}
+	}
+
+	if limit > 0 && s.Occurrences >= limit {
+		return time.Time{}, false, nil
+	}
+	if s.EndAt != nil && next.After(*s.EndAt) {
+		return time.Time{}, false, nil
+	}
+	return next, true, nil
+}
+
+// advance moves s past its current occurrence, counting it as used up
+// whether it was paid or failed, and completes s when the series has ended.
+func advance(s *models.ScheduledTransfer) error {
+	s.Occurrences++
+	s.RetryAttempt = 0
+	next, ok, err := nextOccurrence(s, *s.NextOccurrenceAt)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		s.Status = models.ScheduleStatusCompleted
+		s.NextOccurrenceAt = nil
+		s.NextRunAt = nil
+		return nil
+	}
+	s.NextOccurrenceAt = &next
+	s.NextRunAt = &next
+	return nil
+}
+
+// RunDue executes every schedule whose next run is due and returns how many
+// were processed. Each schedule is handled in its own transaction and locked
+// with SKIP LOCKED, so several server instances can run the scheduler at once.
+func RunDue(db *gorm.DB) (int, error) {
+	processed := 0
+	for processed < 500 {
+		found := false
+		err := db.Transaction(func(tx *gorm.DB) error {
+			var s models.ScheduledTransfer
+			res := tx.Raw(`
+			SELECT * FROM scheduled_transfers
+			WHERE status = ? AND next_run_at <= now()
+			ORDER BY next_run_at LIMIT 1 FOR UPDATE SKIP LOCKED
+			`, models.ScheduleStatusActive).Scan(&s)
+			if res.Error != nil || res.RowsAffected == 0 {
+				return res.Error
+			}
+			found = true
+			return execute(tx, &s)
+		})
+		if err != nil {
+			return processed, err
+		}
+		if !found {
+			break
+		}
+		processed++
+	}
+	return processed, nil
+}
+
+// execute runs the current occurrence of s through ledger.BankTransfer, the
+// same path BankWithdrawHandler uses, records the run and moves the schedule
+// forward.
+func execute(tx *gorm.DB, s *models.ScheduledTransfer) error {
+	now := time.Now()
+	run := models.ScheduledTransferRun{
+		ScheduledTransferID: s.ID,
+		ScheduledFor:        *s.NextOccurrenceAt,
+		Attempt:             s.RetryAttempt + 1,
+	}
+
+	// a failed transfer only rolls back to here, the run is still recorded
+	if err := tx.SavePoint("transfer").Error; err != nil {
+		return err
+	}
+	entry, balance, err := ledger.BankTransfer(tx, s.AccountID, s.Amount, s.Destination, s.BankName)
+	if err != nil {
+		if err := tx.RollbackTo("transfer").Error; err != nil {
+			return err
+		}
+		detail := err.Error()
+		run.Error = &detail
+		failed := models.PublishTransferFailed(tx, s.AccountID, "TRANSFER_OUT", s.Amount, detail, &s.Destination, &s.BankName)
+		if failed != nil {
+			return failed
+		}
+	}
+
+	switch {
+	case err == nil:
+		run.Status = models.ScheduleRunSuccess
+		run.TransactionID = &entry.ID
+		if err := advance(s); err != nil {
+			return err
+		}
+
+		target := entry.ID.String()
+		event := models.AuditEvent{
+			ActorID:    &s.UserID,
+			Action:     "transaction.scheduled_transfer",
+			Outcome:    models.AuditOutcomeSuccess,
+			TargetType: "transaction",
+			TargetID:   &target,
+		}
+		event.SetChanges(
+			map[string]any{"balance": balance + s.Amount},
+			map[string]any{"balance": balance, "scheduleId": s.ID},
+		)
+		if err := tx.Create(&event).Error; err != nil {
+			return err
+		}
+	case errors.Is(err, ledger.ErrInsufficientBalance):
+		if s.RetryAttempt < s.MaxRetries {
+			run.Status = models.ScheduleRunRetrying
+			s.RetryAttempt++
+			retryAt := now.Add(time.Duration(s.RetryInterval) * time.Second)
+			s.NextRunAt = &retryAt
+			break
+		}
+		// out of retries, skip this occurrence and wait for the next one
+		run.Status = models.ScheduleRunFailed
+		if err := advance(s); err != nil {
+			return err
+		}
+	case errors.Is(err, models.ErrAccountClosed), errors.Is(err, models.ErrAccountNotFound):
+		run.Status = models.ScheduleRunFailed
+		s.Status = models.ScheduleStatusCancelled
+		s.NextRunAt = nil
+	case models.IsRestricted(err):
+		// the user resumes the schedule once the account is usable again
+		run.Status = models.ScheduleRunFailed
+		s.Status = models.ScheduleStatusPaused
+		s.NextRunAt = nil
+	default:
+		return err
+	}
+
+	s.LastRunAt = &now
+	if err := tx.Create(&run).Error; err != nil {
+		return err
+	}
+	return tx.Model(s).Select(
+		"status", "occurrences", "next_occurrence_at", "next_run_at", "retry_attempt", "last_run_at", "updated_at",
+	).Updates(s).Error
+}
+
+// Run executes due schedules every interval until ctx is done.
+func Run(ctx context.Context, db *gorm.DB, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			n, err := RunDue(db)
+			if err != nil {
+				log.Println("failed to run scheduled transfers:", err)
+				continue
+			}
+			if n > 0 {
+				log.Printf("ran %d scheduled transfers", n)
+			}
+		}
+	}
+}
+
+// Resume reactivates a paused schedule. Occurrences missed while paused are
+// skipped, the next run is the first occurrence after now.
+func Resume(s *models.ScheduledTransfer, now time.Time) error {
+	s.RetryAttempt = 0
+	s.Status = models.ScheduleStatusActive
+	if s.NextOccurrenceAt != nil && !s.NextOccurrenceAt.Before(now) {
+		s.NextRunAt = s.NextOccurrenceAt
+		return nil
+	}
+	if s.Recurrence == nil && s.Occurrences == 0 {
+		// a one-off transfer that was due while paused runs right away
+		s.NextOccurrenceAt = &now
+		s.NextRunAt = &now
+		return nil
+	}
+	next, ok, err := nextOccurrence(s, now)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		s.Status = models.ScheduleStatusCompleted
+		s.NextOccurrenceAt = nil
+		s.NextRunAt = nil
+		return nil
+	}
+	s.NextOccurrenceAt = &next
+	s.NextRunAt = &next
+	return nil
+}
@@ -0,0 +1,189 @@
+// Package settlement computes merchant fees and the daily settlement report
+// of a merchant account. Days are business days in Asia/Jakarta that start
+// at the cutoff time, so a transaction always lands on the same day no
+// matter when the report is pulled.
+package settlement
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"time"
+	_ "time/tzdata"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// MaxDays bounds the range of one report.
+const MaxDays = 92
+
+var ErrRange = fmt.Errorf("a report covers between 1 and %d days", MaxDays)
+
+// Location is the zone settlement days are counted in.
+var Location = mustLoad("Asia/Jakarta")
+
+func mustLoad(name string) *time.Location {
+	loc, err := time.LoadLocation(name)
+	if err != nil {
+		panic(err)
+	}
+	return loc
+}
+
+// Cutoff reads SETTLEMENT_CUTOFF as HH:MM local time, midnight by default.
+func Cutoff() time.Duration {
+	t, err := time.Parse("15:04", os.Getenv("SETTLEMENT_CUTOFF"))
+	if err != nil {
+		return 0
+	}
+	return time.Duration(t.Hour())*time.Hour + time.Duration(t.Minute())*time.Minute
+}
+
+// FeeBps reads MERCHANT_FEE_BPS, the fee charged on every merchant payment
+// in basis points. It is 0 by default.
+func FeeBps() int64 {
+	bps, err := strconv.ParseInt(os.Getenv("MERCHANT_FEE_BPS"), 10, 64)
+	if err != nil || bps < 0 || bps > 10000 {
+		return 0
+	}
+	return bps
+}
+
+// Fee is the fee on a payment of amount, rounded half up.
+func Fee(amount, bps int64) int64 {
+	return (amount*bps + 5000) / 10000
+}
+
+// FeeAccount reads FEE_ACCOUNT_ID, the wallet collecting merchant fees. Fees
+// are only charged when it is set.
+func FeeAccount() (uuid.UUID, bool) {
+	id, err := uuid.Parse(os.Getenv("FEE_ACCOUNT_ID"))
+	return id, err == nil
+}
+
+// Day returns the business day t belongs to, as midnight in Location.
+func Day(t time.Time, cutoff time.Duration) time.Time {
+	local := t.In(Location).Add(-cutoff)
+	return time.Date(local.Year(), local.Month(), local.Day(), 0, 0, 0, 0, Location)
+}
+
+// Window returns the instants business days from to to (both included)
+// start and end at.
+func Window(from, to time.Time, cutoff time.Duration) (start, end time.Time) {
+	start = time.Date(from.Year(), from.Month(), from.Day(), 0, 0, 0, 0, Location).Add(cutoff)
+	end = time.Date(to.Year(), to.Month(), to.Day()+1, 0, 0, 0, 0, Location).Add(cutoff)
+	return start, end
+}
+
+// Row is one business day of a settlement report. Net is what the merchant
+// keeps: gross payments minus fees minus refunds. Final is false while the
+// day is still open.
+type Row struct {
+	Date        string `json:"date"`
+	Payments    int64  `json:"payments"`
+	Gross       int64  `json:"gross"`
+	Fees        int64  `json:"fees"`
+	Refunds     int64  `json:"refunds"`
+	RefundCount int64  `json:"refundCount"`
+	Net         int64  `json:"net"`
+	Final       bool   `json:"final"`
+}
+
+// Report builds one row per business day from from to to for accountID,
+// days without activity included. It reads the account's TRANSFER credits
+// (payments), FEE debits and REFUND debits.
+func Report(db *gorm.DB, accountID uuid.UUID, from, to time.Time) ([]Row, error) {
+	from, to = Day(from, 0), Day(to, 0)
+	days := int(to.Sub(from).Hours()/24+0.5) + 1
+	if days < 1 || days > MaxDays {
+		return nil, ErrRange
+	}
+	cutoff := Cutoff()
+	start, end := Window(from, to, cutoff)
+
+	var totals []Row
+	err := db.Raw(`
+	SELECT to_char(((created_at AT TIME ZONE ?) - make_interval(secs => ?))::date, 'YYYY-MM-DD') AS date,
+		COUNT(*) FILTER (WHERE type = 'TRANSFER' AND amount > 0) AS payments,
+		COALESCE(SUM(amount) FILTER (WHERE type = 'TRANSFER' AND amount > 0), 0) AS gross,
+		COALESCE(-SUM(amount) FILTER (WHERE type = 'FEE'), 0) AS fees,
+		COALESCE(-SUM(amount) FILTER (WHERE type = 'REFUND' AND amount < 0), 0) AS refunds,
+		COUNT(*) FILTER (WHERE type = 'REFUND' AND amount < 0) AS refund_count
+	FROM transactions
+	WHERE account_id = ? AND deleted_at IS NULL AND created_at >= ? AND created_at < ?
+	GROUP BY 1
+	`, Location.String(), cutoff.Seconds(), accountID.String(), start, end).Scan(&totals).Error
+	if err != nil {
+		return nil, err
+	}
+	return Fill(totals, from, days, time.Now(), cutoff), nil
+}
+
+// Fill lays totals out over days consecutive business days from from,
+// computes Net and marks the days that closed before now as final.
+func Fill(totals []Row, from time.Time, days int, now time.Time, cutoff time.Duration) []Row {
+	byDate := make(map[string]Row, len(totals))
+	for _, t := range totals {
+		byDate[t.Date] = t
+	}
+	rows := make([]Row, 0, days)
+	for i := 0; i < days; i++ {
+		day := time.Date(from.Year(), from.Month(), from.Day()+i, 0, 0, 0, 0, Location)
+		row := byDate[day.Format(time.DateOnly)]
+		row.Date = day.Format(time.DateOnly)
+		row.Net = row.Gross - row.Fees - row.Refunds
+		_, end := Window(day, day, cutoff)
+		row.Final = !end.After(now)
+		rows = append(rows, row)
+	}
+	return rows
+}
+
+// Sum adds up the rows of a report. The result has no date.
+func Sum(rows []Row) Row {
+	var total Row
+	total.Final = true
+	for _, r := range rows {
+		total.Payments += r.Payments
+		total.Gross += r.Gross
+		total.Fees += r.Fees
+		total.Refunds += r.Refunds
+		total.RefundCount += r.RefundCount
+		total.Net += r.Net
+		total.Final = total.Final && r.Final
+	}
+	return total
+}
+
+// WriteCSV writes rows with a header line.
+func WriteCSV(w io.Writer, rows []Row) error {
+	out := csv.NewWriter(w)
+	out.Write([]string{"date", "payments", "gross", "fees", "refunds", "refund_count", "net", "final"})
+	for _, r := range rows {
+		out.Write([]string{
+			r.Date,
+			strconv.FormatInt(r.Payments, 10),
+			strconv.FormatInt(r.Gross, 10),
+			strconv.FormatInt(r.Fees, 10),
+			strconv.FormatInt(r.Refunds, 10),
+			strconv.FormatInt(r.RefundCount, 10),
+			strconv.FormatInt(r.Net, 10),
+			strconv.FormatBool(r.Final),
+		})
+	}
+	out.Flush()
+	return out.Error()
+}
+
+// ParseDate reads a YYYY-MM-DD business day.
+func ParseDate(s string) (time.Time, error) {
+	t, err := time.ParseInLocation(time.DateOnly, s, Location)
+	if err != nil {
+		return time.Time{}, errors.New("dates must be YYYY-MM-DD")
+	}
+	return t, nil
+}
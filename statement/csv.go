@@ -0,0 +1,46 @@
+package statement
+
+import (
+	"encoding/csv"
+	"io"
+	"strconv"
+	"time"
+)
+
+type csvWriter struct {
+	out *csv.Writer
+	loc *time.Location
+}
+
+func newCSVWriter(w io.Writer) *csvWriter {
+	return &csvWriter{out: csv.NewWriter(w)}
+}
+
+// Begin writes the header and an opening balance row.
+func (w *csvWriter) Begin(s *Summary) error {
+	w.loc = s.Location
+	w.out.Write([]string{"date", "transaction_id", "type", "description", "bank", "external_account", "amount", "balance"})
+	w.out.Write([]string{s.From.In(w.loc).Format(time.RFC3339), "", "", "Opening balance", "", "", "", strconv.FormatInt(s.Opening, 10)})
+	return w.out.Error()
+}
+
+func (w *csvWriter) Entry(e *Entry) error {
+	w.out.Write([]string{
+		e.At.In(w.loc).Format(time.RFC3339),
+		e.ID.String(),
+		e.Type,
+		deref(e.Description),
+		deref(e.BankName),
+		deref(e.ExternalAccount),
+		strconv.FormatInt(e.Amount, 10),
+		strconv.FormatInt(e.Balance, 10),
+	})
+	return w.out.Error()
+}
+
+// End writes a closing balance row.
+func (w *csvWriter) End(s *Summary) error {
+	w.out.Write([]string{s.To.In(w.loc).Format(time.RFC3339), "", "", "Closing balance", "", "", "", strconv.FormatInt(s.Closing, 10)})
+	w.out.Flush()
+	return w.out.Error()
+}
@@ -0,0 +1,107 @@
+package statement
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"io"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// jsonWriter writes the canonical JSON document of a statement. It only
+// holds what can not change once the period is over, so rendering the same
+// period again gives the same bytes: the holder's name and the generation
+// time are left out.
+type jsonWriter struct {
+	out   *bufio.Writer
+	loc   *time.Location
+	count int
+}
+
+func newJSONWriter(w io.Writer) *jsonWriter {
+	return &jsonWriter{out: bufio.NewWriter(w)}
+}
+
+type jsonHeader struct {
+	AccountID     uuid.UUID   `json:"accountId"`
+	AccountNumber string      `json:"accountNumber"`
+	From          string      `json:"from"`
+	To            string      `json:"to"`
+	TimeZone      string      `json:"timeZone"`
+	Currency      string      `json:"currency"`
+	Opening       int64       `json:"openingBalance"`
+	Closing       int64       `json:"closingBalance"`
+	Credits       int64       `json:"totalCredits"`
+	Debits        int64       `json:"totalDebits"`
+	Count         int64       `json:"transactionCount"`
+	Totals        []TypeTotal `json:"totalsByType"`
+}
+
+type jsonEntry struct {
+	ID              uuid.UUID `json:"transactionId"`
+	At              string    `json:"at"`
+	Type            string    `json:"type"`
+	Description     *string   `json:"description"`
+	BankName        *string   `json:"bankName"`
+	ExternalAccount *string   `json:"externalAccount"`
+	Amount          int64     `json:"amount"`
+	Balance         int64     `json:"balance"`
+}
+
+// Begin writes every field but the entries and opens the entries array.
+func (w *jsonWriter) Begin(s *Summary) error {
+	w.loc = s.Location
+	totals := s.Totals
+	if totals == nil {
+		totals = []TypeTotal{}
+	}
+	b, err := json.Marshal(jsonHeader{
+		AccountID:     s.AccountID,
+		AccountNumber: s.AccountNumber,
+		From:          s.From.In(w.loc).Format(time.RFC3339),
+		To:            s.To.In(w.loc).Format(time.RFC3339),
+		TimeZone:      w.loc.String(),
+		Currency:      "IDR",
+		Opening:       s.Opening,
+		Closing:       s.Closing,
+		Credits:       s.Credits,
+		Debits:        s.Debits,
+		Count:         s.Count,
+		Totals:        totals,
+	})
+	if err != nil {
+		return err
+	}
+	w.out.Write(bytes.TrimSuffix(b, []byte("}")))
+	_, err = w.out.WriteString(`,"entries":[`)
+	return err
+}
+
+func (w *jsonWriter) Entry(e *Entry) error {
+	b, err := json.Marshal(jsonEntry{
+		ID:              e.ID,
+		At:              e.At.In(w.loc).Format(time.RFC3339Nano),
+		Type:            e.Type,
+		Description:     e.Description,
+		BankName:        e.BankName,
+		ExternalAccount: e.ExternalAccount,
+		Amount:          e.Amount,
+		Balance:         e.Balance,
+	})
+	if err != nil {
+		return err
+	}
+	if w.count > 0 {
+		w.out.WriteByte(',')
+	}
+	w.count++
+	_, err = w.out.Write(b)
+	return err
+}
+
+func (w *jsonWriter) End(s *Summary) error {
+	w.out.WriteString("]}\n")
+	return w.out.Flush()
+}
@@ -0,0 +1,153 @@
+package statement
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"log"
+	"time"
+
+	"github.com/eclipseron/digital-wallet-app/models"
+	"github.com/eclipseron/digital-wallet-app/settlement"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// ArchiveGrace is how long after a month ends its statements are archived,
+// so bookings still committing around midnight land in the month first.
+const ArchiveGrace = time.Hour
+
+var ErrPeriodOpen = errors.New("month has not been closed long enough to archive")
+
+// Month returns the calendar month of t in Asia/Jakarta as YYYY-MM with the
+// instants it starts and ends at.
+func Month(t time.Time) (period string, start, end time.Time) {
+	t = t.In(settlement.Location)
+	start = time.Date(t.Year(), t.Month(), 1, 0, 0, 0, 0, settlement.Location)
+	return start.Format("2006-01"), start, start.AddDate(0, 1, 0)
+}
+
+// ParseMonth reads a YYYY-MM period.
+func ParseMonth(period string) (start, end time.Time, err error) {
+	start, err = time.ParseInLocation("2006-01", period, settlement.Location)
+	if err != nil {
+		return start, end, err
+	}
+	return start, start.AddDate(0, 1, 0), nil
+}
+
+// Render renders the canonical document of accountID for the month starting
+// at start and returns it with its summary.
+func Render(ctx context.Context, db *gorm.DB, accountID uuid.UUID, start time.Time) ([]byte, *Summary, error) {
+	_, start, end := Month(start)
+	var buf bytes.Buffer
+	var summary *Summary
+	capture := func(s *Summary) error {
+		summary = s
+		return nil
+	}
+	err := Generate(ctx, db, accountID, start, end, settlement.Location, capture, newJSONWriter(&buf))
+	if err != nil {
+		return nil, nil, err
+	}
+	return buf.Bytes(), summary, nil
+}
+
+// Hash is the hex SHA-256 of a document.
+func Hash(document []byte) string {
+	sum := sha256.Sum256(document)
+	return hex.EncodeToString(sum[:])
+}
+
+// Archive renders and stores the monthly statement of accountID. A statement
+// that already exists is kept as it is, a month is only archived ArchiveGrace
+// after it ended.
+func Archive(ctx context.Context, db *gorm.DB, accountID uuid.UUID, start time.Time) error {
+	if _, _, end := Month(start); time.Now().Before(end.Add(ArchiveGrace)) {
+		return ErrPeriodOpen
+	}
+	document, s, err := Render(ctx, db, accountID, start)
+	if err != nil {
+		return err
+	}
+	totals, err := json.Marshal(s.Totals)
+	if err != nil {
+		return err
+	}
+	period, start, end := Month(start)
+	return db.WithContext(ctx).Clauses(clause.OnConflict{DoNothing: true}).Create(&models.MonthlyStatement{
+		AccountID:   accountID,
+		Period:      period,
+		PeriodStart: start,
+		PeriodEnd:   end,
+		Opening:     s.Opening,
+		Closing:     s.Closing,
+		Credits:     s.Credits,
+		Debits:      s.Debits,
+		Count:       s.Count,
+		Totals:      string(totals),
+		Document:    document,
+		Hash:        Hash(document),
+	}).Error
+}
+
+// ArchiveDue archives last month's statement of every account that existed
+// during it and has none yet, once ArchiveGrace has passed since it ended.
+// Accounts that fail are logged and retried on the next run. It returns how
+// many statements were archived.
+func ArchiveDue(ctx context.Context, db *gorm.DB, now time.Time) (int, error) {
+	_, current, _ := Month(now.Add(-ArchiveGrace))
+	period, start, end := Month(current.AddDate(0, -1, 0))
+
+	archived := 0
+	after := uuid.Nil
+	for {
+		var ids []uuid.UUID
+		err := db.WithContext(ctx).Raw(`
+		SELECT a.id FROM accounts a
+		WHERE a.id > ? AND a.created_at < ? AND (a.deleted_at IS NULL OR a.deleted_at >= ?)
+		AND NOT EXISTS (SELECT 1 FROM monthly_statements s WHERE s.account_id = a.id AND s.period = ?)
+		ORDER BY a.id LIMIT 100
+		`, after.String(), end, start, period).Scan(&ids).Error
+		if err != nil {
+			return archived, err
+		}
+		if len(ids) == 0 {
+			return archived, nil
+		}
+		for _, id := range ids {
+			if err := Archive(ctx, db, id, start); err != nil {
+				log.Printf("failed to archive %s statement of account %s: %v", period, id, err)
+				continue
+			}
+			archived++
+		}
+		after = ids[len(ids)-1]
+	}
+}
+
+// Run archives last month's statements every interval until ctx is done, so
+// they are written shortly after a month starts.
+func Run(ctx context.Context, db *gorm.DB, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			n, err := ArchiveDue(ctx, db, time.Now())
+			if err != nil {
+				log.Println("failed to archive monthly statements:", err)
+				continue
+			}
+			if n > 0 {
+				log.Printf("archived %d monthly statements", n)
+			}
+		}
+	}
+}
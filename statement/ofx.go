@@ -0,0 +1,97 @@
+package statement
+
+import (
+	"bufio"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+)
+
+// BankID identifies the wallet in OFX files.
+const BankID = "WALLET"
+
+type ofxWriter struct {
+	out *bufio.Writer
+	loc *time.Location
+}
+
+func newOFXWriter(w io.Writer) *ofxWriter {
+	return &ofxWriter{out: bufio.NewWriter(w)}
+}
+
+// ofxTime formats t as an OFX datetime with its offset, e.g.
+// 20240301120000.000[+7:WIB].
+func ofxTime(t time.Time) string {
+	name, offset := t.Zone()
+	return fmt.Sprintf("%s[%+g:%s]", t.Format("20060102150405.000"), float64(offset)/3600, name)
+}
+
+func ofxAmount(amount int64) string {
+	return fmt.Sprintf("%d.00", amount)
+}
+
+func ofxText(s string, max int) string {
+	if len(s) > max {
+		s = s[:max]
+	}
+	var b strings.Builder
+	xml.EscapeText(&b, []byte(s))
+	return b.String()
+}
+
+// ofxType maps a transaction type to an OFX TRNTYPE.
+func ofxType(e *Entry) string {
+	switch e.Type {
+	case "FEE", "PAYOUT_FEE":
+		return "FEE"
+	case "TRANSFER_IN", "TRANSFER_OUT", "TRANSFER":
+		return "XFER"
+	case "INTEREST":
+		return "INT"
+	}
+	if e.Amount < 0 {
+		return "DEBIT"
+	}
+	return "CREDIT"
+}
+
+func (w *ofxWriter) Begin(s *Summary) error {
+	w.loc = s.Location
+	fmt.Fprint(w.out, `<?xml version="1.0" encoding="UTF-8" standalone="no"?>`+"\n")
+	fmt.Fprint(w.out, `<?OFX OFXHEADER="200" VERSION="211" SECURITY="NONE" OLDFILEUID="NONE" NEWFILEUID="NONE"?>`+"\n")
+	fmt.Fprintf(w.out, "<OFX>\n<SIGNONMSGSRSV1><SONRS>"+
+		"<STATUS><CODE>0</CODE><SEVERITY>INFO</SEVERITY></STATUS>"+
+		"<DTSERVER>%s</DTSERVER><LANGUAGE>ENG</LANGUAGE></SONRS></SIGNONMSGSRSV1>\n",
+		ofxTime(s.GeneratedAt.In(w.loc)))
+	fmt.Fprintf(w.out, "<BANKMSGSRSV1><STMTTRNRS><TRNUID>%s</TRNUID>"+
+		"<STATUS><CODE>0</CODE><SEVERITY>INFO</SEVERITY></STATUS>\n<STMTRS><CURDEF>IDR</CURDEF>\n"+
+		"<BANKACCTFROM><BANKID>%s</BANKID><ACCTID>%s</ACCTID><ACCTTYPE>CHECKING</ACCTTYPE></BANKACCTFROM>\n"+
+		"<BANKTRANLIST><DTSTART>%s</DTSTART><DTEND>%s</DTEND>\n",
+		s.AccountID.String(), BankID, ofxText(s.AccountNumber, 22),
+		ofxTime(s.From.In(w.loc)), ofxTime(s.To.In(w.loc)))
+	return nil
+}
+
+func (w *ofxWriter) Entry(e *Entry) error {
+	name := deref(e.Description)
+	if name == "" {
+		name = e.Type
+	}
+	memo := strings.TrimSpace(strings.Join([]string{deref(e.BankName), deref(e.ExternalAccount)}, " "))
+	fmt.Fprintf(w.out, "<STMTTRN><TRNTYPE>%s</TRNTYPE><DTPOSTED>%s</DTPOSTED><TRNAMT>%s</TRNAMT><FITID>%s</FITID><NAME>%s</NAME>",
+		ofxType(e), ofxTime(e.At.In(w.loc)), ofxAmount(e.Amount), e.ID.String(), ofxText(name, 32))
+	if memo != "" {
+		fmt.Fprintf(w.out, "<MEMO>%s</MEMO>", ofxText(memo, 255))
+	}
+	_, err := fmt.Fprint(w.out, "</STMTTRN>\n")
+	return err
+}
+
+func (w *ofxWriter) End(s *Summary) error {
+	fmt.Fprintf(w.out, "</BANKTRANLIST>\n<LEDGERBAL><BALAMT>%s</BALAMT><DTASOF>%s</DTASOF></LEDGERBAL>\n"+
+		"</STMTRS></STMTTRNRS></BANKMSGSRSV1>\n</OFX>\n",
+		ofxAmount(s.Closing), ofxTime(s.To.In(w.loc)))
+	return w.out.Flush()
+}
@@ -0,0 +1,216 @@
+package statement
+
+import (
+	"bufio"
+	"bytes"
+	"compress/zlib"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+)
+
+// The PDF is A4 landscape set in Courier, so columns line up by counting
+// characters. Only the page being filled is kept in memory, finished pages
+// are written out right away and the page tree is written last.
+const (
+	pdfWidth       = 842
+	pdfHeight      = 595
+	pdfMargin      = 36
+	pdfFontSize    = 8
+	pdfLeading     = 11
+	pdfLinesByPage = (pdfHeight - 2*pdfMargin) / pdfLeading
+)
+
+const (
+	pdfCatalog = 1
+	pdfPages   = 2
+	pdfFont    = 3
+	pdfBold    = 4
+)
+
+type pdfWriter struct {
+	out     *countingWriter
+	offsets []int64
+	pages   []int
+	summary *Summary
+	page    bytes.Buffer
+	lines   int
+}
+
+type countingWriter struct {
+	w *bufio.Writer
+	n int64
+}
+
+func (c *countingWriter) Write(p []byte) (int, error) {
+	n, err := c.w.Write(p)
+	c.n += int64(n)
+	return n, err
+}
+
+func newPDFWriter(w io.Writer) *pdfWriter {
+	// object numbers start at 1, the first four are fixed
+	return &pdfWriter{out: &countingWriter{w: bufio.NewWriter(w)}, offsets: make([]int64, pdfBold+1)}
+}
+
+// object writes object number id with body.
+func (w *pdfWriter) object(id int, body string) {
+	for len(w.offsets) <= id {
+		w.offsets = append(w.offsets, 0)
+	}
+	w.offsets[id] = w.out.n
+	fmt.Fprintf(w.out, "%d 0 obj\n%s\nendobj\n", id, body)
+}
+
+func (w *pdfWriter) next() int {
+	w.offsets = append(w.offsets, 0)
+	return len(w.offsets) - 1
+}
+
+// pdfText escapes s for a PDF string. Characters outside of ASCII are
+// replaced, the standard fonts have no glyphs for most of them.
+func pdfText(s string) string {
+	var b strings.Builder
+	for _, r := range s {
+		switch {
+		case r == '(' || r == ')' || r == '\\':
+			b.WriteByte('\\')
+			b.WriteRune(r)
+		case r < 32 || r > 126:
+			b.WriteByte('?')
+		default:
+			b.WriteRune(r)
+		}
+	}
+	return b.String()
+}
+
+func fit(s string, width int) string {
+	if len(s) > width {
+		if width > 1 {
+			return s[:width-1] + "~"
+		}
+		return s[:width]
+	}
+	return s
+}
+
+func (w *pdfWriter) line(text string, bold bool) error {
+	if w.lines == pdfLinesByPage {
+		if err := w.flushPage(); err != nil {
+			return err
+		}
+	}
+	if w.lines == 0 {
+		w.pageHeader()
+	}
+	font := "F1"
+	if bold {
+		font = "F2"
+	}
+	fmt.Fprintf(&w.page, "/%s %d Tf (%s) Tj T*\n", font, pdfFontSize, pdfText(text))
+	w.lines++
+	return nil
+}
+
+const pdfColumns = "%-19s %-12s %-44s %-8s %-20s %16s %16s"
+
+func (w *pdfWriter) pageHeader() {
+	s := w.summary
+	w.lines = 4
+	fmt.Fprintf(&w.page, "BT %d %d Td %d TL\n", pdfMargin, pdfHeight-pdfMargin-pdfFontSize, pdfLeading)
+	fmt.Fprintf(&w.page, "/F2 %d Tf (%s) Tj T*\n", pdfFontSize+2, pdfText(fmt.Sprintf(
+		"Account statement %s - %s", s.AccountNumber, s.Holder)))
+	fmt.Fprintf(&w.page, "/F1 %d Tf (%s) Tj T*\n", pdfFontSize, pdfText(fmt.Sprintf(
+		"Period %s to %s (%s)   Page %d",
+		s.From.In(s.Location).Format("2006-01-02 15:04"), s.To.In(s.Location).Format("2006-01-02 15:04"),
+		s.Location.String(), len(w.pages)+1)))
+	fmt.Fprintf(&w.page, "/F2 %d Tf (%s) Tj T*\n", pdfFontSize, pdfText(fmt.Sprintf(pdfColumns,
+		"Date", "Type", "Description", "Bank", "External account", "Amount", "Balance")))
+	fmt.Fprintf(&w.page, "/F1 %d Tf (%s) Tj T*\n", pdfFontSize, strings.Repeat("-", 141))
+}
+
+// flushPage writes the page being filled as a compressed content stream and
+// its page object.
+func (w *pdfWriter) flushPage() error {
+	w.page.WriteString("ET\n")
+	var content bytes.Buffer
+	z := zlib.NewWriter(&content)
+	z.Write(w.page.Bytes())
+	z.Close()
+
+	contents := w.next()
+	w.offsets[contents] = w.out.n
+	fmt.Fprintf(w.out, "%d 0 obj\n<< /Length %d /Filter /FlateDecode >>\nstream\n", contents, content.Len())
+	w.out.Write(content.Bytes())
+	fmt.Fprint(w.out, "\nendstream\nendobj\n")
+
+	page := w.next()
+	w.object(page, fmt.Sprintf(
+		"<< /Type /Page /Parent %d 0 R /MediaBox [0 0 %d %d] /Resources << /Font << /F1 %d 0 R /F2 %d 0 R >> >> /Contents %d 0 R >>",
+		pdfPages, pdfWidth, pdfHeight, pdfFont, pdfBold, contents))
+	w.pages = append(w.pages, page)
+
+	w.page.Reset()
+	w.lines = 0
+	return w.out.w.Flush()
+}
+
+func (w *pdfWriter) Begin(s *Summary) error {
+	w.summary = s
+	fmt.Fprint(w.out, "%PDF-1.4\n%\xe2\xe3\xcf\xd3\n")
+	w.object(pdfFont, "<< /Type /Font /Subtype /Type1 /BaseFont /Courier /Encoding /WinAnsiEncoding >>")
+	w.object(pdfBold, "<< /Type /Font /Subtype /Type1 /BaseFont /Courier-Bold /Encoding /WinAnsiEncoding >>")
+	return w.line(fmt.Sprintf(pdfColumns, "", "", "Opening balance", "", "", "", FormatAmount(s.Opening)), true)
+}
+
+func (w *pdfWriter) Entry(e *Entry) error {
+	return w.line(fmt.Sprintf(pdfColumns,
+		e.At.In(w.summary.Location).Format("2006-01-02 15:04:05"),
+		e.Type,
+		fit(deref(e.Description), 44),
+		fit(deref(e.BankName), 8),
+		fit(deref(e.ExternalAccount), 20),
+		FormatAmount(e.Amount),
+		FormatAmount(e.Balance),
+	), false)
+}
+
+// End writes the totals, the page tree, the catalog and the cross-reference
+// table.
+func (w *pdfWriter) End(s *Summary) error {
+	totals := [][2]string{
+		{"Closing balance", FormatAmount(s.Closing)},
+		{"Total credits", FormatAmount(s.Credits)},
+		{"Total debits", FormatAmount(-s.Debits)},
+		{"Transactions", fmt.Sprint(s.Count)},
+		{"Generated at", s.GeneratedAt.In(s.Location).Format(time.RFC3339)},
+	}
+	for _, t := range s.Totals {
+		totals = append(totals, [2]string{fmt.Sprintf("%s (%d)", t.Type, t.Count), FormatAmount(t.Amount)})
+	}
+	for i, t := range totals {
+		if err := w.line(fmt.Sprintf(pdfColumns, "", "", t[0], "", "", "", t[1]), i == 0); err != nil {
+			return err
+		}
+	}
+	if err := w.flushPage(); err != nil {
+		return err
+	}
+
+	kids := make([]string, len(w.pages))
+	for i, p := range w.pages {
+		kids[i] = fmt.Sprintf("%d 0 R", p)
+	}
+	w.object(pdfPages, fmt.Sprintf("<< /Type /Pages /Kids [%s] /Count %d >>", strings.Join(kids, " "), len(w.pages)))
+	w.object(pdfCatalog, fmt.Sprintf("<< /Type /Catalog /Pages %d 0 R >>", pdfPages))
+
+	xref := w.out.n
+	fmt.Fprintf(w.out, "xref\n0 %d\n0000000000 65535 f \n", len(w.offsets))
+	for _, off := range w.offsets[1:] {
+		fmt.Fprintf(w.out, "%010d 00000 n \n", off)
+	}
+	fmt.Fprintf(w.out, "trailer\n<< /Size %d /Root %d 0 R >>\nstartxref\n%d\n%%%%EOF\n", len(w.offsets), pdfCatalog, xref)
+	return w.out.w.Flush()
+}
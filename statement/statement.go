@@ -0,0 +1,221 @@
+// Package statement renders the transactions of an account over a period as
+// CSV, PDF or OFX. Rows are streamed from the database to the writer one at
+// a time, so the size of a statement does not depend on available memory.
+package statement
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+const (
+	FormatCSV = "csv"
+	FormatPDF = "pdf"
+	FormatOFX = "ofx"
+	// FormatJSON is the canonical document archived as monthly statement
+	FormatJSON = "json"
+)
+
+var (
+	ErrFormat          = errors.New("format must be csv, pdf, ofx or json")
+	ErrAccountNotFound = errors.New("account not found")
+)
+
+// TypeTotal adds up the transactions of one type.
+type TypeTotal struct {
+	Type   string `json:"type"`
+	Count  int64  `json:"count"`
+	Amount int64  `json:"amount"`
+}
+
+// Summary describes a statement. Opening is the balance at From, Closing the
+// balance right before To. Credits and Debits are both positive.
+type Summary struct {
+	AccountID     uuid.UUID
+	AccountNumber string
+	Holder        string
+	From          time.Time
+	To            time.Time
+	Location      *time.Location
+	Opening       int64
+	Closing       int64
+	Credits       int64
+	Debits        int64
+	Count         int64
+	Totals        []TypeTotal
+	GeneratedAt   time.Time
+}
+
+// Entry is one transaction with the balance after it.
+type Entry struct {
+	ID              uuid.UUID
+	At              time.Time
+	Type            string
+	Description     *string
+	BankName        *string
+	ExternalAccount *string
+	Amount          int64
+	Balance         int64
+}
+
+// Writer renders a statement. Begin is called once before the entries and
+// End once after them.
+type Writer interface {
+	Begin(s *Summary) error
+	Entry(e *Entry) error
+	End(s *Summary) error
+}
+
+// NewWriter returns the Writer of format writing to w.
+func NewWriter(format string, w io.Writer) (Writer, error) {
+	switch format {
+	case FormatCSV:
+		return newCSVWriter(w), nil
+	case FormatPDF:
+		return newPDFWriter(w), nil
+	case FormatOFX:
+		return newOFXWriter(w), nil
+	case FormatJSON:
+		return newJSONWriter(w), nil
+	}
+	return nil, ErrFormat
+}
+
+// ContentType is the media type of format.
+func ContentType(format string) string {
+	switch format {
+	case FormatPDF:
+		return "application/pdf"
+	case FormatOFX:
+		return "application/x-ofx"
+	case FormatJSON:
+		return "application/json"
+	}
+	return "text/csv"
+}
+
+// Generate writes the statement of accountID from from (included) to to
+// (excluded). Everything is read in one repeatable read transaction so the
+// balances agree with the rows. begin is called with the summary before
+// anything is written, it is the last chance to reject the request.
+func Generate(ctx context.Context, db *gorm.DB, accountID uuid.UUID, from, to time.Time, loc *time.Location,
+	begin func(*Summary) error, w Writer) error {
+	return db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		s := Summary{AccountID: accountID, From: from, To: to, Location: loc, GeneratedAt: time.Now()}
+		var head struct {
+			AccountNumber string
+			Name          string
+			Balance       int64
+			Since         int64
+			Credits       int64
+			Debits        int64
+			Count         int64
+		}
+		res := tx.Raw(`
+		SELECT a.account_number, u.name, a.balance,
+			COALESCE(SUM(t.amount), 0) AS since,
+			COALESCE(SUM(t.amount) FILTER (WHERE t.created_at < ? AND t.amount > 0), 0) AS credits,
+			COALESCE(-SUM(t.amount) FILTER (WHERE t.created_at < ? AND t.amount < 0), 0) AS debits,
+			COUNT(t.id) FILTER (WHERE t.created_at < ?) AS count
+		FROM accounts a
+		JOIN users u ON u.id = a.user_id
+		LEFT JOIN transactions t ON t.account_id = a.id AND t.deleted_at IS NULL AND t.created_at >= ?
+		WHERE a.id = ?
+		GROUP BY a.id, u.name
+		`, to, to, to, from, accountID.String()).Scan(&head)
+		if res.Error != nil {
+			return res.Error
+		}
+		if res.RowsAffected == 0 {
+			return ErrAccountNotFound
+		}
+		s.AccountNumber = head.AccountNumber
+		s.Holder = head.Name
+		s.Opening = head.Balance - head.Since
+		s.Credits = head.Credits
+		s.Debits = head.Debits
+		s.Count = head.Count
+		s.Closing = s.Opening + s.Credits - s.Debits
+
+		err := tx.Raw(`
+		SELECT type, COUNT(*) AS count, SUM(amount) AS amount
+		FROM transactions
+		WHERE account_id = ? AND deleted_at IS NULL AND created_at >= ? AND created_at < ?
+		GROUP BY type ORDER BY type
+		`, accountID.String(), from, to).Scan(&s.Totals).Error
+		if err != nil {
+			return err
+		}
+
+		if begin != nil {
+			if err := begin(&s); err != nil {
+				return err
+			}
+		}
+		if err := w.Begin(&s); err != nil {
+			return err
+		}
+
+		rows, err := tx.Raw(`
+		SELECT id, created_at, type, description, bank_name, external_account, amount
+		FROM transactions
+		WHERE account_id = ? AND deleted_at IS NULL AND created_at >= ? AND created_at < ?
+		ORDER BY created_at, sequence, id
+		`, accountID.String(), from, to).Rows()
+		if err != nil {
+			return err
+		}
+		defer rows.Close()
+
+		balance := s.Opening
+		var e Entry
+		for rows.Next() {
+			err := rows.Scan(&e.ID, &e.At, &e.Type, &e.Description, &e.BankName, &e.ExternalAccount, &e.Amount)
+			if err != nil {
+				return err
+			}
+			balance += e.Amount
+			e.Balance = balance
+			if err := w.Entry(&e); err != nil {
+				return err
+			}
+		}
+		if err := rows.Err(); err != nil {
+			return err
+		}
+		return w.End(&s)
+	}, &sql.TxOptions{Isolation: sql.LevelRepeatableRead, ReadOnly: true})
+}
+
+// FormatAmount groups the digits of a rupiah amount with dots.
+func FormatAmount(amount int64) string {
+	sign := ""
+	if amount < 0 {
+		sign = "-"
+		amount = -amount
+	}
+	digits := fmt.Sprint(amount)
+	var b strings.Builder
+	for i, d := range digits {
+		if i > 0 && (len(digits)-i)%3 == 0 {
+			b.WriteByte('.')
+		}
+		b.WriteRune(d)
+	}
+	return sign + b.String()
+}
+
+func deref(s *string) string {
+	if s == nil {
+		return ""
+	}
+	return *s
+}
@@ -0,0 +1,168 @@
+package stream
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/eclipseron/digital-wallet-app/models"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5/stdlib"
+	"gorm.io/gorm"
+)
+
+// subscriptionBuffer is how many events a slow client may fall behind
+// before its subscription is dropped. It then reconnects with Last-Event-ID.
+const subscriptionBuffer = 64
+
+type Subscription struct {
+	C         chan models.OutboxEvent
+	hub       *Hub
+	accountID uuid.UUID
+	closed    bool
+}
+
+// Close unsubscribes. It is safe to call after the hub dropped the
+// subscription.
+func (s *Subscription) Close() {
+	s.hub.mu.Lock()
+	defer s.hub.mu.Unlock()
+	s.hub.drop(s)
+}
+
+// Hub fans outbox events out to the streams open on this instance. Every
+// instance LISTENs on models.OutboxChannel, so an event committed by any
+// instance reaches every client.
+type Hub struct {
+	db   *gorm.DB
+	mu   sync.Mutex
+	subs map[uuid.UUID]map[*Subscription]struct{}
+}
+
+func NewHub(db *gorm.DB) *Hub {
+	return &Hub{db: db, subs: map[uuid.UUID]map[*Subscription]struct{}{}}
+}
+
+func (h *Hub) Subscribe(accountID uuid.UUID) *Subscription {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	s := &Subscription{C: make(chan models.OutboxEvent, subscriptionBuffer), hub: h, accountID: accountID}
+	if h.subs[accountID] == nil {
+		h.subs[accountID] = map[*Subscription]struct{}{}
+	}
+	h.subs[accountID][s] = struct{}{}
+	return s
+}
+
+// drop closes s, h.mu must be held.
+func (h *Hub) drop(s *Subscription) {
+	if s.closed {
+		return
+	}
+	s.closed = true
+	close(s.C)
+	delete(h.subs[s.accountID], s)
+	if len(h.subs[s.accountID]) == 0 {
+		delete(h.subs, s.accountID)
+	}
+}
+
+// dropAll ends every stream. Clients resume from their Last-Event-ID, which
+// covers anything missed while the listener was down.
+func (h *Hub) dropAll() {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for _, subs := range h.subs {
+		for s := range subs {
+			h.drop(s)
+		}
+	}
+}
+
+// Run listens for outbox notifications until ctx is done, reconnecting on
+// error. All streams are ended when it returns.
+func (h *Hub) Run(ctx context.Context) {
+	defer h.dropAll()
+	for {
+		err := h.listen(ctx)
+		if ctx.Err() != nil {
+			return
+		}
+		log.Println("outbox listener stopped:", err)
+		h.dropAll()
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(time.Second):
+		}
+	}
+}
+
+func (h *Hub) listen(ctx context.Context) error {
+	sqlDB, err := h.db.DB()
+	if err != nil {
+		return err
+	}
+	conn, err := sqlDB.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	return conn.Raw(func(driverConn any) error {
+		c, ok := driverConn.(*stdlib.Conn)
+		if !ok {
+			return errors.New("database driver does not support LISTEN")
+		}
+		pgConn := c.Conn()
+		if _, err := pgConn.Exec(ctx, "LISTEN "+models.OutboxChannel); err != nil {
+			return err
+		}
+		// the connection goes back to the pool, it must not keep listening
+		defer pgConn.Exec(context.Background(), "UNLISTEN *")
+
+		for {
+			n, err := pgConn.WaitForNotification(ctx)
+			if err != nil {
+				return err
+			}
+			h.notify(n.Payload)
+		}
+	})
+}
+
+func (h *Hub) notify(payload string) {
+	var n struct {
+		AccountID *uuid.UUID `json:"accountId"`
+		Position  int64      `json:"position"`
+	}
+	if err := json.Unmarshal([]byte(payload), &n); err != nil || n.AccountID == nil {
+		return
+	}
+
+	h.mu.Lock()
+	listening := len(h.subs[*n.AccountID]) > 0
+	h.mu.Unlock()
+	if !listening {
+		return
+	}
+
+	var event models.OutboxEvent
+	if err := h.db.Where("position = ?", n.Position).First(&event).Error; err != nil {
+		log.Println("failed to load outbox event:", err)
+		return
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for s := range h.subs[*n.AccountID] {
+		select {
+		case s.C <- event:
+		default:
+			h.drop(s)
+		}
+	}
+}
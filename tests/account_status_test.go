@@ -0,0 +1,125 @@
+package tests
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/eclipseron/digital-wallet-app/conf"
+	"github.com/eclipseron/digital-wallet-app/controller"
+	"github.com/eclipseron/digital-wallet-app/middleware"
+	"github.com/eclipseron/digital-wallet-app/models"
+	"github.com/eclipseron/digital-wallet-app/utils"
+	"github.com/joho/godotenv"
+)
+
+func TestDebitFrozenAllowsTopUpOnly(t *testing.T) {
+	godotenv.Load("../.env")
+	db := conf.SetupDB()
+	hash, _ := utils.CreateHash(TEST_PASSWORD)
+
+	u := models.User{
+		Email:    TEST_EMAIL,
+		Password: hash,
+	}
+	db.Create(&u)
+
+	acc := models.Account{
+		UserID:        u.ID,
+		Balance:       100000,
+		Status:        models.AccountStatusDebitFrozen,
+		AccountNumber: strconv.Itoa(int(time.Now().UnixMilli())),
+	}
+	db.Create(&acc)
+
+	c := controller.NewController(db)
+	srv := http.NewServeMux()
+	srv.Handle("/api/v1/transaction/withdraw",
+		middleware.RequireAuth(http.HandlerFunc(c.WithdrawHandler)))
+	srv.Handle("/api/v1/transaction/transfer/topup",
+		middleware.RequireAuth(http.HandlerFunc(c.TopUpHandler)))
+
+	token, _ := utils.CreateJWT(u.ID, models.RoleCustomer)
+
+	body := strings.NewReader(fmt.Sprintf(`{"amount": %d, "accountId":"%s"}`, 50000, acc.ID.String()))
+	req := httptest.NewRequest("POST", "/api/v1/transaction/withdraw", body)
+	req.Header.Set("Authorization", "Bearer "+token)
+	w := httptest.NewRecorder()
+	srv.ServeHTTP(w, req)
+	if w.Code != http.StatusForbidden {
+		t.Fatalf("expected 403 on withdraw, got %d", w.Code)
+	}
+
+	body = strings.NewReader(fmt.Sprintf(`{"amount": %d, "accountId":"%s"}`, 10000, acc.ID.String()))
+	req = httptest.NewRequest("POST", "/api/v1/transaction/transfer/topup", body)
+	req.Header.Set("Authorization", "Bearer "+token)
+	w = httptest.NewRecorder()
+	srv.ServeHTTP(w, req)
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected 200 on top up, got %d", w.Code)
+	}
+
+	t.Cleanup(func() {
+		db.Where("id = ?", acc.ID).Delete(&models.Account{})
+		db.Where("id = ?", u.ID).Delete(&models.User{})
+	})
+}
+
+func TestCloseAccountRequiresZeroBalance(t *testing.T) {
+	godotenv.Load("../.env")
+	db := conf.SetupDB()
+	hash, _ := utils.CreateHash(TEST_PASSWORD)
+
+	u := models.User{
+		Email:    TEST_EMAIL,
+		Password: hash,
+	}
+	db.Create(&u)
+
+	acc := models.Account{
+		UserID:        u.ID,
+		Balance:       50000,
+		AccountNumber: strconv.Itoa(int(time.Now().UnixMilli())),
+	}
+	db.Create(&acc)
+
+	c := controller.NewController(db)
+	srv := http.NewServeMux()
+	srv.Handle("POST /api/v1/accounts/{accountId}/close",
+		middleware.RequireAuth(http.HandlerFunc(c.CloseAccountHandler)))
+
+	token, _ := utils.CreateJWT(u.ID, models.RoleCustomer)
+	target := fmt.Sprintf("/api/v1/accounts/%s/close", acc.ID.String())
+
+	req := httptest.NewRequest("POST", target, strings.NewReader(`{}`))
+	req.Header.Set("Authorization", "Bearer "+token)
+	w := httptest.NewRecorder()
+	srv.ServeHTTP(w, req)
+	if w.Code != http.StatusConflict {
+		t.Fatalf("expected 409, got %d", w.Code)
+	}
+
+	req = httptest.NewRequest("POST", target, strings.NewReader(`{"to": "1234567890", "bankName": "BCA"}`))
+	req.Header.Set("Authorization", "Bearer "+token)
+	w = httptest.NewRecorder()
+	srv.ServeHTTP(w, req)
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d", w.Code)
+	}
+
+	var closed models.Account
+	db.First(&closed, "id = ?", acc.ID)
+	if closed.Status != models.AccountStatusClosed || closed.Balance != 0 {
+		t.Fatalf("expected closed account with zero balance, got %s %d", closed.Status, closed.Balance)
+	}
+
+	t.Cleanup(func() {
+		db.Where("account_id = ?", acc.ID).Delete(&models.AccountStatusChange{})
+		db.Where("id = ?", acc.ID).Delete(&models.Account{})
+		db.Where("id = ?", u.ID).Delete(&models.User{})
+	})
+}
@@ -0,0 +1,96 @@
+package tests
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/eclipseron/digital-wallet-app/conf"
+	"github.com/eclipseron/digital-wallet-app/controller"
+	"github.com/eclipseron/digital-wallet-app/middleware"
+	"github.com/eclipseron/digital-wallet-app/models"
+	"github.com/eclipseron/digital-wallet-app/utils"
+	"github.com/google/uuid"
+	"github.com/joho/godotenv"
+)
+
+func TestAdminRouteForbiddenForCustomer(t *testing.T) {
+	godotenv.Load("../.env")
+
+	called := false
+	srv := http.NewServeMux()
+	srv.Handle("/api/v1/admin/users",
+		middleware.RequireAuth(middleware.RequireRole(models.RoleAdmin)(
+			http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) { called = true }))))
+
+	req := httptest.NewRequest("GET", "/api/v1/admin/users?reason=test", nil)
+	token, _ := utils.CreateJWT(uuid.New(), models.RoleCustomer)
+	req.Header.Set("Authorization", "Bearer "+token)
+
+	w := httptest.NewRecorder()
+	srv.ServeHTTP(w, req)
+
+	if w.Code != http.StatusForbidden {
+		t.Fatalf("expected 403, got %d", w.Code)
+	}
+	if called {
+		t.Fatalf("expected handler not to be called")
+	}
+}
+
+func TestAdminFreezeBlocksWithdraw(t *testing.T) {
+	godotenv.Load("../.env")
+	db := conf.SetupDB()
+	hash, _ := utils.CreateHash(TEST_PASSWORD)
+
+	u := models.User{
+		Email:    TEST_EMAIL,
+		Password: hash,
+	}
+	db.Create(&u)
+
+	acc := models.Account{
+		UserID:        u.ID,
+		Balance:       100000,
+		AccountNumber: strconv.Itoa(int(time.Now().UnixMilli())),
+	}
+	db.Create(&acc)
+
+	c := controller.NewController(db)
+	srv := http.NewServeMux()
+	srv.Handle("POST /api/v1/admin/accounts/{accountId}/freeze",
+		middleware.RequireAuth(middleware.RequireRole(models.RoleSupport)(http.HandlerFunc(c.AdminFreezeAccountHandler))))
+	srv.Handle("/api/v1/transaction/withdraw",
+		middleware.RequireAuth(http.HandlerFunc(c.WithdrawHandler)))
+
+	staffToken, _ := utils.CreateJWT(uuid.New(), models.RoleSupport)
+	target := fmt.Sprintf("/api/v1/admin/accounts/%s/freeze", acc.ID.String())
+	req := httptest.NewRequest("POST", target, strings.NewReader(`{"reason": "fraud investigation"}`))
+	req.Header.Set("Authorization", "Bearer "+staffToken)
+
+	w := httptest.NewRecorder()
+	srv.ServeHTTP(w, req)
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d", w.Code)
+	}
+
+	token, _ := utils.CreateJWT(u.ID, models.RoleCustomer)
+	body := strings.NewReader(fmt.Sprintf(`{"amount": %d, "accountId":"%s"}`, 50000, acc.ID.String()))
+	req = httptest.NewRequest("POST", "/api/v1/transaction/withdraw", body)
+	req.Header.Set("Authorization", "Bearer "+token)
+
+	w = httptest.NewRecorder()
+	srv.ServeHTTP(w, req)
+	if w.Code != http.StatusForbidden {
+		t.Fatalf("expected 403, got %d", w.Code)
+	}
+
+	t.Cleanup(func() {
+		db.Where("id = ?", acc.ID).Delete(&models.Account{})
+		db.Where("id = ?", u.ID).Delete(&models.User{})
+	})
+}
@@ -0,0 +1,104 @@
+package tests
+
+import (
+	"testing"
+	"time"
+
+	"github.com/eclipseron/digital-wallet-app/analytics"
+	"github.com/eclipseron/digital-wallet-app/models"
+	"github.com/eclipseron/digital-wallet-app/settlement"
+)
+
+func TestCategorizeRules(t *testing.T) {
+	desc := func(s string) *string { return &s }
+	cases := []struct {
+		txType      string
+		amount      int64
+		bank        *string
+		description *string
+		expected    string
+	}{
+		{"TRANSFER_IN", 50000, nil, desc("Makan siang"), models.CategoryIncome},
+		{"FEE", -100, nil, nil, models.CategoryFees},
+		{"PAYOUT_FEE", -2500, nil, nil, models.CategoryFees},
+		{"REFUND", 20000, nil, nil, models.CategoryRefund},
+		{"TRANSFER", -35000, nil, desc("GrabFood order"), models.CategoryFood},
+		{"TRANSFER_OUT", -15000, nil, desc("Gojek ride"), models.CategoryTransport},
+		{"WITHDRAW", -200000, desc("BCA"), desc("Token PLN"), models.CategoryBills},
+		{"WITHDRAW", -100000, desc("atm"), nil, models.CategoryCashOut},
+		{"WITHDRAW", -100000, desc("BCA"), nil, models.CategoryTransfer},
+		{"WITHDRAW", -100000, nil, desc("Cash Withdrawal"), models.CategoryCashOut},
+		{"WITHDRAW", -100000, nil, nil, models.CategoryCashOut},
+		{"TRANSFER", -80000, nil, desc("Order 1234"), models.CategoryShopping},
+		{"ADJUSTMENT", -500, nil, nil, models.CategoryOther},
+	}
+	for _, tc := range cases {
+		if got := models.Categorize(tc.txType, tc.amount, tc.bank, tc.description); got != tc.expected {
+			t.Errorf("%s %d: expected %s, got %s", tc.txType, tc.amount, tc.expected, got)
+		}
+	}
+}
+
+func TestAnalyticsWeeksStartOnMonday(t *testing.T) {
+	// Sunday 2024-03-03 22:00 in Jakarta
+	at := time.Date(2024, 3, 3, 15, 0, 0, 0, time.UTC)
+	if start := analytics.Truncate(at, analytics.IntervalWeek).Format(time.DateOnly); start != "2024-02-26" {
+		t.Fatalf("expected week of 2024-02-26, got %s", start)
+	}
+	if start := analytics.Truncate(at, analytics.IntervalMonth).Format(time.DateOnly); start != "2024-03-01" {
+		t.Fatalf("expected month of 2024-03-01, got %s", start)
+	}
+}
+
+func TestAnalyticsAssembleComparesWithPreviousPeriod(t *testing.T) {
+	month := func(m time.Month) time.Time { return time.Date(2024, m, 1, 0, 0, 0, 0, settlement.Location) }
+	rows := []analytics.Row{
+		{Bucket: "2024-01-01", Category: models.CategoryFood, MoneyOut: 40000, Count: 2},
+		{Bucket: "2024-02-01", Category: models.CategoryIncome, MoneyIn: 100000, Count: 1},
+		{Bucket: "2024-03-01", Category: models.CategoryFood, MoneyOut: 30000, Count: 1},
+		{Bucket: "2024-04-01", Category: models.CategoryFood, MoneyOut: 50000, Count: 3},
+		{Bucket: "2024-04-01", Category: models.CategoryBills, MoneyOut: 60000, Count: 1},
+	}
+	report := analytics.Assemble(rows, analytics.IntervalMonth, month(1), []time.Time{month(3), month(4)})
+
+	if report.From != "2024-03-01" || report.To != "2024-04-30" {
+		t.Fatalf("expected 2024-03-01 to 2024-04-30, got %s to %s", report.From, report.To)
+	}
+	if len(report.Buckets) != 2 || report.Buckets[1].MoneyOut != 110000 || report.Buckets[1].Count != 4 {
+		t.Fatalf("unexpected buckets %+v", report.Buckets)
+	}
+	if report.Buckets[1].Categories[0].Category != models.CategoryBills {
+		t.Fatalf("expected biggest spending first, got %+v", report.Buckets[1].Categories)
+	}
+	if report.Total.MoneyOut != 140000 || report.Total.Net != -140000 {
+		t.Fatalf("unexpected total %+v", report.Total)
+	}
+
+	previous := report.Previous
+	if previous.From != "2024-01-01" || previous.To != "2024-02-29" {
+		t.Fatalf("expected previous period 2024-01-01 to 2024-02-29, got %s to %s", previous.From, previous.To)
+	}
+	if previous.MoneyOut != 40000 || previous.MoneyIn != 100000 {
+		t.Fatalf("unexpected previous totals %+v", previous)
+	}
+	if previous.MoneyOutChange == nil || *previous.MoneyOutChange != 250 {
+		t.Fatalf("expected money out up 250%%, got %v", previous.MoneyOutChange)
+	}
+	if len(previous.Categories) != 2 {
+		t.Fatalf("expected spending on food and bills compared, got %+v", previous.Categories)
+	}
+	for _, c := range previous.Categories {
+		if c.Category == models.CategoryBills && c.Change != nil {
+			t.Fatalf("expected no change for a new category, got %v", *c.Change)
+		}
+	}
+}
+
+func TestAnalyticsChange(t *testing.T) {
+	if c := analytics.Change(0, 100); c != nil {
+		t.Fatalf("expected nil change from zero, got %v", *c)
+	}
+	if c := analytics.Change(3, 2); c == nil || *c != -33.3 {
+		t.Fatalf("expected -33.3, got %v", c)
+	}
+}
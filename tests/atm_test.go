@@ -0,0 +1,114 @@
+package tests
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/eclipseron/digital-wallet-app/atm"
+	"github.com/eclipseron/digital-wallet-app/conf"
+	"github.com/eclipseron/digital-wallet-app/models"
+	"github.com/eclipseron/digital-wallet-app/utils"
+	"github.com/eclipseron/digital-wallet-app/webhooks"
+	"github.com/joho/godotenv"
+	"gorm.io/gorm"
+)
+
+func TestATMCallbackSignature(t *testing.T) {
+	body := []byte(`{"code":"123456789012"}`)
+	now := time.Now()
+	header := webhooks.Sign("secret", now.Unix(), body)
+
+	if err := atm.Verify("secret", header, body, now); err != nil {
+		t.Fatalf("expected a valid signature, got %v", err)
+	}
+	if err := atm.Verify("other", header, body, now); !errors.Is(err, atm.ErrSignature) {
+		t.Fatalf("expected a wrong secret to fail, got %v", err)
+	}
+	if err := atm.Verify("secret", header, []byte(`{"code":"000000000000"}`), now); !errors.Is(err, atm.ErrSignature) {
+		t.Fatalf("expected a changed body to fail, got %v", err)
+	}
+	if err := atm.Verify("secret", header, body, now.Add(10*time.Minute)); !errors.Is(err, atm.ErrSignature) {
+		t.Fatalf("expected an old signature to fail, got %v", err)
+	}
+}
+
+func TestATMCodeLifecycle(t *testing.T) {
+	godotenv.Load("../.env")
+	db := conf.SetupDB()
+	hash, _ := utils.CreateHash(TEST_PASSWORD)
+
+	u := models.User{
+		Email:    TEST_EMAIL,
+		Password: hash,
+	}
+	db.Create(&u)
+
+	acc := models.Account{
+		UserID:        u.ID,
+		Balance:       200000,
+		AccountNumber: strconv.Itoa(int(time.Now().UnixMilli())),
+	}
+	db.Create(&acc)
+
+	var code *models.ATMCode
+	var plainCode, pin string
+	err := db.Transaction(func(tx *gorm.DB) error {
+		var err error
+		code, plainCode, pin, err = atm.Issue(tx, acc.ID, u.ID, 150000)
+		return err
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	var held models.Account
+	db.First(&held, "id = ?", acc.ID)
+	if held.HeldBalance != 150000 {
+		t.Fatalf("expected 150000 held, got %d", held.HeldBalance)
+	}
+
+	audits := 0
+	audit := func(tx *gorm.DB, code *models.ATMCode, before string, result error) error {
+		audits++
+		return nil
+	}
+	wrong := "000000"
+	if pin == wrong {
+		wrong = "111111"
+	}
+	req := atm.Redemption{Code: plainCode, Pin: wrong, TerminalID: "SIM00001", Reference: "SIM-" + code.ID.String()}
+	if _, err := atm.Redeem(context.Background(), db, req, audit); !errors.Is(err, atm.ErrPinInvalid) {
+		t.Fatalf("expected a wrong pin to be refused, got %v", err)
+	}
+
+	req.Pin = pin
+	redeemed, err := atm.Redeem(context.Background(), db, req, audit)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if redeemed.Status != models.ATMCodeStatusRedeemed || redeemed.TransactionID == nil {
+		t.Fatalf("expected the code to be redeemed, got %+v", redeemed)
+	}
+	// the network retrying the same callback gets the same answer
+	if _, err := atm.Redeem(context.Background(), db, req, audit); err != nil {
+		t.Fatalf("expected a retry to succeed, got %v", err)
+	}
+	if audits != 3 {
+		t.Fatalf("expected every attempt audited, got %d", audits)
+	}
+
+	var after models.Account
+	db.First(&after, "id = ?", acc.ID)
+	if after.Balance != 50000 || after.HeldBalance != 0 {
+		t.Fatalf("expected 50000 left and nothing held, got %d and %d", after.Balance, after.HeldBalance)
+	}
+
+	t.Cleanup(func() {
+		db.Where("account_id = ?", acc.ID).Delete(&models.ATMCode{})
+		db.Where("id = ?", acc.ID).Delete(&models.Account{})
+		db.Where("id = ?", u.ID).Delete(&models.User{})
+	})
+}
@@ -0,0 +1,103 @@
+package tests
+
+import (
+	"context"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/eclipseron/digital-wallet-app/conf"
+	"github.com/eclipseron/digital-wallet-app/ledger"
+	"github.com/eclipseron/digital-wallet-app/models"
+	"github.com/eclipseron/digital-wallet-app/utils"
+	"github.com/joho/godotenv"
+)
+
+func TestEndOfDayIsJakartaMidnight(t *testing.T) {
+	day, end := ledger.EndOfDay(time.Date(2026, 3, 3, 18, 30, 0, 0, time.UTC))
+	if got := day.Format(time.DateOnly); got != "2026-03-04" {
+		t.Fatalf("expected 18:30 UTC to fall on the next day in Jakarta, got %s", got)
+	}
+	if !end.Equal(time.Date(2026, 3, 4, 17, 0, 0, 0, time.UTC)) {
+		t.Fatalf("expected day to end at 17:00 UTC, got %s", end.UTC())
+	}
+}
+
+func TestBalanceAtReplaysFromSnapshot(t *testing.T) {
+	godotenv.Load("../.env")
+	db := conf.SetupDB()
+	hash, _ := utils.CreateHash(TEST_PASSWORD)
+	ctx := context.Background()
+
+	day, end := ledger.EndOfDay(time.Now().AddDate(0, 0, -2))
+
+	u := models.User{
+		Email:    TEST_EMAIL,
+		Password: hash,
+	}
+	db.Create(&u)
+
+	acc := models.Account{
+		UserID:        u.ID,
+		Balance:       7500,
+		AccountNumber: strconv.Itoa(int(time.Now().UnixMilli())),
+		CreatedAt:     end.Add(-48 * time.Hour),
+	}
+	db.Create(&acc)
+
+	for _, entry := range []struct {
+		amount int64
+		at     time.Time
+	}{
+		{10000, end.Add(-time.Hour)},
+		{-5000, end.Add(time.Hour)},
+		{2500, time.Now().Add(-time.Minute)},
+	} {
+		db.Create(&models.Transactions{AccountID: acc.ID, Amount: entry.amount, Type: "ADJUSTMENT", CreatedAt: entry.at})
+	}
+
+	if _, err := ledger.Snapshot(ctx, db, day); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	var snapshot models.BalanceSnapshot
+	db.Where("account_id = ?", acc.ID).First(&snapshot)
+	if snapshot.Balance != 10000 {
+		t.Fatalf("expected end of day balance 10000, got %d", snapshot.Balance)
+	}
+
+	for _, tc := range []struct {
+		at       time.Time
+		expected int64
+	}{
+		{end.Add(-2 * time.Hour), 0},
+		{end.Add(30 * time.Minute), 10000},
+		{end.Add(2 * time.Hour), 5000},
+		{time.Now(), 7500},
+	} {
+		balance, err := ledger.BalanceAt(ctx, db, acc.ID, tc.at)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if balance.Balance != tc.expected || balance.SnapshotDay == nil {
+			t.Fatalf("expected %d at %s from the snapshot, got %+v", tc.expected, tc.at, balance)
+		}
+	}
+
+	if _, err := ledger.BalanceAt(ctx, db, acc.ID, time.Now().Add(time.Hour)); err != ledger.ErrFutureInstant {
+		t.Fatalf("expected future instant to be rejected, got %v", err)
+	}
+
+	report, err := ledger.VerifyChain(db, acc.ID)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !report.Valid || report.Snapshots != 1 {
+		t.Fatalf("expected valid report with 1 snapshot, got %+v", report)
+	}
+
+	t.Cleanup(func() {
+		db.Where("account_id = ?", acc.ID).Delete(&models.BalanceSnapshot{})
+		db.Where("id = ?", acc.ID).Delete(&models.Account{})
+		db.Where("id = ?", u.ID).Delete(&models.User{})
+	})
+}
@@ -0,0 +1,187 @@
+package tests
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/eclipseron/digital-wallet-app/biller"
+	"github.com/eclipseron/digital-wallet-app/conf"
+	"github.com/eclipseron/digital-wallet-app/models"
+	"github.com/eclipseron/digital-wallet-app/utils"
+	"github.com/joho/godotenv"
+	"gorm.io/gorm"
+)
+
+func TestBillerSimulator(t *testing.T) {
+	sim := biller.NewSimulator()
+	ctx := context.Background()
+
+	pln, err := biller.Find("PLN50")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	inquiry, err := sim.Inquire(ctx, *pln, "08123456781")
+	if err != nil || inquiry.Amount != 50000 {
+		t.Fatalf("expected the product price quoted, got %+v, %v", inquiry, err)
+	}
+	result, err := sim.Purchase(ctx, *pln, "08123456781", 50000, "req-1")
+	if err != nil || result.Status != biller.ResultSuccess || len(result.Token) != 24 {
+		t.Fatalf("expected a token, got %+v, %v", result, err)
+	}
+	again, _ := sim.Purchase(ctx, *pln, "08123456781", 50000, "req-1")
+	if again.Token != result.Token || again.Reference != result.Reference {
+		t.Fatal("expected a repeated request to return the same purchase")
+	}
+
+	if _, err := sim.Inquire(ctx, *pln, "08123456780"); !errors.Is(err, biller.ErrCustomerNotFound) {
+		t.Fatalf("expected an unknown customer, got %v", err)
+	}
+	if result, _ := sim.Purchase(ctx, *pln, "08123456789", 50000, "req-2"); result.Status != biller.ResultFailed {
+		t.Fatalf("expected a failed purchase, got %+v", result)
+	}
+	if result, _ := sim.Purchase(ctx, *pln, "08123456788", 50000, "req-3"); result.Status != biller.ResultPending {
+		t.Fatalf("expected a pending purchase, got %+v", result)
+	}
+	if result, _ := sim.Purchase(ctx, *pln, "08123456788", 50000, "req-3"); result.Status != biller.ResultSuccess {
+		t.Fatalf("expected the retry to succeed, got %+v", result)
+	}
+
+	bill, _ := biller.Find("PLNPOST")
+	inquiry, err = sim.Inquire(ctx, *bill, "5123456781")
+	if err != nil || inquiry.Amount < 50000 || inquiry.Amount > 500000 || inquiry.Amount%100 != 0 {
+		t.Fatalf("expected an amount due, got %+v, %v", inquiry, err)
+	}
+
+	if _, err := biller.Find("NOPE"); !errors.Is(err, biller.ErrUnknownProduct) {
+		t.Fatalf("expected an unknown product, got %v", err)
+	}
+	if biller.ValidCustomerID("0812a456") || biller.ValidCustomerID("123") || !biller.ValidCustomerID("081234") {
+		t.Fatal("unexpected customer id validation")
+	}
+}
+
+func TestBillPaymentRefund(t *testing.T) {
+	godotenv.Load("../.env")
+	db := conf.SetupDB()
+	hash, _ := utils.CreateHash(TEST_PASSWORD)
+
+	u := models.User{
+		Email:    TEST_EMAIL,
+		Password: hash,
+	}
+	db.Create(&u)
+
+	acc := models.Account{
+		UserID:        u.ID,
+		Balance:       100000,
+		AccountNumber: strconv.Itoa(int(time.Now().UnixMilli())),
+	}
+	db.Create(&acc)
+
+	// the simulator fails every purchase of a number ending in 9
+	payment, err := biller.Inquire(context.Background(), db, acc.ID, u.ID, "PULSA25", "08123456789")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if payment.Total != 26500 {
+		t.Fatalf("expected price and admin fee quoted, got %d", payment.Total)
+	}
+	err = db.Transaction(func(tx *gorm.DB) error {
+		_, _, err := biller.Pay(tx, acc.ID, payment.ID)
+		return err
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	var paid models.Account
+	db.First(&paid, "id = ?", acc.ID)
+	if paid.Balance != 73500 {
+		t.Fatalf("expected 73500 after paying, got %d", paid.Balance)
+	}
+
+	if err := biller.Process(context.Background(), db, payment.ID); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	var refunded models.BillPayment
+	db.First(&refunded, "id = ?", payment.ID)
+	if refunded.Status != models.BillPaymentStatusRefunded || refunded.RefundTransactionID == nil {
+		t.Fatalf("expected the payment refunded, got %+v", refunded)
+	}
+	var after models.Account
+	db.First(&after, "id = ?", acc.ID)
+	if after.Balance != 100000 {
+		t.Fatalf("expected the total refunded, got %d", after.Balance)
+	}
+
+	t.Cleanup(func() {
+		db.Where("type = ?", biller.JobPay).Delete(&models.Job{})
+		db.Where("user_id = ?", u.ID).Delete(&models.Notification{})
+		db.Where("account_id = ?", acc.ID).Delete(&models.BillPayment{})
+		db.Where("account_id = ?", acc.ID).Delete(&models.Transactions{})
+		db.Where("id = ?", acc.ID).Delete(&models.Account{})
+		db.Where("id = ?", u.ID).Delete(&models.User{})
+	})
+}
+
+func TestReconcileDeadBillPayment(t *testing.T) {
+	godotenv.Load("../.env")
+	db := conf.SetupDB()
+	hash, _ := utils.CreateHash(TEST_PASSWORD)
+
+	u := models.User{
+		Email:    TEST_EMAIL,
+		Password: hash,
+	}
+	db.Create(&u)
+
+	acc := models.Account{
+		UserID:        u.ID,
+		Balance:       100000,
+		AccountNumber: strconv.Itoa(int(time.Now().UnixMilli())),
+	}
+	db.Create(&acc)
+
+	// the simulator answers pending to the first purchase of a number ending in 8
+	payment, err := biller.Inquire(context.Background(), db, acc.ID, u.ID, "PULSA25", "08123456788")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	err = db.Transaction(func(tx *gorm.DB) error {
+		_, _, err := biller.Pay(tx, acc.ID, payment.ID)
+		return err
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := biller.Process(context.Background(), db, payment.ID); !errors.Is(err, biller.ErrStillPending) {
+		t.Fatalf("expected the purchase still pending, got %v", err)
+	}
+
+	// the job gave up and the purchase was paid long ago
+	db.Model(&models.Job{}).Where("unique_key = ?", biller.JobPay+":"+payment.ID.String()).
+		Update("status", models.JobStatusDead)
+	db.Model(&models.BillPayment{}).Where("id = ?", payment.ID).
+		Update("paid_at", time.Now().Add(-2*biller.StaleAfter))
+
+	if _, err := biller.Reconcile(context.Background(), db); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	var done models.BillPayment
+	db.First(&done, "id = ?", payment.ID)
+	if done.Status != models.BillPaymentStatusSuccess {
+		t.Fatalf("expected the stale purchase completed, got %+v", done)
+	}
+
+	t.Cleanup(func() {
+		db.Where("type = ?", biller.JobPay).Delete(&models.Job{})
+		db.Where("user_id = ?", u.ID).Delete(&models.Notification{})
+		db.Where("account_id = ?", acc.ID).Delete(&models.BillPayment{})
+		db.Where("account_id = ?", acc.ID).Delete(&models.Transactions{})
+		db.Where("id = ?", acc.ID).Delete(&models.Account{})
+		db.Where("id = ?", u.ID).Delete(&models.User{})
+	})
+}
@@ -0,0 +1,118 @@
+package tests
+
+import (
+	"slices"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/eclipseron/digital-wallet-app/conf"
+	"github.com/eclipseron/digital-wallet-app/models"
+	"github.com/eclipseron/digital-wallet-app/utils"
+	"github.com/google/uuid"
+	"github.com/joho/godotenv"
+)
+
+func TestBudgetThresholdsCrossed(t *testing.T) {
+	b := models.Budget{Amount: 100000, Thresholds: models.FormatThresholds([]int{100, 80, 80, 50})}
+	if b.Thresholds != "50,80,100" {
+		t.Fatalf("expected sorted unique thresholds, got %s", b.Thresholds)
+	}
+	if crossed := b.Crossed(79999); !slices.Equal(crossed, []int{50}) {
+		t.Fatalf("expected only 50 crossed, got %v", crossed)
+	}
+	if crossed := b.Crossed(100000); !slices.Equal(crossed, []int{50, 80, 100}) {
+		t.Fatalf("expected every threshold crossed, got %v", crossed)
+	}
+}
+
+func TestBudgetAlertOnDebit(t *testing.T) {
+	godotenv.Load("../.env")
+	db := conf.SetupDB()
+	hash, _ := utils.CreateHash(TEST_PASSWORD)
+
+	u := models.User{
+		Email:    TEST_EMAIL,
+		Password: hash,
+	}
+	db.Create(&u)
+
+	acc := models.Account{
+		UserID:        u.ID,
+		Balance:       0,
+		AccountNumber: strconv.Itoa(int(time.Now().UnixMilli())),
+	}
+	db.Create(&acc)
+
+	budget := models.Budget{
+		AccountID:  acc.ID,
+		UserID:     u.ID,
+		Category:   models.CategoryFood,
+		Amount:     100000,
+		Thresholds: models.FormatThresholds(models.DefaultBudgetThresholds),
+	}
+	db.Create(&budget)
+
+	food := "Kopi susu"
+	for _, amount := range []int64{-50000, -35000, -10000, -20000} {
+		db.Create(&models.Transactions{AccountID: acc.ID, Amount: amount, Type: "TRANSFER", Description: &food})
+	}
+	// other categories do not count against the budget
+	db.Create(&models.Transactions{AccountID: acc.ID, Amount: -90000, Type: "TRANSFER_OUT"})
+
+	var thresholds []int
+	db.Model(&models.BudgetAlert{}).Where("budget_id = ?", budget.ID).Order("threshold").Pluck("threshold", &thresholds)
+	if !slices.Equal(thresholds, []int{80, 100}) {
+		t.Fatalf("expected alerts at 80 and 100, got %v", thresholds)
+	}
+
+	var notifications int64
+	db.Model(&models.Notification{}).
+		Where("user_id = ? AND type = ?", u.ID, models.NotificationBudgetThreshold).Count(&notifications)
+	if notifications != 2 {
+		t.Fatalf("expected one notification per threshold, got %d", notifications)
+	}
+
+	statuses, err := models.BudgetStatuses(db, acc.ID, nil, time.Now())
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(statuses) != 1 || statuses[0].Spent != 115000 {
+		t.Fatalf("expected 115000 spent on food, got %+v", statuses)
+	}
+
+	// moving money to an own account is not spending, a reversal gives back
+	// to the category it reverses
+	own := models.Account{
+		UserID:        u.ID,
+		AccountNumber: strconv.Itoa(int(time.Now().UnixMilli()) + 1),
+	}
+	db.Create(&own)
+	overall := models.Budget{
+		AccountID:  acc.ID,
+		UserID:     u.ID,
+		Amount:     1000000,
+		Thresholds: models.FormatThresholds(models.DefaultBudgetThresholds),
+	}
+	db.Create(&overall)
+	db.Create(&models.Transactions{AccountID: acc.ID, Amount: -30000, Type: "TRANSFER_OUT", RelatedAccountID: &own.ID})
+	var reversed models.Transactions
+	db.Where("account_id = ? AND amount = ?", acc.ID, -20000).First(&reversed)
+	db.Create(&models.Transactions{AccountID: acc.ID, Amount: 20000, Type: "REVERSAL", ReversalOf: &reversed.ID})
+
+	statuses, err = models.BudgetStatuses(db, acc.ID, nil, time.Now())
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(statuses) != 2 || statuses[0].Spent != 185000 || statuses[1].Spent != 95000 {
+		t.Fatalf("expected 185000 spent overall and 95000 on food, got %+v", statuses)
+	}
+
+	t.Cleanup(func() {
+		db.Where("user_id = ?", u.ID).Delete(&models.Notification{})
+		db.Where("id IN ?", []uuid.UUID{budget.ID, overall.ID}).Delete(&models.Budget{})
+		db.Where("account_id = ?", acc.ID).Delete(&models.Transactions{})
+		db.Where("id IN ?", []uuid.UUID{acc.ID, own.ID}).Delete(&models.Account{})
+		db.Where("id = ?", u.ID).Delete(&models.User{})
+	})
+}
@@ -0,0 +1,76 @@
+package tests
+
+import (
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/eclipseron/digital-wallet-app/conf"
+	"github.com/eclipseron/digital-wallet-app/ledger"
+	"github.com/eclipseron/digital-wallet-app/models"
+	"github.com/eclipseron/digital-wallet-app/utils"
+	"github.com/google/uuid"
+	"github.com/joho/godotenv"
+)
+
+func TestTransactionHashCoversContent(t *testing.T) {
+	desc := "Top Up"
+	tx := models.Transactions{
+		ID:          uuid.New(),
+		AccountID:   uuid.New(),
+		Amount:      10000,
+		Type:        "TRANSFER_IN",
+		Description: &desc,
+		Sequence:    1,
+		CreatedAt:   time.Now(),
+	}
+	original := tx.ComputeHash()
+
+	tx.Amount = 20000
+	if tx.ComputeHash() == original {
+		t.Fatalf("expected hash to change with amount")
+	}
+
+	tx.Amount = 10000
+	prev := "00"
+	tx.PrevHash = &prev
+	if tx.ComputeHash() == original {
+		t.Fatalf("expected hash to change with previous hash")
+	}
+}
+
+func TestVerifyChainValid(t *testing.T) {
+	godotenv.Load("../.env")
+	db := conf.SetupDB()
+	hash, _ := utils.CreateHash(TEST_PASSWORD)
+
+	u := models.User{
+		Email:    TEST_EMAIL,
+		Password: hash,
+	}
+	db.Create(&u)
+
+	acc := models.Account{
+		UserID:        u.ID,
+		Balance:       0,
+		AccountNumber: strconv.Itoa(int(time.Now().UnixMilli())),
+	}
+	db.Create(&acc)
+
+	for _, amount := range []int64{10000, -5000, 2500} {
+		db.Create(&models.Transactions{AccountID: acc.ID, Amount: amount, Type: "ADJUSTMENT"})
+	}
+
+	report, err := ledger.VerifyChain(db, acc.ID)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !report.Valid || report.Entries != 3 || report.LastSequence != 3 {
+		t.Fatalf("expected valid chain of 3 entries, got %+v", report)
+	}
+
+	t.Cleanup(func() {
+		db.Where("id = ?", acc.ID).Delete(&models.Account{})
+		db.Where("id = ?", u.ID).Delete(&models.User{})
+	})
+}
@@ -0,0 +1,37 @@
+package tests
+
+import (
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/eclipseron/digital-wallet-app/utils"
+)
+
+func TestClientIP(t *testing.T) {
+	t.Setenv("TRUSTED_PROXIES", "10.0.0.0/8")
+
+	// a client talking to us directly can not pick its own address
+	req := httptest.NewRequest("GET", "/", nil)
+	req.RemoteAddr = "203.0.113.7:5000"
+	req.Header.Set("X-Forwarded-For", "198.51.100.1")
+	if ip := utils.ClientIP(req); ip != "203.0.113.7" {
+		t.Fatalf("expected the connection address, got %q", ip)
+	}
+
+	// behind the proxy the hop it appended wins over one the client forged
+	req.RemoteAddr = "10.1.2.3:5000"
+	req.Header.Set("X-Forwarded-For", "198.51.100.1, 203.0.113.7, 10.9.9.9")
+	if ip := utils.ClientIP(req); ip != "203.0.113.7" {
+		t.Fatalf("expected the last untrusted hop, got %q", ip)
+	}
+
+	// an oversized or malformed hop is never returned
+	req.Header.Set("X-Forwarded-For", strings.Repeat("a", 200))
+	if ip := utils.ClientIP(req); ip != "10.1.2.3" {
+		t.Fatalf("expected the proxy address, got %q", ip)
+	}
+	if ip := utils.ClientIP(req); len(ip) > 45 {
+		t.Fatalf("expected an address that fits the audit column, got %d characters", len(ip))
+	}
+}
@@ -45,7 +45,7 @@ func TestGetBalanceSuccess(t *testing.T) {
 
 	target := fmt.Sprintf("/api/v1/accounts/%s/balance", acc.ID.String())
 	req := httptest.NewRequest("GET", target, nil)
-	token, _ := utils.CreateJWT(u.ID)
+	token, _ := utils.CreateJWT(u.ID, models.RoleCustomer)
 	req.Header.Set("Authorization", "Bearer "+token)
 
 	w := httptest.NewRecorder()
@@ -147,7 +147,7 @@ func TestGetBalanceAccountNotFound(t *testing.T) {
 
 	target := fmt.Sprintf("/api/v1/accounts/%s/balance", uuid.New().String())
 	req := httptest.NewRequest("GET", target, nil)
-	token, _ := utils.CreateJWT(u.ID)
+	token, _ := utils.CreateJWT(u.ID, models.RoleCustomer)
 	req.Header.Set("Authorization", "Bearer "+token)
 
 	w := httptest.NewRecorder()
@@ -0,0 +1,100 @@
+package tests
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/eclipseron/digital-wallet-app/conf"
+	"github.com/eclipseron/digital-wallet-app/controller"
+	"github.com/eclipseron/digital-wallet-app/ledger"
+	"github.com/eclipseron/digital-wallet-app/middleware"
+	"github.com/eclipseron/digital-wallet-app/models"
+	"github.com/eclipseron/digital-wallet-app/utils"
+	"github.com/joho/godotenv"
+)
+
+func TestHoldReducesAvailableBalance(t *testing.T) {
+	godotenv.Load("../.env")
+	db := conf.SetupDB()
+	hash, _ := utils.CreateHash(TEST_PASSWORD)
+
+	u := models.User{
+		Email:    TEST_EMAIL,
+		Password: hash,
+	}
+	db.Create(&u)
+
+	acc := models.Account{
+		UserID:        u.ID,
+		Balance:       100000,
+		AccountNumber: strconv.Itoa(int(time.Now().UnixMilli())),
+	}
+	db.Create(&acc)
+
+	hold := models.Hold{AccountID: acc.ID, Amount: 30000, ExpiresAt: time.Now().Add(time.Hour)}
+	tx := db.Begin()
+	if err := ledger.PlaceHold(tx, &hold); err != nil {
+		tx.Rollback()
+		t.Fatalf("unexpected error: %v", err)
+	}
+	tx.Commit()
+
+	c := controller.NewController(db)
+	srv := http.NewServeMux()
+	srv.Handle("/api/v1/accounts/{accountId}/balance",
+		middleware.RequireAuth(http.HandlerFunc(c.GetAccountBalanceHandler)))
+
+	target := fmt.Sprintf("/api/v1/accounts/%s/balance", acc.ID.String())
+	req := httptest.NewRequest("GET", target, nil)
+	token, _ := utils.CreateJWT(u.ID, models.RoleCustomer)
+	req.Header.Set("Authorization", "Bearer "+token)
+
+	w := httptest.NewRecorder()
+	srv.ServeHTTP(w, req)
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d", w.Code)
+	}
+
+	type DataModel struct {
+		LedgerBalance    int64 `json:"ledgerBalance"`
+		AvailableBalance int64 `json:"availableBalance"`
+	}
+	type ResponseModel struct {
+		Data DataModel `json:"data"`
+	}
+	var res ResponseModel
+	json.NewDecoder(w.Result().Body).Decode(&res)
+	if res.Data.LedgerBalance != 100000 || res.Data.AvailableBalance != 70000 {
+		t.Fatalf("expected ledger 100000 and available 70000, got %d and %d",
+			res.Data.LedgerBalance, res.Data.AvailableBalance)
+	}
+
+	tx = db.Begin()
+	entry := models.Transactions{Type: "CAPTURE"}
+	captured, balance, err := ledger.CaptureHold(tx, hold.ID, 10000, &entry)
+	if err != nil {
+		tx.Rollback()
+		t.Fatalf("unexpected error: %v", err)
+	}
+	tx.Commit()
+	if captured.Status != models.HoldStatusCaptured || balance != 90000 {
+		t.Fatalf("expected captured hold and balance 90000, got %s and %d", captured.Status, balance)
+	}
+
+	var after models.Account
+	db.First(&after, "id = ?", acc.ID)
+	if after.HeldBalance != 0 {
+		t.Fatalf("expected remaining hold to be released, got %d held", after.HeldBalance)
+	}
+
+	t.Cleanup(func() {
+		db.Where("account_id = ?", acc.ID).Delete(&models.Hold{})
+		db.Where("id = ?", acc.ID).Delete(&models.Account{})
+		db.Where("id = ?", u.ID).Delete(&models.User{})
+	})
+}
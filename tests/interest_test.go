@@ -0,0 +1,156 @@
+package tests
+
+import (
+	"context"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/eclipseron/digital-wallet-app/conf"
+	"github.com/eclipseron/digital-wallet-app/interest"
+	"github.com/eclipseron/digital-wallet-app/models"
+	"github.com/eclipseron/digital-wallet-app/statement"
+	"github.com/eclipseron/digital-wallet-app/utils"
+	"github.com/google/uuid"
+	"github.com/joho/godotenv"
+)
+
+func TestInterestDailyAccrualByTier(t *testing.T) {
+	tiers := []interest.Tier{{MinBalance: 10000000, RateBps: 300}, {MinBalance: 0, RateBps: 100}}
+	if err := interest.Validate(tiers); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if tiers[0].MinBalance != 0 {
+		t.Fatalf("expected tiers sorted by minBalance, got %+v", tiers)
+	}
+
+	// 10,000,000 at 1% and 5,000,000 at 3%, each band rounded half up
+	if micros := interest.Daily(15000000, tiers); micros != 273972603+410958904 {
+		t.Fatalf("expected 684931507 micro rupiah, got %d", micros)
+	}
+	if micros := interest.Daily(1, tiers); micros != 27 {
+		t.Fatalf("expected 27 micro rupiah, got %d", micros)
+	}
+	if micros := interest.Daily(-5000, tiers); micros != 0 {
+		t.Fatalf("expected nothing on a negative balance, got %d", micros)
+	}
+
+	duplicate := []interest.Tier{{MinBalance: 0, RateBps: 100}, {MinBalance: 0, RateBps: 200}}
+	if err := interest.Validate(duplicate); err == nil {
+		t.Fatal("expected duplicate tiers to be rejected")
+	}
+}
+
+func TestInterestSplitCarriesFraction(t *testing.T) {
+	gross, tax, net, carry := interest.Split(20547945210, 500000, 2000)
+	if gross != 20548 || carry != 445210 {
+		t.Fatalf("expected 20548 paid and 445210 carried, got %d and %d", gross, carry)
+	}
+	// 20% of 20548 is 4109.6, rounded half up
+	if tax != 4110 || net != 16438 {
+		t.Fatalf("expected 4110 tax and 16438 net, got %d and %d", tax, net)
+	}
+}
+
+func TestInterestPayout(t *testing.T) {
+	godotenv.Load("../.env")
+	db := conf.SetupDB()
+	hash, _ := utils.CreateHash(TEST_PASSWORD)
+
+	u := models.User{
+		Email:    TEST_EMAIL,
+		Password: hash,
+	}
+	db.Create(&u)
+
+	acc := models.Account{
+		UserID:        u.ID,
+		Balance:       15000000,
+		AccountNumber: strconv.Itoa(int(time.Now().UnixMilli())),
+	}
+	db.Create(&acc)
+
+	// interest is paid from a funded account and the tax owed on another
+	expense := models.Account{
+		UserID:        u.ID,
+		Balance:       1000000,
+		AccountNumber: strconv.Itoa(int(time.Now().UnixMilli()) + 1),
+	}
+	db.Create(&expense)
+	taxAccount := models.Account{
+		UserID:        u.ID,
+		AccountNumber: strconv.Itoa(int(time.Now().UnixMilli()) + 2),
+	}
+	db.Create(&taxAccount)
+	t.Setenv("INTEREST_ACCOUNT_ID", expense.ID.String())
+	t.Setenv("TAX_ACCOUNT_ID", taxAccount.ID.String())
+
+	frozen := models.Account{
+		UserID:        u.ID,
+		Balance:       15000000,
+		Status:        models.AccountStatusFrozen,
+		AccountNumber: strconv.Itoa(int(time.Now().UnixMilli()) + 3),
+	}
+	db.Create(&frozen)
+
+	for day := 1; day <= 30; day++ {
+		for _, id := range []uuid.UUID{acc.ID, frozen.ID} {
+			db.Create(&models.InterestAccrual{
+				AccountID: id,
+				Day:       time.Date(2024, 6, day, 0, 0, 0, 0, time.UTC),
+				Balance:   15000000,
+				Amount:    684931507,
+			})
+		}
+	}
+
+	start, _, _ := statement.ParseMonth("2024-06")
+	payout, err := interest.Pay(context.Background(), db, acc.ID, nil, start, 2000)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if payout.Days != 30 || payout.Gross != 20547 || payout.Tax != 4109 || payout.CarryOut != 945210 {
+		t.Fatalf("unexpected payout %+v", payout)
+	}
+
+	var after, paidFrom, owed models.Account
+	db.First(&after, "id = ?", acc.ID)
+	if after.Balance != 15000000+payout.Net {
+		t.Fatalf("expected %d, got %d", 15000000+payout.Net, after.Balance)
+	}
+	db.First(&paidFrom, "id = ?", expense.ID)
+	db.First(&owed, "id = ?", taxAccount.ID)
+	if paidFrom.Balance != 1000000-payout.Gross || owed.Balance != payout.Tax {
+		t.Fatalf("expected the interest paid from and the tax owed on system accounts, got %d and %d", paidFrom.Balance, owed.Balance)
+	}
+
+	deferred, err := interest.Pay(context.Background(), db, frozen.ID, nil, start, 2000)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if deferred.Deferred == nil || deferred.Gross != 0 || deferred.CarryOut != 30*684931507 {
+		t.Fatalf("expected the frozen account's payout deferred, got %+v", deferred)
+	}
+
+	rows, total, err := interest.Report(db, start)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	for _, r := range rows {
+		if r.AccountID == acc.ID && !r.Reconciled {
+			t.Fatalf("expected the payout to reconcile, got %+v", r)
+		}
+	}
+	if total.Mismatches != 0 || total.Deferred < 1 {
+		t.Fatalf("expected no mismatches and the deferral reported, got %+v", total)
+	}
+
+	t.Cleanup(func() {
+		ids := []uuid.UUID{acc.ID, frozen.ID, expense.ID, taxAccount.ID}
+		db.Where("account_id IN ?", ids).Delete(&models.InterestPayout{})
+		db.Where("account_id IN ?", ids).Delete(&models.InterestAccrual{})
+		db.Where("account_id IN ?", ids).Delete(&models.Transactions{})
+		db.Where("id IN ?", ids).Delete(&models.Account{})
+		db.Where("id = ?", u.ID).Delete(&models.User{})
+	})
+}
@@ -0,0 +1,74 @@
+package tests
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/eclipseron/digital-wallet-app/conf"
+	"github.com/eclipseron/digital-wallet-app/jobs"
+	"github.com/eclipseron/digital-wallet-app/models"
+	"github.com/google/uuid"
+	"github.com/joho/godotenv"
+)
+
+func TestBackoffGrowsAndIsCapped(t *testing.T) {
+	if d := jobs.Backoff(1); d < 5*time.Second || d > 6*time.Second {
+		t.Fatalf("expected about 5s for the first retry, got %s", d)
+	}
+	if d := jobs.Backoff(3); d < 20*time.Second || d > 22*time.Second {
+		t.Fatalf("expected about 20s for the third retry, got %s", d)
+	}
+	if d := jobs.Backoff(40); d < time.Hour || d > time.Hour+6*time.Minute {
+		t.Fatalf("expected the delay to be capped at an hour, got %s", d)
+	}
+}
+
+func TestFailingJobIsDeadLetteredAndRetried(t *testing.T) {
+	godotenv.Load("../.env")
+	db := conf.SetupDB()
+
+	jobType := "test." + uuid.NewString()
+	key := uuid.NewString()
+	job, err := jobs.Enqueue(db, jobType, map[string]string{"hello": "world"}, jobs.EnqueueOptions{
+		UniqueKey:   key,
+		MaxAttempts: 2,
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if _, err := jobs.Enqueue(db, jobType, nil, jobs.EnqueueOptions{UniqueKey: key}); !errors.Is(err, jobs.ErrDuplicateJob) {
+		t.Fatalf("expected duplicate job error, got %v", err)
+	}
+
+	queue := jobs.NewQueue(db)
+	queue.PollInterval = 50 * time.Millisecond
+	jobs.Handle(queue, jobType, func(ctx context.Context, payload map[string]string) error {
+		return jobs.Permanent(errors.New("downstream rejected " + payload["hello"]))
+	})
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	queue.Run(ctx, 1)
+
+	var dead models.Job
+	db.First(&dead, "id = ?", job.ID)
+	if dead.Status != models.JobStatusDead || dead.Attempts != 1 {
+		t.Fatalf("expected a dead job after one attempt, got %s after %d", dead.Status, dead.Attempts)
+	}
+
+	tx := db.Begin()
+	retried, err := jobs.Retry(tx, job.ID)
+	if err != nil {
+		tx.Rollback()
+		t.Fatalf("unexpected error: %v", err)
+	}
+	tx.Commit()
+	if retried.Status != models.JobStatusQueued || retried.Attempts != 0 {
+		t.Fatalf("expected a fresh queued job, got %s with %d attempts", retried.Status, retried.Attempts)
+	}
+
+	t.Cleanup(func() {
+		db.Where("type = ?", jobType).Delete(&models.Job{})
+	})
+}
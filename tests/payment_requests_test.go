@@ -0,0 +1,99 @@
+package tests
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/eclipseron/digital-wallet-app/conf"
+	"github.com/eclipseron/digital-wallet-app/controller"
+	"github.com/eclipseron/digital-wallet-app/middleware"
+	"github.com/eclipseron/digital-wallet-app/models"
+	"github.com/eclipseron/digital-wallet-app/utils"
+	"github.com/joho/godotenv"
+)
+
+func TestPayLinkIsPaidOnce(t *testing.T) {
+	godotenv.Load("../.env")
+	db := conf.SetupDB()
+	hash, _ := utils.CreateHash(TEST_PASSWORD)
+
+	requester := models.User{Email: "requester." + TEST_EMAIL, Password: hash}
+	db.Create(&requester)
+	payer := models.User{Email: TEST_EMAIL, Password: hash}
+	db.Create(&payer)
+
+	requesterAcc := models.Account{
+		UserID:        requester.ID,
+		AccountNumber: strconv.Itoa(int(time.Now().UnixMilli())),
+	}
+	db.Create(&requesterAcc)
+	payerAcc := models.Account{
+		UserID:        payer.ID,
+		Balance:       100000,
+		AccountNumber: strconv.Itoa(int(time.Now().UnixMilli()) + 1),
+	}
+	db.Create(&payerAcc)
+
+	request := models.PaymentRequest{
+		RequesterID: requester.ID,
+		AccountID:   requesterAcc.ID,
+		Amount:      25000,
+		LinkToken:   strconv.Itoa(int(time.Now().UnixNano())),
+		ExpiresAt:   time.Now().Add(time.Hour),
+	}
+	db.Create(&request)
+
+	c := controller.NewController(db)
+	srv := http.NewServeMux()
+	srv.Handle("/api/v1/pay-links/{token}/pay",
+		middleware.RequireAuth(http.HandlerFunc(c.PayLinkHandler)))
+	token, _ := utils.CreateJWT(payer.ID, models.RoleCustomer)
+
+	pay := func() int {
+		target := fmt.Sprintf("/api/v1/pay-links/%s/pay", request.LinkToken)
+		body := fmt.Sprintf(`{"accountId":%q}`, payerAcc.ID.String())
+		req := httptest.NewRequest("POST", target, strings.NewReader(body))
+		req.Header.Set("Authorization", "Bearer "+token)
+		w := httptest.NewRecorder()
+		srv.ServeHTTP(w, req)
+		return w.Code
+	}
+
+	if code := pay(); code != http.StatusOK {
+		t.Fatalf("expected 200, got %d", code)
+	}
+	if code := pay(); code != http.StatusConflict {
+		t.Fatalf("expected 409 for a second payment, got %d", code)
+	}
+
+	var rows []models.Transactions
+	db.Where("account_id IN ?", []string{payerAcc.ID.String(), requesterAcc.ID.String()}).Find(&rows)
+	if len(rows) != 2 {
+		t.Fatalf("expected one TRANSFER_OUT and one TRANSFER_IN, got %d rows", len(rows))
+	}
+	for _, row := range rows {
+		switch {
+		case row.Type == "TRANSFER_OUT" && row.Amount == -25000:
+			if row.RelatedAccountID == nil || *row.RelatedAccountID != requesterAcc.ID {
+				t.Fatalf("expected TRANSFER_OUT to point at the requester")
+			}
+		case row.Type == "TRANSFER_IN" && row.Amount == 25000:
+			if row.RelatedAccountID == nil || *row.RelatedAccountID != payerAcc.ID {
+				t.Fatalf("expected TRANSFER_IN to point at the payer")
+			}
+		default:
+			t.Fatalf("unexpected row %s %d", row.Type, row.Amount)
+		}
+	}
+
+	t.Cleanup(func() {
+		db.Where("id = ?", request.ID).Delete(&models.PaymentRequest{})
+		db.Where("id IN ?", []string{payerAcc.ID.String(), requesterAcc.ID.String()}).Delete(&models.Account{})
+		db.Where("id IN ?", []string{payer.ID.String(), requester.ID.String()}).Delete(&models.User{})
+	})
+}
@@ -0,0 +1,105 @@
+package tests
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/eclipseron/digital-wallet-app/conf"
+	"github.com/eclipseron/digital-wallet-app/controller"
+	"github.com/eclipseron/digital-wallet-app/middleware"
+	"github.com/eclipseron/digital-wallet-app/models"
+	"github.com/eclipseron/digital-wallet-app/utils"
+	"github.com/joho/godotenv"
+)
+
+func TestPaymentIntentCanOnlyBePaidOnce(t *testing.T) {
+	godotenv.Load("../.env")
+	db := conf.SetupDB()
+	hash, _ := utils.CreateHash(TEST_PASSWORD)
+
+	payer := models.User{Email: TEST_EMAIL, Password: hash}
+	db.Create(&payer)
+	seller := models.User{Email: "merchant." + TEST_EMAIL, Password: hash}
+	db.Create(&seller)
+
+	payerAcc := models.Account{
+		UserID:        payer.ID,
+		Balance:       100000,
+		AccountNumber: strconv.Itoa(int(time.Now().UnixMilli())),
+	}
+	db.Create(&payerAcc)
+	sellerAcc := models.Account{
+		UserID:        seller.ID,
+		AccountNumber: strconv.Itoa(int(time.Now().UnixMilli()) + 1),
+	}
+	db.Create(&sellerAcc)
+
+	merchant := models.Merchant{OwnerID: seller.ID, AccountID: sellerAcc.ID, Name: "Test Shop"}
+	db.Create(&merchant)
+	intent := models.PaymentIntent{
+		MerchantID: merchant.ID,
+		Reference:  "order-1",
+		Amount:     40000,
+		ExpiresAt:  time.Now().Add(time.Hour),
+	}
+	db.Create(&intent)
+
+	c := controller.NewController(db)
+	srv := http.NewServeMux()
+	srv.Handle("/api/v1/payment-intents/{intentId}/confirm",
+		middleware.RequireAuth(http.HandlerFunc(c.ConfirmPaymentIntentHandler)))
+	token, _ := utils.CreateJWT(payer.ID, models.RoleCustomer)
+
+	confirm := func() int {
+		target := fmt.Sprintf("/api/v1/payment-intents/%s/confirm", intent.ID.String())
+		body := fmt.Sprintf(`{"accountId":%q}`, payerAcc.ID.String())
+		req := httptest.NewRequest("POST", target, strings.NewReader(body))
+		req.Header.Set("Authorization", "Bearer "+token)
+		w := httptest.NewRecorder()
+		srv.ServeHTTP(w, req)
+		return w.Code
+	}
+
+	if code := confirm(); code != http.StatusOK {
+		t.Fatalf("expected 200, got %d", code)
+	}
+	if code := confirm(); code != http.StatusConflict {
+		t.Fatalf("expected 409 for a second payment, got %d", code)
+	}
+
+	var paid models.PaymentIntent
+	db.First(&paid, "id = ?", intent.ID)
+	if paid.Status != models.PaymentIntentSucceeded || paid.TransactionID == nil {
+		t.Fatalf("expected succeeded intent with a transaction, got %s", paid.Status)
+	}
+
+	var after []models.Account
+	db.Where("id IN ?", []string{payerAcc.ID.String(), sellerAcc.ID.String()}).Find(&after)
+	for _, acc := range after {
+		if acc.ID == payerAcc.ID && acc.Balance != 60000 {
+			t.Fatalf("expected payer balance 60000, got %d", acc.Balance)
+		}
+		if acc.ID == sellerAcc.ID && acc.Balance != 40000 {
+			t.Fatalf("expected merchant balance 40000, got %d", acc.Balance)
+		}
+	}
+
+	var events int64
+	db.Model(&models.OutboxEvent{}).
+		Where("account_id = ? AND type = ?", sellerAcc.ID, models.EventPaymentSucceeded).Count(&events)
+	if events != 1 {
+		t.Fatalf("expected one payment.succeeded event, got %d", events)
+	}
+
+	t.Cleanup(func() {
+		db.Where("merchant_id = ?", merchant.ID).Delete(&models.PaymentIntent{})
+		db.Where("id = ?", merchant.ID).Delete(&models.Merchant{})
+		db.Where("id IN ?", []string{payerAcc.ID.String(), sellerAcc.ID.String()}).Delete(&models.Account{})
+		db.Where("id IN ?", []string{payer.ID.String(), seller.ID.String()}).Delete(&models.User{})
+	})
+}
@@ -0,0 +1,146 @@
+package tests
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/eclipseron/digital-wallet-app/conf"
+	"github.com/eclipseron/digital-wallet-app/models"
+	"github.com/eclipseron/digital-wallet-app/payout"
+	"github.com/eclipseron/digital-wallet-app/utils"
+	"github.com/joho/godotenv"
+	"gorm.io/gorm"
+)
+
+func TestParsePayoutFile(t *testing.T) {
+	file := strings.Join([]string{
+		"amount,bank,account_number,account_name,reference",
+		"100000,bca,1234567890,Partner One,INV-1",
+		"250000,MANDIRI,1234567890123,Partner Two,",
+		"100000,XYZ,1234567890,Partner Three,INV-3",
+		"100000,BCA,12345,Partner Four,INV-4",
+		"10000,BCA,1234567890,Partner Five,INV-5",
+		"1e5,BCA,1234567890,Partner Six,INV-6",
+		"100000,BCA,1234567890,,INV-7",
+		"100000,BNI,1234567890,Partner Eight,INV-1",
+	}, "\n")
+
+	rows, rowErrors, err := payout.Parse(strings.NewReader(file), true)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(rows) != 2 {
+		t.Fatalf("expected 2 valid rows, got %d", len(rows))
+	}
+	if rows[0].BankCode != "BCA" || rows[0].Line != 2 || rows[0].Fee != 2500 {
+		t.Fatalf("unexpected first row %+v", rows[0])
+	}
+	lines := []int{}
+	for _, e := range rowErrors {
+		lines = append(lines, e.Line)
+	}
+	if len(lines) != 6 || lines[0] != 4 || lines[5] != 9 {
+		t.Fatalf("expected lines 4 to 9 refused, got %v", rowErrors)
+	}
+	total, fees := payout.Totals(rows)
+	if total != 350000 || fees != 5000 {
+		t.Fatalf("expected 350000 and 5000 in fees, got %d and %d", total, fees)
+	}
+
+	if _, _, err := payout.Parse(strings.NewReader("bank,amount\nBCA,100000"), false); !errors.Is(err, payout.ErrFile) {
+		t.Fatalf("expected missing columns refused, got %v", err)
+	}
+	if _, _, err := payout.Parse(strings.NewReader("bank,account_number,account_name,amount\n"), false); !errors.Is(err, payout.ErrFile) {
+		t.Fatalf("expected a file without rows refused, got %v", err)
+	}
+	rows, _, _ = payout.Parse(strings.NewReader("bank,account_number,account_name,amount\nBCA,1234567890,A,50000"), false)
+	if len(rows) != 1 || rows[0].Fee != 0 {
+		t.Fatalf("expected no fee without a fee account, got %+v", rows)
+	}
+}
+
+func TestPayoutBatchExecution(t *testing.T) {
+	godotenv.Load("../.env")
+	db := conf.SetupDB()
+	hash, _ := utils.CreateHash(TEST_PASSWORD)
+
+	u := models.User{
+		Email:    TEST_EMAIL,
+		Password: hash,
+	}
+	db.Create(&u)
+
+	acc := models.Account{
+		UserID:        u.ID,
+		Balance:       500000,
+		AccountNumber: strconv.Itoa(int(time.Now().UnixMilli())),
+	}
+	db.Create(&acc)
+
+	rows, rowErrors, err := payout.Parse(strings.NewReader(
+		"bank,account_number,account_name,amount,reference\n"+
+			"BCA,1234567890,Partner One,100000,P-1\n"+
+			"BNI,1234567890,Partner Two,150000,P-2\n"), false)
+	if err != nil || len(rowErrors) > 0 {
+		t.Fatalf("unexpected errors: %v %v", err, rowErrors)
+	}
+
+	var batch *models.PayoutBatch
+	err = db.Transaction(func(tx *gorm.DB) error {
+		var err error
+		if batch, err = payout.Create(tx, acc.ID, u.ID, "partners.csv", rows); err != nil {
+			return err
+		}
+		_, err = payout.Execute(tx, acc.ID, batch.ID)
+		return err
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	var held models.Account
+	db.First(&held, "id = ?", acc.ID)
+	if held.HeldBalance != 250000 {
+		t.Fatalf("expected the whole batch held, got %d", held.HeldBalance)
+	}
+
+	if err := payout.Process(context.Background(), db, batch.ID); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	var done models.PayoutBatch
+	db.First(&done, "id = ?", batch.ID)
+	if done.Status != models.PayoutBatchStatusCompleted || done.Succeeded != 2 || done.PaidAmount != 250000 {
+		t.Fatalf("expected the batch completed, got %+v", done)
+	}
+	var after models.Account
+	db.First(&after, "id = ?", acc.ID)
+	if after.Balance != 250000 || after.HeldBalance != 0 {
+		t.Fatalf("expected 250000 left and nothing held, got %d and %d", after.Balance, after.HeldBalance)
+	}
+
+	var items []models.PayoutItem
+	db.Where("batch_id = ?", batch.ID).Order("line").Find(&items)
+	var result bytes.Buffer
+	if err := payout.WriteResult(&result, items); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if strings.Count(result.String(), ",SUCCESS,") != 2 {
+		t.Fatalf("expected every row successful, got\n%s", result.String())
+	}
+
+	t.Cleanup(func() {
+		db.Where("type = ?", payout.JobExecute).Delete(&models.Job{})
+		db.Where("user_id = ?", u.ID).Delete(&models.Notification{})
+		db.Where("batch_id = ?", batch.ID).Delete(&models.PayoutItem{})
+		db.Where("id = ?", batch.ID).Delete(&models.PayoutBatch{})
+		db.Where("account_id = ?", acc.ID).Delete(&models.Hold{})
+		db.Where("account_id = ?", acc.ID).Delete(&models.Transactions{})
+		db.Where("id = ?", acc.ID).Delete(&models.Account{})
+		db.Where("id = ?", u.ID).Delete(&models.User{})
+	})
+}
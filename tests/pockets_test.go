@@ -0,0 +1,75 @@
+package tests
+
+import (
+	"errors"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/eclipseron/digital-wallet-app/conf"
+	"github.com/eclipseron/digital-wallet-app/ledger"
+	"github.com/eclipseron/digital-wallet-app/models"
+	"github.com/eclipseron/digital-wallet-app/utils"
+	"github.com/joho/godotenv"
+	"gorm.io/gorm"
+)
+
+func TestPocketIsNotAvailableForWithdrawal(t *testing.T) {
+	godotenv.Load("../.env")
+	db := conf.SetupDB()
+	hash, _ := utils.CreateHash(TEST_PASSWORD)
+
+	u := models.User{
+		Email:    TEST_EMAIL,
+		Password: hash,
+	}
+	db.Create(&u)
+
+	acc := models.Account{
+		UserID:        u.ID,
+		Balance:       100000,
+		AccountNumber: strconv.Itoa(int(time.Now().UnixMilli())),
+	}
+	db.Create(&acc)
+
+	pocket := models.Pocket{AccountID: acc.ID, Name: "Holiday"}
+	db.Create(&pocket)
+
+	err := db.Transaction(func(tx *gorm.DB) error {
+		_, err := ledger.MovePocket(tx, acc.ID, pocket.ID, 40000)
+		return err
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	desc := "Cash Withdrawal"
+	err = db.Transaction(func(tx *gorm.DB) error {
+		_, err := ledger.Debit(tx, &models.Transactions{AccountID: acc.ID, Type: "WITHDRAW", Description: &desc}, 70000)
+		return err
+	})
+	if !errors.Is(err, ledger.ErrInsufficientBalance) {
+		t.Fatalf("expected pocket money to be unavailable, got %v", err)
+	}
+
+	db.Model(&pocket).Update("locked", true)
+	err = db.Transaction(func(tx *gorm.DB) error {
+		_, err := ledger.MovePocket(tx, acc.ID, pocket.ID, -10000)
+		return err
+	})
+	if !errors.Is(err, ledger.ErrPocketLocked) {
+		t.Fatalf("expected locked pocket to refuse, got %v", err)
+	}
+
+	var after models.Account
+	db.First(&after, "id = ?", acc.ID)
+	if after.Balance != 100000 || after.PocketBalance != 40000 {
+		t.Fatalf("expected 100000 total with 40000 in pockets, got %d and %d", after.Balance, after.PocketBalance)
+	}
+
+	t.Cleanup(func() {
+		db.Unscoped().Where("id = ?", pocket.ID).Delete(&models.Pocket{})
+		db.Where("id = ?", acc.ID).Delete(&models.Account{})
+		db.Where("id = ?", u.ID).Delete(&models.User{})
+	})
+}
@@ -0,0 +1,106 @@
+package tests
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"image/png"
+	"testing"
+
+	"github.com/eclipseron/digital-wallet-app/qrcode"
+	"github.com/eclipseron/digital-wallet-app/qris"
+)
+
+func TestQRISChecksum(t *testing.T) {
+	if crc := qris.CRC16([]byte("123456789")); crc != 0x29B1 {
+		t.Fatalf("expected 29B1, got %04X", crc)
+	}
+}
+
+func TestQRISRoundTrip(t *testing.T) {
+	in := qris.Payload{
+		Dynamic:       true,
+		AccountNumber: "1700000000000",
+		IntentID:      "6f1c1a52-8f3e-4e0b-9a8e-2f4b2f0f8d11",
+		Category:      qris.MCCMerchant,
+		Amount:        125000,
+		MerchantName:  "Warung Makan Sederhana Jaya Abadi",
+		BillNumber:    "INV-42",
+	}
+	encoded, err := in.Encode()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	out, err := qris.Parse(encoded)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !out.Dynamic || out.Amount != 125000 || out.AccountNumber != in.AccountNumber || out.IntentID != in.IntentID {
+		t.Fatalf("payload did not survive the round trip: %+v", out)
+	}
+	if out.MerchantName != "Warung Makan Sederhana Ja" || out.Currency != qris.CurrencyIDR || out.BillNumber != "INV-42" {
+		t.Fatalf("unexpected fields: %+v", out)
+	}
+
+	account := qris.Payload{Dynamic: true, AccountNumber: "1700000000001", Amount: 50000, CodeID: "0b8f1a6e-3c1d-4f2a-9d5e-7a6b5c4d3e2f"}
+	encoded2, err := account.Encode()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if out, err := qris.Parse(encoded2); err != nil || out.CodeID != account.CodeID || out.IntentID != "" {
+		t.Fatalf("expected the code id kept, got %+v %v", out, err)
+	}
+
+	tampered := []byte(encoded)
+	tampered[len(tampered)-12] ^= 1
+	if _, err := qris.Parse(string(tampered)); !errors.Is(err, qris.ErrChecksum) {
+		t.Fatalf("expected checksum error, got %v", err)
+	}
+}
+
+func TestQRISRejectsOtherIssuers(t *testing.T) {
+	tlv := func(id, value string) string { return fmt.Sprintf("%s%02d%s", id, len(value), value) }
+	body := tlv("00", "01") + tlv("01", "11") +
+		tlv("26", tlv("00", "ID.CO.OTHER.WWW")+tlv("01", "ABCD1234")) +
+		tlv("52", "5999") + tlv("53", "360") + tlv("58", "ID") + tlv("59", "Toko") + tlv("60", "JAKARTA") + "6304"
+	payload := body + fmt.Sprintf("%04X", qris.CRC16([]byte(body)))
+	if _, err := qris.Parse(payload); !errors.Is(err, qris.ErrUnsupported) {
+		t.Fatalf("expected unsupported payload, got %v", err)
+	}
+}
+
+func TestQRCodeRendersPNG(t *testing.T) {
+	p := qris.Payload{AccountNumber: "1700000000000", MerchantName: "Test"}
+	encoded, _ := p.Encode()
+
+	code, err := qrcode.Encode([]byte(encoded))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if code.Size != code.Version*4+17 {
+		t.Fatalf("unexpected size %d for version %d", code.Size, code.Version)
+	}
+	// finder pattern corners and the always dark module
+	for _, m := range [][2]int{{0, 0}, {code.Size - 1, 0}, {0, code.Size - 1}, {8, code.Size - 8}} {
+		if !code.Dark(m[0], m[1]) {
+			t.Fatalf("expected module %v to be dark", m)
+		}
+	}
+
+	var buf bytes.Buffer
+	if err := code.PNG(&buf, 4); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	img, err := png.Decode(&buf)
+	if err != nil {
+		t.Fatalf("invalid png: %v", err)
+	}
+	if side := (code.Size + 8) * 4; img.Bounds().Dx() != side {
+		t.Fatalf("expected %dpx, got %dpx", side, img.Bounds().Dx())
+	}
+
+	if _, err := qrcode.Encode(make([]byte, 1000)); !errors.Is(err, qrcode.ErrTooLong) {
+		t.Fatalf("expected too long error, got %v", err)
+	}
+}
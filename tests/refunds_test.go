@@ -0,0 +1,119 @@
+package tests
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/eclipseron/digital-wallet-app/conf"
+	"github.com/eclipseron/digital-wallet-app/controller"
+	"github.com/eclipseron/digital-wallet-app/middleware"
+	"github.com/eclipseron/digital-wallet-app/models"
+	"github.com/eclipseron/digital-wallet-app/utils"
+	"github.com/joho/godotenv"
+)
+
+func TestRefundsNeverExceedThePayment(t *testing.T) {
+	godotenv.Load("../.env")
+	db := conf.SetupDB()
+	hash, _ := utils.CreateHash(TEST_PASSWORD)
+
+	payer := models.User{Email: TEST_EMAIL, Password: hash}
+	db.Create(&payer)
+	seller := models.User{Email: "merchant." + TEST_EMAIL, Password: hash}
+	db.Create(&seller)
+
+	payerAcc := models.Account{
+		UserID:        payer.ID,
+		Balance:       100000,
+		AccountNumber: strconv.Itoa(int(time.Now().UnixMilli())),
+	}
+	db.Create(&payerAcc)
+	sellerAcc := models.Account{
+		UserID:        seller.ID,
+		Balance:       5000,
+		AccountNumber: strconv.Itoa(int(time.Now().UnixMilli()) + 1),
+	}
+	db.Create(&sellerAcc)
+
+	merchant := models.Merchant{OwnerID: seller.ID, AccountID: sellerAcc.ID, Name: "Test Shop"}
+	db.Create(&merchant)
+	intent := models.PaymentIntent{
+		MerchantID: merchant.ID,
+		Reference:  "order-1",
+		Amount:     40000,
+		ExpiresAt:  time.Now().Add(time.Hour),
+	}
+	db.Create(&intent)
+
+	c := controller.NewController(db)
+	srv := http.NewServeMux()
+	srv.Handle("/api/v1/payment-intents/{intentId}/confirm",
+		middleware.RequireAuth(http.HandlerFunc(c.ConfirmPaymentIntentHandler)))
+	srv.HandleFunc("/api/v1/merchant/refunds", func(w http.ResponseWriter, r *http.Request) {
+		ctx := context.WithValue(r.Context(), middleware.MERCHANTID, merchant.ID.String())
+		c.CreateRefundHandler(w, r.WithContext(ctx))
+	})
+	token, _ := utils.CreateJWT(payer.ID, models.RoleCustomer)
+
+	target := fmt.Sprintf("/api/v1/payment-intents/%s/confirm", intent.ID.String())
+	req := httptest.NewRequest("POST", target, strings.NewReader(fmt.Sprintf(`{"accountId":%q}`, payerAcc.ID.String())))
+	req.Header.Set("Authorization", "Bearer "+token)
+	w := httptest.NewRecorder()
+	srv.ServeHTTP(w, req)
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d", w.Code)
+	}
+
+	refund := func(body string) int {
+		req := httptest.NewRequest("POST", "/api/v1/merchant/refunds", strings.NewReader(body))
+		w := httptest.NewRecorder()
+		srv.ServeHTTP(w, req)
+		return w.Code
+	}
+	partial := fmt.Sprintf(`{"paymentIntentId":%q,"amount":30000,"reference":"rf-1"}`, intent.ID.String())
+	if code := refund(partial); code != http.StatusCreated {
+		t.Fatalf("expected 201, got %d", code)
+	}
+	if code := refund(partial); code != http.StatusOK {
+		t.Fatalf("expected 200 for a retried refund, got %d", code)
+	}
+	if code := refund(fmt.Sprintf(`{"paymentIntentId":%q,"amount":20000}`, intent.ID.String())); code != http.StatusConflict {
+		t.Fatalf("expected 409 for a refund over the captured amount, got %d", code)
+	}
+	if code := refund(fmt.Sprintf(`{"paymentIntentId":%q}`, intent.ID.String())); code != http.StatusCreated {
+		t.Fatalf("expected the rest to be refunded, got %d", code)
+	}
+	if code := refund(fmt.Sprintf(`{"paymentIntentId":%q}`, intent.ID.String())); code != http.StatusConflict {
+		t.Fatalf("expected 409 once fully refunded, got %d", code)
+	}
+
+	var paid models.PaymentIntent
+	db.First(&paid, "id = ?", intent.ID)
+	if paid.RefundedAmount != 40000 {
+		t.Fatalf("expected 40000 refunded, got %d", paid.RefundedAmount)
+	}
+	var after []models.Account
+	db.Where("id IN ?", []string{payerAcc.ID.String(), sellerAcc.ID.String()}).Find(&after)
+	for _, acc := range after {
+		if acc.ID == payerAcc.ID && acc.Balance != 100000 {
+			t.Fatalf("expected payer balance 100000, got %d", acc.Balance)
+		}
+		if acc.ID == sellerAcc.ID && acc.Balance != 5000 {
+			t.Fatalf("expected merchant balance 5000, got %d", acc.Balance)
+		}
+	}
+
+	t.Cleanup(func() {
+		db.Where("merchant_id = ?", merchant.ID).Delete(&models.Refund{})
+		db.Where("merchant_id = ?", merchant.ID).Delete(&models.PaymentIntent{})
+		db.Where("id = ?", merchant.ID).Delete(&models.Merchant{})
+		db.Where("id IN ?", []string{payerAcc.ID.String(), sellerAcc.ID.String()}).Delete(&models.Account{})
+		db.Where("id IN ?", []string{payer.ID.String(), seller.ID.String()}).Delete(&models.User{})
+	})
+}
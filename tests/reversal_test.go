@@ -0,0 +1,132 @@
+package tests
+
+import (
+	"errors"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/eclipseron/digital-wallet-app/conf"
+	"github.com/eclipseron/digital-wallet-app/ledger"
+	"github.com/eclipseron/digital-wallet-app/models"
+	"github.com/eclipseron/digital-wallet-app/utils"
+	"github.com/joho/godotenv"
+)
+
+func TestReversePartialThenRemainder(t *testing.T) {
+	godotenv.Load("../.env")
+	db := conf.SetupDB()
+	hash, _ := utils.CreateHash(TEST_PASSWORD)
+
+	u := models.User{
+		Email:    TEST_EMAIL,
+		Password: hash,
+	}
+	db.Create(&u)
+
+	acc := models.Account{
+		UserID:        u.ID,
+		Balance:       50000,
+		AccountNumber: strconv.Itoa(int(time.Now().UnixMilli())),
+	}
+	db.Create(&acc)
+
+	original := models.Transactions{AccountID: acc.ID, Amount: -50000, Type: "WITHDRAW"}
+	db.Create(&original)
+	db.Model(&models.Account{}).Where("id = ?", acc.ID).Update("balance", 0)
+
+	tx := db.Begin()
+	reversal, balance, err := ledger.Reverse(tx, original.ID, 20000, "failed payout", false)
+	if err != nil {
+		tx.Rollback()
+		t.Fatalf("unexpected error: %v", err)
+	}
+	tx.Commit()
+
+	if reversal.Amount != 20000 || balance != 20000 {
+		t.Fatalf("expected 20000 credited, got %d with balance %d", reversal.Amount, balance)
+	}
+
+	tx = db.Begin()
+	_, _, err = ledger.Reverse(tx, original.ID, 40000, "too much", false)
+	tx.Rollback()
+	if !errors.Is(err, ledger.ErrReversalAmount) {
+		t.Fatalf("expected %v, got %v", ledger.ErrReversalAmount, err)
+	}
+
+	tx = db.Begin()
+	reversal, balance, err = ledger.Reverse(tx, original.ID, 0, "rest of the payout", false)
+	if err != nil {
+		tx.Rollback()
+		t.Fatalf("unexpected error: %v", err)
+	}
+	tx.Commit()
+
+	if reversal.Amount != 30000 || balance != 50000 {
+		t.Fatalf("expected the remaining 30000 credited, got %d with balance %d", reversal.Amount, balance)
+	}
+	var reversed models.Transactions
+	db.First(&reversed, "id = ?", original.ID)
+	if reversed.ReversedAmount != 50000 || reversed.ReversedAt == nil {
+		t.Fatalf("expected the original fully reversed, got %d at %v", reversed.ReversedAmount, reversed.ReversedAt)
+	}
+
+	tx = db.Begin()
+	_, _, err = ledger.Reverse(tx, original.ID, 0, "again", false)
+	tx.Rollback()
+	if !errors.Is(err, ledger.ErrAlreadyReversed) {
+		t.Fatalf("expected %v, got %v", ledger.ErrAlreadyReversed, err)
+	}
+
+	t.Cleanup(func() {
+		db.Where("id = ?", acc.ID).Delete(&models.Account{})
+		db.Where("id = ?", u.ID).Delete(&models.User{})
+	})
+}
+
+func TestReverseRefusesTransfersAndHeldMoney(t *testing.T) {
+	godotenv.Load("../.env")
+	db := conf.SetupDB()
+	hash, _ := utils.CreateHash(TEST_PASSWORD)
+
+	u := models.User{
+		Email:    TEST_EMAIL,
+		Password: hash,
+	}
+	db.Create(&u)
+
+	acc := models.Account{
+		UserID:        u.ID,
+		Balance:       50000,
+		HeldBalance:   40000,
+		AccountNumber: strconv.Itoa(int(time.Now().UnixMilli())),
+	}
+	db.Create(&acc)
+
+	other := acc.ID
+	internal := models.Transactions{AccountID: acc.ID, Amount: -10000, Type: "TRANSFER_OUT", RelatedAccountID: &other}
+	db.Create(&internal)
+	topUp := models.Transactions{AccountID: acc.ID, Amount: 50000, Type: "TRANSFER_IN"}
+	db.Create(&topUp)
+
+	tx := db.Begin()
+	_, _, err := ledger.Reverse(tx, internal.ID, 0, "wrong recipient", false)
+	tx.Rollback()
+	if !errors.Is(err, ledger.ErrInternalTransfer) {
+		t.Fatalf("expected %v, got %v", ledger.ErrInternalTransfer, err)
+	}
+
+	// only 10000 is available, the rest is held
+	tx = db.Begin()
+	_, _, err = ledger.Reverse(tx, topUp.ID, 20000, "chargeback", false)
+	tx.Rollback()
+	if !errors.Is(err, ledger.ErrInsufficientBalance) {
+		t.Fatalf("expected %v, got %v", ledger.ErrInsufficientBalance, err)
+	}
+
+	t.Cleanup(func() {
+		db.Where("account_id = ?", acc.ID).Delete(&models.Transactions{})
+		db.Where("id = ?", acc.ID).Delete(&models.Account{})
+		db.Where("id = ?", u.ID).Delete(&models.User{})
+	})
+}
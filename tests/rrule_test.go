@@ -0,0 +1,66 @@
+package tests
+
+import (
+	"testing"
+	"time"
+
+	"github.com/eclipseron/digital-wallet-app/scheduler"
+)
+
+func TestRuleMonthlyClampsToLastDay(t *testing.T) {
+	rule, err := scheduler.ParseRule("FREQ=MONTHLY;BYMONTHDAY=31")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	start := time.Date(2024, time.January, 31, 9, 0, 0, 0, time.UTC)
+	next, ok := rule.Next(start, start)
+	if !ok {
+		t.Fatal("expected a next occurrence")
+	}
+	expected := time.Date(2024, time.February, 29, 9, 0, 0, 0, time.UTC)
+	if !next.Equal(expected) {
+		t.Fatalf("expected %s, got %s", expected, next)
+	}
+}
+
+func TestRuleWeeklyByDayStopsAtUntil(t *testing.T) {
+	rule, err := scheduler.ParseRule("RRULE:FREQ=WEEKLY;BYDAY=MO,FR;UNTIL=20240112T000000Z")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	// 2024-01-03 is a Wednesday
+	start := time.Date(2024, time.January, 3, 8, 0, 0, 0, time.UTC)
+	var got []time.Time
+	after := start.Add(-time.Nanosecond)
+	for {
+		next, ok := rule.Next(start, after)
+		if !ok {
+			break
+		}
+		got = append(got, next)
+		after = next
+	}
+
+	expected := []time.Time{
+		time.Date(2024, time.January, 5, 8, 0, 0, 0, time.UTC),
+		time.Date(2024, time.January, 8, 8, 0, 0, 0, time.UTC),
+	}
+	if len(got) != len(expected) {
+		t.Fatalf("expected %d occurrences, got %v", len(expected), got)
+	}
+	for i := range expected {
+		if !got[i].Equal(expected[i]) {
+			t.Fatalf("expected %s, got %s", expected[i], got[i])
+		}
+	}
+}
+
+func TestRuleRejectsUnsupportedParts(t *testing.T) {
+	for _, s := range []string{"", "FREQ=HOURLY", "FREQ=DAILY;BYDAY=MO", "FREQ=MONTHLY;BYSETPOS=1"} {
+		if _, err := scheduler.ParseRule(s); err == nil {
+			t.Fatalf("expected %q to be rejected", s)
+		}
+	}
+}
@@ -0,0 +1,57 @@
+package tests
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/eclipseron/digital-wallet-app/settlement"
+)
+
+func TestSettlementDayUsesJakartaCutoff(t *testing.T) {
+	// 17:30 UTC is 00:30 the next day in Jakarta
+	at := time.Date(2024, 3, 1, 17, 30, 0, 0, time.UTC)
+	if day := settlement.Day(at, 0).Format(time.DateOnly); day != "2024-03-02" {
+		t.Fatalf("expected 2024-03-02, got %s", day)
+	}
+	// with a 01:00 cutoff it still belongs to the previous business day
+	if day := settlement.Day(at, time.Hour).Format(time.DateOnly); day != "2024-03-01" {
+		t.Fatalf("expected 2024-03-01, got %s", day)
+	}
+
+	from, _ := settlement.ParseDate("2024-03-01")
+	start, end := settlement.Window(from, from, time.Hour)
+	if !start.Equal(time.Date(2024, 2, 29, 18, 0, 0, 0, time.UTC)) || end.Sub(start) != 24*time.Hour {
+		t.Fatalf("unexpected window %s - %s", start, end)
+	}
+}
+
+func TestSettlementReportRows(t *testing.T) {
+	if fee := settlement.Fee(12345, 70); fee != 86 {
+		t.Fatalf("expected fee 86, got %d", fee)
+	}
+
+	from, _ := settlement.ParseDate("2024-03-01")
+	totals := []settlement.Row{{Date: "2024-03-02", Payments: 2, Gross: 100000, Fees: 700, Refunds: 20000, RefundCount: 1}}
+	now := time.Date(2024, 3, 2, 12, 0, 0, 0, settlement.Location)
+	rows := settlement.Fill(totals, from, 3, now, 0)
+	if len(rows) != 3 || rows[0].Gross != 0 || rows[1].Net != 79300 {
+		t.Fatalf("unexpected rows %+v", rows)
+	}
+	if !rows[0].Final || rows[1].Final || rows[2].Final {
+		t.Fatalf("only closed days are final: %+v", rows)
+	}
+	if total := settlement.Sum(rows); total.Net != 79300 || total.Final {
+		t.Fatalf("unexpected total %+v", total)
+	}
+
+	var buf bytes.Buffer
+	if err := settlement.WriteCSV(&buf, rows); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(lines) != 4 || lines[2] != "2024-03-02,2,100000,700,20000,1,79300,false" {
+		t.Fatalf("unexpected csv %q", buf.String())
+	}
+}
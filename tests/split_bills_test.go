@@ -0,0 +1,58 @@
+package tests
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/eclipseron/digital-wallet-app/billsplit"
+)
+
+func sumShares(shares []int64) (total int64) {
+	for _, s := range shares {
+		total += s
+	}
+	return total
+}
+
+func TestSplitEqual(t *testing.T) {
+	shares, err := billsplit.Equal(100000, 3)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if shares[0] != 33334 || shares[1] != 33333 || shares[2] != 33333 {
+		t.Fatalf("unexpected shares %v", shares)
+	}
+	if _, err := billsplit.Equal(100000, 0); !errors.Is(err, billsplit.ErrNoParticipants) {
+		t.Fatalf("expected no participants error, got %v", err)
+	}
+}
+
+func TestSplitByPercent(t *testing.T) {
+	// 33.33% / 33.33% / 33.34% of 1001
+	shares, err := billsplit.ByPercent(1001, []int64{3333, 3333, 3334})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if sumShares(shares) != 1001 {
+		t.Fatalf("shares %v do not add up to 1001", shares)
+	}
+	if shares[2] != 334 {
+		t.Fatalf("expected the largest fraction to get the remainder, got %v", shares)
+	}
+
+	if _, err := billsplit.ByPercent(1000, []int64{5000, 4000}); !errors.Is(err, billsplit.ErrPercentTotal) {
+		t.Fatalf("expected percent total error, got %v", err)
+	}
+}
+
+func TestSplitCustom(t *testing.T) {
+	if _, err := billsplit.Custom(50000, []int64{20000, 30000}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if _, err := billsplit.Custom(50000, []int64{20000, 20000}); !errors.Is(err, billsplit.ErrAmountMismatch) {
+		t.Fatalf("expected amount mismatch, got %v", err)
+	}
+	if _, err := billsplit.Custom(50000, []int64{60000, -10000}); !errors.Is(err, billsplit.ErrAmountMismatch) {
+		t.Fatalf("expected amount mismatch, got %v", err)
+	}
+}
@@ -0,0 +1,143 @@
+package tests
+
+import (
+	"bytes"
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/eclipseron/digital-wallet-app/settlement"
+	"github.com/eclipseron/digital-wallet-app/statement"
+	"github.com/google/uuid"
+)
+
+func renderStatement(t *testing.T, format string, rows int) string {
+	from := time.Date(2024, 3, 1, 0, 0, 0, 0, settlement.Location)
+	s := &statement.Summary{
+		AccountNumber: "1700000000000",
+		Holder:        "Test (User)",
+		From:          from,
+		To:            from.AddDate(0, 1, 0),
+		Location:      settlement.Location,
+		Opening:       500000,
+		GeneratedAt:   from,
+	}
+	var buf bytes.Buffer
+	w, err := statement.NewWriter(format, &buf)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	w.Begin(s)
+	desc, bank, ext := "Bank Withdrawal & <fee>", "BCA", "1234567890"
+	balance := s.Opening
+	for i := 0; i < rows; i++ {
+		e := statement.Entry{
+			ID: uuid.New(), At: from.Add(time.Duration(i) * time.Hour), Type: "TRANSFER_OUT",
+			Description: &desc, BankName: &bank, ExternalAccount: &ext, Amount: -1000,
+		}
+		balance += e.Amount
+		e.Balance = balance
+		s.Debits += 1000
+		s.Count++
+		if err := w.Entry(&e); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+	s.Closing = balance
+	if err := w.End(s); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	return buf.String()
+}
+
+func TestStatementCSVRunningBalance(t *testing.T) {
+	out := renderStatement(t, statement.FormatCSV, 2)
+	lines := strings.Split(strings.TrimSpace(out), "\n")
+	if len(lines) != 5 {
+		t.Fatalf("expected header, opening, 2 rows and closing, got %q", out)
+	}
+	if !strings.HasSuffix(lines[1], "Opening balance,,,,500000") || !strings.HasSuffix(lines[3], ",BCA,1234567890,-1000,498000") {
+		t.Fatalf("unexpected rows %q", out)
+	}
+	if !strings.HasSuffix(lines[4], "Closing balance,,,,498000") {
+		t.Fatalf("unexpected closing row %q", lines[4])
+	}
+}
+
+func TestStatementOFXIsWellFormed(t *testing.T) {
+	out := renderStatement(t, statement.FormatOFX, 3)
+	dec := xml.NewDecoder(strings.NewReader(out))
+	transactions := 0
+	for {
+		tok, err := dec.Token()
+		if err != nil {
+			break
+		}
+		if el, ok := tok.(xml.StartElement); ok && el.Name.Local == "STMTTRN" {
+			transactions++
+		}
+	}
+	if transactions != 3 {
+		t.Fatalf("expected 3 transactions, got %d", transactions)
+	}
+	if !strings.Contains(out, "<BALAMT>497000.00</BALAMT>") || !strings.Contains(out, "[+7:WIB]") {
+		t.Fatalf("unexpected ofx %s", out)
+	}
+}
+
+func TestStatementPDFPages(t *testing.T) {
+	out := renderStatement(t, statement.FormatPDF, 200)
+	if !strings.HasPrefix(out, "%PDF-1.4") || !strings.HasSuffix(out, "%%EOF\n") {
+		t.Fatalf("not a pdf")
+	}
+	if pages := strings.Count(out, "/Type /Page "); pages < 5 || !strings.Contains(out, "/Count ") {
+		t.Fatalf("expected the rows to spread over several pages, got %d", pages)
+	}
+	if _, err := statement.NewWriter("xls", &bytes.Buffer{}); !errors.Is(err, statement.ErrFormat) {
+		t.Fatalf("expected format error, got %v", err)
+	}
+	if s := statement.FormatAmount(-1234567); s != "-1.234.567" {
+		t.Fatalf("unexpected amount %s", s)
+	}
+}
+
+func TestMonthlyStatementIsReproducible(t *testing.T) {
+	first := renderStatement(t, statement.FormatJSON, 3)
+	second := renderStatement(t, statement.FormatJSON, 3)
+	// entry ids are random in renderStatement, compare everything around them
+	strip := func(s string) string {
+		var b strings.Builder
+		for _, part := range strings.Split(s, `"transactionId":"`) {
+			if i := strings.IndexByte(part, '"'); i == 36 {
+				part = part[36:]
+			}
+			b.WriteString(part)
+		}
+		return b.String()
+	}
+	if strip(first) != strip(second) {
+		t.Fatalf("rendering the same statement twice differs:\n%s\n%s", first, second)
+	}
+
+	var doc struct {
+		Opening int64            `json:"openingBalance"`
+		Entries []map[string]any `json:"entries"`
+	}
+	if err := json.Unmarshal([]byte(first), &doc); err != nil {
+		t.Fatalf("invalid json: %v", err)
+	}
+	if doc.Opening != 500000 || len(doc.Entries) != 3 || doc.Entries[2]["balance"] != float64(497000) {
+		t.Fatalf("unexpected document %s", first)
+	}
+	if statement.Hash([]byte(first)) == statement.Hash([]byte(second)) {
+		t.Fatalf("expected different documents to hash differently")
+	}
+
+	period, start, end := statement.Month(time.Date(2024, 2, 29, 17, 30, 0, 0, time.UTC))
+	if period != "2024-03" || end.Sub(start) != 31*24*time.Hour {
+		t.Fatalf("unexpected month %s %s - %s", period, start, end)
+	}
+}
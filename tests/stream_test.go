@@ -0,0 +1,117 @@
+package tests
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/eclipseron/digital-wallet-app/conf"
+	"github.com/eclipseron/digital-wallet-app/controller"
+	"github.com/eclipseron/digital-wallet-app/ledger"
+	"github.com/eclipseron/digital-wallet-app/middleware"
+	"github.com/eclipseron/digital-wallet-app/models"
+	"github.com/eclipseron/digital-wallet-app/stream"
+	"github.com/eclipseron/digital-wallet-app/utils"
+	"github.com/joho/godotenv"
+)
+
+func TestAccountEventsReplayAndLive(t *testing.T) {
+	godotenv.Load("../.env")
+	db := conf.SetupDB()
+	hash, _ := utils.CreateHash(TEST_PASSWORD)
+
+	u := models.User{
+		Email:    TEST_EMAIL,
+		Password: hash,
+	}
+	db.Create(&u)
+
+	acc := models.Account{
+		UserID:        u.ID,
+		AccountNumber: strconv.Itoa(int(time.Now().UnixMilli())),
+	}
+	db.Create(&acc)
+
+	credit := func(amount int64) {
+		tx := db.Begin()
+		entry := models.Transactions{AccountID: acc.ID, Type: "TRANSFER_IN"}
+		if _, err := ledger.Credit(tx, &entry, amount); err != nil {
+			tx.Rollback()
+			t.Fatalf("unexpected error: %v", err)
+		}
+		tx.Commit()
+	}
+	credit(10000)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	c := controller.NewController(db)
+	c.Events = stream.NewHub(db)
+	go c.Events.Run(ctx)
+
+	mux := http.NewServeMux()
+	mux.Handle("/api/v1/accounts/{accountId}/events",
+		middleware.RequireAuth(http.HandlerFunc(c.AccountEventsHandler)))
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+
+	target := fmt.Sprintf("%s/api/v1/accounts/%s/events", srv.URL, acc.ID.String())
+	req, _ := http.NewRequestWithContext(ctx, "GET", target, nil)
+	token, _ := utils.CreateJWT(u.ID, models.RoleCustomer)
+	req.Header.Set("Authorization", "Bearer "+token)
+	req.Header.Set("Last-Event-ID", "0")
+
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		t.Fatalf("expected 200, got %d", res.StatusCode)
+	}
+
+	events := make(chan string, 16)
+	go func() {
+		scanner := bufio.NewScanner(res.Body)
+		for scanner.Scan() {
+			if line := scanner.Text(); strings.HasPrefix(line, "event: ") {
+				events <- strings.TrimPrefix(line, "event: ")
+			}
+		}
+	}()
+	next := func() string {
+		select {
+		case e := <-events:
+			return e
+		case <-time.After(3 * time.Second):
+			t.Fatal("timed out waiting for an event")
+			return ""
+		}
+	}
+
+	// the credit made before connecting is replayed
+	if e := next(); e != models.EventTransactionCreated {
+		t.Fatalf("expected %s, got %s", models.EventTransactionCreated, e)
+	}
+	if e := next(); e != models.EventBalanceChanged {
+		t.Fatalf("expected %s, got %s", models.EventBalanceChanged, e)
+	}
+
+	// give the hub a moment to LISTEN, then a new credit arrives live
+	time.Sleep(200 * time.Millisecond)
+	credit(20000)
+	if e := next(); e != models.EventTransactionCreated {
+		t.Fatalf("expected live %s, got %s", models.EventTransactionCreated, e)
+	}
+
+	t.Cleanup(func() {
+		db.Where("id = ?", acc.ID).Delete(&models.Account{})
+		db.Where("id = ?", u.ID).Delete(&models.User{})
+	})
+}
@@ -0,0 +1,119 @@
+package tests
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/eclipseron/digital-wallet-app/conf"
+	"github.com/eclipseron/digital-wallet-app/jobs"
+	"github.com/eclipseron/digital-wallet-app/ledger"
+	"github.com/eclipseron/digital-wallet-app/models"
+	"github.com/eclipseron/digital-wallet-app/utils"
+	"github.com/eclipseron/digital-wallet-app/webhooks"
+	"github.com/joho/godotenv"
+)
+
+func TestWebhookSignature(t *testing.T) {
+	body := []byte(`{"type":"balance.changed"}`)
+	signature := webhooks.Sign("whsec_test", 1700000000, body)
+
+	mac := hmac.New(sha256.New, []byte("whsec_test"))
+	mac.Write([]byte("1700000000." + string(body)))
+	expected := "t=1700000000,v1=" + hex.EncodeToString(mac.Sum(nil))
+	if signature != expected {
+		t.Fatalf("expected %s, got %s", expected, signature)
+	}
+}
+
+func TestWebhookDeliversAccountEventsInOrder(t *testing.T) {
+	godotenv.Load("../.env")
+	db := conf.SetupDB()
+	hash, _ := utils.CreateHash(TEST_PASSWORD)
+
+	u := models.User{
+		Email:    TEST_EMAIL,
+		Password: hash,
+	}
+	db.Create(&u)
+
+	acc := models.Account{
+		UserID:        u.ID,
+		AccountNumber: strconv.Itoa(int(time.Now().UnixMilli())),
+	}
+	db.Create(&acc)
+
+	var mu sync.Mutex
+	var received []webhooks.Body
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		raw, _ := io.ReadAll(r.Body)
+		if !strings.HasPrefix(r.Header.Get("X-Webhook-Signature"), "t=") {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		var body webhooks.Body
+		json.Unmarshal(raw, &body)
+		if body.AccountID != nil && *body.AccountID == acc.ID {
+			mu.Lock()
+			received = append(received, body)
+			mu.Unlock()
+		}
+	}))
+	defer srv.Close()
+
+	endpoint := models.WebhookEndpoint{
+		URL:        srv.URL,
+		Secret:     "whsec_test",
+		EventTypes: models.EventTransactionCreated,
+		Active:     true,
+	}
+	db.Create(&endpoint)
+
+	for _, amount := range []int64{10000, 20000, 30000} {
+		tx := db.Begin()
+		entry := models.Transactions{AccountID: acc.ID, Type: "TRANSFER_IN"}
+		if _, err := ledger.Credit(tx, &entry, amount); err != nil {
+			tx.Rollback()
+			t.Fatalf("unexpected error: %v", err)
+		}
+		tx.Commit()
+	}
+
+	if _, err := webhooks.Dispatch(db); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	queue := jobs.NewQueue(db)
+	queue.PollInterval = 50 * time.Millisecond
+	webhooks.Register(queue, db)
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	queue.Run(ctx, 2)
+
+	mu.Lock()
+	defer mu.Unlock()
+	if len(received) != 3 {
+		t.Fatalf("expected 3 events, got %d", len(received))
+	}
+	for i := 1; i < len(received); i++ {
+		if received[i].Position <= received[i-1].Position {
+			t.Fatalf("expected events in position order, got %d after %d",
+				received[i].Position, received[i-1].Position)
+		}
+	}
+
+	t.Cleanup(func() {
+		db.Where("id = ?", endpoint.ID).Delete(&models.WebhookEndpoint{})
+		db.Where("id = ?", acc.ID).Delete(&models.Account{})
+		db.Where("id = ?", u.ID).Delete(&models.User{})
+	})
+}
@@ -44,7 +44,7 @@ func TestWithdrawSuccess(t *testing.T) {
 	srv.Handle("/api/v1/transaction/withdraw",
 		middleware.RequireAuth(http.HandlerFunc(c.WithdrawHandler)))
 
-	token, _ := utils.CreateJWT(u.ID)
+	token, _ := utils.CreateJWT(u.ID, models.RoleCustomer)
 
 	body := strings.NewReader(fmt.Sprintf(`{"amount": %d, "accountId":"%s"}`, 50000, acc.ID.String()))
 	req := httptest.NewRequest("POST", "/api/v1/transaction/withdraw", body)
@@ -111,7 +111,7 @@ func TestWithdrawInsufficientBalance(t *testing.T) {
 	srv.Handle("/api/v1/transaction/withdraw",
 		middleware.RequireAuth(http.HandlerFunc(c.WithdrawHandler)))
 
-	token, _ := utils.CreateJWT(u.ID)
+	token, _ := utils.CreateJWT(u.ID, models.RoleCustomer)
 
 	body := strings.NewReader(fmt.Sprintf(`{"amount": %d, "accountId":"%s"}`, 100000, acc.ID.String()))
 	req := httptest.NewRequest("POST", "/api/v1/transaction/withdraw", body)
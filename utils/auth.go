@@ -4,6 +4,8 @@ import (
 	"crypto/rand"
 	"encoding/base64"
 	"fmt"
+	"net"
+	"net/http"
 	"os"
 	"strings"
 	"time"
@@ -45,15 +47,84 @@ func IsValid(encoded, password string) bool {
 	return string(hash) == string(expectedHash)
 }
 
-func CreateJWT(userID uuid.UUID) (string, error) {
+func CreateJWT(userID uuid.UUID, role string) (string, error) {
 	godotenv.Load()
 	secret := os.Getenv("JWT_SECRET")
 	claims := jwt.MapClaims{
-		"sub": userID.String(),
-		"exp": time.Now().Add(time.Hour * 24).Unix(), // 24h
-		"iat": time.Now().Unix(),
+		"sub":  userID.String(),
+		"role": role,
+		"exp":  time.Now().Add(time.Hour * 24).Unix(), // 24h
+		"iat":  time.Now().Unix(),
 	}
 
 	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
 	return token.SignedString([]byte(secret))
 }
+
+// TrustedProxies reads TRUSTED_PROXIES, the comma separated addresses or
+// CIDR ranges of the load balancers allowed to set X-Forwarded-For.
+func TrustedProxies() []*net.IPNet {
+	var nets []*net.IPNet
+	for _, entry := range strings.Split(os.Getenv("TRUSTED_PROXIES"), ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		if !strings.Contains(entry, "/") {
+			if ip := net.ParseIP(entry); ip != nil {
+				bits := 8 * len(ip.To16())
+				if ip.To4() != nil {
+					ip, bits = ip.To4(), 32
+				}
+				nets = append(nets, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+			}
+			continue
+		}
+		if _, n, err := net.ParseCIDR(entry); err == nil {
+			nets = append(nets, n)
+		}
+	}
+	return nets
+}
+
+func trusted(ip net.IP, proxies []*net.IPNet) bool {
+	for _, n := range proxies {
+		if n.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// ClientIP is the address of the client. X-Forwarded-For is only honoured
+// when the connection comes from one of TrustedProxies, the hops are then
+// read from the right and the first one that is not a trusted proxy wins. An
+// address that does not parse is never returned, the result is empty when
+// even the connection address is unusable.
+func ClientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	ip := net.ParseIP(host)
+	if ip == nil {
+		return ""
+	}
+
+	proxies := TrustedProxies()
+	if !trusted(ip, proxies) {
+		return ip.String()
+	}
+	hops := strings.Split(strings.Join(r.Header.Values("X-Forwarded-For"), ","), ",")
+	for i := len(hops) - 1; i >= 0; i-- {
+		hop := net.ParseIP(strings.TrimSpace(hops[i]))
+		if hop == nil {
+			break
+		}
+		ip = hop
+		if !trusted(hop, proxies) {
+			break
+		}
+	}
+	return ip.String()
+}
@@ -0,0 +1,302 @@
+package webhooks
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/eclipseron/digital-wallet-app/jobs"
+	"github.com/eclipseron/digital-wallet-app/models"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// JobDeliver is the job type that delivers the pending deliveries of one
+// endpoint and account in order.
+const JobDeliver = "webhook.deliver"
+
+var ErrDeliveryNotFound = errors.New("delivery not found")
+
+type deliverPayload struct {
+	EndpointID uuid.UUID  `json:"endpointId"`
+	AccountID  *uuid.UUID `json:"accountId"`
+}
+
+// Body is what an endpoint receives. Position orders the events of an
+// account, receivers should use it to drop replays they already applied.
+type Body struct {
+	ID        uuid.UUID       `json:"id"`
+	Type      string          `json:"type"`
+	AccountID *uuid.UUID      `json:"accountId"`
+	Position  int64           `json:"position"`
+	CreatedAt time.Time       `json:"createdAt"`
+	Data      json.RawMessage `json:"data"`
+}
+
+// NewSecret returns a random signing secret for a new endpoint.
+func NewSecret() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return "whsec_" + hex.EncodeToString(b), nil
+}
+
+// Sign returns the X-Webhook-Signature value for body, an HMAC-SHA256 over
+// "<timestamp>.<body>" keyed with the endpoint secret.
+func Sign(secret string, timestamp int64, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	fmt.Fprintf(mac, "%d.", timestamp)
+	mac.Write(body)
+	return fmt.Sprintf("t=%d,v1=%s", timestamp, hex.EncodeToString(mac.Sum(nil)))
+}
+
+func maxAttempts() int {
+	if n, err := strconv.Atoi(os.Getenv("WEBHOOK_MAX_ATTEMPTS")); err == nil && n > 0 {
+		return n
+	}
+	return 8
+}
+
+// Dispatch copies new outbox events into the delivery log of every active
+// endpoint that wants them, then queues a delivery job for each endpoint and
+// account with a due delivery. It returns how many events were dispatched.
+func Dispatch(db *gorm.DB) (int, error) {
+	dispatched := 0
+	err := db.Transaction(func(tx *gorm.DB) error {
+		// one dispatcher at a time keeps deliveries in position order
+		var locked bool
+		if err := tx.Raw(`SELECT pg_try_advisory_xact_lock(hashtext('outbox_dispatch'))`).Scan(&locked).Error; err != nil {
+			return err
+		}
+		if !locked {
+			return nil
+		}
+
+		var events []models.OutboxEvent
+		err := tx.Raw(`
+		SELECT * FROM outbox_events WHERE dispatched_at IS NULL ORDER BY position LIMIT 500
+		`).Scan(&events).Error
+		if err != nil || len(events) == 0 {
+			return err
+		}
+
+		var endpoints []models.WebhookEndpoint
+		if err := tx.Where("active = ?", true).Find(&endpoints).Error; err != nil {
+			return err
+		}
+
+		ids := make([]uuid.UUID, 0, len(events))
+		for _, event := range events {
+			for _, endpoint := range endpoints {
+				if !endpoint.Accepts(event.Type, event.AccountID) {
+					continue
+				}
+				err := tx.Exec(`
+				INSERT INTO webhook_deliveries
+					(event_id, endpoint_id, account_id, position, status, next_attempt_at, created_at, updated_at)
+				VALUES (?, ?, ?, ?, ?, now(), now(), now())
+				ON CONFLICT (event_id, endpoint_id) DO NOTHING
+				`, event.ID, endpoint.ID, event.AccountID, event.Position, models.DeliveryStatusPending).Error
+				if err != nil {
+					return err
+				}
+			}
+			ids = append(ids, event.ID)
+		}
+		dispatched = len(ids)
+		return tx.Exec(`UPDATE outbox_events SET dispatched_at = now() WHERE id IN ?`, ids).Error
+	})
+	if err != nil {
+		return dispatched, err
+	}
+
+	var due []deliverPayload
+	err = db.Raw(`
+	SELECT DISTINCT d.endpoint_id, d.account_id
+	FROM webhook_deliveries d JOIN webhook_endpoints e ON e.id = d.endpoint_id
+	WHERE d.status = ? AND d.next_attempt_at <= now() AND e.active
+	`, models.DeliveryStatusPending).Scan(&due).Error
+	if err != nil {
+		return dispatched, err
+	}
+	for _, p := range due {
+		key := "webhook:" + p.EndpointID.String()
+		if p.AccountID != nil {
+			key += ":" + p.AccountID.String()
+		}
+		_, err := jobs.Enqueue(db, JobDeliver, p, jobs.EnqueueOptions{UniqueKey: key})
+		if err != nil && !errors.Is(err, jobs.ErrDuplicateJob) {
+			return dispatched, err
+		}
+	}
+	return dispatched, nil
+}
+
+// Run dispatches the outbox every interval until ctx is done.
+func Run(ctx context.Context, db *gorm.DB, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if _, err := Dispatch(db); err != nil {
+				log.Println("failed to dispatch outbox:", err)
+			}
+		}
+	}
+}
+
+// Register adds the delivery job handler to the queue.
+func Register(q *jobs.Queue, db *gorm.DB) {
+	client := &http.Client{Timeout: 10 * time.Second}
+	jobs.Handle(q, JobDeliver, func(ctx context.Context, p deliverPayload) error {
+		return deliver(ctx, db, client, p)
+	})
+}
+
+// deliver sends the pending deliveries of one endpoint and account oldest
+// first. It stops at the first delivery that has to wait for a retry, so a
+// later event is never delivered before an earlier one.
+func deliver(ctx context.Context, db *gorm.DB, client *http.Client, p deliverPayload) error {
+	var endpoint models.WebhookEndpoint
+	if err := db.First(&endpoint, "id = ?", p.EndpointID).Error; err != nil {
+		return err
+	}
+	limit := maxAttempts()
+
+	for ctx.Err() == nil && endpoint.Active {
+		var delivery models.WebhookDelivery
+		res := db.Raw(`
+		SELECT * FROM webhook_deliveries
+		WHERE endpoint_id = ? AND account_id IS NOT DISTINCT FROM ? AND status = ?
+		ORDER BY position LIMIT 1
+		`, p.EndpointID, p.AccountID, models.DeliveryStatusPending).Scan(&delivery)
+		if res.Error != nil {
+			return res.Error
+		}
+		if res.RowsAffected == 0 || delivery.NextAttemptAt.After(time.Now()) {
+			return nil
+		}
+
+		var event models.OutboxEvent
+		if err := db.First(&event, "id = ?", delivery.EventID).Error; err != nil {
+			return err
+		}
+
+		delivery.Attempts++
+		code, err := send(ctx, client, &endpoint, &event, delivery.Attempts)
+		if code != 0 {
+			delivery.LastStatusCode = &code
+		}
+		now := time.Now()
+		switch {
+		case err == nil:
+			delivery.Status = models.DeliveryStatusDelivered
+			delivery.DeliveredAt = &now
+			delivery.LastError = nil
+		case delivery.Attempts >= limit:
+			// give up on this one, it can be replayed later
+			detail := err.Error()
+			delivery.Status = models.DeliveryStatusFailed
+			delivery.LastError = &detail
+		default:
+			detail := err.Error()
+			delivery.LastError = &detail
+			delivery.NextAttemptAt = now.Add(jobs.Backoff(delivery.Attempts))
+		}
+
+		err = db.Model(&delivery).Select(
+			"status", "attempts", "next_attempt_at", "last_status_code", "last_error", "delivered_at", "updated_at",
+		).Updates(&delivery).Error
+		if err != nil {
+			return err
+		}
+		if delivery.Status == models.DeliveryStatusPending {
+			return nil
+		}
+	}
+	return nil
+}
+
+// send posts one event and returns the response status code. Anything but a
+// 2xx is an error.
+func send(ctx context.Context, client *http.Client, endpoint *models.WebhookEndpoint, event *models.OutboxEvent, attempt int) (int, error) {
+	body, err := json.Marshal(Body{
+		ID:        event.ID,
+		Type:      event.Type,
+		AccountID: event.AccountID,
+		Position:  event.Position,
+		CreatedAt: event.CreatedAt.UTC(),
+		Data:      json.RawMessage(event.Payload),
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint.URL, bytes.NewReader(body))
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "digital-wallet-webhooks/1.0")
+	req.Header.Set("X-Webhook-Id", event.ID.String())
+	req.Header.Set("X-Webhook-Event", event.Type)
+	req.Header.Set("X-Webhook-Attempt", strconv.Itoa(attempt))
+	req.Header.Set("X-Webhook-Signature", Sign(endpoint.Secret, time.Now().Unix(), body))
+
+	res, err := client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer res.Body.Close()
+	if res.StatusCode < 200 || res.StatusCode > 299 {
+		snippet, _ := io.ReadAll(io.LimitReader(res.Body, 1024))
+		return res.StatusCode, fmt.Errorf("endpoint answered %d: %s", res.StatusCode, snippet)
+	}
+	return res.StatusCode, nil
+}
+
+// Replay puts one delivery back into the queue with fresh attempts.
+func Replay(tx *gorm.DB, deliveryID uuid.UUID) (*models.WebhookDelivery, error) {
+	var delivery models.WebhookDelivery
+	res := tx.Raw(`
+	UPDATE webhook_deliveries
+	SET status = ?, attempts = 0, next_attempt_at = now(), delivered_at = NULL, updated_at = now()
+	WHERE id = ?
+	RETURNING *
+	`, models.DeliveryStatusPending, deliveryID.String()).Scan(&delivery)
+	if res.Error != nil {
+		return nil, res.Error
+	}
+	if res.RowsAffected == 0 {
+		return nil, ErrDeliveryNotFound
+	}
+	return &delivery, nil
+}
+
+// ReplayRange puts every delivery to an endpoint whose event was created
+// within [from, to) back into the queue and returns how many were replayed.
+func ReplayRange(tx *gorm.DB, endpointID uuid.UUID, from, to time.Time) (int64, error) {
+	res := tx.Exec(`
+	UPDATE webhook_deliveries d
+	SET status = ?, attempts = 0, next_attempt_at = now(), delivered_at = NULL, updated_at = now()
+	FROM outbox_events e
+	WHERE e.id = d.event_id AND d.endpoint_id = ? AND e.created_at >= ? AND e.created_at < ?
+	`, models.DeliveryStatusPending, endpointID.String(), from, to)
+	return res.RowsAffected, res.Error
+}